@@ -73,6 +73,12 @@ func (s *baseBootenvSuite) SetUpTest(c *C) {
 	s.cmdlineFile = filepath.Join(c.MkDir(), "cmdline")
 	restore = kcmdline.MockProcCmdline(s.cmdlineFile)
 	s.AddCleanup(restore)
+
+	// the mocked kernels have no embedded command line
+	restore = boot.MockKernelEmbeddedCommandLine(func(string) (string, bool, error) {
+		return "", false, nil
+	})
+	s.AddCleanup(restore)
 }
 
 func (s *baseBootenvSuite) forceBootloader(bloader bootloader.Bootloader) {
@@ -3035,6 +3041,46 @@ func (s *bootenv20Suite) TestMarkBootSuccessful20CommandLineUpdatedMismatch(c *C
 	c.Assert(err, ErrorMatches, `cannot mark boot successful: cannot mark successful boot command line: current command line content "snapd_recovery_mode=run different" not matching any expected entry`)
 }
 
+func (s *bootenv20Suite) TestMarkBootSuccessful20CommandLineUpdatedKernelEmbeddedCommandLine(c *C) {
+	s.mockCmdline(c, "snapd_recovery_mode=run uki")
+	restore := boot.MockKernelEmbeddedCommandLine(func(kernelPath string) (string, bool, error) {
+		c.Check(kernelPath, Equals, filepath.Join(dirs.SnapBlobDir, s.kern1.Filename()))
+		return "snapd_recovery_mode=run uki", true, nil
+	})
+	defer restore()
+	tab := s.bootloaderWithTrustedAssets(c, map[string]string{
+		"asset": "asset",
+	})
+	coreDev := boottest.MockUC20Device("", nil)
+	c.Assert(coreDev.HasModeenv(), Equals, true)
+	m := s.setupMarkBootSuccessful20CommandLine(c, coreDev.Model(), "run", boot.BootCommandLines{
+		"snapd_recovery_mode=run",
+		"snapd_recovery_mode=run candidate",
+	})
+	r := setupUC20Bootenv(
+		c,
+		tab.MockBootloader,
+		&bootenv20Setup{
+			modeenv:    m,
+			kern:       s.kern1,
+			kernStatus: boot.DefaultStatus,
+		},
+	)
+	defer r()
+
+	// mark successful
+	err := boot.MarkBootSuccessful(coreDev)
+	c.Assert(err, IsNil)
+
+	// the kernel booted with its embedded command line, the candidate
+	// command line is the one passed by the bootloader now
+	m2, err := boot.ReadModeenv("")
+	c.Assert(err, IsNil)
+	c.Check(m2.CurrentKernelCommandLines, DeepEquals, boot.BootCommandLines{
+		"snapd_recovery_mode=run candidate",
+	})
+}
+
 func (s *bootenv20Suite) TestMarkBootSuccessful20CommandLineUpdatedFallbackOnBootSuccessful(c *C) {
 	s.mockCmdline(c, "snapd_recovery_mode=run panic=-1")
 	tab := s.bootloaderWithTrustedAssets(c, map[string]string{
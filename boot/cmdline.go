@@ -22,6 +22,7 @@ package boot
 import (
 	"errors"
 	"fmt"
+	"path/filepath"
 
 	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/bootloader"
@@ -277,11 +278,21 @@ func observeSuccessfulCommandLineUpdate(m *Modeenv) (*Modeenv, error) {
 	if err != nil {
 		return nil, err
 	}
+	newCmdline := cmdlineBootedWith
 	if !strutil.ListContains([]string(m.CurrentKernelCommandLines), cmdlineBootedWith) {
-		return nil, fmt.Errorf("current command line content %q not matching any expected entry",
-			cmdlineBootedWith)
+		embedded, err := bootedWithEmbeddedCommandLine(m, cmdlineBootedWith)
+		if err != nil {
+			return nil, err
+		}
+		if !embedded {
+			return nil, fmt.Errorf("current command line content %q not matching any expected entry",
+				cmdlineBootedWith)
+		}
+		// the kernel ignored the command line passed by the
+		// bootloader, which is the new one by now
+		newCmdline = m.CurrentKernelCommandLines[len(m.CurrentKernelCommandLines)-1]
 	}
-	newM.CurrentKernelCommandLines = bootCommandLines{cmdlineBootedWith}
+	newM.CurrentKernelCommandLines = bootCommandLines{newCmdline}
 
 	return newM, nil
 }
@@ -310,7 +321,13 @@ func observeSuccessfulCommandLineCompatBoot(model *asserts.Model, m *Modeenv) (*
 		return nil, err
 	}
 	if cmdlineExpected != cmdlineBootedWith {
-		return nil, fmt.Errorf("unexpected current command line: %q", cmdlineBootedWith)
+		embedded, err := bootedWithEmbeddedCommandLine(m, cmdlineBootedWith)
+		if err != nil {
+			return nil, err
+		}
+		if !embedded {
+			return nil, fmt.Errorf("unexpected current command line: %q", cmdlineBootedWith)
+		}
 	}
 	newM, err := m.Copy()
 	if err != nil {
@@ -366,6 +383,11 @@ func observeCommandLineUpdate(model *asserts.Model, reason commandLineUpdateReas
 		return false, nil
 	}
 	logger.Debugf("kernel commandline changes from %q to %q", cmdline, candidateCmdline)
+	for _, k := range m.CurrentKernels {
+		if err := checkKernelCommandLine(filepath.Join(dirs.SnapBlobDir, k), candidateCmdline); err != nil {
+			return false, err
+		}
+	}
 	// actual change of the command line content
 	m.CurrentKernelCommandLines = bootCommandLines{cmdline, candidateCmdline}
 
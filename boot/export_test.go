@@ -74,6 +74,12 @@ var (
 	BootVarsForTrustedCommandLineFromGadget = bootVarsForTrustedCommandLineFromGadget
 
 	WriteModelToUbuntuBoot = writeModelToUbuntuBoot
+
+	KernelEmbeddedCommandLine   = kernelEmbeddedCommandLine
+	CheckKernelCommandLine      = checkKernelCommandLine
+	KernelCommandLinesForKernel = kernelCommandLinesForKernel
+
+	NewBootloaderABSlotSwitcher = newBootloaderABSlotSwitcher
 )
 
 type BootAssetsMap = bootAssetsMap
@@ -287,3 +293,7 @@ func EnableTestingRebootFunction() (restore func()) {
 	testingRebootItself = true
 	return func() { testingRebootItself = false }
 }
+
+func MockKernelEmbeddedCommandLine(f func(kernelPath string) (cmdline string, embedded bool, err error)) (restore func()) {
+	return testutil.Mock(&kernelEmbeddedCommandLine, f)
+}
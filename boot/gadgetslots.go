@@ -0,0 +1,193 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package boot
+
+import (
+	"fmt"
+
+	"github.com/snapcore/snapd/bootloader"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/gadget"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/strutil"
+)
+
+// The slot of A/B paired gadget structures is tracked in the bootloader
+// environment with the following variables:
+//   - gadget_slot is the committed slot, "a" when unset
+//   - gadget_try_slot is the slot to try
+//   - gadget_slot_status is the status of the switch to gadget_try_slot,
+//     following the same protocol as kernel_status
+//
+// The bootloader is expected to boot with gadget_try_slot and move
+// gadget_slot_status from "try" to "trying" when it is "try", and to boot
+// with gadget_slot and reset gadget_slot_status when it is "trying", that is
+// when the previous boot with gadget_try_slot was not marked as successful.
+// The reverted switch is then reported by CheckGadgetSlotSwitch.
+const (
+	gadgetSlotVar       = "gadget_slot"
+	gadgetTrySlotVar    = "gadget_try_slot"
+	gadgetSlotStatusVar = "gadget_slot_status"
+)
+
+// bootloaders supporting A/B paired gadget structures
+var gadgetABSlotsBootloaders = []string{"uboot", "lk"}
+
+func init() {
+	gadget.RegisterABSlotSwitcher(newBootloaderABSlotSwitcher)
+}
+
+// findGadgetABSlotsBootloader returns the bootloader tracking the slot of A/B
+// paired gadget structures, or nil if the bootloader does not support them.
+func findGadgetABSlotsBootloader() (bootloader.Bootloader, error) {
+	var opts *bootloader.Options
+	if osutil.FileExists(dirs.SnapModeenvFileUnder(dirs.GlobalRootDir)) {
+		opts = &bootloader.Options{Role: bootloader.RoleRunMode}
+	}
+	bl, err := bootloader.Find("", opts)
+	if err != nil {
+		return nil, err
+	}
+	if !strutil.ListContains(gadgetABSlotsBootloaders, bl.Name()) {
+		return nil, nil
+	}
+	return bl, nil
+}
+
+// bootloaderABSlotSwitcher implements gadget.ABSlotSwitcher on top of the
+// bootloader environment.
+type bootloaderABSlotSwitcher struct {
+	bl bootloader.Bootloader
+}
+
+func newBootloaderABSlotSwitcher() (gadget.ABSlotSwitcher, error) {
+	bl, err := findGadgetABSlotsBootloader()
+	if err != nil {
+		return nil, err
+	}
+	if bl == nil {
+		return nil, fmt.Errorf("bootloader does not support A/B gadget structures")
+	}
+	return &bootloaderABSlotSwitcher{bl: bl}, nil
+}
+
+func (s *bootloaderABSlotSwitcher) ActiveSlot() (string, error) {
+	m, err := s.bl.GetBootVars(gadgetSlotStatusVar, gadgetSlotVar, gadgetTrySlotVar)
+	if err != nil {
+		return "", err
+	}
+	if m[gadgetSlotStatusVar] == TryingStatus {
+		return "", fmt.Errorf("switch to slot %q is not committed yet", m[gadgetTrySlotVar])
+	}
+	if m[gadgetSlotVar] == "" {
+		return gadget.SlotA, nil
+	}
+	return m[gadgetSlotVar], nil
+}
+
+func (s *bootloaderABSlotSwitcher) TrySlot(slot string) error {
+	mode := TryStatus
+	if slot == "" {
+		mode = DefaultStatus
+	}
+	return s.bl.SetBootVars(map[string]string{
+		gadgetTrySlotVar:    slot,
+		gadgetSlotStatusVar: mode,
+	})
+}
+
+// bootState20GadgetSlots implements the successfulBootState interface for
+// the slot of A/B paired gadget structures.
+type bootState20GadgetSlots struct{}
+
+func (bgs20 *bootState20GadgetSlots) markSuccessful(update bootStateUpdate) (bootStateUpdate, error) {
+	u20, err := toBootStateUpdate20(update)
+	if err != nil {
+		return nil, err
+	}
+
+	bl, err := findGadgetABSlotsBootloader()
+	if err != nil {
+		return nil, err
+	}
+	if bl == nil {
+		return u20, nil
+	}
+	m, err := bl.GetBootVars(gadgetSlotStatusVar, gadgetSlotVar, gadgetTrySlotVar)
+	if err != nil {
+		return nil, err
+	}
+
+	// a switch reverted by the bootloader is left for
+	// CheckGadgetSlotSwitch to report
+	if m[gadgetSlotStatusVar] == TryingStatus {
+		// booted successfully with the tried slot, commit it
+		trySlot := m[gadgetTrySlotVar]
+		u20.postModeenv(func() error {
+			return bl.SetBootVars(map[string]string{
+				gadgetSlotVar:       trySlot,
+				gadgetTrySlotVar:    "",
+				gadgetSlotStatusVar: DefaultStatus,
+			})
+		})
+	}
+	return u20, nil
+}
+
+// CheckGadgetSlotSwitch checks the outcome of a switch to another slot of A/B
+// paired gadget structures across a reboot. It returns an error if the
+// bootloader reverted to the committed slot because booting with the tried
+// slot failed, in which case the reverted switch is forgotten, and
+// ErrBootNameAndRevisionNotReady if the boot with the tried slot is yet to be
+// marked as successful.
+func CheckGadgetSlotSwitch() error {
+	bl, err := findGadgetABSlotsBootloader()
+	if err != nil {
+		return err
+	}
+	if bl == nil {
+		return nil
+	}
+	m, err := bl.GetBootVars(gadgetSlotStatusVar, gadgetSlotVar, gadgetTrySlotVar)
+	if err != nil {
+		return err
+	}
+	switch m[gadgetSlotStatusVar] {
+	case TryingStatus:
+		return ErrBootNameAndRevisionNotReady
+	case DefaultStatus:
+		if m[gadgetTrySlotVar] == "" {
+			return nil
+		}
+		slot := m[gadgetSlotVar]
+		if slot == "" {
+			slot = gadget.SlotA
+		}
+		if err := bl.SetBootVars(map[string]string{gadgetTrySlotVar: ""}); err != nil {
+			return err
+		}
+		return fmt.Errorf("cannot boot with gadget assets from slot %q, reverted to slot %q", m[gadgetTrySlotVar], slot)
+	}
+	return nil
+}
+
+func gadgetSlotsBootState() *bootState20GadgetSlots {
+	return &bootState20GadgetSlots{}
+}
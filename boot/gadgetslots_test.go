@@ -0,0 +1,196 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package boot_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/boot/boottest"
+	"github.com/snapcore/snapd/bootloader/bootloadertest"
+	"github.com/snapcore/snapd/gadget"
+)
+
+type gadgetSlotsSuite struct {
+	baseBootenv20Suite
+
+	bootloader *bootloadertest.MockBootloader
+}
+
+var _ = Suite(&gadgetSlotsSuite{})
+
+func (s *gadgetSlotsSuite) SetUpTest(c *C) {
+	s.baseBootenv20Suite.SetUpTest(c)
+
+	s.bootloader = bootloadertest.Mock("uboot", c.MkDir())
+	s.forceBootloader(s.bootloader)
+
+	r := setupUC20Bootenv(c, s.bootloader, s.normalDefaultState)
+	s.AddCleanup(r)
+}
+
+func (s *gadgetSlotsSuite) TestSwitcherActiveSlot(c *C) {
+	sw, err := boot.NewBootloaderABSlotSwitcher()
+	c.Assert(err, IsNil)
+
+	// slot a is the default
+	slot, err := sw.ActiveSlot()
+	c.Assert(err, IsNil)
+	c.Check(slot, Equals, gadget.SlotA)
+
+	s.bootloader.BootVars["gadget_slot"] = "b"
+	slot, err = sw.ActiveSlot()
+	c.Assert(err, IsNil)
+	c.Check(slot, Equals, gadget.SlotB)
+
+	// a switch is pending but the bootloader has not tried it yet
+	s.bootloader.BootVars["gadget_try_slot"] = "a"
+	s.bootloader.BootVars["gadget_slot_status"] = boot.TryStatus
+	slot, err = sw.ActiveSlot()
+	c.Assert(err, IsNil)
+	c.Check(slot, Equals, gadget.SlotB)
+
+	s.bootloader.BootVars["gadget_slot_status"] = boot.TryingStatus
+	_, err = sw.ActiveSlot()
+	c.Assert(err, ErrorMatches, `switch to slot "a" is not committed yet`)
+}
+
+func (s *gadgetSlotsSuite) TestSwitcherTrySlot(c *C) {
+	sw, err := boot.NewBootloaderABSlotSwitcher()
+	c.Assert(err, IsNil)
+
+	err = sw.TrySlot(gadget.SlotB)
+	c.Assert(err, IsNil)
+	m, err := s.bootloader.GetBootVars("gadget_slot", "gadget_try_slot", "gadget_slot_status")
+	c.Assert(err, IsNil)
+	c.Check(m, DeepEquals, map[string]string{
+		"gadget_slot":        "",
+		"gadget_try_slot":    "b",
+		"gadget_slot_status": boot.TryStatus,
+	})
+
+	// cancel the switch
+	err = sw.TrySlot("")
+	c.Assert(err, IsNil)
+	m, err = s.bootloader.GetBootVars("gadget_slot", "gadget_try_slot", "gadget_slot_status")
+	c.Assert(err, IsNil)
+	c.Check(m, DeepEquals, map[string]string{
+		"gadget_slot":        "",
+		"gadget_try_slot":    "",
+		"gadget_slot_status": boot.DefaultStatus,
+	})
+}
+
+func (s *gadgetSlotsSuite) TestSwitcherUnsupportedBootloader(c *C) {
+	s.forceBootloader(bootloadertest.Mock("grub", c.MkDir()))
+
+	_, err := boot.NewBootloaderABSlotSwitcher()
+	c.Assert(err, ErrorMatches, "bootloader does not support A/B gadget structures")
+}
+
+func (s *gadgetSlotsSuite) TestMarkBootSuccessfulCommitsTriedSlot(c *C) {
+	s.bootloader.BootVars["gadget_try_slot"] = "b"
+	s.bootloader.BootVars["gadget_slot_status"] = boot.TryingStatus
+
+	coreDev := boottest.MockUC20Device("", nil)
+	err := boot.MarkBootSuccessful(coreDev)
+	c.Assert(err, IsNil)
+
+	m, err := s.bootloader.GetBootVars("gadget_slot", "gadget_try_slot", "gadget_slot_status")
+	c.Assert(err, IsNil)
+	c.Check(m, DeepEquals, map[string]string{
+		"gadget_slot":        "b",
+		"gadget_try_slot":    "",
+		"gadget_slot_status": boot.DefaultStatus,
+	})
+}
+
+func (s *gadgetSlotsSuite) TestMarkBootSuccessfulAfterRevert(c *C) {
+	// the bootloader reverted to the committed slot
+	s.bootloader.BootVars["gadget_try_slot"] = "b"
+	s.bootloader.BootVars["gadget_slot_status"] = boot.DefaultStatus
+
+	coreDev := boottest.MockUC20Device("", nil)
+	err := boot.MarkBootSuccessful(coreDev)
+	c.Assert(err, IsNil)
+
+	// the reverted switch is left to be reported
+	m, err := s.bootloader.GetBootVars("gadget_slot", "gadget_try_slot", "gadget_slot_status")
+	c.Assert(err, IsNil)
+	c.Check(m, DeepEquals, map[string]string{
+		"gadget_slot":        "",
+		"gadget_try_slot":    "b",
+		"gadget_slot_status": boot.DefaultStatus,
+	})
+}
+
+func (s *gadgetSlotsSuite) TestCheckGadgetSlotSwitch(c *C) {
+	// no switch
+	c.Check(boot.CheckGadgetSlotSwitch(), IsNil)
+
+	// the switch was set up but there was no reboot yet
+	s.bootloader.BootVars["gadget_try_slot"] = "b"
+	s.bootloader.BootVars["gadget_slot_status"] = boot.TryStatus
+	c.Check(boot.CheckGadgetSlotSwitch(), IsNil)
+
+	// booted with the tried slot, not marked successful yet
+	s.bootloader.BootVars["gadget_slot_status"] = boot.TryingStatus
+	c.Check(boot.CheckGadgetSlotSwitch(), Equals, boot.ErrBootNameAndRevisionNotReady)
+
+	// the switch is committed
+	s.bootloader.BootVars["gadget_slot"] = "b"
+	s.bootloader.BootVars["gadget_try_slot"] = ""
+	s.bootloader.BootVars["gadget_slot_status"] = boot.DefaultStatus
+	c.Check(boot.CheckGadgetSlotSwitch(), IsNil)
+
+	// the bootloader reverted a switch back to slot b
+	s.bootloader.BootVars["gadget_try_slot"] = "a"
+	err := boot.CheckGadgetSlotSwitch()
+	c.Check(err, ErrorMatches, `cannot boot with gadget assets from slot "a", reverted to slot "b"`)
+	// and the reverted switch is reported only once
+	c.Check(s.bootloader.BootVars["gadget_try_slot"], Equals, "")
+	c.Check(boot.CheckGadgetSlotSwitch(), IsNil)
+}
+
+func (s *gadgetSlotsSuite) TestCheckGadgetSlotSwitchUnsupportedBootloader(c *C) {
+	bl := bootloadertest.Mock("grub", c.MkDir())
+	bl.BootVars["gadget_try_slot"] = "b"
+	s.forceBootloader(bl)
+
+	c.Check(boot.CheckGadgetSlotSwitch(), IsNil)
+}
+
+func (s *gadgetSlotsSuite) TestMarkBootSuccessfulSwitchNotTriedYet(c *C) {
+	// the switch was set up but there was no reboot yet
+	s.bootloader.BootVars["gadget_try_slot"] = "b"
+	s.bootloader.BootVars["gadget_slot_status"] = boot.TryStatus
+
+	coreDev := boottest.MockUC20Device("", nil)
+	err := boot.MarkBootSuccessful(coreDev)
+	c.Assert(err, IsNil)
+
+	m, err := s.bootloader.GetBootVars("gadget_slot", "gadget_try_slot", "gadget_slot_status")
+	c.Assert(err, IsNil)
+	c.Check(m, DeepEquals, map[string]string{
+		"gadget_slot":        "",
+		"gadget_try_slot":    "b",
+		"gadget_slot_status": boot.TryStatus,
+	})
+}
@@ -137,7 +137,7 @@ func InitramfsReboot() error {
 
 // This function implements logic that is usually part of the
 // bootloader, but that it is not possible to implement in, for
-// instance, piboot. See handling of kernel_status in
+// instance, piboot or sd-boot. See handling of kernel_status in
 // bootloader/assets/data/grub.cfg.
 func updateNotScriptableBootloaderStatus(bl bootloader.NotScriptableBootloader) error {
 	blVars, err := bl.GetBootVars("kernel_status")
@@ -149,17 +149,27 @@ func updateNotScriptableBootloaderStatus(bl bootloader.NotScriptableBootloader)
 		return nil
 	}
 
-	kVals, err := kcmdline.KeyValues("kernel_status")
-	if err != nil {
-		return err
+	var bootedTryKernel bool
+	if tkbl, ok := bl.(bootloader.TryKernelAwareBootloader); ok {
+		// the bootloader knows which kernel it booted
+		bootedTryKernel, err = tkbl.BootedTryKernel()
+		if err != nil {
+			return err
+		}
+	} else {
+		kVals, err := kcmdline.KeyValues("kernel_status")
+		if err != nil {
+			return err
+		}
+		bootedTryKernel = kVals["kernel_status"] == "trying"
 	}
 	// "" would be the value for the error case, which at this point is any
-	// case different to kernel_status=trying in kernel command line and
-	// kernel_status=try in configuration file. Note that kernel_status in
-	// the file should be only "try" or empty, and for the latter we should
-	// have returned a few lines up.
+	// case different to having booted the try-kernel (kernel_status=trying
+	// in kernel command line) and kernel_status=try in configuration
+	// file. Note that kernel_status in the file should be only "try" or
+	// empty, and for the latter we should have returned a few lines up.
 	newStatus := ""
-	if kVals["kernel_status"] == "trying" && curKernStatus == "try" {
+	if bootedTryKernel && curKernStatus == "try" {
 		newStatus = "trying"
 	}
 
@@ -169,8 +179,8 @@ func updateNotScriptableBootloaderStatus(bl bootloader.NotScriptableBootloader)
 }
 
 // InitramfsRunModeUpdateBootloaderVars updates bootloader variables
-// from the initramfs. This is necessary only for piboot at the
-// moment.
+// from the initramfs. This is necessary only for piboot and sd-boot at
+// the moment.
 func InitramfsRunModeUpdateBootloaderVars() error {
 	// For very limited bootloaders we need to change the kernel
 	// status from the initramfs as we cannot do that from the
@@ -792,6 +792,46 @@ func (s *initramfsSuite) TestInitramfsRunModeUpdateBootloaderVars(c *C) {
 	}
 }
 
+func (s *initramfsSuite) TestInitramfsRunModeUpdateBootloaderVarsTryKernelAware(c *C) {
+	bloader := bootloadertest.Mock("noscripts", c.MkDir()).WithNotScriptable().WithTryKernelAware()
+	bootloader.Force(bloader)
+	defer bootloader.Force(nil)
+
+	// the kernel command line is not used
+	cmdlineFile := filepath.Join(c.MkDir(), "cmdline")
+	err := os.WriteFile(cmdlineFile, []byte("kernel_status=trying"), 0644)
+	c.Assert(err, IsNil)
+	r := kcmdline.MockProcCmdline(cmdlineFile)
+	defer r()
+
+	tt := []struct {
+		bootedTryKernel bool
+		initialStatus   string
+		finalStatus     string
+	}{
+		{true, "try", "trying"},
+		{true, "badstate", ""},
+		{false, "try", ""},
+		{false, "trying", ""},
+	}
+
+	for _, t := range tt {
+		bloader.SetBootVars(map[string]string{"kernel_status": t.initialStatus})
+		bloader.BootedTryKernelResult = t.bootedTryKernel
+
+		err = boot.InitramfsRunModeUpdateBootloaderVars()
+		c.Assert(err, IsNil)
+		vars, err := bloader.GetBootVars("kernel_status")
+		c.Assert(err, IsNil)
+		c.Check(vars, DeepEquals, map[string]string{"kernel_status": t.finalStatus}, Commentf("%+v", t))
+	}
+
+	bloader.SetBootVars(map[string]string{"kernel_status": "try"})
+	bloader.BootedTryKernelErr = errors.New("cannot read EFI variable")
+	err = boot.InitramfsRunModeUpdateBootloaderVars()
+	c.Assert(err, ErrorMatches, "cannot read EFI variable")
+}
+
 func (s *initramfsSuite) TestInitramfsRunModeUpdateBootloaderVarsNotNotScriptable(c *C) {
 	// Make sure the method does not change status if the
 	// bootloader does not implement NotScriptableBootloader
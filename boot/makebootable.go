@@ -267,9 +267,9 @@ func MakeRecoverySystemBootable(model *asserts.Model, rootdir string, relativeRe
 		return fmt.Errorf("internal error: cannot find bootloader: %v", err)
 	}
 
-	// on e.g. ARM we need to extract the kernel assets on the recovery
-	// system as well, but the bootloader does not load any environment from
-	// the recovery system
+	// on e.g. ARM or with sd-boot we need to extract the kernel assets on
+	// the recovery system as well, unless the bootloader is also recovery
+	// aware it does not load any environment from the recovery system
 	erkbl, ok := bl.(bootloader.ExtractedRecoveryKernelImageBootloader)
 	if ok {
 		kernelf, err := snapfile.Open(bootWith.KernelPath)
@@ -285,12 +285,15 @@ func MakeRecoverySystemBootable(model *asserts.Model, rootdir string, relativeRe
 		if err != nil {
 			return fmt.Errorf("cannot extract recovery system kernel assets: %v", err)
 		}
-
-		return nil
 	}
 
 	rbl, ok := bl.(bootloader.RecoveryAwareBootloader)
 	if !ok {
+		if erkbl != nil {
+			// the recovery system is booted from the
+			// extracted kernel assets only
+			return nil
+		}
 		return fmt.Errorf("cannot use %s bootloader: does not support recovery systems", bl.Name())
 	}
 	kernelPath, err := filepath.Rel(rootdir, bootWith.KernelPath)
@@ -516,6 +519,9 @@ func makeRunnableSystem(model *asserts.Model, bootWith *BootableSet, observer Tr
 		if err != nil {
 			return fmt.Errorf("while retrieving system.kernel.*cmdline-append defaults: %v", err)
 		}
+		if err := checkKernelCommandLine(bootWith.KernelPath, strutil.JoinNonEmpty([]string{cmdline, cmdlineAppend}, " ")); err != nil {
+			return err
+		}
 
 		candidate := false
 		defaultCmdLine, err := tbl.DefaultCommandLine(candidate)
@@ -717,6 +717,14 @@ func recoveryBootChainsForSystems(systems []string, modesForSystems map[string][
 				cmdlines = append(cmdlines, cmdline)
 			}
 
+			// the kernel may only boot with its embedded
+			// command line, which must then carry the
+			// arguments of all the modes
+			cmdlines, err = kernelCommandLinesForKernel(seedKernel.Path, cmdlines)
+			if err != nil {
+				return err
+			}
+
 			var kernelRev string
 			if seedKernel.SideInfo.Revision.Store() {
 				kernelRev = seedKernel.SideInfo.Revision.String()
@@ -808,6 +816,10 @@ func runModeBootChains(rbl, bl bootloader.Bootloader, modeenv *Modeenv, cmdlines
 			if err != nil {
 				return err
 			}
+			kernelCmdlines, err := kernelCommandLinesForKernel(kernelPath, cmdlines)
+			if err != nil {
+				return err
+			}
 
 			foundChain := false
 
@@ -838,7 +850,7 @@ func runModeBootChains(rbl, bl bootloader.Bootloader, modeenv *Modeenv, cmdlines
 					AssetChain:     assetChain,
 					Kernel:         info.SnapName(),
 					KernelRevision: kernelRev,
-					KernelCmdlines: cmdlines,
+					KernelCmdlines: kernelCmdlines,
 					kernelBootFile: kbf,
 				})
 				foundChain = true
@@ -66,6 +66,10 @@ func (s *sealSuite) SetUpTest(c *C) {
 	}
 	s.AddCleanup(assets.MockSnippetsForEdition("grub.cfg:static-cmdline", snippets))
 	s.AddCleanup(assets.MockSnippetsForEdition("grub-recovery.cfg:static-cmdline", snippets))
+	// the mocked kernels have no embedded command line
+	s.AddCleanup(boot.MockKernelEmbeddedCommandLine(func(string) (string, bool, error) {
+		return "", false, nil
+	}))
 }
 
 func mockKernelSeedSnap(rev snap.Revision) *seed.Snap {
@@ -1640,6 +1644,81 @@ func (s *sealSuite) TestRunModeBootChains(c *C) {
 	}
 }
 
+func (s *sealSuite) TestRunModeBootChainsKernelEmbeddedCommandLine(c *C) {
+	rootdir := c.MkDir()
+	dirs.SetRootDir(rootdir)
+	defer dirs.SetRootDir("")
+
+	var kernelPaths []string
+	restore := boot.MockKernelEmbeddedCommandLine(func(kernelPath string) (string, bool, error) {
+		kernelPaths = append(kernelPaths, kernelPath)
+		if kernelPath == "/snaps/pc-kernel_501.snap" {
+			return "snapd_recovery_mode=run console=ttyS0 extra", true, nil
+		}
+		return "", false, nil
+	})
+	defer restore()
+
+	model := boottest.MakeMockUC20Model()
+	modeenv := &boot.Modeenv{
+		CurrentTrustedRecoveryBootAssets: boot.BootAssetsMap{
+			"grubx64.efi": []string{"grub-hash-1"},
+			"bootx64.efi": []string{"shim-hash-1"},
+		},
+		CurrentTrustedBootAssets: boot.BootAssetsMap{
+			"grubx64.efi": []string{"grub-hash-2"},
+		},
+		CurrentKernels: []string{"pc-kernel_500.snap", "pc-kernel_501.snap"},
+
+		BrandID:        model.BrandID(),
+		Model:          model.Model(),
+		ModelSignKeyID: model.SignKeyID(),
+		Grade:          string(model.Grade()),
+	}
+
+	grubDir := filepath.Join(rootdir, "run/mnt/ubuntu-seed")
+	c.Assert(createMockGrubCfg(grubDir), IsNil)
+	runGrubDir := filepath.Join(rootdir, "run/mnt/ubuntu-boot")
+	c.Assert(createMockGrubCfg(runGrubDir), IsNil)
+
+	rbl, err := bootloader.Find(grubDir, &bootloader.Options{
+		Role:        bootloader.RoleRecovery,
+		NoSlashBoot: true,
+	})
+	c.Assert(err, IsNil)
+	bl, err := bootloader.Find(runGrubDir, &bootloader.Options{
+		Role:        bootloader.RoleRunMode,
+		NoSlashBoot: true,
+	})
+	c.Assert(err, IsNil)
+
+	cmdlines := []string{"snapd_recovery_mode=run console=ttyS0 extra"}
+	bootChains, err := boot.RunModeBootChains(rbl, bl, modeenv, cmdlines, "/snaps")
+	c.Assert(err, IsNil)
+	c.Check(kernelPaths, DeepEquals, []string{"/snaps/pc-kernel_500.snap", "/snaps/pc-kernel_501.snap"})
+	c.Assert(bootChains, HasLen, 2)
+	c.Check(bootChains[0].KernelRevision, Equals, "500")
+	c.Check(bootChains[0].KernelCmdlines, DeepEquals, cmdlines)
+	// the kernel can only be booted with its embedded command line
+	c.Check(bootChains[1].KernelRevision, Equals, "501")
+	c.Check(bootChains[1].KernelCmdlines, DeepEquals, []string{"snapd_recovery_mode=run console=ttyS0 extra"})
+
+	// the embedded command line is not the one passed by the bootloader
+	_, err = boot.RunModeBootChains(rbl, bl, modeenv, []string{"snapd_recovery_mode=run quiet"}, "/snaps")
+	c.Check(err, ErrorMatches, `cannot use kernel pc-kernel_501.snap: its embedded command line ".*" is not the command line "snapd_recovery_mode=run quiet"`)
+
+	// nor can it be while the command line is being updated
+	_, err = boot.RunModeBootChains(rbl, bl, modeenv, []string{"snapd_recovery_mode=run console=ttyS0", "snapd_recovery_mode=run console=ttyS0 extra"}, "/snaps")
+	c.Check(err, ErrorMatches, `cannot use kernel pc-kernel_501.snap: its embedded command line ".*" is not the command line "snapd_recovery_mode=run console=ttyS0"`)
+
+	restore = boot.MockKernelEmbeddedCommandLine(func(kernelPath string) (string, bool, error) {
+		return "", false, fmt.Errorf("cannot inspect kernel")
+	})
+	defer restore()
+	_, err = boot.RunModeBootChains(rbl, bl, modeenv, []string{"testline"}, "/snaps")
+	c.Check(err, ErrorMatches, "cannot inspect kernel")
+}
+
 func (s *sealSuite) TestRecoveryBootChainsForSystems(c *C) {
 	for _, tc := range []struct {
 		desc                    string
@@ -0,0 +1,128 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package boot
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/snapcore/snapd/bootloader"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil/kcmdline"
+	"github.com/snapcore/snapd/snap/snapfile"
+)
+
+// Kernel snaps may ship a signed Unified Kernel Image with an embedded
+// command line. With Secure Boot enabled the EFI stub then ignores the
+// command line passed by the bootloader, so the embedded command line is
+// the one the kernel is booted with and the one to seal against. Such a
+// kernel is only accepted when its embedded command line is the command line
+// snapd would pass to it, including the mode argument, as there is no other
+// way for the bootloader to select the mode or for the gadget and system
+// options to change the command line. A kernel that can be booted in modes
+// with different command lines, like the recover and factory-reset modes of
+// a recovery system, can therefore not have an embedded command line.
+
+// kernelEmbeddedCommandLine returns the command line embedded in the
+// Unified Kernel Image shipped by the kernel snap at the given path, the
+// second return value is false if there is none.
+var kernelEmbeddedCommandLine = func(kernelPath string) (cmdline string, embedded bool, err error) {
+	snapf, err := snapfile.Open(kernelPath)
+	if err != nil {
+		return "", false, err
+	}
+	uki, err := bootloader.ReadUnifiedKernelImage(snapf)
+	if err != nil {
+		return "", false, fmt.Errorf("cannot inspect kernel %s: %v", filepath.Base(kernelPath), err)
+	}
+	if uki == nil || !uki.HasCmdline {
+		return "", false, nil
+	}
+	return uki.Cmdline, true, nil
+}
+
+// kernelCommandLinesForKernel returns the command lines the kernel snap at
+// the given path is booted with, given the command lines composed by snapd
+// for each of the modes the bootloader can boot it in. A kernel with an
+// embedded command line is booted with it whatever the mode selected by the
+// bootloader, so such a kernel is refused unless its embedded command line is
+// each of the composed command lines.
+func kernelCommandLinesForKernel(kernelPath string, cmdlines []string) ([]string, error) {
+	embedded, ok, err := kernelEmbeddedCommandLine(kernelPath)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return cmdlines, nil
+	}
+	for _, cmdline := range cmdlines {
+		if err := checkEmbeddedCommandLine(kernelPath, embedded, cmdline); err != nil {
+			return nil, err
+		}
+	}
+	return []string{embedded}, nil
+}
+
+// bootedWithEmbeddedCommandLine returns true if the given command line is
+// the one embedded in any of the current kernels of the modeenv.
+func bootedWithEmbeddedCommandLine(m *Modeenv, cmdline string) (bool, error) {
+	for _, k := range m.CurrentKernels {
+		embedded, ok, err := kernelEmbeddedCommandLine(filepath.Join(dirs.SnapBlobDir, k))
+		if err != nil {
+			return false, err
+		}
+		if ok && embedded == cmdline {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkKernelCommandLine returns an error when the kernel snap at the given
+// path has an embedded command line other than the command line composed by
+// snapd, for instance from the gadget cmdline.extra or the system options, as
+// the composed command line would not be passed to the kernel.
+func checkKernelCommandLine(kernelPath, cmdline string) error {
+	embedded, ok, err := kernelEmbeddedCommandLine(kernelPath)
+	if err != nil || !ok {
+		return err
+	}
+	return checkEmbeddedCommandLine(kernelPath, embedded, cmdline)
+}
+
+// checkEmbeddedCommandLine returns an error unless the embedded command line
+// has the same arguments as the given one, in the same order. An embedded
+// command line with additional arguments is refused as well, as it could
+// carry arguments, like the mode, contradicting the given ones.
+func checkEmbeddedCommandLine(kernelPath, embedded, cmdline string) error {
+	embeddedArgs, err := kcmdline.Split(embedded)
+	if err != nil {
+		return fmt.Errorf("cannot parse kernel %s embedded command line: %v", filepath.Base(kernelPath), err)
+	}
+	args, err := kcmdline.Split(cmdline)
+	if err != nil {
+		return err
+	}
+	if !stringListsEqual(embeddedArgs, args) {
+		return fmt.Errorf("cannot use kernel %s: its embedded command line %q is not the command line %q",
+			filepath.Base(kernelPath), embedded, cmdline)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package boot_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/bootloader/bootloadertest"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type ukiSuite struct {
+	testutil.BaseTest
+}
+
+var _ = Suite(&ukiSuite{})
+
+// mockKernel returns the path to an unpacked kernel snap with the given
+// kernel.efi.
+func (s *ukiSuite) mockKernel(c *C, kernelEfi []byte) string {
+	dir := filepath.Join(c.MkDir(), "pc-kernel_1.snap")
+	c.Assert(os.MkdirAll(filepath.Join(dir, "meta"), 0755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dir, "meta/snap.yaml"), []byte("name: pc-kernel\ntype: kernel\nversion: 1\n"), 0644), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dir, "kernel.efi"), kernelEfi, 0644), IsNil)
+	return dir
+}
+
+func (s *ukiSuite) TestKernelEmbeddedCommandLine(c *C) {
+	kernel := s.mockKernel(c, bootloadertest.MakeEfiImage(map[string]string{
+		".linux":   "kernel",
+		".initrd":  "initrd",
+		".cmdline": "snapd_recovery_mode=run console=ttyS0\x00",
+	}))
+	cmdline, embedded, err := boot.KernelEmbeddedCommandLine(kernel)
+	c.Assert(err, IsNil)
+	c.Check(embedded, Equals, true)
+	c.Check(cmdline, Equals, "snapd_recovery_mode=run console=ttyS0")
+
+	// no command line in the image
+	kernel = s.mockKernel(c, bootloadertest.MakeEfiImage(map[string]string{
+		".linux":  "kernel",
+		".initrd": "initrd",
+	}))
+	_, embedded, err = boot.KernelEmbeddedCommandLine(kernel)
+	c.Assert(err, IsNil)
+	c.Check(embedded, Equals, false)
+
+	kernel = s.mockKernel(c, []byte("garbage"))
+	_, _, err = boot.KernelEmbeddedCommandLine(kernel)
+	c.Check(err, ErrorMatches, "cannot inspect kernel pc-kernel_1.snap: cannot read kernel image: .*")
+}
+
+func (s *ukiSuite) TestCheckKernelCommandLine(c *C) {
+	embedded := "snapd_recovery_mode=run console=ttyS0 panic=-1"
+	restore := boot.MockKernelEmbeddedCommandLine(func(kernelPath string) (string, bool, error) {
+		c.Check(kernelPath, Equals, "/snaps/pc-kernel_1.snap")
+		return embedded, true, nil
+	})
+	defer restore()
+
+	err := boot.CheckKernelCommandLine("/snaps/pc-kernel_1.snap", "snapd_recovery_mode=run  console=ttyS0 panic=-1")
+	c.Check(err, IsNil)
+
+	for _, cmdline := range []string{
+		// arguments missing from the embedded command line
+		"snapd_recovery_mode=run console=ttyS0 panic=-1 foo=bar quiet",
+		// the embedded command line has more arguments
+		"snapd_recovery_mode=run panic=-1",
+		// in another order
+		"console=ttyS0 snapd_recovery_mode=run panic=-1",
+	} {
+		err = boot.CheckKernelCommandLine("/snaps/pc-kernel_1.snap", cmdline)
+		c.Check(err, ErrorMatches, `cannot use kernel pc-kernel_1.snap: its embedded command line "snapd_recovery_mode=run console=ttyS0 panic=-1" is not the command line "`+cmdline+`"`)
+	}
+
+	// no embedded command line, nothing is ignored
+	restore = boot.MockKernelEmbeddedCommandLine(func(kernelPath string) (string, bool, error) {
+		return "", false, nil
+	})
+	defer restore()
+	err = boot.CheckKernelCommandLine("/snaps/pc-kernel_1.snap", "foo=bar")
+	c.Check(err, IsNil)
+}
+
+func (s *ukiSuite) TestKernelCommandLinesForKernel(c *C) {
+	embedded := "snapd_recovery_mode=recover snapd_recovery_system=20261017 console=ttyS0"
+	restore := boot.MockKernelEmbeddedCommandLine(func(kernelPath string) (string, bool, error) {
+		return embedded, true, nil
+	})
+	defer restore()
+
+	// the embedded command line is the one of the only mode
+	cmdlines, err := boot.KernelCommandLinesForKernel("/snaps/pc-kernel_1.snap", []string{
+		"snapd_recovery_mode=recover snapd_recovery_system=20261017 console=ttyS0",
+	})
+	c.Assert(err, IsNil)
+	c.Check(cmdlines, DeepEquals, []string{embedded})
+
+	// but cannot be the one of several modes
+	_, err = boot.KernelCommandLinesForKernel("/snaps/pc-kernel_1.snap", []string{
+		"snapd_recovery_mode=recover snapd_recovery_system=20261017 console=ttyS0",
+		"snapd_recovery_mode=factory-reset snapd_recovery_system=20261017 console=ttyS0",
+	})
+	c.Check(err, ErrorMatches, `cannot use kernel pc-kernel_1.snap: its embedded command line ".*" is not the command line "snapd_recovery_mode=factory-reset .*"`)
+
+	// even when it carries the arguments of all of them
+	restore = boot.MockKernelEmbeddedCommandLine(func(kernelPath string) (string, bool, error) {
+		return "snapd_recovery_mode=recover snapd_recovery_mode=factory-reset snapd_recovery_system=20261017", true, nil
+	})
+	defer restore()
+	_, err = boot.KernelCommandLinesForKernel("/snaps/pc-kernel_1.snap", []string{
+		"snapd_recovery_mode=recover snapd_recovery_system=20261017",
+		"snapd_recovery_mode=factory-reset snapd_recovery_system=20261017",
+	})
+	c.Check(err, ErrorMatches, `cannot use kernel pc-kernel_1.snap: its embedded command line ".*" is not the command line "snapd_recovery_mode=recover snapd_recovery_system=20261017"`)
+
+	// kernels without an embedded command line are booted with the
+	// composed ones
+	restore = boot.MockKernelEmbeddedCommandLine(func(kernelPath string) (string, bool, error) {
+		return "", false, nil
+	})
+	defer restore()
+	cmdlines, err = boot.KernelCommandLinesForKernel("/snaps/pc-kernel_1.snap", []string{"foo", "bar"})
+	c.Assert(err, IsNil)
+	c.Check(cmdlines, DeepEquals, []string{"foo", "bar"})
+}
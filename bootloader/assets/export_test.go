@@ -23,6 +23,7 @@ var (
 	RegisterInternal           = registerInternal
 	RegisterSnippetForEditions = registerSnippetForEditions
 	RegisterGrubSnippets       = registerGrubSnippets
+	RegisterSdbootSnippets     = registerSdbootSnippets
 )
 
 func MockCleanState() (restore func()) {
@@ -0,0 +1,44 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package assets
+
+import (
+	"github.com/snapcore/snapd/arch"
+)
+
+// systemd-boot does not use a scripted config, the static command line is
+// written to the boot entries by snapd instead
+var sdbootCmdlineForArch = map[string][]ForEditions{
+	"amd64": {
+		{FirstEdition: 1, Snippet: []byte("console=ttyS0,115200n8 console=tty1 panic=-1")},
+	},
+	"arm64": {
+		{FirstEdition: 1, Snippet: []byte("panic=-1")},
+	},
+}
+
+func registerSdbootSnippets() {
+	snippets := sdbootCmdlineForArch[arch.DpkgArchitecture()]
+	registerSnippetForEditions("sd-boot-loader.conf:static-cmdline", snippets)
+}
+
+func init() {
+	registerSdbootSnippets()
+}
@@ -0,0 +1,76 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package assets_test
+
+import (
+	"bytes"
+	"os"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/arch"
+	"github.com/snapcore/snapd/arch/archtest"
+	"github.com/snapcore/snapd/bootloader/assets"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type sdbootAssetsTestSuite struct {
+	testutil.BaseTest
+}
+
+var _ = Suite(&sdbootAssetsTestSuite{})
+
+func (s *sdbootAssetsTestSuite) TestLoaderConf(c *C) {
+	a := assets.Internal("sd-boot-loader.conf")
+	c.Assert(a, NotNil)
+	c.Check(bytes.HasPrefix(a, []byte("# Snapd-Boot-Config-Edition: 1\n")), Equals, true)
+	c.Check(string(a), testutil.Contains, "\ntimeout 0\n")
+	c.Check(string(a), testutil.Contains, "\neditor no\n")
+	// the default entry is selected by snapd through sort keys
+	c.Check(string(a), Not(testutil.Contains), "\ndefault ")
+}
+
+func (s *sdbootAssetsTestSuite) TestCmdlineSnippetEditions(c *C) {
+	for _, tc := range []struct {
+		arch arch.ArchitectureType
+		snip string
+	}{
+		{"amd64", "console=ttyS0,115200n8 console=tty1 panic=-1"},
+		{"arm64", "panic=-1"},
+	} {
+		restoreArch := archtest.MockArchitecture(tc.arch)
+		restoreState := assets.MockCleanState()
+		assets.RegisterSdbootSnippets()
+
+		snip := assets.SnippetForEdition("sd-boot-loader.conf:static-cmdline", 1)
+		c.Check(string(snip), Equals, tc.snip)
+
+		restoreState()
+		restoreArch()
+	}
+}
+
+func (s *sdbootAssetsTestSuite) TestAssetsWereRegenerated(c *C) {
+	assetData := assets.Internal("sd-boot-loader.conf")
+	c.Assert(assetData, NotNil)
+	data, err := os.ReadFile("data/sd-boot-loader.conf")
+	c.Assert(err, IsNil)
+	c.Check(assetData, DeepEquals, data)
+}
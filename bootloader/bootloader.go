@@ -24,12 +24,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/snapcore/snapd/bootloader/assets"
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/osutil/kcmdline"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/strutil"
 )
 
 var (
@@ -194,6 +196,40 @@ func (c *CommandLineComponents) Validate() error {
 	return nil
 }
 
+// composeCommandLine returns the kernel command line made of the mode and
+// system arguments of the components followed by either the static command
+// line of the bootloader and extra arguments, or the full arguments.
+func composeCommandLine(staticCmdline string, pieces CommandLineComponents) (string, error) {
+	if err := pieces.Validate(); err != nil {
+		return "", err
+	}
+
+	var nonSnapdCmdline string
+	if pieces.FullArgs == "" {
+		keepDefaultArgs := kcmdline.RemoveMatchingFilter(staticCmdline, pieces.RemoveArgs)
+
+		nonSnapdCmdline = strutil.JoinNonEmpty(append(keepDefaultArgs, pieces.ExtraArgs), " ")
+	} else {
+		nonSnapdCmdline = pieces.FullArgs
+	}
+	args, err := kcmdline.Split(nonSnapdCmdline)
+	if err != nil {
+		return "", fmt.Errorf("cannot use badly formatted kernel command line: %v", err)
+	}
+	// join all argument with a single space, see
+	// grub-core/lib/cmdline.c:grub_create_loader_cmdline() for reference,
+	// arguments are separated by a single space, the space after last is
+	// replaced with terminating NULL
+	snapdArgs := make([]string, 0, 2)
+	if pieces.ModeArg != "" {
+		snapdArgs = append(snapdArgs, pieces.ModeArg)
+	}
+	if pieces.SystemArg != "" {
+		snapdArgs = append(snapdArgs, pieces.SystemArg)
+	}
+	return strings.Join(append(snapdArgs, args...), " "), nil
+}
+
 // TrustedAssetsBootloader has boot assets that take part in the secure boot
 // process and need to be tracked, while other boot assets (typically boot
 // config) are managed by snapd.
@@ -253,6 +289,17 @@ type NotScriptableBootloader interface {
 	SetBootVarsFromInitramfs(values map[string]string) error
 }
 
+// TryKernelAwareBootloader is a NotScriptableBootloader that can tell
+// whether the current boot used the try-kernel, instead of relying on a
+// kernel_status argument in the kernel command line.
+type TryKernelAwareBootloader interface {
+	NotScriptableBootloader
+
+	// BootedTryKernel returns true if the try-kernel was used for the
+	// current boot.
+	BootedTryKernel() (bool, error)
+}
+
 // RebootBootloader needs arguments to the reboot syscall when snaps
 // are being updated.
 type RebootBootloader interface {
@@ -340,6 +387,7 @@ var (
 		newAndroidBoot,
 		newLk,
 		newPiboot,
+		newSdboot,
 	}
 )
 
@@ -343,6 +343,7 @@ func (s *bootenvTestSuite) TestBootloaderForGadget(c *C) {
 		{name: "uboot", gadgetFile: "uboot.conf", expName: "uboot"},
 		{name: "androidboot", gadgetFile: "androidboot.conf", expName: "androidboot"},
 		{name: "lk", gadgetFile: "lk.conf", expName: "lk"},
+		{name: "sd-boot", gadgetFile: "sd-boot.conf", opts: &bootloader.Options{Role: bootloader.RoleRecovery}, expName: "sd-boot"},
 	} {
 		c.Logf("tc: %v", tc.name)
 		gadgetDir := c.MkDir()
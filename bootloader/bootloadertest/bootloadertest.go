@@ -582,6 +582,26 @@ func (b *MockNotScriptableBootloader) SetBootVarsFromInitramfs(values map[string
 	return nil
 }
 
+// MockTryKernelAwareBootloader implements the
+// bootloader.TryKernelAwareBootloader interface and includes
+// MockNotScriptableBootloader
+type MockTryKernelAwareBootloader struct {
+	*MockNotScriptableBootloader
+
+	BootedTryKernelResult bool
+	BootedTryKernelErr    error
+}
+
+func (b *MockNotScriptableBootloader) WithTryKernelAware() *MockTryKernelAwareBootloader {
+	return &MockTryKernelAwareBootloader{
+		MockNotScriptableBootloader: b,
+	}
+}
+
+func (b *MockTryKernelAwareBootloader) BootedTryKernel() (bool, error) {
+	return b.BootedTryKernelResult, b.BootedTryKernelErr
+}
+
 // MockExtractedRecoveryKernelNotScriptableBootloader implements the
 // bootloader.ExtractedRecoveryKernelImageBootloader interface and
 // includes MockNotScriptableBootloader
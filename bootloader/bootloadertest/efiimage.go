@@ -0,0 +1,68 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package bootloadertest
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"sort"
+)
+
+// MakeEfiImage returns a minimal PE image with the given sections, such as
+// ".linux", ".initrd" and ".cmdline" for a Unified Kernel Image.
+func MakeEfiImage(sections map[string]string) []byte {
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	const dosHeaderSize = 64
+	const peHeaderSize = 4 + 20
+	const sectionHeaderSize = 40
+
+	var buf bytes.Buffer
+	dosHeader := make([]byte, dosHeaderSize)
+	copy(dosHeader, "MZ")
+	binary.LittleEndian.PutUint32(dosHeader[0x3c:], dosHeaderSize)
+	buf.Write(dosHeader)
+	buf.WriteString("PE\x00\x00")
+	binary.Write(&buf, binary.LittleEndian, pe.FileHeader{
+		Machine:          pe.IMAGE_FILE_MACHINE_AMD64,
+		NumberOfSections: uint16(len(names)),
+	})
+
+	dataOffset := uint32(dosHeaderSize + peHeaderSize + sectionHeaderSize*len(names))
+	for _, name := range names {
+		hdr := pe.SectionHeader32{
+			VirtualSize:      uint32(len(sections[name])),
+			SizeOfRawData:    uint32(len(sections[name])),
+			PointerToRawData: dataOffset,
+		}
+		copy(hdr.Name[:], name)
+		binary.Write(&buf, binary.LittleEndian, hdr)
+		dataOffset += uint32(len(sections[name]))
+	}
+	for _, name := range names {
+		buf.WriteString(sections[name])
+	}
+	return buf.Bytes()
+}
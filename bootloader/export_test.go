@@ -326,3 +326,7 @@ var (
 	ConfigAssetFrom                      = configAssetFrom
 	StaticCommandLineForGrubAssetEdition = staticCommandLineForGrubAssetEdition
 )
+
+func NewSdboot(rootdir string, opts *Options) ExtractedRunKernelImageBootloader {
+	return newSdboot(rootdir, opts).(ExtractedRunKernelImageBootloader)
+}
@@ -23,15 +23,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/snapcore/snapd/arch"
 	"github.com/snapcore/snapd/bootloader/assets"
 	"github.com/snapcore/snapd/bootloader/grubenv"
 	"github.com/snapcore/snapd/osutil"
-	"github.com/snapcore/snapd/osutil/kcmdline"
 	"github.com/snapcore/snapd/snap"
-	"github.com/snapcore/snapd/strutil"
 )
 
 // grub implements the required interfaces
@@ -185,28 +182,43 @@ func (g *grub) extractedKernelDir(prefix string, s snap.PlaceInfo) string {
 }
 
 func (g *grub) ExtractKernelAssets(s snap.PlaceInfo, snapf snap.Container) error {
-	// default kernel assets are:
-	// - kernel.img
-	// - initrd.img
-	// - dtbs/*
-	var assets []string
-	if g.uefiRunKernelExtraction {
-		assets = []string{"kernel.efi"}
-	} else {
-		assets = []string{"kernel.img", "initrd.img", "dtbs/*"}
-	}
-
 	// extraction can be forced through either a special file in the kernel snap
 	// or through an option in the bootloader
 	_, err := snapf.ReadFile("meta/force-kernel-extraction")
-	if g.uefiRunKernelExtraction || err == nil {
-		return extractKernelAssetsToBootDir(
-			g.extractedKernelDir(g.dir(), s),
-			snapf,
-			assets,
-		)
+	if !g.uefiRunKernelExtraction && err != nil {
+		return nil
 	}
-	return nil
+
+	assets, err := g.kernelAssets(snapf)
+	if err != nil {
+		return err
+	}
+	return extractKernelAssetsToBootDir(
+		g.extractedKernelDir(g.dir(), s),
+		snapf,
+		assets,
+	)
+}
+
+// kernelAssets returns the assets to extract from the given kernel snap.
+func (g *grub) kernelAssets(snapf snap.Container) ([]string, error) {
+	if g.uefiRunKernelExtraction {
+		return []string{"kernel.efi"}, nil
+	}
+	// a Unified Kernel Image bundles the kernel with its initrd and
+	// command line, there are no separate assets to extract
+	uki, err := ReadUnifiedKernelImage(snapf)
+	if err != nil {
+		return nil, err
+	}
+	if uki != nil {
+		return []string{"kernel.efi"}, nil
+	}
+	// default kernel assets are:
+	// - kernel.img
+	// - initrd.img
+	// - dtbs/*
+	return []string{"kernel.img", "initrd.img", "dtbs/*"}, nil
 }
 
 func (g *grub) RemoveKernelAssets(s snap.PlaceInfo) error {
@@ -366,36 +378,7 @@ func (g *grub) ManagedAssets() []string {
 }
 
 func (g *grub) commandLineForEdition(edition uint, pieces CommandLineComponents) (string, error) {
-	if err := pieces.Validate(); err != nil {
-		return "", err
-	}
-
-	var nonSnapdCmdline string
-	if pieces.FullArgs == "" {
-		staticCmdline := g.defaultCommandLineForEdition(edition)
-
-		keepDefaultArgs := kcmdline.RemoveMatchingFilter(staticCmdline, pieces.RemoveArgs)
-
-		nonSnapdCmdline = strutil.JoinNonEmpty(append(keepDefaultArgs, pieces.ExtraArgs), " ")
-	} else {
-		nonSnapdCmdline = pieces.FullArgs
-	}
-	args, err := kcmdline.Split(nonSnapdCmdline)
-	if err != nil {
-		return "", fmt.Errorf("cannot use badly formatted kernel command line: %v", err)
-	}
-	// join all argument with a single space, see
-	// grub-core/lib/cmdline.c:grub_create_loader_cmdline() for reference,
-	// arguments are separated by a single space, the space after last is
-	// replaced with terminating NULL
-	snapdArgs := make([]string, 0, 2)
-	if pieces.ModeArg != "" {
-		snapdArgs = append(snapdArgs, pieces.ModeArg)
-	}
-	if pieces.SystemArg != "" {
-		snapdArgs = append(snapdArgs, pieces.SystemArg)
-	}
-	return strings.Join(append(snapdArgs, args...), " "), nil
+	return composeCommandLine(g.defaultCommandLineForEdition(edition), pieces)
 }
 
 func (g *grub) assetName() string {
@@ -32,10 +32,12 @@ import (
 	"github.com/snapcore/snapd/arch/archtest"
 	"github.com/snapcore/snapd/bootloader"
 	"github.com/snapcore/snapd/bootloader/assets"
+	"github.com/snapcore/snapd/bootloader/bootloadertest"
 	"github.com/snapcore/snapd/bootloader/grubenv"
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snapdir"
 	"github.com/snapcore/snapd/snap/snapfile"
 	"github.com/snapcore/snapd/snap/snaptest"
 	"github.com/snapcore/snapd/testutil"
@@ -200,6 +202,38 @@ func (s *grubTestSuite) TestExtractKernelAssetsNoUnpacksKernelForGrub(c *C) {
 	c.Assert(osutil.FileExists(kernimg), Equals, false)
 }
 
+func (s *grubTestSuite) TestExtractKernelForceUnifiedKernelImage(c *C) {
+	s.makeFakeGrubEnv(c)
+
+	g := bootloader.NewGrub(s.rootdir, nil)
+	c.Assert(g, NotNil)
+
+	// the kernel snap ships a Unified Kernel Image and no separate kernel
+	// and initrd
+	snapDir := c.MkDir()
+	kernelEfi := bootloadertest.MakeEfiImage(map[string]string{
+		".linux":   "kernel",
+		".initrd":  "initrd",
+		".cmdline": "console=ttyS0",
+	})
+	c.Assert(os.MkdirAll(filepath.Join(snapDir, "meta"), 0755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(snapDir, "meta/force-kernel-extraction"), nil, 0644), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(snapDir, "kernel.efi"), kernelEfi, 0644), IsNil)
+	info, err := snap.ParsePlaceInfoFromSnapFileName("ubuntu-kernel_42.snap")
+	c.Assert(err, IsNil)
+
+	err = g.ExtractKernelAssets(info, snapdir.New(snapDir))
+	c.Assert(err, IsNil)
+
+	c.Check(filepath.Join(s.bootdir, "grub", "ubuntu-kernel_42.snap", "kernel.efi"), testutil.FileEquals, kernelEfi)
+	c.Check(filepath.Join(s.bootdir, "grub", "ubuntu-kernel_42.snap", "kernel.img"), testutil.FileAbsent)
+
+	// kernel.efi cannot be inspected
+	c.Assert(os.WriteFile(filepath.Join(snapDir, "kernel.efi"), []byte("garbage"), 0644), IsNil)
+	err = g.ExtractKernelAssets(info, snapdir.New(snapDir))
+	c.Check(err, ErrorMatches, "cannot read kernel image: .*")
+}
+
 func (s *grubTestSuite) TestExtractKernelForceWorks(c *C) {
 	s.makeFakeGrubEnv(c)
 
@@ -192,26 +192,32 @@ func (l *lkenvTestSuite) TestSave(c *C) {
 		{
 			lkenv.V1,
 			map[string]string{
-				"snap_mode":         boot.TryingStatus,
-				"snap_kernel":       "kernel-1",
-				"snap_try_kernel":   "kernel-2",
-				"snap_core":         "core-1",
-				"snap_try_core":     "core-2",
-				"snap_gadget":       "gadget-1",
-				"snap_try_gadget":   "gadget-2",
-				"bootimg_file_name": "boot.img",
+				"snap_mode":          boot.TryingStatus,
+				"snap_kernel":        "kernel-1",
+				"snap_try_kernel":    "kernel-2",
+				"snap_core":          "core-1",
+				"snap_try_core":      "core-2",
+				"snap_gadget":        "gadget-1",
+				"snap_try_gadget":    "gadget-2",
+				"gadget_slot_status": boot.TryStatus,
+				"gadget_slot":        "a",
+				"gadget_try_slot":    "b",
+				"bootimg_file_name":  "boot.img",
 			},
 			"lkenv v1",
 		},
 		{
 			lkenv.V2Run,
 			map[string]string{
-				"kernel_status":     boot.TryStatus,
-				"snap_kernel":       "kernel-1",
-				"snap_try_kernel":   "kernel-2",
-				"snap_gadget":       "gadget-1",
-				"snap_try_gadget":   "gadget-2",
-				"bootimg_file_name": "boot.img",
+				"kernel_status":      boot.TryStatus,
+				"snap_kernel":        "kernel-1",
+				"snap_try_kernel":    "kernel-2",
+				"snap_gadget":        "gadget-1",
+				"snap_try_gadget":    "gadget-2",
+				"gadget_slot_status": boot.TryingStatus,
+				"gadget_slot":        "b",
+				"gadget_try_slot":    "a",
+				"bootimg_file_name":  "boot.img",
 			},
 			"lkenv v2 run",
 		},
@@ -120,10 +120,16 @@ type SnapBootSelect_v1 struct {
 	 */
 	Gadget_asset_matrix [SNAP_BOOTIMG_PART_NUM][2][SNAP_FILE_NAME_MAX_LEN]byte
 
+	/* GADGET assets: current slot ("a" or "b") of A/B paired structures */
+	Gadget_slot [SNAP_FILE_NAME_MAX_LEN]byte
+	/* GADGET assets: slot of A/B paired structures to try */
+	Gadget_try_slot [SNAP_FILE_NAME_MAX_LEN]byte
+	/* GADGET assets: status of the switch to Gadget_try_slot, one of:
+	 * 'empty', "try", "trying"
+	 */
+	Gadget_slot_status [SNAP_FILE_NAME_MAX_LEN]byte
+
 	/* unused placeholders for additional parameters in the future */
-	Unused_key_01 [SNAP_FILE_NAME_MAX_LEN]byte
-	Unused_key_02 [SNAP_FILE_NAME_MAX_LEN]byte
-	Unused_key_03 [SNAP_FILE_NAME_MAX_LEN]byte
 	Unused_key_04 [SNAP_FILE_NAME_MAX_LEN]byte
 	Unused_key_05 [SNAP_FILE_NAME_MAX_LEN]byte
 	Unused_key_06 [SNAP_FILE_NAME_MAX_LEN]byte
@@ -176,6 +182,12 @@ func (v1 *SnapBootSelect_v1) get(key string) string {
 		return cToGoString(v1.Snap_gadget[:])
 	case "snap_try_gadget":
 		return cToGoString(v1.Snap_try_gadget[:])
+	case "gadget_slot":
+		return cToGoString(v1.Gadget_slot[:])
+	case "gadget_try_slot":
+		return cToGoString(v1.Gadget_try_slot[:])
+	case "gadget_slot_status":
+		return cToGoString(v1.Gadget_slot_status[:])
 	case "reboot_reason":
 		return cToGoString(v1.Reboot_reason[:])
 	case "bootimg_file_name":
@@ -200,6 +212,12 @@ func (v1 *SnapBootSelect_v1) set(key, value string) {
 		copyString(v1.Snap_gadget[:], value)
 	case "snap_try_gadget":
 		copyString(v1.Snap_try_gadget[:], value)
+	case "gadget_slot":
+		copyString(v1.Gadget_slot[:], value)
+	case "gadget_try_slot":
+		copyString(v1.Gadget_try_slot[:], value)
+	case "gadget_slot_status":
+		copyString(v1.Gadget_slot_status[:], value)
 	case "reboot_reason":
 		copyString(v1.Reboot_reason[:], value)
 	case "bootimg_file_name":
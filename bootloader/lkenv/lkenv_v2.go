@@ -281,10 +281,16 @@ type SnapBootSelect_v2_run struct {
 	 */
 	Gadget_asset_matrix [SNAP_RUN_BOOTIMG_PART_NUM][2][SNAP_FILE_NAME_MAX_LEN]byte
 
+	/* GADGET assets: current slot ("a" or "b") of A/B paired structures */
+	Gadget_slot [SNAP_FILE_NAME_MAX_LEN]byte
+	/* GADGET assets: slot of A/B paired structures to try */
+	Gadget_try_slot [SNAP_FILE_NAME_MAX_LEN]byte
+	/* GADGET assets: status of the switch to Gadget_try_slot, one of:
+	 * 'empty', "try", "trying"
+	 */
+	Gadget_slot_status [SNAP_FILE_NAME_MAX_LEN]byte
+
 	/* unused placeholders for additional parameters in the future */
-	Unused_key_01 [SNAP_FILE_NAME_MAX_LEN]byte
-	Unused_key_02 [SNAP_FILE_NAME_MAX_LEN]byte
-	Unused_key_03 [SNAP_FILE_NAME_MAX_LEN]byte
 	Unused_key_04 [SNAP_FILE_NAME_MAX_LEN]byte
 	Unused_key_05 [SNAP_FILE_NAME_MAX_LEN]byte
 	Unused_key_06 [SNAP_FILE_NAME_MAX_LEN]byte
@@ -333,6 +339,12 @@ func (v2run *SnapBootSelect_v2_run) get(key string) string {
 		return cToGoString(v2run.Snap_gadget[:])
 	case "snap_try_gadget":
 		return cToGoString(v2run.Snap_try_gadget[:])
+	case "gadget_slot":
+		return cToGoString(v2run.Gadget_slot[:])
+	case "gadget_try_slot":
+		return cToGoString(v2run.Gadget_try_slot[:])
+	case "gadget_slot_status":
+		return cToGoString(v2run.Gadget_slot_status[:])
 	case "bootimg_file_name":
 		return cToGoString(v2run.Bootimg_file_name[:])
 	}
@@ -351,6 +363,12 @@ func (v2run *SnapBootSelect_v2_run) set(key, value string) {
 		copyString(v2run.Snap_gadget[:], value)
 	case "snap_try_gadget":
 		copyString(v2run.Snap_try_gadget[:], value)
+	case "gadget_slot":
+		copyString(v2run.Gadget_slot[:], value)
+	case "gadget_try_slot":
+		copyString(v2run.Gadget_try_slot[:], value)
+	case "gadget_slot_status":
+		copyString(v2run.Gadget_slot_status[:], value)
 	case "bootimg_file_name":
 		copyString(v2run.Bootimg_file_name[:], value)
 	}
@@ -0,0 +1,752 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package bootloader
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/snapcore/snapd/arch"
+	"github.com/snapcore/snapd/bootloader/assets"
+	"github.com/snapcore/snapd/bootloader/efi"
+	"github.com/snapcore/snapd/bootloader/grubenv"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap"
+)
+
+// sdboot implements the required interfaces
+var (
+	_ Bootloader                             = (*sdboot)(nil)
+	_ RecoveryAwareBootloader                = (*sdboot)(nil)
+	_ ExtractedRecoveryKernelImageBootloader = (*sdboot)(nil)
+	_ ExtractedRunKernelImageBootloader      = (*sdboot)(nil)
+	_ TryKernelAwareBootloader               = (*sdboot)(nil)
+	_ TrustedAssetsBootloader                = (*sdboot)(nil)
+	_ UefiBootloader                         = (*sdboot)(nil)
+)
+
+// systemd-boot cannot run scripts nor read an environment, so the boot
+// entries (see the Boot Loader Specification) are written by snapd whenever
+// the boot variables change. The recovery systems entries are kept on
+// ubuntu-seed, which is the ESP, and the run mode entries on ubuntu-boot,
+// which is expected to be an XBOOTLDR partition so that systemd-boot on the
+// ESP picks them up.
+//
+// The entry to boot is selected through the entry sort keys, systemd-boot
+// boots the first entry in sort order, skipping the entries that ran out of
+// boot tries.
+const (
+	sdbootEnvFile     = "EFI/ubuntu/sdbootenv"
+	sdbootKernelsDir  = "EFI/ubuntu"
+	sdbootLoaderConf  = "loader/loader.conf"
+	sdbootEntriesDir  = "loader/entries"
+	sdbootConfigAsset = "sd-boot-loader.conf"
+
+	sdbootRunEntry = "snapd-run.conf"
+	// the try-kernel entry has a single boot try, once systemd-boot
+	// has booted it the counter drops to zero and the entry is sorted
+	// last so that the run entry is booted next
+	sdbootTryEntry     = "snapd-try+1.conf"
+	sdbootTryEntryGlob = "snapd-try*.conf"
+	// the entry id has the boot counter removed
+	sdbootTryEntryID = "snapd-try.conf"
+)
+
+const (
+	sdbootSortKeySelectedRecovery = "snapd-0"
+	sdbootSortKeyTry              = "snapd-1"
+	sdbootSortKeyRun              = "snapd-2"
+	sdbootSortKeyRecovery         = "snapd-3"
+)
+
+// sdbootLoaderEntrySelectedVar is set by systemd-boot to the id of the
+// booted entry.
+const sdbootLoaderEntrySelectedVar = "LoaderEntrySelected-4a67b082-0a4c-41cf-b6c7-440b29bb8c4f"
+
+type sdboot struct {
+	rootdir string
+
+	role             Role
+	prepareImageTime bool
+}
+
+// newSdboot creates a new systemd-boot bootloader object
+func newSdboot(rootdir string, opts *Options) Bootloader {
+	b := &sdboot{rootdir: rootdir}
+	if opts != nil {
+		b.role = opts.Role
+		b.prepareImageTime = opts.PrepareImageTime
+		if opts.Role == RoleRunMode && !opts.NoSlashBoot {
+			// the entries are at the top of ubuntu-boot, which
+			// is not visible through /boot
+			b.rootdir = filepath.Join(rootdir, "run/mnt/ubuntu-boot")
+		}
+	}
+	return b
+}
+
+func (b *sdboot) Name() string {
+	return "sd-boot"
+}
+
+func (b *sdboot) path(elem ...string) string {
+	if b.rootdir == "" {
+		panic("internal error: unset rootdir")
+	}
+	return filepath.Join(append([]string{b.rootdir}, elem...)...)
+}
+
+func (b *sdboot) envFile() string {
+	return b.path(sdbootEnvFile)
+}
+
+// Present returns true when the environment kept by snapd exists, the
+// loader config alone could have been set up by other tools.
+func (b *sdboot) Present() (bool, error) {
+	if b.role == RoleSole {
+		return false, nil
+	}
+	return osutil.FileExists(b.envFile()), nil
+}
+
+func (b *sdboot) InstallBootConfig(gadgetDir string, opts *Options) error {
+	if b.role == RoleSole {
+		return fmt.Errorf("cannot use sd-boot bootloader before UC20")
+	}
+	if err := genericSetBootConfigFromAsset(b.path(sdbootLoaderConf), sdbootConfigAsset); err != nil {
+		return err
+	}
+	if osutil.FileExists(b.envFile()) {
+		return nil
+	}
+	_, err := b.setEnv(b.envFile(), nil)
+	return err
+}
+
+func loadSdbootEnv(path string) (*grubenv.Env, error) {
+	env := grubenv.NewEnv(path)
+	if err := env.Load(); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return env, nil
+}
+
+func (b *sdboot) setEnv(path string, values map[string]string) (*grubenv.Env, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	env, err := loadSdbootEnv(path)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range values {
+		env.Set(k, v)
+	}
+	if err := env.Save(); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+func (b *sdboot) GetBootVars(names ...string) (map[string]string, error) {
+	env, err := loadSdbootEnv(b.envFile())
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]string, len(names))
+	for _, name := range names {
+		out[name] = env.Get(name)
+	}
+	return out, nil
+}
+
+// SetBootVars sets the boot variables and rewrites the boot entries that
+// depend on them.
+func (b *sdboot) SetBootVars(values map[string]string) error {
+	env, err := b.setEnv(b.envFile(), values)
+	if err != nil {
+		return err
+	}
+
+	if b.role == RoleRecovery {
+		return b.writeRecoveryEntries(env)
+	}
+	// the run mode entries only depend on the command line
+	for _, k := range []string{"snapd_extra_cmdline_args", "snapd_full_cmdline_args"} {
+		if _, ok := values[k]; ok {
+			return b.rewriteRunEntries(env)
+		}
+	}
+	return nil
+}
+
+// SetBootVarsFromInitramfs sets the boot variables without touching the boot
+// entries.
+func (b *sdboot) SetBootVarsFromInitramfs(values map[string]string) error {
+	_, err := b.setEnv(b.envFile(), values)
+	return err
+}
+
+// BootedTryKernel returns true if systemd-boot booted the try-kernel entry.
+func (b *sdboot) BootedTryKernel() (bool, error) {
+	entry, _, err := efi.ReadVarString(sdbootLoaderEntrySelectedVar)
+	if err != nil {
+		return false, err
+	}
+	return entry == sdbootTryEntryID, nil
+}
+
+type sdbootEntry struct {
+	title   string
+	sortKey string
+	// efi is the path of the EFI binary relative to the partition
+	efi     string
+	options string
+}
+
+func (e *sdbootEntry) write(path string) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "title %s\n", e.title)
+	fmt.Fprintf(&buf, "sort-key %s\n", e.sortKey)
+	fmt.Fprintf(&buf, "efi /%s\n", e.efi)
+	if e.options != "" {
+		fmt.Fprintf(&buf, "options %s\n", e.options)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return osutil.AtomicWriteFile(path, buf.Bytes(), 0644, 0)
+}
+
+// entryKernel returns the kernel snap booted by the given run mode entry.
+func entryKernel(path string) (snap.PlaceInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read boot entry: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		efiPath := strings.TrimPrefix(scanner.Text(), "efi ")
+		if efiPath == scanner.Text() {
+			continue
+		}
+		kernelSnapFileName := filepath.Base(filepath.Dir(strings.TrimSpace(efiPath)))
+		sn, err := snap.ParsePlaceInfoFromSnapFileName(kernelSnapFileName)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse kernel snap file name from boot entry %s: %v", filepath.Base(path), err)
+		}
+		return sn, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read boot entry: %v", err)
+	}
+	return nil, fmt.Errorf("cannot find kernel in boot entry %s", filepath.Base(path))
+}
+
+func (b *sdboot) ExtractKernelAssets(s snap.PlaceInfo, snapf snap.Container) error {
+	// recovery kernels are extracted with ExtractRecoveryKernelAssets
+	if b.role != RoleRunMode {
+		return nil
+	}
+	return extractKernelAssetsToBootDir(b.path(sdbootKernelsDir, s.Filename()), snapf, []string{"kernel.efi"})
+}
+
+func (b *sdboot) RemoveKernelAssets(s snap.PlaceInfo) error {
+	return removeKernelAssetsFromBootDir(b.path(sdbootKernelsDir), s)
+}
+
+func (b *sdboot) ExtractRecoveryKernelAssets(recoverySystemDir string, s snap.PlaceInfo, snapf snap.Container) error {
+	if recoverySystemDir == "" {
+		return fmt.Errorf("internal error: recoverySystemDir unset")
+	}
+	return extractKernelAssetsToBootDir(b.path(recoverySystemDir, "kernel"), snapf, []string{"kernel.efi"})
+}
+
+func cmdlineComponentsFromEnv(env *grubenv.Env) CommandLineComponents {
+	// as in grub.cfg, full arguments take precedence
+	pieces := CommandLineComponents{FullArgs: env.Get("snapd_full_cmdline_args")}
+	if pieces.FullArgs == "" {
+		pieces.ExtraArgs = env.Get("snapd_extra_cmdline_args")
+	}
+	return pieces
+}
+
+func (b *sdboot) writeRunEntry(env *grubenv.Env, path, title, sortKey string, s snap.PlaceInfo) error {
+	kernelEfi := filepath.Join(sdbootKernelsDir, s.Filename(), "kernel.efi")
+	// make sure the kernel was extracted so that the entry can be booted
+	if !osutil.FileExists(b.path(kernelEfi)) {
+		return fmt.Errorf("cannot enable kernel %s: %v", kernelEfi, os.ErrNotExist)
+	}
+
+	pieces := cmdlineComponentsFromEnv(env)
+	pieces.ModeArg = "snapd_recovery_mode=run"
+	cmdline, err := b.entryOptions(kernelEfi, pieces)
+	if err != nil {
+		return err
+	}
+
+	entry := &sdbootEntry{
+		title:   title,
+		sortKey: sortKey,
+		efi:     kernelEfi,
+		options: cmdline,
+	}
+	return entry.write(path)
+}
+
+// entryOptions returns the command line to pass to the given kernel. There
+// is none for Unified Kernel Images with an embedded command line, so that
+// the kernel gets the same command line whether Secure Boot is enabled or
+// not.
+func (b *sdboot) entryOptions(kernelEfi string, pieces CommandLineComponents) (string, error) {
+	uki, err := readUnifiedKernelImageFile(b.path(kernelEfi))
+	if err != nil {
+		return "", err
+	}
+	if uki != nil && uki.HasCmdline {
+		return "", nil
+	}
+	return b.CommandLine(pieces)
+}
+
+func (b *sdboot) tryEntries() ([]string, error) {
+	return filepath.Glob(b.path(sdbootEntriesDir, sdbootTryEntryGlob))
+}
+
+// rewriteRunEntries updates the run mode entries after a change of the
+// command line. The try-kernel entry keeps its name so that its boot counter
+// is preserved.
+func (b *sdboot) rewriteRunEntries(env *grubenv.Env) error {
+	runEntry := b.path(sdbootEntriesDir, sdbootRunEntry)
+	if osutil.FileExists(runEntry) {
+		kernel, err := entryKernel(runEntry)
+		if err != nil {
+			return err
+		}
+		if err := b.writeRunEntry(env, runEntry, "Ubuntu Core", sdbootSortKeyRun, kernel); err != nil {
+			return err
+		}
+	}
+
+	tryEntries, err := b.tryEntries()
+	if err != nil {
+		return err
+	}
+	for _, tryEntry := range tryEntries {
+		kernel, err := entryKernel(tryEntry)
+		if err != nil {
+			return err
+		}
+		if err := b.writeRunEntry(env, tryEntry, "Ubuntu Core (try)", sdbootSortKeyTry, kernel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnableKernel writes the run mode entry booting the given kernel snap,
+// which must have been extracted already.
+func (b *sdboot) EnableKernel(s snap.PlaceInfo) error {
+	env, err := loadSdbootEnv(b.envFile())
+	if err != nil {
+		return err
+	}
+	return b.writeRunEntry(env, b.path(sdbootEntriesDir, sdbootRunEntry), "Ubuntu Core", sdbootSortKeyRun, s)
+}
+
+// EnableTryKernel writes the try-kernel entry booting the given kernel snap,
+// which must have been extracted already. The entry is booted once.
+func (b *sdboot) EnableTryKernel(s snap.PlaceInfo) error {
+	env, err := loadSdbootEnv(b.envFile())
+	if err != nil {
+		return err
+	}
+	// reset the boot counter of a previous try
+	if err := b.DisableTryKernel(); err != nil {
+		return err
+	}
+	return b.writeRunEntry(env, b.path(sdbootEntriesDir, sdbootTryEntry), "Ubuntu Core (try)", sdbootSortKeyTry, s)
+}
+
+// DisableTryKernel removes the try-kernel entry, whatever its boot counter.
+func (b *sdboot) DisableTryKernel() error {
+	tryEntries, err := b.tryEntries()
+	if err != nil {
+		return err
+	}
+	for _, tryEntry := range tryEntries {
+		if err := os.Remove(tryEntry); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Kernel returns the kernel snap booted by the run mode entry.
+func (b *sdboot) Kernel() (snap.PlaceInfo, error) {
+	return entryKernel(b.path(sdbootEntriesDir, sdbootRunEntry))
+}
+
+// TryKernel returns the kernel snap booted by the try-kernel entry, the
+// entry is reported even if it ran out of boot tries.
+func (b *sdboot) TryKernel() (snap.PlaceInfo, error) {
+	tryEntries, err := b.tryEntries()
+	if err != nil {
+		return nil, err
+	}
+	if len(tryEntries) == 0 {
+		return nil, ErrNoTryKernelRef
+	}
+	return entryKernel(tryEntries[0])
+}
+
+func (b *sdboot) recoverySystemEnvFile(recoverySystemDir string) string {
+	return b.path(recoverySystemDir, "sdbootenv")
+}
+
+func (b *sdboot) SetRecoverySystemEnv(recoverySystemDir string, values map[string]string) error {
+	if recoverySystemDir == "" {
+		return fmt.Errorf("internal error: recoverySystemDir unset")
+	}
+	if _, err := b.setEnv(b.recoverySystemEnvFile(recoverySystemDir), values); err != nil {
+		return err
+	}
+	env, err := loadSdbootEnv(b.envFile())
+	if err != nil {
+		return err
+	}
+	return b.writeRecoveryEntries(env)
+}
+
+func (b *sdboot) GetRecoverySystemEnv(recoverySystemDir string, key string) (string, error) {
+	if recoverySystemDir == "" {
+		return "", fmt.Errorf("internal error: recoverySystemDir unset")
+	}
+	env, err := loadSdbootEnv(b.recoverySystemEnvFile(recoverySystemDir))
+	if err != nil {
+		return "", err
+	}
+	return env.Get(key), nil
+}
+
+var sdbootRecoveryModes = []struct {
+	mode  string
+	title string
+}{
+	{"recover", "Recover using %s"},
+	{"install", "Install using %s"},
+	{"factory-reset", "Factory reset using %s"},
+}
+
+// writeRecoveryEntries writes the entries of all the recovery systems with
+// an extracted kernel, selecting the one for the mode and system in the
+// environment, and removes the entries of systems that are gone.
+func (b *sdboot) writeRecoveryEntries(env *grubenv.Env) error {
+	mode := env.Get("snapd_recovery_mode")
+	if mode == "" {
+		mode = "install"
+	}
+	system := env.Get("snapd_recovery_system")
+
+	kernels, err := filepath.Glob(b.path("systems/*/kernel/kernel.efi"))
+	if err != nil {
+		return err
+	}
+
+	written := make(map[string]bool)
+	for _, kernel := range kernels {
+		label := filepath.Base(filepath.Dir(filepath.Dir(kernel)))
+		if system == "" {
+			// as with grub, default to the first system
+			system = label
+		}
+		systemEnv, err := loadSdbootEnv(b.recoverySystemEnvFile(filepath.Join("systems", label)))
+		if err != nil {
+			return err
+		}
+
+		kernelEfi := filepath.Join("systems", label, "kernel/kernel.efi")
+		for _, m := range sdbootRecoveryModes {
+			pieces := cmdlineComponentsFromEnv(systemEnv)
+			pieces.ModeArg = "snapd_recovery_mode=" + m.mode
+			pieces.SystemArg = "snapd_recovery_system=" + label
+			cmdline, err := b.entryOptions(kernelEfi, pieces)
+			if err != nil {
+				return err
+			}
+
+			sortKey := sdbootSortKeyRecovery
+			if m.mode == mode && label == system {
+				sortKey = sdbootSortKeySelectedRecovery
+			}
+			name := fmt.Sprintf("snapd-%s-%s.conf", m.mode, label)
+			entry := &sdbootEntry{
+				title:   fmt.Sprintf(m.title, label),
+				sortKey: sortKey,
+				efi:     kernelEfi,
+				options: cmdline,
+			}
+			if err := entry.write(b.path(sdbootEntriesDir, name)); err != nil {
+				return err
+			}
+			written[name] = true
+		}
+	}
+
+	entries, err := filepath.Glob(b.path(sdbootEntriesDir, "snapd-*.conf"))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if written[filepath.Base(entry)] {
+			continue
+		}
+		if err := os.Remove(entry); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateBootConfig updates the loader config only if it is already managed
+// and has a lower edition.
+//
+// Implements TrustedAssetsBootloader for the sd-boot bootloader.
+func (b *sdboot) UpdateBootConfig() (bool, error) {
+	return genericUpdateBootConfigFromAssets(b.path(sdbootLoaderConf), sdbootConfigAsset)
+}
+
+// ManagedAssets returns a list relative paths to boot assets inside the root
+// directory of the filesystem.
+//
+// Implements TrustedAssetsBootloader for the sd-boot bootloader.
+func (b *sdboot) ManagedAssets() []string {
+	return []string{sdbootLoaderConf}
+}
+
+func (b *sdboot) defaultCommandLineForEdition(edition uint) string {
+	cmdline := assets.SnippetForEdition(sdbootConfigAsset+":static-cmdline", edition)
+	if cmdline == nil {
+		return ""
+	}
+	return string(cmdline)
+}
+
+// CommandLine returns the kernel command line composed of mode and system
+// arguments, followed by either the static arguments corresponding to the
+// on-disk loader config edition and any extra arguments, or a separate set
+// of arguments provided in the components.
+//
+// Implements TrustedAssetsBootloader for the sd-boot bootloader.
+func (b *sdboot) CommandLine(pieces CommandLineComponents) (string, error) {
+	cmdline, err := b.DefaultCommandLine(false)
+	if err != nil {
+		return "", err
+	}
+	return composeCommandLine(cmdline, pieces)
+}
+
+// CandidateCommandLine is similar to CommandLine, but uses the current
+// edition of the managed loader config as reference.
+//
+// Implements TrustedAssetsBootloader for the sd-boot bootloader.
+func (b *sdboot) CandidateCommandLine(pieces CommandLineComponents) (string, error) {
+	cmdline, err := b.DefaultCommandLine(true)
+	if err != nil {
+		return "", err
+	}
+	return composeCommandLine(cmdline, pieces)
+}
+
+// DefaultCommandLine returns the default kernel command-line used by
+// the bootloader excluding the recovery mode and system parameters.
+func (b *sdboot) DefaultCommandLine(candidate bool) (string, error) {
+	var edition uint
+	var err error
+	if candidate {
+		edition, err = editionFromInternalConfigAsset(sdbootConfigAsset)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		edition, err = editionFromDiskConfigAssetFallback(b.path(sdbootLoaderConf))
+		if err != nil {
+			return "", fmt.Errorf("cannot obtain edition number of current boot config: %v", err)
+		}
+	}
+	return b.defaultCommandLineForEdition(edition), nil
+}
+
+// sdbootBootAssetPath contains the paths for assets in the boot chain.
+type sdbootBootAssetPath struct {
+	sdbootBinary   taggedPath
+	fallbackBinary taggedPath
+}
+
+var sdbootBootAssetsForArch = map[string]sdbootBootAssetPath{
+	"amd64": {
+		sdbootBinary: taggedPath{
+			tag:  "systemd",
+			path: filepath.Join("EFI/systemd/", "systemd-bootx64.efi"),
+		},
+		fallbackBinary: taggedPath{
+			tag:  "boot",
+			path: filepath.Join("EFI/boot/", "bootx64.efi"),
+		},
+	},
+	"arm64": {
+		sdbootBinary: taggedPath{
+			tag:  "systemd",
+			path: filepath.Join("EFI/systemd/", "systemd-bootaa64.efi"),
+		},
+		fallbackBinary: taggedPath{
+			tag:  "boot",
+			path: filepath.Join("EFI/boot/", "bootaa64.efi"),
+		},
+	},
+}
+
+func (b *sdboot) getBootAssetsForArch() (*sdbootBootAssetPath, error) {
+	if b.prepareImageTime {
+		return nil, fmt.Errorf("internal error: retrieving boot assets at prepare image time")
+	}
+	archi := arch.DpkgArchitecture()
+	assets, ok := sdbootBootAssetsForArch[archi]
+	if !ok {
+		return nil, fmt.Errorf("cannot find sd-boot assets for %q", archi)
+	}
+	return &assets, nil
+}
+
+// getRecoveryModeTrustedAssets returns the list of ordered asset chains,
+// which is systemd-boot from the seed partition either from its own
+// location or from the removable media path. There are no run mode assets,
+// the run mode kernels are booted by systemd-boot from the seed partition.
+func (b *sdboot) getRecoveryModeTrustedAssets() ([][]taggedPath, error) {
+	assets, err := b.getBootAssetsForArch()
+	if err != nil {
+		return nil, err
+	}
+	return [][]taggedPath{{assets.sdbootBinary}, {assets.fallbackBinary}}, nil
+}
+
+// TrustedAssets returns the map of relative paths to asset
+// identifers. The relative paths are relative to the bootloader's
+// rootdir.
+func (b *sdboot) TrustedAssets() (map[string]string, error) {
+	switch b.role {
+	case RoleRunMode:
+		return map[string]string{}, nil
+	case RoleRecovery:
+	default:
+		return nil, fmt.Errorf("internal error: trusted assets called without a bootloader role")
+	}
+	chains, err := b.getRecoveryModeTrustedAssets()
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]string)
+	for _, chain := range chains {
+		for _, asset := range chain {
+			ret[asset.path] = asset.Id()
+		}
+	}
+	return ret, nil
+}
+
+func (b *sdboot) bootChains(kernelPath string, kernelRole Role) ([][]BootFile, error) {
+	if b.role != RoleRecovery {
+		return nil, fmt.Errorf("not a recovery bootloader")
+	}
+	assetsSet, err := b.getRecoveryModeTrustedAssets()
+	if err != nil {
+		return nil, err
+	}
+	chains := make([][]BootFile, 0, len(assetsSet))
+	for _, assets := range assetsSet {
+		chain := make([]BootFile, 0, len(assets)+1)
+		for _, ta := range assets {
+			chain = append(chain, NewBootFile("", ta.path, RoleRecovery))
+		}
+		chain = append(chain, NewBootFile(kernelPath, "kernel.efi", kernelRole))
+		chains = append(chains, chain)
+	}
+	return chains, nil
+}
+
+// RecoveryBootChains returns the list of load chains for recovery modes.
+// It should be called on a RoleRecovery bootloader.
+func (b *sdboot) RecoveryBootChains(kernelPath string) ([][]BootFile, error) {
+	return b.bootChains(kernelPath, RoleRecovery)
+}
+
+// BootChains returns the list of load chains for run mode.
+// It should be called on a RoleRecovery bootloader passing the
+// RoleRunMode bootloader.
+func (b *sdboot) BootChains(runBl Bootloader, kernelPath string) ([][]BootFile, error) {
+	if runBl.Name() != b.Name() {
+		return nil, fmt.Errorf("run mode bootloader must be sd-boot")
+	}
+	return b.bootChains(kernelPath, RoleRunMode)
+}
+
+// ParametersForEfiLoadOption returns a serialized load option for the
+// systemd-boot binary. It should be called on a UefiBootloader.
+// updatedAssets is a list of assets that were installed/updated. This
+// only expects trusted assets.
+func (b *sdboot) ParametersForEfiLoadOption(updatedAssets []string) (description string, assetPath string, optionalData []byte, err error) {
+	if b.role != RoleRecovery {
+		return "", "", nil, fmt.Errorf("internal error: run sd-boot does not provide a boot entry")
+	}
+
+	knownAssets, err := b.getBootAssetsForArch()
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	foundSdboot := false
+	foundFallback := false
+	for _, updated := range updatedAssets {
+		switch updated {
+		case knownAssets.sdbootBinary.Id():
+			foundSdboot = true
+		case knownAssets.fallbackBinary.Id():
+			foundFallback = true
+		}
+	}
+
+	switch {
+	case foundSdboot:
+		assetPath = b.path(knownAssets.sdbootBinary.path)
+	case foundFallback:
+		assetPath = b.path(knownAssets.fallbackBinary.path)
+	default:
+		return "", "", nil, ErrNoBootChainFound
+	}
+
+	return "ubuntu", assetPath, nil, nil
+}
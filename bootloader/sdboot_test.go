@@ -0,0 +1,445 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package bootloader_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/arch/archtest"
+	"github.com/snapcore/snapd/bootloader"
+	"github.com/snapcore/snapd/bootloader/assets"
+	"github.com/snapcore/snapd/bootloader/bootloadertest"
+	"github.com/snapcore/snapd/bootloader/efi"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type sdbootTestSuite struct {
+	baseBootenvTestSuite
+}
+
+var _ = Suite(&sdbootTestSuite{})
+
+func (s *sdbootTestSuite) SetUpTest(c *C) {
+	s.baseBootenvTestSuite.SetUpTest(c)
+
+	s.AddCleanup(archtest.MockArchitecture("amd64"))
+	snippets := []assets.ForEditions{
+		{FirstEdition: 1, Snippet: []byte("console=ttyS0 panic=-1")},
+	}
+	s.AddCleanup(assets.MockSnippetsForEdition("sd-boot-loader.conf:static-cmdline", snippets))
+}
+
+func (s *sdbootTestSuite) runBootloader(c *C) bootloader.ExtractedRunKernelImageBootloader {
+	b := bootloader.NewSdboot(s.rootdir, &bootloader.Options{Role: bootloader.RoleRunMode, NoSlashBoot: true})
+	c.Assert(b.InstallBootConfig(c.MkDir(), nil), IsNil)
+	return b
+}
+
+func (s *sdbootTestSuite) recoveryBootloader(c *C) bootloader.ExtractedRunKernelImageBootloader {
+	b := bootloader.NewSdboot(s.rootdir, &bootloader.Options{Role: bootloader.RoleRecovery})
+	c.Assert(b.InstallBootConfig(c.MkDir(), nil), IsNil)
+	return b
+}
+
+// ukiKernelSnap is a kernel snap container shipping only a UKI
+type ukiKernelSnap struct {
+	snap.Container
+
+	kernelEfi []byte
+}
+
+func (k ukiKernelSnap) Unpack(src, dstDir string) error {
+	if src != "kernel.efi" {
+		return fmt.Errorf("unexpected unpack of %q", src)
+	}
+	return os.WriteFile(filepath.Join(dstDir, src), k.kernelEfi, 0644)
+}
+
+var mockKernelEfi = bootloadertest.MakeEfiImage(map[string]string{
+	".linux":  "kernel",
+	".initrd": "initrd",
+})
+
+func (s *sdbootTestSuite) kernelContainer(c *C) snap.Container {
+	return ukiKernelSnap{kernelEfi: mockKernelEfi}
+}
+
+func (s *sdbootTestSuite) extractKernel(c *C, b bootloader.Bootloader, name string) snap.PlaceInfo {
+	info, err := snap.ParsePlaceInfoFromSnapFileName(name)
+	c.Assert(err, IsNil)
+	c.Assert(b.ExtractKernelAssets(info, s.kernelContainer(c)), IsNil)
+	return info
+}
+
+func (s *sdbootTestSuite) TestNewSdboot(c *C) {
+	b := bootloader.NewSdboot(s.rootdir, &bootloader.Options{Role: bootloader.RoleRecovery})
+	c.Assert(b, NotNil)
+	c.Check(b.Name(), Equals, "sd-boot")
+
+	present, err := b.Present()
+	c.Assert(err, IsNil)
+	c.Check(present, Equals, false)
+
+	c.Assert(b.InstallBootConfig(c.MkDir(), nil), IsNil)
+	present, err = b.Present()
+	c.Assert(err, IsNil)
+	c.Check(present, Equals, true)
+	c.Check(filepath.Join(s.rootdir, "loader/loader.conf"), testutil.FileContains, "# Snapd-Boot-Config-Edition: 1\n")
+	c.Check(filepath.Join(s.rootdir, "EFI/ubuntu/sdbootenv"), testutil.FilePresent)
+}
+
+func (s *sdbootTestSuite) TestNewSdbootRunModeUsesUbuntuBoot(c *C) {
+	b := bootloader.NewSdboot(s.rootdir, &bootloader.Options{Role: bootloader.RoleRunMode})
+	c.Assert(b.InstallBootConfig(c.MkDir(), nil), IsNil)
+	c.Check(filepath.Join(s.rootdir, "run/mnt/ubuntu-boot/loader/loader.conf"), testutil.FilePresent)
+	c.Check(filepath.Join(s.rootdir, "run/mnt/ubuntu-boot/EFI/ubuntu/sdbootenv"), testutil.FilePresent)
+}
+
+func (s *sdbootTestSuite) TestNoSoleRole(c *C) {
+	b := bootloader.NewSdboot(s.rootdir, nil)
+	c.Assert(os.MkdirAll(filepath.Join(s.rootdir, "EFI/ubuntu"), 0755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(s.rootdir, "EFI/ubuntu/sdbootenv"), nil, 0644), IsNil)
+
+	present, err := b.Present()
+	c.Assert(err, IsNil)
+	c.Check(present, Equals, false)
+	c.Check(b.InstallBootConfig(c.MkDir(), nil), ErrorMatches, "cannot use sd-boot bootloader before UC20")
+}
+
+func (s *sdbootTestSuite) TestSetGetBootVars(c *C) {
+	b := s.runBootloader(c)
+
+	c.Assert(b.SetBootVars(map[string]string{"kernel_status": "try"}), IsNil)
+	m, err := b.GetBootVars("kernel_status", "unset")
+	c.Assert(err, IsNil)
+	c.Check(m, DeepEquals, map[string]string{"kernel_status": "try", "unset": ""})
+
+	nsb := b.(bootloader.NotScriptableBootloader)
+	c.Assert(nsb.SetBootVarsFromInitramfs(map[string]string{"kernel_status": "trying"}), IsNil)
+	m, err = b.GetBootVars("kernel_status")
+	c.Assert(err, IsNil)
+	c.Check(m, DeepEquals, map[string]string{"kernel_status": "trying"})
+}
+
+func (s *sdbootTestSuite) TestExtractAndRemoveKernelAssets(c *C) {
+	b := s.runBootloader(c)
+
+	info := s.extractKernel(c, b, "pc-kernel_1.snap")
+	kernelEfi := filepath.Join(s.rootdir, "EFI/ubuntu/pc-kernel_1.snap/kernel.efi")
+	c.Check(kernelEfi, testutil.FileEquals, mockKernelEfi)
+
+	c.Assert(b.RemoveKernelAssets(info), IsNil)
+	c.Check(osutil.FileExists(filepath.Dir(kernelEfi)), Equals, false)
+}
+
+func (s *sdbootTestSuite) TestEnableKernel(c *C) {
+	b := s.runBootloader(c)
+
+	_, err := b.Kernel()
+	c.Check(err, ErrorMatches, "cannot read boot entry: .*")
+
+	info, err := snap.ParsePlaceInfoFromSnapFileName("pc-kernel_1.snap")
+	c.Assert(err, IsNil)
+	c.Check(b.EnableKernel(info), ErrorMatches, "cannot enable kernel EFI/ubuntu/pc-kernel_1.snap/kernel.efi: file does not exist")
+
+	s.extractKernel(c, b, "pc-kernel_1.snap")
+	c.Assert(b.EnableKernel(info), IsNil)
+	c.Check(filepath.Join(s.rootdir, "loader/entries/snapd-run.conf"), testutil.FileEquals, `title Ubuntu Core
+sort-key snapd-2
+efi /EFI/ubuntu/pc-kernel_1.snap/kernel.efi
+options snapd_recovery_mode=run console=ttyS0 panic=-1
+`)
+
+	kernel, err := b.Kernel()
+	c.Assert(err, IsNil)
+	c.Check(kernel.Filename(), Equals, "pc-kernel_1.snap")
+}
+
+func (s *sdbootTestSuite) TestEnableDisableTryKernel(c *C) {
+	b := s.runBootloader(c)
+
+	s.extractKernel(c, b, "pc-kernel_1.snap")
+	tryInfo := s.extractKernel(c, b, "pc-kernel_2.snap")
+
+	_, err := b.TryKernel()
+	c.Check(err, Equals, bootloader.ErrNoTryKernelRef)
+
+	c.Assert(b.EnableTryKernel(tryInfo), IsNil)
+	tryEntry := filepath.Join(s.rootdir, "loader/entries/snapd-try+1.conf")
+	c.Check(tryEntry, testutil.FileEquals, `title Ubuntu Core (try)
+sort-key snapd-1
+efi /EFI/ubuntu/pc-kernel_2.snap/kernel.efi
+options snapd_recovery_mode=run console=ttyS0 panic=-1
+`)
+	kernel, err := b.TryKernel()
+	c.Assert(err, IsNil)
+	c.Check(kernel.Filename(), Equals, "pc-kernel_2.snap")
+
+	// systemd-boot decremented the counter when booting the entry, it
+	// is still reported
+	c.Assert(os.Rename(tryEntry, filepath.Join(s.rootdir, "loader/entries/snapd-try+0-1.conf")), IsNil)
+	kernel, err = b.TryKernel()
+	c.Assert(err, IsNil)
+	c.Check(kernel.Filename(), Equals, "pc-kernel_2.snap")
+
+	// enabling again resets the counter
+	c.Assert(b.EnableTryKernel(tryInfo), IsNil)
+	entries, err := filepath.Glob(filepath.Join(s.rootdir, "loader/entries/snapd-try*.conf"))
+	c.Assert(err, IsNil)
+	c.Check(entries, DeepEquals, []string{tryEntry})
+
+	c.Assert(b.DisableTryKernel(), IsNil)
+	c.Check(osutil.FileExists(tryEntry), Equals, false)
+	_, err = b.TryKernel()
+	c.Check(err, Equals, bootloader.ErrNoTryKernelRef)
+	// disabling again is fine
+	c.Assert(b.DisableTryKernel(), IsNil)
+}
+
+func (s *sdbootTestSuite) TestCommandLineChangeRewritesRunEntries(c *C) {
+	b := s.runBootloader(c)
+
+	runInfo := s.extractKernel(c, b, "pc-kernel_1.snap")
+	tryInfo := s.extractKernel(c, b, "pc-kernel_2.snap")
+	c.Assert(b.EnableKernel(runInfo), IsNil)
+	c.Assert(b.EnableTryKernel(tryInfo), IsNil)
+	tryEntry := filepath.Join(s.rootdir, "loader/entries/snapd-try+0-1.conf")
+	c.Assert(os.Rename(filepath.Join(s.rootdir, "loader/entries/snapd-try+1.conf"), tryEntry), IsNil)
+
+	c.Assert(b.SetBootVars(map[string]string{"snapd_extra_cmdline_args": "foo=bar"}), IsNil)
+	c.Check(filepath.Join(s.rootdir, "loader/entries/snapd-run.conf"), testutil.FileContains,
+		"options snapd_recovery_mode=run console=ttyS0 panic=-1 foo=bar\n")
+	// the boot counter is kept
+	c.Check(tryEntry, testutil.FileContains, "options snapd_recovery_mode=run console=ttyS0 panic=-1 foo=bar\n")
+
+	// full arguments take precedence
+	c.Assert(b.SetBootVars(map[string]string{"snapd_full_cmdline_args": "full=1"}), IsNil)
+	c.Check(filepath.Join(s.rootdir, "loader/entries/snapd-run.conf"), testutil.FileContains,
+		"options snapd_recovery_mode=run full=1\n")
+	c.Check(tryEntry, testutil.FileContains, "options snapd_recovery_mode=run full=1\n")
+}
+
+func (s *sdbootTestSuite) TestBootedTryKernel(c *C) {
+	b := s.runBootloader(c)
+	tkab, ok := b.(bootloader.TryKernelAwareBootloader)
+	c.Assert(ok, Equals, true)
+
+	for _, tc := range []struct {
+		entry string
+		exp   bool
+	}{
+		{"snapd-try.conf", true},
+		{"snapd-run.conf", false},
+	} {
+		restore := efi.MockVars(map[string][]byte{
+			"LoaderEntrySelected-4a67b082-0a4c-41cf-b6c7-440b29bb8c4f": bootloadertest.UTF16Bytes(tc.entry),
+		}, nil)
+		booted, err := tkab.BootedTryKernel()
+		restore()
+		c.Assert(err, IsNil)
+		c.Check(booted, Equals, tc.exp, Commentf(tc.entry))
+	}
+
+	restore := efi.MockVars(nil, nil)
+	defer restore()
+	_, err := tkab.BootedTryKernel()
+	c.Check(err, Equals, efi.ErrNoEFISystem)
+}
+
+func (s *sdbootTestSuite) TestRecoveryEntries(c *C) {
+	b := s.recoveryBootloader(c)
+	rbl := b.(bootloader.RecoveryAwareBootloader)
+	erkbl := b.(bootloader.ExtractedRecoveryKernelImageBootloader)
+
+	info, err := snap.ParsePlaceInfoFromSnapFileName("pc-kernel_1.snap")
+	c.Assert(err, IsNil)
+	for _, label := range []string{"20260101", "20260202"} {
+		systemDir := filepath.Join("systems", label)
+		c.Assert(erkbl.ExtractRecoveryKernelAssets(systemDir, info, s.kernelContainer(c)), IsNil)
+		c.Check(filepath.Join(s.rootdir, systemDir, "kernel/kernel.efi"), testutil.FileEquals, mockKernelEfi)
+	}
+	c.Assert(rbl.SetRecoverySystemEnv("systems/20260202", map[string]string{
+		"snapd_extra_cmdline_args": "extra=1",
+	}), IsNil)
+	value, err := rbl.GetRecoverySystemEnv("systems/20260202", "snapd_extra_cmdline_args")
+	c.Assert(err, IsNil)
+	c.Check(value, Equals, "extra=1")
+
+	c.Assert(b.SetBootVars(map[string]string{
+		"snapd_recovery_mode":   "recover",
+		"snapd_recovery_system": "20260202",
+	}), IsNil)
+
+	entriesDir := filepath.Join(s.rootdir, "loader/entries")
+	entries, err := filepath.Glob(filepath.Join(entriesDir, "*.conf"))
+	c.Assert(err, IsNil)
+	c.Check(entries, HasLen, 6)
+	c.Check(filepath.Join(entriesDir, "snapd-recover-20260202.conf"), testutil.FileEquals, `title Recover using 20260202
+sort-key snapd-0
+efi /systems/20260202/kernel/kernel.efi
+options snapd_recovery_mode=recover snapd_recovery_system=20260202 console=ttyS0 panic=-1 extra=1
+`)
+	c.Check(filepath.Join(entriesDir, "snapd-install-20260101.conf"), testutil.FileEquals, `title Install using 20260101
+sort-key snapd-3
+efi /systems/20260101/kernel/kernel.efi
+options snapd_recovery_mode=install snapd_recovery_system=20260101 console=ttyS0 panic=-1
+`)
+	c.Check(filepath.Join(entriesDir, "snapd-factory-reset-20260202.conf"), testutil.FileContains, "sort-key snapd-3\n")
+
+	// the entries of removed systems are removed too
+	c.Assert(os.RemoveAll(filepath.Join(s.rootdir, "systems/20260101")), IsNil)
+	c.Assert(b.SetBootVars(map[string]string{"snapd_recovery_mode": "install"}), IsNil)
+	entries, err = filepath.Glob(filepath.Join(entriesDir, "*.conf"))
+	c.Assert(err, IsNil)
+	c.Check(entries, DeepEquals, []string{
+		filepath.Join(entriesDir, "snapd-factory-reset-20260202.conf"),
+		filepath.Join(entriesDir, "snapd-install-20260202.conf"),
+		filepath.Join(entriesDir, "snapd-recover-20260202.conf"),
+	})
+	c.Check(filepath.Join(entriesDir, "snapd-install-20260202.conf"), testutil.FileContains, "sort-key snapd-0\n")
+	c.Check(filepath.Join(entriesDir, "snapd-recover-20260202.conf"), testutil.FileContains, "sort-key snapd-3\n")
+}
+
+func (s *sdbootTestSuite) TestTrustedAssets(c *C) {
+	b := s.recoveryBootloader(c)
+	tab := b.(bootloader.TrustedAssetsBootloader)
+
+	c.Check(tab.ManagedAssets(), DeepEquals, []string{"loader/loader.conf"})
+	ta, err := tab.TrustedAssets()
+	c.Assert(err, IsNil)
+	c.Check(ta, DeepEquals, map[string]string{
+		"EFI/systemd/systemd-bootx64.efi": "systemd:systemd-bootx64.efi",
+		"EFI/boot/bootx64.efi":            "boot:bootx64.efi",
+	})
+
+	runTab := s.runBootloader(c).(bootloader.TrustedAssetsBootloader)
+	ta, err = runTab.TrustedAssets()
+	c.Assert(err, IsNil)
+	c.Check(ta, HasLen, 0)
+
+	restore := archtest.MockArchitecture("arm64")
+	defer restore()
+	ta, err = tab.TrustedAssets()
+	c.Assert(err, IsNil)
+	c.Check(ta, DeepEquals, map[string]string{
+		"EFI/systemd/systemd-bootaa64.efi": "systemd:systemd-bootaa64.efi",
+		"EFI/boot/bootaa64.efi":            "boot:bootaa64.efi",
+	})
+}
+
+func (s *sdbootTestSuite) TestBootChains(c *C) {
+	b := s.recoveryBootloader(c)
+	tab := b.(bootloader.TrustedAssetsBootloader)
+
+	chains, err := tab.RecoveryBootChains("kernel.snap")
+	c.Assert(err, IsNil)
+	c.Check(chains, DeepEquals, [][]bootloader.BootFile{
+		{
+			bootloader.NewBootFile("", "EFI/systemd/systemd-bootx64.efi", bootloader.RoleRecovery),
+			bootloader.NewBootFile("kernel.snap", "kernel.efi", bootloader.RoleRecovery),
+		}, {
+			bootloader.NewBootFile("", "EFI/boot/bootx64.efi", bootloader.RoleRecovery),
+			bootloader.NewBootFile("kernel.snap", "kernel.efi", bootloader.RoleRecovery),
+		},
+	})
+
+	chains, err = tab.BootChains(s.runBootloader(c), "run-kernel.snap")
+	c.Assert(err, IsNil)
+	c.Check(chains, DeepEquals, [][]bootloader.BootFile{
+		{
+			bootloader.NewBootFile("", "EFI/systemd/systemd-bootx64.efi", bootloader.RoleRecovery),
+			bootloader.NewBootFile("run-kernel.snap", "kernel.efi", bootloader.RoleRunMode),
+		}, {
+			bootloader.NewBootFile("", "EFI/boot/bootx64.efi", bootloader.RoleRecovery),
+			bootloader.NewBootFile("run-kernel.snap", "kernel.efi", bootloader.RoleRunMode),
+		},
+	})
+
+	_, err = tab.BootChains(bootloadertest.Mock("mock", c.MkDir()), "run-kernel.snap")
+	c.Check(err, ErrorMatches, "run mode bootloader must be sd-boot")
+}
+
+func (s *sdbootTestSuite) TestParametersForEfiLoadOption(c *C) {
+	b := s.recoveryBootloader(c)
+	ubl := b.(bootloader.UefiBootloader)
+
+	for _, tc := range []struct {
+		updated []string
+		path    string
+	}{
+		{[]string{"systemd:systemd-bootx64.efi", "boot:bootx64.efi"}, "EFI/systemd/systemd-bootx64.efi"},
+		{[]string{"boot:bootx64.efi"}, "EFI/boot/bootx64.efi"},
+	} {
+		description, assetPath, optionalData, err := ubl.ParametersForEfiLoadOption(tc.updated)
+		c.Assert(err, IsNil)
+		c.Check(description, Equals, "ubuntu")
+		c.Check(assetPath, Equals, filepath.Join(s.rootdir, tc.path))
+		c.Check(optionalData, IsNil)
+	}
+
+	_, _, _, err := ubl.ParametersForEfiLoadOption([]string{"other:other.efi"})
+	c.Check(err, Equals, bootloader.ErrNoBootChainFound)
+
+	runUbl := s.runBootloader(c).(bootloader.UefiBootloader)
+	_, _, _, err = runUbl.ParametersForEfiLoadOption([]string{"systemd:systemd-bootx64.efi"})
+	c.Check(err, ErrorMatches, "internal error: run sd-boot does not provide a boot entry")
+}
+
+func (s *sdbootTestSuite) TestEntriesForUKIWithEmbeddedCommandLine(c *C) {
+	ukiSnap := ukiKernelSnap{kernelEfi: bootloadertest.MakeEfiImage(map[string]string{
+		".linux":   "kernel",
+		".initrd":  "initrd",
+		".cmdline": "snapd_recovery_mode=run console=ttyS0 quiet",
+	})}
+
+	b := s.runBootloader(c)
+	info, err := snap.ParsePlaceInfoFromSnapFileName("pc-kernel_1.snap")
+	c.Assert(err, IsNil)
+	c.Assert(b.ExtractKernelAssets(info, ukiSnap), IsNil)
+	c.Assert(b.EnableKernel(info), IsNil)
+	// the command line embedded in the image is used
+	c.Check(filepath.Join(s.rootdir, "loader/entries/snapd-run.conf"), testutil.FileEquals, `title Ubuntu Core
+sort-key snapd-2
+efi /EFI/ubuntu/pc-kernel_1.snap/kernel.efi
+`)
+
+	rb := s.recoveryBootloader(c)
+	erkbl := rb.(bootloader.ExtractedRecoveryKernelImageBootloader)
+	c.Assert(erkbl.ExtractRecoveryKernelAssets("systems/20260101", info, ukiSnap), IsNil)
+	c.Assert(rb.SetBootVars(map[string]string{"snapd_recovery_mode": "install"}), IsNil)
+	c.Check(filepath.Join(s.rootdir, "loader/entries/snapd-install-20260101.conf"), testutil.FileEquals, `title Install using 20260101
+sort-key snapd-0
+efi /systems/20260101/kernel/kernel.efi
+`)
+}
+
+func (s *sdbootTestSuite) TestEnableKernelInvalidImage(c *C) {
+	b := s.runBootloader(c)
+	info, err := snap.ParsePlaceInfoFromSnapFileName("pc-kernel_1.snap")
+	c.Assert(err, IsNil)
+	c.Assert(b.ExtractKernelAssets(info, ukiKernelSnap{kernelEfi: []byte("garbage")}), IsNil)
+	c.Check(b.EnableKernel(info), ErrorMatches, "cannot read kernel image: .*")
+}
@@ -0,0 +1,99 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package bootloader
+
+import (
+	"debug/pe"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/snapcore/snapd/snap"
+)
+
+// UnifiedKernelImage describes a Unified Kernel Image, that is an EFI
+// stub bundling the kernel with its initrd and possibly a command line in
+// PE sections.
+type UnifiedKernelImage struct {
+	// HasInitrd is set when the image carries an initrd.
+	HasInitrd bool
+	// HasCmdline is set when the image carries a command line, which
+	// the EFI stub uses instead of the command line passed by the
+	// bootloader when Secure Boot is enabled.
+	HasCmdline bool
+	// Cmdline is the command line embedded in the image.
+	Cmdline string
+}
+
+// readUnifiedKernelImage returns the description of the Unified Kernel
+// Image read from r, or nil if it is not one.
+func readUnifiedKernelImage(r io.ReaderAt) (*UnifiedKernelImage, error) {
+	f, err := pe.NewFile(r)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read kernel image: %v", err)
+	}
+	defer f.Close()
+
+	if f.Section(".linux") == nil {
+		// a plain kernel with an EFI stub
+		return nil, nil
+	}
+	uki := &UnifiedKernelImage{
+		HasInitrd: f.Section(".initrd") != nil,
+	}
+	if sec := f.Section(".cmdline"); sec != nil {
+		data, err := sec.Data()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read kernel image command line: %v", err)
+		}
+		// the section is padded with zeros
+		uki.HasCmdline = true
+		uki.Cmdline = strings.TrimSpace(strings.TrimRight(string(data), "\x00"))
+	}
+	return uki, nil
+}
+
+// ReadUnifiedKernelImage returns the description of the kernel.efi shipped
+// by the given kernel snap if it is a Unified Kernel Image. It returns nil
+// for kernel snaps without a kernel.efi or whose kernel.efi is a plain
+// kernel.
+func ReadUnifiedKernelImage(snapf snap.Container) (*UnifiedKernelImage, error) {
+	kernelEfi, err := snapf.RandomAccessFile("kernel.efi")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer kernelEfi.Close()
+	return readUnifiedKernelImage(kernelEfi)
+}
+
+// readUnifiedKernelImageFile is like ReadUnifiedKernelImage but for an
+// already extracted kernel.efi.
+func readUnifiedKernelImageFile(path string) (*UnifiedKernelImage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readUnifiedKernelImage(f)
+}
@@ -0,0 +1,82 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package bootloader_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/bootloader"
+	"github.com/snapcore/snapd/bootloader/bootloadertest"
+	"github.com/snapcore/snapd/snap/snapdir"
+)
+
+type ukiTestSuite struct{}
+
+var _ = Suite(&ukiTestSuite{})
+
+func (s *ukiTestSuite) readUnifiedKernelImage(c *C, kernelEfi []byte) (*bootloader.UnifiedKernelImage, error) {
+	dir := c.MkDir()
+	if kernelEfi != nil {
+		c.Assert(os.WriteFile(filepath.Join(dir, "kernel.efi"), kernelEfi, 0644), IsNil)
+	}
+	return bootloader.ReadUnifiedKernelImage(snapdir.New(dir))
+}
+
+func (s *ukiTestSuite) TestReadUnifiedKernelImage(c *C) {
+	uki, err := s.readUnifiedKernelImage(c, bootloadertest.MakeEfiImage(map[string]string{
+		".linux":   "kernel",
+		".initrd":  "initrd",
+		".cmdline": "console=ttyS0 panic=-1\n\x00\x00",
+	}))
+	c.Assert(err, IsNil)
+	c.Check(uki, DeepEquals, &bootloader.UnifiedKernelImage{
+		HasInitrd:  true,
+		HasCmdline: true,
+		Cmdline:    "console=ttyS0 panic=-1",
+	})
+
+	// the stub built by ubuntu-core-initramfs has no command line
+	uki, err = s.readUnifiedKernelImage(c, bootloadertest.MakeEfiImage(map[string]string{
+		".linux":  "kernel",
+		".initrd": "initrd",
+	}))
+	c.Assert(err, IsNil)
+	c.Check(uki, DeepEquals, &bootloader.UnifiedKernelImage{HasInitrd: true})
+}
+
+func (s *ukiTestSuite) TestReadUnifiedKernelImageNotUKI(c *C) {
+	// no kernel.efi
+	uki, err := s.readUnifiedKernelImage(c, nil)
+	c.Assert(err, IsNil)
+	c.Check(uki, IsNil)
+
+	// a plain kernel
+	uki, err = s.readUnifiedKernelImage(c, bootloadertest.MakeEfiImage(map[string]string{
+		".text": "kernel",
+	}))
+	c.Assert(err, IsNil)
+	c.Check(uki, IsNil)
+
+	_, err = s.readUnifiedKernelImage(c, []byte("not a PE image"))
+	c.Check(err, ErrorMatches, "cannot read kernel image: .*")
+}
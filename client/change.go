@@ -40,6 +40,10 @@ type Change struct {
 	SpawnTime time.Time `json:"spawn-time,omitempty"`
 	ReadyTime time.Time `json:"ready-time,omitempty"`
 
+	// RequestedBy is the UID of the user that requested the change, if
+	// known.
+	RequestedBy *uint32 `json:"requested-by,omitempty"`
+
 	data map[string]*json.RawMessage
 }
 
@@ -134,6 +138,17 @@ const (
 type ChangesOptions struct {
 	SnapName string // if empty, no filtering by name is done
 	Selector ChangeSelector
+
+	// Archived selects the changes that were pruned from the system
+	// state and archived, the selector is ignored in that case.
+	Archived bool
+	// Kind and Status filter the archived changes, if set.
+	Kind   string
+	Status string
+	// After and Before filter the archived changes by the time they
+	// were spawned, if set.
+	After  time.Time
+	Before time.Time
 }
 
 func (client *Client) Changes(opts *ChangesOptions) ([]*Change, error) {
@@ -145,6 +160,21 @@ func (client *Client) Changes(opts *ChangesOptions) ([]*Change, error) {
 		if opts.SnapName != "" {
 			query.Set("for", opts.SnapName)
 		}
+		if opts.Archived {
+			query.Set("archived", "true")
+			if opts.Kind != "" {
+				query.Set("kind", opts.Kind)
+			}
+			if opts.Status != "" {
+				query.Set("status", opts.Status)
+			}
+			if !opts.After.IsZero() {
+				query.Set("after", opts.After.Format(time.RFC3339))
+			}
+			if !opts.Before.IsZero() {
+				query.Set("before", opts.Before.Format(time.RFC3339))
+			}
+		}
 	}
 
 	var chgds []changeAndData
@@ -21,6 +21,7 @@ package client_test
 
 import (
 	"io"
+	"net/url"
 	"time"
 
 	"gopkg.in/check.v1"
@@ -179,6 +180,51 @@ func (cs *clientSuite) TestClientChanges(c *check.C) {
 
 }
 
+func (cs *clientSuite) TestClientChangesArchived(c *check.C) {
+	cs.rsp = `{"type": "sync", "result": [{
+  "id":   "uno",
+  "kind": "install-snap",
+  "summary": "...",
+  "status": "Done",
+  "ready": true,
+  "spawn-time": "2024-01-02T03:04:05Z",
+  "ready-time": "2024-01-02T03:05:05Z",
+  "requested-by": 1000,
+  "tasks": [{"kind": "bar", "summary": "...", "status": "Done", "log": ["2024-01-02T03:05:05Z INFO done"], "progress": {"done": 0, "total": 0}}]
+}]}`
+
+	chgs, err := cs.cli.Changes(&client.ChangesOptions{
+		SnapName: "foo",
+		Archived: true,
+		Kind:     "install-snap",
+		Status:   "Done",
+		After:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Before:   time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{
+		"for":      {"foo"},
+		"archived": {"true"},
+		"kind":     {"install-snap"},
+		"status":   {"Done"},
+		"after":    {"2024-01-01T00:00:00Z"},
+		"before":   {"2024-02-01T00:00:00Z"},
+	})
+	c.Assert(chgs, check.HasLen, 1)
+	uid := uint32(1000)
+	c.Check(chgs[0], check.DeepEquals, &client.Change{
+		ID:          "uno",
+		Kind:        "install-snap",
+		Summary:     "...",
+		Status:      "Done",
+		Ready:       true,
+		SpawnTime:   time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		ReadyTime:   time.Date(2024, 1, 2, 3, 5, 5, 0, time.UTC),
+		RequestedBy: &uid,
+		Tasks:       []*client.Task{{Kind: "bar", Summary: "...", Status: "Done", Log: []string{"2024-01-02T03:05:05Z INFO done"}}},
+	})
+}
+
 func (cs *clientSuite) TestClientChangesData(c *check.C) {
 	cs.rsp = `{"type": "sync", "result": [{
   "id":   "uno",
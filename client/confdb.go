@@ -25,6 +25,7 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"time"
 )
 
 func (c *Client) ConfdbGetViaView(viewID string, requests []string) (result map[string]interface{}, err error) {
@@ -52,3 +53,45 @@ func (c *Client) ConfdbSetViaView(viewID string, requestValues map[string]interf
 	endpoint := fmt.Sprintf("/v2/confdbs/%s", viewID)
 	return c.doAsync("PUT", endpoint, nil, headers, bytes.NewReader(body))
 }
+
+// ConfdbRevision holds a committed change to a confdb.
+type ConfdbRevision struct {
+	Revision   int                      `json:"revision"`
+	Timestamp  time.Time                `json:"timestamp"`
+	Snap       string                   `json:"snap,omitempty"`
+	View       string                   `json:"view,omitempty"`
+	RollbackTo int                      `json:"rollback-to,omitempty"`
+	Changes    []map[string]interface{} `json:"changes,omitempty"`
+	Data       map[string]interface{}   `json:"data"`
+}
+
+// ConfdbHistory returns the recorded revisions of the confdb identified by
+// <account-id>/<confdb>, oldest first.
+func (c *Client) ConfdbHistory(confdbID string) ([]*ConfdbRevision, error) {
+	var revs []*ConfdbRevision
+	endpoint := fmt.Sprintf("/v2/confdbs/%s", confdbID)
+	if _, err := c.doSync("GET", endpoint, nil, nil, nil, &revs); err != nil {
+		return nil, err
+	}
+
+	return revs, nil
+}
+
+// ConfdbRollback restores the data of the given revision of the confdb
+// identified by <account-id>/<confdb>. The hooks of the custodians of all views
+// affected by the restored data check and save it.
+func (c *Client) ConfdbRollback(confdbID string, revision int) (changeID string, err error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"action":   "rollback",
+		"revision": revision,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	headers := make(map[string]string)
+	headers["Content-Type"] = "application/json"
+
+	endpoint := fmt.Sprintf("/v2/confdbs/%s", confdbID)
+	return c.doAsync("POST", endpoint, nil, headers, bytes.NewReader(body))
+}
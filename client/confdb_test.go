@@ -23,6 +23,7 @@ import (
 	"encoding/json"
 	"io"
 	"net/url"
+	"time"
 
 	. "gopkg.in/check.v1"
 )
@@ -59,3 +60,42 @@ func (cs *clientSuite) TestConfdbSet(c *C) {
 	c.Assert(err, IsNil)
 	c.Check(res, DeepEquals, map[string]interface{}{"foo": "bar", "baz": float64(1)})
 }
+
+func (cs *clientSuite) TestConfdbHistory(c *C) {
+	cs.rsp = `{"type": "sync", "result": [
+		{"revision": 1, "timestamp": "2024-11-01T12:00:00Z", "snap": "foo", "view": "c", "changes": [{"a.b": "baz"}], "data": {"a": {"b": "baz"}}},
+		{"revision": 2, "timestamp": "2024-11-01T13:00:00Z", "view": "c", "rollback-to": 1, "data": {}}
+	]}`
+
+	revs, err := cs.cli.ConfdbHistory("a/b")
+	c.Assert(err, IsNil)
+	c.Assert(cs.reqs, HasLen, 1)
+	c.Check(cs.reqs[0].Method, Equals, "GET")
+	c.Check(cs.reqs[0].URL.Path, Equals, "/v2/confdbs/a/b")
+
+	c.Assert(revs, HasLen, 2)
+	c.Check(revs[0].Revision, Equals, 1)
+	c.Check(revs[0].Timestamp.Equal(time.Date(2024, time.November, 1, 12, 0, 0, 0, time.UTC)), Equals, true)
+	c.Check(revs[0].Snap, Equals, "foo")
+	c.Check(revs[0].View, Equals, "c")
+	c.Check(revs[0].Changes, DeepEquals, []map[string]interface{}{{"a.b": "baz"}})
+	c.Check(revs[0].Data, DeepEquals, map[string]interface{}{"a": map[string]interface{}{"b": "baz"}})
+	c.Check(revs[1].RollbackTo, Equals, 1)
+}
+
+func (cs *clientSuite) TestConfdbRollback(c *C) {
+	cs.status = 202
+	cs.rsp = `{"type": "async", "status-code": 202, "change": "42"}`
+
+	chgID, err := cs.cli.ConfdbRollback("a/b", 3)
+	c.Assert(err, IsNil)
+	c.Check(chgID, Equals, "42")
+	c.Assert(cs.reqs, HasLen, 1)
+	c.Check(cs.reqs[0].Method, Equals, "POST")
+	c.Check(cs.reqs[0].Header.Get("Content-Type"), Equals, "application/json")
+	c.Check(cs.reqs[0].URL.Path, Equals, "/v2/confdbs/a/b")
+
+	var body map[string]interface{}
+	c.Assert(json.NewDecoder(cs.reqs[0].Body).Decode(&body), IsNil)
+	c.Check(body, DeepEquals, map[string]interface{}{"action": "rollback", "revision": float64(3)})
+}
@@ -143,6 +143,14 @@ const (
 	// ErrorKindValidationSetNotFound: validation set cannot be found.
 	ErrorKindValidationSetNotFound ErrorKind = "validation-set-not-found"
 
+	// ErrorKindSnapshotKeyRequired: the snapshot set is encrypted and
+	// no key was given. The error `value` is the key source of the
+	// snapshot set ("passphrase" or "device").
+	ErrorKindSnapshotKeyRequired ErrorKind = "snapshot-key-required"
+	// ErrorKindSnapshotKeyInvalid: the given key cannot decrypt the
+	// snapshot set.
+	ErrorKindSnapshotKeyInvalid ErrorKind = "snapshot-key-invalid"
+
 	// ErrorKindAppArmorPromptingNotRunning: AppArmor Prompting is not running.
 	ErrorKindAppArmorPromptingNotRunning ErrorKind = "apparmor-prompting-not-running"
 
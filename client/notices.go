@@ -61,4 +61,9 @@ type NoticeType string
 const (
 	// SnapRunInhibitNotice is recorded when "snap run" is inhibited due refresh.
 	SnapRunInhibitNotice NoticeType = "snap-run-inhibit"
+
+	// ConfdbChangedNotice is recorded when a committed change may have
+	// modified the data visible through a confdb view. Its key is the view
+	// ID, in the form <account>/<confdb>/<view>.
+	ConfdbChangedNotice NoticeType = "confdb-changed"
 )
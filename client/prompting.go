@@ -0,0 +1,143 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"time"
+)
+
+// PromptingConstraints holds the path pattern and the permissions to which
+// a prompting rule applies.
+type PromptingConstraints struct {
+	PathPattern string   `json:"path-pattern,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+// PromptingRule is a rule which allows or denies the requests of a snap to
+// access resources through an interface.
+type PromptingRule struct {
+	ID          string                `json:"id"`
+	Timestamp   time.Time             `json:"timestamp"`
+	User        uint32                `json:"user"`
+	Snap        string                `json:"snap"`
+	Interface   string                `json:"interface"`
+	Constraints *PromptingConstraints `json:"constraints"`
+	Outcome     string                `json:"outcome"`
+	Lifespan    string                `json:"lifespan"`
+	Expiration  time.Time             `json:"expiration,omitempty"`
+	// Admin is true if the rule was set by the administrator for all the
+	// users.
+	Admin bool `json:"admin,omitempty"`
+}
+
+// PromptingRuleContents holds the contents of a prompting rule, as used when
+// importing and exporting rules.
+type PromptingRuleContents struct {
+	Snap        string                `json:"snap"`
+	Interface   string                `json:"interface"`
+	Constraints *PromptingConstraints `json:"constraints"`
+	Outcome     string                `json:"outcome"`
+	Lifespan    string                `json:"lifespan"`
+	Duration    string                `json:"duration,omitempty"`
+}
+
+// Contents returns the contents of the rule, from which an equivalent rule
+// can be imported. The duration of a rule with a lifespan of timespan is the
+// time remaining until its expiration at the given time, rounded up to the
+// second.
+func (r *PromptingRule) Contents(now time.Time) *PromptingRuleContents {
+	contents := &PromptingRuleContents{
+		Snap:        r.Snap,
+		Interface:   r.Interface,
+		Constraints: r.Constraints,
+		Outcome:     r.Outcome,
+		Lifespan:    r.Lifespan,
+	}
+	if r.Lifespan == "timespan" {
+		remaining := r.Expiration.Sub(now)
+		if remaining < time.Second {
+			remaining = time.Second
+		}
+		contents.Duration = (remaining + time.Second - 1).Truncate(time.Second).String()
+	}
+	return contents
+}
+
+// PromptingRulesOptions selects the prompting rules to list.
+type PromptingRulesOptions struct {
+	// Snap and Interface restrict the rules of the user to the ones for the
+	// given snap and/or interface, if set.
+	Snap      string
+	Interface string
+	// Admin selects the rules set by the administrator for all the users
+	// instead of the rules of the user.
+	Admin bool
+}
+
+// PromptingRules lists the prompting rules of the user, or the rules set by
+// the administrator.
+func (client *Client) PromptingRules(opts *PromptingRulesOptions) ([]*PromptingRule, error) {
+	if opts == nil {
+		opts = &PromptingRulesOptions{}
+	}
+	query := url.Values{}
+	if opts.Snap != "" {
+		query.Set("snap", opts.Snap)
+	}
+	if opts.Interface != "" {
+		query.Set("interface", opts.Interface)
+	}
+	if opts.Admin {
+		query.Set("admin", "true")
+	}
+
+	var rules []*PromptingRule
+	_, err := client.doSync("GET", "/v2/interfaces/requests/rules", query, nil, nil, &rules)
+	return rules, err
+}
+
+// ImportPromptingRules adds rules with the given contents to the prompting
+// rules of the user, either all of them or none. If admin is true, the rules
+// replace instead the rules set by the administrator for all the users.
+func (client *Client) ImportPromptingRules(rules []*PromptingRuleContents, admin bool) ([]*PromptingRule, error) {
+	if rules == nil {
+		rules = []*PromptingRuleContents{}
+	}
+	payload := struct {
+		Action string                   `json:"action"`
+		Rules  []*PromptingRuleContents `json:"rules"`
+		Admin  bool                     `json:"admin,omitempty"`
+	}{
+		Action: "import",
+		Rules:  rules,
+		Admin:  admin,
+	}
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(&payload); err != nil {
+		return nil, err
+	}
+
+	var imported []*PromptingRule
+	_, err := client.doSync("POST", "/v2/interfaces/requests/rules", nil, nil, &body, &imported)
+	return imported, err
+}
@@ -0,0 +1,157 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+)
+
+func (cs *clientSuite) TestPromptingRules(c *C) {
+	cs.rsp = `{
+		"type": "sync",
+		"result": [{
+			"id": "0000000000000002",
+			"timestamp": "2024-08-14T09:47:03.350324989-05:00",
+			"user": 1000,
+			"snap": "firefox",
+			"interface": "home",
+			"constraints": {"path-pattern": "/home/test/Downloads/**", "permissions": ["read", "write"]},
+			"outcome": "allow",
+			"lifespan": "timespan",
+			"expiration": "2024-08-15T09:47:03.350324989-05:00"
+		}]
+	}`
+	rules, err := cs.cli.PromptingRules(&client.PromptingRulesOptions{Snap: "firefox", Interface: "home"})
+	c.Assert(err, IsNil)
+	c.Check(cs.req.Method, Equals, "GET")
+	c.Check(cs.req.URL.Path, Equals, "/v2/interfaces/requests/rules")
+	c.Check(cs.req.URL.Query(), DeepEquals, url.Values{
+		"snap":      {"firefox"},
+		"interface": {"home"},
+	})
+	c.Assert(rules, HasLen, 1)
+	c.Check(rules[0].ID, Equals, "0000000000000002")
+	c.Check(rules[0].User, Equals, uint32(1000))
+	c.Check(rules[0].Constraints, DeepEquals, &client.PromptingConstraints{
+		PathPattern: "/home/test/Downloads/**",
+		Permissions: []string{"read", "write"},
+	})
+	c.Check(rules[0].Lifespan, Equals, "timespan")
+	c.Check(rules[0].Admin, Equals, false)
+
+	cs.rsp = `{"type": "sync", "result": [{"id": "0000000000000003", "snap": "firefox", "admin": true}]}`
+	rules, err = cs.cli.PromptingRules(&client.PromptingRulesOptions{Admin: true})
+	c.Assert(err, IsNil)
+	c.Check(cs.req.URL.Query(), DeepEquals, url.Values{
+		"admin": {"true"},
+	})
+	c.Assert(rules, HasLen, 1)
+	c.Check(rules[0].Admin, Equals, true)
+
+	_, err = cs.cli.PromptingRules(nil)
+	c.Assert(err, IsNil)
+	c.Check(cs.req.URL.RawQuery, Equals, "")
+}
+
+func (cs *clientSuite) TestImportPromptingRules(c *C) {
+	cs.rsp = `{"type": "sync", "result": [{"id": "0000000000000004", "snap": "firefox"}]}`
+	contents := []*client.PromptingRuleContents{{
+		Snap:      "firefox",
+		Interface: "home",
+		Constraints: &client.PromptingConstraints{
+			PathPattern: "/home/test/.ssh/**",
+			Permissions: []string{"read"},
+		},
+		Outcome:  "deny",
+		Lifespan: "forever",
+	}}
+	for _, admin := range []bool{false, true} {
+		rules, err := cs.cli.ImportPromptingRules(contents, admin)
+		c.Assert(err, IsNil)
+		c.Check(rules, HasLen, 1)
+		c.Check(cs.req.Method, Equals, "POST")
+		c.Check(cs.req.URL.Path, Equals, "/v2/interfaces/requests/rules")
+
+		body, err := io.ReadAll(cs.req.Body)
+		c.Assert(err, IsNil)
+		var m map[string]any
+		c.Assert(json.Unmarshal(body, &m), IsNil)
+		expected := map[string]any{
+			"action": "import",
+			"rules": []any{map[string]any{
+				"snap":      "firefox",
+				"interface": "home",
+				"constraints": map[string]any{
+					"path-pattern": "/home/test/.ssh/**",
+					"permissions":  []any{"read"},
+				},
+				"outcome":  "deny",
+				"lifespan": "forever",
+			}},
+		}
+		if admin {
+			expected["admin"] = true
+		}
+		c.Check(m, DeepEquals, expected)
+	}
+
+	// Admin rules can be cleared
+	_, err := cs.cli.ImportPromptingRules(nil, true)
+	c.Assert(err, IsNil)
+	body, err := io.ReadAll(cs.req.Body)
+	c.Assert(err, IsNil)
+	c.Check(string(body), Equals, `{"action":"import","rules":[],"admin":true}`+"\n")
+}
+
+func (cs *clientSuite) TestPromptingRuleContents(c *C) {
+	now := time.Now()
+	rule := &client.PromptingRule{
+		ID:        "0000000000000002",
+		User:      1000,
+		Snap:      "firefox",
+		Interface: "home",
+		Constraints: &client.PromptingConstraints{
+			PathPattern: "/home/test/**",
+			Permissions: []string{"read"},
+		},
+		Outcome:  "allow",
+		Lifespan: "forever",
+	}
+	c.Check(rule.Contents(now), DeepEquals, &client.PromptingRuleContents{
+		Snap:        "firefox",
+		Interface:   "home",
+		Constraints: rule.Constraints,
+		Outcome:     "allow",
+		Lifespan:    "forever",
+	})
+
+	rule.Lifespan = "timespan"
+	rule.Expiration = now.Add(90*time.Second + time.Millisecond)
+	c.Check(rule.Contents(now).Duration, Equals, "1m31s")
+	rule.Expiration = now.Add(-time.Minute)
+	c.Check(rule.Contents(now).Duration, Equals, "1s")
+}
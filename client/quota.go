@@ -66,12 +66,20 @@ type QuotaJournalValues struct {
 	*QuotaJournalRate
 }
 
+type QuotaIOValues struct {
+	Device         string        `json:"device"`
+	ReadBandwidth  quantity.Size `json:"read-bandwidth,omitempty"`
+	WriteBandwidth quantity.Size `json:"write-bandwidth,omitempty"`
+}
+
 type QuotaValues struct {
-	Memory  quantity.Size       `json:"memory,omitempty"`
-	CPU     *QuotaCPUValues     `json:"cpu,omitempty"`
-	CPUSet  *QuotaCPUSetValues  `json:"cpu-set,omitempty"`
-	Threads int                 `json:"threads,omitempty"`
-	Journal *QuotaJournalValues `json:"journal,omitempty"`
+	Memory     quantity.Size       `json:"memory,omitempty"`
+	MemorySwap quantity.Size       `json:"memory-swap,omitempty"`
+	CPU        *QuotaCPUValues     `json:"cpu,omitempty"`
+	CPUSet     *QuotaCPUSetValues  `json:"cpu-set,omitempty"`
+	Threads    int                 `json:"threads,omitempty"`
+	Journal    *QuotaJournalValues `json:"journal,omitempty"`
+	IO         *QuotaIOValues      `json:"io,omitempty"`
 }
 
 type EnsureQuotaOptions struct {
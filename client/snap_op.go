@@ -64,6 +64,7 @@ type SnapOptions struct {
 	Time             string          `json:"time,omitempty"`
 	HoldLevel        string          `json:"hold-level,omitempty"`
 	Users            []string        `json:"users,omitempty"`
+	SnapshotKey      *SnapshotKey    `json:"snapshot-key,omitempty"`
 }
 
 func writeFieldBool(mw *multipart.Writer, key string, val bool) error {
@@ -136,6 +137,7 @@ type multiActionData struct {
 	Time           string              `json:"time,omitempty"`
 	HoldLevel      string              `json:"hold-level,omitempty"`
 	Components     map[string][]string `json:"components,omitempty"`
+	SnapshotKey    *SnapshotKey        `json:"snapshot-key,omitempty"`
 }
 
 // Install adds the snap with the given name from the given channel (or
@@ -205,8 +207,9 @@ func (client *Client) Switch(name string, options *SnapOptions) (changeID string
 }
 
 // SnapshotMany snapshots many snaps (all, if names empty) for many users (all, if users is empty).
-func (client *Client) SnapshotMany(names []string, users []string) (setID uint64, changeID string, err error) {
-	result, changeID, err := client.doMultiSnapActionFull("snapshot", names, nil, &SnapOptions{Users: users})
+// If key is not nil the snapshot set is encrypted with it.
+func (client *Client) SnapshotMany(names []string, users []string, key *SnapshotKey) (setID uint64, changeID string, err error) {
+	result, changeID, err := client.doMultiSnapActionFull("snapshot", names, nil, &SnapOptions{Users: users, SnapshotKey: key})
 	if err != nil {
 		return 0, "", err
 	}
@@ -269,6 +272,7 @@ func (client *Client) doMultiSnapActionFull(actionName string, snaps []string, c
 		action.ValidationSets = options.ValidationSets
 		action.Time = options.Time
 		action.HoldLevel = options.HoldLevel
+		action.SnapshotKey = options.SnapshotKey
 	}
 
 	data, err := json.Marshal(&action)
@@ -23,6 +23,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -39,17 +40,100 @@ import (
 // SnapshotExportMediaType is the media type used to identify snapshot exports in the API.
 const SnapshotExportMediaType = "application/x.snapd.snapshot"
 
+// SnapshotKeyHeader is the header used to pass the key of an encrypted
+// snapshot set when exporting or importing it.
+const SnapshotKeyHeader = "X-Snapd-Snapshot-Key"
+
 var (
 	ErrSnapshotSetNotFound   = errors.New("no snapshot set with the given ID")
 	ErrSnapshotSnapsNotFound = errors.New("no snapshot for the requested snaps found in the set with the given ID")
+	ErrSnapshotKeyRequired   = errors.New("snapshot set is encrypted and requires a key")
+	ErrSnapshotKeyInvalid    = errors.New("invalid key for encrypted snapshot set")
+)
+
+// The sources of the keys of encrypted snapshots.
+const (
+	// SnapshotKeySourcePassphrase keys are derived from a user-supplied
+	// passphrase.
+	SnapshotKeySourcePassphrase = "passphrase"
+	// SnapshotKeySourceDevice keys are derived from a key sealed to the
+	// TPM, so the snapshot can only be decrypted on the same device. The
+	// key is bound to the TPM only, not to the boot chain or the model.
+	SnapshotKeySourceDevice = "device"
 )
 
+// A SnapshotKey is used to encrypt a snapshot set, or to access an
+// encrypted one. Exactly one of its fields must be set.
+type SnapshotKey struct {
+	Passphrase string `json:"passphrase,omitempty"`
+	Device     bool   `json:"device,omitempty"`
+}
+
+// Validate checks that the key is well formed.
+func (key *SnapshotKey) Validate() error {
+	if key.Passphrase == "" && !key.Device {
+		return errors.New("snapshot key requires either a passphrase or the device key")
+	}
+	if key.Passphrase != "" && key.Device {
+		return errors.New("snapshot key cannot be both a passphrase and the device key")
+	}
+	return nil
+}
+
+// Source returns the key source of the key.
+func (key *SnapshotKey) Source() string {
+	if key.Device {
+		return SnapshotKeySourceDevice
+	}
+	return SnapshotKeySourcePassphrase
+}
+
+// EncodeHeader encodes the key for use as the value of SnapshotKeyHeader.
+func (key *SnapshotKey) EncodeHeader() (string, error) {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// DecodeSnapshotKeyHeader decodes a key encoded with EncodeHeader.
+func DecodeSnapshotKeyHeader(value string) (*SnapshotKey, error) {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode snapshot key: %v", err)
+	}
+	var key SnapshotKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("cannot decode snapshot key: %v", err)
+	}
+	if err := key.Validate(); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// SnapshotEncryption describes how the archives of an encrypted snapshot
+// are encrypted.
+type SnapshotEncryption struct {
+	// KeySource is where the key comes from, either
+	// SnapshotKeySourcePassphrase or SnapshotKeySourceDevice
+	KeySource string `json:"key-source"`
+	// Salt is the random salt used to derive the key
+	Salt []byte `json:"salt"`
+	// KeyCheck is used to verify that a key is the right one
+	// before trying to decrypt anything with it
+	KeyCheck []byte `json:"key-check"`
+}
+
 // A snapshotAction is used to request an operation on a snapshot.
 type snapshotAction struct {
-	SetID  uint64   `json:"set"`
-	Action string   `json:"action"`
-	Snaps  []string `json:"snaps,omitempty"`
-	Users  []string `json:"users,omitempty"`
+	SetID    uint64       `json:"set,omitempty"`
+	Action   string       `json:"action"`
+	Snaps    []string     `json:"snaps,omitempty"`
+	Users    []string     `json:"users,omitempty"`
+	Key      *SnapshotKey `json:"key,omitempty"`
+	RemoteID string       `json:"remote-id,omitempty"`
 }
 
 // A Snapshot is a collection of archives with a simple metadata json file
@@ -81,6 +165,10 @@ type Snapshot struct {
 	// dynamic snapshot options
 	Options *snap.SnapshotOptions `json:"options,omitempty"`
 
+	// set if the snapshot's archives and configuration are encrypted;
+	// Conf is not set for encrypted snapshots
+	Encryption *SnapshotEncryption `json:"encryption,omitempty"`
+
 	// if the snapshot failed to open this will be the reason why
 	Broken string `json:"broken,omitempty"`
 
@@ -142,6 +230,17 @@ func (ss SnapshotSet) Size() int64 {
 	return sum
 }
 
+// KeySource returns the key source of the set's encrypted snapshots, or
+// an empty string if the set is not encrypted.
+func (ss SnapshotSet) KeySource() string {
+	for _, sh := range ss.Snapshots {
+		if sh.Encryption != nil {
+			return sh.Encryption.KeySource
+		}
+	}
+	return ""
+}
+
 type bySnap []*Snapshot
 
 func (ss bySnap) Len() int           { return len(ss) }
@@ -195,26 +294,48 @@ func (client *Client) ForgetSnapshots(setID uint64, snaps []string) (changeID st
 // CheckSnapshots verifies the archive checksums in the given snapshot set.
 //
 // If snaps or users are non-empty, limit to checking only those
-// archives of the snapshot.
-func (client *Client) CheckSnapshots(setID uint64, snaps []string, users []string) (changeID string, err error) {
+// archives of the snapshot. The key is required for encrypted sets.
+func (client *Client) CheckSnapshots(setID uint64, snaps []string, users []string, key *SnapshotKey) (changeID string, err error) {
 	return client.snapshotAction(&snapshotAction{
 		SetID:  setID,
 		Action: "check",
 		Snaps:  snaps,
 		Users:  users,
+		Key:    key,
 	})
 }
 
 // RestoreSnapshots extracts the given snapshot set.
 //
 // If snaps or users are non-empty, limit to checking only those
-// archives of the snapshot.
-func (client *Client) RestoreSnapshots(setID uint64, snaps []string, users []string) (changeID string, err error) {
+// archives of the snapshot. The key is required for encrypted sets.
+func (client *Client) RestoreSnapshots(setID uint64, snaps []string, users []string, key *SnapshotKey) (changeID string, err error) {
 	return client.snapshotAction(&snapshotAction{
 		SetID:  setID,
 		Action: "restore",
 		Snaps:  snaps,
 		Users:  users,
+		Key:    key,
+	})
+}
+
+// PushSnapshots uploads the given snapshot set to the configured remote
+// snapshot repository. Encrypted sets stay encrypted, so no key is needed.
+func (client *Client) PushSnapshots(setID uint64) (changeID string, err error) {
+	return client.snapshotAction(&snapshotAction{
+		SetID:  setID,
+		Action: "push",
+	})
+}
+
+// PullSnapshots downloads the given snapshot set from the configured remote
+// snapshot repository and imports it as a new snapshot set. The key is
+// required for encrypted sets.
+func (client *Client) PullSnapshots(remoteID string, key *SnapshotKey) (changeID string, err error) {
+	return client.snapshotAction(&snapshotAction{
+		Action:   "pull",
+		RemoteID: remoteID,
+		Key:      key,
 	})
 }
 
@@ -233,9 +354,18 @@ func (client *Client) snapshotAction(action *snapshotAction) (changeID string, e
 
 // SnapshotExport streams the requested snapshot set.
 //
-// The return value includes the length of the returned stream.
-func (client *Client) SnapshotExport(setID uint64) (stream io.ReadCloser, contentLength int64, err error) {
-	rsp, err := client.raw(context.Background(), "GET", fmt.Sprintf("/v2/snapshots/%v/export", setID), nil, nil, nil)
+// The return value includes the length of the returned stream. The key is
+// required for encrypted sets; the exported data stays encrypted.
+func (client *Client) SnapshotExport(setID uint64, key *SnapshotKey) (stream io.ReadCloser, contentLength int64, err error) {
+	var headers map[string]string
+	if key != nil {
+		value, err := key.EncodeHeader()
+		if err != nil {
+			return nil, 0, err
+		}
+		headers = map[string]string{SnapshotKeyHeader: value}
+	}
+	rsp, err := client.raw(context.Background(), "GET", fmt.Sprintf("/v2/snapshots/%v/export", setID), nil, headers, nil)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -260,18 +390,51 @@ func (client *Client) SnapshotExport(setID uint64) (stream io.ReadCloser, conten
 	return rsp.Body, rsp.ContentLength, nil
 }
 
+// A RemoteSnapshotSet is a snapshot set stored in a remote snapshot
+// repository.
+type RemoteSnapshotSet struct {
+	// ID identifies the set in the repository; it is derived from the
+	// content hash of the set, so pushing the same set from different
+	// devices results in a single copy.
+	ID string `json:"id"`
+	// SetID is the ID of the set on the device it was pushed from.
+	SetID uint64    `json:"set-id"`
+	Time  time.Time `json:"time"`
+	Snaps []string  `json:"snaps"`
+	// Size is the size of the exported set in the repository.
+	Size int64 `json:"size"`
+	// KeySource is the source of the key of an encrypted set.
+	KeySource string `json:"key-source,omitempty"`
+}
+
+// RemoteSnapshotSets lists the snapshot sets in the configured remote
+// snapshot repository.
+func (client *Client) RemoteSnapshotSets() ([]RemoteSnapshotSet, error) {
+	var sets []RemoteSnapshotSet
+	_, err := client.doSync("GET", "/v2/snapshots/remote", nil, nil, nil, &sets)
+	return sets, err
+}
+
 // SnapshotImportSet is a snapshot import created by a "snap import-snapshot".
 type SnapshotImportSet struct {
 	ID    uint64   `json:"set-id"`
 	Snaps []string `json:"snaps"`
 }
 
-// SnapshotImport imports an exported snapshot set.
-func (client *Client) SnapshotImport(exportStream io.Reader, size int64) (SnapshotImportSet, error) {
+// SnapshotImport imports an exported snapshot set. The key is required
+// for encrypted sets.
+func (client *Client) SnapshotImport(exportStream io.Reader, size int64, key *SnapshotKey) (SnapshotImportSet, error) {
 	headers := map[string]string{
 		"Content-Type":   SnapshotExportMediaType,
 		"Content-Length": strconv.FormatInt(size, 10),
 	}
+	if key != nil {
+		value, err := key.EncodeHeader()
+		if err != nil {
+			return SnapshotImportSet{}, err
+		}
+		headers[SnapshotKeyHeader] = value
+	}
 
 	var importSet SnapshotImportSet
 	if _, err := client.doSync("POST", "/v2/snapshots", nil, headers, exportStream, &importSet); err != nil {
@@ -129,18 +129,93 @@ func (cs *clientSuite) TestClientForgetSnapshot(c *check.C) {
 	})
 }
 
-func (cs *clientSuite) testClientSnapshotAction(c *check.C, action string, f func(uint64, []string, []string) (string, error)) {
+func (cs *clientSuite) testClientSnapshotAction(c *check.C, action string, f func(uint64, []string, []string, *client.SnapshotKey) (string, error)) {
 	cs.testClientSnapshotActionFull(c, action, []string{"auser", "buser"}, func() (string, error) {
-		return f(42, []string{"asnap", "bsnap"}, []string{"auser", "buser"})
+		return f(42, []string{"asnap", "bsnap"}, []string{"auser", "buser"}, nil)
 	})
 }
 
+func (cs *clientSuite) testClientSnapshotActionWithKey(c *check.C, action string, f func(uint64, []string, []string, *client.SnapshotKey) (string, error)) {
+	cs.status = 202
+	cs.rsp = `{
+		"status-code": 202,
+		"type": "async",
+		"change": "1too3"
+	}`
+	_, err := f(42, nil, nil, &client.SnapshotKey{Passphrase: "s3cret"})
+	c.Assert(err, check.IsNil)
+
+	act, err := client.UnmarshalSnapshotAction(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	c.Check(act.Action, check.Equals, action)
+	c.Check(act.Key, check.DeepEquals, &client.SnapshotKey{Passphrase: "s3cret"})
+}
+
 func (cs *clientSuite) TestClientCheckSnapshots(c *check.C) {
 	cs.testClientSnapshotAction(c, "check", cs.cli.CheckSnapshots)
+	cs.testClientSnapshotActionWithKey(c, "check", cs.cli.CheckSnapshots)
 }
 
 func (cs *clientSuite) TestClientRestoreSnapshots(c *check.C) {
 	cs.testClientSnapshotAction(c, "restore", cs.cli.RestoreSnapshots)
+	cs.testClientSnapshotActionWithKey(c, "restore", cs.cli.RestoreSnapshots)
+}
+
+func (cs *clientSuite) TestClientPushSnapshots(c *check.C) {
+	cs.status = 202
+	cs.rsp = `{
+		"status-code": 202,
+		"type": "async",
+		"change": "1too3"
+	}`
+	id, err := cs.cli.PushSnapshots(42)
+	c.Assert(err, check.IsNil)
+	c.Check(id, check.Equals, "1too3")
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/snapshots")
+
+	act, err := client.UnmarshalSnapshotAction(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	c.Check(act.SetID, check.Equals, uint64(42))
+	c.Check(act.Action, check.Equals, "push")
+	c.Check(act.Key, check.IsNil)
+}
+
+func (cs *clientSuite) TestClientPullSnapshots(c *check.C) {
+	cs.status = 202
+	cs.rsp = `{
+		"status-code": 202,
+		"type": "async",
+		"change": "1too3"
+	}`
+	id, err := cs.cli.PullSnapshots("0123abcd", &client.SnapshotKey{Passphrase: "s3cret"})
+	c.Assert(err, check.IsNil)
+	c.Check(id, check.Equals, "1too3")
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/snapshots")
+
+	body, err := io.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	c.Check(string(body), check.Equals, `{"action":"pull","key":{"passphrase":"s3cret"},"remote-id":"0123abcd"}`)
+}
+
+func (cs *clientSuite) TestClientRemoteSnapshotSets(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"result": [{"id": "0123abcd", "set-id": 42, "time": "2024-01-02T03:04:05Z", "snaps": ["foo"], "size": 1024, "key-source": "device"}]
+}`
+	sets, err := cs.cli.RemoteSnapshotSets()
+	c.Assert(err, check.IsNil)
+	c.Check(sets, check.DeepEquals, []client.RemoteSnapshotSet{{
+		ID:        "0123abcd",
+		SetID:     42,
+		Time:      time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Snaps:     []string{"foo"},
+		Size:      1024,
+		KeySource: client.SnapshotKeySourceDevice,
+	}})
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/snapshots/remote")
 }
 
 func (cs *clientSuite) TestClientExportSnapshotSpecificErr(c *check.C) {
@@ -149,7 +224,7 @@ func (cs *clientSuite) TestClientExportSnapshotSpecificErr(c *check.C) {
 	cs.rsp = content
 	cs.status = 400
 	cs.header = http.Header{"Content-Type": []string{"application/json"}}
-	_, _, err := cs.cli.SnapshotExport(42)
+	_, _, err := cs.cli.SnapshotExport(42, nil)
 	c.Check(err, check.ErrorMatches, "boom")
 }
 
@@ -174,7 +249,7 @@ func (cs *clientSuite) TestClientExportSnapshot(c *check.C) {
 		cs.rsp = t.content
 		cs.status = t.status
 
-		r, size, err := cs.cli.SnapshotExport(42)
+		r, size, err := cs.cli.SnapshotExport(42, nil)
 		if t.status == 200 {
 			c.Assert(err, check.IsNil, comm)
 			c.Assert(cs.countingCloser.closeCalled, check.Equals, 0)
@@ -212,7 +287,7 @@ func (cs *clientSuite) TestClientSnapshotImport(c *check.C) {
 
 		fakeSnapshotData := "fake"
 		r := strings.NewReader(fakeSnapshotData)
-		importSet, err := cs.cli.SnapshotImport(r, int64(len(fakeSnapshotData)))
+		importSet, err := cs.cli.SnapshotImport(r, int64(len(fakeSnapshotData)), nil)
 		if t.error != "" {
 			c.Assert(err, check.NotNil, comm)
 			c.Check(err.Error(), check.Equals, t.error, comm)
@@ -229,6 +304,75 @@ func (cs *clientSuite) TestClientSnapshotImport(c *check.C) {
 	}
 }
 
+func (cs *clientSuite) TestClientExportSnapshotWithKey(c *check.C) {
+	cs.contentLength = 4
+	cs.header = http.Header{"Content-Type": []string{client.SnapshotExportMediaType}}
+	cs.rsp = "data"
+	cs.status = 200
+
+	_, _, err := cs.cli.SnapshotExport(42, &client.SnapshotKey{Passphrase: "s3cret"})
+	c.Assert(err, check.IsNil)
+	key, err := client.DecodeSnapshotKeyHeader(cs.req.Header.Get(client.SnapshotKeyHeader))
+	c.Assert(err, check.IsNil)
+	c.Check(key, check.DeepEquals, &client.SnapshotKey{Passphrase: "s3cret"})
+}
+
+func (cs *clientSuite) TestClientSnapshotImportWithKey(c *check.C) {
+	cs.rsp = `{"type": "sync", "result": {"set-id": 42, "snaps": ["foo"]}}`
+	_, err := cs.cli.SnapshotImport(strings.NewReader("fake"), 4, &client.SnapshotKey{Device: true})
+	c.Assert(err, check.IsNil)
+	key, err := client.DecodeSnapshotKeyHeader(cs.req.Header.Get(client.SnapshotKeyHeader))
+	c.Assert(err, check.IsNil)
+	c.Check(key, check.DeepEquals, &client.SnapshotKey{Device: true})
+
+	cs.rsp = `{"type": "error", "status-code": 400, "result": {"message": "snapshot set is encrypted and requires a key", "kind": "snapshot-key-required", "value": "passphrase"}}`
+	cs.status = 400
+	_, err = cs.cli.SnapshotImport(strings.NewReader("fake"), 4, nil)
+	c.Check(cs.req.Header.Get(client.SnapshotKeyHeader), check.Equals, "")
+	c.Assert(err, check.FitsTypeOf, &client.Error{})
+	c.Check(err.(*client.Error).Kind, check.Equals, client.ErrorKindSnapshotKeyRequired)
+	c.Check(err.(*client.Error).Value, check.Equals, "passphrase")
+}
+
+func (cs *clientSuite) TestSnapshotKey(c *check.C) {
+	for _, t := range []struct {
+		key    client.SnapshotKey
+		source string
+		err    string
+	}{
+		{client.SnapshotKey{Passphrase: "s3cret"}, "passphrase", ""},
+		{client.SnapshotKey{Device: true}, "device", ""},
+		{client.SnapshotKey{}, "", "snapshot key requires either a passphrase or the device key"},
+		{client.SnapshotKey{Passphrase: "s3cret", Device: true}, "", "snapshot key cannot be both a passphrase and the device key"},
+	} {
+		err := t.key.Validate()
+		if t.err != "" {
+			c.Check(err, check.ErrorMatches, t.err)
+			continue
+		}
+		c.Assert(err, check.IsNil)
+		c.Check(t.key.Source(), check.Equals, t.source)
+
+		value, err := t.key.EncodeHeader()
+		c.Assert(err, check.IsNil)
+		key, err := client.DecodeSnapshotKeyHeader(value)
+		c.Assert(err, check.IsNil)
+		c.Check(*key, check.DeepEquals, t.key)
+	}
+
+	_, err := client.DecodeSnapshotKeyHeader("not base64!")
+	c.Check(err, check.ErrorMatches, "cannot decode snapshot key: .*")
+	_, err = client.DecodeSnapshotKeyHeader("e30=") // "{}"
+	c.Check(err, check.ErrorMatches, "snapshot key requires either a passphrase or the device key")
+}
+
+func (cs *clientSuite) TestSnapshotSetKeySource(c *check.C) {
+	ss := client.SnapshotSet{Snapshots: []*client.Snapshot{{Snap: "foo"}}}
+	c.Check(ss.KeySource(), check.Equals, "")
+	ss.Snapshots = append(ss.Snapshots, &client.Snapshot{Snap: "bar", Encryption: &client.SnapshotEncryption{KeySource: "device"}})
+	c.Check(ss.KeySource(), check.Equals, "device")
+}
+
 func (cs *clientSuite) TestClientSnapshotContentHash(c *check.C) {
 	now := time.Now()
 	revno := snap.R(1)
@@ -250,3 +250,32 @@ func (s *SnapSuite) TestNoChanges(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Check(s.Stderr(), check.Equals, "no changes found\n")
 }
+
+func (s *SnapSuite) TestChangesArchived(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/changes")
+			c.Check(r.URL.Query().Get("archived"), check.Equals, "true")
+			c.Check(r.URL.Query().Get("for"), check.Equals, "foo")
+			fmt.Fprintln(w, mockChangesJSON)
+		default:
+			c.Fatalf("expected to get 1 requests, now on %d", n+1)
+		}
+
+		n++
+	})
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"changes", "--archived", "--abs-time", "foo"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, `
+ID     Status  Spawn                 Ready                 Summary
+four   Do      2015-02-21T01:02:03Z  2015-02-21T01:02:04Z  ...
+three  Do      2016-01-21T01:02:03Z  2016-01-21T01:02:04Z  ...
+one    Do      2016-03-21T01:02:03Z  2016-03-21T01:02:04Z  ...
+two    Do      2016-04-21T01:02:03Z  2016-04-21T01:02:04Z  ...
+
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "")
+}
@@ -0,0 +1,85 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/store"
+)
+
+type cmdServeStoreMirror struct {
+	Address    string `long:"address" default:"localhost:8080"`
+	Positional struct {
+		Directory string `positional-arg-name:"<dir>"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var httpListenAndServe = http.ListenAndServe
+
+func init() {
+	addDebugCommand("serve-store-mirror",
+		i18n.G("Serve snaps and assertions from a directory as a store mirror"),
+		i18n.G(`
+The serve-store-mirror command serves the snaps and assertions found in the
+given directory, as obtained with "snap download", using the store API. Devices
+on an isolated network can then install and refresh those snaps by pointing
+them at the mirror with "snap set system store.mirror=http://<host>:<port>".
+
+The revisions released to each channel can be listed in a channels.json file in
+the directory, e.g. {"foo": {"latest/stable": 2}}. Snaps which are not listed
+have their newest revision released to latest/stable.
+
+The mirror doesn't authenticate devices: anyone who can reach it can download
+the snaps it serves, and the device sessions it hands out carry no credentials.
+Devices check the integrity of the snaps with the store signed assertions. The
+mirror only listens on localhost by default, use --address to make it reachable
+from other devices.
+`),
+		func() flags.Commander {
+			return &cmdServeStoreMirror{}
+		}, map[string]string{
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"address": i18n.G("Address to listen on"),
+		}, []argDesc{{
+			// TRANSLATORS: This needs to begin with < and end with >
+			name: i18n.G("<dir>"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			desc: i18n.G("Directory with the snaps and assertions to serve"),
+		}})
+}
+
+func (x *cmdServeStoreMirror) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	mirror, err := store.NewMirror(x.Positional.Directory)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(Stdout, i18n.G("Serving store mirror of %q on %s\n"), x.Positional.Directory, x.Address)
+	return httpListenAndServe(x.Address, mirror)
+}
@@ -0,0 +1,64 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"errors"
+	"net/http"
+
+	"gopkg.in/check.v1"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+)
+
+func (s *SnapSuite) TestServeStoreMirror(c *check.C) {
+	dir := c.MkDir()
+	n := 0
+	restore := snap.MockHttpListenAndServe(func(addr string, handler http.Handler) error {
+		n++
+		c.Check(addr, check.Equals, "127.0.0.1:9999")
+		c.Check(handler, check.NotNil)
+		return errors.New("boom")
+	})
+	defer restore()
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "serve-store-mirror", "--address", "127.0.0.1:9999", dir})
+	c.Assert(err, check.ErrorMatches, "boom")
+	c.Check(n, check.Equals, 1)
+	c.Check(s.Stdout(), check.Equals, `Serving store mirror of "`+dir+`" on 127.0.0.1:9999`+"\n")
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *SnapSuite) TestServeStoreMirrorDefaultAddress(c *check.C) {
+	dir := c.MkDir()
+	restore := snap.MockHttpListenAndServe(func(addr string, handler http.Handler) error {
+		c.Check(addr, check.Equals, "localhost:8080")
+		return errors.New("boom")
+	})
+	defer restore()
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "serve-store-mirror", dir})
+	c.Assert(err, check.ErrorMatches, "boom")
+}
+
+func (s *SnapSuite) TestServeStoreMirrorNeedsDir(c *check.C) {
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "serve-store-mirror"})
+	c.Assert(err, check.ErrorMatches, "the required argument `<dir>` was not provided")
+}
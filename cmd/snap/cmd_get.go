@@ -21,12 +21,15 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/jessevdk/go-flags"
 
+	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/features"
 	"github.com/snapcore/snapd/i18n"
 )
@@ -56,6 +59,9 @@ If the first argument passed into get is a confdb identifier matching the
 format <account-id>/<confdb>/<view>, get will use the confdb API. In this
 case, the command returns the data retrieved from the requested dot-separated
 view paths.
+
+With --history, get lists the committed revisions of the confdb identified
+by <account-id>/<confdb>, along with the changes each one made.
 `)
 
 type cmdGet struct {
@@ -68,6 +74,7 @@ type cmdGet struct {
 	Typed    bool `short:"t"`
 	Document bool `short:"d"`
 	List     bool `short:"l"`
+	History  bool `long:"history"`
 }
 
 func init() {
@@ -83,6 +90,8 @@ func init() {
 			"l": i18n.G("Always return list, even with single key"),
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"t": i18n.G("Strict typing with nulls and quoted strings"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"history": i18n.G("Show the revisions of the given confdb"),
 		}, []argDesc{
 			{
 				name: "<snap>",
@@ -254,6 +263,10 @@ func (x *cmdGet) Execute(args []string) error {
 	snapName := string(x.Positional.Snap)
 	confKeys := x.Positional.Keys
 
+	if x.History {
+		return x.showConfdbHistory(snapName, confKeys)
+	}
+
 	var conf map[string]interface{}
 	var err error
 	if isConfdbViewID(snapName) {
@@ -293,3 +306,94 @@ func validateConfdbFeatureFlag() error {
 	}
 	return nil
 }
+
+func (x *cmdGet) showConfdbHistory(confdbID string, confKeys []string) error {
+	if err := validateConfdbFeatureFlag(); err != nil {
+		return err
+	}
+
+	if len(confKeys) > 0 {
+		return errors.New(i18n.G("cannot use --history with keys"))
+	}
+
+	if x.Typed || x.List {
+		return errors.New(i18n.G("cannot use --history with -t or -l"))
+	}
+
+	// a view identifier may be used to refer to its confdb
+	parts := strings.Split(confdbID, "/")
+	if len(parts) == 3 {
+		parts = parts[:2]
+	}
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return errors.New(i18n.G("confdb identifier must conform to format: <account-id>/<confdb>"))
+	}
+
+	revs, err := x.client.ConfdbHistory(strings.Join(parts, "/"))
+	if err != nil {
+		return err
+	}
+
+	if x.Document {
+		return x.outputJson(revs)
+	}
+
+	if len(revs) == 0 {
+		fmt.Fprintf(Stderr, i18n.G("No revisions of confdb %s.\n"), strings.Join(parts, "/"))
+		return nil
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	fmt.Fprintln(w, i18n.G("Rev\tTimestamp\tSnap\tView\tChanges"))
+	for _, rev := range revs {
+		snap := rev.Snap
+		if snap == "" {
+			snap = "-"
+		}
+		view := rev.View
+		if view == "" {
+			view = "-"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", rev.Revision, rev.Timestamp.Format(time.RFC3339), snap, view, fmtConfdbChanges(rev))
+	}
+
+	return nil
+}
+
+// fmtConfdbChanges formats the changes made by a confdb revision using the
+// same syntax as snap set and unset.
+func fmtConfdbChanges(rev *client.ConfdbRevision) string {
+	if rev.RollbackTo != 0 {
+		return fmt.Sprintf(i18n.G("rollback to revision %d"), rev.RollbackTo)
+	}
+
+	changes := make([]string, 0, len(rev.Changes))
+	for _, delta := range rev.Changes {
+		paths := make([]string, 0, len(delta))
+		for path := range delta {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		for _, path := range paths {
+			value := delta[path]
+			if value == nil {
+				changes = append(changes, path+"!")
+				continue
+			}
+
+			data, err := json.Marshal(value)
+			if err != nil {
+				data = []byte(fmt.Sprintf("%v", value))
+			}
+			changes = append(changes, fmt.Sprintf("%s=%s", path, data))
+		}
+	}
+
+	if len(changes) == 0 {
+		return "-"
+	}
+	return strings.Join(changes, " ")
+}
@@ -458,3 +458,77 @@ func (s *confdbSuite) TestConfdbGetNoFields(c *check.C) {
 }
 `)
 }
+
+func (s *confdbSuite) TestConfdbGetHistory(c *C) {
+	restore := s.mockConfdbFlag(c)
+	defer restore()
+
+	var reqs int
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch reqs {
+		case 0:
+			c.Check(r.Method, Equals, "GET")
+			c.Check(r.URL.Path, Equals, "/v2/confdbs/foo/bar")
+
+			w.WriteHeader(200)
+			fmt.Fprintf(w, syncResp, `[
+				{"revision": 1, "timestamp": "2024-11-01T12:00:00Z", "snap": "custodian", "view": "baz", "changes": [{"wifi.ssid": "abc"}, {"wifi.psk": null}], "data": {"wifi": {"ssid": "abc"}}},
+				{"revision": 2, "timestamp": "2024-11-01T13:00:00Z", "view": "baz", "changes": [{"wifi.ssids": ["a", "b"]}], "data": {}},
+				{"revision": 3, "timestamp": "2024-11-01T14:00:00Z", "view": "baz", "rollback-to": 1, "data": {}}
+			]`)
+		default:
+			err := fmt.Errorf("expected to get 1 request, now on %d (%v)", reqs+1, r)
+			w.WriteHeader(500)
+			fmt.Fprintf(w, `{"type": "error", "result": {"message": %q}}`, err)
+			c.Error(err)
+		}
+
+		reqs++
+	})
+
+	// the confdb can also be referred to through one of its views
+	rest, err := snapset.Parser(snapset.Client()).ParseArgs([]string{"get", "--history", "foo/bar/baz"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, HasLen, 0)
+	c.Check(s.Stdout(), Equals, `
+Rev  Timestamp             Snap       View  Changes
+1    2024-11-01T12:00:00Z  custodian  baz   wifi.ssid="abc" wifi.psk!
+2    2024-11-01T13:00:00Z  -          baz   wifi.ssids=["a","b"]
+3    2024-11-01T14:00:00Z  -          baz   rollback to revision 1
+`[1:])
+	c.Check(s.Stderr(), Equals, "")
+}
+
+func (s *confdbSuite) TestConfdbGetHistoryEmpty(c *C) {
+	restore := s.mockConfdbFlag(c)
+	defer restore()
+
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, "/v2/confdbs/foo/bar")
+		w.WriteHeader(200)
+		fmt.Fprintf(w, syncResp, `[]`)
+	})
+
+	_, err := snapset.Parser(snapset.Client()).ParseArgs([]string{"get", "--history", "foo/bar"})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Equals, "")
+	c.Check(s.Stderr(), Equals, "No revisions of confdb foo/bar.\n")
+}
+
+func (s *confdbSuite) TestConfdbGetHistoryErrors(c *C) {
+	restore := s.mockConfdbFlag(c)
+	defer restore()
+
+	for _, tc := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"get", "--history", "foo/bar", "abc"}, "cannot use --history with keys"},
+		{[]string{"get", "--history", "-l", "foo/bar"}, "cannot use --history with -t or -l"},
+		{[]string{"get", "--history", "foo"}, "confdb identifier must conform to format: <account-id>/<confdb>"},
+		{[]string{"get", "--history", "foo//baz"}, "confdb identifier must conform to format: <account-id>/<confdb>"},
+	} {
+		_, err := snapset.Parser(snapset.Client()).ParseArgs(tc.args)
+		c.Check(err, ErrorMatches, tc.err, Commentf("%v", tc.args))
+	}
+}
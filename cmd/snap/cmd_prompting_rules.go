@@ -0,0 +1,251 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/i18n"
+)
+
+type cmdPromptingRules struct{}
+
+var shortPromptingRulesHelp = i18n.G("Manage prompting rules")
+var longPromptingRulesHelp = i18n.G(`
+The prompting-rules command contains sub-commands to list, export and
+import the rules which allow or deny the requests of snaps to access
+resources through interfaces which prompt the user.
+
+Besides the rules of each user, the administrator can set rules which
+apply to all the users and take precedence over the rules of the users.
+`)
+
+var (
+	shortPromptingRulesListHelp   = i18n.G("List prompting rules")
+	shortPromptingRulesExportHelp = i18n.G("Export prompting rules as JSON")
+	shortPromptingRulesImportHelp = i18n.G("Import prompting rules from JSON")
+)
+
+var longPromptingRulesListHelp = i18n.G(`
+The list command displays the prompting rules of the user, or with
+--admin the rules set by the administrator for all the users.
+`)
+
+var longPromptingRulesExportHelp = i18n.G(`
+The export command writes the prompting rules of the user, or with
+--admin the rules set by the administrator for all the users, to the
+standard output as a JSON list which can be given to the import
+command.
+
+Rules with a lifespan of timespan are exported with the time remaining
+until they expire as duration.
+`)
+
+var longPromptingRulesImportHelp = i18n.G(`
+The import command adds the prompting rules in the given JSON file, or
+in the standard input if the file is - or not given, to the rules of the
+user. Either all the rules are added, or none of them is if any of them
+is invalid or conflicts with an existing rule.
+
+With --admin, the rules replace instead the rules set by the
+administrator for all the users, which must have a lifespan of forever.
+Only root can set the admin rules.
+`)
+
+var promptingRulesSelectDescs = map[string]string{
+	// TRANSLATORS: This should not start with a lowercase letter.
+	"admin": i18n.G("Select the rules set by the administrator for all the users"),
+	// TRANSLATORS: This should not start with a lowercase letter.
+	"snap": i18n.G("Only select the rules for the given snap"),
+	// TRANSLATORS: This should not start with a lowercase letter.
+	"interface": i18n.G("Only select the rules for the given interface"),
+}
+
+type promptingRulesSelectMixin struct {
+	Admin     bool   `long:"admin"`
+	Snap      string `long:"snap"`
+	Interface string `long:"interface"`
+}
+
+func (x *promptingRulesSelectMixin) rules(cli *client.Client) ([]*client.PromptingRule, error) {
+	if x.Admin && (x.Snap != "" || x.Interface != "") {
+		return nil, errors.New(i18n.G("cannot use --snap or --interface with --admin"))
+	}
+	return cli.PromptingRules(&client.PromptingRulesOptions{
+		Snap:      x.Snap,
+		Interface: x.Interface,
+		Admin:     x.Admin,
+	})
+}
+
+type promptingRulesListCmd struct {
+	clientMixin
+	timeMixin
+	promptingRulesSelectMixin
+}
+
+func (x *promptingRulesListCmd) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	rules, err := x.rules(x.client)
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		fmt.Fprintln(Stdout, i18n.G("No prompting rules found."))
+		return nil
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		"ID",
+		i18n.G("Snap"),
+		i18n.G("Interface"),
+		i18n.G("Path pattern"),
+		i18n.G("Permissions"),
+		i18n.G("Outcome"),
+		i18n.G("Lifespan"),
+		i18n.G("Expires"))
+	for _, rule := range rules {
+		pathPattern := "-"
+		permissions := "-"
+		if rule.Constraints != nil {
+			if rule.Constraints.PathPattern != "" {
+				pathPattern = rule.Constraints.PathPattern
+			}
+			if len(rule.Constraints.Permissions) > 0 {
+				permissions = strings.Join(rule.Constraints.Permissions, ",")
+			}
+		}
+		expires := "-"
+		if rule.Lifespan == "timespan" {
+			expires = x.fmtTime(rule.Expiration)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", rule.ID, rule.Snap, rule.Interface, pathPattern, permissions, rule.Outcome, rule.Lifespan, expires)
+	}
+	return nil
+}
+
+type promptingRulesExportCmd struct {
+	clientMixin
+	promptingRulesSelectMixin
+}
+
+func (x *promptingRulesExportCmd) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	rules, err := x.rules(x.client)
+	if err != nil {
+		return err
+	}
+	now := timeNow()
+	contents := make([]*client.PromptingRuleContents, 0, len(rules))
+	for _, rule := range rules {
+		contents = append(contents, rule.Contents(now))
+	}
+	enc := json.NewEncoder(Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(contents)
+}
+
+type promptingRulesImportCmd struct {
+	clientMixin
+	Admin      bool `long:"admin"`
+	Positional struct {
+		Filename flags.Filename `positional-arg-name:"<filename>"`
+	} `positional-args:"yes"`
+}
+
+func (x *promptingRulesImportCmd) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	var data []byte
+	var err error
+	if x.Positional.Filename == "" || x.Positional.Filename == "-" {
+		data, err = io.ReadAll(Stdin)
+	} else {
+		data, err = os.ReadFile(string(x.Positional.Filename))
+	}
+	if err != nil {
+		return fmt.Errorf(i18n.G("cannot read prompting rules: %v"), err)
+	}
+	var contents []*client.PromptingRuleContents
+	if err := json.Unmarshal(data, &contents); err != nil {
+		return fmt.Errorf(i18n.G("cannot decode prompting rules: %v"), err)
+	}
+
+	rules, err := x.client.ImportPromptingRules(contents, x.Admin)
+	if err != nil {
+		return err
+	}
+	if x.Admin {
+		fmt.Fprintf(Stdout, i18n.NG("Set %d admin prompting rule.\n", "Set %d admin prompting rules.\n", len(rules)), len(rules))
+	} else {
+		fmt.Fprintf(Stdout, i18n.NG("Imported %d prompting rule.\n", "Imported %d prompting rules.\n", len(rules)), len(rules))
+	}
+	return nil
+}
+
+func init() {
+	addPromptingRulesCommand("list",
+		shortPromptingRulesListHelp,
+		longPromptingRulesListHelp,
+		func() flags.Commander {
+			return &promptingRulesListCmd{}
+		}, timeDescs.also(promptingRulesSelectDescs), nil)
+
+	addPromptingRulesCommand("export",
+		shortPromptingRulesExportHelp,
+		longPromptingRulesExportHelp,
+		func() flags.Commander {
+			return &promptingRulesExportCmd{}
+		}, promptingRulesSelectDescs, nil)
+
+	addPromptingRulesCommand("import",
+		shortPromptingRulesImportHelp,
+		longPromptingRulesImportHelp,
+		func() flags.Commander {
+			return &promptingRulesImportCmd{}
+		}, map[string]string{
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"admin": i18n.G("Replace the rules set by the administrator for all the users"),
+		}, []argDesc{
+			{
+				// TRANSLATORS: This needs to begin with < and end with >
+				name: i18n.G("<filename>"),
+				// TRANSLATORS: This should not start with a lowercase letter.
+				desc: i18n.G("JSON file with the rules to import (defaults to stdin)"),
+			},
+		})
+}
@@ -0,0 +1,183 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	main "github.com/snapcore/snapd/cmd/snap"
+)
+
+const promptingRulesJSON = `[
+	{
+		"id": "0000000000000002",
+		"timestamp": "2024-01-02T03:04:05Z",
+		"user": 1000,
+		"snap": "firefox",
+		"interface": "home",
+		"constraints": {"path-pattern": "/home/test/Downloads/**", "permissions": ["read", "write"]},
+		"outcome": "allow",
+		"lifespan": "forever"
+	},
+	{
+		"id": "0000000000000005",
+		"timestamp": "2024-01-02T03:04:05Z",
+		"user": 1000,
+		"snap": "thunderbird",
+		"interface": "home",
+		"constraints": {"path-pattern": "/home/test/.ssh/**", "permissions": ["read"]},
+		"outcome": "deny",
+		"lifespan": "timespan",
+		"expiration": "2024-01-03T03:04:05Z"
+	}
+]`
+
+func (s *SnapSuite) mockPromptingRulesServer(c *C, queries *[]string, actions *[]map[string]interface{}) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.URL.Path, Equals, "/v2/interfaces/requests/rules")
+		switch r.Method {
+		case "GET":
+			*queries = append(*queries, r.URL.RawQuery)
+			fmt.Fprintf(w, `{"type": "sync", "status-code": 200, "result": %s}`, promptingRulesJSON)
+		case "POST":
+			var action map[string]interface{}
+			c.Assert(json.NewDecoder(r.Body).Decode(&action), IsNil)
+			*actions = append(*actions, action)
+			fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": [{"id": "0000000000000007"}, {"id": "0000000000000008"}]}`)
+		default:
+			c.Errorf("unexpected method %q", r.Method)
+		}
+	})
+}
+
+func (s *SnapSuite) TestPromptingRulesList(c *C) {
+	var queries []string
+	s.mockPromptingRulesServer(c, &queries, nil)
+
+	rest, err := main.Parser(main.Client()).ParseArgs([]string{"prompting-rules", "list", "--abs-time", "--snap", "firefox"})
+	c.Assert(err, IsNil)
+	c.Check(rest, HasLen, 0)
+	c.Check(queries, DeepEquals, []string{"snap=firefox"})
+	c.Check(s.Stdout(), Equals, `
+ID                Snap         Interface  Path pattern             Permissions  Outcome  Lifespan  Expires
+0000000000000002  firefox      home       /home/test/Downloads/**  read,write   allow    forever   -
+0000000000000005  thunderbird  home       /home/test/.ssh/**       read         deny     timespan  2024-01-03T03:04:05Z
+`[1:])
+	c.Check(s.Stderr(), Equals, "")
+
+	s.ResetStdStreams()
+	_, err = main.Parser(main.Client()).ParseArgs([]string{"prompting-rules", "list", "--admin"})
+	c.Assert(err, IsNil)
+	c.Check(queries[1], Equals, "admin=true")
+
+	_, err = main.Parser(main.Client()).ParseArgs([]string{"prompting-rules", "list", "--admin", "--interface", "home"})
+	c.Check(err, ErrorMatches, `cannot use --snap or --interface with --admin`)
+	c.Check(queries, HasLen, 2)
+}
+
+func (s *SnapSuite) TestPromptingRulesListNoRules(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": []}`)
+	})
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"prompting-rules", "list"})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Equals, "No prompting rules found.\n")
+}
+
+func (s *SnapSuite) TestPromptingRulesExport(c *C) {
+	var queries []string
+	s.mockPromptingRulesServer(c, &queries, nil)
+	now, err := time.Parse(time.RFC3339, "2024-01-02T15:04:05Z")
+	c.Assert(err, IsNil)
+	restore := main.MockTimeNow(func() time.Time { return now })
+	defer restore()
+
+	_, err = main.Parser(main.Client()).ParseArgs([]string{"prompting-rules", "export", "--interface", "home"})
+	c.Assert(err, IsNil)
+	c.Check(queries, DeepEquals, []string{"interface=home"})
+	var exported []map[string]interface{}
+	c.Assert(json.Unmarshal([]byte(s.Stdout()), &exported), IsNil)
+	c.Check(exported, DeepEquals, []map[string]interface{}{
+		{
+			"snap":        "firefox",
+			"interface":   "home",
+			"constraints": map[string]interface{}{"path-pattern": "/home/test/Downloads/**", "permissions": []interface{}{"read", "write"}},
+			"outcome":     "allow",
+			"lifespan":    "forever",
+		},
+		{
+			"snap":        "thunderbird",
+			"interface":   "home",
+			"constraints": map[string]interface{}{"path-pattern": "/home/test/.ssh/**", "permissions": []interface{}{"read"}},
+			"outcome":     "deny",
+			"lifespan":    "timespan",
+			"duration":    "12h0m0s",
+		},
+	})
+}
+
+func (s *SnapSuite) TestPromptingRulesImport(c *C) {
+	var actions []map[string]interface{}
+	s.mockPromptingRulesServer(c, nil, &actions)
+
+	const rules = `[{"snap": "firefox", "interface": "home", "constraints": {"path-pattern": "/home/*/.ssh/**", "permissions": ["read"]}, "outcome": "deny", "lifespan": "forever"}]`
+	expectedRules := []interface{}{map[string]interface{}{
+		"snap":        "firefox",
+		"interface":   "home",
+		"constraints": map[string]interface{}{"path-pattern": "/home/*/.ssh/**", "permissions": []interface{}{"read"}},
+		"outcome":     "deny",
+		"lifespan":    "forever",
+	}}
+
+	// From a file
+	path := filepath.Join(c.MkDir(), "rules.json")
+	c.Assert(os.WriteFile(path, []byte(rules), 0644), IsNil)
+	rest, err := main.Parser(main.Client()).ParseArgs([]string{"prompting-rules", "import", path})
+	c.Assert(err, IsNil)
+	c.Check(rest, HasLen, 0)
+	c.Check(actions, DeepEquals, []map[string]interface{}{{"action": "import", "rules": expectedRules}})
+	c.Check(s.Stdout(), Equals, "Imported 2 prompting rules.\n")
+
+	// From stdin, as admin rules
+	s.ResetStdStreams()
+	actions = nil
+	s.stdin.WriteString(rules)
+	_, err = main.Parser(main.Client()).ParseArgs([]string{"prompting-rules", "import", "--admin", "-"})
+	c.Assert(err, IsNil)
+	c.Check(actions, DeepEquals, []map[string]interface{}{{"action": "import", "rules": expectedRules, "admin": true}})
+	c.Check(s.Stdout(), Equals, "Set 2 admin prompting rules.\n")
+
+	// Invalid input
+	actions = nil
+	s.stdin.WriteString(`{"snap": "firefox"}`)
+	_, err = main.Parser(main.Client()).ParseArgs([]string{"prompting-rules", "import"})
+	c.Check(err, ErrorMatches, `cannot decode prompting rules: .*`)
+	_, err = main.Parser(main.Client()).ParseArgs([]string{"prompting-rules", "import", filepath.Join(c.MkDir(), "missing")})
+	c.Check(err, ErrorMatches, `cannot read prompting rules: .*no such file or directory`)
+	c.Check(actions, HasLen, 0)
+}
@@ -85,6 +85,15 @@ with the remove-quota command and recreated with a lower limit. Increasing the
 memory limit for a quota group does not restart any services associated with 
 snaps in the quota group.
 
+The memory-swap limit for a quota group can be both increased and decreased
+after being set on a quota group, but not removed. It limits the amount of swap
+the snaps in the group can use, on top of the memory limit.
+
+The IO limits restrict the read and write bandwidth, in bytes per second, that
+the snaps in the quota group can use on the block device given with --io-device.
+They can be increased and decreased after being set on a quota group. Setting
+limits for a different device replaces the limits for the previous one.
+
 The CPU limit for a quota group can be both increased and decreased after being
 set on a quota group. The CPU limit can be specified as a single percentage which
 means that the quota group is allowed an overall percentage of the CPU resources. Setting
@@ -117,11 +126,15 @@ func init() {
 		func() flags.Commander { return &cmdSetQuota{} },
 		waitDescs.also(map[string]string{
 			"memory":             i18n.G("Memory quota"),
+			"memory-swap":        i18n.G("Memory swap quota"),
 			"cpu":                i18n.G("CPU quota"),
 			"cpu-set":            i18n.G("CPU set quota"),
 			"threads":            i18n.G("Threads quota"),
 			"journal-size":       i18n.G("Journal size quota"),
 			"journal-rate-limit": i18n.G("Journal rate limit as <message count>/<message period>"),
+			"io-device":          i18n.G("Block device the IO bandwidth quotas apply to"),
+			"io-read-bandwidth":  i18n.G("IO read bandwidth quota, per second"),
+			"io-write-bandwidth": i18n.G("IO write bandwidth quota, per second"),
 			"parent":             i18n.G("Parent quota group"),
 		}), nil)
 	addCommand("quota", shortQuotaHelp, longQuotaHelp, func() flags.Commander { return &cmdQuota{} }, nil, nil)
@@ -133,11 +146,15 @@ type cmdSetQuota struct {
 	waitMixin
 
 	MemoryMax        string `long:"memory" optional:"true"`
+	MemorySwapMax    string `long:"memory-swap" optional:"true"`
 	CPUMax           string `long:"cpu" optional:"true"`
 	CPUSet           string `long:"cpu-set" optional:"true"`
 	ThreadsMax       string `long:"threads" optional:"true"`
 	JournalSizeMax   string `long:"journal-size" optional:"true"`
 	JournalRateLimit string `long:"journal-rate-limit" optional:"true"`
+	IODevice         string `long:"io-device" optional:"true"`
+	IOReadBandwidth  string `long:"io-read-bandwidth" optional:"true"`
+	IOWriteBandwidth string `long:"io-write-bandwidth" optional:"true"`
 	Parent           string `long:"parent" optional:"true"`
 	Positional       struct {
 		GroupName string        `positional-arg-name:"<group-name>" required:"true"`
@@ -205,6 +222,14 @@ func (x *cmdSetQuota) parseQuotas() (*client.QuotaValues, error) {
 		quotaValues.Memory = quantity.Size(value)
 	}
 
+	if x.MemorySwapMax != "" {
+		value, err := strutil.ParseByteSize(x.MemorySwapMax)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse memory-swap size %q: %v", x.MemorySwapMax, err)
+		}
+		quotaValues.MemorySwap = quantity.Size(value)
+	}
+
 	if x.CPUMax != "" {
 		countValue, percentageValue, err := parseCpuQuota(x.CPUMax)
 		if err != nil {
@@ -266,12 +291,37 @@ func (x *cmdSetQuota) parseQuotas() (*client.QuotaValues, error) {
 		}
 	}
 
+	if x.IODevice != "" || x.IOReadBandwidth != "" || x.IOWriteBandwidth != "" {
+		if x.IODevice == "" {
+			return nil, fmt.Errorf("cannot set io bandwidth quotas without --io-device")
+		}
+		if x.IOReadBandwidth == "" && x.IOWriteBandwidth == "" {
+			return nil, fmt.Errorf("cannot set --io-device without --io-read-bandwidth or --io-write-bandwidth")
+		}
+		quotaValues.IO = &client.QuotaIOValues{Device: x.IODevice}
+		if x.IOReadBandwidth != "" {
+			value, err := strutil.ParseByteSize(x.IOReadBandwidth)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse io read bandwidth %q: %v", x.IOReadBandwidth, err)
+			}
+			quotaValues.IO.ReadBandwidth = quantity.Size(value)
+		}
+		if x.IOWriteBandwidth != "" {
+			value, err := strutil.ParseByteSize(x.IOWriteBandwidth)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse io write bandwidth %q: %v", x.IOWriteBandwidth, err)
+			}
+			quotaValues.IO.WriteBandwidth = quantity.Size(value)
+		}
+	}
+
 	return &quotaValues, nil
 }
 
 func (x *cmdSetQuota) hasQuotaSet() bool {
-	return x.MemoryMax != "" || x.CPUMax != "" || x.CPUSet != "" ||
-		x.ThreadsMax != "" || x.JournalSizeMax != "" || x.JournalRateLimit != ""
+	return x.MemoryMax != "" || x.MemorySwapMax != "" || x.CPUMax != "" || x.CPUSet != "" ||
+		x.ThreadsMax != "" || x.JournalSizeMax != "" || x.JournalRateLimit != "" ||
+		x.IODevice != "" || x.IOReadBandwidth != "" || x.IOWriteBandwidth != ""
 }
 
 func (x *cmdSetQuota) splitSnapsAndServices() (snaps []string, services []string) {
@@ -416,6 +466,10 @@ func (x *cmdQuota) Execute(args []string) (err error) {
 		val := strings.TrimSpace(fmtSize(int64(group.Constraints.Memory)))
 		fmt.Fprintf(w, "  memory:\t%s\n", val)
 	}
+	if group.Constraints.MemorySwap != 0 {
+		val := strings.TrimSpace(fmtSize(int64(group.Constraints.MemorySwap)))
+		fmt.Fprintf(w, "  memory-swap:\t%s\n", val)
+	}
 	if group.Constraints.CPU != nil {
 		fmt.Fprintf(w, "  cpu-count:\t%d\n", group.Constraints.CPU.Count)
 		fmt.Fprintf(w, "  cpu-percentage:\t%d\n", group.Constraints.CPU.Percentage)
@@ -438,6 +492,17 @@ func (x *cmdQuota) Execute(args []string) (err error) {
 				group.Constraints.Journal.RatePeriod)
 		}
 	}
+	if group.Constraints.IO != nil {
+		fmt.Fprintf(w, "  io-device:\t%s\n", group.Constraints.IO.Device)
+		if group.Constraints.IO.ReadBandwidth != 0 {
+			val := strings.TrimSpace(fmtSize(int64(group.Constraints.IO.ReadBandwidth)))
+			fmt.Fprintf(w, "  io-read-bandwidth:\t%s/s\n", val)
+		}
+		if group.Constraints.IO.WriteBandwidth != 0 {
+			val := strings.TrimSpace(fmtSize(int64(group.Constraints.IO.WriteBandwidth)))
+			fmt.Fprintf(w, "  io-write-bandwidth:\t%s/s\n", val)
+		}
+	}
 
 	memoryUsage := "0B"
 	currentThreads := 0
@@ -528,6 +593,11 @@ func (x *cmdQuotas) Execute(args []string) (err error) {
 			grpConstraints = append(grpConstraints, "memory="+strings.TrimSpace(fmtSize(int64(q.Constraints.Memory))))
 		}
 
+		// format memory-swap constraint as memory-swap=N
+		if q.Constraints.MemorySwap != 0 {
+			grpConstraints = append(grpConstraints, "memory-swap="+strings.TrimSpace(fmtSize(int64(q.Constraints.MemorySwap))))
+		}
+
 		// format cpu constraint as cpu=NxM%,cpu-set=x,y,z
 		if q.Constraints.CPU != nil {
 			if q.Constraints.CPU.Count != 0 {
@@ -560,6 +630,16 @@ func (x *cmdQuotas) Execute(args []string) (err error) {
 			}
 		}
 
+		// format io constraint as io-read=xMB/s,io-write=xMB/s
+		if q.Constraints.IO != nil {
+			if q.Constraints.IO.ReadBandwidth != 0 {
+				grpConstraints = append(grpConstraints, "io-read="+strings.TrimSpace(fmtSize(int64(q.Constraints.IO.ReadBandwidth)))+"/s")
+			}
+			if q.Constraints.IO.WriteBandwidth != 0 {
+				grpConstraints = append(grpConstraints, "io-write="+strings.TrimSpace(fmtSize(int64(q.Constraints.IO.WriteBandwidth)))+"/s")
+			}
+		}
+
 		// format current resource values as memory=N,threads=N
 		var grpCurrent []string
 		if q.Current != nil {
@@ -259,6 +259,43 @@ func (s *quotaSuite) TestParseQuotas(c *check.C) {
 	}
 }
 
+func (s *quotaSuite) TestParseSwapAndIOQuotas(c *check.C) {
+	for _, testData := range []struct {
+		memorySwapMax    string
+		ioDevice         string
+		ioReadBandwidth  string
+		ioWriteBandwidth string
+
+		quotas string
+		err    string
+	}{
+		{memorySwapMax: "1GB", quotas: `{"memory-swap":1000000000}`},
+		{ioDevice: "/dev/sda", ioReadBandwidth: "10MB", quotas: `{"io":{"device":"/dev/sda","read-bandwidth":10000000}}`},
+		{ioDevice: "/dev/sda", ioWriteBandwidth: "1MB", quotas: `{"io":{"device":"/dev/sda","write-bandwidth":1000000}}`},
+		{ioDevice: "/dev/sda", ioReadBandwidth: "2kB", ioWriteBandwidth: "1kB", quotas: `{"io":{"device":"/dev/sda","read-bandwidth":2000,"write-bandwidth":1000}}`},
+
+		// Error cases
+		{memorySwapMax: "1", err: `cannot parse memory-swap size "1": cannot parse "1": need a number with a unit as input`},
+		{ioReadBandwidth: "10MB", err: `cannot set io bandwidth quotas without --io-device`},
+		{ioDevice: "/dev/sda", err: `cannot set --io-device without --io-read-bandwidth or --io-write-bandwidth`},
+		{ioDevice: "/dev/sda", ioReadBandwidth: "x", err: `cannot parse io read bandwidth "x": .*`},
+		{ioDevice: "/dev/sda", ioWriteBandwidth: "x", err: `cannot parse io write bandwidth "x": .*`},
+	} {
+		quotas, err := main.ParseSwapAndIOQuotaValues(testData.memorySwapMax, testData.ioDevice,
+			testData.ioReadBandwidth, testData.ioWriteBandwidth)
+		testLabel := check.Commentf("%v", testData)
+		if testData.err == "" {
+			c.Check(err, check.IsNil, testLabel)
+			var jsonQuota bytes.Buffer
+			err := json.NewEncoder(&jsonQuota).Encode(quotas)
+			c.Assert(err, check.IsNil, testLabel)
+			c.Check(strings.TrimSpace(jsonQuota.String()), check.Equals, testData.quotas, testLabel)
+		} else {
+			c.Check(err, check.ErrorMatches, testData.err, testLabel)
+		}
+	}
+}
+
 func (s *quotaSuite) TestSetQuotaInvalidArgs(c *check.C) {
 	const json = `{
 		"type": "sync",
@@ -445,6 +482,33 @@ current:
 	c.Check(s.quotaGetGroupHandlerCalls, check.Equals, 2)
 }
 
+func (s *quotaSuite) TestGetSwapAndIOQuotaGroupSimple(c *check.C) {
+	const json = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": {
+			"group-name": "foo",
+			"constraints": {"memory-swap": 2000, "io": {"device": "/dev/sda", "read-bandwidth": 10000000, "write-bandwidth": 5000}}
+		}
+	}`
+
+	s.RedirectClientToTestServer(s.makeFakeGetQuotaGroupHandler(c, json))
+
+	rest, err := main.Parser(main.Client()).ParseArgs([]string{"quota", "foo"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(s.Stdout(), check.Equals, `
+name:  foo
+constraints:
+  memory-swap:         2000B
+  io-device:           /dev/sda
+  io-read-bandwidth:   10.0MB/s
+  io-write-bandwidth:  5000B/s
+current:
+`[1:])
+}
+
 func (s *quotaSuite) TestGetCpuQuotaGroupSimple(c *check.C) {
 	const jsonTemplate = `{
 		"type": "sync",
@@ -747,6 +811,27 @@ bbb      zzz     memory=1000B                              memory=400B
 	c.Check(s.quotaGetGroupsHandlerCalls, check.Equals, 1)
 }
 
+func (s *quotaSuite) TestGetAllQuotaGroupsSwapAndIO(c *check.C) {
+	restore := main.MockIsStdinTTY(true)
+	defer restore()
+
+	s.RedirectClientToTestServer(s.makeFakeGetQuotaGroupsHandler(c,
+		`{"type": "sync", "status-code": 200, "result": [
+			{"group-name":"io0","constraints":{"memory-swap":2000,"io":{"device":"/dev/sda","read-bandwidth":10000000,"write-bandwidth":5000}}},
+			{"group-name":"io1","constraints":{"io":{"device":"/dev/sdb","write-bandwidth":5000}}}
+			]}`))
+
+	rest, err := main.Parser(main.Client()).ParseArgs([]string{"quotas"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(s.Stdout(), check.Equals, `
+Quota  Parent  Constraints                                          Current
+io0            memory-swap=2000B,io-read=10.0MB/s,io-write=5000B/s  
+io1            io-write=5000B/s                                     
+`[1:])
+}
+
 func (s *quotaSuite) TestGetAllQuotaGroupsInconsistencyError(c *check.C) {
 	restore := main.MockIsStdinTTY(true)
 	defer restore()
@@ -20,6 +20,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -28,6 +29,7 @@ import (
 
 	"github.com/jessevdk/go-flags"
 
+	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/i18n"
 	"github.com/snapcore/snapd/strutil"
 	"github.com/snapcore/snapd/strutil/quantity"
@@ -62,6 +64,12 @@ for which users, or a combination of these.
 If a snap is included in a save operation, excluding its system and
 configuration data from the snapshot is not currently possible. This
 restriction may be lifted in the future.
+
+With --passphrase or --device-key the snapshot is encrypted, and the
+same passphrase, or the same device, is needed to check, restore,
+export or import it. Keys bound to the device are only available on
+devices with full disk encryption; they are bound to the TPM of the
+device but, unlike the disk encryption keys, not to the booted system.
 `)
 var longForgetHelp = i18n.G(`
 The forget command deletes a snapshot. This operation can not be
@@ -175,19 +183,86 @@ func (x *savedCmd) Execute([]string) error {
 	return nil
 }
 
+// readSnapshotPassphrase asks for the passphrase of an encrypted snapshot.
+func readSnapshotPassphrase(prompt string) (string, error) {
+	fmt.Fprint(Stdout, prompt)
+	passphrase, err := ReadPassword(0)
+	fmt.Fprint(Stdout, "\n")
+	if err != nil {
+		return "", err
+	}
+	// strings.TrimSpace needed because we get \r from the pty in the tests
+	return strings.TrimSpace(string(passphrase)), nil
+}
+
+// withSnapshotKey calls f without a key, and if the snapshot set turns out
+// to be encrypted calls it again with the key for it, asking for the
+// passphrase if needed.
+func withSnapshotKey(prompt string, f func(key *client.SnapshotKey) error) error {
+	err := f(nil)
+	var cerr *client.Error
+	if !errors.As(err, &cerr) || cerr.Kind != client.ErrorKindSnapshotKeyRequired {
+		return err
+	}
+	key := &client.SnapshotKey{Device: true}
+	if source, _ := cerr.Value.(string); source != client.SnapshotKeySourceDevice {
+		passphrase, err := readSnapshotPassphrase(prompt)
+		if err != nil {
+			return err
+		}
+		if passphrase == "" {
+			return errors.New(i18n.G("no passphrase given"))
+		}
+		key = &client.SnapshotKey{Passphrase: passphrase}
+	}
+	return f(key)
+}
+
 type saveCmd struct {
 	waitMixin
 	durationMixin
 	Users      string `long:"users"`
+	Passphrase bool   `long:"passphrase"`
+	DeviceKey  bool   `long:"device-key"`
 	Positional struct {
 		Snaps []installedSnapName `positional-arg-name:"<snap>"`
 	} `positional-args:"yes"`
 }
 
+func (x *saveCmd) key() (*client.SnapshotKey, error) {
+	switch {
+	case x.Passphrase && x.DeviceKey:
+		return nil, errors.New(i18n.G("cannot use --passphrase and --device-key together"))
+	case x.DeviceKey:
+		return &client.SnapshotKey{Device: true}, nil
+	case !x.Passphrase:
+		return nil, nil
+	}
+	passphrase, err := readSnapshotPassphrase(i18n.G("Passphrase for the snapshot: "))
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		return nil, errors.New(i18n.G("no passphrase given"))
+	}
+	again, err := readSnapshotPassphrase(i18n.G("Repeat the passphrase: "))
+	if err != nil {
+		return nil, err
+	}
+	if again != passphrase {
+		return nil, errors.New(i18n.G("passphrases do not match"))
+	}
+	return &client.SnapshotKey{Passphrase: passphrase}, nil
+}
+
 func (x *saveCmd) Execute([]string) error {
 	snaps := installedSnapNames(x.Positional.Snaps)
 	users := strutil.CommaSeparatedList(x.Users)
-	setID, changeID, err := x.client.SnapshotMany(snaps, users)
+	key, err := x.key()
+	if err != nil {
+		return err
+	}
+	setID, changeID, err := x.client.SnapshotMany(snaps, users, key)
 	if err != nil {
 		return err
 	}
@@ -257,7 +332,11 @@ func (x *checkSnapshotCmd) Execute([]string) error {
 	}
 	snaps := installedSnapNames(x.Positional.Snaps)
 	users := strutil.CommaSeparatedList(x.Users)
-	changeID, err := x.client.CheckSnapshots(setID, snaps, users)
+	var changeID string
+	err = withSnapshotKey(fmt.Sprintf(i18n.G("Passphrase for snapshot #%s: "), x.Positional.ID), func(key *client.SnapshotKey) (err error) {
+		changeID, err = x.client.CheckSnapshots(setID, snaps, users, key)
+		return err
+	})
 	if err != nil {
 		return err
 	}
@@ -296,7 +375,11 @@ func (x *restoreCmd) Execute([]string) error {
 	}
 	snaps := installedSnapNames(x.Positional.Snaps)
 	users := strutil.CommaSeparatedList(x.Users)
-	changeID, err := x.client.RestoreSnapshots(setID, snaps, users)
+	var changeID string
+	err = withSnapshotKey(fmt.Sprintf(i18n.G("Passphrase for snapshot #%s: "), x.Positional.ID), func(key *client.SnapshotKey) (err error) {
+		changeID, err = x.client.RestoreSnapshots(setID, snaps, users, key)
+		return err
+	})
 	if err != nil {
 		return err
 	}
@@ -340,6 +423,10 @@ func init() {
 		}, durationDescs.also(waitDescs).also(map[string]string{
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"users": i18n.G("Snapshot data of only specific users (comma-separated) (default: all users)"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"passphrase": i18n.G("Encrypt the snapshot with a passphrase, asked for interactively"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"device-key": i18n.G("Encrypt the snapshot with a key bound to this device"),
 		}), nil)
 
 	addCommand("restore",
@@ -446,7 +533,12 @@ func (x *exportSnapshotCmd) Execute([]string) (err error) {
 		return err
 	}
 
-	r, expectedSize, err := x.client.SnapshotExport(setID)
+	var r io.ReadCloser
+	var expectedSize int64
+	err = withSnapshotKey(fmt.Sprintf(i18n.G("Passphrase for snapshot #%s: "), x.Positional.ID), func(key *client.SnapshotKey) (err error) {
+		r, expectedSize, err = x.client.SnapshotExport(setID, key)
+		return err
+	})
 	if err != nil {
 		return err
 	}
@@ -493,19 +585,26 @@ type importSnapshotCmd struct {
 	} `positional-args:"yes" required:"yes"`
 }
 
-func (x *importSnapshotCmd) Execute([]string) error {
-	filename := x.Positional.Filename
-	f, err := os.Open(filename)
+func (x *importSnapshotCmd) importSnapshot(key *client.SnapshotKey) (client.SnapshotImportSet, error) {
+	f, err := os.Open(x.Positional.Filename)
 	if err != nil {
-		return fmt.Errorf("error accessing file: %v", err)
+		return client.SnapshotImportSet{}, fmt.Errorf("error accessing file: %v", err)
 	}
 	defer f.Close()
 	st, err := f.Stat()
 	if err != nil {
-		return fmt.Errorf("cannot stat file: %v", err)
+		return client.SnapshotImportSet{}, fmt.Errorf("cannot stat file: %v", err)
 	}
+	return x.client.SnapshotImport(f, st.Size(), key)
+}
 
-	importSet, err := x.client.SnapshotImport(f, st.Size())
+func (x *importSnapshotCmd) Execute([]string) error {
+	var importSet client.SnapshotImportSet
+	err := withSnapshotKey(i18n.G("Passphrase for the imported snapshot: "), func(key *client.SnapshotKey) (err error) {
+		// the snapshot is sent again when a key turns out to be needed
+		importSet, err = x.importSnapshot(key)
+		return err
+	})
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,268 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/strutil"
+)
+
+type cmdSnapshot struct{}
+
+var shortSnapshotHelp = i18n.G("Manage snapshots in a remote repository")
+var longSnapshotHelp = i18n.G(`
+The snapshot command contains sub-commands to push snapshots to, and
+pull them from, the remote snapshot repository set with the
+snapshots.remote.url system option.
+`)
+
+var (
+	shortSnapshotPushHelp       = i18n.G("Push a snapshot to the remote repository")
+	shortSnapshotPullHelp       = i18n.G("Pull a snapshot from the remote repository")
+	shortSnapshotListRemoteHelp = i18n.G("List the snapshots in the remote repository")
+)
+
+var longSnapshotPushHelp = i18n.G(`
+The push command uploads a snapshot to the remote snapshot repository.
+Encrypted snapshots stay encrypted in the repository.
+
+Snapshots are identified in the repository by their content, so a
+snapshot that was pushed before, possibly from another device, is not
+uploaded again.
+`)
+
+var longSnapshotPullHelp = i18n.G(`
+The pull command downloads a snapshot from the remote snapshot
+repository and imports it with a new snapshot ID, unless the same
+snapshot is already on the device. The snapshot can then be restored
+using the restore command.
+
+The ID of the snapshot in the repository, as shown by the list-remote
+command, can be abbreviated as long as it is unambiguous.
+`)
+
+var longSnapshotListRemoteHelp = i18n.G(`
+The list-remote command displays the snapshots in the remote snapshot
+repository.
+`)
+
+// remoteSnapshotIDLen is the length remote snapshot IDs are abbreviated to
+// for display.
+const remoteSnapshotIDLen = 12
+
+type snapshotPushCmd struct {
+	waitMixin
+	Positional struct {
+		ID snapshotID `positional-arg-name:"<id>"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (x *snapshotPushCmd) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	setID, err := x.Positional.ID.ToUint()
+	if err != nil {
+		return err
+	}
+	changeID, err := x.client.PushSnapshots(setID)
+	if err != nil {
+		return err
+	}
+	if _, err := x.wait(changeID); err != nil {
+		if err == noWait {
+			return nil
+		}
+		return err
+	}
+
+	fmt.Fprintf(Stdout, i18n.G("Pushed snapshot #%s to the remote repository.\n"), x.Positional.ID)
+	return nil
+}
+
+type snapshotPullCmd struct {
+	waitMixin
+	durationMixin
+	Positional struct {
+		ID string `positional-arg-name:"<remote-id>"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+// key returns the key needed to pull the given remote snapshot set, asking
+// for the passphrase if needed.
+func (x *snapshotPullCmd) key() (*client.SnapshotKey, error) {
+	sets, err := x.client.RemoteSnapshotSets()
+	if err != nil {
+		return nil, err
+	}
+	var found *client.RemoteSnapshotSet
+	for i := range sets {
+		if strings.HasPrefix(sets[i].ID, x.Positional.ID) {
+			if found != nil {
+				// let snapd report the ambiguity
+				return nil, nil
+			}
+			found = &sets[i]
+		}
+	}
+	if found == nil {
+		return nil, nil
+	}
+	switch found.KeySource {
+	case "":
+		return nil, nil
+	case client.SnapshotKeySourceDevice:
+		return &client.SnapshotKey{Device: true}, nil
+	}
+	passphrase, err := readSnapshotPassphrase(fmt.Sprintf(i18n.G("Passphrase for snapshot %s: "), x.Positional.ID))
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		return nil, errors.New(i18n.G("no passphrase given"))
+	}
+	return &client.SnapshotKey{Passphrase: passphrase}, nil
+}
+
+func (x *snapshotPullCmd) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	key, err := x.key()
+	if err != nil {
+		return err
+	}
+	changeID, err := x.client.PullSnapshots(x.Positional.ID, key)
+	if err != nil {
+		return err
+	}
+	chg, err := x.wait(changeID)
+	if err != nil {
+		if err == noWait {
+			return nil
+		}
+		return err
+	}
+	var setID uint64
+	if err := chg.Get("set-id", &setID); err != nil {
+		return fmt.Errorf(i18n.G("cannot get the ID of the pulled snapshot: %v"), err)
+	}
+
+	fmt.Fprintf(Stdout, i18n.G("Pulled snapshot %s as #%d\n"), x.Positional.ID, setID)
+	y := &savedCmd{
+		clientMixin:   x.clientMixin,
+		durationMixin: x.durationMixin,
+		ID:            snapshotID(strconv.FormatUint(setID, 10)),
+	}
+	return y.Execute(nil)
+}
+
+type snapshotListRemoteCmd struct {
+	clientMixin
+	durationMixin
+	Verbose bool `long:"verbose"`
+}
+
+func (x *snapshotListRemoteCmd) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	sets, err := x.client.RemoteSnapshotSets()
+	if err != nil {
+		return err
+	}
+	if len(sets) == 0 {
+		fmt.Fprintln(Stdout, i18n.G("No remote snapshots found."))
+		return nil
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+		"ID",
+		// TRANSLATORS: 'Set' as in group or bag of things
+		i18n.G("Set"),
+		// TRANSLATORS: 'Age' as in how old something is
+		i18n.G("Age"),
+		i18n.G("Snaps"),
+		i18n.G("Size"),
+		// TRANSLATORS: 'Notes' as in 'Comments'
+		i18n.G("Notes"))
+	for _, set := range sets {
+		id := set.ID
+		if !x.Verbose && len(id) > remoteSnapshotIDLen {
+			id = id[:remoteSnapshotIDLen]
+		}
+		note := "-"
+		if set.KeySource != "" {
+			note = "encrypted: " + set.KeySource
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n", id, set.SetID, x.fmtDuration(set.Time), strutil.Quoted(set.Snaps), fmtSize(set.Size), note)
+	}
+	return nil
+}
+
+func init() {
+	addSnapshotCommand("push",
+		shortSnapshotPushHelp,
+		longSnapshotPushHelp,
+		func() flags.Commander {
+			return &snapshotPushCmd{}
+		}, waitDescs, []argDesc{
+			{
+				name: "<id>",
+				// TRANSLATORS: This should not start with a lowercase letter.
+				desc: i18n.G("Set id of snapshot to push (see 'snap help saved')"),
+			},
+		})
+
+	addSnapshotCommand("pull",
+		shortSnapshotPullHelp,
+		longSnapshotPullHelp,
+		func() flags.Commander {
+			return &snapshotPullCmd{}
+		}, durationDescs.also(waitDescs), []argDesc{
+			{
+				// TRANSLATORS: This needs to begin with < and end with >
+				name: i18n.G("<remote-id>"),
+				// TRANSLATORS: This should not start with a lowercase letter.
+				desc: i18n.G("ID of the snapshot in the remote repository (see 'snap snapshot list-remote')"),
+			},
+		})
+
+	addSnapshotCommand("list-remote",
+		shortSnapshotListRemoteHelp,
+		longSnapshotListRemoteHelp,
+		func() flags.Commander {
+			return &snapshotListRemoteCmd{}
+		}, durationDescs.also(map[string]string{
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"verbose": i18n.G("Show the full IDs of the snapshots"),
+		}), nil)
+}
@@ -0,0 +1,148 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	. "gopkg.in/check.v1"
+
+	main "github.com/snapcore/snapd/cmd/snap"
+	"github.com/snapcore/snapd/testutil"
+)
+
+const remoteSnapshotSetsJSON = `[
+	{"id": "0123456789abcdef0123", "set-id": 3, "time": "2024-01-02T03:04:05Z", "snaps": ["htop"], "size": 2048},
+	{"id": "4567abcdef0123456789", "set-id": 7, "time": "2024-02-03T04:05:06Z", "snaps": ["htop", "hello"], "size": 4096, "key-source": "passphrase"}
+]`
+
+func (s *SnapSuite) mockRemoteSnapshotsServer(c *C, actions *[]map[string]interface{}) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/snapshots/remote":
+			c.Check(r.Method, Equals, "GET")
+			fmt.Fprintf(w, `{"type": "sync", "status-code": 200, "result": %s}`, remoteSnapshotSetsJSON)
+		case "/v2/snapshots":
+			if r.Method == "GET" {
+				c.Check(r.URL.Query().Get("set"), Equals, "12")
+				fmt.Fprintln(w, `{"type":"sync","status-code":200,"status":"OK","result":[{"id":12,"snapshots":[{"set":12,"time":"2024-01-02T03:04:05Z","snap":"htop","revision":"1168","epoch":{"read":[0],"write":[0]},"version":"2","size":1}]}]}`)
+				return
+			}
+			var action map[string]interface{}
+			c.Assert(json.NewDecoder(r.Body).Decode(&action), IsNil)
+			*actions = append(*actions, action)
+			w.WriteHeader(202)
+			fmt.Fprintln(w, `{"type":"async", "status-code": 202, "change": "9"}`)
+		case "/v2/changes/9":
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done", "data": {"set-id": 12, "snap-names": ["htop"]}}}`)
+		default:
+			c.Errorf("unexpected path %q", r.URL.Path)
+		}
+	})
+}
+
+func (s *SnapSuite) TestSnapshotPush(c *C) {
+	var actions []map[string]interface{}
+	s.mockRemoteSnapshotsServer(c, &actions)
+
+	rest, err := main.Parser(main.Client()).ParseArgs([]string{"snapshot", "push", "3"})
+	c.Assert(err, IsNil)
+	c.Check(rest, HasLen, 0)
+	c.Check(actions, DeepEquals, []map[string]interface{}{{"action": "push", "set": 3.}})
+	c.Check(s.Stdout(), Equals, "Pushed snapshot #3 to the remote repository.\n")
+	c.Check(s.Stderr(), Equals, "")
+
+	_, err = main.Parser(main.Client()).ParseArgs([]string{"snapshot", "push", "x"})
+	c.Check(err, ErrorMatches, `invalid argument for snapshot set id: expected a non-negative integer argument \(see 'snap help saved'\)`)
+}
+
+func (s *SnapSuite) TestSnapshotPull(c *C) {
+	var actions []map[string]interface{}
+	s.mockRemoteSnapshotsServer(c, &actions)
+
+	rest, err := main.Parser(main.Client()).ParseArgs([]string{"snapshot", "pull", "--abs-time", "0123"})
+	c.Assert(err, IsNil)
+	c.Check(rest, HasLen, 0)
+	c.Check(actions, DeepEquals, []map[string]interface{}{{"action": "pull", "remote-id": "0123"}})
+	c.Check(s.Stdout(), testutil.MatchesWrapped, `Pulled snapshot 0123 as #12
+Set  Snap  Age                   Version  Rev   Size  Notes
+12   htop  2024-01-02T03:04:05Z  2        1168    1B  -
+`)
+	c.Check(s.Stderr(), Equals, "")
+}
+
+func (s *SnapSuite) TestSnapshotPullEncrypted(c *C) {
+	var actions []map[string]interface{}
+	s.mockRemoteSnapshotsServer(c, &actions)
+	s.password = "s3cret"
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"snapshot", "pull", "4567"})
+	c.Assert(err, IsNil)
+	c.Check(actions, DeepEquals, []map[string]interface{}{{
+		"action":    "pull",
+		"remote-id": "4567",
+		"key":       map[string]interface{}{"passphrase": "s3cret"},
+	}})
+	c.Check(s.Stdout(), testutil.Contains, "Passphrase for snapshot 4567: \nPulled snapshot 4567 as #12\n")
+
+	actions = nil
+	s.password = ""
+	_, err = main.Parser(main.Client()).ParseArgs([]string{"snapshot", "pull", "4567"})
+	c.Check(err, ErrorMatches, "no passphrase given")
+	c.Check(actions, HasLen, 0)
+}
+
+func (s *SnapSuite) TestSnapshotListRemote(c *C) {
+	var actions []map[string]interface{}
+	s.mockRemoteSnapshotsServer(c, &actions)
+
+	rest, err := main.Parser(main.Client()).ParseArgs([]string{"snapshot", "list-remote", "--abs-time"})
+	c.Assert(err, IsNil)
+	c.Check(rest, HasLen, 0)
+	c.Check(s.Stdout(), Equals, `
+ID            Set  Age                   Snaps            Size    Notes
+0123456789ab  3    2024-01-02T03:04:05Z  "htop"            2048B  -
+4567abcdef01  7    2024-02-03T04:05:06Z  "htop", "hello"   4096B  encrypted: passphrase
+`[1:])
+
+	s.stdout.Truncate(0)
+	_, err = main.Parser(main.Client()).ParseArgs([]string{"snapshot", "list-remote", "--verbose"})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Matches, `(?s)ID +Set.*\n0123456789abcdef0123 +3 .*\n4567abcdef0123456789 +7 .*`)
+	c.Check(actions, HasLen, 0)
+}
+
+func (s *SnapSuite) TestSnapshotListRemoteEmpty(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, "/v2/snapshots/remote")
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": []}`)
+	})
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"snapshot", "list-remote"})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Equals, "No remote snapshots found.\n")
+}
+
+func (s *SnapSuite) TestSnapshotRequiresSubcommand(c *C) {
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"snapshot"})
+	c.Check(err, ErrorMatches, `.*Please specify one command of: .*`)
+}
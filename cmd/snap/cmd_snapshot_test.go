@@ -20,7 +20,9 @@
 package main_test
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -167,3 +169,145 @@ Set  Snap  Age    Version  Rev   Size    Notes
 1    htop  %-6s 2        1168      1B  -
 `, ageStr))
 }
+
+func (s *SnapSuite) mockEncryptedSnapshotsServer(c *C, keySource string, keys *[]*client.SnapshotKey) {
+	keyRequired := func(w http.ResponseWriter, key *client.SnapshotKey) bool {
+		*keys = append(*keys, key)
+		if key == nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, `{"type": "error", "status-code": 400, "result": {"message": "snapshot set is encrypted and requires a key", "kind": "snapshot-key-required", "value": %q}}`, keySource)
+			return true
+		}
+		return false
+	}
+	headerKey := func(r *http.Request) *client.SnapshotKey {
+		value := r.Header.Get(client.SnapshotKeyHeader)
+		if value == "" {
+			return nil
+		}
+		key, err := client.DecodeSnapshotKeyHeader(value)
+		c.Assert(err, IsNil)
+		return key
+	}
+
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/snaps":
+			var body struct {
+				SnapshotKey *client.SnapshotKey `json:"snapshot-key"`
+			}
+			c.Assert(json.NewDecoder(r.Body).Decode(&body), IsNil)
+			*keys = append(*keys, body.SnapshotKey)
+			w.WriteHeader(202)
+			fmt.Fprintln(w, `{"type":"async", "status-code": 202, "change": "9", "result": {"set-id": 1}}`)
+		case "/v2/snapshots":
+			switch {
+			case r.Method == "GET":
+				fmt.Fprintln(w, `{"type":"sync","status-code":200,"status":"OK","result":[{"id":1,"snapshots":[{"set":1,"snap":"htop","revision":"1168","epoch":{"read":[0],"write":[0]},"version":"2","size":1}]}]}`)
+			case r.Header.Get("Content-Type") == client.SnapshotExportMediaType:
+				data, err := io.ReadAll(r.Body)
+				c.Assert(err, IsNil)
+				c.Check(string(data), Equals, "encrypted snapshot data")
+				if keyRequired(w, headerKey(r)) {
+					return
+				}
+				fmt.Fprintln(w, `{"type": "sync", "result": {"set-id": 1, "snaps": ["htop"]}}`)
+			default:
+				var action struct {
+					Key *client.SnapshotKey `json:"key"`
+				}
+				c.Assert(json.NewDecoder(r.Body).Decode(&action), IsNil)
+				if keyRequired(w, action.Key) {
+					return
+				}
+				w.WriteHeader(202)
+				fmt.Fprintln(w, `{"type":"async", "status-code": 202, "change": "9"}`)
+			}
+		case "/v2/changes/9":
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done", "data": {}}}`)
+		case "/v2/snapshots/1/export":
+			if keyRequired(w, headerKey(r)) {
+				return
+			}
+			w.Header().Set("Content-Type", client.SnapshotExportMediaType)
+			fmt.Fprint(w, "Hello World!")
+		default:
+			c.Errorf("unexpected path %q", r.URL.Path)
+		}
+	})
+}
+
+func (s *SnapSuite) TestSnapshotSaveEncrypted(c *C) {
+	var keys []*client.SnapshotKey
+	s.mockEncryptedSnapshotsServer(c, "passphrase", &keys)
+
+	s.password = "s3cret"
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"save", "--passphrase", "htop"})
+	c.Assert(err, IsNil)
+	c.Check(keys, DeepEquals, []*client.SnapshotKey{{Passphrase: "s3cret"}})
+	c.Check(s.Stdout(), testutil.Contains, "Passphrase for the snapshot: \nRepeat the passphrase: \n")
+
+	keys = nil
+	_, err = main.Parser(main.Client()).ParseArgs([]string{"save", "--device-key", "htop"})
+	c.Assert(err, IsNil)
+	c.Check(keys, DeepEquals, []*client.SnapshotKey{{Device: true}})
+}
+
+func (s *SnapSuite) TestSnapshotSaveEncryptedErrors(c *C) {
+	var keys []*client.SnapshotKey
+	s.mockEncryptedSnapshotsServer(c, "passphrase", &keys)
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"save", "--passphrase", "--device-key", "htop"})
+	c.Check(err, ErrorMatches, "cannot use --passphrase and --device-key together")
+
+	s.password = ""
+	_, err = main.Parser(main.Client()).ParseArgs([]string{"save", "--passphrase", "htop"})
+	c.Check(err, ErrorMatches, "no passphrase given")
+	c.Check(keys, HasLen, 0)
+}
+
+func (s *SnapSuite) TestSnapshotRestoreCheckEncrypted(c *C) {
+	var keys []*client.SnapshotKey
+	s.mockEncryptedSnapshotsServer(c, "passphrase", &keys)
+	s.password = "s3cret"
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"restore", "1"})
+	c.Assert(err, IsNil)
+	c.Check(keys, DeepEquals, []*client.SnapshotKey{nil, {Passphrase: "s3cret"}})
+	c.Check(s.Stdout(), Equals, "Passphrase for snapshot #1: \nRestored snapshot #1.\n")
+
+	s.stdout.Truncate(0)
+	keys = nil
+	_, err = main.Parser(main.Client()).ParseArgs([]string{"check-snapshot", "1"})
+	c.Assert(err, IsNil)
+	c.Check(keys, DeepEquals, []*client.SnapshotKey{nil, {Passphrase: "s3cret"}})
+	c.Check(s.Stdout(), Equals, "Passphrase for snapshot #1: \nSnapshot #1 verified successfully.\n")
+}
+
+func (s *SnapSuite) TestSnapshotExportEncryptedDeviceKey(c *C) {
+	var keys []*client.SnapshotKey
+	s.mockEncryptedSnapshotsServer(c, "device", &keys)
+
+	exportedSnapshotPath := filepath.Join(c.MkDir(), "export-snapshot.snapshot")
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"export-snapshot", "1", exportedSnapshotPath})
+	c.Assert(err, IsNil)
+	// the device key is used without asking for anything
+	c.Check(keys, DeepEquals, []*client.SnapshotKey{nil, {Device: true}})
+	c.Check(s.Stdout(), testutil.MatchesWrapped, `Exported snapshot #1 into ".*/export-snapshot.snapshot"`)
+	c.Check(exportedSnapshotPath, testutil.FileEquals, "Hello World!")
+}
+
+func (s *SnapSuite) TestSnapshotImportEncrypted(c *C) {
+	var keys []*client.SnapshotKey
+	s.mockEncryptedSnapshotsServer(c, "passphrase", &keys)
+	s.password = "s3cret"
+
+	exportedSnapshotPath := filepath.Join(c.MkDir(), "mocked-snapshot.snapshot")
+	c.Assert(os.WriteFile(exportedSnapshotPath, []byte("encrypted snapshot data"), 0644), IsNil)
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"import-snapshot", exportedSnapshotPath})
+	c.Assert(err, IsNil)
+	// the file is sent again with the key
+	c.Check(keys, DeepEquals, []*client.SnapshotKey{nil, {Passphrase: "s3cret"}})
+	c.Check(s.Stdout(), testutil.Contains, "Passphrase for the imported snapshot: \nImported snapshot as #1\n")
+}
@@ -21,6 +21,7 @@ package main
 
 import (
 	"context"
+	"net/http"
 	"os"
 	"time"
 
@@ -466,8 +467,23 @@ func ParseQuotaValues(maxMemory, cpuMax, cpuSet, threadsMax, journalSizeMax, jou
 	return quotas.parseQuotas()
 }
 
+func ParseSwapAndIOQuotaValues(memorySwapMax, ioDevice, ioReadBandwidth, ioWriteBandwidth string) (*client.QuotaValues, error) {
+	var quotas cmdSetQuota
+
+	quotas.MemorySwapMax = memorySwapMax
+	quotas.IODevice = ioDevice
+	quotas.IOReadBandwidth = ioReadBandwidth
+	quotas.IOWriteBandwidth = ioWriteBandwidth
+
+	return quotas.parseQuotas()
+}
+
 func MockSeedWriterReadManifest(f func(manifestFile string) (*seedwriter.Manifest, error)) (restore func()) {
 	restore = testutil.Backup(&seedwriterReadManifest)
 	seedwriterReadManifest = f
 	return restore
 }
+
+func MockHttpListenAndServe(f func(addr string, handler http.Handler) error) (restore func()) {
+	return testutil.Mock(&httpListenAndServe, f)
+}
@@ -102,6 +102,13 @@ var debugCommands []*cmdInfo
 // routineCommands holds information about all internal commands.
 var routineCommands []*cmdInfo
 
+// snapshotCommands holds information about all "snap snapshot" commands.
+var snapshotCommands []*cmdInfo
+
+// promptingRulesCommands holds information about all "snap prompting-rules"
+// commands.
+var promptingRulesCommands []*cmdInfo
+
 // addCommand replaces parser.addCommand() in a way that is compatible with
 // re-constructing a pristine parser.
 func addCommand(name, shortHelp, longHelp string, builder func() flags.Commander, optDescs map[string]string, argDescs []argDesc) *cmdInfo {
@@ -149,6 +156,38 @@ func addRoutineCommand(name, shortHelp, longHelp string, builder func() flags.Co
 	return info
 }
 
+// addSnapshotCommand replaces parser.addCommand() in a way that is
+// compatible with re-constructing a pristine parser. It is meant for
+// adding "snap snapshot" commands.
+func addSnapshotCommand(name, shortHelp, longHelp string, builder func() flags.Commander, optDescs map[string]string, argDescs []argDesc) *cmdInfo {
+	info := &cmdInfo{
+		name:      name,
+		shortHelp: shortHelp,
+		longHelp:  longHelp,
+		builder:   builder,
+		optDescs:  optDescs,
+		argDescs:  argDescs,
+	}
+	snapshotCommands = append(snapshotCommands, info)
+	return info
+}
+
+// addPromptingRulesCommand replaces parser.addCommand() in a way that is
+// compatible with re-constructing a pristine parser. It is meant for
+// adding "snap prompting-rules" commands.
+func addPromptingRulesCommand(name, shortHelp, longHelp string, builder func() flags.Commander, optDescs map[string]string, argDescs []argDesc) *cmdInfo {
+	info := &cmdInfo{
+		name:      name,
+		shortHelp: shortHelp,
+		longHelp:  longHelp,
+		builder:   builder,
+		optDescs:  optDescs,
+		argDescs:  argDescs,
+	}
+	promptingRulesCommands = append(promptingRulesCommands, info)
+	return info
+}
+
 type parserSetter interface {
 	setParser(*flags.Parser)
 }
@@ -331,7 +370,7 @@ func Parser(cli *client.Client) *flags.Parser {
 	// add --help like what go-flags would do for us, but hidden
 	addHelp(parser)
 
-	seen := make(map[string]bool, len(commands)+len(debugCommands)+len(routineCommands))
+	seen := make(map[string]bool, len(commands)+len(debugCommands)+len(routineCommands)+len(snapshotCommands)+len(promptingRulesCommands))
 	checkUnique := func(ci *cmdInfo, kind string) {
 		if seen[ci.shortHelp] && ci.shortHelp != "Internal" && ci.shortHelp != "Deprecated (hidden)" {
 			logger.Panicf(`%scommand %q has an already employed description != "Internal"|"Deprecated (hidden)": %s`, kind, ci.name, ci.shortHelp)
@@ -352,6 +391,24 @@ func Parser(cli *client.Client) *flags.Parser {
 	registerCommands(cli, parser, debugCommand, debugCommands, func(ci *cmdInfo) {
 		checkUnique(ci, "debug ")
 	})
+	// Add the snapshot command
+	snapshotCommand, err := parser.AddCommand("snapshot", shortSnapshotHelp, longSnapshotHelp, &cmdSnapshot{})
+	if err != nil {
+		logger.Panicf("cannot add command %q: %v", "snapshot", err)
+	}
+	// Add all the sub-commands of the snapshot command
+	registerCommands(cli, parser, snapshotCommand, snapshotCommands, func(ci *cmdInfo) {
+		checkUnique(ci, "snapshot ")
+	})
+	// Add the prompting-rules command
+	promptingRulesCommand, err := parser.AddCommand("prompting-rules", shortPromptingRulesHelp, longPromptingRulesHelp, &cmdPromptingRules{})
+	if err != nil {
+		logger.Panicf("cannot add command %q: %v", "prompting-rules", err)
+	}
+	// Add all the sub-commands of the prompting-rules command
+	registerCommands(cli, parser, promptingRulesCommand, promptingRulesCommands, func(ci *cmdInfo) {
+		checkUnique(ci, "prompting-rules ")
+	})
 	// Add the internal command
 	routineCommand, err := parser.AddCommand("routine", shortRoutineHelp, longRoutineHelp, &cmdRoutine{})
 	routineCommand.Hidden = true
@@ -969,8 +969,10 @@ func namespaceResult(res interface{}, suffixParts []string) (interface{}, error)
 	return map[string]interface{}{part: nested}, nil
 }
 
-// Get returns the view value identified by the request. If either the named
-// view or the corresponding value can't be found, a NotFoundError is returned.
+// Get returns the view value identified by the request. Values which aren't
+// stored are read from the defaults declared in the schema, if any. If either
+// the named view or the corresponding value can't be found, a NotFoundError is
+// returned.
 func (v *View) Get(databag DataBag, request string) (interface{}, error) {
 	if request != "" {
 		if err := validateViewDottedPath(request, nil); err != nil {
@@ -986,13 +988,20 @@ func (v *View) Get(databag DataBag, request string) (interface{}, error) {
 	var merged interface{}
 	for _, match := range matches {
 		val, err := databag.Get(match.storagePath)
+		if err != nil && !errors.Is(err, PathError("")) {
+			return nil, err
+		}
+
+		// use the defaults declared in the schema for anything that isn't stored
+		val, err = v.withDefaults(match.storagePath, val)
 		if err != nil {
-			if errors.Is(err, PathError("")) {
-				continue
-			}
 			return nil, err
 		}
 
+		if val == nil {
+			continue
+		}
+
 		// build a namespace around the result based on the unmatched suffix parts
 		val, err = namespaceResult(val, match.suffixParts)
 		if err != nil {
@@ -1018,6 +1027,25 @@ func (v *View) Get(databag DataBag, request string) (interface{}, error) {
 	return merged, nil
 }
 
+// withDefaults returns the value stored at the storage path with any missing
+// values filled in with the defaults declared in the confdb's schema.
+func (v *View) withDefaults(storagePath string, val interface{}) (interface{}, error) {
+	schema, ok := v.confdb.Schema.(*StorageSchema)
+	if !ok {
+		return val, nil
+	}
+
+	subkeys := strings.Split(storagePath, ".")
+	for _, subkey := range subkeys {
+		// unmatched placeholders don't refer to a specific entry
+		if isPlaceholder(subkey) {
+			return val, nil
+		}
+	}
+
+	return schema.fillDefaults(subkeys, val)
+}
+
 func mergeNamespaces(old, new interface{}) (interface{}, error) {
 	if old == nil {
 		return new, nil
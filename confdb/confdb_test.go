@@ -1508,6 +1508,91 @@ func (s *viewSuite) TestSetOverwriteValueWithNewLevel(c *C) {
 	c.Assert(data, DeepEquals, map[string]interface{}{"bar": "baz"})
 }
 
+func (s *viewSuite) TestGetReturnsSchemaDefaults(c *C) {
+	schema, err := confdb.ParseSchema([]byte(`{
+	"schema": {
+		"wifi": {
+			"schema": {
+				"ssid": "string",
+				"security": {
+					"type": "string",
+					"choices": ["wpa2", "wpa3"],
+					"default": "wpa2"
+				},
+				"channel": {
+					"type": "int",
+					"default": 6
+				}
+			}
+		},
+		"interfaces": {
+			"values": {
+				"schema": {
+					"mtu": {"type": "int", "default": 1500},
+					"name": "string"
+				}
+			}
+		}
+	}
+}`))
+	c.Assert(err, IsNil)
+
+	db, err := confdb.New("acc", "confdb", map[string]interface{}{
+		"foo": map[string]interface{}{
+			"rules": []interface{}{
+				map[string]interface{}{"request": "ssid", "storage": "wifi.ssid"},
+				map[string]interface{}{"request": "security", "storage": "wifi.security"},
+				map[string]interface{}{"request": "wifi", "storage": "wifi"},
+				map[string]interface{}{"request": "interfaces.{name}", "storage": "interfaces.{name}"},
+			},
+		},
+	}, schema)
+	c.Assert(err, IsNil)
+
+	view := db.View("foo")
+	databag := confdb.NewJSONDataBag()
+
+	// nothing is stored so the default is returned
+	val, err := view.Get(databag, "security")
+	c.Assert(err, IsNil)
+	c.Check(val, Equals, "wpa2")
+
+	// the entries with defaults are filled into the map
+	val, err = view.Get(databag, "wifi")
+	c.Assert(err, IsNil)
+	c.Check(val, DeepEquals, map[string]interface{}{"security": "wpa2", "channel": float64(6)})
+
+	// values without defaults still aren't found
+	_, err = view.Get(databag, "ssid")
+	c.Assert(err, FitsTypeOf, &confdb.NotFoundError{})
+
+	err = view.Set(databag, "ssid", "foo")
+	c.Assert(err, IsNil)
+	err = view.Set(databag, "security", "wpa3")
+	c.Assert(err, IsNil)
+
+	// stored values take precedence over defaults
+	val, err = view.Get(databag, "wifi")
+	c.Assert(err, IsNil)
+	c.Check(val, DeepEquals, map[string]interface{}{"ssid": "foo", "security": "wpa3", "channel": float64(6)})
+
+	// defaults are filled into values stored under keys of arbitrary names
+	err = databag.Set("interfaces.eth0", map[string]interface{}{"name": "eth0"})
+	c.Assert(err, IsNil)
+
+	val, err = view.Get(databag, "interfaces.eth0")
+	c.Assert(err, IsNil)
+	c.Check(val, DeepEquals, map[string]interface{}{"name": "eth0", "mtu": float64(1500)})
+
+	// unset values are reset to the default
+	err = view.Unset(databag, "security")
+	c.Assert(err, IsNil)
+
+	val, err = view.Get(databag, "security")
+	c.Assert(err, IsNil)
+	c.Check(val, Equals, "wpa2")
+}
+
 func (s *viewSuite) TestSetValidatesDataWithSchemaPass(c *C) {
 	schema, err := confdb.ParseSchema([]byte(`{
 	"aliases": {
@@ -28,3 +28,11 @@ func MockMaxValueDepth(newDepth int) (restore func()) {
 		maxValueDepth = oldDepth
 	}
 }
+
+func StringChoiceDescriptions(s Schema) map[string]string {
+	return s.(*stringSchema).descriptions
+}
+
+func IntChoiceDescriptions(s Schema) map[int64]string {
+	return s.(*intSchema).descriptions
+}
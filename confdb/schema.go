@@ -198,6 +198,12 @@ func (s *StorageSchema) parse(raw json.RawMessage) (Schema, error) {
 		if err := schema.parseConstraints(schemaDef); err != nil {
 			return nil, err
 		}
+
+		if rawDefault, ok := schemaDef["default"]; ok {
+			if err := parseDefault(schema, rawDefault); err != nil {
+				return nil, err
+			}
+		}
 	} else if schema.expectsConstraints() {
 		return nil, fmt.Errorf(`cannot parse %q: must be schema definition with constraints`, typ)
 	}
@@ -205,6 +211,109 @@ func (s *StorageSchema) parse(raw json.RawMessage) (Schema, error) {
 	return schema, nil
 }
 
+// defaulter is implemented by schemas which can declare a default value to be
+// used when nothing is stored.
+type defaulter interface {
+	defaultValue() json.RawMessage
+	setDefault(json.RawMessage)
+}
+
+// schemaDefault holds the default value declared by a type definition.
+type schemaDefault struct {
+	def json.RawMessage
+}
+
+func (d *schemaDefault) defaultValue() json.RawMessage { return d.def }
+
+func (d *schemaDefault) setDefault(raw json.RawMessage) { d.def = raw }
+
+// parseDefault checks that the default value is valid according to the schema
+// and sets it as the schema's default.
+func parseDefault(schema parser, raw json.RawMessage) error {
+	d, ok := schema.(defaulter)
+	if !ok {
+		// alias references share the alias' schema so they can't have their own
+		return fmt.Errorf(`cannot use "default" constraint in alias reference`)
+	}
+
+	if err := schema.Validate(raw); err != nil {
+		return fmt.Errorf(`cannot parse "default" constraint: %w`, err)
+	}
+
+	d.setDefault(raw)
+	return nil
+}
+
+// fillDefaults returns the value at the path with the defaults declared in the
+// schema filled in. If the value is nil, the path's default is returned (or
+// nil, if there is none). Defaults are only filled in if the path corresponds
+// to a single schema.
+func (s *StorageSchema) fillDefaults(path []string, value interface{}) (interface{}, error) {
+	schemas, err := s.SchemaAt(path)
+	if err != nil || len(schemas) != 1 {
+		return value, nil
+	}
+
+	return fillDefaults(schemas[0], value)
+}
+
+func fillDefaults(schema Schema, value interface{}) (interface{}, error) {
+	if alias, ok := schema.(*aliasRefParser); ok {
+		schema = alias.Schema
+	}
+
+	if value == nil {
+		if d, ok := schema.(defaulter); ok && d.defaultValue() != nil {
+			if err := json.Unmarshal(d.defaultValue(), &value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	mapSch, ok := schema.(*mapSchema)
+	if !ok {
+		return value, nil
+	}
+
+	mapVal, ok := value.(map[string]interface{})
+	if value != nil && !ok {
+		return value, nil
+	}
+
+	filled := make(map[string]interface{}, len(mapVal))
+	for k, v := range mapVal {
+		filled[k] = v
+	}
+
+	if mapSch.entrySchemas != nil {
+		// maps with a "schema" can have defaults for missing entries
+		for key, entrySchema := range mapSch.entrySchemas {
+			val, err := fillDefaults(entrySchema, filled[key])
+			if err != nil {
+				return nil, err
+			}
+
+			if val != nil {
+				filled[key] = val
+			}
+		}
+	} else if mapSch.valueSchema != nil {
+		for key, val := range mapVal {
+			val, err := fillDefaults(mapSch.valueSchema, val)
+			if err != nil {
+				return nil, err
+			}
+			filled[key] = val
+		}
+	}
+
+	if value == nil && len(filled) == 0 {
+		return nil, nil
+	}
+
+	return filled, nil
+}
+
 // parseTypeDefinition tries to parse the raw JSON as a list, a map or a string
 // (the accepted ways to express types).
 func parseTypeDefinition(raw json.RawMessage) (interface{}, error) {
@@ -391,6 +500,8 @@ func (v *alternativesSchema) Type() SchemaType {
 }
 
 type mapSchema struct {
+	schemaDefault
+
 	// topSchema is the schema for the top-level schema which contains the aliases.
 	topSchema *StorageSchema
 
@@ -407,6 +518,10 @@ type mapSchema struct {
 	// requiredCombs holds combinations of keys that an instance of the map is
 	// allowed to have.
 	requiredCombs [][]string
+
+	// constraints holds relations between the map's entries that must hold for
+	// the map to be valid.
+	constraints []*constraint
 }
 
 // Validate that raw is a valid map and meets the constraints set by the
@@ -470,8 +585,9 @@ func (v *mapSchema) Validate(raw []byte) error {
 			}
 		}
 
-		// all required entries are present and validated
-		return nil
+		// all required entries are present and validated, check the relations
+		// between them
+		return v.checkConstraints(raw)
 	}
 
 	if v.keySchema != nil {
@@ -596,6 +712,21 @@ func (v *mapSchema) parseConstraints(constraints map[string]json.RawMessage) err
 			}
 		}
 
+		if rawConstraints, ok := constraints["constraints"]; ok {
+			var exprs []string
+			if err := json.Unmarshal(rawConstraints, &exprs); err != nil {
+				return fmt.Errorf(`cannot parse map's "constraints" constraint: %v`, err)
+			}
+
+			for _, expr := range exprs {
+				constraint, err := v.parseConstraint(expr)
+				if err != nil {
+					return fmt.Errorf(`cannot parse map's "constraints" constraint: %w`, err)
+				}
+				v.constraints = append(v.constraints, constraint)
+			}
+		}
+
 		return nil
 	}
 
@@ -632,6 +763,9 @@ func checkExclusiveMapConstraints(obj map[string]json.RawMessage) error {
 	if has("required") && !has("schema") {
 		return fmt.Errorf(`cannot use "required" without "schema" constraint`)
 	}
+	if has("constraints") && !has("schema") {
+		return fmt.Errorf(`cannot use "constraints" without "schema" constraint`)
+	}
 	if has("schema") && has("keys") {
 		return fmt.Errorf(`cannot use "schema" and "keys" constraints simultaneously`)
 	}
@@ -642,6 +776,270 @@ func checkExclusiveMapConstraints(obj map[string]json.RawMessage) error {
 	return nil
 }
 
+// constraint is a relation between a map's entries which must hold for the
+// map to be valid. Constraints are expressed as "<key> <operator> <operand>"
+// where the key is a (possibly dotted) path to one of the map's entries and the
+// operand is either another path or a literal: a number, a boolean or a string
+// in single quotes. The supported operators are:
+//   - ==, !=, <, <=, > and >=, which compare the entries' values and hold if
+//     either of the entries isn't set
+//   - requires, which holds if the key isn't set or the other entry is set
+//   - excludes, which holds if the key and the other entry aren't both set
+//
+// Entries with a default value are compared using the default if they aren't
+// set but, for requires and excludes, only entries that are actually set
+// count.
+type constraint struct {
+	expr string
+	key  []string
+	op   string
+
+	// other is the path to the entry which the key is related to or nil, if the
+	// operand is a literal.
+	other   []string
+	literal interface{}
+}
+
+var constraintOperators = []string{"==", "!=", "<", "<=", ">", ">=", "requires", "excludes"}
+
+func (v *mapSchema) parseConstraint(expr string) (*constraint, error) {
+	parts := strings.Fields(expr)
+	if len(parts) < 3 {
+		return nil, fmt.Errorf(`cannot parse constraint %q: must be "<key> <operator> <operand>"`, expr)
+	}
+
+	c := &constraint{
+		expr: expr,
+		op:   parts[1],
+	}
+
+	if !strutil.ListContains(constraintOperators, c.op) {
+		return nil, fmt.Errorf(`cannot parse constraint %q: unknown operator %q`, expr, c.op)
+	}
+
+	var err error
+	if c.key, err = v.constraintPath(parts[0]); err != nil {
+		return nil, fmt.Errorf(`cannot parse constraint %q: %w`, expr, err)
+	}
+
+	// the operand is the rest of the expression so strings can contain spaces
+	rest := strings.TrimSpace(strings.TrimSpace(expr)[len(parts[0]):])
+	operand := strings.TrimSpace(rest[len(c.op):])
+
+	if c.op == "requires" || c.op == "excludes" {
+		if c.other, err = v.constraintPath(operand); err != nil {
+			return nil, fmt.Errorf(`cannot parse constraint %q: %w`, expr, err)
+		}
+		return c, nil
+	}
+
+	if len(operand) >= 2 && operand[0] == '\'' && operand[len(operand)-1] == '\'' {
+		c.literal = operand[1 : len(operand)-1]
+		return c, nil
+	}
+
+	var literal interface{}
+	if err := json.Unmarshal([]byte(operand), &literal); err == nil {
+		switch literal.(type) {
+		case bool:
+			if c.op != "==" && c.op != "!=" {
+				return nil, fmt.Errorf(`cannot parse constraint %q: cannot use operator %q with bool values`, expr, c.op)
+			}
+			c.literal = literal
+			return c, nil
+		case float64:
+			c.literal = literal
+			return c, nil
+		}
+	}
+
+	if c.other, err = v.constraintPath(operand); err != nil {
+		return nil, fmt.Errorf(`cannot parse constraint %q: %w`, expr, err)
+	}
+
+	return c, nil
+}
+
+// constraintPath checks that the path refers to an entry in the map's schema
+// and returns it split into sub-keys.
+func (v *mapSchema) constraintPath(path string) ([]string, error) {
+	subkeys := strings.Split(path, ".")
+	for _, subkey := range subkeys {
+		if !validSubkey.MatchString(subkey) {
+			return nil, fmt.Errorf(`invalid key %q`, path)
+		}
+	}
+
+	if _, err := v.SchemaAt(subkeys); err != nil {
+		return nil, fmt.Errorf(`cannot use key %q: %v`, path, err)
+	}
+
+	return subkeys, nil
+}
+
+// checkConstraints checks that the map's value meets its constraints. Missing
+// entries with defaults are filled in before comparing values.
+func (v *mapSchema) checkConstraints(raw []byte) error {
+	if len(v.constraints) == 0 {
+		return nil
+	}
+
+	var value map[string]interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return validationErrorFrom(err)
+	}
+
+	filled, err := fillDefaults(v, value)
+	if err != nil {
+		return validationErrorFrom(err)
+	}
+	filledValue, _ := filled.(map[string]interface{})
+
+	for _, c := range v.constraints {
+		if err := c.check(value, filledValue); err != nil {
+			return validationErrorFrom(err)
+		}
+	}
+
+	return nil
+}
+
+// check checks the constraint against the stored value, which determines
+// whether entries are set, and the value filled in with defaults, which is
+// used to compare entries.
+func (c *constraint) check(stored, filled map[string]interface{}) error {
+	switch c.op {
+	case "requires", "excludes":
+		_, keySet := lookupConstraintPath(stored, c.key)
+		_, otherSet := lookupConstraintPath(stored, c.other)
+		return c.checkSet(keySet, otherSet)
+	}
+
+	keyVal, keySet := lookupConstraintPath(filled, c.key)
+
+	var otherVal interface{}
+	otherSet := true
+	if c.other != nil {
+		otherVal, otherSet = lookupConstraintPath(filled, c.other)
+	} else {
+		otherVal = c.literal
+	}
+
+	if !keySet || !otherSet {
+		return nil
+	}
+
+	cmp, err := compareConstraintValues(keyVal, otherVal, c.op)
+	if err != nil {
+		return fmt.Errorf(`cannot check constraint %q: %v`, c.expr, err)
+	}
+
+	if !cmp {
+		return fmt.Errorf(`constraint %q is not satisfied`, c.expr)
+	}
+	return nil
+}
+
+func (c *constraint) checkSet(keySet, otherSet bool) error {
+	switch c.op {
+	case "requires":
+		if keySet && !otherSet {
+			return fmt.Errorf(`constraint %q is not satisfied: %q is set but %q is not`, c.expr, strings.Join(c.key, "."), strings.Join(c.other, "."))
+		}
+		return nil
+	case "excludes":
+		if keySet && otherSet {
+			return fmt.Errorf(`constraint %q is not satisfied: %q and %q cannot both be set`, c.expr, strings.Join(c.key, "."), strings.Join(c.other, "."))
+		}
+		return nil
+	}
+
+	return fmt.Errorf(`internal error: unexpected constraint operator %q`, c.op)
+}
+
+func lookupConstraintPath(value map[string]interface{}, path []string) (interface{}, bool) {
+	var cur interface{} = value
+	for _, subkey := range path {
+		level, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		if cur, ok = level[subkey]; !ok {
+			return nil, false
+		}
+	}
+
+	return cur, true
+}
+
+// compareConstraintValues compares two values using the operator. Numbers and
+// strings can be ordered, booleans can only be compared for equality.
+func compareConstraintValues(left, right interface{}, op string) (bool, error) {
+	switch l := left.(type) {
+	case float64:
+		if r, ok := right.(float64); ok {
+			return compareOrdered(l, r, op), nil
+		}
+	case string:
+		if r, ok := right.(string); ok {
+			return compareOrdered(l, r, op), nil
+		}
+	case bool:
+		if r, ok := right.(bool); ok {
+			switch op {
+			case "==":
+				return l == r, nil
+			case "!=":
+				return l != r, nil
+			default:
+				return false, fmt.Errorf(`cannot use operator %q with bool values`, op)
+			}
+		}
+	default:
+		return false, fmt.Errorf(`cannot compare value of type %s`, jsonTypeName(left))
+	}
+
+	return false, fmt.Errorf(`cannot compare %s and %s values`, jsonTypeName(left), jsonTypeName(right))
+}
+
+func compareOrdered[T float64 | string](l, r T, op string) bool {
+	switch op {
+	case "==":
+		return l == r
+	case "!=":
+		return l != r
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	case ">=":
+		return l >= r
+	}
+
+	// cannot happen since operators are checked when parsing
+	return false
+}
+
+func jsonTypeName(v interface{}) string {
+	switch v.(type) {
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case map[string]interface{}:
+		return "map"
+	case []interface{}:
+		return "array"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
 func (v *mapSchema) parseMapKeyType(raw json.RawMessage) (Schema, error) {
 	var typ string
 	if err := json.Unmarshal(raw, &typ); err != nil {
@@ -696,11 +1094,16 @@ func (v *mapSchema) parseMapKeyType(raw json.RawMessage) (Schema, error) {
 func (v *mapSchema) expectsConstraints() bool { return true }
 
 type stringSchema struct {
+	schemaDefault
+
 	// pattern is a regex pattern that the string must match.
 	pattern *regexp.Regexp
 
 	// choices holds the possible values the string can take, if non-empty.
 	choices []string
+
+	// descriptions holds the descriptions documenting the choices, if any.
+	descriptions map[string]string
 }
 
 // Validate that raw is a valid string and meets the schema's constraints.
@@ -725,7 +1128,7 @@ func (v *stringSchema) Validate(raw []byte) (err error) {
 	}
 
 	if len(v.choices) != 0 && !strutil.ListContains(v.choices, *value) {
-		return fmt.Errorf(`string %q is not one of the allowed choices`, *value)
+		return fmt.Errorf(`string %q is not one of the allowed choices%s`, *value, describeChoices(v.choices, v.descriptions))
 	}
 
 	if v.pattern != nil && !v.pattern.Match([]byte(*value)) {
@@ -751,8 +1154,8 @@ func (v *stringSchema) Type() SchemaType {
 
 func (v *stringSchema) parseConstraints(constraints map[string]json.RawMessage) error {
 	if rawChoices, ok := constraints["choices"]; ok {
-		var choices []string
-		if err := json.Unmarshal(rawChoices, &choices); err != nil {
+		choices, descriptions, err := parseChoices[string](rawChoices)
+		if err != nil {
 			return fmt.Errorf(`cannot parse "choices" constraint: %w`, err)
 		}
 
@@ -761,6 +1164,7 @@ func (v *stringSchema) parseConstraints(constraints map[string]json.RawMessage)
 		}
 
 		v.choices = choices
+		v.descriptions = descriptions
 	}
 
 	if rawPattern, ok := constraints["pattern"]; ok {
@@ -784,10 +1188,91 @@ func (v *stringSchema) parseConstraints(constraints map[string]json.RawMessage)
 
 func (v *stringSchema) expectsConstraints() bool { return false }
 
+// parseChoices parses a list of choices. Each choice can be either a value or
+// an object with a "value" and a "description" documenting it, in which case
+// the descriptions are also returned.
+func parseChoices[T string | int64 | float64](raw json.RawMessage) ([]T, map[T]string, error) {
+	var choices []T
+	err := json.Unmarshal(raw, &choices)
+	if err == nil {
+		return choices, nil, nil
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		return nil, nil, err
+	}
+
+	var rawChoices []json.RawMessage
+	if json.Unmarshal(raw, &rawChoices) != nil {
+		// not a list, so report the original error
+		return nil, nil, err
+	}
+
+	choices = make([]T, 0, len(rawChoices))
+	var descriptions map[T]string
+	for _, rawChoice := range rawChoices {
+		var choice T
+		if err := json.Unmarshal(rawChoice, &choice); err == nil {
+			choices = append(choices, choice)
+			continue
+		}
+
+		var described struct {
+			Value       *T     `json:"value"`
+			Description string `json:"description"`
+		}
+		if err := json.Unmarshal(rawChoice, &described); err != nil {
+			return nil, nil, fmt.Errorf(`choice must be a value or an object with "value" and "description": %v`, err)
+		}
+
+		if described.Value == nil {
+			return nil, nil, fmt.Errorf(`choice must have a "value"`)
+		}
+
+		if descriptions == nil {
+			descriptions = make(map[T]string)
+		}
+		choices = append(choices, *described.Value)
+		descriptions[*described.Value] = described.Description
+	}
+
+	return choices, descriptions, nil
+}
+
+// describeChoices lists the choices along with their descriptions, to be
+// appended to an error about a value not being one of them. Nothing is listed
+// if none of the choices are described.
+func describeChoices[T string | int64 | float64](choices []T, descriptions map[T]string) string {
+	if len(descriptions) == 0 {
+		return ""
+	}
+
+	described := make([]string, 0, len(choices))
+	for _, choice := range choices {
+		var desc string
+		if str, ok := any(choice).(string); ok {
+			desc = strconv.Quote(str)
+		} else {
+			desc = fmt.Sprintf("%v", choice)
+		}
+		if descriptions[choice] != "" {
+			desc = fmt.Sprintf("%s (%s)", desc, descriptions[choice])
+		}
+		described = append(described, desc)
+	}
+	return ": " + strings.Join(described, ", ")
+}
+
 type intSchema struct {
+	schemaDefault
+
 	min     *int64
 	max     *int64
 	choices []int64
+
+	// descriptions holds the descriptions documenting the choices, if any.
+	descriptions map[int64]string
 }
 
 // Validate that raw is a valid integer and meets the schema's constraints.
@@ -811,7 +1296,7 @@ func (v *intSchema) Validate(raw []byte) (err error) {
 		return fmt.Errorf(`cannot accept null value for "int" type`)
 	}
 
-	return validateNumber(*num, v.choices, v.min, v.max)
+	return validateNumber(*num, v.choices, v.descriptions, v.min, v.max)
 }
 
 // SchemaAt returns the int schema if the path terminates here and an error if
@@ -831,8 +1316,7 @@ func (v *intSchema) Type() SchemaType {
 
 func (v *intSchema) parseConstraints(constraints map[string]json.RawMessage) error {
 	if rawChoices, ok := constraints["choices"]; ok {
-		var choices []int64
-		err := json.Unmarshal(rawChoices, &choices)
+		choices, descriptions, err := parseChoices[int64](rawChoices)
 		if err != nil {
 			return fmt.Errorf(`cannot parse "choices" constraint: %v`, err)
 		}
@@ -842,6 +1326,7 @@ func (v *intSchema) parseConstraints(constraints map[string]json.RawMessage) err
 		}
 
 		v.choices = choices
+		v.descriptions = descriptions
 	}
 
 	if rawMin, ok := constraints["min"]; ok {
@@ -877,7 +1362,9 @@ func (v *intSchema) parseConstraints(constraints map[string]json.RawMessage) err
 
 func (v *intSchema) expectsConstraints() bool { return false }
 
-type anySchema struct{}
+type anySchema struct {
+	schemaDefault
+}
 
 func (v *anySchema) Validate(raw []byte) (err error) {
 	defer func() {
@@ -915,9 +1402,14 @@ func (v *anySchema) Type() SchemaType {
 func (v *anySchema) expectsConstraints() bool { return false }
 
 type numberSchema struct {
+	schemaDefault
+
 	min     *float64
 	max     *float64
 	choices []float64
+
+	// descriptions holds the descriptions documenting the choices, if any.
+	descriptions map[float64]string
 }
 
 // Validate that raw is a valid number and meets the schema's constraints.
@@ -941,7 +1433,7 @@ func (v *numberSchema) Validate(raw []byte) (err error) {
 		return fmt.Errorf(`cannot accept null value for "number" type`)
 	}
 
-	return validateNumber(*num, v.choices, v.min, v.max)
+	return validateNumber(*num, v.choices, v.descriptions, v.min, v.max)
 }
 
 // SchemaAt returns the number schema if the path terminates here and an error if
@@ -959,7 +1451,7 @@ func (v *numberSchema) Type() SchemaType {
 	return Number
 }
 
-func validateNumber[Num ~int64 | ~float64](num Num, choices []Num, min, max *Num) error {
+func validateNumber[Num int64 | float64](num Num, choices []Num, descriptions map[Num]string, min, max *Num) error {
 	if len(choices) != 0 {
 		var found bool
 		for _, choice := range choices {
@@ -970,7 +1462,7 @@ func validateNumber[Num ~int64 | ~float64](num Num, choices []Num, min, max *Num
 		}
 
 		if !found {
-			return fmt.Errorf(`%v is not one of the allowed choices`, num)
+			return fmt.Errorf(`%v is not one of the allowed choices%s`, num, describeChoices(choices, descriptions))
 		}
 	}
 
@@ -989,8 +1481,7 @@ func validateNumber[Num ~int64 | ~float64](num Num, choices []Num, min, max *Num
 
 func (v *numberSchema) parseConstraints(constraints map[string]json.RawMessage) error {
 	if rawChoices, ok := constraints["choices"]; ok {
-		var choices []float64
-		err := json.Unmarshal(rawChoices, &choices)
+		choices, descriptions, err := parseChoices[float64](rawChoices)
 		if err != nil {
 			return fmt.Errorf(`cannot parse "choices" constraint: %v`, err)
 		}
@@ -1000,6 +1491,7 @@ func (v *numberSchema) parseConstraints(constraints map[string]json.RawMessage)
 		}
 
 		v.choices = choices
+		v.descriptions = descriptions
 	}
 
 	if rawMin, ok := constraints["min"]; ok {
@@ -1035,7 +1527,9 @@ func (v *numberSchema) parseConstraints(constraints map[string]json.RawMessage)
 
 func (v *numberSchema) expectsConstraints() bool { return false }
 
-type booleanSchema struct{}
+type booleanSchema struct {
+	schemaDefault
+}
 
 func (v *booleanSchema) Validate(raw []byte) (err error) {
 	defer func() {
@@ -1083,6 +1577,8 @@ func (v *booleanSchema) parseConstraints(map[string]json.RawMessage) error {
 func (v *booleanSchema) expectsConstraints() bool { return false }
 
 type arraySchema struct {
+	schemaDefault
+
 	// topSchema is the schema for the top-level schema which contains the aliases.
 	topSchema *StorageSchema
 
@@ -2339,3 +2339,409 @@ func (*schemaSuite) TestSchemaAtAnyAcceptsLongerPath(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(schemas, NotNil)
 }
+
+func (*schemaSuite) TestDefaultMustBeValid(c *C) {
+	type testcase struct {
+		typeDef string
+		err     string
+	}
+
+	tcs := []testcase{
+		{
+			typeDef: `{"type": "string", "default": 1}`,
+			err:     `cannot parse "default" constraint: cannot accept top level element: expected string type but value was number`,
+		},
+		{
+			typeDef: `{"type": "string", "choices": ["a", "b"], "default": "c"}`,
+			err:     `cannot parse "default" constraint: cannot accept top level element: string "c" is not one of the allowed choices`,
+		},
+		{
+			typeDef: `{"type": "int", "min": 1, "default": 0}`,
+			err:     `cannot parse "default" constraint: cannot accept top level element: 0 is less than the allowed minimum 1`,
+		},
+		{
+			typeDef: `{"type": "bool", "default": null}`,
+			err:     `cannot parse "default" constraint: cannot accept top level element: cannot accept null value for "bool" type`,
+		},
+		{
+			typeDef: `{"schema": {"bar": "int"}, "default": {"baz": 1}}`,
+			err:     `cannot parse "default" constraint: cannot accept top level element: map contains unexpected key "baz"`,
+		},
+		{
+			typeDef: `{"type": "$my-type", "default": "foo"}`,
+			err:     `cannot use "default" constraint in alias reference`,
+		},
+	}
+
+	for _, tc := range tcs {
+		schemaStr := []byte(fmt.Sprintf(`{
+	"aliases": {
+		"my-type": "string"
+	},
+	"schema": {
+		"foo": %s
+	}
+}`, tc.typeDef))
+
+		_, err := confdb.ParseSchema(schemaStr)
+		c.Check(err, ErrorMatches, tc.err, Commentf("%s", tc.typeDef))
+	}
+}
+
+func (*schemaSuite) TestDefaultOfEachType(c *C) {
+	schemaStr := []byte(`{
+	"aliases": {
+		"my-type": {
+			"type": "string",
+			"default": "alias-default"
+		}
+	},
+	"schema": {
+		"str": {"type": "string", "default": "foo"},
+		"int": {"type": "int", "default": 1},
+		"num": {"type": "number", "default": 1.5},
+		"bool": {"type": "bool", "default": true},
+		"arr": {"type": "array", "values": "string", "default": ["a", "b"]},
+		"any": {"type": "any", "default": {"a": 1}},
+		"map": {"schema": {"a": "string"}, "default": {"a": "b"}},
+		"alias": "$my-type"
+	}
+}`)
+
+	_, err := confdb.ParseSchema(schemaStr)
+	c.Assert(err, IsNil)
+}
+
+func (*schemaSuite) TestChoicesWithDescriptions(c *C) {
+	schemaStr := []byte(`{
+	"schema": {
+		"security": {
+			"type": "string",
+			"choices": [
+				{"value": "wpa2", "description": "WPA2 personal"},
+				{"value": "wpa3", "description": "WPA3 personal"},
+				"none"
+			]
+		},
+		"channel": {
+			"type": "int",
+			"choices": [{"value": 1, "description": "2.412 GHz"}, 6, 11]
+		},
+		"width": {
+			"type": "number",
+			"choices": [{"value": 20, "description": "20 MHz"}, 40.5]
+		}
+	}
+}`)
+
+	schema, err := confdb.ParseSchema(schemaStr)
+	c.Assert(err, IsNil)
+
+	schemas, err := schema.SchemaAt([]string{"security"})
+	c.Assert(err, IsNil)
+	c.Assert(schemas, HasLen, 1)
+	c.Check(confdb.StringChoiceDescriptions(schemas[0]), DeepEquals, map[string]string{
+		"wpa2": "WPA2 personal",
+		"wpa3": "WPA3 personal",
+	})
+
+	schemas, err = schema.SchemaAt([]string{"channel"})
+	c.Assert(err, IsNil)
+	c.Assert(schemas, HasLen, 1)
+	c.Check(confdb.IntChoiceDescriptions(schemas[0]), DeepEquals, map[int64]string{1: "2.412 GHz"})
+
+	err = schema.Validate([]byte(`{"security": "wpa3", "channel": 6, "width": 20}`))
+	c.Check(err, IsNil)
+
+	// the described choices are listed when a value is not one of them
+	err = schema.Validate([]byte(`{"security": "wep"}`))
+	c.Check(err, ErrorMatches, `cannot accept element in "security": string "wep" is not one of the allowed choices: "wpa2" \(WPA2 personal\), "wpa3" \(WPA3 personal\), "none"`)
+
+	err = schema.Validate([]byte(`{"channel": 2}`))
+	c.Check(err, ErrorMatches, `cannot accept element in "channel": 2 is not one of the allowed choices: 1 \(2.412 GHz\), 6, 11`)
+
+	err = schema.Validate([]byte(`{"width": 40}`))
+	c.Check(err, ErrorMatches, `cannot accept element in "width": 40 is not one of the allowed choices: 20 \(20 MHz\), 40.5`)
+}
+
+func (*schemaSuite) TestChoicesWithDescriptionsFail(c *C) {
+	type testcase struct {
+		typeDef string
+		err     string
+	}
+
+	tcs := []testcase{
+		{
+			typeDef: `{"type": "string", "choices": [{"description": "foo"}]}`,
+			err:     `cannot parse "choices" constraint: choice must have a "value"`,
+		},
+		{
+			typeDef: `{"type": "string", "choices": [{"value": 1}]}`,
+			err:     `cannot parse "choices" constraint: choice must be a value or an object with "value" and "description": .*`,
+		},
+		{
+			typeDef: `{"type": "int", "choices": ["foo"]}`,
+			err:     `cannot parse "choices" constraint: choice must be a value or an object with "value" and "description": .*`,
+		},
+	}
+
+	for _, tc := range tcs {
+		schemaStr := []byte(fmt.Sprintf(`{"schema": {"foo": %s}}`, tc.typeDef))
+		_, err := confdb.ParseSchema(schemaStr)
+		c.Check(err, ErrorMatches, tc.err, Commentf("%s", tc.typeDef))
+	}
+}
+
+func (*schemaSuite) TestConstraintsCompareEntries(c *C) {
+	schemaStr := []byte(`{
+	"schema": {
+		"min": "int",
+		"max": "int",
+		"name": "string"
+	},
+	"constraints": [
+		"max >= min",
+		"min >= 0",
+		"name != 'not allowed'"
+	]
+}`)
+
+	schema, err := confdb.ParseSchema(schemaStr)
+	c.Assert(err, IsNil)
+
+	type testcase struct {
+		input string
+		err   string
+	}
+
+	tcs := []testcase{
+		{input: `{"min": 1, "max": 2}`},
+		{input: `{"min": 2, "max": 2}`},
+		// constraints hold if an entry isn't set
+		{input: `{"max": -1}`},
+		{input: `{"name": "allowed"}`},
+		{
+			input: `{"min": 3, "max": 2}`,
+			err:   `cannot accept top level element: constraint "max >= min" is not satisfied`,
+		},
+		{
+			input: `{"min": -1}`,
+			err:   `cannot accept top level element: constraint "min >= 0" is not satisfied`,
+		},
+		{
+			input: `{"name": "not allowed"}`,
+			err:   `cannot accept top level element: constraint "name != 'not allowed'" is not satisfied`,
+		},
+	}
+
+	for _, tc := range tcs {
+		err := schema.Validate([]byte(tc.input))
+		if tc.err == "" {
+			c.Check(err, IsNil, Commentf("%s", tc.input))
+		} else {
+			c.Check(err, ErrorMatches, tc.err, Commentf("%s", tc.input))
+		}
+	}
+}
+
+func (*schemaSuite) TestConstraintsRequiresExcludes(c *C) {
+	schemaStr := []byte(`{
+	"schema": {
+		"wifi": {
+			"schema": {
+				"ssid": "string",
+				"psk": "string",
+				"open": "bool"
+			},
+			"constraints": [
+				"psk requires ssid",
+				"open excludes psk",
+				"open != false"
+			]
+		}
+	}
+}`)
+
+	schema, err := confdb.ParseSchema(schemaStr)
+	c.Assert(err, IsNil)
+
+	type testcase struct {
+		input string
+		err   string
+	}
+
+	tcs := []testcase{
+		{input: `{"wifi": {"ssid": "foo", "psk": "bar"}}`},
+		{input: `{"wifi": {"ssid": "foo", "open": true}}`},
+		{
+			input: `{"wifi": {"psk": "bar"}}`,
+			err:   `cannot accept element in "wifi": constraint "psk requires ssid" is not satisfied: "psk" is set but "ssid" is not`,
+		},
+		{
+			input: `{"wifi": {"ssid": "foo", "psk": "bar", "open": true}}`,
+			err:   `cannot accept element in "wifi": constraint "open excludes psk" is not satisfied: "open" and "psk" cannot both be set`,
+		},
+		{
+			input: `{"wifi": {"open": false}}`,
+			err:   `cannot accept element in "wifi": constraint "open != false" is not satisfied`,
+		},
+	}
+
+	for _, tc := range tcs {
+		err := schema.Validate([]byte(tc.input))
+		if tc.err == "" {
+			c.Check(err, IsNil, Commentf("%s", tc.input))
+		} else {
+			c.Check(err, ErrorMatches, tc.err, Commentf("%s", tc.input))
+		}
+	}
+}
+
+func (*schemaSuite) TestConstraintsRequiresExcludesIgnoreDefaults(c *C) {
+	schemaStr := []byte(`{
+	"schema": {
+		"wifi": {
+			"schema": {
+				"ssid": {"type": "string", "default": "default-ssid"},
+				"psk": "string",
+				"open": {"type": "bool", "default": true}
+			},
+			"constraints": [
+				"psk requires ssid",
+				"open excludes psk"
+			]
+		}
+	}
+}`)
+
+	schema, err := confdb.ParseSchema(schemaStr)
+	c.Assert(err, IsNil)
+
+	// only the stored entries count, not the defaulted ones
+	err = schema.Validate([]byte(`{"wifi": {"psk": "bar"}}`))
+	c.Check(err, ErrorMatches, `cannot accept element in "wifi": constraint "psk requires ssid" is not satisfied: "psk" is set but "ssid" is not`)
+
+	err = schema.Validate([]byte(`{"wifi": {"ssid": "foo", "psk": "bar"}}`))
+	c.Check(err, IsNil)
+
+	err = schema.Validate([]byte(`{"wifi": {"ssid": "foo", "psk": "bar", "open": true}}`))
+	c.Check(err, ErrorMatches, `cannot accept element in "wifi": constraint "open excludes psk" is not satisfied: "open" and "psk" cannot both be set`)
+}
+
+func (*schemaSuite) TestConstraintsNestedPathsAndDefaults(c *C) {
+	schemaStr := []byte(`{
+	"schema": {
+		"limits": {
+			"schema": {
+				"low": {"type": "number", "default": 10},
+				"high": "number"
+			}
+		},
+		"threshold": "number"
+	},
+	"constraints": [
+		"threshold >= limits.low",
+		"threshold <= limits.high"
+	]
+}`)
+
+	schema, err := confdb.ParseSchema(schemaStr)
+	c.Assert(err, IsNil)
+
+	err = schema.Validate([]byte(`{"threshold": 15, "limits": {"high": 20}}`))
+	c.Check(err, IsNil)
+
+	// the default is used if the entry isn't set
+	err = schema.Validate([]byte(`{"threshold": 5}`))
+	c.Check(err, ErrorMatches, `cannot accept top level element: constraint "threshold >= limits.low" is not satisfied`)
+
+	err = schema.Validate([]byte(`{"threshold": 5, "limits": {"low": 1}}`))
+	c.Check(err, IsNil)
+
+	err = schema.Validate([]byte(`{"threshold": 25, "limits": {"high": 20}}`))
+	c.Check(err, ErrorMatches, `cannot accept top level element: constraint "threshold <= limits.high" is not satisfied`)
+}
+
+func (*schemaSuite) TestConstraintsCannotCompareTypes(c *C) {
+	schemaStr := []byte(`{
+	"schema": {
+		"foo": ["int", "string"],
+		"bar": "int"
+	},
+	"constraints": ["foo > bar"]
+}`)
+
+	schema, err := confdb.ParseSchema(schemaStr)
+	c.Assert(err, IsNil)
+
+	err = schema.Validate([]byte(`{"foo": 2, "bar": 1}`))
+	c.Check(err, IsNil)
+
+	err = schema.Validate([]byte(`{"foo": "a", "bar": 1}`))
+	c.Check(err, ErrorMatches, `cannot accept top level element: cannot check constraint "foo > bar": cannot compare string and number values`)
+}
+
+func (*schemaSuite) TestConstraintsParseFail(c *C) {
+	type testcase struct {
+		constraints string
+		err         string
+	}
+
+	tcs := []testcase{
+		{
+			constraints: `"foo >= bar"`,
+			err:         `cannot parse map's "constraints" constraint: json: cannot unmarshal string into Go value of type \[\]string`,
+		},
+		{
+			constraints: `["foo >="]`,
+			err:         `cannot parse map's "constraints" constraint: cannot parse constraint "foo >=": must be "<key> <operator> <operand>"`,
+		},
+		{
+			constraints: `["foo => bar"]`,
+			err:         `cannot parse map's "constraints" constraint: cannot parse constraint "foo => bar": unknown operator "=>"`,
+		},
+		{
+			constraints: `["baz >= bar"]`,
+			err:         `cannot parse map's "constraints" constraint: cannot parse constraint "baz >= bar": cannot use key "baz": cannot use "baz" as key in map`,
+		},
+		{
+			constraints: `["foo >= Bar"]`,
+			err:         `cannot parse map's "constraints" constraint: cannot parse constraint "foo >= Bar": invalid key "Bar"`,
+		},
+		{
+			constraints: `["foo requires 1"]`,
+			err:         `cannot parse map's "constraints" constraint: cannot parse constraint "foo requires 1": invalid key "1"`,
+		},
+		{
+			constraints: `["foo < true"]`,
+			err:         `cannot parse map's "constraints" constraint: cannot parse constraint "foo < true": cannot use operator "<" with bool values`,
+		},
+	}
+
+	for _, tc := range tcs {
+		schemaStr := []byte(fmt.Sprintf(`{
+	"schema": {
+		"foo": "int",
+		"bar": "int"
+	},
+	"constraints": %s
+}`, tc.constraints))
+
+		_, err := confdb.ParseSchema(schemaStr)
+		c.Check(err, ErrorMatches, tc.err, Commentf("%s", tc.constraints))
+	}
+}
+
+func (*schemaSuite) TestConstraintsWithoutSchema(c *C) {
+	schemaStr := []byte(`{
+	"schema": {
+		"foo": {
+			"values": "int",
+			"constraints": ["a >= b"]
+		}
+	}
+}`)
+
+	_, err := confdb.ParseSchema(schemaStr)
+	c.Assert(err, ErrorMatches, `cannot parse map: cannot use "constraints" without "schema" constraint`)
+}
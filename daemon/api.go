@@ -68,6 +68,7 @@ var api = []*Command{
 	debugCmd,
 	snapshotCmd,
 	snapshotExportCmd,
+	snapshotRemoteCmd,
 	connectionsCmd,
 	modelCmd,
 	cohortsCmd,
@@ -83,12 +84,14 @@ var api = []*Command{
 	quotaGroupsCmd,
 	quotaGroupInfoCmd,
 	confdbCmd,
+	confdbHistoryCmd,
 	noticesCmd,
 	noticeCmd,
 	requestsPromptsCmd,
 	requestsPromptCmd,
 	requestsRulesCmd,
 	requestsRuleCmd,
+	requestsAuditCmd,
 }
 
 const (
@@ -175,6 +178,8 @@ var (
 	confdbstateGetTransaction = confdbstate.GetTransactionToModify
 	confdbstateGet            = confdbstate.Get
 	confdbstateSetViaView     = confdbstate.SetViaView
+	confdbstateHistory        = confdbstate.History
+	confdbstateRollback       = confdbstate.Rollback
 )
 
 func ensureStateSoonImpl(st *state.State) {
@@ -90,6 +90,7 @@ type apiBaseSuite struct {
 	SysctlBufs        [][]byte
 
 	connectivityResult map[string]bool
+	deltaStats         store.DeltaStats
 
 	restoreSanitize func()
 	restoreMuxVars  func()
@@ -166,6 +167,10 @@ func (s *apiBaseSuite) ConnectivityCheck() (map[string]bool, error) {
 	return s.connectivityResult, s.err
 }
 
+func (s *apiBaseSuite) DeltaStats() store.DeltaStats {
+	return s.deltaStats
+}
+
 func (s *apiBaseSuite) muxVars(*http.Request) map[string]string {
 	return s.vars
 }
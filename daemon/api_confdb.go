@@ -27,6 +27,7 @@ import (
 	"github.com/snapcore/snapd/confdb"
 	"github.com/snapcore/snapd/features"
 	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/confdbstate"
 	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/strutil"
@@ -40,6 +41,14 @@ var (
 		ReadAccess:  authenticatedAccess{Polkit: polkitActionManage},
 		WriteAccess: authenticatedAccess{Polkit: polkitActionManage},
 	}
+
+	confdbHistoryCmd = &Command{
+		Path:        "/v2/confdbs/{account}/{confdb}",
+		GET:         getConfdbHistory,
+		POST:        postConfdbAction,
+		ReadAccess:  authenticatedAccess{Polkit: polkitActionManage},
+		WriteAccess: authenticatedAccess{Polkit: polkitActionManage},
+	}
 )
 
 func getView(c *Command, r *http.Request, _ *auth.UserState) Response {
@@ -109,6 +118,70 @@ func setView(c *Command, r *http.Request, _ *auth.UserState) Response {
 	return AsyncResponse(nil, changeID)
 }
 
+func getConfdbHistory(c *Command, r *http.Request, _ *auth.UserState) Response {
+	st := c.d.state
+	st.Lock()
+	defer st.Unlock()
+
+	if err := validateConfdbFeatureFlag(st); err != nil {
+		return err
+	}
+
+	vars := muxVars(r)
+	account, confdbName := vars["account"], vars["confdb"]
+
+	revs, err := confdbstateHistory(st, account, confdbName)
+	if err != nil {
+		return toAPIError(err)
+	}
+
+	if len(revs) == 0 {
+		revs = []*confdbstate.Revision{}
+	}
+
+	return SyncResponse(revs)
+}
+
+type confdbAction struct {
+	Action   string `json:"action"`
+	Revision int    `json:"revision"`
+}
+
+func postConfdbAction(c *Command, r *http.Request, _ *auth.UserState) Response {
+	st := c.d.state
+	st.Lock()
+	defer st.Unlock()
+
+	if err := validateConfdbFeatureFlag(st); err != nil {
+		return err
+	}
+
+	vars := muxVars(r)
+	account, confdbName := vars["account"], vars["confdb"]
+
+	var action confdbAction
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&action); err != nil {
+		return BadRequest("cannot decode confdb action: %v", err)
+	}
+
+	switch action.Action {
+	case "rollback":
+		if action.Revision <= 0 {
+			return BadRequest("cannot rollback confdb: invalid revision %d", action.Revision)
+		}
+
+		chg, err := confdbstateRollback(st, account, confdbName, action.Revision)
+		if err != nil {
+			return toAPIError(err)
+		}
+
+		return AsyncResponse(nil, chg.ID())
+	default:
+		return BadRequest("unknown confdb action %q", action.Action)
+	}
+}
+
 func toAPIError(err error) *apiError {
 	switch {
 	case errors.Is(err, &confdb.NotFoundError{}):
@@ -621,3 +621,91 @@ func (s *confdbSuite) TestGetNoFields(c *C) {
 	c.Check(rspe.Status, Equals, 200)
 	c.Check(rspe.Result, DeepEquals, value)
 }
+
+func (s *confdbSuite) TestGetHistory(c *C) {
+	s.setFeatureFlag(c)
+
+	revs := []*confdbstate.Revision{
+		{Revision: 1, Snap: "custodian-snap", View: "wifi-setup", Changes: []map[string]interface{}{{"wifi.ssid": "foo"}}},
+		{Revision: 2, View: "wifi-setup", RollbackTo: 1},
+	}
+	var calls int
+	restore := daemon.MockConfdbstateHistory(func(_ *state.State, account, confdbName string) ([]*confdbstate.Revision, error) {
+		calls++
+		c.Check(account, Equals, "system")
+		c.Check(confdbName, Equals, "network")
+		return revs, nil
+	})
+	defer restore()
+
+	req, err := http.NewRequest("GET", "/v2/confdbs/system/network", nil)
+	c.Assert(err, IsNil)
+
+	rsp := s.syncReq(c, req, nil)
+	c.Check(rsp.Status, Equals, 200)
+	c.Check(rsp.Result, DeepEquals, revs)
+	c.Check(calls, Equals, 1)
+
+	// no history is returned as an empty list
+	revs = nil
+	rsp = s.syncReq(c, req, nil)
+	c.Check(rsp.Status, Equals, 200)
+	c.Check(rsp.Result, DeepEquals, []*confdbstate.Revision{})
+}
+
+func (s *confdbSuite) TestRollback(c *C) {
+	s.setFeatureFlag(c)
+
+	var calls int
+	restore := daemon.MockConfdbstateRollback(func(st *state.State, account, confdbName string, revision int) (*state.Change, error) {
+		calls++
+		c.Check(account, Equals, "system")
+		c.Check(confdbName, Equals, "network")
+		c.Check(revision, Equals, 2)
+		return st.NewChange("rollback-confdb", ""), nil
+	})
+	defer restore()
+
+	buf := bytes.NewBufferString(`{"action": "rollback", "revision": 2}`)
+	req, err := http.NewRequest("POST", "/v2/confdbs/system/network", buf)
+	c.Assert(err, IsNil)
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp := s.asyncReq(c, req, nil)
+	c.Check(rsp.Status, Equals, 202)
+	c.Check(calls, Equals, 1)
+
+	s.st.Lock()
+	chg := s.st.Change(rsp.Change)
+	s.st.Unlock()
+	c.Assert(chg, NotNil)
+	c.Check(chg.Kind(), Equals, "rollback-confdb")
+}
+
+func (s *confdbSuite) TestRollbackErrors(c *C) {
+	s.setFeatureFlag(c)
+
+	restore := daemon.MockConfdbstateRollback(func(*state.State, string, string, int) (*state.Change, error) {
+		return nil, confdb.NewNotFoundError("cannot find revision 3 of confdb system/network")
+	})
+	defer restore()
+
+	for _, tc := range []struct {
+		body   string
+		status int
+		msg    string
+	}{
+		{body: `{`, status: 400, msg: "cannot decode confdb action: .*"},
+		{body: `{"action": "foo"}`, status: 400, msg: `unknown confdb action "foo"`},
+		{body: `{"action": "rollback"}`, status: 400, msg: "cannot rollback confdb: invalid revision 0"},
+		{body: `{"action": "rollback", "revision": 3}`, status: 404, msg: "cannot find revision 3 of confdb system/network"},
+	} {
+		req, err := http.NewRequest("POST", "/v2/confdbs/system/network", bytes.NewBufferString(tc.body))
+		c.Assert(err, IsNil)
+		req.Header.Set("Content-Type", "application/json")
+
+		rspe := s.errorReq(c, req, nil)
+		c.Check(rspe.Status, Equals, tc.status, Commentf("body: %s", tc.body))
+		c.Check(rspe.Message, Matches, tc.msg, Commentf("body: %s", tc.body))
+	}
+}
@@ -34,6 +34,7 @@ import (
 	"github.com/snapcore/snapd/overlord/devicestate"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/store"
 	"github.com/snapcore/snapd/timings"
 )
 
@@ -92,6 +93,20 @@ func checkConnectivity(st *state.State) Response {
 	return SyncResponse(status)
 }
 
+// deltaStatsStore is implemented by the stores which keep counters about the
+// use of deltas.
+type deltaStatsStore interface {
+	DeltaStats() store.DeltaStats
+}
+
+func getDeltaStats(st *state.State) Response {
+	sto, ok := snapstate.Store(st, nil).(deltaStatsStore)
+	if !ok {
+		return InternalError("cannot get delta statistics from the store")
+	}
+	return SyncResponse(sto.DeltaStats())
+}
+
 type changeTimings struct {
 	Status         string                `json:"status,omitempty"`
 	Kind           string                `json:"kind,omitempty"`
@@ -349,6 +364,8 @@ func getDebug(c *Command, r *http.Request, user *auth.UserState) Response {
 		return getBaseDeclaration(st)
 	case "connectivity":
 		return checkConnectivity(st)
+	case "delta-stats":
+		return getDeltaStats(st)
 	case "model":
 		model, err := c.d.overlord.DeviceManager().Model()
 		if err != nil {
@@ -30,8 +30,11 @@ import (
 
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/daemon"
+	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/store"
+	"github.com/snapcore/snapd/store/storetest"
 	"github.com/snapcore/snapd/testutil"
 	"github.com/snapcore/snapd/timings"
 )
@@ -99,6 +102,34 @@ func (s *postDebugSuite) TestDebugConnectivityUnhappy(c *check.C) {
 	})
 }
 
+func (s *postDebugSuite) TestDebugDeltaStats(c *check.C) {
+	_ = s.daemon(c)
+
+	s.deltaStats = store.DeltaStats{Applied: 3, Failed: 1, BytesSaved: 4096}
+
+	req, err := http.NewRequest("GET", "/v2/debug?aspect=delta-stats", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := s.syncReq(c, req, nil)
+	c.Check(rsp.Result, check.DeepEquals, store.DeltaStats{Applied: 3, Failed: 1, BytesSaved: 4096})
+}
+
+func (s *postDebugSuite) TestDebugDeltaStatsUnsupportedStore(c *check.C) {
+	d := s.daemon(c)
+
+	st := d.Overlord().State()
+	st.Lock()
+	snapstate.ReplaceStore(st, &storetest.Store{})
+	st.Unlock()
+
+	req, err := http.NewRequest("GET", "/v2/debug?aspect=delta-stats", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := s.errorReq(c, req, nil)
+	c.Check(rsp.Status, check.Equals, 500)
+	c.Check(rsp.Message, check.Equals, "cannot get delta statistics from the store")
+}
+
 func (s *postDebugSuite) TestGetDebugBaseDeclaration(c *check.C) {
 	_ = s.daemon(c)
 
@@ -24,6 +24,7 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"net/url"
 	"sort"
 	"time"
 
@@ -35,6 +36,7 @@ import (
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/changearchive"
 	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/devicestate"
 	"github.com/snapcore/snapd/overlord/snapstate"
@@ -223,6 +225,10 @@ func getChanges(c *Command, r *http.Request, user *auth.UserState) Response {
 	if qselect == "" {
 		qselect = "in-progress"
 	}
+	if query.Get("archived") == "true" {
+		return getArchivedChanges(c.d.overlord.State(), query)
+	}
+
 	var filter func(*state.Change) bool
 	switch qselect {
 	case "all":
@@ -324,6 +330,8 @@ type changeInfo struct {
 	SpawnTime time.Time  `json:"spawn-time,omitempty"`
 	ReadyTime *time.Time `json:"ready-time,omitempty"`
 
+	RequestedBy *uint32 `json:"requested-by,omitempty"`
+
 	Data map[string]*json.RawMessage `json:"data,omitempty"`
 }
 
@@ -400,6 +408,74 @@ func change2changeInfo(chg *state.Change) *changeInfo {
 		chgInfo.Data = data
 	}
 
+	var uid uint32
+	if chg.Get(changearchive.RequestedByKey, &uid) == nil {
+		chgInfo.RequestedBy = &uid
+	}
+
+	return chgInfo
+}
+
+func getArchivedChanges(st *state.State, query url.Values) Response {
+	filter := &changearchive.Filter{
+		Kind:     query.Get("kind"),
+		SnapName: query.Get("for"),
+		Status:   query.Get("status"),
+	}
+	for _, bound := range []struct {
+		name string
+		t    *time.Time
+	}{{"after", &filter.After}, {"before", &filter.Before}} {
+		if v := query.Get(bound.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return BadRequest("invalid %q parameter: %v", bound.name, err)
+			}
+			*bound.t = t
+		}
+	}
+
+	archived, err := changearchive.Changes(st, filter)
+	if err != nil {
+		return InternalError("%v", err)
+	}
+	chgInfos := make([]*changeInfo, 0, len(archived))
+	for _, ach := range archived {
+		chgInfos = append(chgInfos, archivedChange2changeInfo(ach))
+	}
+	return SyncResponse(chgInfos)
+}
+
+func archivedChange2changeInfo(ach *changearchive.Change) *changeInfo {
+	readyTime := ach.ReadyTime
+	chgInfo := &changeInfo{
+		ID:          ach.ID,
+		Kind:        ach.Kind,
+		Summary:     ach.Summary,
+		Status:      ach.Status,
+		Ready:       true,
+		Err:         ach.Err,
+		SpawnTime:   ach.SpawnTime,
+		ReadyTime:   &readyTime,
+		RequestedBy: ach.RequestedBy,
+		Data:        ach.APIData,
+	}
+	chgInfo.Tasks = make([]*taskInfo, len(ach.Tasks))
+	for i, t := range ach.Tasks {
+		taskInfo := &taskInfo{
+			ID:        t.ID,
+			Kind:      t.Kind,
+			Summary:   t.Summary,
+			Status:    t.Status,
+			Log:       t.Log,
+			SpawnTime: t.SpawnTime,
+		}
+		if !t.ReadyTime.IsZero() {
+			readyTime := t.ReadyTime
+			taskInfo.ReadyTime = &readyTime
+		}
+		chgInfo.Tasks[i] = taskInfo
+	}
 	return chgInfo
 }
 
@@ -27,6 +27,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"time"
 
 	"gopkg.in/check.v1"
@@ -544,6 +545,86 @@ func (s *generalSuite) TestStateChangesReady(c *check.C) {
 	c.Check(string(res), check.Matches, `.*{"id":"\w+","kind":"remove","summary":"remove..","status":"Error","tasks":\[{"id":"\w+","kind":"unlink","summary":"1...","status":"Error","log":\["2016-04-21T01:02:03Z ERROR rm failed"],"progress":{"label":"","done":1,"total":1},"spawn-time":"2016-04-21T01:02:03Z","ready-time":"2016-04-21T01:02:03Z"}.*],"ready":true,"err":"[^"]+".*`)
 }
 
+const archivedChangesJSON = `{"id":"1","kind":"install-snap","summary":"Install \"foo\" snap","status":"Done","spawn-time":"2024-01-02T03:04:05Z","ready-time":"2024-01-02T03:05:05Z","snap-names":["foo"],"requested-by":1000,"api-data":{"snap-names":["foo"]},"tasks":[{"id":"1","kind":"download-snap","summary":"Download","status":"Done","log":["2024-01-02T03:05:00Z INFO done"],"spawn-time":"2024-01-02T03:04:05Z","ready-time":"2024-01-02T03:05:00Z"}]}
+{"id":"2","kind":"remove-snap","summary":"Remove \"bar\" snap","status":"Error","err":"cannot remove","spawn-time":"2024-02-02T03:04:05Z","ready-time":"2024-02-02T03:05:05Z","snap-names":["bar"]}
+{"id":"3","kind":"refresh-snap","summary":"Refresh \"foo\" snap","status":"Done","spawn-time":"2024-03-02T03:04:05Z","ready-time":"2024-03-02T03:05:05Z","snap-names":["foo"]}
+`
+
+func (s *generalSuite) TestStateChangesArchived(c *check.C) {
+	s.expectChangesReadAccess()
+	s.daemon(c)
+	c.Assert(os.WriteFile(dirs.SnapChangeArchiveFile, []byte(archivedChangesJSON), 0600), check.IsNil)
+
+	req, err := http.NewRequest("GET", "/v2/changes?archived=true&for=foo&before=2024-03-01T00:00:00Z", nil)
+	c.Assert(err, check.IsNil)
+	rsp := s.syncReq(c, req, nil)
+	c.Assert(rsp.Result, check.FitsTypeOf, []*daemon.ChangeInfo(nil))
+	res := rsp.Result.([]*daemon.ChangeInfo)
+	c.Assert(res, check.HasLen, 1)
+
+	rec := httptest.NewRecorder()
+	rsp.ServeHTTP(rec, nil)
+	c.Assert(rec.Code, check.Equals, 200)
+	var body map[string]interface{}
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &body), check.IsNil)
+	c.Check(body["result"], check.DeepEquals, []interface{}{
+		map[string]interface{}{
+			"id":           "1",
+			"kind":         "install-snap",
+			"summary":      `Install "foo" snap`,
+			"status":       "Done",
+			"ready":        true,
+			"spawn-time":   "2024-01-02T03:04:05Z",
+			"ready-time":   "2024-01-02T03:05:05Z",
+			"requested-by": 1000.,
+			"data":         map[string]interface{}{"snap-names": []interface{}{"foo"}},
+			"tasks": []interface{}{
+				map[string]interface{}{
+					"id":         "1",
+					"kind":       "download-snap",
+					"summary":    "Download",
+					"status":     "Done",
+					"log":        []interface{}{"2024-01-02T03:05:00Z INFO done"},
+					"progress":   map[string]interface{}{"label": "", "done": 0., "total": 0.},
+					"spawn-time": "2024-01-02T03:04:05Z",
+					"ready-time": "2024-01-02T03:05:00Z",
+				},
+			},
+		},
+	})
+
+	for _, tc := range []struct {
+		query string
+		ids   []string
+	}{
+		{"", []string{"1", "2", "3"}},
+		{"&kind=remove-snap", []string{"2"}},
+		{"&status=Done", []string{"1", "3"}},
+		{"&after=2024-02-02T03:04:05Z", []string{"2", "3"}},
+		{"&for=baz", nil},
+	} {
+		req, err := http.NewRequest("GET", "/v2/changes?archived=true"+tc.query, nil)
+		c.Assert(err, check.IsNil)
+		rsp := s.syncReq(c, req, nil)
+		var ids []string
+		for _, chg := range rsp.Result.([]*daemon.ChangeInfo) {
+			ids = append(ids, chg.ID)
+		}
+		c.Check(ids, check.DeepEquals, tc.ids, check.Commentf(tc.query))
+	}
+}
+
+func (s *generalSuite) TestStateChangesArchivedBadTime(c *check.C) {
+	s.expectChangesReadAccess()
+	s.daemon(c)
+
+	req, err := http.NewRequest("GET", "/v2/changes?archived=true&after=yesterday", nil)
+	c.Assert(err, check.IsNil)
+	rspe := s.errorReq(c, req, nil)
+	c.Check(rspe.Status, check.Equals, 400)
+	c.Check(rspe.Message, check.Matches, `invalid "after" parameter: .*`)
+}
+
 func (s *generalSuite) TestStateChangesForSnapName(c *check.C) {
 	restore := state.MockTime(time.Date(2016, 04, 21, 1, 2, 3, 0, time.UTC))
 	defer restore()
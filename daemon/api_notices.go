@@ -24,7 +24,9 @@ import (
 	"strconv"
 
 	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/interfaces"
 	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/ifacestate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/snap/naming"
 	"github.com/snapcore/snapd/strutil"
@@ -36,6 +38,7 @@ var noticeReadInterfaces = map[state.NoticeType][]string{
 	state.SnapRunInhibitNotice:               {"snap-refresh-observe"},
 	state.InterfacesRequestsPromptNotice:     {"snap-interfaces-requests-control"},
 	state.InterfacesRequestsRuleUpdateNotice: {"snap-interfaces-requests-control"},
+	state.ConfdbChangedNotice:                {"confdb"},
 }
 
 var (
@@ -43,14 +46,14 @@ var (
 		Path:        "/v2/notices",
 		GET:         getNotices,
 		POST:        postNotices,
-		ReadAccess:  interfaceOpenAccess{Interfaces: []string{"snap-refresh-observe", "snap-interfaces-requests-control"}},
+		ReadAccess:  interfaceOpenAccess{Interfaces: []string{"snap-refresh-observe", "snap-interfaces-requests-control", "confdb"}},
 		WriteAccess: openAccess{},
 	}
 
 	noticeCmd = &Command{
 		Path:       "/v2/notices/{id}",
 		GET:        getNotice,
-		ReadAccess: interfaceOpenAccess{Interfaces: []string{"snap-refresh-observe", "snap-interfaces-requests-control"}},
+		ReadAccess: interfaceOpenAccess{Interfaces: []string{"snap-refresh-observe", "snap-interfaces-requests-control", "confdb"}},
 	}
 )
 
@@ -128,6 +131,11 @@ func getNotices(c *Command, r *http.Request, user *auth.UserState) Response {
 	st.Lock()
 	defer st.Unlock()
 
+	filter.TypeKeys, err = noticeKeysViewableBySnap(st, r)
+	if err != nil {
+		return InternalError("cannot determine notices viewable by snap: %v", err)
+	}
+
 	var notices []*state.Notice
 
 	if timeout != 0 {
@@ -329,6 +337,13 @@ func getNotice(c *Command, r *http.Request, user *auth.UserState) Response {
 	if !noticeTypesViewableBySnap([]state.NoticeType{notice.Type()}, r) {
 		return Forbidden("not allowed to access notice with id %q", noticeID)
 	}
+	typeKeys, err := noticeKeysViewableBySnap(st, r)
+	if err != nil {
+		return InternalError("cannot determine notices viewable by snap: %v", err)
+	}
+	if keys, ok := typeKeys[notice.Type()]; ok && !strutil.ListContains(keys, notice.Key()) {
+		return Forbidden("not allowed to access notice with id %q", noticeID)
+	}
 	return SyncResponse(notice)
 }
 
@@ -377,3 +392,52 @@ InterfaceTypeLoop:
 	}
 	return true
 }
+
+// noticeKeysViewableBySnap returns, by notice type, the keys of the notices
+// the snap making the request is restricted to: snaps can only read the
+// confdb-changed notices of the views referenced by their connected confdb
+// plugs. Nothing is returned for requests not coming from snapd-snap.socket.
+// It must be called with the state locked.
+func noticeKeysViewableBySnap(st *state.State, r *http.Request) (map[state.NoticeType][]string, error) {
+	ucred, ifaces, err := ucrednetGetWithInterfaces(r.RemoteAddr)
+	if err != nil {
+		return nil, err
+	}
+	if ucred.Socket == dirs.SnapdSocket || !strutil.ListContains(ifaces, "confdb") {
+		// either all notices are viewable or, without a connected confdb
+		// plug, confdb-changed notices are not viewable at all
+		return nil, nil
+	}
+
+	snapName, err := cgroupSnapNameFromPid(int(ucred.Pid))
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine snap name for pid: %v", err)
+	}
+	conns, err := ifacestate.ConnectionStates(st)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get connections: %v", err)
+	}
+
+	// the keys of confdb-changed notices are <account>/<confdb>/<view>
+	// and the view attribute of confdb plugs is <confdb>/<view>
+	var keys []string
+	for refStr, connState := range conns {
+		if !connState.Active() || connState.Interface != "confdb" {
+			continue
+		}
+		connRef, err := interfaces.ParseConnRef(refStr)
+		if err != nil {
+			return nil, err
+		}
+		if connRef.PlugRef.Snap != snapName {
+			continue
+		}
+		account, _ := connState.StaticPlugAttrs["account"].(string)
+		view, _ := connState.StaticPlugAttrs["view"].(string)
+		if account == "" || view == "" {
+			continue
+		}
+		keys = append(keys, account+"/"+view)
+	}
+	return map[state.NoticeType][]string{state.ConfdbChangedNotice: keys}, nil
+}
@@ -46,7 +46,7 @@ type noticesSuite struct {
 func (s *noticesSuite) SetUpTest(c *C) {
 	s.apiBaseSuite.SetUpTest(c)
 
-	s.expectReadAccess(daemon.InterfaceOpenAccess{Interfaces: []string{"snap-refresh-observe", "snap-interfaces-requests-control"}})
+	s.expectReadAccess(daemon.InterfaceOpenAccess{Interfaces: []string{"snap-refresh-observe", "snap-interfaces-requests-control", "confdb"}})
 	s.expectWriteAccess(daemon.OpenAccess{})
 }
 
@@ -337,6 +337,123 @@ func (s *noticesSuite) TestNoticesFilterTypesForSnap(c *C) {
 	c.Check(seenNoticeType["snap-run-inhibit"], Equals, 1)
 }
 
+func (s *noticesSuite) mockConfdbPlugConnected(c *C) {
+	restore := daemon.MockCgroupSnapNameFromPid(func(pid int) (string, error) {
+		if pid == 100 {
+			return "some-snap", nil
+		}
+		return "", fmt.Errorf("not a snap")
+	})
+	s.AddCleanup(restore)
+
+	st := s.d.Overlord().State()
+	st.Lock()
+	defer st.Unlock()
+	st.Set("conns", map[string]interface{}{
+		"some-snap:setup-wifi core:confdb": map[string]interface{}{
+			"interface": "confdb",
+			"plug-static": map[string]interface{}{
+				"account": "acc",
+				"view":    "network/setup-wifi",
+			},
+		},
+		"other-snap:control-wifi core:confdb": map[string]interface{}{
+			"interface": "confdb",
+			"plug-static": map[string]interface{}{
+				"account": "acc",
+				"view":    "network/control-wifi",
+			},
+		},
+	})
+}
+
+func (s *noticesSuite) TestNoticesConfdbChangedForSnap(c *C) {
+	s.daemon(c)
+	s.mockConfdbPlugConnected(c)
+
+	st := s.d.Overlord().State()
+	st.Lock()
+	root := uint32(0)
+	addNotice(c, st, &root, state.ConfdbChangedNotice, "acc/network/setup-wifi", nil)
+	addNotice(c, st, &root, state.ConfdbChangedNotice, "acc/network/control-wifi", nil)
+	addNotice(c, st, nil, state.ChangeUpdateNotice, "123", nil)
+	st.Unlock()
+
+	// the confdb interface allows accessing the confdb-changed notices of
+	// the views referenced by the snap's connected plugs
+	req, err := http.NewRequest("GET", "/v2/notices", nil)
+	c.Assert(err, IsNil)
+	req.RemoteAddr = fmt.Sprintf("pid=100;uid=0;socket=%s;iface=confdb;", dirs.SnapSocket)
+	rsp := s.syncReq(c, req, nil)
+	c.Check(rsp.Status, Equals, 200)
+	notices, ok := rsp.Result.([]*state.Notice)
+	c.Assert(ok, Equals, true)
+	c.Assert(notices, HasLen, 1)
+	n := noticeToMap(c, notices[0])
+	c.Check(n["type"], Equals, "confdb-changed")
+	c.Check(n["key"], Equals, "acc/network/setup-wifi")
+
+	// even when asking for the keys of other views
+	req, err = http.NewRequest("GET", "/v2/notices?types=confdb-changed&keys=acc/network/control-wifi", nil)
+	c.Assert(err, IsNil)
+	req.RemoteAddr = fmt.Sprintf("pid=100;uid=0;socket=%s;iface=confdb;", dirs.SnapSocket)
+	rsp = s.syncReq(c, req, nil)
+	c.Check(rsp.Status, Equals, 200)
+	c.Check(rsp.Result, HasLen, 0)
+
+	// but the notices are not public
+	req, err = http.NewRequest("GET", "/v2/notices?types=confdb-changed", nil)
+	c.Assert(err, IsNil)
+	req.RemoteAddr = fmt.Sprintf("pid=100;uid=1000;socket=%s;iface=confdb;", dirs.SnapSocket)
+	rsp = s.syncReq(c, req, nil)
+	c.Check(rsp.Status, Equals, 200)
+	c.Check(rsp.Result, HasLen, 0)
+
+	// and other interfaces don't give access to them
+	req, err = http.NewRequest("GET", "/v2/notices?types=confdb-changed", nil)
+	c.Assert(err, IsNil)
+	req.RemoteAddr = fmt.Sprintf("pid=100;uid=0;socket=%s;iface=snap-refresh-observe;", dirs.SnapSocket)
+	errRsp := s.errorReq(c, req, nil)
+	c.Check(errRsp.Status, Equals, 403)
+
+	// while all of them are visible through snapd.socket
+	req, err = http.NewRequest("GET", "/v2/notices?types=confdb-changed", nil)
+	c.Assert(err, IsNil)
+	req.RemoteAddr = fmt.Sprintf("pid=100;uid=0;socket=%s;", dirs.SnapdSocket)
+	rsp = s.syncReq(c, req, nil)
+	c.Check(rsp.Status, Equals, 200)
+	c.Check(rsp.Result, HasLen, 2)
+}
+
+func (s *noticesSuite) TestNoticeConfdbChangedForSnap(c *C) {
+	s.daemon(c)
+	s.mockConfdbPlugConnected(c)
+
+	st := s.d.Overlord().State()
+	st.Lock()
+	root := uint32(0)
+	allowedID, err := st.AddNotice(&root, state.ConfdbChangedNotice, "acc/network/setup-wifi", nil)
+	c.Assert(err, IsNil)
+	otherID, err := st.AddNotice(&root, state.ConfdbChangedNotice, "acc/network/control-wifi", nil)
+	c.Assert(err, IsNil)
+	st.Unlock()
+
+	req, err := http.NewRequest("GET", "/v2/notices/"+allowedID, nil)
+	c.Assert(err, IsNil)
+	req.RemoteAddr = fmt.Sprintf("pid=100;uid=0;socket=%s;iface=confdb;", dirs.SnapSocket)
+	rsp := s.syncReq(c, req, nil)
+	c.Check(rsp.Status, Equals, 200)
+	n := noticeToMap(c, rsp.Result.(*state.Notice))
+	c.Check(n["key"], Equals, "acc/network/setup-wifi")
+
+	req, err = http.NewRequest("GET", "/v2/notices/"+otherID, nil)
+	c.Assert(err, IsNil)
+	req.RemoteAddr = fmt.Sprintf("pid=100;uid=0;socket=%s;iface=confdb;", dirs.SnapSocket)
+	errRsp := s.errorReq(c, req, nil)
+	c.Check(errRsp.Status, Equals, 403)
+	c.Check(errRsp.Message, Equals, fmt.Sprintf("not allowed to access notice with id %q", otherID))
+}
+
 func (s *noticesSuite) TestNoticesFilterTypesForSnapForbidden(c *C) {
 	s.daemon(c)
 
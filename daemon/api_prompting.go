@@ -25,10 +25,12 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/interfaces/prompting"
 	prompting_errors "github.com/snapcore/snapd/interfaces/prompting/errors"
+	"github.com/snapcore/snapd/interfaces/prompting/requestaudit"
 	"github.com/snapcore/snapd/interfaces/prompting/requestprompts"
 	"github.com/snapcore/snapd/interfaces/prompting/requestrules"
 	"github.com/snapcore/snapd/overlord/auth"
@@ -66,6 +68,12 @@ var (
 		ReadAccess:  interfaceOpenAccess{Interfaces: []string{"snap-interfaces-requests-control"}},
 		WriteAccess: interfaceAuthenticatedAccess{Interfaces: []string{"snap-interfaces-requests-control"}, Polkit: polkitActionManage},
 	}
+
+	requestsAuditCmd = &Command{
+		Path:       "/v2/interfaces/requests/audit",
+		GET:        getRequestsAudit,
+		ReadAccess: interfaceOpenAccess{Interfaces: []string{"snap-interfaces-requests-control"}},
+	}
 )
 
 // getUserID returns the UID specified by the user-id parameter of the query,
@@ -266,6 +274,8 @@ func promptingError(err error) *apiError {
 		if errors.As(err, &conflictErr) {
 			apiErr.Value = (*promptingRuleConflictError)(conflictErr)
 		}
+	case errors.Is(err, prompting_errors.ErrNoUserSession):
+		apiErr.Status = 400
 	default:
 		// Treat errors without specific mapping as internal errors.
 		// These include:
@@ -318,9 +328,11 @@ type patchRuleContents struct {
 }
 
 type postRulesRequestBody struct {
-	Action         string               `json:"action"`
-	AddRule        *addRuleContents     `json:"rule,omitempty"`
-	RemoveSelector *removeRulesSelector `json:"selector,omitempty"`
+	Action         string                       `json:"action"`
+	AddRule        *addRuleContents             `json:"rule,omitempty"`
+	RemoveSelector *removeRulesSelector         `json:"selector,omitempty"`
+	ImportRules    []*requestrules.RuleContents `json:"rules,omitempty"`
+	Admin          bool                         `json:"admin,omitempty"`
 }
 
 type postRuleRequestBody struct {
@@ -431,9 +443,22 @@ func getRules(c *Command, r *http.Request, user *auth.UserState) Response {
 	snap := query.Get("snap")
 	iface := query.Get("interface")
 
-	rules, err := getInterfaceManager(c).InterfacesRequestsManager().Rules(userID, snap, iface)
+	var rules []*requestrules.Rule
+	var err error
+	switch query.Get("admin") {
+	case "", "false":
+		rules, err = getInterfaceManager(c).InterfacesRequestsManager().Rules(userID, snap, iface)
+	case "true":
+		if snap != "" || iface != "" {
+			return BadRequest(`cannot use "snap" or "interface" parameters with "admin"`)
+		}
+		rules, err = getInterfaceManager(c).InterfacesRequestsManager().AdminRules()
+	default:
+		return BadRequest(`invalid "admin" parameter: must be "true" or "false"`)
+	}
 	if err != nil {
-		// Should be impossible, Rules() always returns nil error
+		// Should be impossible, Rules() and AdminRules() always return nil
+		// error
 		return promptingError(err)
 	}
 
@@ -482,8 +507,38 @@ func postRules(c *Command, r *http.Request, user *auth.UserState) Response {
 			return promptingError(err)
 		}
 		return SyncResponse(removedRules)
+	case "import":
+		if postBody.ImportRules == nil {
+			return BadRequest(`must include "rules" field in request body when action is "import"`)
+		}
+		var importedRules []*requestrules.Rule
+		var err error
+		if postBody.Admin {
+			// Admin rules apply to all users, so only root may set them,
+			// regardless of polkit authorization.
+			ucred, err := ucrednetGet(r.RemoteAddr)
+			if err != nil {
+				return Forbidden("cannot get remote user: %v", err)
+			}
+			if ucred.Uid != 0 {
+				return Forbidden("only admins may import admin rules")
+			}
+			importedRules, err = getInterfaceManager(c).InterfacesRequestsManager().SetAdminRules(postBody.ImportRules)
+			if err != nil {
+				return promptingError(err)
+			}
+		} else {
+			importedRules, err = getInterfaceManager(c).InterfacesRequestsManager().ImportRules(userID, postBody.ImportRules)
+			if err != nil {
+				return promptingError(err)
+			}
+		}
+		if len(importedRules) == 0 {
+			importedRules = []*requestrules.Rule{}
+		}
+		return SyncResponse(importedRules)
 	default:
-		return BadRequest(`"action" field must be "create" or "remove"`)
+		return BadRequest(`"action" field must be "add", "remove" or "import"`)
 	}
 }
 
@@ -557,3 +612,62 @@ func postRule(c *Command, r *http.Request, user *auth.UserState) Response {
 		return BadRequest(`action must be "add" or "remove"`)
 	}
 }
+
+// getRequestsAudit returns the entries of the audit log of prompting decisions
+// which match the filters given in the query.
+//
+// Non-admin users may only see the decisions made for their own requests.
+// Admin users see the decisions made for all users, unless the "user-id"
+// parameter is given.
+func getRequestsAudit(c *Command, r *http.Request, user *auth.UserState) Response {
+	userID, errorResp := getUserID(r)
+	if errorResp != nil {
+		return errorResp
+	}
+
+	query := r.URL.Query()
+	filter := &requestaudit.Filter{
+		Snap:      query.Get("snap"),
+		Interface: query.Get("interface"),
+	}
+	if userID != 0 || len(query["user-id"]) != 0 {
+		filter.User = &userID
+	}
+
+	switch outcome := prompting.OutcomeType(query.Get("outcome")); outcome {
+	case prompting.OutcomeUnset, prompting.OutcomeAllow, prompting.OutcomeDeny:
+		filter.Outcome = outcome
+	default:
+		return BadRequest(`invalid "outcome" parameter: must be %q or %q`, prompting.OutcomeAllow, prompting.OutcomeDeny)
+	}
+
+	switch source := requestaudit.SourceType(query.Get("source")); source {
+	case "", requestaudit.SourceRule, requestaudit.SourceReply, requestaudit.SourceExpired:
+		filter.Source = source
+	default:
+		return BadRequest(`invalid "source" parameter: must be %q, %q or %q`, requestaudit.SourceRule, requestaudit.SourceReply, requestaudit.SourceExpired)
+	}
+
+	for _, bound := range []struct {
+		name string
+		t    *time.Time
+	}{{"after", &filter.After}, {"before", &filter.Before}} {
+		if v := query.Get(bound.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return BadRequest("invalid %q parameter: %v", bound.name, err)
+			}
+			*bound.t = t
+		}
+	}
+
+	entries, err := requestaudit.Entries(filter)
+	if err != nil {
+		return InternalError("cannot read prompting audit log: %v", err)
+	}
+	if len(entries) == 0 {
+		entries = []*requestaudit.Entry{}
+	}
+
+	return SyncResponse(entries)
+}
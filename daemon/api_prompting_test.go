@@ -34,6 +34,7 @@ import (
 	"github.com/snapcore/snapd/interfaces/prompting"
 	prompting_errors "github.com/snapcore/snapd/interfaces/prompting/errors"
 	"github.com/snapcore/snapd/interfaces/prompting/patterns"
+	"github.com/snapcore/snapd/interfaces/prompting/requestaudit"
 	"github.com/snapcore/snapd/interfaces/prompting/requestprompts"
 	"github.com/snapcore/snapd/interfaces/prompting/requestrules"
 	"github.com/snapcore/snapd/overlord/ifacestate/apparmorprompting"
@@ -61,6 +62,8 @@ type fakeInterfacesRequestsManager struct {
 	lifespan       prompting.LifespanType
 	duration       string
 	clientActivity bool
+	contents       []*requestrules.RuleContents
+	admin          bool
 }
 
 func (m *fakeInterfacesRequestsManager) Prompts(userID uint32, clientActivity bool) ([]*requestprompts.Prompt, error) {
@@ -134,6 +137,23 @@ func (m *fakeInterfacesRequestsManager) RemoveRule(userID uint32, ruleID prompti
 	return m.rule, m.err
 }
 
+func (m *fakeInterfacesRequestsManager) ImportRules(userID uint32, contents []*requestrules.RuleContents) ([]*requestrules.Rule, error) {
+	m.userID = userID
+	m.contents = contents
+	return m.rules, m.err
+}
+
+func (m *fakeInterfacesRequestsManager) AdminRules() ([]*requestrules.Rule, error) {
+	m.admin = true
+	return m.rules, m.err
+}
+
+func (m *fakeInterfacesRequestsManager) SetAdminRules(contents []*requestrules.RuleContents) ([]*requestrules.Rule, error) {
+	m.admin = true
+	m.contents = contents
+	return m.rules, m.err
+}
+
 type promptingSuite struct {
 	apiBaseSuite
 
@@ -623,6 +643,17 @@ func (s *promptingSuite) TestPromptingError(c *C) {
 				"type":        "error",
 			},
 		},
+		{
+			err: prompting_errors.ErrNoUserSession,
+			body: map[string]interface{}{
+				"result": map[string]interface{}{
+					"message": prompting_errors.ErrNoUserSession.Error(),
+				},
+				"status":      "Bad Request",
+				"status-code": 400.0,
+				"type":        "error",
+			},
+		},
 		{
 			err: fmt.Errorf("some arbitrary error"),
 			body: map[string]interface{}{
@@ -946,6 +977,162 @@ func (s *promptingSuite) TestPostRulesRemoveHappy(c *C) {
 	}
 }
 
+func (s *promptingSuite) TestGetRulesAdmin(c *C) {
+	s.daemon(c)
+
+	s.manager.rules = []*requestrules.Rule{
+		{
+			ID:        prompting.IDType(0xabcd),
+			Timestamp: time.Now(),
+			Snap:      "firefox",
+			Interface: "home",
+			Constraints: &prompting.Constraints{
+				PathPattern: mustParsePathPattern(c, "/home/*/.ssh/**"),
+				Permissions: []string{"read"},
+			},
+			Outcome:  prompting.OutcomeDeny,
+			Lifespan: prompting.LifespanForever,
+			Admin:    true,
+		},
+	}
+
+	// Any user can see the admin rules
+	rsp := s.makeSyncReq(c, "GET", "/v2/interfaces/requests/rules?admin=true", 1234, nil)
+	c.Check(s.manager.admin, Equals, true)
+	rules, ok := rsp.Result.([]*requestrules.Rule)
+	c.Check(ok, Equals, true)
+	c.Check(rules, DeepEquals, s.manager.rules)
+
+	for _, testCase := range []struct {
+		vars string
+		err  string
+	}{
+		{"?admin=true&snap=firefox", `cannot use "snap" or "interface" parameters with "admin"`},
+		{"?admin=true&interface=home", `cannot use "snap" or "interface" parameters with "admin"`},
+		{"?admin=foo", `invalid "admin" parameter: must be "true" or "false"`},
+	} {
+		s.manager = &fakeInterfacesRequestsManager{}
+		req, err := http.NewRequest("GET", "/v2/interfaces/requests/rules"+testCase.vars, nil)
+		c.Assert(err, IsNil)
+		req.RemoteAddr = "pid=100;uid=1234;socket=;"
+		rspe := s.errorReq(c, req, nil)
+		c.Check(rspe.Status, Equals, 400)
+		c.Check(rspe.Message, Equals, testCase.err)
+		c.Check(s.manager.admin, Equals, false)
+	}
+}
+
+func (s *promptingSuite) TestPostRulesImportHappy(c *C) {
+	s.expectWriteAccess(daemon.InterfaceAuthenticatedAccess{Interfaces: []string{"snap-interfaces-requests-control"}, Polkit: "io.snapcraft.snapd.manage"})
+
+	s.daemon(c)
+
+	contents := []*requestrules.RuleContents{
+		{
+			Snap:      "thunderbird",
+			Interface: "home",
+			Constraints: &prompting.Constraints{
+				PathPattern: mustParsePathPattern(c, "/home/test/Mail/**"),
+				Permissions: []string{"read", "write"},
+			},
+			Outcome:  prompting.OutcomeAllow,
+			Lifespan: prompting.LifespanForever,
+		},
+		{
+			Snap:      "firefox",
+			Interface: "home",
+			Constraints: &prompting.Constraints{
+				PathPattern: mustParsePathPattern(c, "/home/test/Downloads/**"),
+				Permissions: []string{"write"},
+			},
+			Outcome:  prompting.OutcomeAllow,
+			Lifespan: prompting.LifespanTimespan,
+			Duration: "24h",
+		},
+	}
+
+	for _, testCase := range []struct {
+		uid   uint32
+		vars  string
+		admin bool
+
+		expectedUser uint32
+	}{
+		{1000, "", false, 1000},
+		{0, "?user-id=1000", false, 1000},
+		{0, "", true, 0},
+	} {
+		s.manager = &fakeInterfacesRequestsManager{
+			rules: []*requestrules.Rule{{ID: prompting.IDType(1)}, {ID: prompting.IDType(2)}},
+		}
+
+		postBody := &daemon.PostRulesRequestBody{
+			Action:      "import",
+			ImportRules: contents,
+			Admin:       testCase.admin,
+		}
+		marshalled, err := json.Marshal(postBody)
+		c.Assert(err, IsNil)
+
+		rsp := s.makeSyncReq(c, "POST", "/v2/interfaces/requests/rules"+testCase.vars, testCase.uid, marshalled)
+
+		// Check parameters
+		c.Check(s.manager.admin, Equals, testCase.admin)
+		c.Check(s.manager.userID, Equals, testCase.expectedUser)
+		c.Check(s.manager.contents, DeepEquals, contents)
+
+		// Check return value
+		rules, ok := rsp.Result.([]*requestrules.Rule)
+		c.Check(ok, Equals, true)
+		c.Check(rules, DeepEquals, s.manager.rules)
+	}
+
+	// Admin rules can be cleared by importing an empty set of rules
+	s.manager = &fakeInterfacesRequestsManager{}
+	rsp := s.makeSyncReq(c, "POST", "/v2/interfaces/requests/rules", 0, []byte(`{"action":"import","rules":[],"admin":true}`))
+	c.Check(s.manager.admin, Equals, true)
+	c.Check(s.manager.contents, HasLen, 0)
+	c.Check(rsp.Result, DeepEquals, []*requestrules.Rule{})
+}
+
+func (s *promptingSuite) TestPostRulesImportErrors(c *C) {
+	s.expectWriteAccess(daemon.InterfaceAuthenticatedAccess{Interfaces: []string{"snap-interfaces-requests-control"}, Polkit: "io.snapcraft.snapd.manage"})
+
+	s.daemon(c)
+
+	for _, testCase := range []struct {
+		uid    uint32
+		body   string
+		status int
+		err    string
+	}{
+		{1000, `{"action":"import"}`, 400, `must include "rules" field in request body when action is "import"`},
+		{1000, `{"action":"import","rules":[],"admin":true}`, 403, `only admins may import admin rules`},
+		{1000, `{"action":"foo"}`, 400, `"action" field must be "add", "remove" or "import"`},
+	} {
+		s.manager = &fakeInterfacesRequestsManager{}
+		req, err := http.NewRequest("POST", "/v2/interfaces/requests/rules", bytes.NewBufferString(testCase.body))
+		c.Assert(err, IsNil)
+		req.RemoteAddr = fmt.Sprintf("pid=100;uid=%d;socket=;", testCase.uid)
+		rspe := s.errorReq(c, req, nil)
+		c.Check(rspe.Status, Equals, testCase.status)
+		c.Check(rspe.Message, Equals, testCase.err)
+		c.Check(s.manager.admin, Equals, false)
+		c.Check(s.manager.contents, IsNil)
+	}
+
+	// Errors from the manager are returned as prompting errors
+	s.manager = &fakeInterfacesRequestsManager{
+		err: fmt.Errorf("cannot import rule 1: %w", prompting_errors.NewInvalidLifespanError("timespan", []string{"forever"})),
+	}
+	req, err := http.NewRequest("POST", "/v2/interfaces/requests/rules", bytes.NewBufferString(`{"action":"import","rules":[],"admin":true}`))
+	c.Assert(err, IsNil)
+	req.RemoteAddr = "pid=100;uid=0;socket=;"
+	rspe := s.errorReq(c, req, nil)
+	c.Check(rspe.Status, Equals, 400)
+	c.Check(rspe.Message, Equals, `cannot import rule 1: invalid lifespan: "timespan"`)
+}
+
 func (s *promptingSuite) TestGetRuleHappy(c *C) {
 	s.daemon(c)
 
@@ -1066,3 +1253,73 @@ func (s *promptingSuite) TestPostRuleRemoveHappy(c *C) {
 	c.Check(ok, Equals, true)
 	c.Check(rule, DeepEquals, s.manager.rule)
 }
+
+func (s *promptingSuite) TestGetRequestsAudit(c *C) {
+	s.daemon(c)
+
+	timestamp := time.Date(2024, time.October, 1, 12, 0, 0, 0, time.UTC)
+	for i, entry := range []*requestaudit.Entry{
+		{User: 1000, Snap: "firefox", Interface: "home", Outcome: prompting.OutcomeAllow, Source: requestaudit.SourceReply},
+		{User: 1000, Snap: "firefox", Interface: "camera", Outcome: prompting.OutcomeDeny, Source: requestaudit.SourceRule},
+		{User: 1001, Snap: "thunderbird", Interface: "home", Outcome: prompting.OutcomeDeny, Source: requestaudit.SourceExpired},
+	} {
+		entry.Timestamp = timestamp.Add(time.Duration(i) * time.Hour)
+		entry.Path = "/home/test/foo"
+		entry.Permissions = []string{"read"}
+		c.Assert(requestaudit.Record(entry), IsNil)
+	}
+
+	for _, testCase := range []struct {
+		vars  string
+		uid   uint32
+		users []uint32
+	}{
+		{vars: "", uid: 0, users: []uint32{1000, 1000, 1001}},
+		{vars: "?user-id=1001", uid: 0, users: []uint32{1001}},
+		{vars: "", uid: 1000, users: []uint32{1000, 1000}},
+		{vars: "", uid: 1234, users: nil},
+		{vars: "?snap=thunderbird", uid: 0, users: []uint32{1001}},
+		{vars: "?interface=home", uid: 1000, users: []uint32{1000}},
+		{vars: "?outcome=deny", uid: 0, users: []uint32{1000, 1001}},
+		{vars: "?source=expired", uid: 0, users: []uint32{1001}},
+		{vars: "?after=2024-10-01T12:30:00Z&before=2024-10-01T14:00:00Z", uid: 0, users: []uint32{1000}},
+	} {
+		rsp := s.makeSyncReq(c, "GET", "/v2/interfaces/requests/audit"+testCase.vars, testCase.uid, nil)
+		entries, ok := rsp.Result.([]*requestaudit.Entry)
+		c.Assert(ok, Equals, true, Commentf("vars: %q", testCase.vars))
+		// Empty results must be marshalled as [] rather than null
+		c.Check(entries, NotNil)
+		users := make([]uint32, 0, len(entries))
+		for _, entry := range entries {
+			users = append(users, entry.User)
+		}
+		if testCase.users == nil {
+			testCase.users = []uint32{}
+		}
+		c.Check(users, DeepEquals, testCase.users, Commentf("vars: %q, uid: %d", testCase.vars, testCase.uid))
+	}
+}
+
+func (s *promptingSuite) TestGetRequestsAuditErrors(c *C) {
+	s.daemon(c)
+
+	for _, testCase := range []struct {
+		vars string
+		uid  uint32
+		code int
+		err  string
+	}{
+		{"?user-id=1001", 1000, 403, `only admins may use the "user-id" parameter`},
+		{"?outcome=foo", 1000, 400, `invalid "outcome" parameter: must be "allow" or "deny"`},
+		{"?source=foo", 1000, 400, `invalid "source" parameter: must be "rule", "reply" or "expired"`},
+		{"?after=yesterday", 1000, 400, `invalid "after" parameter: .*`},
+		{"?before=tomorrow", 1000, 400, `invalid "before" parameter: .*`},
+	} {
+		req, err := http.NewRequest("GET", "/v2/interfaces/requests/audit"+testCase.vars, nil)
+		c.Assert(err, IsNil)
+		req.RemoteAddr = fmt.Sprintf("pid=100;uid=%d;socket=;", testCase.uid)
+		rspe := s.errorReq(c, req, nil)
+		c.Check(rspe.Status, Equals, testCase.code)
+		c.Check(rspe.Message, Matches, testCase.err)
+	}
+}
@@ -88,6 +88,7 @@ var getQuotaUsage = func(grp *quota.Group) (*client.QuotaValues, error) {
 func createQuotaValues(grp *quota.Group) *client.QuotaValues {
 	var constraints client.QuotaValues
 	constraints.Memory = grp.MemoryLimit
+	constraints.MemorySwap = grp.MemorySwapLimit
 	constraints.Threads = grp.ThreadLimit
 
 	if grp.CPULimit != nil {
@@ -99,6 +100,13 @@ func createQuotaValues(grp *quota.Group) *client.QuotaValues {
 			CPUs: grp.CPULimit.CPUSet,
 		}
 	}
+	if grp.IOLimit != nil {
+		constraints.IO = &client.QuotaIOValues{
+			Device:         grp.IOLimit.Device,
+			ReadBandwidth:  grp.IOLimit.ReadBandwidth,
+			WriteBandwidth: grp.IOLimit.WriteBandwidth,
+		}
+	}
 	if grp.JournalLimit != nil {
 		constraints.Journal = &client.QuotaJournalValues{
 			Size: grp.JournalLimit.Size,
@@ -196,6 +204,9 @@ func quotaValuesToResources(values client.QuotaValues) quota.Resources {
 	if values.Memory != 0 {
 		resourcesBuilder.WithMemoryLimit(values.Memory)
 	}
+	if values.MemorySwap != 0 {
+		resourcesBuilder.WithMemorySwapLimit(values.MemorySwap)
+	}
 	if values.CPU != nil {
 		if values.CPU.Count != 0 {
 			resourcesBuilder.WithCPUCount(values.CPU.Count)
@@ -219,6 +230,15 @@ func quotaValuesToResources(values client.QuotaValues) quota.Resources {
 			resourcesBuilder.WithJournalRate(values.Journal.RateCount, values.Journal.RatePeriod)
 		}
 	}
+	if values.IO != nil {
+		resourcesBuilder.WithIODevice(values.IO.Device)
+		if values.IO.ReadBandwidth != 0 {
+			resourcesBuilder.WithIOReadBandwidth(values.IO.ReadBandwidth)
+		}
+		if values.IO.WriteBandwidth != 0 {
+			resourcesBuilder.WithIOWriteBandwidth(values.IO.WriteBandwidth)
+		}
+	}
 	return resourcesBuilder.Build()
 }
 
@@ -488,6 +488,67 @@ func (s *apiQuotaSuite) TestPostEnsureQuotaUpdateMemoryHappy(c *check.C) {
 	c.Assert(s.ensureSoonCalled, check.Equals, 1)
 }
 
+func (s *apiQuotaSuite) TestPostEnsureQuotaUpdateMemorySwapAndIOHappy(c *check.C) {
+	st := s.d.Overlord().State()
+	st.Lock()
+	err := servicestatetest.MockQuotaInState(st, "ginger-ale", "", nil, nil,
+		quota.NewResourcesBuilder().WithMemoryLimit(quantity.SizeMiB).Build())
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+
+	updateCalled := 0
+	r := daemon.MockServicestateUpdateQuota(func(st *state.State, name string, opts servicestate.UpdateQuotaOptions) (*state.TaskSet, error) {
+		updateCalled++
+		c.Assert(name, check.Equals, "ginger-ale")
+		c.Assert(opts, check.DeepEquals, servicestate.UpdateQuotaOptions{
+			NewResourceLimits: quota.NewResourcesBuilder().
+				WithMemorySwapLimit(quantity.SizeGiB).
+				WithIODevice("/dev/sda").
+				WithIOWriteBandwidth(5 * quantity.SizeMiB).
+				Build(),
+		})
+		ts := state.NewTaskSet(st.NewTask("foo-quota", "..."))
+		return ts, nil
+	})
+	defer r()
+
+	data, err := json.Marshal(daemon.PostQuotaGroupData{
+		Action:    "ensure",
+		GroupName: "ginger-ale",
+		Constraints: client.QuotaValues{
+			MemorySwap: quantity.SizeGiB,
+			IO: &client.QuotaIOValues{
+				Device:         "/dev/sda",
+				WriteBandwidth: 5 * quantity.SizeMiB,
+			},
+		},
+	})
+	c.Assert(err, check.IsNil)
+
+	req, err := http.NewRequest("POST", "/v2/quotas", bytes.NewBuffer(data))
+	c.Assert(err, check.IsNil)
+	rsp := s.asyncReq(c, req, nil)
+	c.Assert(rsp.Status, check.Equals, 202)
+	c.Assert(updateCalled, check.Equals, 1)
+}
+
+func (s *apiQuotaSuite) TestCreateQuotaValuesMemorySwapAndIO(c *check.C) {
+	grp, err := quota.NewGroup("ginger-ale", quota.NewResourcesBuilder().
+		WithMemoryLimit(quantity.SizeGiB).
+		WithMemorySwapLimit(quantity.SizeMiB).
+		WithIODevice("/dev/nvme0n1").
+		WithIOReadBandwidth(10*quantity.SizeMiB).
+		Build())
+	c.Assert(err, check.IsNil)
+
+	quotaValues := daemon.CreateQuotaValues(grp)
+	c.Check(quotaValues.MemorySwap, check.Equals, quantity.SizeMiB)
+	c.Check(quotaValues.IO, check.DeepEquals, &client.QuotaIOValues{
+		Device:        "/dev/nvme0n1",
+		ReadBandwidth: 10 * quantity.SizeMiB,
+	})
+}
+
 func (s *apiQuotaSuite) TestPostEnsureQuotaUpdateConflicts(c *check.C) {
 	st := s.d.Overlord().State()
 	st.Lock()
@@ -229,6 +229,7 @@ type snapInstruction struct {
 	Snaps                  []string                         `json:"snaps"`
 	Users                  []string                         `json:"users"`
 	SnapshotOptions        map[string]*snap.SnapshotOptions `json:"snapshot-options"`
+	SnapshotKey            *client.SnapshotKey              `json:"snapshot-key"`
 	ValidationSets         []string                         `json:"validation-sets"`
 	QuotaGroupName         string                           `json:"quota-group"`
 	Time                   string                           `json:"time"`
@@ -335,6 +336,19 @@ func (inst *snapInstruction) validateSnapshotOptions() error {
 	return nil
 }
 
+func (inst *snapInstruction) validateSnapshotKey() error {
+	if inst.SnapshotKey == nil {
+		return nil
+	}
+	if inst.Action != "snapshot" {
+		return fmt.Errorf("snapshot-key can only be specified for snapshot action")
+	}
+	if err := inst.SnapshotKey.Validate(); err != nil {
+		return fmt.Errorf("invalid snapshot-key: %v", err)
+	}
+	return nil
+}
+
 func (inst *snapInstruction) validate() error {
 	if inst.CohortKey != "" {
 		if inst.Action != "install" && inst.Action != "refresh" && inst.Action != "switch" {
@@ -409,6 +423,9 @@ func (inst *snapInstruction) validate() error {
 	if err := inst.validateSnapshotOptions(); err != nil {
 		return err
 	}
+	if err := inst.validateSnapshotKey(); err != nil {
+		return err
+	}
 
 	if inst.Action == "snapshot" {
 		inst.cleanSnapshotOptions()
@@ -202,6 +202,12 @@ func (s *snapsSuite) TestSnapsInfoOnlyLocal(c *check.C) {
 	st.Set("health", map[string]healthstate.HealthState{
 		"local": {Status: healthstate.OkayStatus},
 	})
+	st.Set("health-history", map[string][]healthstate.HealthState{
+		"local": {
+			{Status: healthstate.ErrorStatus, Code: "some-code", Message: "something failed"},
+			{Status: healthstate.OkayStatus},
+		},
+	})
 	st.Unlock()
 
 	req, err := http.NewRequest("GET", "/v2/snaps?sources=local", nil)
@@ -219,6 +225,20 @@ func (s *snapsSuite) TestSnapsInfoOnlyLocal(c *check.C) {
 		"revision":  "unset",
 		"timestamp": "0001-01-01T00:00:00Z",
 	})
+	c.Check(snaps[0]["health-history"], check.DeepEquals, []interface{}{
+		map[string]interface{}{
+			"status":    "error",
+			"code":      "some-code",
+			"message":   "something failed",
+			"revision":  "unset",
+			"timestamp": "0001-01-01T00:00:00Z",
+		},
+		map[string]interface{}{
+			"status":    "okay",
+			"revision":  "unset",
+			"timestamp": "0001-01-01T00:00:00Z",
+		},
+	})
 }
 
 func (s *snapsSuite) TestSnapsInfoAllMixedPublishers(c *check.C) {
@@ -519,6 +539,24 @@ func (s *snapsSuite) TestPostSnapsOptionsUnsupportedActionError(c *check.C) {
 	}
 }
 
+func (s *snapsSuite) TestPostSnapsSnapshotKeyErrors(c *check.C) {
+	s.daemon(c)
+
+	for post, expectedErr := range map[string]string{
+		`{"action": "refresh", "snaps":["foo"], "snapshot-key": {"passphrase": "s3cret"}}`: "snapshot-key can only be specified for snapshot action",
+		`{"action": "snapshot", "snaps":["foo"], "snapshot-key": {}}`:                      "invalid snapshot-key: snapshot key requires either a passphrase or the device key",
+		`{"action": "snapshot", "snapshot-key": {"passphrase": "s3cret", "device": true}}`: "invalid snapshot-key: snapshot key cannot be both a passphrase and the device key",
+	} {
+		req, err := http.NewRequest("POST", "/v2/snaps", strings.NewReader(post))
+		c.Assert(err, check.IsNil)
+		req.Header.Set("Content-Type", "application/json")
+
+		rspe := s.errorReq(c, req, nil)
+		c.Check(rspe.Status, check.Equals, 400, check.Commentf("%s", post))
+		c.Check(rspe.Message, check.Equals, expectedErr, check.Commentf("%s", post))
+	}
+}
+
 func (s *snapsSuite) TestPostSnapsOptionsOtherErrors(c *check.C) {
 	s.daemon(c)
 	const notListedErr = `cannot use snapshot-options for snap "xyzzy" that is not listed in snaps`
@@ -632,7 +670,7 @@ func (s *snapsSuite) TestPostSnapsRemoveManyWithPurge(c *check.C) {
 func (s *snapsSuite) TestPostSnapsOptionsClean(c *check.C) {
 	var snapshotSaveCalled int
 	defer daemon.MockSnapshotSave(func(s *state.State, snaps, users []string,
-		options map[string]*snap.SnapshotOptions) (uint64, []string, *state.TaskSet, error) {
+		options map[string]*snap.SnapshotOptions, key *client.SnapshotKey) (uint64, []string, *state.TaskSet, error) {
 		snapshotSaveCalled++
 
 		c.Check(snaps, check.HasLen, 3)
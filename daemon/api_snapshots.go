@@ -22,6 +22,7 @@ package daemon
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -51,6 +52,12 @@ var snapshotExportCmd = &Command{
 	ReadAccess: authenticatedAccess{},
 }
 
+var snapshotRemoteCmd = &Command{
+	Path:       "/v2/snapshots/remote",
+	GET:        listRemoteSnapshots,
+	ReadAccess: authenticatedAccess{},
+}
+
 var (
 	snapshotList    = snapshotstate.List
 	snapshotCheck   = snapshotstate.Check
@@ -59,6 +66,10 @@ var (
 	snapshotSave    = snapshotstate.Save
 	snapshotExport  = snapshotstate.Export
 	snapshotImport  = snapshotstate.Import
+	snapshotPush    = snapshotstate.Push
+	snapshotPull    = snapshotstate.Pull
+
+	snapshotListRemote = snapshotstate.ListRemote
 )
 
 func listSnapshots(c *Command, r *http.Request, user *auth.UserState) Response {
@@ -85,13 +96,18 @@ func listSnapshots(c *Command, r *http.Request, user *auth.UserState) Response {
 // A snapshotAction is used to request an operation on a snapshot
 // keep this in sync with client/snapshotAction...
 type snapshotAction struct {
-	SetID  uint64   `json:"set"`
-	Action string   `json:"action"`
-	Snaps  []string `json:"snaps,omitempty"`
-	Users  []string `json:"users,omitempty"`
+	SetID    uint64              `json:"set"`
+	RemoteID string              `json:"remote-id,omitempty"`
+	Action   string              `json:"action"`
+	Snaps    []string            `json:"snaps,omitempty"`
+	Users    []string            `json:"users,omitempty"`
+	Key      *client.SnapshotKey `json:"key,omitempty"`
 }
 
 func (action snapshotAction) String() string {
+	if action.Action == "pull" {
+		return fmt.Sprintf("Pull of remote snapshot set %s", action.RemoteID)
+	}
 	// verb of snapshot #N [for snaps %q] [for users %q]
 	var snaps string
 	var users string
@@ -104,6 +120,45 @@ func (action snapshotAction) String() string {
 	return fmt.Sprintf("%s of snapshot set #%d%s%s", strings.Title(action.Action), action.SetID, snaps, users)
 }
 
+// snapshotKeyError returns the error response for operations on encrypted
+// snapshot sets that were given no key or the wrong one, or nil if err is
+// not about the key.
+func snapshotKeyError(err error) *apiError {
+	var keyErr *snapshotstate.KeyRequiredError
+	switch {
+	case errors.As(err, &keyErr):
+		return &apiError{
+			Status:  400,
+			Message: err.Error(),
+			Kind:    client.ErrorKindSnapshotKeyRequired,
+			Value:   keyErr.KeySource,
+		}
+	case errors.Is(err, client.ErrSnapshotKeyRequired):
+		return &apiError{
+			Status:  400,
+			Message: err.Error(),
+			Kind:    client.ErrorKindSnapshotKeyRequired,
+		}
+	case errors.Is(err, client.ErrSnapshotKeyInvalid):
+		return &apiError{
+			Status:  400,
+			Message: err.Error(),
+			Kind:    client.ErrorKindSnapshotKeyInvalid,
+		}
+	}
+	return nil
+}
+
+// snapshotKeyFromHeader returns the key of an encrypted snapshot set given
+// in the request headers, if any.
+func snapshotKeyFromHeader(r *http.Request) (*client.SnapshotKey, error) {
+	value := r.Header.Get(client.SnapshotKeyHeader)
+	if value == "" {
+		return nil, nil
+	}
+	return client.DecodeSnapshotKeyHeader(value)
+}
+
 func changeSnapshots(c *Command, r *http.Request, user *auth.UserState) Response {
 	contentType := r.Header.Get("Content-Type")
 	if contentType == client.SnapshotExportMediaType {
@@ -119,7 +174,14 @@ func changeSnapshots(c *Command, r *http.Request, user *auth.UserState) Response
 		return BadRequest("extra content found after snapshot operation")
 	}
 
-	if action.SetID == 0 {
+	if action.Action == "pull" {
+		if action.RemoteID == "" {
+			return BadRequest(`snapshot "pull" operation requires remote snapshot set ID`)
+		}
+		if action.SetID != 0 || len(action.Snaps) != 0 || len(action.Users) != 0 {
+			return BadRequest(`snapshot "pull" operation can only specify a remote snapshot set ID and a key`)
+		}
+	} else if action.SetID == 0 {
 		return BadRequest("snapshot operation requires snapshot set ID")
 	}
 
@@ -127,6 +189,12 @@ func changeSnapshots(c *Command, r *http.Request, user *auth.UserState) Response
 		return BadRequest("snapshot operation requires action")
 	}
 
+	if action.Key != nil {
+		if err := action.Key.Validate(); err != nil {
+			return BadRequest("%v", err)
+		}
+	}
+
 	var affected []string
 	var ts *state.TaskSet
 	var err error
@@ -137,34 +205,71 @@ func changeSnapshots(c *Command, r *http.Request, user *auth.UserState) Response
 
 	switch action.Action {
 	case "check":
-		affected, ts, err = snapshotCheck(st, action.SetID, action.Snaps, action.Users)
+		affected, ts, err = snapshotCheck(st, action.SetID, action.Snaps, action.Users, action.Key)
 	case "restore":
-		affected, ts, err = snapshotRestore(st, action.SetID, action.Snaps, action.Users)
+		affected, ts, err = snapshotRestore(st, action.SetID, action.Snaps, action.Users, action.Key)
 	case "forget":
 		if len(action.Users) != 0 {
 			return BadRequest(`snapshot "forget" operation cannot specify users`)
 		}
+		if action.Key != nil {
+			return BadRequest(`snapshot "forget" operation cannot specify a key`)
+		}
 		affected, ts, err = snapshotForget(st, action.SetID, action.Snaps)
+	case "push":
+		if len(action.Snaps) != 0 || len(action.Users) != 0 {
+			return BadRequest(`snapshot "push" operation cannot specify snaps or users`)
+		}
+		if action.Key != nil {
+			return BadRequest(`snapshot "push" operation cannot specify a key`)
+		}
+		affected, ts, err = snapshotPush(st, action.SetID)
+	case "pull":
+		ts, err = snapshotPull(st, action.RemoteID, action.Key)
+		if err != nil {
+			return BadRequest("%v", err)
+		}
 	default:
 		return BadRequest("unknown snapshot operation %q", action.Action)
 	}
 
+	if rsp := snapshotKeyError(err); rsp != nil {
+		return rsp
+	}
 	switch err {
 	case nil:
 		// woo
 	case client.ErrSnapshotSetNotFound, client.ErrSnapshotSnapsNotFound:
 		return NotFound("%v", err)
+	case snapshotstate.ErrNoRemoteRepository:
+		return BadRequest("%v", err)
 	default:
 		return InternalError("%v", err)
 	}
 
 	chg := newChange(st, action.Action+"-snapshot", action.String(), []*state.TaskSet{ts}, affected)
-	chg.Set("api-data", map[string]interface{}{"snap-names": affected})
+	if action.Action != "pull" {
+		// the snaps of pulled sets are only known once they were imported
+		chg.Set("api-data", map[string]interface{}{"snap-names": affected})
+	}
 	ensureStateSoon(st)
 
 	return AsyncResponse(nil, chg.ID())
 }
 
+// listRemoteSnapshots lists the snapshot sets in the remote snapshot
+// repository.
+func listRemoteSnapshots(c *Command, r *http.Request, user *auth.UserState) Response {
+	sets, err := snapshotListRemote(r.Context(), c.d.overlord.State())
+	if err == snapshotstate.ErrNoRemoteRepository {
+		return BadRequest("%v", err)
+	}
+	if err != nil {
+		return InternalError("%v", err)
+	}
+	return SyncResponse(sets)
+}
+
 // getSnapshotExport streams an archive containing an export of existing snapshots.
 //
 // The snapshots are re-packaged into a single uncompressed tar archive and
@@ -181,7 +286,15 @@ func getSnapshotExport(c *Command, r *http.Request, user *auth.UserState) Respon
 		return BadRequest("'id' must be a positive base 10 number; got %q", sid)
 	}
 
-	export, err := snapshotExport(r.Context(), st, setID)
+	key, err := snapshotKeyFromHeader(r)
+	if err != nil {
+		return BadRequest("%v", err)
+	}
+
+	export, err := snapshotExport(r.Context(), st, setID, key)
+	if rsp := snapshotKeyError(err); rsp != nil {
+		return rsp
+	}
 	if err != nil {
 		return BadRequest("cannot export %v: %v", setID, err)
 	}
@@ -203,12 +316,19 @@ func doSnapshotImport(c *Command, r *http.Request, user *auth.UserState) Respons
 	if err != nil {
 		return BadRequest("cannot parse Content-Length: %v", err)
 	}
+	key, err := snapshotKeyFromHeader(r)
+	if err != nil {
+		return BadRequest("%v", err)
+	}
 	// ensure we don't read more than we expect
 	limitedBodyReader := io.LimitReader(r.Body, expectedSize)
 
 	// XXX: check that we have enough space to import the compressed snapshots
 	st := c.d.overlord.State()
-	setID, snapNames, err := snapshotImport(r.Context(), st, limitedBodyReader)
+	setID, snapNames, err := snapshotImport(r.Context(), st, limitedBodyReader, key)
+	if rsp := snapshotKeyError(err); rsp != nil {
+		return rsp
+	}
 	if err != nil {
 		return BadRequest(err.Error())
 	}
@@ -218,7 +338,7 @@ func doSnapshotImport(c *Command, r *http.Request, user *auth.UserState) Respons
 }
 
 func snapshotMany(_ context.Context, inst *snapInstruction, st *state.State) (*snapInstructionResult, error) {
-	setID, snapshotted, ts, err := snapshotSave(st, inst.Snaps, inst.Users, inst.SnapshotOptions)
+	setID, snapshotted, ts, err := snapshotSave(st, inst.Snaps, inst.Users, inst.SnapshotOptions, inst.SnapshotKey)
 	if err != nil {
 		return nil, err
 	}
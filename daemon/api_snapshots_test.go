@@ -53,7 +53,7 @@ func (s *snapshotSuite) SetUpTest(c *check.C) {
 
 func (s *snapshotSuite) TestSnapshotManyOptionsNone(c *check.C) {
 	defer daemon.MockSnapshotSave(func(s *state.State, snaps, users []string,
-		options map[string]*snap.SnapshotOptions) (uint64, []string, *state.TaskSet, error) {
+		options map[string]*snap.SnapshotOptions, key *client.SnapshotKey) (uint64, []string, *state.TaskSet, error) {
 		c.Check(snaps, check.HasLen, 2)
 		c.Check(options, check.IsNil)
 		t := s.NewTask("fake-snapshot-2", "Snapshot two")
@@ -74,7 +74,7 @@ func (s *snapshotSuite) TestSnapshotManyOptionsNone(c *check.C) {
 func (s *snapshotSuite) TestSnapshotManyOptionsFull(c *check.C) {
 	var snapshotSaveCalled int
 	defer daemon.MockSnapshotSave(func(s *state.State, snaps, users []string,
-		options map[string]*snap.SnapshotOptions) (uint64, []string, *state.TaskSet, error) {
+		options map[string]*snap.SnapshotOptions, key *client.SnapshotKey) (uint64, []string, *state.TaskSet, error) {
 		snapshotSaveCalled++
 		c.Check(snaps, check.HasLen, 2)
 		c.Check(options, check.HasLen, 2)
@@ -99,9 +99,30 @@ func (s *snapshotSuite) TestSnapshotManyOptionsFull(c *check.C) {
 	c.Check(snapshotSaveCalled, check.Equals, 1)
 }
 
+func (s *snapshotSuite) TestSnapshotManyEncrypted(c *check.C) {
+	var snapshotSaveCalled int
+	defer daemon.MockSnapshotSave(func(s *state.State, snaps, users []string,
+		options map[string]*snap.SnapshotOptions, key *client.SnapshotKey) (uint64, []string, *state.TaskSet, error) {
+		snapshotSaveCalled++
+		c.Check(key, check.DeepEquals, &client.SnapshotKey{Passphrase: "s3cret"})
+		t := s.NewTask("fake-snapshot-2", "Snapshot two")
+		return 1, snaps, state.NewTaskSet(t), nil
+	})()
+
+	inst := daemon.MustUnmarshalSnapInstruction(c, `{"action": "snapshot", "snaps": ["foo", "bar"], "snapshot-key": {"passphrase": "s3cret"}}`)
+
+	st := s.d.Overlord().State()
+	st.Lock()
+	res, err := inst.DispatchForMany()(context.Background(), inst, st)
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+	c.Check(res.Affected, check.DeepEquals, inst.Snaps)
+	c.Check(snapshotSaveCalled, check.Equals, 1)
+}
+
 func (s *snapshotSuite) TestSnapshotManyError(c *check.C) {
 	defer daemon.MockSnapshotSave(func(s *state.State, snaps, users []string,
-		options map[string]*snap.SnapshotOptions) (uint64, []string, *state.TaskSet, error) {
+		options map[string]*snap.SnapshotOptions, key *client.SnapshotKey) (uint64, []string, *state.TaskSet, error) {
 		c.Check(snaps, check.HasLen, 2)
 		return 0, nil, nil, &snap.NotInstalledError{Snap: "foo"}
 	})()
@@ -206,6 +227,9 @@ func (s *snapshotSuite) TestFormatSnapshotAction(c *check.C) {
 		}, {
 			`{"set": 2, "action": "verb", "users": ["meep", "quux"], "snaps": ["foo", "bar"]}`,
 			`Verb of snapshot set #2 for snaps "foo", "bar" for users "meep", "quux"`,
+		}, {
+			`{"remote-id": "0123abcd", "action": "pull"}`,
+			`Pull of remote snapshot set 0123abcd`,
 		},
 	}
 
@@ -236,6 +260,21 @@ func (s *snapshotSuite) TestChangeSnapshots400(c *check.C) {
 		}, {
 			body:  `{"set": 42, "action": "forget", "users": ["foo"]}`,
 			error: `snapshot "forget" operation cannot specify users`,
+		}, {
+			body:  `{"set": 42, "action": "push", "snaps": ["foo"]}`,
+			error: `snapshot "push" operation cannot specify snaps or users`,
+		}, {
+			body:  `{"set": 42, "action": "push", "key": {"passphrase": "s3cret"}}`,
+			error: `snapshot "push" operation cannot specify a key`,
+		}, {
+			body:  `{"action": "pull"}`,
+			error: `snapshot "pull" operation requires remote snapshot set ID`,
+		}, {
+			body:  `{"set": 42, "remote-id": "0123abcd", "action": "pull"}`,
+			error: `snapshot "pull" operation can only specify a remote snapshot set ID and a key`,
+		}, {
+			body:  `{"remote-id": "0123abcd", "action": "pull", "users": ["foo"]}`,
+			error: `snapshot "pull" operation can only specify a remote snapshot set ID and a key`,
 		},
 	}
 
@@ -253,11 +292,11 @@ func (s *snapshotSuite) TestChangeSnapshots400(c *check.C) {
 func (s *snapshotSuite) TestChangeSnapshots404(c *check.C) {
 	var done string
 	expectedError := errors.New("bzzt")
-	defer daemon.MockSnapshotCheck(func(*state.State, uint64, []string, []string) ([]string, *state.TaskSet, error) {
+	defer daemon.MockSnapshotCheck(func(*state.State, uint64, []string, []string, *client.SnapshotKey) ([]string, *state.TaskSet, error) {
 		done = "check"
 		return nil, nil, expectedError
 	})()
-	defer daemon.MockSnapshotRestore(func(*state.State, uint64, []string, []string) ([]string, *state.TaskSet, error) {
+	defer daemon.MockSnapshotRestore(func(*state.State, uint64, []string, []string, *client.SnapshotKey) ([]string, *state.TaskSet, error) {
 		done = "restore"
 		return nil, nil, expectedError
 	})()
@@ -284,11 +323,11 @@ func (s *snapshotSuite) TestChangeSnapshots404(c *check.C) {
 func (s *snapshotSuite) TestChangeSnapshots500(c *check.C) {
 	var done string
 	expectedError := errors.New("bzzt")
-	defer daemon.MockSnapshotCheck(func(*state.State, uint64, []string, []string) ([]string, *state.TaskSet, error) {
+	defer daemon.MockSnapshotCheck(func(*state.State, uint64, []string, []string, *client.SnapshotKey) ([]string, *state.TaskSet, error) {
 		done = "check"
 		return nil, nil, expectedError
 	})()
-	defer daemon.MockSnapshotRestore(func(*state.State, uint64, []string, []string) ([]string, *state.TaskSet, error) {
+	defer daemon.MockSnapshotRestore(func(*state.State, uint64, []string, []string, *client.SnapshotKey) ([]string, *state.TaskSet, error) {
 		done = "restore"
 		return nil, nil, expectedError
 	})()
@@ -311,11 +350,11 @@ func (s *snapshotSuite) TestChangeSnapshots500(c *check.C) {
 
 func (s *snapshotSuite) TestChangeSnapshot(c *check.C) {
 	var done string
-	defer daemon.MockSnapshotCheck(func(*state.State, uint64, []string, []string) ([]string, *state.TaskSet, error) {
+	defer daemon.MockSnapshotCheck(func(*state.State, uint64, []string, []string, *client.SnapshotKey) ([]string, *state.TaskSet, error) {
 		done = "check"
 		return []string{"foo"}, state.NewTaskSet(), nil
 	})()
-	defer daemon.MockSnapshotRestore(func(*state.State, uint64, []string, []string) ([]string, *state.TaskSet, error) {
+	defer daemon.MockSnapshotRestore(func(*state.State, uint64, []string, []string, *client.SnapshotKey) ([]string, *state.TaskSet, error) {
 		done = "restore"
 		return []string{"foo"}, state.NewTaskSet(), nil
 	})()
@@ -355,10 +394,161 @@ func (s *snapshotSuite) TestChangeSnapshot(c *check.C) {
 	}
 }
 
+func (s *snapshotSuite) TestChangeSnapshotEncrypted(c *check.C) {
+	var done string
+	var keyErr error
+	key := &client.SnapshotKey{Passphrase: "s3cret"}
+	defer daemon.MockSnapshotCheck(func(_ *state.State, _ uint64, _, _ []string, k *client.SnapshotKey) ([]string, *state.TaskSet, error) {
+		done = "check"
+		c.Check(k, check.DeepEquals, key)
+		return []string{"foo"}, state.NewTaskSet(), keyErr
+	})()
+	defer daemon.MockSnapshotRestore(func(_ *state.State, _ uint64, _, _ []string, k *client.SnapshotKey) ([]string, *state.TaskSet, error) {
+		done = "restore"
+		c.Check(k, check.DeepEquals, key)
+		return []string{"foo"}, state.NewTaskSet(), keyErr
+	})()
+
+	for _, action := range []string{"check", "restore"} {
+		comm := check.Commentf("%s", action)
+		body := fmt.Sprintf(`{"set": 42, "action": "%s", "key": {"passphrase": "s3cret"}}`, action)
+
+		keyErr = nil
+		req, err := http.NewRequest("POST", "/v2/snapshots", strings.NewReader(body))
+		c.Assert(err, check.IsNil, comm)
+		rsp := s.asyncReq(c, req, nil)
+		c.Check(rsp.Status, check.Equals, 202, comm)
+		c.Check(done, check.Equals, action, comm)
+
+		keyErr = client.ErrSnapshotKeyInvalid
+		req, err = http.NewRequest("POST", "/v2/snapshots", strings.NewReader(body))
+		c.Assert(err, check.IsNil, comm)
+		rspe := s.errorReq(c, req, nil)
+		c.Check(rspe.Status, check.Equals, 400, comm)
+		c.Check(rspe.Kind, check.Equals, client.ErrorKindSnapshotKeyInvalid, comm)
+		c.Check(rspe.Message, check.Equals, "invalid key for encrypted snapshot set", comm)
+
+		keyErr = &snapshotstate.KeyRequiredError{KeySource: "device"}
+		req, err = http.NewRequest("POST", "/v2/snapshots", strings.NewReader(body))
+		c.Assert(err, check.IsNil, comm)
+		rspe = s.errorReq(c, req, nil)
+		c.Check(rspe.Status, check.Equals, 400, comm)
+		c.Check(rspe.Kind, check.Equals, client.ErrorKindSnapshotKeyRequired, comm)
+		c.Check(rspe.Value, check.Equals, "device", comm)
+	}
+}
+
+func (s *snapshotSuite) TestChangeSnapshotKeyErrors(c *check.C) {
+	for body, expectedErr := range map[string]string{
+		`{"set": 42, "action": "check", "key": {}}`:                        "snapshot key requires either a passphrase or the device key",
+		`{"set": 42, "action": "forget", "key": {"passphrase": "s3cret"}}`: `snapshot "forget" operation cannot specify a key`,
+	} {
+		req, err := http.NewRequest("POST", "/v2/snapshots", strings.NewReader(body))
+		c.Assert(err, check.IsNil)
+
+		rspe := s.errorReq(c, req, nil)
+		c.Check(rspe.Status, check.Equals, 400, check.Commentf("%s", body))
+		c.Check(rspe.Message, check.Equals, expectedErr, check.Commentf("%s", body))
+	}
+}
+
+func (s *snapshotSuite) TestChangeSnapshotPush(c *check.C) {
+	var pushErr error
+	defer daemon.MockSnapshotPush(func(_ *state.State, setID uint64) ([]string, *state.TaskSet, error) {
+		c.Check(setID, check.Equals, uint64(42))
+		return []string{"foo", "bar"}, state.NewTaskSet(), pushErr
+	})()
+
+	req, err := http.NewRequest("POST", "/v2/snapshots", strings.NewReader(`{"set": 42, "action": "push"}`))
+	c.Assert(err, check.IsNil)
+	rsp := s.asyncReq(c, req, nil)
+	c.Check(rsp.Status, check.Equals, 202)
+
+	st := s.d.Overlord().State()
+	st.Lock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Kind(), check.Equals, "push-snapshot")
+	c.Check(chg.Summary(), check.Equals, "Push of snapshot set #42")
+	var apiData map[string]interface{}
+	c.Assert(chg.Get("api-data", &apiData), check.IsNil)
+	c.Check(apiData, check.DeepEquals, map[string]interface{}{
+		"snap-names": []interface{}{"foo", "bar"},
+	})
+	st.Unlock()
+
+	pushErr = snapshotstate.ErrNoRemoteRepository
+	req, err = http.NewRequest("POST", "/v2/snapshots", strings.NewReader(`{"set": 42, "action": "push"}`))
+	c.Assert(err, check.IsNil)
+	rspe := s.errorReq(c, req, nil)
+	c.Check(rspe.Status, check.Equals, 400)
+	c.Check(rspe.Message, check.Equals, "no remote snapshot repository configured, set snapshots.remote.url")
+
+	pushErr = client.ErrSnapshotSetNotFound
+	req, err = http.NewRequest("POST", "/v2/snapshots", strings.NewReader(`{"set": 42, "action": "push"}`))
+	c.Assert(err, check.IsNil)
+	rspe = s.errorReq(c, req, nil)
+	c.Check(rspe.Status, check.Equals, 404)
+}
+
+func (s *snapshotSuite) TestChangeSnapshotPull(c *check.C) {
+	var pullErr error
+	defer daemon.MockSnapshotPull(func(_ *state.State, remoteID string, key *client.SnapshotKey) (*state.TaskSet, error) {
+		c.Check(remoteID, check.Equals, "0123abcd")
+		c.Check(key, check.DeepEquals, &client.SnapshotKey{Passphrase: "s3cret"})
+		return state.NewTaskSet(), pullErr
+	})()
+
+	body := `{"remote-id": "0123abcd", "action": "pull", "key": {"passphrase": "s3cret"}}`
+	req, err := http.NewRequest("POST", "/v2/snapshots", strings.NewReader(body))
+	c.Assert(err, check.IsNil)
+	rsp := s.asyncReq(c, req, nil)
+	c.Check(rsp.Status, check.Equals, 202)
+
+	st := s.d.Overlord().State()
+	st.Lock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Kind(), check.Equals, "pull-snapshot")
+	c.Check(chg.Summary(), check.Equals, "Pull of remote snapshot set 0123abcd")
+	st.Unlock()
+
+	pullErr = snapshotstate.ErrNoRemoteRepository
+	req, err = http.NewRequest("POST", "/v2/snapshots", strings.NewReader(body))
+	c.Assert(err, check.IsNil)
+	rspe := s.errorReq(c, req, nil)
+	c.Check(rspe.Status, check.Equals, 400)
+	c.Check(rspe.Message, check.Equals, "no remote snapshot repository configured, set snapshots.remote.url")
+}
+
+func (s *snapshotSuite) TestListRemoteSnapshots(c *check.C) {
+	sets := []client.RemoteSnapshotSet{{ID: "0123abcd", SetID: 1, Snaps: []string{"foo"}, Size: 42}}
+	var listErr error
+	defer daemon.MockSnapshotListRemote(func(context.Context, *state.State) ([]client.RemoteSnapshotSet, error) {
+		return sets, listErr
+	})()
+
+	req, err := http.NewRequest("GET", "/v2/snapshots/remote", nil)
+	c.Assert(err, check.IsNil)
+	rsp := s.syncReq(c, req, nil)
+	c.Check(rsp.Status, check.Equals, 200)
+	c.Check(rsp.Result, check.DeepEquals, sets)
+
+	listErr = snapshotstate.ErrNoRemoteRepository
+	rspe := s.errorReq(c, req, nil)
+	c.Check(rspe.Status, check.Equals, 400)
+	c.Check(rspe.Message, check.Equals, "no remote snapshot repository configured, set snapshots.remote.url")
+
+	listErr = errors.New("cannot list remote snapshot sets: boom")
+	rspe = s.errorReq(c, req, nil)
+	c.Check(rspe.Status, check.Equals, 500)
+	c.Check(rspe.Message, check.Equals, "cannot list remote snapshot sets: boom")
+}
+
 func (s *snapshotSuite) TestExportSnapshots(c *check.C) {
 	var snapshotExportCalled int
 
-	defer daemon.MockSnapshotExport(func(ctx context.Context, st *state.State, setID uint64) (*snapshotstate.SnapshotExport, error) {
+	defer daemon.MockSnapshotExport(func(ctx context.Context, st *state.State, setID uint64, key *client.SnapshotKey) (*snapshotstate.SnapshotExport, error) {
 		snapshotExportCalled++
 		c.Check(setID, check.Equals, uint64(1))
 		return &snapshotstate.SnapshotExport{}, nil
@@ -372,6 +562,40 @@ func (s *snapshotSuite) TestExportSnapshots(c *check.C) {
 	c.Check(snapshotExportCalled, check.Equals, 1)
 }
 
+func (s *snapshotSuite) TestExportSnapshotsEncrypted(c *check.C) {
+	var key *client.SnapshotKey
+	defer daemon.MockSnapshotExport(func(ctx context.Context, st *state.State, setID uint64, k *client.SnapshotKey) (*snapshotstate.SnapshotExport, error) {
+		key = k
+		if k == nil {
+			return nil, &snapshotstate.KeyRequiredError{KeySource: "passphrase"}
+		}
+		return &snapshotstate.SnapshotExport{}, nil
+	})()
+
+	req, err := http.NewRequest("GET", "/v2/snapshots/1/export", nil)
+	c.Assert(err, check.IsNil)
+	rspe := s.errorReq(c, req, nil)
+	c.Check(rspe.Status, check.Equals, 400)
+	c.Check(rspe.Kind, check.Equals, client.ErrorKindSnapshotKeyRequired)
+	c.Check(rspe.Value, check.Equals, "passphrase")
+
+	req, err = http.NewRequest("GET", "/v2/snapshots/1/export", nil)
+	c.Assert(err, check.IsNil)
+	hdr, err := (&client.SnapshotKey{Passphrase: "s3cret"}).EncodeHeader()
+	c.Assert(err, check.IsNil)
+	req.Header.Set(client.SnapshotKeyHeader, hdr)
+	rsp := s.req(c, req, nil)
+	c.Check(rsp, check.FitsTypeOf, &daemon.SnapshotExportResponse{})
+	c.Check(key, check.DeepEquals, &client.SnapshotKey{Passphrase: "s3cret"})
+
+	req, err = http.NewRequest("GET", "/v2/snapshots/1/export", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set(client.SnapshotKeyHeader, "not-base64!")
+	rspe = s.errorReq(c, req, nil)
+	c.Check(rspe.Status, check.Equals, 400)
+	c.Check(rspe.Message, check.Matches, "cannot decode snapshot key: .*")
+}
+
 func (s *snapshotSuite) TestExportSnapshotsBadRequestOnNonNumericID(c *check.C) {
 	req, err := http.NewRequest("GET", "/v2/snapshots/xxx/export", nil)
 	c.Assert(err, check.IsNil)
@@ -384,7 +608,7 @@ func (s *snapshotSuite) TestExportSnapshotsBadRequestOnNonNumericID(c *check.C)
 func (s *snapshotSuite) TestExportSnapshotsBadRequestOnError(c *check.C) {
 	var snapshotExportCalled int
 
-	defer daemon.MockSnapshotExport(func(ctx context.Context, st *state.State, setID uint64) (*snapshotstate.SnapshotExport, error) {
+	defer daemon.MockSnapshotExport(func(ctx context.Context, st *state.State, setID uint64, key *client.SnapshotKey) (*snapshotstate.SnapshotExport, error) {
 		snapshotExportCalled++
 		return nil, fmt.Errorf("boom")
 	})()
@@ -403,7 +627,7 @@ func (s *snapshotSuite) TestImportSnapshot(c *check.C) {
 
 	setID := uint64(3)
 	snapNames := []string{"baz", "bar", "foo"}
-	defer daemon.MockSnapshotImport(func(context.Context, *state.State, io.Reader) (uint64, []string, error) {
+	defer daemon.MockSnapshotImport(func(context.Context, *state.State, io.Reader, *client.SnapshotKey) (uint64, []string, error) {
 		return setID, snapNames, nil
 	})()
 
@@ -417,8 +641,42 @@ func (s *snapshotSuite) TestImportSnapshot(c *check.C) {
 	c.Check(rsp.Result, check.DeepEquals, map[string]interface{}{"set-id": setID, "snaps": snapNames})
 }
 
+func (s *snapshotSuite) TestImportSnapshotEncrypted(c *check.C) {
+	data := []byte("mocked snapshot export data file")
+
+	var key *client.SnapshotKey
+	defer daemon.MockSnapshotImport(func(_ context.Context, _ *state.State, _ io.Reader, k *client.SnapshotKey) (uint64, []string, error) {
+		key = k
+		if k == nil {
+			return 0, nil, fmt.Errorf("cannot import snapshot 3: %w", &snapshotstate.KeyRequiredError{KeySource: "device"})
+		}
+		return 3, []string{"foo"}, nil
+	})()
+
+	req, err := http.NewRequest("POST", "/v2/snapshots", bytes.NewReader(data))
+	c.Assert(err, check.IsNil)
+	req.Header.Add("Content-Length", strconv.Itoa(len(data)))
+	req.Header.Set("Content-Type", client.SnapshotExportMediaType)
+	rspe := s.errorReq(c, req, nil)
+	c.Check(rspe.Status, check.Equals, 400)
+	c.Check(rspe.Kind, check.Equals, client.ErrorKindSnapshotKeyRequired)
+	c.Check(rspe.Value, check.Equals, "device")
+	c.Check(rspe.Message, check.Equals, "cannot import snapshot 3: snapshot set is encrypted and requires a key")
+
+	req, err = http.NewRequest("POST", "/v2/snapshots", bytes.NewReader(data))
+	c.Assert(err, check.IsNil)
+	req.Header.Add("Content-Length", strconv.Itoa(len(data)))
+	req.Header.Set("Content-Type", client.SnapshotExportMediaType)
+	hdr, err := (&client.SnapshotKey{Device: true}).EncodeHeader()
+	c.Assert(err, check.IsNil)
+	req.Header.Set(client.SnapshotKeyHeader, hdr)
+	rsp := s.syncReq(c, req, nil)
+	c.Check(rsp.Status, check.Equals, 200)
+	c.Check(key, check.DeepEquals, &client.SnapshotKey{Device: true})
+}
+
 func (s *snapshotSuite) TestImportSnapshotError(c *check.C) {
-	defer daemon.MockSnapshotImport(func(context.Context, *state.State, io.Reader) (uint64, []string, error) {
+	defer daemon.MockSnapshotImport(func(context.Context, *state.State, io.Reader, *client.SnapshotKey) (uint64, []string, error) {
 		return uint64(0), nil, errors.New("no")
 	})()
 
@@ -447,7 +705,7 @@ func (s *snapshotSuite) TestImportSnapshotNoContentLengthError(c *check.C) {
 func (s *snapshotSuite) TestImportSnapshotLimits(c *check.C) {
 	var dataRead int
 
-	defer daemon.MockSnapshotImport(func(ctx context.Context, st *state.State, r io.Reader) (uint64, []string, error) {
+	defer daemon.MockSnapshotImport(func(ctx context.Context, st *state.State, r io.Reader, key *client.SnapshotKey) (uint64, []string, error) {
 		data, err := io.ReadAll(r)
 		c.Assert(err, check.IsNil)
 		dataRead = len(data)
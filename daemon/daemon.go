@@ -43,6 +43,8 @@ import (
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord"
 	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/changearchive"
+	"github.com/snapcore/snapd/overlord/configstate/peerconf"
 	"github.com/snapcore/snapd/overlord/restart"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/standby"
@@ -78,6 +80,13 @@ type Daemon struct {
 	router          *mux.Router
 	standbyOpinions *standby.StandbyOpinions
 
+	// set when the download cache is shared with peers on the local
+	// network, protected by peerCacheMu
+	peerCacheMu       sync.Mutex
+	peerCacheListener net.Listener
+	peerCacheServe    *http.Server
+	peerCacheStopped  bool
+
 	// set to what kind of restart was requested (if any)
 	requestedRestart restart.RestartType
 	// reboot info needed to handle reboots
@@ -168,6 +177,12 @@ func (c *Command) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 		st.Lock()
 		_, rst := restart.Pending(st)
+		if rjson.Change != "" && ucred != nil {
+			// record who asked for the change
+			if chg := st.Change(rjson.Change); chg != nil {
+				chg.Set(changearchive.RequestedByKey, ucred.Uid)
+			}
+		}
 		st.Unlock()
 		rjson.addMaintenanceFromRestartType(rst)
 
@@ -385,6 +400,10 @@ func (d *Daemon) Start(ctx context.Context) (err error) {
 		return err
 	}
 
+	if err := d.initPeerCache(); err != nil {
+		logger.Noticef("cannot share download cache with peers: %v", err)
+	}
+
 	// the loop runs in its own goroutine
 	d.overlord.Loop()
 
@@ -411,6 +430,86 @@ func (d *Daemon) Start(ctx context.Context) (err error) {
 	return nil
 }
 
+// initPeerCache starts serving the download cache to peers on the local
+// network, as configured with the store.peers-listen and store.peers-token
+// options, and follows the changes to those options.
+func (d *Daemon) initPeerCache() error {
+	// this happens before the overlord loop runs, so the options cannot
+	// change in between
+	d.state.Lock()
+	peerconf.OnListenChanged(d.state, func(addr, token string) {
+		if err := d.servePeerCache(addr, token); err != nil {
+			logger.Noticef("cannot share download cache with peers: %v", err)
+		}
+	})
+	d.state.Unlock()
+
+	addr, token, err := peerconf.New(d.state).Listen()
+	if err != nil {
+		return err
+	}
+	return d.servePeerCache(addr, token)
+}
+
+// servePeerCache serves the download cache to peers on the given address,
+// replacing the current server if any. Connections to the replaced server are
+// closed, peers then download from the store.
+func (d *Daemon) servePeerCache(addr, token string) error {
+	d.peerCacheMu.Lock()
+	defer d.peerCacheMu.Unlock()
+
+	if d.peerCacheStopped {
+		return nil
+	}
+
+	if d.peerCacheServe != nil {
+		d.peerCacheServe.Close()
+		d.peerCacheServe = nil
+		d.peerCacheListener = nil
+	}
+
+	if addr == "" {
+		return nil
+	}
+	if token == "" {
+		return fmt.Errorf("store.peers-token is not set")
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	// the cache is only read from here, so the size limit is irrelevant
+	cache := store.NewCacheManager(dirs.SnapDownloadCacheDir, 0)
+	server := &http.Server{Handler: cache.PeerHandler(token)}
+	d.peerCacheListener = listener
+	d.peerCacheServe = server
+
+	go func() {
+		if err := server.Serve(listener); err != http.ErrServerClosed {
+			logger.Noticef("cannot share download cache with peers: %v", err)
+		}
+	}()
+	return nil
+}
+
+// stopPeerCache stops serving the download cache to peers, for good.
+func (d *Daemon) stopPeerCache(ctx context.Context) {
+	d.peerCacheMu.Lock()
+	defer d.peerCacheMu.Unlock()
+
+	d.peerCacheStopped = true
+	if d.peerCacheServe == nil {
+		return
+	}
+	if err := d.peerCacheServe.Shutdown(ctx); err != nil {
+		logger.Noticef("cannot stop sharing download cache with peers: %v", err)
+	}
+	d.peerCacheServe = nil
+	d.peerCacheListener = nil
+}
+
 // HandleRestart implements overlord.RestartBehavior.
 func (d *Daemon) HandleRestart(t restart.RestartType, rebootInfo *boot.RebootInfo) {
 	d.mu.Lock()
@@ -569,6 +668,7 @@ func (d *Daemon) Stop(sigCh chan<- os.Signal) error {
 	// context will likely already have been cancelled when we are
 	// called.
 	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	d.stopPeerCache(ctx)
 	d.tomb.Kill(d.serve.Shutdown(ctx))
 	cancel()
 
@@ -36,14 +36,18 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
+	"golang.org/x/crypto/sha3"
 	"gopkg.in/check.v1"
 
 	"github.com/snapcore/snapd/boot"
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord"
 	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/configstate/peerconf"
 	"github.com/snapcore/snapd/overlord/devicestate/devicestatetest"
 	"github.com/snapcore/snapd/overlord/ifacestate"
 	"github.com/snapcore/snapd/overlord/patch"
@@ -227,6 +231,35 @@ func (s *daemonSuite) TestCommandMethodDispatchRoot(c *check.C) {
 	c.Check(rec.Code, check.Equals, 405)
 }
 
+func (s *daemonSuite) TestCommandRecordsRequestedBy(c *check.C) {
+	d := s.newTestDaemon(c)
+	st := d.Overlord().State()
+
+	var chg *state.Change
+	cmd := &Command{d: d}
+	cmd.POST = func(*Command, *http.Request, *auth.UserState) Response {
+		st.Lock()
+		defer st.Unlock()
+		chg = st.NewChange("foo", "...")
+		return AsyncResponse(nil, chg.ID())
+	}
+	cmd.WriteAccess = openAccess{}
+	req, err := http.NewRequest("POST", "", nil)
+	c.Assert(err, check.IsNil)
+	req.RemoteAddr = fmt.Sprintf("pid=100;uid=42;socket=%s;", dirs.SnapdSocket)
+
+	rec := httptest.NewRecorder()
+	cmd.ServeHTTP(rec, req)
+	c.Check(rec.Code, check.Equals, 202)
+
+	st.Lock()
+	defer st.Unlock()
+	var uid uint32
+	c.Assert(chg.Get("requested-by", &uid), check.IsNil)
+	c.Check(uid, check.Equals, uint32(42))
+	c.Check(change2changeInfo(chg).RequestedBy, check.DeepEquals, &uid)
+}
+
 func (s *daemonSuite) TestCommandRestartingState(c *check.C) {
 	d := s.newTestDaemon(c)
 
@@ -668,6 +701,142 @@ version: 1`, si)
 	c.Check(s.notified, check.DeepEquals, []string{extendedTimeoutUSec, "READY=1", "STOPPING=1"})
 }
 
+func (s *daemonSuite) peerCacheGet(c *check.C, d *Daemon, digest string) (*http.Response, error) {
+	d.peerCacheMu.Lock()
+	addr := d.peerCacheListener.Addr()
+	d.peerCacheMu.Unlock()
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://%s/v1/peer-cache/%s", addr, digest), nil)
+	c.Assert(err, check.IsNil)
+	token := store.PeerDownloadToken("secret", digest, time.Now().Add(time.Minute))
+	req.Header.Set("Authorization", "Bearer "+token)
+	return http.DefaultClient.Do(req)
+}
+
+func (s *daemonSuite) TestStartStopSharesDownloadCacheWithPeers(c *check.C) {
+	d := s.newTestDaemon(c)
+	s.markSeeded(d)
+
+	st := d.overlord.State()
+	st.Lock()
+	tr := config.NewTransaction(st)
+	tr.Set("core", "store.peers-listen", "127.0.0.1:0")
+	tr.Set("core", "store.peers-token", "secret")
+	tr.Commit()
+	st.Unlock()
+
+	content := []byte("snap blob")
+	digest := fmt.Sprintf("%x", sha3.Sum384(content))
+	c.Assert(os.MkdirAll(dirs.SnapDownloadCacheDir, 0700), check.IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dirs.SnapDownloadCacheDir, digest), content, 0600), check.IsNil)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	d.snapdListener = l
+
+	c.Assert(d.Start(context.Background()), check.IsNil)
+	c.Assert(d.peerCacheListener, check.NotNil)
+	peerAddr := d.peerCacheListener.Addr()
+
+	rsp, err := s.peerCacheGet(c, d, digest)
+	c.Assert(err, check.IsNil)
+	body, err := io.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	c.Assert(err, check.IsNil)
+	c.Check(rsp.StatusCode, check.Equals, 200)
+	c.Check(body, check.DeepEquals, content)
+
+	c.Check(d.Stop(nil), check.IsNil)
+
+	_, err = http.Get(fmt.Sprintf("http://%s/v1/peer-cache/%s", peerAddr, digest))
+	c.Check(err, check.NotNil)
+
+	// changes after stopping are ignored
+	st.Lock()
+	peerconf.ListenChanged(st, "127.0.0.1:0", "secret")
+	st.Unlock()
+	c.Check(d.peerCacheServe, check.IsNil)
+}
+
+func (s *daemonSuite) TestPeerCacheFollowsConfigChanges(c *check.C) {
+	d := s.newTestDaemon(c)
+	s.markSeeded(d)
+
+	content := []byte("snap blob")
+	digest := fmt.Sprintf("%x", sha3.Sum384(content))
+	c.Assert(os.MkdirAll(dirs.SnapDownloadCacheDir, 0700), check.IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dirs.SnapDownloadCacheDir, digest), content, 0600), check.IsNil)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	d.snapdListener = l
+
+	// not shared initially
+	c.Assert(d.Start(context.Background()), check.IsNil)
+	defer d.Stop(nil)
+	c.Check(d.peerCacheListener, check.IsNil)
+
+	// the options are set
+	st := d.overlord.State()
+	st.Lock()
+	peerconf.ListenChanged(st, "127.0.0.1:0", "secret")
+	st.Unlock()
+	c.Assert(d.peerCacheListener, check.NotNil)
+	firstAddr := d.peerCacheListener.Addr()
+
+	rsp, err := s.peerCacheGet(c, d, digest)
+	c.Assert(err, check.IsNil)
+	rsp.Body.Close()
+	c.Check(rsp.StatusCode, check.Equals, 200)
+
+	// the token changes, the server is replaced
+	st.Lock()
+	peerconf.ListenChanged(st, "127.0.0.1:0", "other-secret")
+	st.Unlock()
+	c.Assert(d.peerCacheListener, check.NotNil)
+	c.Check(d.peerCacheListener.Addr(), check.Not(check.Equals), firstAddr)
+
+	rsp, err = s.peerCacheGet(c, d, digest)
+	c.Assert(err, check.IsNil)
+	rsp.Body.Close()
+	c.Check(rsp.StatusCode, check.Equals, 403)
+
+	_, err = http.Get(fmt.Sprintf("http://%s/v1/peer-cache/%s", firstAddr, digest))
+	c.Check(err, check.NotNil)
+
+	// the listen address is unset
+	st.Lock()
+	peerconf.ListenChanged(st, "", "other-secret")
+	st.Unlock()
+	c.Check(d.peerCacheListener, check.IsNil)
+	c.Check(d.peerCacheServe, check.IsNil)
+}
+
+func (s *daemonSuite) TestStartPeerCacheNeedsToken(c *check.C) {
+	d := s.newTestDaemon(c)
+	s.markSeeded(d)
+
+	st := d.overlord.State()
+	st.Lock()
+	tr := config.NewTransaction(st)
+	tr.Set("core", "store.peers-listen", "127.0.0.1:0")
+	tr.Commit()
+	st.Unlock()
+
+	logbuf, restore := logger.MockLogger()
+	defer restore()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	d.snapdListener = l
+
+	c.Assert(d.Start(context.Background()), check.IsNil)
+	c.Check(d.peerCacheListener, check.IsNil)
+	c.Check(logbuf.String(), testutil.Contains, "cannot share download cache with peers: store.peers-token is not set")
+
+	c.Check(d.Stop(nil), check.IsNil)
+}
+
 func (s *daemonSuite) TestRestartWiring(c *check.C) {
 	d := s.newTestDaemon(c)
 
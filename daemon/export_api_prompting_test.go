@@ -20,6 +20,7 @@
 package daemon
 
 import (
+	"github.com/snapcore/snapd/interfaces/prompting/requestrules"
 	"github.com/snapcore/snapd/testutil"
 )
 
@@ -37,9 +38,11 @@ type PatchRuleContents patchRuleContents
 
 // When the types have nested contents, must redefine with exported types.
 type PostRulesRequestBody struct {
-	Action         string               `json:"action"`
-	AddRule        *AddRuleContents     `json:"rule,omitempty"`
-	RemoveSelector *RemoveRulesSelector `json:"selector,omitempty"`
+	Action         string                       `json:"action"`
+	AddRule        *AddRuleContents             `json:"rule,omitempty"`
+	RemoveSelector *RemoveRulesSelector         `json:"selector,omitempty"`
+	ImportRules    []*requestrules.RuleContents `json:"rules,omitempty"`
+	Admin          bool                         `json:"admin,omitempty"`
 }
 
 type PostRuleRequestBody struct {
@@ -425,6 +425,14 @@ func MockConfdbstateGetView(f func(_ *state.State, _, _, _ string) (*confdb.View
 	return testutil.Mock(&confdbstateGetView, f)
 }
 
+func MockConfdbstateHistory(f func(*state.State, string, string) ([]*confdbstate.Revision, error)) (restore func()) {
+	return testutil.Mock(&confdbstateHistory, f)
+}
+
+func MockConfdbstateRollback(f func(*state.State, string, string, int) (*state.Change, error)) (restore func()) {
+	return testutil.Mock(&confdbstateRollback, f)
+}
+
 func MockConfdbstateSetViaView(f func(confdb.DataBag, *confdb.View, map[string]interface{}) error) (restore func()) {
 	return testutil.Mock(&confdbstateSetViaView, f)
 }
@@ -43,6 +43,7 @@ type aboutSnap struct {
 	info           *snap.Info
 	snapst         *snapstate.SnapState
 	health         *client.SnapHealth
+	healthHistory  []client.SnapHealth
 	refreshInhibit *client.SnapRefreshInhibit
 
 	hold       time.Time
@@ -78,6 +79,10 @@ func localSnapInfo(st *state.State, name string) (aboutSnap, error) {
 	if err != nil {
 		return aboutSnap{}, err
 	}
+	healthHistory, err := healthstate.History(st, name)
+	if err != nil {
+		return aboutSnap{}, err
+	}
 
 	userHold, gatingHold, err := getUserAndGatingHolds(st, name)
 	if err != nil {
@@ -90,6 +95,7 @@ func localSnapInfo(st *state.State, name string) (aboutSnap, error) {
 		info:           info,
 		snapst:         &snapst,
 		health:         clientHealthFromHealthstate(health),
+		healthHistory:  clientHealthHistoryFromHealthstate(healthHistory),
 		refreshInhibit: refreshInhibit,
 		hold:           userHold,
 		gatingHold:     gatingHold,
@@ -134,12 +140,17 @@ func allLocalSnapInfos(st *state.State, sel snapSelect, wanted map[string]bool)
 	if err != nil {
 		return nil, err
 	}
+	healthHistories, err := healthstate.AllHistory(st)
+	if err != nil {
+		return nil, err
+	}
 
 	for name, snapst := range snapStates {
 		if len(wanted) > 0 && !wanted[name] {
 			continue
 		}
 		health := clientHealthFromHealthstate(healths[name])
+		healthHistory := clientHealthHistoryFromHealthstate(healthHistories[name])
 
 		userHold, gatingHold, err := getUserAndGatingHolds(st, name)
 		if err != nil {
@@ -176,6 +187,7 @@ func allLocalSnapInfos(st *state.State, sel snapSelect, wanted map[string]bool)
 					info:           info,
 					snapst:         snapst,
 					health:         health,
+					healthHistory:  healthHistory,
 					refreshInhibit: refreshInhibit,
 					hold:           userHold,
 					gatingHold:     gatingHold,
@@ -197,6 +209,7 @@ func allLocalSnapInfos(st *state.State, sel snapSelect, wanted map[string]bool)
 				info:           info,
 				snapst:         snapst,
 				health:         health,
+				healthHistory:  healthHistory,
 				refreshInhibit: refreshInhibit,
 				hold:           userHold,
 				gatingHold:     gatingHold,
@@ -222,6 +235,17 @@ func clientHealthFromHealthstate(h *healthstate.HealthState) *client.SnapHealth
 	}
 }
 
+func clientHealthHistoryFromHealthstate(history []*healthstate.HealthState) []client.SnapHealth {
+	if len(history) == 0 {
+		return nil
+	}
+	clientHistory := make([]client.SnapHealth, 0, len(history))
+	for _, h := range history {
+		clientHistory = append(clientHistory, *clientHealthFromHealthstate(h))
+	}
+	return clientHistory
+}
+
 func clientSnapRefreshInhibit(st *state.State, snapst *snapstate.SnapState, instanceName string) *client.SnapRefreshInhibit {
 	proceedTime := snapst.RefreshInhibitProceedTime(st)
 	if proceedTime.After(time.Now()) || snapstate.IsSnapMonitored(st, instanceName) {
@@ -266,6 +290,7 @@ func mapLocal(about aboutSnap, sd clientutil.StatusDecorator) *client.Snap {
 		result.MountedFrom, _ = os.Readlink(result.MountedFrom)
 	}
 	result.Health = about.health
+	result.HealthHistory = about.healthHistory
 	result.RefreshInhibit = about.refreshInhibit
 
 	if !about.hold.IsZero() {
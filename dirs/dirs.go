@@ -79,8 +79,11 @@ var (
 
 	SnapStateFile     string
 	SnapStateLockFile string
+	SnapStateJournal  string
 	SnapSystemKeyFile string
 
+	SnapChangeArchiveFile string
+
 	SnapRepairConfigFile string
 	SnapRepairDir        string
 	SnapRepairStateFile  string
@@ -349,6 +352,11 @@ func SnapStateFileUnder(rootdir string) string {
 	return filepath.Join(rootdir, snappyDir, "state.json")
 }
 
+// SnapStateJournalUnder returns the path to snapd state journal under rootdir.
+func SnapStateJournalUnder(rootdir string) string {
+	return filepath.Join(rootdir, snappyDir, "state.journal")
+}
+
 // SnapStateLockFileUnder returns the path to snapd state lock file under rootdir.
 func SnapStateLockFileUnder(rootdir string) string {
 	return filepath.Join(rootdir, snappyDir, "state.lock")
@@ -498,6 +506,8 @@ func SetRootDir(rootdir string) {
 
 	SnapStateFile = SnapStateFileUnder(rootdir)
 	SnapStateLockFile = SnapStateLockFileUnder(rootdir)
+	SnapStateJournal = SnapStateJournalUnder(rootdir)
+	SnapChangeArchiveFile = filepath.Join(rootdir, snappyDir, "changes-archive")
 	SnapSystemKeyFile = filepath.Join(rootdir, snappyDir, "system-key")
 
 	SnapCacheDir = filepath.Join(rootdir, "/var/cache/snapd")
@@ -75,6 +75,8 @@ const (
 	Confdbs
 	// AppArmorPrompting enables AppArmor to prompt the user for permission when apps perform certain operations.
 	AppArmorPrompting
+	// StateJournal enables journaling incremental changes to the snapd state instead of rewriting it in full.
+	StateJournal
 
 	// lastFeature is the final known feature, it is only used for testing.
 	lastFeature
@@ -123,6 +125,8 @@ var featureNames = map[SnapdFeature]string{
 	Confdbs:               "confdbs",
 
 	AppArmorPrompting: "apparmor-prompting",
+
+	StateJournal: "state-journal",
 }
 
 // featuresEnabledWhenUnset contains a set of features that are enabled when not explicitly configured.
@@ -148,6 +152,8 @@ var featuresExported = map[SnapdFeature]bool{
 	RefreshAppAwarenessUX: true,
 	Confdbs:               true,
 	AppArmorPrompting:     true,
+
+	StateJournal: true,
 }
 
 var (
@@ -64,6 +64,7 @@ func (*featureSuite) TestName(c *C) {
 	check(features.RefreshAppAwarenessUX, "refresh-app-awareness-ux")
 	check(features.Confdbs, "confdbs")
 	check(features.AppArmorPrompting, "apparmor-prompting")
+	check(features.StateJournal, "state-journal")
 
 	c.Check(tested, Equals, features.NumberOfFeatures())
 	c.Check(func() { _ = features.SnapdFeature(1000).String() }, PanicMatches, "unknown feature flag code 1000")
@@ -104,6 +105,7 @@ func (*featureSuite) TestIsExported(c *C) {
 	check(features.RefreshAppAwarenessUX, true)
 	check(features.Confdbs, true)
 	check(features.AppArmorPrompting, true)
+	check(features.StateJournal, true)
 
 	c.Check(tested, Equals, features.NumberOfFeatures())
 }
@@ -229,6 +231,7 @@ func (*featureSuite) TestIsEnabledWhenUnset(c *C) {
 	check(features.RefreshAppAwarenessUX, false)
 	check(features.Confdbs, false)
 	check(features.AppArmorPrompting, false)
+	check(features.StateJournal, false)
 
 	c.Check(tested, Equals, features.NumberOfFeatures())
 }
@@ -0,0 +1,239 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package gadget
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/snapcore/snapd/osutil"
+)
+
+const (
+	// SlotA is the slot of A/B paired structures held by the structure
+	// declaring the pair.
+	SlotA = "a"
+	// SlotB is the slot of A/B paired structures held by the structure
+	// named in the pair declaration.
+	SlotB = "b"
+)
+
+// ABSlotSwitcher switches the slot of A/B paired structures the system boots
+// with. All A/B pairs of the gadget switch together.
+type ABSlotSwitcher interface {
+	// ActiveSlot returns the slot the system was booted with.
+	ActiveSlot() (string, error)
+	// TrySlot makes the bootloader try the given slot on next boot. The
+	// slot becomes active only once the boot is marked as successful,
+	// otherwise the bootloader reverts to the current slot. An empty slot
+	// cancels a pending switch.
+	TrySlot(slot string) error
+}
+
+var abSlotSwitcher func() (ABSlotSwitcher, error)
+
+// RegisterABSlotSwitcher registers the function returning the switcher used
+// when updating A/B paired structures.
+func RegisterABSlotSwitcher(f func() (ABSlotSwitcher, error)) {
+	abSlotSwitcher = f
+}
+
+func otherSlot(slot string) string {
+	if slot == SlotB {
+		return SlotA
+	}
+	return SlotB
+}
+
+// abPairStructure returns the structure holding the B slot of the given A/B
+// paired structure.
+func abPairStructure(vol *Volume, ps *LaidOutStructure) (*VolumeStructure, error) {
+	for i := range vol.Structure {
+		if vol.Structure[i].Name == ps.VolumeStructure.Update.ABPair {
+			return &vol.Structure[i], nil
+		}
+	}
+	return nil, fmt.Errorf("cannot find structure %q paired with %v", ps.VolumeStructure.Update.ABPair, ps)
+}
+
+// abRawStructureUpdater implements updates of raw (bare) structures paired in
+// A/B slots. The update is written to the structure of the inactive slot,
+// which the bootloader tries on next boot, while the active slot is left
+// untouched and the bootloader reverts to it if the new one fails to boot.
+type abRawStructureUpdater struct {
+	*RawStructureWriter
+	backupDir string
+	// slots holds the location of the structure of each slot
+	slots    map[string]StructureLocation
+	switcher ABSlotSwitcher
+	// target is the inactive slot receiving the update
+	target string
+	// switched is set once the bootloader was set up to try the target
+	switched bool
+}
+
+// newABRawStructureUpdater returns an updater for the given A/B paired raw
+// structure located at locA, whose pair is located at locB.
+func newABRawStructureUpdater(contentDir string, ps *LaidOutStructure, backupDir string, locA, locB StructureLocation) (*abRawStructureUpdater, error) {
+	if backupDir == "" {
+		return nil, fmt.Errorf("internal error: backup directory cannot be unset")
+	}
+	if locA.Device == "" || locB.Device == "" {
+		return nil, fmt.Errorf("internal error: A/B paired structures must have a device set")
+	}
+	if abSlotSwitcher == nil {
+		return nil, fmt.Errorf("cannot update A/B paired structure %v: switching slots is not supported", ps)
+	}
+	switcher, err := abSlotSwitcher()
+	if err != nil {
+		return nil, fmt.Errorf("cannot update A/B paired structure %v: %v", ps, err)
+	}
+	rw, err := NewRawStructureWriter(contentDir, ps)
+	if err != nil {
+		return nil, err
+	}
+	return &abRawStructureUpdater{
+		RawStructureWriter: rw,
+		backupDir:          backupDir,
+		slots: map[string]StructureLocation{
+			SlotA: locA,
+			SlotB: locB,
+		},
+		switcher: switcher,
+	}, nil
+}
+
+func (r *abRawStructureUpdater) sameCheckpointPath() string {
+	return filepath.Join(r.backupDir, fmt.Sprintf("struct-%v-ab.same", r.ps.VolumeStructure.YamlIndex))
+}
+
+// structureForSlot returns the structure laid out at the location of the
+// given slot.
+func (r *abRawStructureUpdater) structureForSlot(slot string) (device string, ps *LaidOutStructure) {
+	loc := r.slots[slot]
+	shifted := ShiftStructureTo(*r.ps, loc.Offset)
+	return loc.Device, &shifted
+}
+
+func (r *abRawStructureUpdater) sameAsActive(active string) (bool, error) {
+	device, ps := r.structureForSlot(active)
+	disk, err := os.Open(device)
+	if err != nil {
+		return false, fmt.Errorf("cannot open device for reading: %v", err)
+	}
+	defer disk.Close()
+
+	for _, pc := range ps.LaidOutContent {
+		if _, err := disk.Seek(int64(pc.StartOffset), io.SeekStart); err != nil {
+			return false, fmt.Errorf("cannot seek to content start offset 0x%x: %v", pc.StartOffset, err)
+		}
+		h := crypto.SHA1.New()
+		if _, err := io.CopyN(h, disk, int64(pc.Size)); err != nil {
+			return false, fmt.Errorf("cannot read image %v: %v", pc, err)
+		}
+		updateDigest, _, err := osutil.FileDigest(filepath.Join(r.contentDir, pc.Image), crypto.SHA1)
+		if err != nil {
+			return false, fmt.Errorf("cannot checksum update image: %v", err)
+		}
+		if !bytes.Equal(h.Sum(nil), updateDigest) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Backup finds the inactive slot that will receive the update. The active
+// slot is not modified by the update, so there is nothing to back up, but if
+// it already carries the new content the update is skipped.
+func (r *abRawStructureUpdater) Backup() error {
+	active, err := r.switcher.ActiveSlot()
+	if err != nil {
+		return fmt.Errorf("cannot determine active slot: %v", err)
+	}
+	if active != SlotA && active != SlotB {
+		return fmt.Errorf("invalid active slot %q", active)
+	}
+	r.target = otherSlot(active)
+
+	if osutil.FileExists(r.sameCheckpointPath()) {
+		return nil
+	}
+	same, err := r.sameAsActive(active)
+	if err != nil {
+		return err
+	}
+	if same {
+		if err := osutil.AtomicWriteFile(r.sameCheckpointPath(), nil, 0644, 0); err != nil {
+			return fmt.Errorf("cannot create a checkpoint file: %v", err)
+		}
+	}
+	return nil
+}
+
+// Update writes the structure content to the inactive slot and sets up the
+// bootloader to try it on next boot.
+func (r *abRawStructureUpdater) Update() error {
+	if r.target == "" {
+		return errors.New("internal error: update target slot is unset")
+	}
+	if osutil.FileExists(r.sameCheckpointPath()) {
+		return ErrNoUpdate
+	}
+
+	device, ps := r.structureForSlot(r.target)
+	disk, err := os.OpenFile(device, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("cannot open device for writing: %v", err)
+	}
+	defer disk.Close()
+
+	for _, pc := range ps.LaidOutContent {
+		if err := r.writeRawImage(disk, &pc); err != nil {
+			return fmt.Errorf("cannot update image %v in slot %s: %v", pc, r.target, err)
+		}
+	}
+	if err := disk.Sync(); err != nil {
+		return fmt.Errorf("cannot sync device: %v", err)
+	}
+
+	if err := r.switcher.TrySlot(r.target); err != nil {
+		return fmt.Errorf("cannot switch to slot %s: %v", r.target, err)
+	}
+	r.switched = true
+	return nil
+}
+
+// Rollback cancels the switch to the updated slot. The content of the active
+// slot was never modified.
+func (r *abRawStructureUpdater) Rollback() error {
+	if !r.switched {
+		return nil
+	}
+	if err := r.switcher.TrySlot(""); err != nil {
+		return fmt.Errorf("cannot cancel switch to slot %s: %v", r.target, err)
+	}
+	r.switched = false
+	return nil
+}
@@ -0,0 +1,238 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package gadget_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/gadget"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type mockABSlotSwitcher struct {
+	active    string
+	activeErr error
+	tryErr    error
+	tried     []string
+}
+
+func (m *mockABSlotSwitcher) ActiveSlot() (string, error) {
+	return m.active, m.activeErr
+}
+
+func (m *mockABSlotSwitcher) TrySlot(slot string) error {
+	m.tried = append(m.tried, slot)
+	return m.tryErr
+}
+
+type abSlotTestSuite struct {
+	testutil.BaseTest
+
+	dir      string
+	backup   string
+	disk     string
+	switcher *mockABSlotSwitcher
+}
+
+var _ = Suite(&abSlotTestSuite{})
+
+const (
+	abSlotAOffset = 4096
+	abSlotBOffset = 8192
+)
+
+func (s *abSlotTestSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+	s.dir = c.MkDir()
+	s.backup = c.MkDir()
+
+	s.disk = filepath.Join(s.dir, "disk.img")
+	mutateFile(c, s.disk, 3*4096, []mutateWrite{
+		{[]byte("old firmware"), abSlotAOffset},
+		{[]byte("older firmware"), abSlotBOffset},
+	})
+	makeSizedFile(c, filepath.Join(s.dir, "fw.img"), 128, []byte("new firmware"))
+
+	s.switcher = &mockABSlotSwitcher{active: gadget.SlotA}
+	s.AddCleanup(gadget.MockABSlotSwitcher(func() (gadget.ABSlotSwitcher, error) {
+		return s.switcher, nil
+	}))
+}
+
+func (s *abSlotTestSuite) laidOutStructure() *gadget.LaidOutStructure {
+	return &gadget.LaidOutStructure{
+		OnDiskStructure: gadget.OnDiskStructure{
+			StartOffset: abSlotAOffset,
+		},
+		VolumeStructure: &gadget.VolumeStructure{
+			Name: "fw-a",
+			Size: 4096,
+			Update: gadget.VolumeUpdate{
+				ABPair: "fw-b",
+			},
+			EnclosingVolume: &gadget.Volume{},
+		},
+		LaidOutContent: []gadget.LaidOutContent{
+			{
+				VolumeContent: &gadget.VolumeContent{
+					Image: "fw.img",
+				},
+				StartOffset: abSlotAOffset,
+				Size:        128,
+			},
+		},
+	}
+}
+
+func (s *abSlotTestSuite) newUpdater(c *C) gadget.Updater {
+	up, err := gadget.NewABRawStructureUpdater(s.dir, s.laidOutStructure(), s.backup,
+		gadget.StructureLocation{Device: s.disk, Offset: abSlotAOffset},
+		gadget.StructureLocation{Device: s.disk, Offset: abSlotBOffset})
+	c.Assert(err, IsNil)
+	return up
+}
+
+func (s *abSlotTestSuite) readSlot(c *C, offset int64) string {
+	f, err := os.Open(s.disk)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	buf := make([]byte, 14)
+	_, err = f.ReadAt(buf, offset)
+	c.Assert(err, IsNil)
+	return string(buf)
+}
+
+func (s *abSlotTestSuite) TestUpdateWritesInactiveSlotAndSwitches(c *C) {
+	up := s.newUpdater(c)
+
+	err := up.Backup()
+	c.Assert(err, IsNil)
+	err = up.Update()
+	c.Assert(err, IsNil)
+
+	// the active slot is untouched
+	c.Check(s.readSlot(c, abSlotAOffset), Equals, "old firmware\x00\x00")
+	c.Check(s.readSlot(c, abSlotBOffset), Equals, "new firmware\x00\x00")
+	c.Check(s.switcher.tried, DeepEquals, []string{gadget.SlotB})
+
+	// rolling back cancels the switch
+	err = up.Rollback()
+	c.Assert(err, IsNil)
+	c.Check(s.switcher.tried, DeepEquals, []string{gadget.SlotB, ""})
+	c.Check(s.readSlot(c, abSlotAOffset), Equals, "old firmware\x00\x00")
+}
+
+func (s *abSlotTestSuite) TestUpdateFromSlotB(c *C) {
+	s.switcher.active = gadget.SlotB
+	up := s.newUpdater(c)
+
+	err := up.Backup()
+	c.Assert(err, IsNil)
+	err = up.Update()
+	c.Assert(err, IsNil)
+
+	c.Check(s.readSlot(c, abSlotAOffset), Equals, "new firmware\x00\x00")
+	c.Check(s.readSlot(c, abSlotBOffset), Equals, "older firmware")
+	c.Check(s.switcher.tried, DeepEquals, []string{gadget.SlotA})
+}
+
+func (s *abSlotTestSuite) TestUpdateSameAsActive(c *C) {
+	mutateFile(c, s.disk, 3*4096, []mutateWrite{
+		{[]byte("new firmware"), abSlotAOffset},
+	})
+	up := s.newUpdater(c)
+
+	err := up.Backup()
+	c.Assert(err, IsNil)
+	c.Check(filepath.Join(s.backup, "struct-0-ab.same"), testutil.FilePresent)
+	err = up.Update()
+	c.Assert(err, Equals, gadget.ErrNoUpdate)
+
+	c.Check(s.readSlot(c, abSlotBOffset), Equals, "\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+	c.Check(s.switcher.tried, HasLen, 0)
+
+	// nothing to roll back
+	err = up.Rollback()
+	c.Assert(err, IsNil)
+	c.Check(s.switcher.tried, HasLen, 0)
+}
+
+func (s *abSlotTestSuite) TestBackupErrors(c *C) {
+	s.switcher.activeErr = errors.New("boom")
+	up := s.newUpdater(c)
+	err := up.Backup()
+	c.Assert(err, ErrorMatches, "cannot determine active slot: boom")
+
+	s.switcher.activeErr = nil
+	s.switcher.active = "c"
+	err = up.Backup()
+	c.Assert(err, ErrorMatches, `invalid active slot "c"`)
+
+	s.switcher.active = gadget.SlotA
+	err = os.Remove(filepath.Join(s.dir, "fw.img"))
+	c.Assert(err, IsNil)
+	err = up.Backup()
+	c.Assert(err, ErrorMatches, "cannot checksum update image: .*")
+}
+
+func (s *abSlotTestSuite) TestUpdateErrors(c *C) {
+	up := s.newUpdater(c)
+	err := up.Update()
+	c.Assert(err, ErrorMatches, "internal error: update target slot is unset")
+
+	s.switcher.tryErr = errors.New("boom")
+	err = up.Backup()
+	c.Assert(err, IsNil)
+	err = up.Update()
+	c.Assert(err, ErrorMatches, "cannot switch to slot b: boom")
+
+	// the switch was not done, so there is nothing to cancel
+	s.switcher.tried = nil
+	err = up.Rollback()
+	c.Assert(err, IsNil)
+	c.Check(s.switcher.tried, HasLen, 0)
+}
+
+func (s *abSlotTestSuite) TestNewUpdaterErrors(c *C) {
+	locA := gadget.StructureLocation{Device: s.disk, Offset: abSlotAOffset}
+	locB := gadget.StructureLocation{Device: s.disk, Offset: abSlotBOffset}
+
+	_, err := gadget.NewABRawStructureUpdater(s.dir, s.laidOutStructure(), "", locA, locB)
+	c.Assert(err, ErrorMatches, "internal error: backup directory cannot be unset")
+
+	_, err = gadget.NewABRawStructureUpdater(s.dir, s.laidOutStructure(), s.backup, locA, gadget.StructureLocation{})
+	c.Assert(err, ErrorMatches, "internal error: A/B paired structures must have a device set")
+
+	restore := gadget.MockABSlotSwitcher(func() (gadget.ABSlotSwitcher, error) {
+		return nil, errors.New("bootloader does not support A/B gadget structures")
+	})
+	defer restore()
+	_, err = gadget.NewABRawStructureUpdater(s.dir, s.laidOutStructure(), s.backup, locA, locB)
+	c.Assert(err, ErrorMatches, `cannot update A/B paired structure #0 \("fw-a"\): bootloader does not support A/B gadget structures`)
+
+	restore = gadget.MockABSlotSwitcher(nil)
+	defer restore()
+	_, err = gadget.NewABRawStructureUpdater(s.dir, s.laidOutStructure(), s.backup, locA, locB)
+	c.Assert(err, ErrorMatches, `cannot update A/B paired structure #0 \("fw-a"\): switching slots is not supported`)
+}
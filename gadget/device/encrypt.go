@@ -75,6 +75,12 @@ func SaveKeyUnder(deviceFDEDir string) string {
 	return filepath.Join(deviceFDEDir, "ubuntu-save.key")
 }
 
+// SnapshotSealedKeyUnder returns the path of the sealed key device-bound
+// snapshot keys are derived from.
+func SnapshotSealedKeyUnder(deviceFDEDir string) string {
+	return filepath.Join(deviceFDEDir, "snapshots.sealed-key")
+}
+
 // RecoveryKeyUnder returns the path of the recovery key.
 func RecoveryKeyUnder(deviceFDEDir string) string {
 	return filepath.Join(deviceFDEDir, "recovery.key")
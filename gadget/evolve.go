@@ -0,0 +1,409 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package gadget
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/gadget/quantity"
+	"github.com/snapcore/snapd/osutil/disks"
+	"github.com/snapcore/snapd/strutil"
+)
+
+// LayoutChangeKind is the kind of a change to the partition layout of a disk.
+type LayoutChangeKind int
+
+const (
+	// LayoutChangeGrow grows the last partition of the disk, and its
+	// filesystem if it has one.
+	LayoutChangeGrow LayoutChangeKind = iota
+	// LayoutChangeCreate creates a new partition in the free space after
+	// the existing ones, and its filesystem if it has one.
+	LayoutChangeCreate
+)
+
+// filesystems that can be grown in place
+var growableFilesystems = []string{"ext4"}
+
+// LayoutChange is a change to the partition layout of a disk required by a
+// gadget update.
+type LayoutChange struct {
+	Kind LayoutChangeKind
+	// GadgetStructure is the structure from the new gadget.
+	GadgetStructure *VolumeStructure
+	// DiskStructure is the partition as it is expected on disk once the
+	// change is applied. The device node is not known for partitions that
+	// are yet to be created.
+	DiskStructure *OnDiskStructure
+	// OldSize is the size of the partition before it is grown.
+	OldSize quantity.Size
+}
+
+func (c *LayoutChange) String() string {
+	ds := c.DiskStructure
+	switch c.Kind {
+	case LayoutChangeGrow:
+		return fmt.Sprintf("grow partition %d (%q) from %s to %s",
+			ds.DiskIndex, c.GadgetStructure.Name, c.OldSize.IECString(), ds.Size.IECString())
+	case LayoutChangeCreate:
+		fs := "no filesystem"
+		if c.GadgetStructure.HasFilesystem() {
+			fs = c.GadgetStructure.LinuxFilesystem() + " filesystem"
+		}
+		return fmt.Sprintf("create partition %d (%q) at offset %s with size %s and %s",
+			ds.DiskIndex, c.GadgetStructure.Name, ds.StartOffset.IECString(), ds.Size.IECString(), fs)
+	default:
+		return fmt.Sprintf("unknown change to partition %d", ds.DiskIndex)
+	}
+}
+
+// VolumeLayoutEvolution holds the changes to the partition layout of the disk
+// of a gadget volume needed to go from the current to the new gadget.
+type VolumeLayoutEvolution struct {
+	// Volume is the volume from the new gadget.
+	Volume *Volume
+	// Disk is the disk of the volume, as it is before the changes.
+	Disk *OnDiskVolume
+	// Changes is the list of changes, ordered by offset on disk.
+	Changes []LayoutChange
+}
+
+// String returns a report of the changes, suitable for showing the changes
+// before applying them.
+func (e *VolumeLayoutEvolution) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "volume %s on %s:", e.Volume.Name, e.Disk.Device)
+	for i := range e.Changes {
+		fmt.Fprintf(&b, "\n- %s", &e.Changes[i])
+	}
+	return b.String()
+}
+
+// isGrownLastStructure returns whether the structure at toIdx is the last
+// structure of the old volume with a new size range entirely above the old
+// one.
+func isGrownLastStructure(fromV *Volume, fromIdx int, toV *Volume, toIdx int) bool {
+	if fromIdx != len(fromV.Structure)-1 {
+		return false
+	}
+	from := &fromV.Structure[fromIdx]
+	to := &toV.Structure[toIdx]
+	// structures with a partial size have no size set
+	return from.Size != 0 && to.Size != 0 && to.MinSize > from.Size
+}
+
+// hasLayoutEvolution returns whether the new volume grows the last structure
+// or adds structures.
+func hasLayoutEvolution(old, new *Volume) bool {
+	n := len(old.Structure)
+	switch {
+	case len(new.Structure) > n:
+		return true
+	case len(new.Structure) < n || n == 0:
+		return false
+	}
+	return isGrownLastStructure(old, n-1, new, n-1)
+}
+
+func canAddStructure(vs *VolumeStructure) error {
+	switch {
+	case !vs.IsPartition():
+		return fmt.Errorf("only partitions can be added")
+	case vs.Role != "":
+		return fmt.Errorf("structures with role %q cannot be added", vs.Role)
+	case vs.Size == 0:
+		return fmt.Errorf("size of new structures must be defined")
+	case vs.HasFilesystem() && vs.Filesystem == "":
+		return fmt.Errorf("filesystem of new structures must be defined")
+	}
+	return nil
+}
+
+// checkLayoutEvolution checks that changes to the partition layout between the
+// old and new definitions of a volume are supported. Only growing the last
+// structure and adding partitions after the existing structures are possible,
+// whether the disk has room for them is checked when planning the changes.
+func checkLayoutEvolution(old, new *Volume) error {
+	n := len(old.Structure)
+	if len(new.Structure) < n {
+		return fmt.Errorf("cannot change the number of structures within volume from %v to %v", n, len(new.Structure))
+	}
+	if len(new.Structure) > n {
+		// structures are sorted by offset, new ones must come last
+		for i := range old.Structure {
+			if new.Structure[i].YamlIndex != old.Structure[i].YamlIndex {
+				return fmt.Errorf("new structures must be placed after the existing ones")
+			}
+		}
+		for i := n; i < len(new.Structure); i++ {
+			vs := &new.Structure[i]
+			if err := canAddStructure(vs); err != nil {
+				return fmt.Errorf("cannot add structure #%d (%q): %v", vs.YamlIndex, vs.Name, err)
+			}
+		}
+	}
+	if n > 0 && isGrownLastStructure(old, n-1, new, n-1) {
+		vs := &new.Structure[n-1]
+		if !vs.IsPartition() {
+			return fmt.Errorf("cannot grow structure #%d (%q): only partitions can be grown", vs.YamlIndex, vs.Name)
+		}
+		if vs.HasFilesystem() && !strutil.ListContains(growableFilesystems, vs.LinuxFilesystem()) {
+			return fmt.Errorf("cannot grow structure #%d (%q): %s filesystems cannot be grown", vs.YamlIndex, vs.Name, vs.LinuxFilesystem())
+		}
+	}
+	return nil
+}
+
+// PlanVolumeLayoutEvolution checks the changes to the partition layout between
+// the old and new definitions of a volume against the disk of the volume, and
+// returns the changes to apply to the disk, or nil if there are none. The disk
+// must match the old volume. The last partition on disk can be grown if it is
+// the last structure of the volume, and new partitions can be created in the
+// free space after it.
+func PlanVolumeLayoutEvolution(old, new *Volume, diskVol *OnDiskVolume, opts *VolumeCompatibilityOptions) (*VolumeLayoutEvolution, error) {
+	if err := checkLayoutEvolution(old, new); err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = &VolumeCompatibilityOptions{}
+	}
+	compatOpts := *opts
+	compatOpts.AssumeCreatablePartitionsCreated = true
+	gadgetToDiskStruct, err := EnsureVolumeCompatibility(old, diskVol, &compatOpts)
+	if err != nil {
+		return nil, fmt.Errorf("volume %s is not compatible with disk %s: %v", old.Name, diskVol.Device, err)
+	}
+
+	sectorSize := diskVol.SectorSize
+	usableEnd := quantity.Offset(diskVol.UsableSectorsEnd * uint64(sectorSize))
+	// where the last partition on disk ends, new partitions go after it
+	diskEnd := quantity.Offset(0)
+	lastDiskIndex := 0
+	for _, ds := range diskVol.Structure {
+		if end := ds.StartOffset + quantity.Offset(ds.Size); end > diskEnd {
+			diskEnd = end
+		}
+		if ds.DiskIndex > lastDiskIndex {
+			lastDiskIndex = ds.DiskIndex
+		}
+	}
+
+	evo := &VolumeLayoutEvolution{
+		Volume: new,
+		Disk:   diskVol,
+	}
+
+	// prevEnd is where the previous structure ends, which is where a new
+	// structure without an explicit offset starts
+	prevEnd := quantity.Offset(0)
+	if n := len(old.Structure); n > 0 {
+		ds := gadgetToDiskStruct[old.Structure[n-1].YamlIndex]
+		prevEnd = ds.StartOffset + quantity.Offset(ds.Size)
+
+		vs := &new.Structure[n-1]
+		if isGrownLastStructure(old, n-1, new, n-1) && ds.Size < vs.MinSize {
+			if prevEnd != diskEnd {
+				return nil, fmt.Errorf("cannot grow partition %s: not the last partition on disk", ds.Node)
+			}
+			if ds.PartitionFSType == "crypto_LUKS" {
+				return nil, fmt.Errorf("cannot grow encrypted partition %s", ds.Node)
+			}
+			newEnd := ds.StartOffset + quantity.Offset(vs.Size)
+			if newEnd > usableEnd {
+				return nil, fmt.Errorf("cannot grow partition %s to %s: not enough space on disk %s",
+					ds.Node, vs.Size.IECString(), diskVol.Device)
+			}
+			grown := *ds
+			grown.Size = vs.Size
+			evo.Changes = append(evo.Changes, LayoutChange{
+				Kind:            LayoutChangeGrow,
+				GadgetStructure: vs,
+				DiskStructure:   &grown,
+				OldSize:         ds.Size,
+			})
+			prevEnd = newEnd
+			diskEnd = newEnd
+		}
+	}
+
+	for i := len(old.Structure); i < len(new.Structure); i++ {
+		vs := &new.Structure[i]
+		offset := prevEnd
+		if vs.Offset != nil {
+			offset = *vs.Offset
+		}
+		if uint64(offset)%uint64(sectorSize) != 0 || vs.Size%sectorSize != 0 {
+			return nil, fmt.Errorf("cannot create partition for structure %q: offset or size is not a multiple of disk sector size %v",
+				vs.Name, sectorSize)
+		}
+		if offset < diskEnd {
+			return nil, fmt.Errorf("cannot create partition for structure %q: offset %d overlaps with existing partitions ending at %d",
+				vs.Name, offset, diskEnd)
+		}
+		end := offset + quantity.Offset(vs.Size)
+		if end > usableEnd {
+			return nil, fmt.Errorf("cannot create partition for structure %q: not enough space on disk %s",
+				vs.Name, diskVol.Device)
+		}
+		lastDiskIndex++
+		evo.Changes = append(evo.Changes, LayoutChange{
+			Kind:            LayoutChangeCreate,
+			GadgetStructure: vs,
+			DiskStructure: &OnDiskStructure{
+				Name:             vs.Name,
+				PartitionFSLabel: vs.Label,
+				Type:             vs.Type,
+				PartitionFSType:  vs.LinuxFilesystem(),
+				StartOffset:      offset,
+				DiskIndex:        lastDiskIndex,
+				Size:             vs.Size,
+			},
+		})
+		prevEnd = end
+		diskEnd = end
+	}
+
+	if len(evo.Changes) == 0 {
+		return nil, nil
+	}
+	return evo, nil
+}
+
+// LayoutEvolutionsForUpdate returns the changes to the partition layout of the
+// disks needed to update from the old to the new gadget, in a deterministic
+// order. The disks are found using the traits saved at install time.
+//
+// The disks of the volumes as they were before a previous attempt at changing
+// their layout can be passed with savedDisks, by volume name, in which case
+// the changes are planned from those disks, as the disks may match neither
+// the old nor the new gadget anymore.
+func LayoutEvolutionsForUpdate(model Model, old, new GadgetData, savedDisks map[string]*OnDiskVolume) ([]*VolumeLayoutEvolution, error) {
+	oldVolumes, _, err := VolumesForCurrentDevice(old.Info)
+	if err != nil {
+		return nil, fmt.Errorf("cannot update gadget assets: %v", err)
+	}
+	newVolumes, _, err := VolumesForCurrentDevice(new.Info)
+	if err != nil {
+		return nil, fmt.Errorf("cannot update gadget assets: %v", err)
+	}
+
+	var volNames []string
+	for volName, oldVol := range oldVolumes {
+		// a mismatch of volumes is reported by Update
+		if newVol, ok := newVolumes[volName]; ok && hasLayoutEvolution(oldVol, newVol) {
+			volNames = append(volNames, volName)
+		}
+	}
+	if len(volNames) == 0 {
+		return nil, nil
+	}
+	sort.Strings(volNames)
+
+	volToDeviceMapping, err := LoadDiskVolumesDeviceTraits(dirs.SnapDeviceDir)
+	if err != nil {
+		return nil, err
+	}
+	isPreUC20 := (model.Grade() == asserts.ModelGradeUnset)
+
+	var evolutions []*VolumeLayoutEvolution
+	for _, volName := range volNames {
+		traits, ok := volToDeviceMapping[volName]
+		if !ok {
+			return nil, fmt.Errorf("cannot change the partition layout of volume %s: no disk mapping was saved for it", volName)
+		}
+		oldVol := oldVolumes[volName]
+		validateOpts := &DiskVolumeValidationOptions{
+			AllowImplicitSystemData:     isPreUC20,
+			ExpectedStructureEncryption: traits.StructureEncryption,
+		}
+		if _, _, err := searchVolumeWithTraitsAndMatchParts(newVolumes[volName], traits, validateOpts); err == nil {
+			// the disk already has the new layout, which happens when
+			// retrying an update that failed after changing the layout
+			continue
+		}
+		diskVol := savedDisks[volName]
+		if diskVol != nil {
+			if err := checkSavedDisk(diskVol); err != nil {
+				return nil, fmt.Errorf("cannot change the partition layout of volume %s: %v", volName, err)
+			}
+		} else {
+			disk, _, err := searchVolumeWithTraitsAndMatchParts(oldVol, traits, validateOpts)
+			if err != nil {
+				return nil, fmt.Errorf("cannot change the partition layout of volume %s: %v", volName, err)
+			}
+			diskVol, err = OnDiskVolumeFromDisk(disk)
+			if err != nil {
+				return nil, err
+			}
+		}
+		compatOpts := &VolumeCompatibilityOptions{
+			AllowImplicitSystemData:     isPreUC20,
+			ExpectedStructureEncryption: traits.StructureEncryption,
+		}
+		evo, err := PlanVolumeLayoutEvolution(oldVol, newVolumes[volName], diskVol, compatOpts)
+		if err != nil {
+			return nil, fmt.Errorf("cannot change the partition layout of volume %s: %v", volName, err)
+		}
+		if evo != nil {
+			evolutions = append(evolutions, evo)
+		}
+	}
+	return evolutions, nil
+}
+
+// checkSavedDisk verifies that the device of a saved disk is still the same
+// disk.
+func checkSavedDisk(diskVol *OnDiskVolume) error {
+	disk, err := disks.DiskFromDeviceName(diskVol.Device)
+	if err != nil {
+		return err
+	}
+	if disk.DiskID() != diskVol.ID {
+		return fmt.Errorf("disk %s has changed: expected ID %s, got %s", diskVol.Device, diskVol.ID, disk.DiskID())
+	}
+	return nil
+}
+
+// UpdateDiskVolumeDeviceTraits verifies that the disk device matches the
+// volume and updates the saved traits of the volume accordingly. It is meant
+// to be used once the partition layout of the disk was changed.
+func UpdateDiskVolumeDeviceTraits(vol *Volume, device string) error {
+	volToDeviceMapping, err := LoadDiskVolumesDeviceTraits(dirs.SnapDeviceDir)
+	if err != nil {
+		return err
+	}
+	oldTraits, ok := volToDeviceMapping[vol.Name]
+	if !ok {
+		return fmt.Errorf("no disk mapping was saved for volume %s", vol.Name)
+	}
+	validateOpts := &DiskVolumeValidationOptions{
+		ExpectedStructureEncryption: oldTraits.StructureEncryption,
+	}
+	traits, err := DiskTraitsFromDeviceAndValidate(vol, device, validateOpts)
+	if err != nil {
+		return err
+	}
+	volToDeviceMapping[vol.Name] = traits
+	return SaveDiskVolumesDeviceTraits(dirs.SnapDeviceDir, volToDeviceMapping)
+}
@@ -0,0 +1,448 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package gadget_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/gadget"
+	"github.com/snapcore/snapd/gadget/quantity"
+	"github.com/snapcore/snapd/osutil/disks"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type evolveTestSuite struct {
+	testutil.BaseTest
+}
+
+var _ = Suite(&evolveTestSuite{})
+
+func (s *evolveTestSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+}
+
+const evolveOldYaml = `
+volumes:
+  foo:
+    bootloader: u-boot
+    schema: gpt
+    structure:
+      - name: nofspart
+        type: EBBEADAF-22C9-E33B-8F5D-0E81686A68CB
+        size: 1M
+      - name: data
+        filesystem: ext4
+        filesystem-label: data
+        type: 83,0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        size: 10M
+`
+
+const evolveNewYaml = `
+volumes:
+  foo:
+    bootloader: u-boot
+    schema: gpt
+    structure:
+      - name: nofspart
+        type: EBBEADAF-22C9-E33B-8F5D-0E81686A68CB
+        size: 1M
+      - name: data
+        filesystem: ext4
+        filesystem-label: data
+        type: 83,0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        size: 20M
+      - name: extra
+        filesystem: ext4
+        filesystem-label: extra
+        type: 83,0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        size: 8M
+`
+
+var evolveNoFsPartition = disks.Partition{
+	PartitionLabel:   "nofspart",
+	PartitionUUID:    "C5A930DF-E86A-4BAE-A4C5-C861353796E6",
+	Major:            525,
+	Minor:            2,
+	KernelDeviceNode: "/dev/foo1",
+	KernelDevicePath: "/sys/block/foo/foo1",
+	DiskIndex:        1,
+	StartInBytes:     uint64(quantity.OffsetMiB),
+	SizeInBytes:      uint64(quantity.SizeMiB),
+}
+
+func evolveMockDisk(data uint64, extra bool) *disks.MockDiskMapping {
+	dm := &disks.MockDiskMapping{
+		DevNode: "/dev/foo",
+		DevPath: "/sys/block/foo",
+		DevNum:  "525:1",
+		// assume 34 sectors at end for GPT headers backup
+		DiskUsableSectorEnd: 64*1024*1024/512 - 34,
+		DiskSizeInBytes:     64 * 1024 * 1024,
+		SectorSizeBytes:     512,
+		DiskSchema:          "gpt",
+		ID:                  "651AC800-B9FB-4B9D-B6D3-A72EB54D9006",
+		Structure: []disks.Partition{
+			evolveNoFsPartition,
+			{
+				PartitionLabel:   "data",
+				PartitionUUID:    "DA2ADBC8-90DF-4B1D-A93F-A92516C12E01",
+				FilesystemLabel:  "data",
+				FilesystemUUID:   "3E3D392C-5D50-4C84-8A6E-09B7A3FEA2C7",
+				FilesystemType:   "ext4",
+				Major:            525,
+				Minor:            3,
+				KernelDeviceNode: "/dev/foo2",
+				KernelDevicePath: "/sys/block/foo/foo2",
+				DiskIndex:        2,
+				StartInBytes:     2 * uint64(quantity.OffsetMiB),
+				SizeInBytes:      data,
+			},
+		},
+	}
+	if extra {
+		dm.Structure = append(dm.Structure, disks.Partition{
+			PartitionLabel:   "extra",
+			PartitionUUID:    "0F4BE1E1-1B1C-4F66-9D5C-6D5E4C4E4A6B",
+			FilesystemLabel:  "extra",
+			FilesystemUUID:   "5B1E2A4E-3C3B-4D5B-8E7F-7E4D2A0B9C1D",
+			FilesystemType:   "ext4",
+			Major:            525,
+			Minor:            4,
+			KernelDeviceNode: "/dev/foo3",
+			KernelDevicePath: "/sys/block/foo/foo3",
+			DiskIndex:        3,
+			StartInBytes:     2*uint64(quantity.OffsetMiB) + data,
+			SizeInBytes:      8 * uint64(quantity.SizeMiB),
+		})
+	}
+	return dm
+}
+
+func (s *evolveTestSuite) mockDisk(dm *disks.MockDiskMapping) {
+	s.AddCleanup(disks.MockDeviceNameToDiskMapping(map[string]*disks.MockDiskMapping{
+		"/dev/foo": dm,
+	}))
+	s.AddCleanup(disks.MockDevicePathToDiskMapping(map[string]*disks.MockDiskMapping{
+		"/sys/block/foo": dm,
+	}))
+}
+
+func (s *evolveTestSuite) readVolume(c *C, yaml string) *gadget.Volume {
+	info, err := gadget.InfoFromGadgetYaml([]byte(yaml), nil)
+	c.Assert(err, IsNil)
+	return info.Volumes["foo"]
+}
+
+func (s *evolveTestSuite) TestPlanVolumeLayoutEvolution(c *C) {
+	s.mockDisk(evolveMockDisk(10*uint64(quantity.SizeMiB), false))
+	oldVol := s.readVolume(c, evolveOldYaml)
+	newVol := s.readVolume(c, evolveNewYaml)
+	diskVol, err := gadget.OnDiskVolumeFromDevice("/dev/foo")
+	c.Assert(err, IsNil)
+
+	evo, err := gadget.PlanVolumeLayoutEvolution(oldVol, newVol, diskVol, nil)
+	c.Assert(err, IsNil)
+	c.Assert(evo, NotNil)
+	c.Check(evo.Volume, Equals, newVol)
+	c.Check(evo.Disk, Equals, diskVol)
+	c.Assert(evo.Changes, HasLen, 2)
+
+	grow := evo.Changes[0]
+	c.Check(grow.Kind, Equals, gadget.LayoutChangeGrow)
+	c.Check(grow.GadgetStructure, Equals, &newVol.Structure[1])
+	c.Check(grow.OldSize, Equals, 10*quantity.SizeMiB)
+	c.Check(*grow.DiskStructure, DeepEquals, gadget.OnDiskStructure{
+		Name:             "data",
+		PartitionFSLabel: "data",
+		PartitionFSType:  "ext4",
+		StartOffset:      2 * quantity.OffsetMiB,
+		Node:             "/dev/foo2",
+		DiskIndex:        2,
+		Size:             20 * quantity.SizeMiB,
+	})
+	// the disk is left untouched
+	c.Check(diskVol.Structure[1].Size, Equals, 10*quantity.SizeMiB)
+
+	create := evo.Changes[1]
+	c.Check(create.Kind, Equals, gadget.LayoutChangeCreate)
+	c.Check(create.GadgetStructure, Equals, &newVol.Structure[2])
+	c.Check(*create.DiskStructure, DeepEquals, gadget.OnDiskStructure{
+		Name:             "extra",
+		PartitionFSLabel: "extra",
+		Type:             "83,0FC63DAF-8483-4772-8E79-3D69D8477DE4",
+		PartitionFSType:  "ext4",
+		StartOffset:      22 * quantity.OffsetMiB,
+		DiskIndex:        3,
+		Size:             8 * quantity.SizeMiB,
+	})
+
+	c.Check(evo.String(), Equals, `volume foo on /dev/foo:
+- grow partition 2 ("data") from 10 MiB to 20 MiB
+- create partition 3 ("extra") at offset 22 MiB with size 8 MiB and ext4 filesystem`)
+}
+
+func (s *evolveTestSuite) TestPlanVolumeLayoutEvolutionNoChanges(c *C) {
+	s.mockDisk(evolveMockDisk(10*uint64(quantity.SizeMiB), false))
+	oldVol := s.readVolume(c, evolveOldYaml)
+	diskVol, err := gadget.OnDiskVolumeFromDevice("/dev/foo")
+	c.Assert(err, IsNil)
+
+	evo, err := gadget.PlanVolumeLayoutEvolution(oldVol, s.readVolume(c, evolveOldYaml), diskVol, nil)
+	c.Assert(err, IsNil)
+	c.Check(evo, IsNil)
+}
+
+func (s *evolveTestSuite) TestPlanVolumeLayoutEvolutionCreateOnly(c *C) {
+	s.mockDisk(evolveMockDisk(10*uint64(quantity.SizeMiB), false))
+	oldVol := s.readVolume(c, evolveOldYaml)
+	newVol := s.readVolume(c, evolveOldYaml+`
+      - name: raw
+        type: EBBEADAF-22C9-E33B-8F5D-0E81686A68CC
+        offset: 16M
+        size: 1M
+`)
+	diskVol, err := gadget.OnDiskVolumeFromDevice("/dev/foo")
+	c.Assert(err, IsNil)
+
+	evo, err := gadget.PlanVolumeLayoutEvolution(oldVol, newVol, diskVol, nil)
+	c.Assert(err, IsNil)
+	c.Assert(evo, NotNil)
+	c.Assert(evo.Changes, HasLen, 1)
+	c.Check(evo.Changes[0].DiskStructure.StartOffset, Equals, 16*quantity.OffsetMiB)
+	c.Check(evo.String(), Equals, `volume foo on /dev/foo:
+- create partition 3 ("raw") at offset 16 MiB with size 1 MiB and no filesystem`)
+}
+
+func (s *evolveTestSuite) TestPlanVolumeLayoutEvolutionErrors(c *C) {
+	s.mockDisk(evolveMockDisk(10*uint64(quantity.SizeMiB), false))
+	oldVol := s.readVolume(c, evolveOldYaml)
+	diskVol, err := gadget.OnDiskVolumeFromDevice("/dev/foo")
+	c.Assert(err, IsNil)
+
+	const grownDataYaml = `
+volumes:
+  foo:
+    bootloader: u-boot
+    schema: gpt
+    structure:
+      - name: nofspart
+        type: EBBEADAF-22C9-E33B-8F5D-0E81686A68CB
+        size: 1M
+      - name: data
+        filesystem: ext4
+        filesystem-label: data
+        type: 83,0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        size: 100M
+`
+	for i, tc := range []struct {
+		yaml string
+		err  string
+	}{{
+		yaml: grownDataYaml,
+		err:  `cannot grow partition /dev/foo2 to 100 MiB: not enough space on disk /dev/foo`,
+	}, {
+		yaml: evolveOldYaml + `
+      - name: extra
+        type: 83,0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        size: 60M
+`,
+		err: `cannot create partition for structure "extra": not enough space on disk /dev/foo`,
+	}, {
+		yaml: evolveOldYaml + `
+      - name: extra
+        type: 83,0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        size: 1000
+`,
+		err: `cannot create partition for structure "extra": offset or size is not a multiple of disk sector size 512`,
+	}, {
+		yaml: evolveOldYaml + `
+      - name: ubuntu-save
+        role: system-save
+        filesystem: ext4
+        type: 83,0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        size: 8M
+`,
+		err: `cannot add structure #2 \("ubuntu-save"\): structures with role "system-save" cannot be added`,
+	}} {
+		c.Logf("tc: %v", i)
+		_, err := gadget.PlanVolumeLayoutEvolution(oldVol, s.readVolume(c, tc.yaml), diskVol, nil)
+		c.Check(err, ErrorMatches, tc.err)
+	}
+
+	// the disk must match the old volume
+	_, err = gadget.PlanVolumeLayoutEvolution(s.readVolume(c, grownDataYaml), s.readVolume(c, evolveNewYaml), diskVol, nil)
+	c.Check(err, ErrorMatches, `volume foo is not compatible with disk /dev/foo: .*`)
+}
+
+func (s *evolveTestSuite) TestPlanVolumeLayoutEvolutionNotLastOnDisk(c *C) {
+	s.mockDisk(evolveMockDisk(10*uint64(quantity.SizeMiB), false))
+	diskVol, err := gadget.OnDiskVolumeFromDevice("/dev/foo")
+	c.Assert(err, IsNil)
+
+	const partialYaml = `
+volumes:
+  foo:
+    bootloader: u-boot
+    schema: gpt
+    partial: [structure]
+    structure:
+      - name: nofspart
+        type: EBBEADAF-22C9-E33B-8F5D-0E81686A68CB
+        size: 1M
+`
+	_, err = gadget.PlanVolumeLayoutEvolution(s.readVolume(c, partialYaml), s.readVolume(c, `
+volumes:
+  foo:
+    bootloader: u-boot
+    schema: gpt
+    partial: [structure]
+    structure:
+      - name: nofspart
+        type: EBBEADAF-22C9-E33B-8F5D-0E81686A68CB
+        size: 2M
+`), diskVol, nil)
+	c.Check(err, ErrorMatches, `cannot grow partition /dev/foo1: not the last partition on disk`)
+}
+
+func (s *evolveTestSuite) saveTraits(c *C, yaml string) {
+	traits, err := gadget.DiskTraitsFromDeviceAndValidate(s.readVolume(c, yaml), "/dev/foo", nil)
+	c.Assert(err, IsNil)
+	err = gadget.SaveDiskVolumesDeviceTraits(dirs.SnapDeviceDir, map[string]gadget.DiskVolumeDeviceTraits{
+		"foo": traits,
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *evolveTestSuite) gadgetData(c *C, yaml string) gadget.GadgetData {
+	info, err := gadget.InfoFromGadgetYaml([]byte(yaml), nil)
+	c.Assert(err, IsNil)
+	return gadget.GadgetData{Info: info, RootDir: c.MkDir()}
+}
+
+func (s *evolveTestSuite) TestLayoutEvolutionsForUpdate(c *C) {
+	s.mockDisk(evolveMockDisk(10*uint64(quantity.SizeMiB), false))
+	s.saveTraits(c, evolveOldYaml)
+
+	evos, err := gadget.LayoutEvolutionsForUpdate(uc20Model, s.gadgetData(c, evolveOldYaml), s.gadgetData(c, evolveNewYaml), nil)
+	c.Assert(err, IsNil)
+	c.Assert(evos, HasLen, 1)
+	c.Check(evos[0].Volume.Name, Equals, "foo")
+	c.Check(evos[0].Disk.Device, Equals, "/dev/foo")
+	c.Check(evos[0].Changes, HasLen, 2)
+}
+
+func (s *evolveTestSuite) TestLayoutEvolutionsForUpdateNoLayoutChange(c *C) {
+	// no disk is needed when the layout does not change
+	evos, err := gadget.LayoutEvolutionsForUpdate(uc20Model, s.gadgetData(c, evolveOldYaml), s.gadgetData(c, evolveOldYaml), nil)
+	c.Assert(err, IsNil)
+	c.Check(evos, IsNil)
+}
+
+func (s *evolveTestSuite) TestLayoutEvolutionsForUpdateAlreadyApplied(c *C) {
+	s.mockDisk(evolveMockDisk(10*uint64(quantity.SizeMiB), false))
+	s.saveTraits(c, evolveOldYaml)
+	// the layout was changed by a previous attempt
+	s.mockDisk(evolveMockDisk(20*uint64(quantity.SizeMiB), true))
+
+	evos, err := gadget.LayoutEvolutionsForUpdate(uc20Model, s.gadgetData(c, evolveOldYaml), s.gadgetData(c, evolveNewYaml), nil)
+	c.Assert(err, IsNil)
+	c.Check(evos, IsNil)
+}
+
+func (s *evolveTestSuite) TestLayoutEvolutionsForUpdateSavedDisks(c *C) {
+	s.mockDisk(evolveMockDisk(10*uint64(quantity.SizeMiB), false))
+	s.saveTraits(c, evolveOldYaml)
+	savedDisk, err := gadget.OnDiskVolumeFromDevice("/dev/foo")
+	c.Assert(err, IsNil)
+
+	// a previous attempt grew the data partition but failed to create the
+	// extra one, the disk matches neither the old nor the new gadget
+	s.mockDisk(evolveMockDisk(20*uint64(quantity.SizeMiB), false))
+	_, err = gadget.LayoutEvolutionsForUpdate(uc20Model, s.gadgetData(c, evolveOldYaml), s.gadgetData(c, evolveNewYaml), nil)
+	c.Check(err, ErrorMatches, `cannot change the partition layout of volume foo: cannot find physical disk laid out to map with volume foo`)
+
+	// the same changes are planned from the saved disk
+	evos, err := gadget.LayoutEvolutionsForUpdate(uc20Model, s.gadgetData(c, evolveOldYaml), s.gadgetData(c, evolveNewYaml), map[string]*gadget.OnDiskVolume{
+		"foo": savedDisk,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(evos, HasLen, 1)
+	c.Check(evos[0].Disk, DeepEquals, savedDisk)
+	c.Check(evos[0].Changes, HasLen, 2)
+	c.Check(evos[0].Changes[0].OldSize, Equals, 10*quantity.SizeMiB)
+
+	// but not if the device is another disk now
+	otherDisk := evolveMockDisk(20*uint64(quantity.SizeMiB), false)
+	otherDisk.ID = "0F4BE1E1-1B1C-4F66-9D5C-6D5E4C4E4A6B"
+	s.mockDisk(otherDisk)
+	_, err = gadget.LayoutEvolutionsForUpdate(uc20Model, s.gadgetData(c, evolveOldYaml), s.gadgetData(c, evolveNewYaml), map[string]*gadget.OnDiskVolume{
+		"foo": savedDisk,
+	})
+	c.Check(err, ErrorMatches, `cannot change the partition layout of volume foo: disk /dev/foo has changed: expected ID 651AC800-B9FB-4B9D-B6D3-A72EB54D9006, got 0F4BE1E1-1B1C-4F66-9D5C-6D5E4C4E4A6B`)
+}
+
+func (s *evolveTestSuite) TestLayoutEvolutionsForUpdateErrors(c *C) {
+	_, err := gadget.LayoutEvolutionsForUpdate(uc20Model, s.gadgetData(c, evolveOldYaml), s.gadgetData(c, evolveNewYaml), nil)
+	c.Check(err, ErrorMatches, `cannot change the partition layout of volume foo: no disk mapping was saved for it`)
+
+	s.mockDisk(evolveMockDisk(10*uint64(quantity.SizeMiB), false))
+	s.saveTraits(c, evolveOldYaml)
+	_, err = gadget.LayoutEvolutionsForUpdate(uc20Model, s.gadgetData(c, evolveOldYaml), s.gadgetData(c, evolveOldYaml+`
+      - name: extra
+        type: 83,0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        size: 60M
+`), nil)
+	c.Check(err, ErrorMatches, `cannot change the partition layout of volume foo: cannot create partition for structure "extra": not enough space on disk /dev/foo`)
+
+	// the disk does not match the old gadget anymore
+	s.mockDisk(evolveMockDisk(12*uint64(quantity.SizeMiB), false))
+	_, err = gadget.LayoutEvolutionsForUpdate(uc20Model, s.gadgetData(c, evolveOldYaml), s.gadgetData(c, evolveNewYaml), nil)
+	c.Check(err, ErrorMatches, `cannot change the partition layout of volume foo: cannot find physical disk laid out to map with volume foo`)
+}
+
+func (s *evolveTestSuite) TestUpdateDiskVolumeDeviceTraits(c *C) {
+	s.mockDisk(evolveMockDisk(10*uint64(quantity.SizeMiB), false))
+	s.saveTraits(c, evolveOldYaml)
+
+	// the new layout is not on disk yet
+	newVol := s.readVolume(c, evolveNewYaml)
+	err := gadget.UpdateDiskVolumeDeviceTraits(newVol, "/dev/foo")
+	c.Assert(err, ErrorMatches, `volume foo is not compatible with disk /dev/foo: .*`)
+
+	s.mockDisk(evolveMockDisk(20*uint64(quantity.SizeMiB), true))
+	err = gadget.UpdateDiskVolumeDeviceTraits(newVol, "/dev/foo")
+	c.Assert(err, IsNil)
+
+	mapping, err := gadget.LoadDiskVolumesDeviceTraits(dirs.SnapDeviceDir)
+	c.Assert(err, IsNil)
+	traits := mapping["foo"]
+	c.Assert(traits.Structure, HasLen, 3)
+	c.Check(traits.Structure[1].Size, Equals, 20*quantity.SizeMiB)
+	c.Check(traits.Structure[2].PartitionLabel, Equals, "extra")
+	c.Check(traits.Structure[2].Offset, Equals, 22*quantity.OffsetMiB)
+}
+
+func (s *evolveTestSuite) TestUpdateDiskVolumeDeviceTraitsNoMapping(c *C) {
+	err := gadget.UpdateDiskVolumeDeviceTraits(s.readVolume(c, evolveNewYaml), "/dev/foo")
+	c.Assert(err, ErrorMatches, `no disk mapping was saved for volume foo`)
+}
@@ -36,6 +36,7 @@ var (
 	ValidateRole            = validateRole
 	ValidateVolume          = validateVolume
 	ValidateOffsetWrite     = validateOffsetWrite
+	ValidateABPairs         = validateABPairs
 
 	SetImplicitForVolumeStructure = setImplicitForVolumeStructure
 
@@ -53,6 +54,7 @@ var (
 
 	NewRawStructureUpdater      = newRawStructureUpdater
 	NewMountedFilesystemUpdater = newMountedFilesystemUpdater
+	NewABRawStructureUpdater    = newABRawStructureUpdater
 
 	ParseRelativeOffset = parseRelativeOffset
 
@@ -106,3 +108,7 @@ func MockFindVolumesMatchingDeviceAssignment(f func(gi *Info) (map[string]*Volum
 	VolumesForCurrentDeviceAssignment = f
 	return r
 }
+
+func MockABSlotSwitcher(f func() (ABSlotSwitcher, error)) (restore func()) {
+	return testutil.Mock(&abSlotSwitcher, f)
+}
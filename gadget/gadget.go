@@ -341,8 +341,9 @@ type VolumeStructure struct {
 	// ID is the GPT partition ID, this should always be made upper case for
 	// comparison purposes.
 	ID string `yaml:"id" json:"id"`
-	// Filesystem used for the partition, 'vfat', 'vfat-{16,32}', 'ext4' or 'none' for
-	// structures of type 'bare'. 'vfat' is a synonymous for 'vfat-32'.
+	// Filesystem used for the partition, 'vfat', 'vfat-{16,32}', 'ext4',
+	// 'btrfs', 'xfs' or 'none' for structures of type 'bare'. 'vfat' is a
+	// synonymous for 'vfat-32'.
 	Filesystem string `yaml:"filesystem" json:"filesystem"`
 	// Content of the structure
 	Content []VolumeContent `yaml:"content" json:"content"`
@@ -563,6 +564,11 @@ func (vc VolumeContent) String() string {
 type VolumeUpdate struct {
 	Edition  edition.Number `yaml:"edition" json:"edition"`
 	Preserve []string       `yaml:"preserve" json:"preserve"`
+	// ABPair is the name of the structure holding the B slot of an A/B
+	// pair whose A slot is this structure. Updates to A/B paired
+	// structures are written to the inactive slot, which the bootloader
+	// then tries on next boot.
+	ABPair string `yaml:"ab-pair,omitempty" json:"ab-pair,omitempty"`
 }
 
 // VolumeAssignment is an optional set of volume-to-disk assignments
@@ -1038,7 +1044,9 @@ func hasGrade(m Model) bool {
 	return m != nil && m.Grade() != asserts.ModelGradeUnset
 }
 
-func compatWithPibootOrIndeterminate(m Model) bool {
+// compatWithUC20BootloaderOrIndeterminate returns true unless the model is
+// known to be a pre-UC20 one, which cannot use UC20-only bootloaders.
+func compatWithUC20BootloaderOrIndeterminate(m Model) bool {
 	return m == nil || m.Grade() != asserts.ModelGradeUnset
 }
 
@@ -1239,13 +1247,13 @@ func InfoFromGadgetYaml(gadgetYaml []byte, model Model) (*Info, error) {
 			// pass
 		case "grub", "u-boot", "android-boot", "lk":
 			bootloadersFound += 1
-		case "piboot":
-			if !compatWithPibootOrIndeterminate(model) {
-				return nil, errors.New("piboot bootloader valid only for UC20 onwards")
+		case "piboot", "sd-boot":
+			if !compatWithUC20BootloaderOrIndeterminate(model) {
+				return nil, fmt.Errorf("%s bootloader valid only for UC20 onwards", v.Bootloader)
 			}
 			bootloadersFound += 1
 		default:
-			return nil, errors.New("bootloader must be one of grub, u-boot, android-boot, piboot or lk")
+			return nil, errors.New("bootloader must be one of grub, u-boot, android-boot, piboot, sd-boot or lk")
 		}
 	}
 	switch {
@@ -1559,9 +1567,48 @@ func validateVolume(vol *Volume) error {
 		}
 	}
 
+	if err := validateABPairs(vol); err != nil {
+		return err
+	}
+
 	return validateCrossVolumeStructure(vol)
 }
 
+// validateABPairs checks that structures of A/B pairs are compatible with
+// each other.
+func validateABPairs(vol *Volume) error {
+	pairedWith := make(map[string]string)
+	for _, vs := range vol.Structure {
+		if vs.Update.ABPair == "" {
+			continue
+		}
+		var pair *VolumeStructure
+		for i := range vol.Structure {
+			if vol.Structure[i].Name == vs.Update.ABPair {
+				pair = &vol.Structure[i]
+				break
+			}
+		}
+		if pair == nil {
+			return fmt.Errorf("structure %q is paired with unknown structure %q", vs.Name, vs.Update.ABPair)
+		}
+		if other, ok := pairedWith[pair.Name]; ok {
+			return fmt.Errorf("structure %q is paired with structure %q already paired with %q", vs.Name, pair.Name, other)
+		}
+		pairedWith[pair.Name] = vs.Name
+		if pair.Update.ABPair != "" {
+			return fmt.Errorf("structure %q is paired with structure %q which is paired with %q", vs.Name, pair.Name, pair.Update.ABPair)
+		}
+		if pair.HasFilesystem() || len(pair.Content) > 0 {
+			return fmt.Errorf("structure %q is paired with structure %q which cannot have content", vs.Name, pair.Name)
+		}
+		if pair.Size != vs.Size {
+			return fmt.Errorf("structure %q is paired with structure %q of different size", vs.Name, pair.Name)
+		}
+	}
+	return nil
+}
+
 // isMBR returns whether the structure is the MBR and can be used before setImplicitForVolume
 func isMBR(vs *VolumeStructure) bool {
 	if vs.Role == schemaMBR {
@@ -1648,6 +1695,9 @@ func contentCheckerCreate(vs *VolumeStructure, vol *Volume) func(*VolumeContent)
 	}
 }
 
+// maxXfsLabelLen is the maximum length of an XFS filesystem label.
+const maxXfsLabelLen = 12
+
 func validateVolumeStructure(vs *VolumeStructure, vol *Volume) error {
 	if !vs.hasPartialSize() {
 		if vs.Size == 0 {
@@ -1670,9 +1720,12 @@ func validateVolumeStructure(vs *VolumeStructure, vol *Volume) error {
 		}
 		return fmt.Errorf("invalid %s: %v", what, err)
 	}
-	if vs.Filesystem != "" && !strutil.ListContains([]string{"ext4", "vfat", "vfat-16", "vfat-32", "none"}, vs.Filesystem) {
+	if vs.Filesystem != "" && !strutil.ListContains([]string{"ext4", "vfat", "vfat-16", "vfat-32", "btrfs", "xfs", "none"}, vs.Filesystem) {
 		return fmt.Errorf("invalid filesystem %q", vs.Filesystem)
 	}
+	if vs.Filesystem == "xfs" && len(vs.Label) > maxXfsLabelLen {
+		return fmt.Errorf("invalid label %q: xfs labels cannot be longer than %d characters", vs.Label, maxXfsLabelLen)
+	}
 
 	contentChecker := contentCheckerCreate(vs, vol)
 	for i, c := range vs.Content {
@@ -1855,6 +1908,14 @@ func validateStructureUpdate(vs *VolumeStructure) error {
 	if !vs.HasFilesystem() && len(vs.Update.Preserve) > 0 {
 		return errors.New("preserving files during update is not supported for non-filesystem structures")
 	}
+	if vs.Update.ABPair != "" {
+		if vs.HasFilesystem() {
+			return errors.New("A/B updates are not supported for filesystem structures")
+		}
+		if vs.Update.ABPair == vs.Name {
+			return errors.New("structure cannot be paired with itself")
+		}
+	}
 
 	names := make(map[string]bool, len(vs.Update.Preserve))
 	for _, n := range vs.Update.Preserve {
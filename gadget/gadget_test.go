@@ -953,7 +953,25 @@ volumes:
 	c.Assert(err, IsNil)
 
 	_, err = gadget.ReadInfo(s.dir, nil)
-	c.Assert(err, ErrorMatches, "bootloader must be one of grub, u-boot, android-boot, piboot or lk")
+	c.Assert(err, ErrorMatches, "bootloader must be one of grub, u-boot, android-boot, piboot, sd-boot or lk")
+}
+
+func (s *gadgetYamlTestSuite) TestReadGadgetYamlSdbootBootloader(c *C) {
+	mockGadgetYaml := []byte(`
+volumes:
+ pc:
+  bootloader: sd-boot
+`)
+
+	err := os.WriteFile(s.gadgetYamlPath, mockGadgetYaml, 0644)
+	c.Assert(err, IsNil)
+
+	ginfo, err := gadget.ReadInfo(s.dir, uc20Mod)
+	c.Assert(err, IsNil)
+	c.Check(ginfo.Volumes["pc"].Bootloader, Equals, "sd-boot")
+
+	_, err = gadget.ReadInfo(s.dir, coreMod)
+	c.Assert(err, ErrorMatches, "sd-boot bootloader valid only for UC20 onwards")
 }
 
 func (s *gadgetYamlTestSuite) TestReadGadgetYamlEmptyBootloader(c *C) {
@@ -1372,7 +1390,9 @@ func (s *gadgetYamlTestSuite) TestValidateFilesystem(c *C) {
 		{"vfat-32", ""},
 		{"ext4", ""},
 		{"none", ""},
-		{"btrfs", `invalid filesystem "btrfs"`},
+		{"btrfs", ""},
+		{"xfs", ""},
+		{"zfs", `invalid filesystem "zfs"`},
 	} {
 		c.Logf("tc: %v %+v", i, tc.s)
 
@@ -1385,6 +1405,29 @@ func (s *gadgetYamlTestSuite) TestValidateFilesystem(c *C) {
 	}
 }
 
+func (s *gadgetYamlTestSuite) TestValidateFilesystemLabel(c *C) {
+	vol := &gadget.Volume{Schema: "gpt"}
+	for i, tc := range []struct {
+		fs    string
+		label string
+		err   string
+	}{
+		{"xfs", "ubuntu-data", ""},
+		{"xfs", "twelve-chars", ""},
+		{"xfs", "thirteen-char", `invalid label "thirteen-char": xfs labels cannot be longer than 12 characters`},
+		{"btrfs", "thirteen-char", ""},
+	} {
+		c.Logf("tc: %v %+v", i, tc)
+
+		err := gadget.ValidateVolumeStructure(&gadget.VolumeStructure{Filesystem: tc.fs, Label: tc.label, Type: "21686148-6449-6E6F-744E-656564454649", Size: 123, EnclosingVolume: vol}, vol)
+		if tc.err != "" {
+			c.Check(err, ErrorMatches, tc.err)
+		} else {
+			c.Check(err, IsNil)
+		}
+	}
+}
+
 func (s *gadgetYamlTestSuite) TestValidateVolumeSchema(c *C) {
 	for i, tc := range []struct {
 		s   string
@@ -1771,6 +1814,137 @@ func (s *gadgetYamlTestSuite) TestValidateStructureUpdatePreserveDuplicates(c *C
 	c.Check(err, ErrorMatches, `duplicate "preserve" entry "foo"`)
 }
 
+func (s *gadgetYamlTestSuite) TestValidateStructureUpdateABPair(c *C) {
+	gv := &gadget.Volume{Schema: "gpt"}
+
+	err := gadget.ValidateVolumeStructure(&gadget.VolumeStructure{
+		Name:            "fw-a",
+		Type:            "bare",
+		Update:          gadget.VolumeUpdate{ABPair: "fw-b"},
+		Size:            512,
+		EnclosingVolume: gv,
+	}, gv)
+	c.Check(err, IsNil)
+
+	err = gadget.ValidateVolumeStructure(&gadget.VolumeStructure{
+		Name:            "fw-a",
+		Type:            "21686148-6449-6E6F-744E-656564454649",
+		Filesystem:      "vfat",
+		Update:          gadget.VolumeUpdate{ABPair: "fw-b"},
+		Size:            512,
+		EnclosingVolume: gv,
+	}, gv)
+	c.Check(err, ErrorMatches, "A/B updates are not supported for filesystem structures")
+
+	err = gadget.ValidateVolumeStructure(&gadget.VolumeStructure{
+		Name:            "fw-a",
+		Type:            "bare",
+		Update:          gadget.VolumeUpdate{ABPair: "fw-a"},
+		Size:            512,
+		EnclosingVolume: gv,
+	}, gv)
+	c.Check(err, ErrorMatches, "structure cannot be paired with itself")
+}
+
+func (s *gadgetYamlTestSuite) TestValidateABPairs(c *C) {
+	for _, tc := range []struct {
+		structs []gadget.VolumeStructure
+		err     string
+	}{{
+		structs: []gadget.VolumeStructure{
+			{Name: "fw-a", Size: 512, Update: gadget.VolumeUpdate{ABPair: "fw-b"}, Content: []gadget.VolumeContent{{Image: "fw.img"}}},
+			{Name: "fw-b", Size: 512},
+		},
+	}, {
+		structs: []gadget.VolumeStructure{
+			{Name: "fw-a", Size: 512, Update: gadget.VolumeUpdate{ABPair: "fw-c"}},
+			{Name: "fw-b", Size: 512},
+		},
+		err: `structure "fw-a" is paired with unknown structure "fw-c"`,
+	}, {
+		structs: []gadget.VolumeStructure{
+			{Name: "fw-a", Size: 512, Update: gadget.VolumeUpdate{ABPair: "fw-b"}},
+			{Name: "fw-b", Size: 512},
+			{Name: "boot-a", Size: 512, Update: gadget.VolumeUpdate{ABPair: "fw-b"}},
+		},
+		err: `structure "boot-a" is paired with structure "fw-b" already paired with "fw-a"`,
+	}, {
+		structs: []gadget.VolumeStructure{
+			{Name: "fw-a", Size: 512, Update: gadget.VolumeUpdate{ABPair: "fw-b"}},
+			{Name: "fw-b", Size: 512, Update: gadget.VolumeUpdate{ABPair: "fw-c"}},
+			{Name: "fw-c", Size: 512},
+		},
+		err: `structure "fw-a" is paired with structure "fw-b" which is paired with "fw-c"`,
+	}, {
+		structs: []gadget.VolumeStructure{
+			{Name: "fw-a", Size: 512, Update: gadget.VolumeUpdate{ABPair: "fw-b"}},
+			{Name: "fw-b", Size: 512, Content: []gadget.VolumeContent{{Image: "fw.img"}}},
+		},
+		err: `structure "fw-a" is paired with structure "fw-b" which cannot have content`,
+	}, {
+		structs: []gadget.VolumeStructure{
+			{Name: "fw-a", Size: 512, Update: gadget.VolumeUpdate{ABPair: "fw-b"}},
+			{Name: "fw-b", Size: 512, Filesystem: "vfat"},
+		},
+		err: `structure "fw-a" is paired with structure "fw-b" which cannot have content`,
+	}, {
+		structs: []gadget.VolumeStructure{
+			{Name: "fw-a", Size: 512, Update: gadget.VolumeUpdate{ABPair: "fw-b"}},
+			{Name: "fw-b", Size: 1024},
+		},
+		err: `structure "fw-a" is paired with structure "fw-b" of different size`,
+	}} {
+		vol := &gadget.Volume{Schema: "gpt", Structure: tc.structs}
+		for i := range vol.Structure {
+			vol.Structure[i].EnclosingVolume = vol
+		}
+		err := gadget.ValidateABPairs(vol)
+		if tc.err == "" {
+			c.Check(err, IsNil)
+		} else {
+			c.Check(err, ErrorMatches, tc.err)
+		}
+	}
+}
+
+func (s *gadgetYamlTestSuite) TestReadInfoABPair(c *C) {
+	gadgetYaml := `
+volumes:
+  board:
+    bootloader: u-boot
+    schema: mbr
+    structure:
+      - name: fw-a
+        type: bare
+        size: 1M
+        offset: 1M
+        update:
+          edition: 1
+          ab-pair: fw-b
+        content:
+          - image: fw.img
+      - name: fw-b
+        type: bare
+        size: 1M
+`
+	err := os.WriteFile(s.gadgetYamlPath, []byte(gadgetYaml), 0644)
+	c.Assert(err, IsNil)
+
+	ginfo, err := gadget.ReadInfo(s.dir, nil)
+	c.Assert(err, IsNil)
+	c.Check(ginfo.Volumes["board"].Structure[0].Update, DeepEquals, gadget.VolumeUpdate{
+		Edition: 1,
+		ABPair:  "fw-b",
+	})
+
+	gadgetYamlBadPair := strings.Replace(gadgetYaml, "ab-pair: fw-b", "ab-pair: fw-c", 1)
+	err = os.WriteFile(s.gadgetYamlPath, []byte(gadgetYamlBadPair), 0644)
+	c.Assert(err, IsNil)
+
+	_, err = gadget.ReadInfo(s.dir, nil)
+	c.Check(err, ErrorMatches, `invalid volume "board": structure "fw-a" is paired with unknown structure "fw-c"`)
+}
+
 func (s *gadgetYamlTestSuite) TestValidateStructureSizeRequired(c *C) {
 
 	gv := &gadget.Volume{Schema: "gpt"}
@@ -2636,7 +2810,7 @@ volumes:
     structure:
       - name: bad-size
         size: 99999
-        type: 0C
+        type: bare
 `)
 	for _, tc := range []struct {
 		gadgetYaml []byte
@@ -2644,7 +2818,7 @@ volumes:
 	}{
 		{mockOtherYaml, `cannot find entry for volume "volumename" in updated gadget info`},
 		{mockManyYaml, "gadgets with multiple volumes are unsupported"},
-		{mockNewStructuresYaml, `incompatible layout change: incompatible change in the number of structures from 0 to 1`},
+		{mockNewStructuresYaml, `incompatible layout change: cannot add structure #0 \("bad-size"\): only partitions can be added`},
 		{mockBadIDYaml, "incompatible layout change: incompatible ID change from 0C to 0D"},
 		{mockSchemaYaml, "incompatible layout change: incompatible schema change from mbr to gpt"},
 		{mockBootloaderYaml, "incompatible layout change: incompatible bootloader change from u-boot to grub"},
@@ -2714,12 +2888,42 @@ volumes:
         filesystem: ext4
         filesystem-label: fs-legit
 `
+	var mockGrownYaml = baseYaml + `
+      - name: legit
+        size: 4M
+        type: 00000000-0000-0000-0000-0000deadbeef
+        filesystem: ext4
+        filesystem-label: fs-legit
+`
+	var mockNewPartitionYaml = mockYaml + `
+      - name: new-data
+        size: 8M
+        type: 0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        filesystem: ext4
+        filesystem-label: new-data
+`
+	var mockNewRolePartitionYaml = mockYaml + `
+      - name: ubuntu-save
+        role: system-save
+        size: 8M
+        type: 0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        filesystem: ext4
+`
+	var mockNewBareYaml = mockYaml + `
+      - name: new-bare
+        size: 8M
+        type: bare
+`
 
 	for i, tc := range []struct {
 		gadgetYaml string
 		err        string
 	}{
 		{mockYaml, ``},
+		{mockGrownYaml, ``},
+		{mockNewPartitionYaml, ``},
+		{mockNewRolePartitionYaml, `incompatible layout change: cannot add structure #1 \("ubuntu-save"\): structures with role "system-save" cannot be added`},
+		{mockNewBareYaml, `incompatible layout change: cannot add structure #1 \("new-bare"\): only partitions can be added`},
 		{mockBadStructureTypeYaml, `incompatible layout change: incompatible structure #0 \("legit"\) change: cannot change structure type from "00000000-0000-0000-0000-0000deadbeef" to "00000000-0000-0000-0000-0000deadcafe"`},
 		{mockBadFsYaml, `incompatible layout change: incompatible structure #0 \("legit"\) change: cannot change filesystem from "ext4" to "vfat"`},
 		{mockBadOffsetYaml, `incompatible layout change: incompatible structure #0 \("legit"\) change: new valid structure offset range \[2097152, 2097152\] is not compatible with current \(\[1048576, 1048576\]\)`},
@@ -2741,6 +2945,60 @@ volumes:
 	}
 }
 
+func (s *gadgetCompatibilityTestSuite) TestGadgetIsCompatibleGrowLastStructure(c *C) {
+	var baseYaml = `
+volumes:
+  volumename:
+    schema: gpt
+    bootloader: grub
+    structure:
+      - name: first
+        size: 1M
+        type: 00000000-0000-0000-0000-0000deadbeef`
+	var mockYaml = baseYaml + `
+      - name: last
+        size: 2M
+        type: EF,C12A7328-F81F-11D2-BA4B-00A0C93EC93B
+        filesystem: vfat
+`
+	var mockGrownVfatYaml = baseYaml + `
+      - name: last
+        size: 4M
+        type: EF,C12A7328-F81F-11D2-BA4B-00A0C93EC93B
+        filesystem: vfat
+`
+	var mockGrownFirstYaml = `
+volumes:
+  volumename:
+    schema: gpt
+    bootloader: grub
+    structure:
+      - name: first
+        size: 2M
+        type: 00000000-0000-0000-0000-0000deadbeef
+      - name: last
+        size: 2M
+        type: EF,C12A7328-F81F-11D2-BA4B-00A0C93EC93B
+        filesystem: vfat
+`
+
+	for i, tc := range []struct {
+		gadgetYaml string
+		err        string
+	}{
+		{mockGrownVfatYaml, `incompatible layout change: cannot grow structure #1 \("last"\): vfat filesystems cannot be grown`},
+		{mockGrownFirstYaml, `incompatible layout change: incompatible structure #0 \("first"\) change: new valid structure size range \[2097152, 2097152\] is not compatible with current \(\[1048576, 1048576\]\)`},
+	} {
+		c.Logf("trying: %d %v\n", i, tc.gadgetYaml)
+		gi, err := gadget.InfoFromGadgetYaml([]byte(mockYaml), coreMod)
+		c.Assert(err, IsNil)
+		giNew, err := gadget.InfoFromGadgetYaml([]byte(tc.gadgetYaml), coreMod)
+		c.Assert(err, IsNil)
+		err = gadget.IsCompatible(gi, giNew)
+		c.Check(err, ErrorMatches, tc.err)
+	}
+}
+
 func (s *gadgetCompatibilityTestSuite) TestGadgetIsCompatibleStructureNameMBR(c *C) {
 	var baseYaml = `
 volumes:
@@ -0,0 +1,284 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package install
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/snapcore/snapd/gadget"
+	"github.com/snapcore/snapd/gadget/quantity"
+	"github.com/snapcore/snapd/kernel"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+)
+
+// EvolveOptions holds options for changing the partition layout of a disk.
+type EvolveOptions struct {
+	// GadgetRootDir is the root directory of the new gadget.
+	GadgetRootDir string
+	// KernelRootDir is the root directory of the kernel, used to resolve
+	// content of the new structures referring to kernel assets.
+	KernelRootDir string
+	// Done lists the steps which were already done by a previous attempt,
+	// as reported by Progress, which are skipped.
+	Done []string
+	// Progress, if set, is called after each step is done, so that the
+	// progress can be persisted and the changes resumed if interrupted.
+	Progress func(step string) error
+}
+
+// EvolveVolumeLayout applies the changes to the partition layout of a disk
+// planned with gadget.PlanVolumeLayoutEvolution: the partitions are grown or
+// created, then filesystems are grown or created and the content of new
+// structures is written. Once done, the disk is checked against the new
+// volume and the saved disk traits are updated.
+//
+// Each step can be repeated, so that the changes can be resumed after an
+// interruption or a failure, either by skipping the steps listed in
+// opts.Done or by applying them again.
+func EvolveVolumeLayout(evo *gadget.VolumeLayoutEvolution, opts *EvolveOptions) error {
+	if opts == nil {
+		opts = &EvolveOptions{}
+	}
+	device := evo.Disk.Device
+	sectorSize := uint64(evo.Disk.SectorSize)
+
+	done := make(map[string]bool, len(opts.Done))
+	for _, step := range opts.Done {
+		done[step] = true
+	}
+	runStep := func(step string, f func() error) error {
+		if done[step] {
+			return nil
+		}
+		if err := f(); err != nil {
+			return err
+		}
+		if opts.Progress == nil {
+			return nil
+		}
+		return opts.Progress(step)
+	}
+
+	var grown, created []*gadget.OnDiskAndGadgetStructurePair
+	for _, change := range evo.Changes {
+		ds := *change.DiskStructure
+		dgpair := &gadget.OnDiskAndGadgetStructurePair{
+			DiskStructure:   &ds,
+			GadgetStructure: change.GadgetStructure,
+		}
+		switch change.Kind {
+		case gadget.LayoutChangeGrow:
+			grown = append(grown, dgpair)
+		case gadget.LayoutChangeCreate:
+			ds.Node = deviceName(device, ds.DiskIndex)
+			created = append(created, dgpair)
+		default:
+			return fmt.Errorf("internal error: unknown layout change %v", change.Kind)
+		}
+	}
+
+	logger.Noticef("changing partition layout of %s", evo)
+
+	// partitions are not re-read by sfdisk as some of them are mounted, see
+	// createMissingPartitions
+	for _, dgpair := range grown {
+		ds := dgpair.DiskStructure
+		err := runStep(fmt.Sprintf("grow-partition-%d", ds.DiskIndex), func() error {
+			// setting the same start and size again is harmless
+			cmd := exec.Command("sfdisk", "--no-reread", "-N", strconv.Itoa(ds.DiskIndex), device)
+			cmd.Stdin = bytes.NewBufferString(fmt.Sprintf("start=%d, size=%d\n",
+				uint64(ds.StartOffset)/sectorSize, uint64(ds.Size)/sectorSize))
+			if output, err := cmd.CombinedOutput(); err != nil {
+				return fmt.Errorf("cannot grow partition %s: %v", ds.Node, osutil.OutputErr(output, err))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(created) != 0 {
+		err := runStep("create-partitions", func() error {
+			return createEvolvedPartitions(evo.Disk, created)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := reloadPartitionTable(opts.GadgetRootDir, device); err != nil {
+		return err
+	}
+	if out, err := exec.Command("udevadm", "settle", "--timeout=180").CombinedOutput(); err != nil {
+		return fmt.Errorf("cannot wait for udev to settle after reloading partition table: %v", osutil.OutputErr(out, err))
+	}
+	var nodes []string
+	for _, dgpair := range created {
+		nodes = append(nodes, dgpair.DiskStructure.Node)
+	}
+	sort.Strings(nodes)
+	if err := ensureNodesExist(nodes, 5*time.Second); err != nil {
+		return fmt.Errorf("partition not available: %v", err)
+	}
+
+	for _, dgpair := range grown {
+		err := runStep(fmt.Sprintf("grow-filesystem-%d", dgpair.DiskStructure.DiskIndex), func() error {
+			return growFilesystem(dgpair)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(created) != 0 {
+		kernelInfo, err := kernel.ReadInfo(opts.KernelRootDir)
+		if err != nil {
+			return err
+		}
+		layoutOpts := &gadget.LayoutOptions{
+			GadgetRootDir: opts.GadgetRootDir,
+			KernelRootDir: opts.KernelRootDir,
+		}
+		for _, dgpair := range created {
+			err := runStep(fmt.Sprintf("create-structure-%d", dgpair.DiskStructure.DiskIndex), func() error {
+				return writeNewStructure(dgpair, device, evo.Disk.SectorSize, kernelInfo, layoutOpts)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return gadget.UpdateDiskVolumeDeviceTraits(evo.Volume, device)
+}
+
+// createEvolvedPartitions appends the new partitions to the partition table of
+// the disk. Partitions which already exist with the expected start and size,
+// as created by a previous attempt, are left alone.
+func createEvolvedPartitions(diskVol *gadget.OnDiskVolume, created []*gadget.OnDiskAndGadgetStructurePair) error {
+	device := diskVol.Device
+	sectorSize := uint64(diskVol.SectorSize)
+
+	current, err := gadget.OnDiskVolumeFromDevice(device)
+	if err != nil {
+		return err
+	}
+	existing := make(map[int]*gadget.OnDiskStructure, len(current.Structure))
+	for i := range current.Structure {
+		existing[current.Structure[i].DiskIndex] = &current.Structure[i]
+	}
+
+	createBuf := &bytes.Buffer{}
+	for _, dgpair := range created {
+		ds := dgpair.DiskStructure
+		if cur, ok := existing[ds.DiskIndex]; ok {
+			if cur.StartOffset != ds.StartOffset || cur.Size != ds.Size {
+				return fmt.Errorf("cannot create partition %s: partition %d already exists with offset %s and size %s",
+					ds.Node, ds.DiskIndex, cur.StartOffset.IECString(), cur.Size.IECString())
+			}
+			continue
+		}
+		fmt.Fprintf(createBuf, "%s : start=%12d, size=%12d, type=%s, name=%q\n", ds.Node,
+			uint64(ds.StartOffset)/sectorSize, uint64(ds.Size)/sectorSize,
+			partitionType(diskVol.Schema, ds.Type), ds.Name)
+	}
+	if createBuf.Len() == 0 {
+		return nil
+	}
+	cmd := exec.Command("sfdisk", "--append", "--no-reread", device)
+	cmd.Stdin = createBuf
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("cannot create partitions: %v", osutil.OutputErr(output, err))
+	}
+	return nil
+}
+
+// growFilesystem grows the filesystem of a grown partition to fill it.
+func growFilesystem(dgpair *gadget.OnDiskAndGadgetStructurePair) error {
+	vs := dgpair.GadgetStructure
+	if !vs.HasFilesystem() {
+		return nil
+	}
+	node := dgpair.DiskStructure.Node
+	switch vs.LinuxFilesystem() {
+	case "ext4":
+		// resize2fs grows mounted filesystems online
+		if output, err := exec.Command("resize2fs", node).CombinedOutput(); err != nil {
+			return fmt.Errorf("cannot grow filesystem on %s: %v", node, osutil.OutputErr(output, err))
+		}
+	default:
+		return fmt.Errorf("internal error: cannot grow %s filesystem on %s", vs.LinuxFilesystem(), node)
+	}
+	return nil
+}
+
+// writeNewStructure creates the filesystem of a new partition and writes the
+// content of the structure.
+func writeNewStructure(dgpair *gadget.OnDiskAndGadgetStructurePair, device string, sectorSize quantity.Size, kernelInfo *kernel.Info, opts *gadget.LayoutOptions) error {
+	vs := dgpair.GadgetStructure
+	ds := dgpair.DiskStructure
+	if vs.HasFilesystem() {
+		fsParams := mkfsParams{
+			Type:       vs.Filesystem,
+			Label:      vs.Label,
+			Device:     ds.Node,
+			Size:       ds.Size,
+			SectorSize: sectorSize,
+		}
+		if err := makeFilesystem(fsParams); err != nil {
+			return fmt.Errorf("cannot make filesystem for partition %s: %v", ds.Node, err)
+		}
+	}
+
+	los, err := gadget.LayoutVolumeStructure(dgpair, kernelInfo, opts)
+	if err != nil {
+		return err
+	}
+	if vs.HasFilesystem() {
+		if len(los.ResolvedContent) == 0 {
+			return nil
+		}
+		return writeFilesystemContent(los, nil, ds.Node, nil)
+	}
+
+	if len(los.LaidOutContent) == 0 {
+		return nil
+	}
+	rw, err := gadget.NewRawStructureWriter(opts.GadgetRootDir, los)
+	if err != nil {
+		return err
+	}
+	disk, err := os.OpenFile(device, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("cannot open device for writing: %v", err)
+	}
+	defer disk.Close()
+	if err := rw.Write(disk); err != nil {
+		return fmt.Errorf("cannot write content of partition %s: %v", ds.Node, err)
+	}
+	return disk.Sync()
+}
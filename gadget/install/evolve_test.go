@@ -0,0 +1,388 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package install_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/gadget"
+	"github.com/snapcore/snapd/gadget/gadgettest"
+	"github.com/snapcore/snapd/gadget/install"
+	"github.com/snapcore/snapd/gadget/quantity"
+	"github.com/snapcore/snapd/osutil/disks"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type evolveTestSuite struct {
+	testutil.BaseTest
+
+	device     string
+	gadgetRoot string
+	sfdiskIn   string
+
+	cmdSfdisk    *testutil.MockCmd
+	cmdPartx     *testutil.MockCmd
+	cmdUdevadm   *testutil.MockCmd
+	cmdResize2fs *testutil.MockCmd
+}
+
+var _ = Suite(&evolveTestSuite{})
+
+const evolveOldGadgetYaml = `
+volumes:
+  foo:
+    bootloader: u-boot
+    schema: gpt
+    structure:
+      - name: data
+        filesystem: ext4
+        filesystem-label: data
+        type: 83,0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        size: 10M
+`
+
+const evolveNewGadgetYaml = `
+volumes:
+  foo:
+    bootloader: u-boot
+    schema: gpt
+    structure:
+      - name: data
+        filesystem: ext4
+        filesystem-label: data
+        type: 83,0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        size: 20M
+      - name: extra
+        filesystem: ext4
+        filesystem-label: extra
+        type: 83,0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        size: 8M
+        content:
+          - source: extra.txt
+            target: /
+      - name: fw
+        type: EBBEADAF-22C9-E33B-8F5D-0E81686A68CB
+        size: 1M
+        content:
+          - image: fw.img
+`
+
+func (s *evolveTestSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+
+	dir := c.MkDir()
+	s.device = filepath.Join(dir, "disk.img")
+	f, err := os.Create(s.device)
+	c.Assert(err, IsNil)
+	c.Assert(f.Truncate(64*int64(quantity.SizeMiB)), IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	s.sfdiskIn = filepath.Join(dir, "sfdisk.in")
+	s.cmdSfdisk = testutil.MockCommand(c, "sfdisk", fmt.Sprintf("cat >> %q", s.sfdiskIn))
+	s.AddCleanup(s.cmdSfdisk.Restore)
+	s.cmdPartx = testutil.MockCommand(c, "partx", "")
+	s.AddCleanup(s.cmdPartx.Restore)
+	s.cmdUdevadm = testutil.MockCommand(c, "udevadm", "")
+	s.AddCleanup(s.cmdUdevadm.Restore)
+	s.cmdResize2fs = testutil.MockCommand(c, "resize2fs", "")
+	s.AddCleanup(s.cmdResize2fs.Restore)
+
+	s.AddCleanup(install.MockEnsureNodesExist(func(nodes []string, timeout time.Duration) error {
+		return nil
+	}))
+	s.AddCleanup(install.MockSysMount(func(source, target, fstype string, flags uintptr, data string) error {
+		return nil
+	}))
+	s.AddCleanup(install.MockSysUnmount(func(target string, flags int) error {
+		return nil
+	}))
+
+	gadgetRoot, err := gadgettest.WriteGadgetYaml(c.MkDir(), evolveNewGadgetYaml)
+	c.Assert(err, IsNil)
+	s.gadgetRoot = gadgetRoot
+	c.Assert(os.WriteFile(filepath.Join(gadgetRoot, "extra.txt"), []byte("extra"), 0644), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(gadgetRoot, "fw.img"), []byte("firmware"), 0644), IsNil)
+}
+
+func (s *evolveTestSuite) mockDisk(evolved bool) {
+	partition := func(idx int, label, fs string, start, size quantity.Size) disks.Partition {
+		return disks.Partition{
+			PartitionLabel:   label,
+			PartitionUUID:    fmt.Sprintf("DA2ADBC8-90DF-4B1D-A93F-A92516C12E0%d", idx),
+			FilesystemLabel:  map[bool]string{true: label}[fs != ""],
+			FilesystemType:   fs,
+			Major:            525,
+			Minor:            idx,
+			KernelDeviceNode: fmt.Sprintf("%s%d", s.device, idx),
+			KernelDevicePath: fmt.Sprintf("/sys/block/foo/foo%d", idx),
+			DiskIndex:        uint64(idx),
+			StartInBytes:     uint64(start),
+			SizeInBytes:      uint64(size),
+		}
+	}
+	dm := &disks.MockDiskMapping{
+		DevNode:             s.device,
+		DevPath:             "/sys/block/foo",
+		DevNum:              "525:0",
+		DiskUsableSectorEnd: 64*1024*1024/512 - 34,
+		DiskSizeInBytes:     64 * 1024 * 1024,
+		SectorSizeBytes:     512,
+		DiskSchema:          "gpt",
+		ID:                  "651AC800-B9FB-4B9D-B6D3-A72EB54D9006",
+	}
+	if !evolved {
+		dm.Structure = []disks.Partition{
+			partition(1, "data", "ext4", quantity.SizeMiB, 10*quantity.SizeMiB),
+		}
+	} else {
+		dm.Structure = []disks.Partition{
+			partition(1, "data", "ext4", quantity.SizeMiB, 20*quantity.SizeMiB),
+			partition(2, "extra", "ext4", 21*quantity.SizeMiB, 8*quantity.SizeMiB),
+			partition(3, "fw", "", 29*quantity.SizeMiB, quantity.SizeMiB),
+		}
+	}
+	s.AddCleanup(disks.MockDeviceNameToDiskMapping(map[string]*disks.MockDiskMapping{
+		s.device: dm,
+	}))
+}
+
+func (s *evolveTestSuite) planEvolution(c *C) *gadget.VolumeLayoutEvolution {
+	s.mockDisk(false)
+
+	oldInfo, err := gadget.InfoFromGadgetYaml([]byte(evolveOldGadgetYaml), nil)
+	c.Assert(err, IsNil)
+	newInfo, err := gadget.ReadInfo(s.gadgetRoot, nil)
+	c.Assert(err, IsNil)
+	oldVol := oldInfo.Volumes["foo"]
+
+	traits, err := gadget.DiskTraitsFromDeviceAndValidate(oldVol, s.device, nil)
+	c.Assert(err, IsNil)
+	err = gadget.SaveDiskVolumesDeviceTraits(dirs.SnapDeviceDir, map[string]gadget.DiskVolumeDeviceTraits{
+		"foo": traits,
+	})
+	c.Assert(err, IsNil)
+
+	diskVol, err := gadget.OnDiskVolumeFromDevice(s.device)
+	c.Assert(err, IsNil)
+	evo, err := gadget.PlanVolumeLayoutEvolution(oldVol, newInfo.Volumes["foo"], diskVol, nil)
+	c.Assert(err, IsNil)
+	c.Assert(evo, NotNil)
+	c.Assert(evo.Changes, HasLen, 3)
+	return evo
+}
+
+func (s *evolveTestSuite) TestEvolveVolumeLayout(c *C) {
+	evo := s.planEvolution(c)
+
+	var mkfsCalls [][]interface{}
+	restore := install.MockMkfsMake(func(typ, img, label string, devSize, sectorSize quantity.Size) error {
+		mkfsCalls = append(mkfsCalls, []interface{}{typ, img, label, devSize, sectorSize})
+		return nil
+	})
+	defer restore()
+
+	// the partitions get changed once the partition table is reloaded
+	restore = install.MockEnsureNodesExist(func(nodes []string, timeout time.Duration) error {
+		s.mockDisk(true)
+		return nil
+	})
+	defer restore()
+
+	var steps []string
+	err := install.EvolveVolumeLayout(evo, &install.EvolveOptions{
+		GadgetRootDir: s.gadgetRoot,
+		Progress: func(step string) error {
+			steps = append(steps, step)
+			return nil
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(steps, DeepEquals, []string{
+		"grow-partition-1", "create-partitions", "grow-filesystem-1",
+		"create-structure-2", "create-structure-3",
+	})
+
+	c.Check(s.cmdSfdisk.Calls(), DeepEquals, [][]string{
+		{"sfdisk", "--no-reread", "-N", "1", s.device},
+		{"sfdisk", "--append", "--no-reread", s.device},
+	})
+	c.Check(s.sfdiskIn, testutil.FileEquals, "start=2048, size=40960\n"+
+		s.device+"2 : start=       43008, size=       16384, type=0FC63DAF-8483-4772-8E79-3D69D8477DE4, name=\"extra\"\n"+
+		s.device+"3 : start=       59392, size=        2048, type=EBBEADAF-22C9-E33B-8F5D-0E81686A68CB, name=\"fw\"\n")
+	c.Check(s.cmdPartx.Calls(), DeepEquals, [][]string{
+		{"partx", "-u", s.device},
+	})
+	c.Check(s.cmdResize2fs.Calls(), DeepEquals, [][]string{
+		{"resize2fs", s.device + "1"},
+	})
+	c.Check(mkfsCalls, DeepEquals, [][]interface{}{
+		{"ext4", s.device + "2", "extra", 8 * quantity.SizeMiB, quantity.Size(512)},
+	})
+
+	// the filesystem content was written
+	mntPt := filepath.Join(dirs.SnapRunDir, "gadget-install", strings.ReplaceAll(strings.Trim(s.device+"2", "/"), "/", "-"))
+	c.Check(filepath.Join(mntPt, "extra.txt"), testutil.FileEquals, "extra")
+
+	// and the raw content too
+	f, err := os.Open(s.device)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	buf := make([]byte, len("firmware"))
+	_, err = f.ReadAt(buf, 29*int64(quantity.SizeMiB))
+	c.Assert(err, IsNil)
+	c.Check(string(buf), Equals, "firmware")
+
+	// the traits now describe the new layout
+	mapping, err := gadget.LoadDiskVolumesDeviceTraits(dirs.SnapDeviceDir)
+	c.Assert(err, IsNil)
+	c.Assert(mapping["foo"].Structure, HasLen, 3)
+	c.Check(mapping["foo"].Structure[0].Size, Equals, 20*quantity.SizeMiB)
+	c.Check(mapping["foo"].Structure[2].PartitionLabel, Equals, "fw")
+}
+
+func (s *evolveTestSuite) TestEvolveVolumeLayoutSfdiskError(c *C) {
+	evo := s.planEvolution(c)
+
+	cmdSfdisk := testutil.MockCommand(c, "sfdisk", `echo "boom"; exit 1`)
+	defer cmdSfdisk.Restore()
+
+	err := install.EvolveVolumeLayout(evo, &install.EvolveOptions{GadgetRootDir: s.gadgetRoot})
+	c.Assert(err, ErrorMatches, fmt.Sprintf("cannot grow partition %s1: boom", s.device))
+	c.Check(s.cmdPartx.Calls(), HasLen, 0)
+}
+
+func (s *evolveTestSuite) TestEvolveVolumeLayoutResizeError(c *C) {
+	evo := s.planEvolution(c)
+
+	cmdResize2fs := testutil.MockCommand(c, "resize2fs", `echo "boom"; exit 1`)
+	defer cmdResize2fs.Restore()
+
+	err := install.EvolveVolumeLayout(evo, &install.EvolveOptions{GadgetRootDir: s.gadgetRoot})
+	c.Assert(err, ErrorMatches, fmt.Sprintf("cannot grow filesystem on %s1: boom", s.device))
+}
+
+func (s *evolveTestSuite) TestEvolveVolumeLayoutVerifyError(c *C) {
+	evo := s.planEvolution(c)
+
+	restore := install.MockMkfsMake(func(typ, img, label string, devSize, sectorSize quantity.Size) error {
+		return nil
+	})
+	defer restore()
+
+	// the disk does not show the changes
+	err := install.EvolveVolumeLayout(evo, &install.EvolveOptions{GadgetRootDir: s.gadgetRoot})
+	c.Assert(err, ErrorMatches, fmt.Sprintf("volume foo is not compatible with disk %s: .*", s.device))
+}
+
+func (s *evolveTestSuite) TestEvolveVolumeLayoutResume(c *C) {
+	evo := s.planEvolution(c)
+
+	var mkfsCalls []string
+	restore := install.MockMkfsMake(func(typ, img, label string, devSize, sectorSize quantity.Size) error {
+		mkfsCalls = append(mkfsCalls, img)
+		return nil
+	})
+	defer restore()
+
+	// a previous attempt changed the partition table and grew the
+	// filesystem before being interrupted
+	s.mockDisk(true)
+
+	var steps []string
+	err := install.EvolveVolumeLayout(evo, &install.EvolveOptions{
+		GadgetRootDir: s.gadgetRoot,
+		Done:          []string{"grow-partition-1", "create-partitions", "grow-filesystem-1"},
+		Progress: func(step string) error {
+			steps = append(steps, step)
+			return nil
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(steps, DeepEquals, []string{"create-structure-2", "create-structure-3"})
+
+	c.Check(s.cmdSfdisk.Calls(), HasLen, 0)
+	c.Check(s.cmdResize2fs.Calls(), HasLen, 0)
+	// the partition table is reloaded all the same
+	c.Check(s.cmdPartx.Calls(), DeepEquals, [][]string{
+		{"partx", "-u", s.device},
+	})
+	c.Check(mkfsCalls, DeepEquals, []string{s.device + "2"})
+
+	mapping, err := gadget.LoadDiskVolumesDeviceTraits(dirs.SnapDeviceDir)
+	c.Assert(err, IsNil)
+	c.Check(mapping["foo"].Structure, HasLen, 3)
+}
+
+func (s *evolveTestSuite) TestEvolveVolumeLayoutPartitionsAlreadyCreated(c *C) {
+	evo := s.planEvolution(c)
+
+	restore := install.MockMkfsMake(func(typ, img, label string, devSize, sectorSize quantity.Size) error {
+		return nil
+	})
+	defer restore()
+
+	// a previous attempt created the partitions but its progress was not
+	// recorded
+	s.mockDisk(true)
+
+	err := install.EvolveVolumeLayout(evo, &install.EvolveOptions{GadgetRootDir: s.gadgetRoot})
+	c.Assert(err, IsNil)
+
+	// the partitions are not created again
+	c.Check(s.cmdSfdisk.Calls(), DeepEquals, [][]string{
+		{"sfdisk", "--no-reread", "-N", "1", s.device},
+	})
+	c.Check(s.sfdiskIn, testutil.FileEquals, "start=2048, size=40960\n")
+}
+
+func (s *evolveTestSuite) TestEvolveVolumeLayoutPartitionConflict(c *C) {
+	evo := s.planEvolution(c)
+
+	// a partition with the index of a new one is in the way
+	evo.Changes[1].DiskStructure.Size = 4 * quantity.SizeMiB
+	s.mockDisk(true)
+
+	err := install.EvolveVolumeLayout(evo, &install.EvolveOptions{GadgetRootDir: s.gadgetRoot})
+	c.Assert(err, ErrorMatches, fmt.Sprintf(`cannot create partition %[1]s2: partition 2 already exists with offset 21 MiB and size 8 MiB`, s.device))
+	c.Check(s.cmdSfdisk.Calls(), HasLen, 1)
+}
+
+func (s *evolveTestSuite) TestEvolveVolumeLayoutProgressError(c *C) {
+	evo := s.planEvolution(c)
+
+	err := install.EvolveVolumeLayout(evo, &install.EvolveOptions{
+		GadgetRootDir: s.gadgetRoot,
+		Progress: func(step string) error {
+			return fmt.Errorf("cannot record %s", step)
+		},
+	})
+	c.Assert(err, ErrorMatches, "cannot record grow-partition-1")
+	c.Check(s.cmdSfdisk.Calls(), HasLen, 1)
+}
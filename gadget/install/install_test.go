@@ -877,6 +877,8 @@ type factoryResetOpts struct {
 	traits            map[string]gadget.DiskVolumeDeviceTraits
 	fromSeed          bool
 	volumeAssignments bool
+	// dataFs is the filesystem of ubuntu-data, ext4 if unset
+	dataFs string
 }
 
 func (s *installSuite) testFactoryReset(c *C, opts factoryResetOpts) {
@@ -965,6 +967,10 @@ fi
 	if opts.encryption {
 		dataDev = "/dev/mapper/ubuntu-data"
 	}
+	dataFs := opts.dataFs
+	if dataFs == "" {
+		dataFs = "ext4"
+	}
 
 	mkfsCall := 0
 	restore = install.MockMkfsMake(func(typ, img, label string, devSize, sectorSize quantity.Size) error {
@@ -977,7 +983,7 @@ fi
 			c.Assert(devSize, Equals, 750*quantity.SizeMiB)
 			c.Assert(sectorSize, Equals, quantity.Size(512))
 		case 2:
-			c.Assert(typ, Equals, "ext4")
+			c.Assert(typ, Equals, dataFs)
 			c.Assert(img, Equals, dataDev)
 			c.Assert(label, Equals, "ubuntu-data")
 			if opts.noSave {
@@ -1019,7 +1025,7 @@ fi
 				}
 				c.Assert(target, Equals, filepath.Join(dirs.SnapRunDir, mntPoint))
 			}
-			c.Assert(fstype, Equals, "ext4")
+			c.Assert(fstype, Equals, dataFs)
 			c.Assert(flags, Equals, uintptr(0))
 			c.Assert(data, Equals, "")
 		default:
@@ -1232,6 +1238,23 @@ func (s *installSuite) TestFactoryResetHappyEncrypted(c *C) {
 	})
 }
 
+func (s *installSuite) TestFactoryResetHappyEncryptedBtrfs(c *C) {
+	s.testFactoryReset(c, factoryResetOpts{
+		encryption: true,
+		diskMappings: map[string]*disks.MockDiskMapping{
+			"mmcblk0": gadgettest.ExpectedLUKSEncryptedRaspiMockDiskMapping,
+		},
+		disks: defaultDiskSetup,
+		gadgetYaml: strings.Replace(gadgettest.RaspiSimplifiedYaml,
+			"- filesystem: ext4\n      name: ubuntu-data", "- filesystem: btrfs\n      name: ubuntu-data", 1),
+		traitsJSON: gadgettest.ExpectedLUKSEncryptedRaspiDiskVolumeDeviceTraitsJSON,
+		traits: map[string]gadget.DiskVolumeDeviceTraits{
+			"pi": gadgettest.ExpectedLUKSEncryptedRaspiDiskVolumeDeviceTraits,
+		},
+		dataFs: "btrfs",
+	})
+}
+
 func (s *installSuite) TestFactoryResetHappyWithDeviceAssignmentFromSeed(c *C) {
 	s.testFactoryReset(c, factoryResetOpts{
 		diskMappings: map[string]*disks.MockDiskMapping{
@@ -534,12 +534,14 @@ func isLayoutCompatible(current, new *Volume) error {
 			current.Bootloader, new.Bootloader)
 	}
 
-	// XXX: the code below asssumes both volumes have the same number of
-	// structures, this limitation may be lifted later
-	if len(current.Structure) != len(new.Structure) {
+	// structures can only be added after the existing ones
+	if len(current.Structure) > len(new.Structure) {
 		return fmt.Errorf("incompatible change in the number of structures from %v to %v",
 			len(current.Structure), len(new.Structure))
 	}
+	if err := checkLayoutEvolution(current, new); err != nil {
+		return err
+	}
 
 	// at the structure level we expect the volume to be identical
 	for i := range current.Structure {
@@ -1506,7 +1506,9 @@ func canUpdateStructure(fromV *Volume, fromIdx int, toV *Volume, toIdx int) erro
 		return fmt.Errorf("cannot change structure name from %q to %q",
 			from.Name, to.Name)
 	}
-	if !arePossibleSizesCompatible(from, to) {
+	// the last structure can be grown as it can take over free space at
+	// the end of the disk, see checkLayoutEvolution
+	if !arePossibleSizesCompatible(from, to) && !isGrownLastStructure(fromV, fromIdx, toV, toIdx) {
 		return fmt.Errorf("new valid structure size range [%v, %v] is not compatible with current ([%v, %v])",
 			to.MinSize, effectivePartSize(to), from.MinSize, effectivePartSize(from))
 	}
@@ -1556,10 +1558,11 @@ func canUpdateVolume(from *PartiallyLaidOutVolume, to *LaidOutVolume) error {
 	if err := checkCompatibleSchema(from.Volume, to.Volume); err != nil {
 		return err
 	}
-	if len(from.LaidOutStructure) != len(to.LaidOutStructure) {
+	// structures can be added to the volume, but not removed
+	if len(from.LaidOutStructure) > len(to.LaidOutStructure) {
 		return fmt.Errorf("cannot change the number of structures within volume from %v to %v", len(from.LaidOutStructure), len(to.LaidOutStructure))
 	}
-	return nil
+	return checkLayoutEvolution(from.Volume, to.Volume)
 }
 
 type updatePair struct {
@@ -1605,8 +1608,11 @@ func KernelUpdatePolicy(from, to *LaidOutStructure) (bool, ResolvedContentFilter
 }
 
 func resolveUpdate(oldVol *PartiallyLaidOutVolume, newVol *LaidOutVolume, policy UpdatePolicyFunc, newGadgetRootDir, newKernelRootDir string, kernelInfo *kernel.Info) (updates []updatePair, err error) {
-	if len(oldVol.LaidOutStructure) != len(newVol.LaidOutStructure) {
-		return nil, errors.New("internal error: the number of structures in new and old volume definitions is different")
+	// structures added by the new volume are created along with their
+	// content when changing the partition layout, so only the existing
+	// ones are considered
+	if len(oldVol.LaidOutStructure) > len(newVol.LaidOutStructure) {
+		return nil, errors.New("internal error: the new volume definition has fewer structures than the old one")
 	}
 	// We must order updates from the latest binary in the boot
 	// chain to the newest. So any seed partitions should come
@@ -1696,7 +1702,12 @@ func applyUpdates(structureLocations map[string]map[int]StructureLocation, new G
 		if err != nil {
 			return fmt.Errorf("cannot prepare update for volume structure %v on volume %s: %v", one.to, one.volume.Name, err)
 		}
-		up, err := updaterForStructure(loc, one.from, one.to, new.RootDir, rollbackDir, observer)
+		var up Updater
+		if one.to.VolumeStructure.Update.ABPair != "" {
+			up, err = abUpdaterForStructure(structureLocations, loc, one.volume, one.to, new.RootDir, rollbackDir)
+		} else {
+			up, err = updaterForStructure(loc, one.from, one.to, new.RootDir, rollbackDir, observer)
+		}
 		if err != nil {
 			return fmt.Errorf("cannot prepare update for volume structure %v on volume %s: %v", one.to, one.volume.Name, err)
 		}
@@ -1788,6 +1799,18 @@ func updaterForStructureImpl(loc StructureLocation, fromPs *LaidOutStructure, ps
 	}
 }
 
+func abUpdaterForStructure(structureLocations map[string]map[int]StructureLocation, loc StructureLocation, vol *Volume, ps *LaidOutStructure, newRootDir, rollbackDir string) (Updater, error) {
+	pair, err := abPairStructure(vol, ps)
+	if err != nil {
+		return nil, err
+	}
+	pairLoc, ok := structureLocations[pair.VolumeName][pair.YamlIndex]
+	if !ok {
+		return nil, fmt.Errorf("structure with index %d on volume %s not found", pair.YamlIndex, pair.VolumeName)
+	}
+	return newABRawStructureUpdater(newRootDir, ps, rollbackDir, loc, pairLoc)
+}
+
 // MockUpdaterForStructure replace internal call with a mocked one, for use in tests only
 func MockUpdaterForStructure(mock func(loc StructureLocation, fromPs, ps *LaidOutStructure, rootDir, rollbackDir string, observer ContentUpdateObserver) (Updater, error)) (restore func()) {
 	old := updaterForStructure
@@ -151,10 +151,10 @@ func (u *updateTestSuite) TestCanUpdateSize(c *C) {
 	partSizeVol := &gadget.Volume{Partial: []gadget.PartialProperty{gadget.PartialSize}}
 	cases := []canUpdateTestCase{
 		{
-			// size change
+			// size change, ok as the last structure can grow
 			from: gadget.VolumeStructure{MinSize: quantity.SizeMiB, Size: quantity.SizeMiB, EnclosingVolume: mokVol},
 			to:   gadget.VolumeStructure{MinSize: quantity.SizeMiB + quantity.SizeKiB, Size: quantity.SizeMiB + quantity.SizeKiB, EnclosingVolume: mokVol},
-			err:  `new valid structure size range \[1049600, 1049600\] is not compatible with current \(\[1048576, 1048576\]\)`,
+			err:  "",
 		}, {
 			// no size change
 			from: gadget.VolumeStructure{MinSize: quantity.SizeMiB, Size: quantity.SizeMiB, EnclosingVolume: mokVol},
@@ -203,16 +203,45 @@ func (u *updateTestSuite) TestCanUpdateSize(c *C) {
 			to:   gadget.VolumeStructure{MinSize: 1, Size: 9, EnclosingVolume: mokVol},
 			err:  `new valid structure size range \[1, 9\] is not compatible with current \(\[10, 18446744073709551615\]\)`,
 		}, {
-			// range out
+			// range above, ok as the last structure can grow
 			from: gadget.VolumeStructure{MinSize: 10, Size: 20, EnclosingVolume: mokVol},
 			to:   gadget.VolumeStructure{MinSize: 21, Size: 25, EnclosingVolume: mokVol},
-			err:  `new valid structure size range \[21, 25\] is not compatible with current \(\[10, 20\]\)`,
+			err:  "",
+		}, {
+			// growing from partial size is out of range
+			from: gadget.VolumeStructure{MinSize: 10, Size: 0, EnclosingVolume: partSizeVol},
+			to:   gadget.VolumeStructure{MinSize: 1, Size: 9, EnclosingVolume: partSizeVol},
+			err:  `new valid structure size range \[1, 9\] is not compatible with current \(\[10, 18446744073709551615\]\)`,
 		},
 	}
 
 	u.testCanUpdate(c, cases)
 }
 
+func (u *updateTestSuite) TestCanUpdateSizeNotLastStructure(c *C) {
+	fromV := &gadget.Volume{
+		Structure: []gadget.VolumeStructure{
+			{Name: "first", MinSize: quantity.SizeMiB, Size: quantity.SizeMiB},
+			{Name: "last", Offset: asOffsetPtr(quantity.OffsetMiB), MinSize: quantity.SizeMiB, Size: quantity.SizeMiB},
+		},
+	}
+	toV := &gadget.Volume{
+		Structure: []gadget.VolumeStructure{
+			{Name: "first", MinSize: 2 * quantity.SizeMiB, Size: 2 * quantity.SizeMiB},
+			{Name: "last", Offset: asOffsetPtr(quantity.OffsetMiB), MinSize: quantity.SizeMiB, Size: quantity.SizeMiB},
+		},
+	}
+	for _, v := range []*gadget.Volume{fromV, toV} {
+		for i := range v.Structure {
+			v.Structure[i].EnclosingVolume = v
+		}
+	}
+
+	// only the last structure can grow
+	err := gadget.CanUpdateStructure(fromV, 0, toV, 0)
+	c.Check(err, ErrorMatches, `new valid structure size range \[2097152, 2097152\] is not compatible with current \(\[1048576, 1048576\]\)`)
+}
+
 func (u *updateTestSuite) TestCanUpdateOffsetWrite(c *C) {
 	// We do not care about changes in offset-write, so we check that nothing
 	// errors here.
@@ -2990,6 +3019,112 @@ func (u *updateTestSuite) TestUpdateApplyOnlyWhenNeeded(c *C) {
 	c.Assert(muo.canceledCalled, Equals, 0)
 }
 
+func (u *updateTestSuite) TestUpdateApplyABPair(c *C) {
+	fwA := gadget.VolumeStructure{
+		VolumeName: "foo",
+		Name:       "fw-a",
+		Type:       "bare",
+		Offset:     asOffsetPtr(quantity.OffsetMiB),
+		MinSize:    quantity.SizeMiB,
+		Size:       quantity.SizeMiB,
+		Content: []gadget.VolumeContent{
+			{Image: "fw.img"},
+		},
+		Update:    gadget.VolumeUpdate{ABPair: "fw-b"},
+		YamlIndex: 0,
+	}
+	fwB := gadget.VolumeStructure{
+		VolumeName: "foo",
+		Name:       "fw-b",
+		Type:       "bare",
+		Offset:     asOffsetPtr(2 * quantity.OffsetMiB),
+		MinSize:    quantity.SizeMiB,
+		Size:       quantity.SizeMiB,
+		YamlIndex:  1,
+	}
+	newFwA := fwA
+	newFwA.Update.Edition = 1
+	oldData := gadget.GadgetData{
+		Info: &gadget.Info{
+			Volumes: map[string]*gadget.Volume{
+				"foo": {
+					Name:       "foo",
+					Bootloader: "u-boot",
+					Schema:     "mbr",
+					Structure:  []gadget.VolumeStructure{fwA, fwB},
+				},
+			},
+		},
+		RootDir: c.MkDir(),
+	}
+	newData := gadget.GadgetData{
+		Info: &gadget.Info{
+			Volumes: map[string]*gadget.Volume{
+				"foo": {
+					Name:       "foo",
+					Bootloader: "u-boot",
+					Schema:     "mbr",
+					Structure:  []gadget.VolumeStructure{newFwA, fwB},
+				},
+			},
+		},
+		RootDir: c.MkDir(),
+	}
+	gadget.SetEnclosingVolumeInStructs(oldData.Info.Volumes)
+	gadget.SetEnclosingVolumeInStructs(newData.Info.Volumes)
+	makeSizedFile(c, filepath.Join(oldData.RootDir, "fw.img"), 0, []byte("old firmware"))
+	makeSizedFile(c, filepath.Join(newData.RootDir, "fw.img"), 0, []byte("new firmware"))
+	rollbackDir := c.MkDir()
+
+	disk := filepath.Join(c.MkDir(), "disk.img")
+	mutateFile(c, disk, 3*quantity.SizeMiB, []mutateWrite{
+		{[]byte("old firmware"), int64(quantity.OffsetMiB)},
+	})
+
+	r := gadget.MockVolumeStructureToLocationMap(func(_ gadget.Model, oldVolumes, _ map[string]*gadget.Volume) (map[string]map[int]gadget.StructureLocation, map[string]map[int]*gadget.OnDiskStructure, error) {
+		return map[string]map[int]gadget.StructureLocation{
+				"foo": {
+					0: {
+						Device: disk,
+						Offset: quantity.OffsetMiB,
+					},
+					1: {
+						Device: disk,
+						Offset: 2 * quantity.OffsetMiB,
+					},
+				},
+			}, map[string]map[int]*gadget.OnDiskStructure{
+				"foo": gadget.OnDiskStructsFromGadget(oldVolumes["foo"]),
+			},
+			nil
+	})
+	defer r()
+
+	restore := gadget.MockUpdaterForStructure(func(loc gadget.StructureLocation, fromPs, ps *gadget.LaidOutStructure, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
+		c.Fatalf("unexpected call")
+		return nil, errors.New("not called")
+	})
+	defer restore()
+
+	switcher := &mockABSlotSwitcher{active: gadget.SlotA}
+	restore = gadget.MockABSlotSwitcher(func() (gadget.ABSlotSwitcher, error) {
+		return switcher, nil
+	})
+	defer restore()
+
+	muo := &mockUpdateProcessObserver{}
+	err := gadget.Update(uc20Model, oldData, newData, rollbackDir, nil, muo)
+	c.Assert(err, IsNil)
+	c.Check(muo.beforeWriteCalled, Equals, 1)
+
+	// the new firmware was written to the inactive slot only
+	content, err := os.ReadFile(disk)
+	c.Assert(err, IsNil)
+	c.Check(string(content[quantity.OffsetMiB:quantity.OffsetMiB+12]), Equals, "old firmware")
+	c.Check(string(content[2*quantity.OffsetMiB:2*quantity.OffsetMiB+12]), Equals, "new firmware")
+	c.Check(switcher.tried, DeepEquals, []string{gadget.SlotB})
+}
+
 func (u *updateTestSuite) TestUpdateApplyErrorLayout(c *C) {
 	// prepare the stage
 	bareStruct := gadget.VolumeStructure{
@@ -3063,6 +3198,8 @@ func (u *updateTestSuite) TestUpdateApplyErrorIllegalVolumeUpdate(c *C) {
 	}
 	bareStructUpdate := bareStruct
 	bareStructUpdate.Name = "foo update"
+	bareStructUpdate.YamlIndex = 1
+	bareStructUpdate.Type = "bare"
 	bareStructUpdate.Update.Edition = 1
 	bareStructUpdate.Offset = asOffsetPtr(5 * quantity.OffsetMiB)
 
@@ -3080,7 +3217,8 @@ func (u *updateTestSuite) TestUpdateApplyErrorIllegalVolumeUpdate(c *C) {
 			"foo": {
 				Bootloader: "grub",
 				Schema:     "gpt",
-				// more structures than old
+				// more structures than old, but only partitions can
+				// be added
 				Structure: []gadget.VolumeStructure{bareStruct, bareStructUpdate},
 			},
 		},
@@ -3090,6 +3228,7 @@ func (u *updateTestSuite) TestUpdateApplyErrorIllegalVolumeUpdate(c *C) {
 			map[string]map[int]*gadget.OnDiskStructure{
 				"foo": {
 					0: {},
+					1: {},
 				},
 			},
 			nil
@@ -3110,7 +3249,11 @@ func (u *updateTestSuite) TestUpdateApplyErrorIllegalVolumeUpdate(c *C) {
 	makeSizedFile(c, filepath.Join(newRootDir, "first.img"), 900*quantity.SizeKiB, nil)
 
 	err := gadget.Update(uc16Model, oldData, newData, rollbackDir, nil, nil)
-	c.Assert(err, ErrorMatches, `cannot apply update to volume foo: cannot change the number of structures within volume from 1 to 2`)
+	c.Assert(err, ErrorMatches, `cannot apply update to volume foo: cannot add structure #1 \("foo update"\): only partitions can be added`)
+
+	// fewer structures than old
+	err = gadget.Update(uc16Model, newData, oldData, rollbackDir, nil, nil)
+	c.Assert(err, ErrorMatches, `cannot apply update to volume foo: cannot change the number of structures within volume from 2 to 1`)
 }
 
 func (u *updateTestSuite) TestUpdateApplyErrorIllegalStructureUpdate(c *C) {
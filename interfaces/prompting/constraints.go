@@ -48,6 +48,29 @@ func (c *Constraints) ValidateForInterface(iface string) error {
 	return c.validatePermissions(iface)
 }
 
+// WithDefaultPathPattern returns the constraints to use for the given
+// interface. The constraints for device interfaces such as camera need not
+// have a path pattern, in which case a copy of the constraints is returned
+// with a path pattern matching all the devices to which the interface grants
+// access. Otherwise, the constraints are returned as they are.
+func (c *Constraints) WithDefaultPathPattern(iface string) (*Constraints, error) {
+	if c.PathPattern != nil {
+		return c, nil
+	}
+	devicePattern, ok := interfaceDevicePathPatterns[iface]
+	if !ok {
+		return c, nil
+	}
+	pathPattern, err := patterns.ParsePathPattern(devicePattern)
+	if err != nil {
+		// the device path patterns are predefined
+		return nil, fmt.Errorf("internal error: %v", err)
+	}
+	withDefault := *c
+	withDefault.PathPattern = pathPattern
+	return &withDefault, nil
+}
+
 // validatePermissions checks that the permissions for the given constraints
 // are valid for the given interface. If not, returns an error, otherwise
 // ensures that the permissions are in the order in which they occur in the
@@ -111,8 +134,22 @@ func (c *Constraints) ContainPermissions(permissions []string) bool {
 var (
 	// List of permissions available for each interface. This also defines the
 	// order in which the permissions should be presented.
+	//
+	// The audio-record interface is not listed: it grants no file access, as
+	// recording is mediated by the audio service, so there is no access for
+	// AppArmor to prompt on without widening its policy.
 	interfacePermissionsAvailable = map[string][]string{
-		"home": {"read", "write", "execute"},
+		"home":            {"read", "write", "execute"},
+		"removable-media": {"read", "write", "execute"},
+		"personal-files":  {"read", "write"},
+		"camera":          {"access"},
+	}
+
+	// The path patterns matching all the devices to which device interfaces
+	// grant access, used for the constraints which do not specify a path
+	// pattern of their own.
+	interfaceDevicePathPatterns = map[string]string{
+		"camera": "/dev/{video*,vchiq}",
 	}
 
 	// A mapping from interfaces which support AppArmor file permissions to
@@ -127,6 +164,21 @@ var (
 			"write":   notify.AA_MAY_WRITE | notify.AA_MAY_APPEND | notify.AA_MAY_CREATE | notify.AA_MAY_DELETE | notify.AA_MAY_RENAME | notify.AA_MAY_SETATTR | notify.AA_MAY_CHMOD | notify.AA_MAY_LOCK | notify.AA_MAY_LINK,
 			"execute": notify.AA_MAY_EXEC | notify.AA_EXEC_MMAP,
 		},
+		"removable-media": {
+			"read":    notify.AA_MAY_READ | notify.AA_MAY_GETATTR,
+			"write":   notify.AA_MAY_WRITE | notify.AA_MAY_APPEND | notify.AA_MAY_CREATE | notify.AA_MAY_DELETE | notify.AA_MAY_RENAME | notify.AA_MAY_SETATTR | notify.AA_MAY_CHMOD | notify.AA_MAY_LOCK | notify.AA_MAY_LINK,
+			"execute": notify.AA_MAY_EXEC | notify.AA_EXEC_MMAP,
+		},
+		// personal-files grants read and lock or read, write, lock and
+		// link access, never execute
+		"personal-files": {
+			"read":  notify.AA_MAY_READ | notify.AA_MAY_GETATTR | notify.AA_MAY_LOCK,
+			"write": notify.AA_MAY_WRITE | notify.AA_MAY_APPEND | notify.AA_MAY_CREATE | notify.AA_MAY_DELETE | notify.AA_MAY_RENAME | notify.AA_MAY_SETATTR | notify.AA_MAY_CHMOD | notify.AA_MAY_LINK,
+		},
+		// the device interfaces grant access to device nodes as a whole
+		"camera": {
+			"access": notify.AA_MAY_READ | notify.AA_MAY_WRITE | notify.AA_MAY_APPEND | notify.AA_MAY_GETATTR | notify.AA_MAY_LOCK,
+		},
 	}
 )
 
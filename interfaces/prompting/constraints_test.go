@@ -56,6 +56,12 @@ func (s *constraintsSuite) TestConstraintsValidateForInterface(c *C) {
 			[]string{"read"},
 			`invalid interface: "foo"`,
 		},
+		{
+			// recording is mediated by the audio service
+			"audio-record",
+			[]string{"access"},
+			`invalid interface: "audio-record"`,
+		},
 		{
 			"home",
 			[]string{},
@@ -84,6 +90,55 @@ func (s *constraintsSuite) TestConstraintsValidateForInterface(c *C) {
 	c.Check(err, ErrorMatches, `invalid path pattern: no path pattern: ""`)
 }
 
+func (s *constraintsSuite) TestConstraintsWithDefaultPathPattern(c *C) {
+	// the path pattern defaults to all the devices of the interface
+	constraints := &prompting.Constraints{
+		Permissions: []string{"access"},
+	}
+	withDefault, err := constraints.WithDefaultPathPattern("camera")
+	c.Assert(err, IsNil)
+	c.Check(withDefault.PathPattern.String(), Equals, "/dev/{video*,vchiq}")
+	c.Check(withDefault.Permissions, DeepEquals, []string{"access"})
+	c.Assert(withDefault.ValidateForInterface("camera"), IsNil)
+	for _, path := range []string{"/dev/video0", "/dev/video12", "/dev/vchiq"} {
+		match, err := withDefault.Match(path)
+		c.Check(err, IsNil)
+		c.Check(match, Equals, true, Commentf("path: %s", path))
+	}
+	// the original constraints are left untouched
+	c.Check(constraints.PathPattern, IsNil)
+	c.Check(constraints.ValidateForInterface("camera"), ErrorMatches, `invalid path pattern: no path pattern: ""`)
+
+	// a path pattern can restrict the devices
+	pathPattern, err := patterns.ParsePathPattern("/dev/video0")
+	c.Assert(err, IsNil)
+	constraints = &prompting.Constraints{
+		PathPattern: pathPattern,
+		Permissions: []string{"access"},
+	}
+	withDefault, err = constraints.WithDefaultPathPattern("camera")
+	c.Assert(err, IsNil)
+	c.Check(withDefault, Equals, constraints)
+	match, err := withDefault.Match("/dev/video1")
+	c.Check(err, IsNil)
+	c.Check(match, Equals, false)
+
+	// there is no default for other interfaces
+	constraints = &prompting.Constraints{
+		Permissions: []string{"read"},
+	}
+	withDefault, err = constraints.WithDefaultPathPattern("home")
+	c.Assert(err, IsNil)
+	c.Check(withDefault.PathPattern, IsNil)
+	c.Check(withDefault.ValidateForInterface("home"), ErrorMatches, `invalid path pattern: no path pattern: ""`)
+
+	constraints = &prompting.Constraints{
+		PathPattern: pathPattern,
+		Permissions: []string{"read"},
+	}
+	c.Check(constraints.ValidateForInterface("camera"), ErrorMatches, "invalid permissions for camera interface.*")
+}
+
 func (s *constraintsSuite) TestValidatePermissionsHappy(c *C) {
 	cases := []struct {
 		iface   string
@@ -453,6 +508,16 @@ func (s *constraintsSuite) TestAbstractPermissionsToAppArmorPermissionsHappy(c *
 			[]string{"execute", "write", "read"},
 			notify.AA_MAY_OPEN | notify.AA_MAY_READ | notify.AA_MAY_GETATTR | notify.AA_MAY_EXEC | notify.AA_EXEC_MMAP | notify.AA_MAY_WRITE | notify.AA_MAY_APPEND | notify.AA_MAY_CREATE | notify.AA_MAY_DELETE | notify.AA_MAY_RENAME | notify.AA_MAY_SETATTR | notify.AA_MAY_CHMOD | notify.AA_MAY_LOCK | notify.AA_MAY_LINK,
 		},
+		{
+			"personal-files",
+			[]string{"read"},
+			notify.AA_MAY_OPEN | notify.AA_MAY_READ | notify.AA_MAY_GETATTR | notify.AA_MAY_LOCK,
+		},
+		{
+			"camera",
+			[]string{"access"},
+			notify.AA_MAY_OPEN | notify.AA_MAY_READ | notify.AA_MAY_WRITE | notify.AA_MAY_APPEND | notify.AA_MAY_GETATTR | notify.AA_MAY_LOCK,
+		},
 	}
 	for _, testCase := range cases {
 		ret, err := prompting.AbstractPermissionsToAppArmorPermissions(testCase.iface, testCase.list)
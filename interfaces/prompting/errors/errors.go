@@ -43,6 +43,10 @@ var (
 	ErrReplyNotMatchRequestedPermissions = errors.New("permissions in reply constraints do not include all requested permissions")
 	ErrRuleConflict                      = errors.New("a rule with conflicting path pattern and permission already exists in the rule database")
 
+	// ErrNoUserSession is returned when a rule with lifespan "session" is
+	// requested for a user who is not logged in
+	ErrNoUserSession = errors.New("cannot have lifespan \"session\" when the user has no login session")
+
 	// Internal errors which are not handled specifically
 	ErrPromptsClosed      = errors.New("prompts backend has already been closed")
 	ErrRulesClosed        = errors.New("rules backend has already been closed")
@@ -130,15 +130,16 @@ const (
 	// LifespanTimespan indicates that a reply/rule should apply for a given
 	// duration or until a given expiration timestamp.
 	LifespanTimespan LifespanType = "timespan"
-	// TODO: add LifespanSession which expires after the user logs out
-	// LifespanSession  LifespanType = "session"
+	// LifespanSession indicates that a reply/rule should apply until the
+	// user logs out.
+	LifespanSession LifespanType = "session"
 )
 
 var (
-	supportedLifespans = []string{string(LifespanForever), string(LifespanSingle), string(LifespanTimespan)}
+	supportedLifespans = []string{string(LifespanForever), string(LifespanSingle), string(LifespanTimespan), string(LifespanSession)}
 	// SupportedRuleLifespans is exported so interfaces/promptin/requestrules
 	// can use it when constructing a ErrRuleLifespanSingle
-	SupportedRuleLifespans = []string{string(LifespanForever), string(LifespanTimespan)}
+	SupportedRuleLifespans = []string{string(LifespanForever), string(LifespanTimespan), string(LifespanSession)}
 )
 
 func (lifespan *LifespanType) UnmarshalJSON(data []byte) error {
@@ -148,7 +149,7 @@ func (lifespan *LifespanType) UnmarshalJSON(data []byte) error {
 	}
 	value := LifespanType(lifespanStr)
 	switch value {
-	case LifespanForever, LifespanSingle, LifespanTimespan:
+	case LifespanForever, LifespanSingle, LifespanTimespan, LifespanSession:
 		*lifespan = value
 	default:
 		return prompting_errors.NewInvalidLifespanError(lifespanStr, supportedLifespans)
@@ -164,7 +165,7 @@ func (lifespan *LifespanType) UnmarshalJSON(data []byte) error {
 // any of the above are invalid.
 func (lifespan LifespanType) ValidateExpiration(expiration time.Time, currTime time.Time) error {
 	switch lifespan {
-	case LifespanForever, LifespanSingle:
+	case LifespanForever, LifespanSingle, LifespanSession:
 		if !expiration.IsZero() {
 			return prompting_errors.NewInvalidExpirationError(expiration, fmt.Sprintf("cannot have specified expiration when lifespan is %q", lifespan))
 		}
@@ -193,7 +194,7 @@ func (lifespan LifespanType) ValidateExpiration(expiration time.Time, currTime t
 func (lifespan LifespanType) ParseDuration(duration string, currTime time.Time) (time.Time, error) {
 	var expiration time.Time
 	switch lifespan {
-	case LifespanForever, LifespanSingle:
+	case LifespanForever, LifespanSingle, LifespanSession:
 		if duration != "" {
 			return expiration, prompting_errors.NewInvalidDurationError(duration, fmt.Sprintf("cannot have specified duration when lifespan is %q", lifespan))
 		}
@@ -0,0 +1,49 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package requestaudit
+
+import (
+	"github.com/snapcore/snapd/testutil"
+)
+
+var LogPath = logPath
+
+func MockMaxLogSize(size int64) (restore func()) {
+	return testutil.Mock(&maxLogSize, size)
+}
+
+func MockMaxPendingEntries(n int) (restore func()) {
+	return testutil.Mock(&maxPendingEntries, n)
+}
+
+func MockRotation(maxSize int64, maxFiles int) (restore func()) {
+	oldSize, oldRotated := maxLogSize, maxRotatedLogs
+	maxLogSize, maxRotatedLogs = maxSize, maxFiles-1
+	return func() {
+		maxLogSize, maxRotatedLogs = oldSize, oldRotated
+	}
+}
+
+// LockLog prevents the recorded entries from being written to the audit log
+// until the returned function is called.
+func LockLog() (unlock func()) {
+	mutex.Lock()
+	return mutex.Unlock
+}
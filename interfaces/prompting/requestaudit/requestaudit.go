@@ -0,0 +1,418 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package requestaudit provides support for keeping an audit log of the
+// decisions taken on the requests of snaps which are mediated by AppArmor
+// prompting, whether they were allowed or denied by a rule, by a reply of the
+// user to a prompt, or because the prompt expired.
+package requestaudit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/snapcore/snapd/gadget/quantity"
+	"github.com/snapcore/snapd/interfaces/prompting"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/snap/naming"
+)
+
+// SourceType is the origin of a decision on a request.
+type SourceType string
+
+const (
+	// SourceRule indicates that the request was decided by an existing or
+	// new rule.
+	SourceRule SourceType = "rule"
+	// SourceReply indicates that the request was decided by the reply of the
+	// user to a prompt.
+	SourceReply SourceType = "reply"
+	// SourceExpired indicates that the request was denied because the
+	// prompt for it expired without a reply.
+	SourceExpired SourceType = "expired"
+)
+
+// Entry is a record of a decision taken on a request.
+type Entry struct {
+	Timestamp time.Time `json:"timestamp"`
+	User      uint32    `json:"user"`
+	Snap      string    `json:"snap"`
+	// App is the app or hook of the snap which made the request, if the
+	// request was made by a snap.
+	App       string `json:"app,omitempty"`
+	Interface string `json:"interface"`
+	Path      string `json:"path"`
+	// Permissions are the permissions which were requested.
+	Permissions []string              `json:"permissions"`
+	Outcome     prompting.OutcomeType `json:"outcome"`
+	Source      SourceType            `json:"source"`
+}
+
+// NewEntry returns a new entry timestamped with the current time for a
+// request made by the process with the given AppArmor label.
+func NewEntry(user uint32, label string, iface string, path string, permissions []string, outcome prompting.OutcomeType, source SourceType) *Entry {
+	entry := &Entry{
+		Timestamp:   time.Now(),
+		User:        user,
+		Snap:        label,
+		Interface:   iface,
+		Path:        path,
+		Permissions: permissions,
+		Outcome:     outcome,
+		Source:      source,
+	}
+	switch tag := parseSecurityTag(label).(type) {
+	case naming.AppSecurityTag:
+		entry.Snap = tag.InstanceName()
+		entry.App = tag.AppName()
+	case naming.HookSecurityTag:
+		entry.Snap = tag.InstanceName()
+		entry.App = "hook." + tag.HookName()
+	}
+	return entry
+}
+
+func parseSecurityTag(label string) naming.SecurityTag {
+	tag, err := naming.ParseSecurityTag(label)
+	if err != nil {
+		// The process is not a snap
+		return nil
+	}
+	return tag
+}
+
+var (
+	// maxLogSize is the size past which the audit log is rotated.
+	maxLogSize int64 = DefaultMaxLogSize
+	// maxRotatedLogs is the number of rotated audit logs which are kept.
+	maxRotatedLogs = DefaultMaxLogFiles - 1
+)
+
+const (
+	// DefaultMaxLogSize is the default size past which the audit log is
+	// rotated.
+	DefaultMaxLogSize = 8 * 1024 * 1024
+	// DefaultMaxLogFiles is the default number of audit log files which are
+	// kept, including the current one.
+	DefaultMaxLogFiles = 4
+)
+
+// maxPendingEntries is the number of entries which can wait to be written to
+// the audit log, past which new entries are dropped.
+var maxPendingEntries = 1024
+
+var (
+	// mutex serializes writing and rotating the audit log, and protects
+	// the rotation settings.
+	mutex sync.Mutex
+
+	// pendingMutex protects the entries waiting to be written to the
+	// audit log.
+	pendingMutex sync.Mutex
+	pending      [][]byte
+	writing      bool
+	written      = sync.NewCond(&pendingMutex)
+)
+
+func logPath() string {
+	return filepath.Join(prompting.StateDir(), "audit.log")
+}
+
+func rotatedLogPath(n int) string {
+	return logPath() + "." + strconv.Itoa(n)
+}
+
+// SetRotation sets the size past which the audit log is rotated and the
+// number of audit log files which are kept, including the current one.
+func SetRotation(maxSize int64, maxFiles int) error {
+	if maxSize <= 0 {
+		return fmt.Errorf("invalid audit log size: %d", maxSize)
+	}
+	if maxFiles < 1 {
+		return fmt.Errorf("invalid number of audit log files: %d", maxFiles)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	maxLogSize = maxSize
+	maxRotatedLogs = maxFiles - 1
+	return nil
+}
+
+// ParseRotation parses the size past which the audit log is rotated and the
+// number of audit log files which are kept, as given in the system
+// configuration. Empty values stand for the defaults.
+func ParseRotation(maxSize, maxFiles string) (size int64, files int, err error) {
+	size, files = DefaultMaxLogSize, DefaultMaxLogFiles
+	if maxSize != "" {
+		sz, err := quantity.ParseSize(maxSize)
+		size = int64(sz)
+		if err != nil || size <= 0 {
+			return 0, 0, fmt.Errorf("audit log size must be a positive size, not %q", maxSize)
+		}
+	}
+	if maxFiles != "" {
+		files, err = strconv.Atoi(maxFiles)
+		if err != nil || files < 1 {
+			return 0, 0, fmt.Errorf("number of audit log files must be a positive integer, not %q", maxFiles)
+		}
+	}
+	return size, files, nil
+}
+
+// Record queues the given entry to be appended to the audit log. The entry is
+// written in the background, so that recording it doesn't wait for I/O.
+func Record(entry *Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	pendingMutex.Lock()
+	defer pendingMutex.Unlock()
+	if len(pending) >= maxPendingEntries {
+		return fmt.Errorf("cannot record entry: too many entries waiting to be written to the audit log")
+	}
+	pending = append(pending, line)
+	if !writing {
+		writing = true
+		go writePending()
+	}
+	return nil
+}
+
+// writePending writes the pending entries to the audit log until there are
+// none left.
+func writePending() {
+	for {
+		pendingMutex.Lock()
+		lines := pending
+		pending = nil
+		if len(lines) == 0 {
+			writing = false
+			written.Broadcast()
+			pendingMutex.Unlock()
+			return
+		}
+		pendingMutex.Unlock()
+
+		if err := write(lines); err != nil {
+			logger.Noticef("cannot record request decisions in audit log: %v", err)
+		}
+	}
+}
+
+// Flush waits for the recorded entries to be written to the audit log.
+func Flush() {
+	pendingMutex.Lock()
+	defer pendingMutex.Unlock()
+	for writing {
+		written.Wait()
+	}
+}
+
+// write appends the given lines to the audit log, rotating the log whenever
+// it grows too large.
+func write(lines [][]byte) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if err := prompting.EnsureStateDir(); err != nil {
+		return err
+	}
+	var f *os.File
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	for _, line := range lines {
+		if f == nil {
+			var err error
+			f, err = os.OpenFile(logPath(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+			if err != nil {
+				return fmt.Errorf("cannot open audit log: %w", err)
+			}
+		}
+		if _, err := f.Write(line); err != nil {
+			return fmt.Errorf("cannot write to audit log: %w", err)
+		}
+		st, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if st.Size() > maxLogSize {
+			f.Close()
+			f = nil
+			if err := rotate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rotate renames the audit log to the first rotated log, shifting the
+// existing rotated logs and dropping the oldest ones.
+//
+// The caller must ensure that the mutex is held.
+func rotate() error {
+	// Drop the rotated logs which are not kept anymore, in case the number
+	// of kept logs was lowered
+	for n := maxRotatedLogs; ; n++ {
+		err := os.Remove(rotatedLogPath(n))
+		if errors.Is(err, os.ErrNotExist) {
+			if n > maxRotatedLogs {
+				break
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("cannot rotate audit log: %w", err)
+		}
+	}
+	for n := maxRotatedLogs; n > 1; n-- {
+		err := os.Rename(rotatedLogPath(n-1), rotatedLogPath(n))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("cannot rotate audit log: %w", err)
+		}
+	}
+	if maxRotatedLogs == 0 {
+		if err := os.Remove(logPath()); err != nil {
+			return fmt.Errorf("cannot rotate audit log: %w", err)
+		}
+		return nil
+	}
+	if err := os.Rename(logPath(), rotatedLogPath(1)); err != nil {
+		return fmt.Errorf("cannot rotate audit log: %w", err)
+	}
+	return nil
+}
+
+// Filter selects audit log entries.
+type Filter struct {
+	// User is the user whose requests were decided, if set.
+	User *uint32
+	// Snap, Interface, Outcome and Source select the entries with the
+	// given values, if set.
+	Snap      string
+	Interface string
+	Outcome   prompting.OutcomeType
+	Source    SourceType
+	// After and Before delimit when the decisions were taken, if set.
+	After  time.Time
+	Before time.Time
+}
+
+func (f *Filter) matches(entry *Entry) bool {
+	if f == nil {
+		return true
+	}
+	if f.User != nil && entry.User != *f.User {
+		return false
+	}
+	if f.Snap != "" && entry.Snap != f.Snap {
+		return false
+	}
+	if f.Interface != "" && entry.Interface != f.Interface {
+		return false
+	}
+	if f.Outcome != prompting.OutcomeUnset && entry.Outcome != f.Outcome {
+		return false
+	}
+	if f.Source != "" && entry.Source != f.Source {
+		return false
+	}
+	if !f.After.IsZero() && entry.Timestamp.Before(f.After) {
+		return false
+	}
+	if !f.Before.IsZero() && !entry.Timestamp.Before(f.Before) {
+		return false
+	}
+	return true
+}
+
+// Entries returns the entries of the audit log, including the rotated logs,
+// which match the given filter, oldest first.
+func Entries(filter *Filter) ([]*Entry, error) {
+	// Include the entries which were recorded but not written yet
+	Flush()
+
+	// Prevent the logs from being rotated while they are read
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	var entries []*Entry
+	paths := make([]string, 0, maxRotatedLogs+1)
+	for n := maxRotatedLogs; n > 0; n-- {
+		paths = append(paths, rotatedLogPath(n))
+	}
+	paths = append(paths, logPath())
+	for _, path := range paths {
+		var err error
+		entries, err = readEntries(path, filter, entries)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// readEntries appends the entries of the log at the given path which match
+// the given filter to the given entries.
+func readEntries(path string, filter *Filter, entries []*Entry) ([]*Entry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read audit log: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// An incomplete last line was not completely written
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read audit log: %w", err)
+		}
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			logger.Noticef("ignoring invalid audit log entry: %v", err)
+			continue
+		}
+		if filter.matches(&entry) {
+			entries = append(entries, &entry)
+		}
+	}
+	return entries, nil
+}
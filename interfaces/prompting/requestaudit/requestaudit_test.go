@@ -0,0 +1,227 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package requestaudit_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/interfaces/prompting"
+	"github.com/snapcore/snapd/interfaces/prompting/requestaudit"
+	"github.com/snapcore/snapd/testutil"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type requestauditSuite struct {
+	testutil.BaseTest
+}
+
+var _ = Suite(&requestauditSuite{})
+
+func (s *requestauditSuite) SetUpTest(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+}
+
+func (s *requestauditSuite) TestNewEntry(c *C) {
+	before := time.Now()
+	for _, testCase := range []struct {
+		label string
+		snap  string
+		app   string
+	}{
+		{"snap.firefox.firefox", "firefox", "firefox"},
+		{"snap.firefox_foo.geckodriver", "firefox_foo", "geckodriver"},
+		{"snap.firefox.hook.configure", "firefox", "hook.configure"},
+		{"/usr/bin/foo", "/usr/bin/foo", ""},
+	} {
+		entry := requestaudit.NewEntry(1000, testCase.label, "home", "/home/test/foo", []string{"read"}, prompting.OutcomeAllow, requestaudit.SourceRule)
+		c.Check(entry.Timestamp.Before(before), Equals, false)
+		c.Check(entry, DeepEquals, &requestaudit.Entry{
+			Timestamp:   entry.Timestamp,
+			User:        1000,
+			Snap:        testCase.snap,
+			App:         testCase.app,
+			Interface:   "home",
+			Path:        "/home/test/foo",
+			Permissions: []string{"read"},
+			Outcome:     prompting.OutcomeAllow,
+			Source:      requestaudit.SourceRule,
+		}, Commentf("label: %s", testCase.label))
+	}
+}
+
+func mockEntries(c *C) []*requestaudit.Entry {
+	t0 := time.Date(2024, 8, 1, 10, 0, 0, 0, time.UTC)
+	entries := []*requestaudit.Entry{
+		{t0, 1000, "firefox", "firefox", "home", "/home/test/foo", []string{"read"}, prompting.OutcomeAllow, requestaudit.SourceRule},
+		{t0.Add(time.Minute), 1000, "firefox", "firefox", "home", "/home/test/.ssh/id_rsa", []string{"read", "write"}, prompting.OutcomeDeny, requestaudit.SourceReply},
+		{t0.Add(2 * time.Minute), 1001, "zoom-client", "zoom-client", "camera", "/dev/video0", []string{"access"}, prompting.OutcomeAllow, requestaudit.SourceReply},
+		{t0.Add(3 * time.Minute), 1001, "firefox", "firefox", "home", "/home/other/bar", []string{"write"}, prompting.OutcomeDeny, requestaudit.SourceExpired},
+	}
+	for _, entry := range entries {
+		c.Assert(requestaudit.Record(entry), IsNil)
+	}
+	// the entries are written in the background
+	requestaudit.Flush()
+	return entries
+}
+
+func (s *requestauditSuite) TestRecordEntries(c *C) {
+	entries := mockEntries(c)
+
+	st, err := os.Stat(requestaudit.LogPath())
+	c.Assert(err, IsNil)
+	c.Check(st.Mode().Perm(), Equals, os.FileMode(0600))
+	c.Check(requestaudit.LogPath(), testutil.FileContains, `{"timestamp":"2024-08-01T10:00:00Z","user":1000,"snap":"firefox","app":"firefox","interface":"home","path":"/home/test/foo","permissions":["read"],"outcome":"allow","source":"rule"}`+"\n")
+
+	all, err := requestaudit.Entries(nil)
+	c.Assert(err, IsNil)
+	c.Check(all, DeepEquals, entries)
+
+	user := uint32(1001)
+	for _, testCase := range []struct {
+		filter   *requestaudit.Filter
+		expected []*requestaudit.Entry
+	}{
+		{&requestaudit.Filter{}, entries},
+		{&requestaudit.Filter{User: &user}, entries[2:]},
+		{&requestaudit.Filter{Snap: "firefox"}, []*requestaudit.Entry{entries[0], entries[1], entries[3]}},
+		{&requestaudit.Filter{Interface: "camera"}, entries[2:3]},
+		{&requestaudit.Filter{Outcome: prompting.OutcomeDeny}, []*requestaudit.Entry{entries[1], entries[3]}},
+		{&requestaudit.Filter{Source: requestaudit.SourceReply}, entries[1:3]},
+		{&requestaudit.Filter{After: entries[1].Timestamp}, entries[1:]},
+		{&requestaudit.Filter{Before: entries[1].Timestamp}, entries[:1]},
+		{&requestaudit.Filter{Snap: "firefox", User: &user}, entries[3:]},
+		{&requestaudit.Filter{Snap: "foo"}, nil},
+	} {
+		found, err := requestaudit.Entries(testCase.filter)
+		c.Assert(err, IsNil)
+		c.Check(found, DeepEquals, testCase.expected, Commentf("filter: %+v", testCase.filter))
+	}
+}
+
+func (s *requestauditSuite) TestEntriesNoLog(c *C) {
+	entries, err := requestaudit.Entries(nil)
+	c.Assert(err, IsNil)
+	c.Check(entries, HasLen, 0)
+}
+
+func (s *requestauditSuite) TestEntriesIgnoresInvalidEntries(c *C) {
+	entries := mockEntries(c)
+
+	f, err := os.OpenFile(requestaudit.LogPath(), os.O_WRONLY|os.O_APPEND, 0600)
+	c.Assert(err, IsNil)
+	// An invalid entry, and an entry which was not completely written
+	_, err = f.WriteString("garbage\n" + `{"timestamp":"2024-08-01T10:00:00Z","user":1000,"snap":"fire`)
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	found, err := requestaudit.Entries(nil)
+	c.Assert(err, IsNil)
+	c.Check(found, DeepEquals, entries)
+}
+
+func (s *requestauditSuite) TestRecordRotates(c *C) {
+	restore := requestaudit.MockMaxLogSize(1)
+	defer restore()
+
+	// Every entry is rotated right after being recorded, and only three
+	// rotated logs are kept
+	entries := mockEntries(c)
+	c.Check(requestaudit.LogPath(), testutil.FileAbsent)
+	for n, entry := range []*requestaudit.Entry{entries[3], entries[2], entries[1]} {
+		path := requestaudit.LogPath() + "." + string(rune('1'+n))
+		c.Check(path, testutil.FileContains, `"path":"`+entry.Path+`"`)
+	}
+	c.Check(requestaudit.LogPath()+".4", testutil.FileAbsent)
+
+	found, err := requestaudit.Entries(nil)
+	c.Assert(err, IsNil)
+	c.Check(found, DeepEquals, entries[1:])
+
+	// New entries are read after the rotated ones
+	restore()
+	newEntry := requestaudit.NewEntry(1000, "snap.firefox.firefox", "home", "/home/test/new", []string{"read"}, prompting.OutcomeAllow, requestaudit.SourceRule)
+	c.Assert(requestaudit.Record(newEntry), IsNil)
+	found, err = requestaudit.Entries(nil)
+	c.Assert(err, IsNil)
+	c.Assert(found, HasLen, 4)
+	c.Check(found[3].Path, Equals, "/home/test/new")
+}
+
+func (s *requestauditSuite) TestSetRotation(c *C) {
+	s.AddCleanup(requestaudit.MockRotation(requestaudit.DefaultMaxLogSize, requestaudit.DefaultMaxLogFiles))
+
+	c.Assert(requestaudit.SetRotation(1, 5), IsNil)
+	entries := mockEntries(c)
+	c.Check(requestaudit.LogPath()+".4", testutil.FilePresent)
+
+	// Lowering the number of kept logs drops the extra ones at the next
+	// rotation
+	c.Assert(requestaudit.SetRotation(1, 2), IsNil)
+	newEntry := requestaudit.NewEntry(1000, "snap.firefox.firefox", "home", "/home/test/new", []string{"read"}, prompting.OutcomeAllow, requestaudit.SourceRule)
+	c.Assert(requestaudit.Record(newEntry), IsNil)
+	found, err := requestaudit.Entries(nil)
+	c.Assert(err, IsNil)
+	c.Check(found, HasLen, 1)
+	c.Check(found[0].Path, Equals, "/home/test/new")
+	for n := 2; n <= 4; n++ {
+		c.Check(requestaudit.LogPath()+"."+string(rune('0'+n)), testutil.FileAbsent)
+	}
+
+	// Only the current log is kept
+	c.Assert(requestaudit.SetRotation(1024*1024, 1), IsNil)
+	c.Assert(requestaudit.Record(entries[0]), IsNil)
+	found, err = requestaudit.Entries(nil)
+	c.Assert(err, IsNil)
+	c.Check(found, DeepEquals, entries[:1])
+
+	c.Check(requestaudit.SetRotation(0, 4), ErrorMatches, "invalid audit log size: 0")
+	c.Check(requestaudit.SetRotation(1024, 0), ErrorMatches, "invalid number of audit log files: 0")
+}
+
+func (s *requestauditSuite) TestRecordDoesNotWaitForWriting(c *C) {
+	restore := requestaudit.MockMaxPendingEntries(3)
+	defer restore()
+
+	unlock := requestaudit.LockLog()
+	entry := requestaudit.NewEntry(1000, "snap.firefox.firefox", "home", "/home/test/foo", []string{"read"}, prompting.OutcomeAllow, requestaudit.SourceRule)
+	recorded := 0
+	var err error
+	for ; recorded < 10; recorded++ {
+		if err = requestaudit.Record(entry); err != nil {
+			break
+		}
+	}
+	// The entries past the limit of pending entries are dropped
+	c.Check(err, ErrorMatches, "cannot record entry: too many entries waiting to be written to the audit log")
+	c.Check(recorded >= 3 && recorded <= 4, Equals, true, Commentf("recorded %d entries", recorded))
+	unlock()
+
+	found, err := requestaudit.Entries(nil)
+	c.Assert(err, IsNil)
+	c.Check(found, HasLen, recorded)
+}
@@ -26,6 +26,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
@@ -33,6 +34,7 @@ import (
 	"github.com/snapcore/snapd/interfaces/prompting"
 	prompting_errors "github.com/snapcore/snapd/interfaces/prompting/errors"
 	"github.com/snapcore/snapd/interfaces/prompting/internal/maxidmmap"
+	"github.com/snapcore/snapd/interfaces/prompting/requestaudit"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/sandbox/apparmor/notify/listener"
 	"github.com/snapcore/snapd/strutil"
@@ -152,6 +154,24 @@ func (p *Prompt) sendReplyWithPermission(allowedPermission any) error {
 
 var sendReply = (*listener.Request).Reply
 
+var recordAudit = requestaudit.Record
+
+// recordDecision records in the audit log that the receiving prompt of the
+// given user was resolved with the given outcome.
+func (p *Prompt) recordDecision(user uint32, outcome prompting.OutcomeType, source requestaudit.SourceType) {
+	// All listener requests of a prompt were made by the same snap and app,
+	// so the label of the first one is used.
+	label := p.Snap
+	if len(p.listenerReqs) > 0 {
+		label = p.listenerReqs[0].Label
+	}
+	entry := requestaudit.NewEntry(user, label, p.Interface, p.Constraints.path, p.Constraints.originalPermissions, outcome, source)
+	entry.Snap = p.Snap
+	if err := recordAudit(entry); err != nil {
+		logger.Noticef("cannot record prompt decision in audit log: %v", err)
+	}
+}
+
 // promptConstraints store the path which was requested, along with three
 // lists of permissions: the original permissions associated with the request,
 // the remaining unsatisfied permissions (as rules may satisfy some of the
@@ -317,6 +337,7 @@ func (udb *userPromptDB) timeoutCallback(pdb *PromptDB, user uint32) {
 	data := map[string]string{"resolved": "expired"}
 	for _, p := range expiredPrompts {
 		pdb.notifyPrompt(user, p.ID, data)
+		p.recordDecision(user, prompting.OutcomeDeny, requestaudit.SourceExpired)
 		p.sendReply(prompting.OutcomeDeny) // ignore any error, should not occur
 	}
 }
@@ -477,6 +498,20 @@ func (pdb *PromptDB) Prompts(user uint32, clientActivity bool) ([]*Prompt, error
 	return promptsCopy, nil
 }
 
+// Users returns the users which have outstanding prompts, in increasing order.
+func (pdb *PromptDB) Users() []uint32 {
+	pdb.mutex.RLock()
+	defer pdb.mutex.RUnlock()
+	var users []uint32
+	for user, userEntry := range pdb.perUser {
+		if len(userEntry.prompts) > 0 {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+	return users
+}
+
 // PromptWithID returns the prompt with the given ID for the given user.
 //
 // If clientActivity is true, reset the expiration timeout for prompts for
@@ -534,6 +569,7 @@ func (pdb *PromptDB) Reply(user uint32, id prompting.IDType, outcome prompting.O
 	userEntry.remove(id)
 	data := map[string]string{"resolved": "replied"}
 	pdb.notifyPrompt(user, id, data)
+	prompt.recordDecision(user, outcome, requestaudit.SourceReply)
 	return prompt, nil
 }
 
@@ -604,6 +640,7 @@ func (pdb *PromptDB) HandleNewRule(metadata *prompting.Metadata, constraints *pr
 		satisfiedPromptIDs = append(satisfiedPromptIDs, id)
 		data := map[string]string{"resolved": "satisfied"}
 		pdb.notifyPrompt(metadata.User, id, data)
+		prompt.recordDecision(metadata.User, outcome, requestaudit.SourceRule)
 	}
 	return satisfiedPromptIDs, nil
 }
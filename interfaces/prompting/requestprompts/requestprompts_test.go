@@ -36,11 +36,13 @@ import (
 	prompting_errors "github.com/snapcore/snapd/interfaces/prompting/errors"
 	"github.com/snapcore/snapd/interfaces/prompting/internal/maxidmmap"
 	"github.com/snapcore/snapd/interfaces/prompting/patterns"
+	"github.com/snapcore/snapd/interfaces/prompting/requestaudit"
 	"github.com/snapcore/snapd/interfaces/prompting/requestprompts"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/sandbox/apparmor/notify"
 	"github.com/snapcore/snapd/sandbox/apparmor/notify/listener"
 	"github.com/snapcore/snapd/testtime"
+	"github.com/snapcore/snapd/testutil"
 	"github.com/snapcore/snapd/timeutil"
 )
 
@@ -442,6 +444,37 @@ func (s *requestpromptsSuite) TestAddOrMergeTooMany(c *C) {
 	}
 }
 
+func (s *requestpromptsSuite) TestUsers(c *C) {
+	// Outstanding prompts are denied when the prompt DB is closed
+	restore := requestprompts.MockSendReply(func(listenerReq *listener.Request, allowedPermission any) error {
+		return nil
+	})
+	defer restore()
+
+	notifyPrompt := func(userID uint32, promptID prompting.IDType, data map[string]string) error {
+		return nil
+	}
+	pdb, err := requestprompts.New(notifyPrompt)
+	c.Assert(err, IsNil)
+	defer pdb.Close()
+
+	c.Check(pdb.Users(), HasLen, 0)
+
+	path := "/home/test/Documents/foo.txt"
+	permissions := []string{"read"}
+	for _, user := range []uint32{s.defaultUser + 1, s.defaultUser, s.defaultUser + 1} {
+		metadata := &prompting.Metadata{
+			User:      user,
+			Snap:      "nextcloud",
+			Interface: "home",
+		}
+		_, _, err := pdb.AddOrMerge(metadata, path, permissions, permissions, &listener.Request{})
+		c.Assert(err, IsNil)
+	}
+
+	c.Check(pdb.Users(), DeepEquals, []uint32{s.defaultUser, s.defaultUser + 1})
+}
+
 func (s *requestpromptsSuite) TestPromptWithIDErrors(c *C) {
 	restore := requestprompts.MockSendReply(func(listenerReq *listener.Request, allowedPermission any) error {
 		c.Fatalf("should not have called sendReply")
@@ -553,6 +586,17 @@ func (s *requestpromptsSuite) TestReply(c *C) {
 
 		expectedData := map[string]string{"resolved": "replied"}
 		s.checkNewNoticesSimple(c, []prompting.IDType{repliedPrompt.ID}, expectedData)
+
+		// Check that the decision was recorded in the audit log
+		entries, err := requestaudit.Entries(&requestaudit.Filter{Outcome: outcome})
+		c.Assert(err, IsNil)
+		c.Assert(entries, HasLen, 1)
+		c.Check(entries[0].User, Equals, metadata.User)
+		c.Check(entries[0].Snap, Equals, metadata.Snap)
+		c.Check(entries[0].Interface, Equals, metadata.Interface)
+		c.Check(entries[0].Path, Equals, path)
+		c.Check(entries[0].Permissions, DeepEquals, permissions)
+		c.Check(entries[0].Source, Equals, requestaudit.SourceReply)
 	}
 }
 
@@ -730,6 +774,23 @@ func (s *requestpromptsSuite) TestHandleNewRuleAllowPermissions(c *C) {
 	expectedPerm, err := prompting.AbstractPermissionsToAppArmorPermissions(metadata.Interface, permissions1)
 	c.Check(err, IsNil)
 	c.Check(allowedPermission, DeepEquals, expectedPerm)
+
+	// Check that each satisfied prompt was recorded in the audit log
+	entries, err := requestaudit.Entries(nil)
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 3)
+	auditedPerms := make([][]string, 0, len(entries))
+	for _, entry := range entries {
+		c.Check(entry.User, Equals, metadata.User)
+		c.Check(entry.Snap, Equals, metadata.Snap)
+		c.Check(entry.Path, Equals, path)
+		c.Check(entry.Outcome, Equals, prompting.OutcomeAllow)
+		c.Check(entry.Source, Equals, requestaudit.SourceRule)
+		auditedPerms = append(auditedPerms, entry.Permissions)
+	}
+	// prompt2 and prompt3 are satisfied in map order, but prompt1 is last
+	c.Check(auditedPerms[:2], testutil.DeepUnsortedMatches, [][]string{permissions2, permissions3})
+	c.Check(auditedPerms[2], DeepEquals, permissions1)
 }
 
 func promptIDListContains(haystack []prompting.IDType, needle prompting.IDType) bool {
@@ -1243,6 +1304,15 @@ func (s *requestpromptsSuite) TestPromptExpiration(c *C) {
 	checkCurrentNotices(c, noticeChan, prompt.ID, map[string]string{"resolved": "expired"})
 	waitForReply(c, replyChan)
 	c.Assert(timer.FireCount(), Equals, 3)
+
+	// Check that all expired prompts were recorded as denied
+	entries, err := requestaudit.Entries(&requestaudit.Filter{Source: requestaudit.SourceExpired})
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 4)
+	for _, entry := range entries {
+		c.Check(entry.Snap, Equals, metadata.Snap)
+		c.Check(entry.Outcome, Equals, prompting.OutcomeDeny)
+	}
 }
 
 func (s *requestpromptsSuite) TestPromptExpirationRace(c *C) {
@@ -26,8 +26,10 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
@@ -39,6 +41,13 @@ import (
 	"github.com/snapcore/snapd/osutil"
 )
 
+var currentUserSession = prompting.CurrentUserSession
+
+// AdminUser is the user of the rules set by the administrator for all users,
+// under which they are stored in the rule tree and their notices are
+// recorded. It is (uid_t)-1, which is never the UID of an actual user.
+const AdminUser uint32 = math.MaxUint32
+
 // Rule stores the contents of a request rule.
 type Rule struct {
 	ID          prompting.IDType       `json:"id"`
@@ -50,6 +59,60 @@ type Rule struct {
 	Outcome     prompting.OutcomeType  `json:"outcome"`
 	Lifespan    prompting.LifespanType `json:"lifespan"`
 	Expiration  time.Time              `json:"expiration,omitempty"`
+	// Session is the login session of the user during which a rule with
+	// lifespan "session" was created.
+	Session prompting.UserSessionID `json:"session,omitempty"`
+	// Admin is true if the rule was set by the administrator for all the
+	// users, in which case it takes precedence over the rules of the users.
+	Admin bool `json:"admin,omitempty"`
+}
+
+// RuleContents holds the contents of a rule, as used when importing and
+// exporting rules.
+type RuleContents struct {
+	Snap        string                 `json:"snap"`
+	Interface   string                 `json:"interface"`
+	Constraints *prompting.Constraints `json:"constraints"`
+	Outcome     prompting.OutcomeType  `json:"outcome"`
+	Lifespan    prompting.LifespanType `json:"lifespan"`
+	Duration    string                 `json:"duration,omitempty"`
+}
+
+// Contents returns the contents of the receiving rule, from which an
+// equivalent rule can be imported. The duration of a rule with a lifespan of
+// timespan is the time remaining until its expiration, rounded up to the
+// second.
+func (rule *Rule) Contents(currTime time.Time) *RuleContents {
+	contents := &RuleContents{
+		Snap:        rule.Snap,
+		Interface:   rule.Interface,
+		Constraints: rule.Constraints,
+		Outcome:     rule.Outcome,
+		Lifespan:    rule.Lifespan,
+	}
+	if rule.Lifespan == prompting.LifespanTimespan {
+		remaining := rule.Expiration.Sub(currTime)
+		if remaining < time.Second {
+			remaining = time.Second
+		}
+		contents.Duration = (remaining + time.Second - 1).Truncate(time.Second).String()
+	}
+	return contents
+}
+
+// treeUser returns the user under which the receiving rule is stored in the
+// rule tree.
+func (rule *Rule) treeUser() uint32 {
+	if rule.Admin {
+		return AdminUser
+	}
+	return rule.User
+}
+
+// ownedBy returns true if the receiving rule is a rule of the given user, and
+// not an admin rule.
+func (rule *Rule) ownedBy(user uint32) bool {
+	return !rule.Admin && rule.User == user
 }
 
 // Validate verifies internal correctness of the rule
@@ -70,24 +133,39 @@ func (rule *Rule) validate(currTime time.Time) error {
 		// Error may occur when validating a rule loaded from disk.
 		return err
 	}
+	if rule.Lifespan == prompting.LifespanSession && rule.Session == 0 {
+		return prompting_errors.ErrNoUserSession
+	}
+	if rule.Admin && rule.Lifespan != prompting.LifespanForever {
+		return prompting_errors.NewInvalidLifespanError(string(rule.Lifespan), supportedAdminRuleLifespans)
+	}
 	return nil
 }
 
+var supportedAdminRuleLifespans = []string{string(prompting.LifespanForever)}
+
 // Expired returns true if the receiving rule has a lifespan of timespan and
 // the current time is after the rule's expiration time.
+//
+// Rules with a lifespan of session do not expire with time, they are removed
+// by ExpireSessionRules once the user logs out, or when loading the rule
+// database if the user logged out in the meantime.
 func (rule *Rule) Expired(currentTime time.Time) bool {
 	switch rule.Lifespan {
 	case prompting.LifespanTimespan:
 		if currentTime.After(rule.Expiration) {
 			return true
 		}
-		// TODO: add lifespan session
-		//case prompting.LifespanSession:
-		// TODO: return true if the user session has changed
 	}
 	return false
 }
 
+// sessionEnded returns true if the receiving rule has a lifespan of session
+// and the given session is not the one during which the rule was created.
+func (rule *Rule) sessionEnded(currentSession prompting.UserSessionID) bool {
+	return rule.Lifespan == prompting.LifespanSession && rule.Session != currentSession
+}
+
 // variantEntry stores the actual pattern variant struct which can be used to
 // match paths, and the set of rule IDs whose path patterns render to this
 // variant. All rules in a particular entry must have the same outcome, and
@@ -146,6 +224,11 @@ type RuleDB struct {
 	// matching given query
 	perUser map[uint32]*userDB
 
+	// uncheckedSessions holds the users whose login session could not be
+	// determined when loading the rules, so whose rules with lifespan
+	// session were kept until their session can be checked again.
+	uncheckedSessions map[uint32]bool
+
 	dbPath string
 	// notifyRule is a closure which will be called to record a notice when a
 	// rule is added, patched, or removed.
@@ -194,8 +277,12 @@ type rulesDBJSON struct {
 // load resets the receiving rule database to empty and then reads the stored
 // rules from the database file and populates the database.
 //
-// Removes any expired rules while loading the database. If any rules expired,
-// saves the database to disk.
+// Removes any expired rules while loading the database, including rules with
+// lifespan session whose user logged out. If any rules expired, saves the
+// database to disk. If the login session of a user cannot be determined, for
+// example because logind cannot be reached, the rules with lifespan session of
+// that user are kept, and the user is reported by UncheckedSessionUsers so
+// that its rules can be expired later using ExpireSessionRules.
 //
 // Returns an error if an existing rule DB cannot be loaded, if any rules are
 // invalid or in conflict, or if there is an error while saving the database to
@@ -207,6 +294,7 @@ func (rdb *RuleDB) load() (retErr error) {
 	rdb.indexByID = make(map[prompting.IDType]int)
 	rdb.rules = make([]*Rule, 0)
 	rdb.perUser = make(map[uint32]*userDB)
+	rdb.uncheckedSessions = make(map[uint32]bool)
 
 	expiredRules := make(map[*Rule]bool)
 
@@ -231,6 +319,7 @@ func (rdb *RuleDB) load() (retErr error) {
 	}
 
 	currTime := time.Now()
+	sessions := make(map[uint32]prompting.UserSessionID)
 
 	var errInvalid error
 	for _, rule := range wrapped.Rules {
@@ -238,6 +327,25 @@ func (rdb *RuleDB) load() (retErr error) {
 			expiredRules[rule] = true
 			continue
 		}
+		if rule.Lifespan == prompting.LifespanSession {
+			session, ok := sessions[rule.User]
+			if !ok && !rdb.uncheckedSessions[rule.User] {
+				var err error
+				session, err = currentUserSession(rule.User)
+				if err != nil && !errors.Is(err, prompting_errors.ErrNoUserSession) {
+					// The session may still be ongoing, so keep the
+					// rules of the user until it can be checked again.
+					logger.Noticef("cannot check login session of user %d, keeping its rules with lifespan session: %v", rule.User, err)
+					rdb.uncheckedSessions[rule.User] = true
+				} else {
+					sessions[rule.User] = session
+				}
+			}
+			if !rdb.uncheckedSessions[rule.User] && rule.sessionEnded(session) {
+				expiredRules[rule] = true
+				continue
+			}
+		}
 		// If an expired rule happens to be invalid, it's fine, since we remove
 		// it anyway.
 
@@ -263,6 +371,7 @@ func (rdb *RuleDB) load() (retErr error) {
 		rdb.indexByID = make(map[prompting.IDType]int)
 		rdb.rules = make([]*Rule, 0)
 		rdb.perUser = make(map[uint32]*userDB)
+		rdb.uncheckedSessions = make(map[uint32]bool)
 
 		// Save the empty rule DB to disk to overwrite the previous one which
 		// was invalid.
@@ -456,7 +565,7 @@ func (rdb *RuleDB) addRuleToTree(rule *Rule) *prompting_errors.RuleConflictError
 //
 // The caller must ensure that the database lock is held for writing.
 func (rdb *RuleDB) addRulePermissionToTree(rule *Rule, permission string) []prompting_errors.RuleConflict {
-	permVariants := rdb.ensurePermissionDBForUserSnapInterfacePermission(rule.User, rule.Snap, rule.Interface, permission)
+	permVariants := rdb.ensurePermissionDBForUserSnapInterfacePermission(rule.treeUser(), rule.Snap, rule.Interface, permission)
 
 	newVariantEntries := make(map[string]variantEntry, rule.Constraints.PathPattern.NumVariants())
 	expiredRules := make(map[prompting.IDType]bool)
@@ -566,7 +675,7 @@ func (rdb *RuleDB) removeRuleFromTree(rule *Rule) error {
 //
 // The caller must ensure that the database lock is held for writing.
 func (rdb *RuleDB) removeRulePermissionFromTree(rule *Rule, permission string) []error {
-	permVariants, ok := rdb.permissionDBForUserSnapInterfacePermission(rule.User, rule.Snap, rule.Interface, permission)
+	permVariants, ok := rdb.permissionDBForUserSnapInterfacePermission(rule.treeUser(), rule.Snap, rule.Interface, permission)
 	if !ok || permVariants == nil {
 		err := fmt.Errorf("internal error: no rules in the rule tree for user %d, snap %q, interface %q, permission %q", rule.User, rule.Snap, rule.Interface, permission)
 		return []error{err}
@@ -752,6 +861,17 @@ func (rdb *RuleDB) makeNewRule(user uint32, snap string, iface string, constrain
 	if err != nil {
 		return nil, err
 	}
+	constraints, err = constraints.WithDefaultPathPattern(iface)
+	if err != nil {
+		return nil, err
+	}
+	var session prompting.UserSessionID
+	if lifespan == prompting.LifespanSession {
+		session, err = currentUserSession(user)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	newRule := Rule{
 		Timestamp:   currTime,
@@ -762,6 +882,7 @@ func (rdb *RuleDB) makeNewRule(user uint32, snap string, iface string, constrain
 		Outcome:     outcome,
 		Lifespan:    lifespan,
 		Expiration:  expiration,
+		Session:     session,
 	}
 
 	if err := newRule.validate(currTime); err != nil {
@@ -777,10 +898,24 @@ func (rdb *RuleDB) makeNewRule(user uint32, snap string, iface string, constrain
 
 // IsPathAllowed checks whether the given path with the given permission is
 // allowed or denied by existing rules for the given user, snap, and interface.
-// If no rule applies, returns prompting_errors.ErrNoMatchingRule.
+// Admin rules take precedence over the rules of the user. If no rule applies,
+// returns prompting_errors.ErrNoMatchingRule.
 func (rdb *RuleDB) IsPathAllowed(user uint32, snap string, iface string, path string, permission string) (bool, error) {
 	rdb.mutex.RLock()
 	defer rdb.mutex.RUnlock()
+	allowed, err := rdb.isPathAllowedForTreeUser(AdminUser, snap, iface, path, permission)
+	if !errors.Is(err, prompting_errors.ErrNoMatchingRule) {
+		return allowed, err
+	}
+	return rdb.isPathAllowedForTreeUser(user, snap, iface, path, permission)
+}
+
+// isPathAllowedForTreeUser checks whether the given path with the given
+// permission is allowed or denied by the rules stored in the rule tree under
+// the given user, snap, and interface.
+//
+// The caller must ensure that the database lock is held.
+func (rdb *RuleDB) isPathAllowedForTreeUser(user uint32, snap string, iface string, path string, permission string) (bool, error) {
 	permissionMap, ok := rdb.permissionDBForUserSnapInterfacePermission(user, snap, iface, permission)
 	if !ok || permissionMap == nil {
 		return false, prompting_errors.ErrNoMatchingRule
@@ -840,7 +975,7 @@ func (rdb *RuleDB) Rules(user uint32) []*Rule {
 	rdb.mutex.RLock()
 	defer rdb.mutex.RUnlock()
 	ruleFilter := func(rule *Rule) bool {
-		return rule.User == user
+		return rule.ownedBy(user)
 	}
 	return rdb.rulesInternal(ruleFilter)
 }
@@ -873,7 +1008,7 @@ func (rdb *RuleDB) RulesForSnap(user uint32, snap string) []*Rule {
 	rdb.mutex.RLock()
 	defer rdb.mutex.RUnlock()
 	ruleFilter := func(rule *Rule) bool {
-		return rule.User == user && rule.Snap == snap
+		return rule.ownedBy(user) && rule.Snap == snap
 	}
 	return rdb.rulesInternal(ruleFilter)
 }
@@ -884,7 +1019,7 @@ func (rdb *RuleDB) RulesForInterface(user uint32, iface string) []*Rule {
 	rdb.mutex.RLock()
 	defer rdb.mutex.RUnlock()
 	ruleFilter := func(rule *Rule) bool {
-		return rule.User == user && rule.Interface == iface
+		return rule.ownedBy(user) && rule.Interface == iface
 	}
 	return rdb.rulesInternal(ruleFilter)
 }
@@ -895,7 +1030,7 @@ func (rdb *RuleDB) RulesForSnapInterface(user uint32, snap string, iface string)
 	rdb.mutex.RLock()
 	defer rdb.mutex.RUnlock()
 	ruleFilter := func(rule *Rule) bool {
-		return rule.User == user && rule.Snap == snap && rule.Interface == iface
+		return rule.ownedBy(user) && rule.Snap == snap && rule.Interface == iface
 	}
 	return rdb.rulesInternal(ruleFilter)
 }
@@ -909,7 +1044,7 @@ func (rdb *RuleDB) lookupRuleByIDForUser(user uint32, id prompting.IDType) (*Rul
 	if err != nil {
 		return nil, err
 	}
-	if rule.User != user {
+	if !rule.ownedBy(user) {
 		return nil, prompting_errors.ErrRuleNotAllowed
 	}
 	return rule, nil
@@ -958,20 +1093,20 @@ func (rdb *RuleDB) RemoveRulesForSnap(user uint32, snap string) ([]*Rule, error)
 	rdb.mutex.Lock()
 	defer rdb.mutex.Unlock()
 	ruleFilter := func(rule *Rule) bool {
-		return rule.User == user && rule.Snap == snap
+		return rule.ownedBy(user) && rule.Snap == snap
 	}
 	rules := rdb.rulesInternal(ruleFilter)
-	if err := rdb.removeRulesInternal(user, rules); err != nil {
+	if err := rdb.removeRulesInternal(user, rules, map[string]string{"removed": "removed"}); err != nil {
 		return nil, err
 	}
 	return rules, nil
 }
 
 // removeRulesInternal removes all of the given rules from the rule DB and
-// records a notice for each one.
+// records a notice with the given data for each one.
 //
 // The caller must ensure that the database lock is held for writing.
-func (rdb *RuleDB) removeRulesInternal(user uint32, rules []*Rule) error {
+func (rdb *RuleDB) removeRulesInternal(user uint32, rules []*Rule, data map[string]string) error {
 	if rdb.maxIDMmap.IsClosed() {
 		return prompting_errors.ErrRulesClosed
 	}
@@ -998,7 +1133,6 @@ func (rdb *RuleDB) removeRulesInternal(user uint32, rules []*Rule) error {
 	}
 
 	// Save successful, now remove rules' variants from tree
-	data := map[string]string{"removed": "removed"}
 	for _, rule := range rules {
 		rdb.removeRuleFromTree(rule)
 		// If error occurs, rule was still fully removed from tree, and no other
@@ -1008,16 +1142,56 @@ func (rdb *RuleDB) removeRulesInternal(user uint32, rules []*Rule) error {
 	return nil
 }
 
+// ExpireSessionRules removes the rules with lifespan session of the user with
+// the given user ID which were created during a login session which has since
+// ended, and records a notice for each one. It should be called when the user
+// logs out, and for each of the users returned by UncheckedSessionUsers.
+func (rdb *RuleDB) ExpireSessionRules(user uint32) ([]*Rule, error) {
+	// Look up the session before taking the lock, as it involves a call to
+	// logind.
+	session, err := currentUserSession(user)
+	if err != nil && !errors.Is(err, prompting_errors.ErrNoUserSession) {
+		return nil, err
+	}
+
+	rdb.mutex.Lock()
+	defer rdb.mutex.Unlock()
+	delete(rdb.uncheckedSessions, user)
+	ruleFilter := func(rule *Rule) bool {
+		return rule.ownedBy(user) && rule.sessionEnded(session)
+	}
+	rules := rdb.rulesInternal(ruleFilter)
+	if err := rdb.removeRulesInternal(user, rules, map[string]string{"removed": "expired"}); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// UncheckedSessionUsers returns the users, in increasing order, whose login
+// session could not be determined when loading the rule database, and whose
+// rules with lifespan session have not been checked by ExpireSessionRules
+// since.
+func (rdb *RuleDB) UncheckedSessionUsers() []uint32 {
+	rdb.mutex.RLock()
+	defer rdb.mutex.RUnlock()
+	var users []uint32
+	for user := range rdb.uncheckedSessions {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+	return users
+}
+
 // RemoveRulesForInterface removes all rules pertaining to the given interface
 // for the user with the given user ID.
 func (rdb *RuleDB) RemoveRulesForInterface(user uint32, iface string) ([]*Rule, error) {
 	rdb.mutex.Lock()
 	defer rdb.mutex.Unlock()
 	ruleFilter := func(rule *Rule) bool {
-		return rule.User == user && rule.Interface == iface
+		return rule.ownedBy(user) && rule.Interface == iface
 	}
 	rules := rdb.rulesInternal(ruleFilter)
-	if err := rdb.removeRulesInternal(user, rules); err != nil {
+	if err := rdb.removeRulesInternal(user, rules, map[string]string{"removed": "removed"}); err != nil {
 		return nil, err
 	}
 	return rules, nil
@@ -1029,10 +1203,10 @@ func (rdb *RuleDB) RemoveRulesForSnapInterface(user uint32, snap string, iface s
 	rdb.mutex.Lock()
 	defer rdb.mutex.Unlock()
 	ruleFilter := func(rule *Rule) bool {
-		return rule.User == user && rule.Snap == snap && rule.Interface == iface
+		return rule.ownedBy(user) && rule.Snap == snap && rule.Interface == iface
 	}
 	rules := rdb.rulesInternal(ruleFilter)
-	if err := rdb.removeRulesInternal(user, rules); err != nil {
+	if err := rdb.removeRulesInternal(user, rules, map[string]string{"removed": "removed"}); err != nil {
 		return nil, err
 	}
 	return rules, nil
@@ -1101,3 +1275,143 @@ func (rdb *RuleDB) PatchRule(user uint32, id prompting.IDType, constraints *prom
 	rdb.notifyRule(newRule.User, newRule.ID, nil)
 	return newRule, nil
 }
+
+// ImportRules creates rules with the given contents for the user with the
+// given user ID and adds them to the rule database. Either all the rules are
+// added, or, if any of them is invalid or conflicts with an existing rule,
+// none is and an error is returned. Returns the newly-added rules, and saves
+// the database to disk.
+func (rdb *RuleDB) ImportRules(user uint32, contents []*RuleContents) ([]*Rule, error) {
+	rdb.mutex.Lock()
+	defer rdb.mutex.Unlock()
+
+	if rdb.maxIDMmap.IsClosed() {
+		return nil, prompting_errors.ErrRulesClosed
+	}
+
+	newRules, err := rdb.addRulesFromContents(user, false, contents)
+	if err != nil {
+		return nil, err
+	}
+	if err := rdb.save(); err != nil {
+		for _, rule := range newRules {
+			rdb.removeRuleByID(rule.ID)
+		}
+		return nil, err
+	}
+
+	for _, rule := range newRules {
+		rdb.notifyRule(user, rule.ID, nil)
+	}
+	return newRules, nil
+}
+
+// addRulesFromContents creates rules with the given contents and adds them to
+// the rule DB. If any rule cannot be created or added, the rules which were
+// added are removed again and an error is returned.
+//
+// The caller must ensure that the database lock is held for writing.
+func (rdb *RuleDB) addRulesFromContents(user uint32, admin bool, contents []*RuleContents) ([]*Rule, error) {
+	newRules := make([]*Rule, 0, len(contents))
+	rollback := func() {
+		for _, rule := range newRules {
+			rdb.removeRuleByID(rule.ID)
+		}
+	}
+	for i, ruleContents := range contents {
+		if ruleContents == nil {
+			rollback()
+			return nil, fmt.Errorf("cannot import rule %d: empty rule", i)
+		}
+		if admin && ruleContents.Lifespan != prompting.LifespanForever {
+			// Check before creating the rule, so no ID is consumed
+			rollback()
+			err := prompting_errors.NewInvalidLifespanError(string(ruleContents.Lifespan), supportedAdminRuleLifespans)
+			return nil, fmt.Errorf("cannot import rule %d: %w", i, err)
+		}
+		newRule, err := rdb.makeNewRule(user, ruleContents.Snap, ruleContents.Interface, ruleContents.Constraints, ruleContents.Outcome, ruleContents.Lifespan, ruleContents.Duration)
+		if err != nil {
+			rollback()
+			return nil, fmt.Errorf("cannot import rule %d: %w", i, err)
+		}
+		newRule.Admin = admin
+		if err := rdb.addRule(newRule); err != nil {
+			rollback()
+			return nil, fmt.Errorf("cannot import rule %d: %w", i, err)
+		}
+		newRules = append(newRules, newRule)
+	}
+	return newRules, nil
+}
+
+// AdminRules returns the rules set by the administrator for all users.
+func (rdb *RuleDB) AdminRules() []*Rule {
+	rdb.mutex.RLock()
+	defer rdb.mutex.RUnlock()
+	ruleFilter := func(rule *Rule) bool {
+		return rule.Admin
+	}
+	return rdb.rulesInternal(ruleFilter)
+}
+
+// SetAdminRules replaces the rules set by the administrator for all users
+// with rules created from the given contents, which must have a lifespan of
+// forever. Admin rules take precedence over the rules of the users, and
+// cannot be modified or removed by them.
+//
+// If any of the new rules is invalid or conflicts with another, the existing
+// admin rules are left unchanged and an error is returned. Otherwise, returns
+// the new admin rules, and saves the database to disk.
+func (rdb *RuleDB) SetAdminRules(contents []*RuleContents) ([]*Rule, error) {
+	rdb.mutex.Lock()
+	defer rdb.mutex.Unlock()
+
+	if rdb.maxIDMmap.IsClosed() {
+		return nil, prompting_errors.ErrRulesClosed
+	}
+
+	oldRules := rdb.rulesInternal(func(rule *Rule) bool { return rule.Admin })
+	for _, rule := range oldRules {
+		rdb.removeRuleByID(rule.ID)
+	}
+	restoreOldRules := func() {
+		for _, rule := range oldRules {
+			// The old rules did not conflict before, so this cannot fail
+			rdb.addRule(rule)
+		}
+	}
+
+	// Admin rules are not owned by any user
+	newRules, err := rdb.addRulesFromContents(AdminUser, true, contents)
+	if err != nil {
+		restoreOldRules()
+		return nil, err
+	}
+	if err := rdb.save(); err != nil {
+		for _, rule := range newRules {
+			rdb.removeRuleByID(rule.ID)
+		}
+		restoreOldRules()
+		return nil, err
+	}
+
+	removedData := map[string]string{"removed": "removed"}
+	for _, rule := range oldRules {
+		rdb.notifyRule(rule.User, rule.ID, removedData)
+	}
+	for _, rule := range newRules {
+		rdb.notifyRule(rule.User, rule.ID, nil)
+	}
+	return newRules, nil
+}
+
+// MockCurrentUserSession mocks the function to look up the current login
+// session of a user so tests, both for this package and for consumers of this
+// package, do not need logind.
+func MockCurrentUserSession(f func(uid uint32) (prompting.UserSessionID, error)) (restore func()) {
+	orig := currentUserSession
+	currentUserSession = f
+	return func() {
+		currentUserSession = orig
+	}
+}
@@ -129,6 +129,19 @@ func (s *requestrulesSuite) TestRuleValidate(c *C) {
 	c.Check(rule.Validate(currTime), ErrorMatches, "invalid permissions for home interface:.*")
 }
 
+func (s *requestrulesSuite) TestRuleValidateSession(c *C) {
+	currTime := time.Now()
+	rule := s.ruleTemplate(c, prompting.IDType(1))
+	rule.Lifespan = prompting.LifespanSession
+	c.Check(rule.Validate(currTime), Equals, prompting_errors.ErrNoUserSession)
+
+	rule.Session = prompting.UserSessionID(1234)
+	c.Check(rule.Validate(currTime), IsNil)
+
+	rule.Expiration = currTime.Add(time.Minute)
+	c.Check(rule.Validate(currTime), ErrorMatches, `invalid expiration: cannot have specified expiration when lifespan is "session".*`)
+}
+
 func mustParsePathPattern(c *C, patternStr string) *patterns.PathPattern {
 	pattern, err := patterns.ParsePathPattern(patternStr)
 	c.Assert(err, IsNil)
@@ -412,6 +425,132 @@ func (s *requestrulesSuite) TestLoadExpiredRules(c *C) {
 	s.checkNewNotices(c, expectedNoticeInfo)
 }
 
+// mockUserSessions mocks the current login sessions of users, users without
+// a session are not logged in.
+func mockUserSessions(sessions map[uint32]prompting.UserSessionID) (restore func()) {
+	return requestrules.MockCurrentUserSession(func(uid uint32) (prompting.UserSessionID, error) {
+		session, ok := sessions[uid]
+		if !ok {
+			return 0, prompting_errors.ErrNoUserSession
+		}
+		return session, nil
+	})
+}
+
+func (s *requestrulesSuite) TestLoadSessionRules(c *C) {
+	dbPath := s.prepDBPath(c)
+	restore := mockUserSessions(map[uint32]prompting.UserSessionID{
+		s.defaultUser: 2000,
+	})
+	defer restore()
+
+	good1 := s.ruleTemplate(c, prompting.IDType(1))
+
+	// Session rule from the current session of the user
+	good2 := s.ruleTemplate(c, prompting.IDType(2))
+	good2.Constraints.PathPattern = mustParsePathPattern(c, "/home/test/current")
+	good2.Lifespan = prompting.LifespanSession
+	good2.Session = 2000
+
+	// Session rule from a previous session of the user
+	expired1 := s.ruleTemplate(c, prompting.IDType(3))
+	expired1.Constraints.PathPattern = mustParsePathPattern(c, "/home/test/previous")
+	expired1.Lifespan = prompting.LifespanSession
+	expired1.Session = 1000
+
+	// Session rule of a user who logged out
+	expired2 := s.ruleTemplate(c, prompting.IDType(4))
+	expired2.User = s.defaultUser + 1
+	expired2.Lifespan = prompting.LifespanSession
+	expired2.Session = 2000
+
+	rules := []*requestrules.Rule{good1, good2, expired1, expired2}
+	s.writeRules(c, dbPath, rules)
+
+	logbuf, restore := logger.MockLogger()
+	defer restore()
+	rdb, err := requestrules.New(s.defaultNotifyRule)
+	c.Check(err, IsNil)
+	c.Check(rdb, NotNil)
+	c.Check(logbuf.String(), HasLen, 0)
+
+	s.checkWrittenRuleDB(c, []*requestrules.Rule{good1, good2})
+
+	expectedNoticeInfo := []*noticeInfo{
+		{
+			userID: good1.User,
+			ruleID: good1.ID,
+			data:   nil,
+		},
+		{
+			userID: good2.User,
+			ruleID: good2.ID,
+			data:   nil,
+		},
+		{
+			userID: expired1.User,
+			ruleID: expired1.ID,
+			data:   map[string]string{"removed": "expired"},
+		},
+		{
+			userID: expired2.User,
+			ruleID: expired2.ID,
+			data:   map[string]string{"removed": "expired"},
+		},
+	}
+	s.checkNewNotices(c, expectedNoticeInfo)
+}
+
+func (s *requestrulesSuite) TestLoadSessionRulesSessionUnknown(c *C) {
+	dbPath := s.prepDBPath(c)
+	var sessionErr error = errors.New("cannot connect to the system bus: boom")
+	restore := requestrules.MockCurrentUserSession(func(uid uint32) (prompting.UserSessionID, error) {
+		if sessionErr != nil {
+			return 0, sessionErr
+		}
+		return 0, prompting_errors.ErrNoUserSession
+	})
+	defer restore()
+
+	good := s.ruleTemplate(c, prompting.IDType(1))
+
+	// Session rule whose session cannot be determined
+	session := s.ruleTemplate(c, prompting.IDType(2))
+	session.Constraints.PathPattern = mustParsePathPattern(c, "/home/test/current")
+	session.Lifespan = prompting.LifespanSession
+	session.Session = 2000
+
+	rules := []*requestrules.Rule{good, session}
+	s.writeRules(c, dbPath, rules)
+
+	logbuf, restore := logger.MockLogger()
+	defer restore()
+	rdb, err := requestrules.New(s.defaultNotifyRule)
+	c.Assert(err, IsNil)
+	c.Check(logbuf.String(), testutil.Contains, fmt.Sprintf("cannot check login session of user %d, keeping its rules with lifespan session: cannot connect to the system bus: boom", s.defaultUser))
+
+	// The session rule is kept until the session can be checked
+	s.checkWrittenRuleDB(c, rules)
+	s.checkNewNoticesSimple(c, nil, good, session)
+	c.Check(rdb.UncheckedSessionUsers(), DeepEquals, []uint32{s.defaultUser})
+
+	// The session still cannot be checked
+	_, err = rdb.ExpireSessionRules(s.defaultUser)
+	c.Check(err, Equals, sessionErr)
+	c.Check(rdb.UncheckedSessionUsers(), DeepEquals, []uint32{s.defaultUser})
+	s.checkNewNotices(c, nil)
+
+	// The user logged out in the meantime
+	sessionErr = nil
+	expired, err := rdb.ExpireSessionRules(s.defaultUser)
+	c.Assert(err, IsNil)
+	c.Assert(expired, HasLen, 1)
+	c.Check(expired[0].ID, Equals, session.ID)
+	c.Check(rdb.UncheckedSessionUsers(), HasLen, 0)
+	s.checkNewNoticesSimple(c, map[string]string{"removed": "expired"}, session)
+	s.checkWrittenRuleDB(c, []*requestrules.Rule{good})
+}
+
 func (s *requestrulesSuite) TestLoadHappy(c *C) {
 	dbPath := s.prepDBPath(c)
 
@@ -581,6 +720,111 @@ func (s *requestrulesSuite) TestAddRuleHappy(c *C) {
 	}
 }
 
+func (s *requestrulesSuite) TestAddRuleSession(c *C) {
+	sessions := map[uint32]prompting.UserSessionID{
+		s.defaultUser: 2000,
+	}
+	restore := mockUserSessions(sessions)
+	defer restore()
+
+	rdb, err := requestrules.New(s.defaultNotifyRule)
+	c.Assert(err, IsNil)
+
+	template := &addRuleContents{
+		User:        s.defaultUser,
+		Snap:        "lxd",
+		Interface:   "home",
+		PathPattern: "/home/test/**",
+		Permissions: []string{"read"},
+		Outcome:     prompting.OutcomeAllow,
+		Lifespan:    prompting.LifespanSession,
+	}
+	rule, err := addRuleFromTemplate(c, rdb, template, nil)
+	c.Assert(err, IsNil)
+	c.Check(rule.Lifespan, Equals, prompting.LifespanSession)
+	c.Check(rule.Session, Equals, prompting.UserSessionID(2000))
+	c.Check(rule.Expiration.IsZero(), Equals, true)
+	s.checkWrittenRuleDB(c, []*requestrules.Rule{rule})
+	s.checkNewNoticesSimple(c, nil, rule)
+
+	// Session rules cannot have a duration
+	_, err = addRuleFromTemplate(c, rdb, template, &addRuleContents{
+		PathPattern: "/home/test/foo",
+		Duration:    "10s",
+	})
+	c.Check(err, ErrorMatches, `invalid duration: cannot have specified duration when lifespan is "session".*`)
+
+	// A user who is not logged in cannot have session rules
+	_, err = addRuleFromTemplate(c, rdb, template, &addRuleContents{
+		User: s.defaultUser + 1,
+	})
+	c.Check(err, Equals, prompting_errors.ErrNoUserSession)
+	s.checkWrittenRuleDB(c, []*requestrules.Rule{rule})
+	s.checkNewNotices(c, nil)
+}
+
+func (s *requestrulesSuite) TestExpireSessionRules(c *C) {
+	sessions := map[uint32]prompting.UserSessionID{
+		s.defaultUser:     2000,
+		s.defaultUser + 1: 3000,
+	}
+	restore := mockUserSessions(sessions)
+	defer restore()
+
+	rdb, err := requestrules.New(s.defaultNotifyRule)
+	c.Assert(err, IsNil)
+
+	template := &addRuleContents{
+		User:        s.defaultUser,
+		Snap:        "lxd",
+		Interface:   "home",
+		PathPattern: "/home/test/**",
+		Permissions: []string{"read"},
+		Outcome:     prompting.OutcomeAllow,
+		Lifespan:    prompting.LifespanSession,
+	}
+	sessionRule, err := addRuleFromTemplate(c, rdb, template, nil)
+	c.Assert(err, IsNil)
+	foreverRule, err := addRuleFromTemplate(c, rdb, template, &addRuleContents{
+		PathPattern: "/home/test/foo/**",
+		Lifespan:    prompting.LifespanForever,
+	})
+	c.Assert(err, IsNil)
+	otherUserRule, err := addRuleFromTemplate(c, rdb, template, &addRuleContents{
+		User: s.defaultUser + 1,
+	})
+	c.Assert(err, IsNil)
+	s.ruleNotices = s.ruleNotices[:0]
+
+	// Nothing expires while the session is still the same
+	expired, err := rdb.ExpireSessionRules(s.defaultUser)
+	c.Assert(err, IsNil)
+	c.Check(expired, HasLen, 0)
+	s.checkNewNotices(c, nil)
+
+	// The user logs out
+	delete(sessions, s.defaultUser)
+	expired, err = rdb.ExpireSessionRules(s.defaultUser)
+	c.Assert(err, IsNil)
+	c.Check(expired, DeepEquals, []*requestrules.Rule{sessionRule})
+	s.checkNewNoticesSimple(c, map[string]string{"removed": "expired"}, sessionRule)
+	s.checkWrittenRuleDB(c, []*requestrules.Rule{otherUserRule, foreverRule})
+
+	allowed, err := rdb.IsPathAllowed(s.defaultUser, "lxd", "home", "/home/test/bar", "read")
+	c.Check(err, Equals, prompting_errors.ErrNoMatchingRule)
+	c.Check(allowed, Equals, false)
+
+	// Session rules of the new session are kept
+	sessions[s.defaultUser] = 4000
+	newSessionRule, err := addRuleFromTemplate(c, rdb, template, nil)
+	c.Assert(err, IsNil)
+	s.ruleNotices = s.ruleNotices[:0]
+	expired, err = rdb.ExpireSessionRules(s.defaultUser)
+	c.Assert(err, IsNil)
+	c.Check(expired, HasLen, 0)
+	c.Check(rdb.Rules(s.defaultUser), DeepEquals, []*requestrules.Rule{foreverRule, newSessionRule})
+}
+
 // addRuleFromTemplate takes a template contents and a partial contents and,
 // for every empty field in the partial contents, fills it with the details
 // from the template contents, and then calls rdb.AddRule with the fields from
@@ -1835,3 +2079,358 @@ func (s *requestrulesSuite) TestPatchRuleExpired(c *C) {
 	rule.Constraints = newConstraints
 	c.Check(patched, DeepEquals, rule)
 }
+
+func (s *requestrulesSuite) TestRuleContents(c *C) {
+	currTime := time.Now()
+	rule := s.ruleTemplate(c, prompting.IDType(1))
+	contents := rule.Contents(currTime)
+	c.Check(contents, DeepEquals, &requestrules.RuleContents{
+		Snap:        rule.Snap,
+		Interface:   rule.Interface,
+		Constraints: rule.Constraints,
+		Outcome:     rule.Outcome,
+		Lifespan:    rule.Lifespan,
+	})
+
+	rule.Lifespan = prompting.LifespanTimespan
+	for _, testCase := range []struct {
+		remaining time.Duration
+		duration  string
+	}{
+		{time.Hour, "1h0m0s"},
+		{10*time.Second + time.Millisecond, "11s"},
+		{time.Millisecond, "1s"},
+		{-time.Second, "1s"},
+	} {
+		rule.Expiration = currTime.Add(testCase.remaining)
+		contents := rule.Contents(currTime)
+		c.Check(contents.Lifespan, Equals, prompting.LifespanTimespan)
+		c.Check(contents.Duration, Equals, testCase.duration, Commentf("remaining: %s", testCase.remaining))
+	}
+}
+
+func ruleContentsFromTemplate(c *C, template *addRuleContents, partial *addRuleContents) *requestrules.RuleContents {
+	if partial == nil {
+		partial = &addRuleContents{}
+	}
+	if partial.PathPattern == "" {
+		partial.PathPattern = template.PathPattern
+	}
+	if partial.Permissions == nil {
+		partial.Permissions = template.Permissions
+	}
+	contents := &requestrules.RuleContents{
+		Snap:      template.Snap,
+		Interface: template.Interface,
+		Constraints: &prompting.Constraints{
+			PathPattern: mustParsePathPattern(c, partial.PathPattern),
+			Permissions: partial.Permissions,
+		},
+		Outcome:  template.Outcome,
+		Lifespan: template.Lifespan,
+		Duration: partial.Duration,
+	}
+	if partial.Snap != "" {
+		contents.Snap = partial.Snap
+	}
+	if partial.Outcome != prompting.OutcomeUnset {
+		contents.Outcome = partial.Outcome
+	}
+	if partial.Lifespan != prompting.LifespanUnset {
+		contents.Lifespan = partial.Lifespan
+	}
+	return contents
+}
+
+func (s *requestrulesSuite) TestImportRules(c *C) {
+	rdb, err := requestrules.New(s.defaultNotifyRule)
+	c.Assert(err, IsNil)
+
+	template := &addRuleContents{
+		Snap:        "lxd",
+		Interface:   "home",
+		PathPattern: "/home/test/**",
+		Permissions: []string{"read"},
+		Outcome:     prompting.OutcomeAllow,
+		Lifespan:    prompting.LifespanForever,
+	}
+	existing, err := addRuleFromTemplate(c, rdb, template, &addRuleContents{User: s.defaultUser})
+	c.Assert(err, IsNil)
+	s.ruleNotices = s.ruleNotices[:0]
+
+	contents := []*requestrules.RuleContents{
+		ruleContentsFromTemplate(c, template, &addRuleContents{Snap: "firefox"}),
+		ruleContentsFromTemplate(c, template, &addRuleContents{PathPattern: "/home/test/secret/**", Outcome: prompting.OutcomeDeny}),
+		ruleContentsFromTemplate(c, template, &addRuleContents{Snap: "firefox", Permissions: []string{"write"}, Lifespan: prompting.LifespanTimespan, Duration: "1h"}),
+	}
+	rules, err := rdb.ImportRules(s.defaultUser, contents)
+	c.Assert(err, IsNil)
+	c.Assert(rules, HasLen, 3)
+	for i, rule := range rules {
+		c.Check(rule.User, Equals, s.defaultUser)
+		c.Check(rule.Admin, Equals, false)
+		c.Check(rule.Snap, Equals, contents[i].Snap)
+		c.Check(rule.Outcome, Equals, contents[i].Outcome)
+		c.Check(rule.Lifespan, Equals, contents[i].Lifespan)
+	}
+	c.Check(rules[2].Expiration.After(time.Now().Add(59*time.Minute)), Equals, true)
+	s.checkWrittenRuleDB(c, append([]*requestrules.Rule{existing}, rules...))
+	s.checkNewNoticesSimple(c, nil, rules...)
+
+	allowed, err := rdb.IsPathAllowed(s.defaultUser, "lxd", "home", "/home/test/secret/foo", "read")
+	c.Check(err, IsNil)
+	c.Check(allowed, Equals, false)
+
+	// Exported rules can be imported again for another user
+	var exported []*requestrules.RuleContents
+	for _, rule := range rdb.Rules(s.defaultUser) {
+		exported = append(exported, rule.Contents(time.Now()))
+	}
+	otherRules, err := rdb.ImportRules(s.defaultUser+1, exported)
+	c.Assert(err, IsNil)
+	c.Assert(otherRules, HasLen, 4)
+	for i, rule := range otherRules {
+		c.Check(rule.User, Equals, s.defaultUser+1)
+		c.Check(rule.Constraints, DeepEquals, exported[i].Constraints)
+	}
+	s.checkNewNoticesSimple(c, nil, otherRules...)
+}
+
+func (s *requestrulesSuite) TestImportRulesErrors(c *C) {
+	rdb, err := requestrules.New(s.defaultNotifyRule)
+	c.Assert(err, IsNil)
+
+	template := &addRuleContents{
+		Snap:        "lxd",
+		Interface:   "home",
+		PathPattern: "/home/test/**",
+		Permissions: []string{"read"},
+		Outcome:     prompting.OutcomeAllow,
+		Lifespan:    prompting.LifespanForever,
+	}
+	existing, err := addRuleFromTemplate(c, rdb, template, &addRuleContents{User: s.defaultUser})
+	c.Assert(err, IsNil)
+	s.ruleNotices = s.ruleNotices[:0]
+
+	valid := ruleContentsFromTemplate(c, template, &addRuleContents{Snap: "firefox"})
+	badInterface := ruleContentsFromTemplate(c, template, nil)
+	badInterface.Interface = "foo"
+
+	for _, testCase := range []struct {
+		contents []*requestrules.RuleContents
+		err      string
+	}{
+		{
+			contents: []*requestrules.RuleContents{valid, nil},
+			err:      `cannot import rule 1: empty rule`,
+		},
+		{
+			contents: []*requestrules.RuleContents{valid, badInterface},
+			err:      `cannot import rule 1: invalid interface: "foo"`,
+		},
+		{
+			contents: []*requestrules.RuleContents{valid, ruleContentsFromTemplate(c, template, &addRuleContents{Outcome: prompting.OutcomeType("foo")})},
+			err:      `cannot import rule 1: invalid outcome: "foo".*`,
+		},
+		{
+			contents: []*requestrules.RuleContents{valid, ruleContentsFromTemplate(c, template, &addRuleContents{Lifespan: prompting.LifespanTimespan})},
+			err:      `cannot import rule 1: invalid duration: cannot have unspecified duration.*`,
+		},
+		{
+			// Conflicts with the existing rule
+			contents: []*requestrules.RuleContents{valid, ruleContentsFromTemplate(c, template, &addRuleContents{Outcome: prompting.OutcomeDeny})},
+			err:      `cannot import rule 1: a rule with conflicting path pattern and permission already exists.*`,
+		},
+		{
+			// Conflicts with the first imported rule
+			contents: []*requestrules.RuleContents{valid, ruleContentsFromTemplate(c, template, &addRuleContents{Snap: "firefox", Outcome: prompting.OutcomeDeny})},
+			err:      `cannot import rule 1: a rule with conflicting path pattern and permission already exists.*`,
+		},
+	} {
+		rules, err := rdb.ImportRules(s.defaultUser, testCase.contents)
+		c.Check(err, ErrorMatches, testCase.err)
+		c.Check(rules, IsNil)
+		// No rule was added
+		c.Check(rdb.Rules(s.defaultUser), DeepEquals, []*requestrules.Rule{existing})
+		s.checkWrittenRuleDB(c, []*requestrules.Rule{existing})
+		s.checkNewNotices(c, nil)
+	}
+
+	c.Assert(rdb.Close(), IsNil)
+	_, err = rdb.ImportRules(s.defaultUser, []*requestrules.RuleContents{valid})
+	c.Check(err, Equals, prompting_errors.ErrRulesClosed)
+}
+
+func (s *requestrulesSuite) TestSetAdminRules(c *C) {
+	rdb, err := requestrules.New(s.defaultNotifyRule)
+	c.Assert(err, IsNil)
+
+	template := &addRuleContents{
+		User:        s.defaultUser,
+		Snap:        "lxd",
+		Interface:   "home",
+		PathPattern: "/home/test/**",
+		Permissions: []string{"read"},
+		Outcome:     prompting.OutcomeAllow,
+		Lifespan:    prompting.LifespanForever,
+	}
+	userRule, err := addRuleFromTemplate(c, rdb, template, nil)
+	c.Assert(err, IsNil)
+	s.ruleNotices = s.ruleNotices[:0]
+
+	// Admin rules do not conflict with the rules of the users
+	adminRules, err := rdb.SetAdminRules([]*requestrules.RuleContents{
+		ruleContentsFromTemplate(c, template, &addRuleContents{PathPattern: "/home/test/.ssh/**", Outcome: prompting.OutcomeDeny}),
+		ruleContentsFromTemplate(c, template, &addRuleContents{Outcome: prompting.OutcomeDeny, Permissions: []string{"write"}}),
+	})
+	c.Assert(err, IsNil)
+	c.Assert(adminRules, HasLen, 2)
+	for _, rule := range adminRules {
+		c.Check(rule.Admin, Equals, true)
+		c.Check(rule.User, Equals, requestrules.AdminUser)
+	}
+	s.checkWrittenRuleDB(c, append([]*requestrules.Rule{userRule}, adminRules...))
+	s.checkNewNoticesSimple(c, nil, adminRules...)
+	c.Check(rdb.AdminRules(), DeepEquals, adminRules)
+
+	// Admin rules are not rules of any user, including root
+	c.Check(rdb.Rules(s.defaultUser), DeepEquals, []*requestrules.Rule{userRule})
+	c.Check(rdb.Rules(0), HasLen, 0)
+	for _, user := range []uint32{0, s.defaultUser, s.defaultUser + 1} {
+		_, err = rdb.RuleWithID(user, adminRules[0].ID)
+		c.Check(err, Equals, prompting_errors.ErrRuleNotAllowed)
+		_, err = rdb.RemoveRule(user, adminRules[0].ID)
+		c.Check(err, Equals, prompting_errors.ErrRuleNotAllowed)
+		_, err = rdb.PatchRule(user, adminRules[0].ID, nil, prompting.OutcomeAllow, prompting.LifespanUnset, "")
+		c.Check(err, Equals, prompting_errors.ErrRuleNotAllowed)
+	}
+	for _, user := range []uint32{0, s.defaultUser + 1} {
+		removed, err := rdb.RemoveRulesForSnap(user, "lxd")
+		c.Check(err, IsNil)
+		c.Check(removed, HasLen, 0)
+	}
+	c.Check(rdb.AdminRules(), DeepEquals, adminRules)
+	s.checkNewNotices(c, nil)
+
+	// Setting the admin rules replaces the existing ones
+	newAdminRules, err := rdb.SetAdminRules([]*requestrules.RuleContents{
+		ruleContentsFromTemplate(c, template, &addRuleContents{PathPattern: "/home/test/.gnupg/**", Outcome: prompting.OutcomeDeny}),
+	})
+	c.Assert(err, IsNil)
+	c.Assert(newAdminRules, HasLen, 1)
+	c.Check(rdb.AdminRules(), DeepEquals, newAdminRules)
+	s.checkWrittenRuleDB(c, []*requestrules.Rule{userRule, newAdminRules[0]})
+	s.checkNewNotices(c, []*noticeInfo{
+		{userID: requestrules.AdminUser, ruleID: adminRules[0].ID, data: map[string]string{"removed": "removed"}},
+		{userID: requestrules.AdminUser, ruleID: adminRules[1].ID, data: map[string]string{"removed": "removed"}},
+		{userID: requestrules.AdminUser, ruleID: newAdminRules[0].ID, data: nil},
+	})
+
+	// Admin rules are kept when the rule database is loaded again
+	c.Assert(rdb.Close(), IsNil)
+	rdb, err = requestrules.New(s.defaultNotifyRule)
+	c.Assert(err, IsNil)
+	loaded := rdb.AdminRules()
+	c.Assert(loaded, HasLen, 1)
+	c.Check(loaded[0].ID, Equals, newAdminRules[0].ID)
+	c.Check(loaded[0].Admin, Equals, true)
+	allowed, err := rdb.IsPathAllowed(s.defaultUser, "lxd", "home", "/home/test/.gnupg/foo", "read")
+	c.Check(err, IsNil)
+	c.Check(allowed, Equals, false)
+	s.ruleNotices = s.ruleNotices[:0]
+
+	// Admin rules can be cleared
+	cleared, err := rdb.SetAdminRules(nil)
+	c.Assert(err, IsNil)
+	c.Check(cleared, HasLen, 0)
+	c.Check(rdb.AdminRules(), HasLen, 0)
+	s.checkNewNoticesSimple(c, map[string]string{"removed": "removed"}, newAdminRules...)
+}
+
+func (s *requestrulesSuite) TestSetAdminRulesErrors(c *C) {
+	rdb, err := requestrules.New(s.defaultNotifyRule)
+	c.Assert(err, IsNil)
+
+	template := &addRuleContents{
+		Snap:        "lxd",
+		Interface:   "home",
+		PathPattern: "/home/test/**",
+		Permissions: []string{"read"},
+		Outcome:     prompting.OutcomeDeny,
+		Lifespan:    prompting.LifespanForever,
+	}
+	adminRules, err := rdb.SetAdminRules([]*requestrules.RuleContents{
+		ruleContentsFromTemplate(c, template, nil),
+	})
+	c.Assert(err, IsNil)
+	s.ruleNotices = s.ruleNotices[:0]
+
+	valid := ruleContentsFromTemplate(c, template, &addRuleContents{Snap: "firefox"})
+	for _, testCase := range []struct {
+		contents []*requestrules.RuleContents
+		err      string
+	}{
+		{
+			contents: []*requestrules.RuleContents{valid, ruleContentsFromTemplate(c, template, &addRuleContents{Lifespan: prompting.LifespanTimespan, Duration: "1h"})},
+			err:      `cannot import rule 1: invalid lifespan: "timespan"`,
+		},
+		{
+			contents: []*requestrules.RuleContents{valid, ruleContentsFromTemplate(c, template, &addRuleContents{Lifespan: prompting.LifespanSession})},
+			err:      `cannot import rule 1: invalid lifespan: "session"`,
+		},
+		{
+			contents: []*requestrules.RuleContents{valid, ruleContentsFromTemplate(c, template, &addRuleContents{Snap: "firefox", Outcome: prompting.OutcomeAllow})},
+			err:      `cannot import rule 1: a rule with conflicting path pattern and permission already exists.*`,
+		},
+	} {
+		rules, err := rdb.SetAdminRules(testCase.contents)
+		c.Check(err, ErrorMatches, testCase.err)
+		c.Check(rules, IsNil)
+		// The existing admin rules are left unchanged
+		c.Check(rdb.AdminRules(), DeepEquals, adminRules)
+		s.checkWrittenRuleDB(c, adminRules)
+		s.checkNewNotices(c, nil)
+	}
+}
+
+func (s *requestrulesSuite) TestIsPathAllowedAdminRules(c *C) {
+	rdb, err := requestrules.New(s.defaultNotifyRule)
+	c.Assert(err, IsNil)
+
+	template := &addRuleContents{
+		User:        s.defaultUser,
+		Snap:        "lxd",
+		Interface:   "home",
+		PathPattern: "/home/test/**",
+		Permissions: []string{"read"},
+		Outcome:     prompting.OutcomeAllow,
+		Lifespan:    prompting.LifespanForever,
+	}
+	_, err = addRuleFromTemplate(c, rdb, template, nil)
+	c.Assert(err, IsNil)
+	_, err = rdb.SetAdminRules([]*requestrules.RuleContents{
+		// Less specific than the rule of the user, but still takes precedence
+		ruleContentsFromTemplate(c, template, &addRuleContents{PathPattern: "/home/*/.ssh/**", Outcome: prompting.OutcomeDeny}),
+		ruleContentsFromTemplate(c, template, &addRuleContents{Snap: "firefox", PathPattern: "/home/test/Downloads/**"}),
+	})
+	c.Assert(err, IsNil)
+
+	for _, testCase := range []struct {
+		user    uint32
+		snap    string
+		path    string
+		allowed bool
+		err     error
+	}{
+		{s.defaultUser, "lxd", "/home/test/foo", true, nil},
+		{s.defaultUser, "lxd", "/home/test/.ssh/id_rsa", false, nil},
+		{s.defaultUser + 1, "lxd", "/home/test/.ssh/id_rsa", false, nil},
+		{s.defaultUser + 1, "lxd", "/home/test/foo", false, prompting_errors.ErrNoMatchingRule},
+		{s.defaultUser, "firefox", "/home/test/Downloads/foo", true, nil},
+		{s.defaultUser, "firefox", "/home/test/foo", false, prompting_errors.ErrNoMatchingRule},
+	} {
+		allowed, err := rdb.IsPathAllowed(testCase.user, testCase.snap, "home", testCase.path, "read")
+		c.Check(err, Equals, testCase.err, Commentf("%+v", testCase))
+		c.Check(allowed, Equals, testCase.allowed, Commentf("%+v", testCase))
+	}
+}
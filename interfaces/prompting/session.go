@@ -0,0 +1,125 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package prompting
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/godbus/dbus"
+
+	"github.com/snapcore/snapd/dbusutil"
+	prompting_errors "github.com/snapcore/snapd/interfaces/prompting/errors"
+)
+
+const (
+	login1BusName     = "org.freedesktop.login1"
+	login1ObjectPath  = "/org/freedesktop/login1"
+	login1Manager     = "org.freedesktop.login1.Manager"
+	login1User        = "org.freedesktop.login1.User"
+	login1NoSuchUser  = "org.freedesktop.login1.NoSuchUser"
+	userRemovedSignal = login1Manager + ".UserRemoved"
+)
+
+// UserSessionID identifies the login session of a user, from when the user
+// first logs in until all the sessions of the user ended.
+//
+// It is the time, in microseconds since the epoch, at which logind started
+// tracking the user, so it changes whenever the user logs in again after
+// having logged out. A zero UserSessionID means the user is not logged in.
+type UserSessionID uint64
+
+// CurrentUserSession returns the current login session of the user with the
+// given UID, as tracked by logind.
+//
+// If the user is not logged in, returns prompting_errors.ErrNoUserSession.
+func CurrentUserSession(uid uint32) (UserSessionID, error) {
+	conn, err := dbusutil.SystemBus()
+	if err != nil {
+		return 0, fmt.Errorf("cannot connect to the system bus: %w", err)
+	}
+
+	var userPath dbus.ObjectPath
+	manager := conn.Object(login1BusName, login1ObjectPath)
+	if err := manager.Call(login1Manager+".GetUser", 0, uid).Store(&userPath); err != nil {
+		if dbusErr, ok := err.(dbus.Error); ok && dbusErr.Name == login1NoSuchUser {
+			return 0, prompting_errors.ErrNoUserSession
+		}
+		return 0, fmt.Errorf("cannot get login session of user %d: %w", uid, err)
+	}
+
+	var props map[string]dbus.Variant
+	user := conn.Object(login1BusName, userPath)
+	if err := user.Call("org.freedesktop.DBus.Properties.GetAll", 0, login1User).Store(&props); err != nil {
+		return 0, fmt.Errorf("cannot get login session of user %d: %w", uid, err)
+	}
+	if userState, _ := props["State"].Value().(string); userState != "active" && userState != "online" {
+		// the user is lingering or its last session is closing
+		return 0, prompting_errors.ErrNoUserSession
+	}
+	timestamp, ok := props["Timestamp"].Value().(uint64)
+	if !ok || timestamp == 0 {
+		return 0, fmt.Errorf("cannot get login session of user %d: invalid login timestamp", uid)
+	}
+	return UserSessionID(timestamp), nil
+}
+
+// WatchUserLogouts calls loggedOut with the UID of each user whose login
+// sessions all ended, until the given stop channel is closed.
+func WatchUserLogouts(stop <-chan struct{}, loggedOut func(uid uint32)) error {
+	conn, err := dbusutil.SystemBus()
+	if err != nil {
+		return fmt.Errorf("cannot connect to the system bus: %w", err)
+	}
+
+	// start receiving signals before subscribing, so that none is missed
+	signals := make(chan *dbus.Signal, 10)
+	conn.Signal(signals)
+	defer conn.RemoveSignal(signals)
+
+	matchOptions := []dbus.MatchOption{
+		dbus.WithMatchInterface(login1Manager),
+		dbus.WithMatchMember("UserRemoved"),
+	}
+	if err := conn.AddMatchSignal(matchOptions...); err != nil {
+		return fmt.Errorf("cannot subscribe to logind signals: %w", err)
+	}
+	defer conn.RemoveMatchSignal(matchOptions...)
+
+	for {
+		select {
+		case sig, ok := <-signals:
+			if !ok {
+				return errors.New("cannot watch logind signals: connection closed")
+			}
+			if sig.Name != userRemovedSignal {
+				continue
+			}
+			var uid uint32
+			var userPath dbus.ObjectPath
+			if err := dbus.Store(sig.Body, &uid, &userPath); err != nil {
+				continue
+			}
+			loggedOut(uid)
+		case <-stop:
+			return nil
+		}
+	}
+}
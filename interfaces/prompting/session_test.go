@@ -0,0 +1,186 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package prompting_test
+
+import (
+	"fmt"
+
+	"github.com/godbus/dbus"
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dbusutil"
+	"github.com/snapcore/snapd/dbusutil/dbustest"
+	"github.com/snapcore/snapd/interfaces/prompting"
+	prompting_errors "github.com/snapcore/snapd/interfaces/prompting/errors"
+)
+
+type sessionSuite struct{}
+
+var _ = Suite(&sessionSuite{})
+
+func methodReply(msg *dbus.Message, body ...interface{}) *dbus.Message {
+	reply := &dbus.Message{
+		Type: dbus.TypeMethodReply,
+		Headers: map[dbus.HeaderField]dbus.Variant{
+			dbus.FieldReplySerial: dbus.MakeVariant(msg.Serial()),
+			dbus.FieldSender:      dbus.MakeVariant(":1"), // This does not matter.
+		},
+		Body: body,
+	}
+	if len(body) > 0 {
+		reply.Headers[dbus.FieldSignature] = dbus.MakeVariant(dbus.SignatureOf(body...))
+	}
+	return reply
+}
+
+func errorReply(msg *dbus.Message, name string) *dbus.Message {
+	return &dbus.Message{
+		Type: dbus.TypeError,
+		Headers: map[dbus.HeaderField]dbus.Variant{
+			dbus.FieldReplySerial: dbus.MakeVariant(msg.Serial()),
+			dbus.FieldSender:      dbus.MakeVariant(":1"), // This does not matter.
+			dbus.FieldErrorName:   dbus.MakeVariant(name),
+		},
+	}
+}
+
+func checkMethodCall(c *C, msg *dbus.Message, path dbus.ObjectPath, iface, member string) {
+	c.Assert(msg.Type, Equals, dbus.TypeMethodCall)
+	c.Check(msg.Headers[dbus.FieldPath], DeepEquals, dbus.MakeVariant(path))
+	c.Check(msg.Headers[dbus.FieldInterface], DeepEquals, dbus.MakeVariant(iface))
+	c.Check(msg.Headers[dbus.FieldMember], DeepEquals, dbus.MakeVariant(member))
+}
+
+// mockLogind mocks logind tracking user 1000 in the given state, or not
+// tracking it at all if the state is empty.
+func mockLogind(c *C, userState string, timestamp uint64) (restore func()) {
+	const userPath = dbus.ObjectPath("/org/freedesktop/login1/user/_1000")
+	conn, err := dbustest.Connection(func(msg *dbus.Message, n int) ([]*dbus.Message, error) {
+		switch n {
+		case 0:
+			checkMethodCall(c, msg, "/org/freedesktop/login1", "org.freedesktop.login1.Manager", "GetUser")
+			c.Check(msg.Body, DeepEquals, []interface{}{uint32(1000)})
+			if userState == "" {
+				return []*dbus.Message{errorReply(msg, "org.freedesktop.login1.NoSuchUser")}, nil
+			}
+			return []*dbus.Message{methodReply(msg, userPath)}, nil
+		case 1:
+			checkMethodCall(c, msg, userPath, "org.freedesktop.DBus.Properties", "GetAll")
+			c.Check(msg.Body, DeepEquals, []interface{}{"org.freedesktop.login1.User"})
+			props := map[string]dbus.Variant{
+				"State":     dbus.MakeVariant(userState),
+				"Timestamp": dbus.MakeVariant(timestamp),
+			}
+			return []*dbus.Message{methodReply(msg, props)}, nil
+		}
+		return nil, fmt.Errorf("unexpected message #%d: %s", n, msg)
+	})
+	c.Assert(err, IsNil)
+	return dbusutil.MockOnlySystemBusAvailable(conn)
+}
+
+func (s *sessionSuite) TestCurrentUserSession(c *C) {
+	for _, userState := range []string{"active", "online"} {
+		restore := mockLogind(c, userState, 1728000000000000)
+		session, err := prompting.CurrentUserSession(1000)
+		restore()
+		c.Check(err, IsNil)
+		c.Check(session, Equals, prompting.UserSessionID(1728000000000000))
+	}
+}
+
+func (s *sessionSuite) TestCurrentUserSessionLoggedOut(c *C) {
+	for _, userState := range []string{"", "lingering", "closing"} {
+		restore := mockLogind(c, userState, 1728000000000000)
+		session, err := prompting.CurrentUserSession(1000)
+		restore()
+		c.Check(err, Equals, prompting_errors.ErrNoUserSession, Commentf("state: %q", userState))
+		c.Check(session, Equals, prompting.UserSessionID(0))
+	}
+}
+
+func (s *sessionSuite) TestCurrentUserSessionErrors(c *C) {
+	restore := dbusutil.MockConnections(func() (*dbus.Conn, error) {
+		return nil, fmt.Errorf("no system bus")
+	}, nil)
+	_, err := prompting.CurrentUserSession(1000)
+	restore()
+	c.Check(err, ErrorMatches, "cannot connect to the system bus: no system bus")
+
+	restore = mockLogind(c, "active", 0)
+	_, err = prompting.CurrentUserSession(1000)
+	restore()
+	c.Check(err, ErrorMatches, "cannot get login session of user 1000: invalid login timestamp")
+}
+
+func userRemovedSignal(uid uint32) *dbus.Message {
+	userPath := dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/login1/user/_%d", uid))
+	return &dbus.Message{
+		Type: dbus.TypeSignal,
+		Headers: map[dbus.HeaderField]dbus.Variant{
+			dbus.FieldSender:    dbus.MakeVariant(":1"), // This does not matter.
+			dbus.FieldPath:      dbus.MakeVariant(dbus.ObjectPath("/org/freedesktop/login1")),
+			dbus.FieldInterface: dbus.MakeVariant("org.freedesktop.login1.Manager"),
+			dbus.FieldMember:    dbus.MakeVariant("UserRemoved"),
+			dbus.FieldSignature: dbus.MakeVariant(dbus.SignatureOf(uint32(0), dbus.ObjectPath(""))),
+		},
+		Body: []interface{}{uid, userPath},
+	}
+}
+
+func (s *sessionSuite) TestWatchUserLogouts(c *C) {
+	const match = `type='signal',interface='org.freedesktop.login1.Manager',member='UserRemoved'`
+	subscribed := make(chan struct{})
+	conn, inject, err := dbustest.InjectableConnection(func(msg *dbus.Message, n int) ([]*dbus.Message, error) {
+		switch n {
+		case 0:
+			checkMethodCall(c, msg, "/org/freedesktop/DBus", "org.freedesktop.DBus", "AddMatch")
+			c.Check(msg.Body, DeepEquals, []interface{}{match})
+			close(subscribed)
+			return []*dbus.Message{methodReply(msg)}, nil
+		case 1:
+			checkMethodCall(c, msg, "/org/freedesktop/DBus", "org.freedesktop.DBus", "RemoveMatch")
+			c.Check(msg.Body, DeepEquals, []interface{}{match})
+			return []*dbus.Message{methodReply(msg)}, nil
+		}
+		return nil, fmt.Errorf("unexpected message #%d: %s", n, msg)
+	})
+	c.Assert(err, IsNil)
+	restore := dbusutil.MockOnlySystemBusAvailable(conn)
+	defer restore()
+
+	stop := make(chan struct{})
+	loggedOut := make(chan uint32)
+	done := make(chan error)
+	go func() {
+		done <- prompting.WatchUserLogouts(stop, func(uid uint32) {
+			loggedOut <- uid
+		})
+	}()
+
+	<-subscribed
+	inject(userRemovedSignal(1000))
+	c.Check(<-loggedOut, Equals, uint32(1000))
+	inject(userRemovedSignal(1001))
+	c.Check(<-loggedOut, Equals, uint32(1001))
+
+	close(stop)
+	c.Check(<-done, IsNil)
+}
@@ -41,7 +41,11 @@ var (
 		"vfat":    mkfsVfat32,
 		"vfat-32": mkfsVfat32,
 		"ext4":    mkfsExt4,
+		"btrfs":   mkfsBtrfs,
+		"xfs":     mkfsXfs,
 	}
+
+	osGeteuid = os.Geteuid
 )
 
 // Make creates a filesystem of given type and provided label in the device or
@@ -105,27 +109,101 @@ func mkfsExt4(img, label, contentsRootDir string, deviceSize, sectorSize quantit
 	}
 	mkfsArgs = append(mkfsArgs, img)
 
-	var cmd *exec.Cmd
-	if os.Geteuid() != 0 {
-		// run through fakeroot so that files are owned by root
-		fakerootFlags := os.Getenv("FAKEROOT_FLAGS")
-		if fakerootFlags != "" {
-			// When executing fakeroot from a classic confinement snap the location of
-			// libfakeroot must be specified, or else it will be loaded from the host system
-			flags, err := shlex.Split(fakerootFlags)
-			if err != nil {
-				return fmt.Errorf("cannot split fakeroot command: %v", err)
-			}
-			if len(fakerootFlags) > 0 {
-				fakerootArgs := append(flags, "--")
-				mkfsArgs = append(fakerootArgs, mkfsArgs...)
-			}
-		}
-		cmd = exec.Command("fakeroot", mkfsArgs...)
-	} else {
+	cmd, err := fakerootCommand(mkfsArgs)
+	if err != nil {
+		return err
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return osutil.OutputErr(out, err)
+	}
+	return nil
+}
+
+// fakerootCommand returns a command running mkfsArgs through fakeroot when
+// not running as root, so that files copied into the filesystem are owned by
+// root.
+func fakerootCommand(mkfsArgs []string) (*exec.Cmd, error) {
+	if osGeteuid() == 0 {
 		// no need to fake it if we're already root
-		cmd = exec.Command(mkfsArgs[0], mkfsArgs[1:]...)
+		return exec.Command(mkfsArgs[0], mkfsArgs[1:]...), nil
+	}
+	fakerootFlags := os.Getenv("FAKEROOT_FLAGS")
+	if fakerootFlags != "" {
+		// When executing fakeroot from a classic confinement snap the location of
+		// libfakeroot must be specified, or else it will be loaded from the host system
+		flags, err := shlex.Split(fakerootFlags)
+		if err != nil {
+			return nil, fmt.Errorf("cannot split fakeroot command: %v", err)
+		}
+		if len(fakerootFlags) > 0 {
+			fakerootArgs := append(flags, "--")
+			mkfsArgs = append(fakerootArgs, mkfsArgs...)
+		}
+	}
+	return exec.Command("fakeroot", mkfsArgs...), nil
+}
+
+// mkfsBtrfs creates a Btrfs filesystem in given image file, with an optional
+// filesystem label, and populates it with the contents of provided root
+// directory.
+func mkfsBtrfs(img, label, contentsRootDir string, deviceSize, sectorSize quantity.Size) error {
+	mkfsArgs := []string{
+		"mkfs.btrfs",
+		// the device may carry an old filesystem, eg. during factory
+		// reset
+		"-f",
+	}
+	const size1GiB = 1 * quantity.SizeGiB
+	if deviceSize != 0 && deviceSize < size1GiB {
+		// small devices do not have room for separate data and
+		// metadata block groups, follow the upstream recommendation and
+		// mix them for filesystems below 1GiB
+		mkfsArgs = append(mkfsArgs, "--mixed")
+	}
+	if contentsRootDir != "" {
+		// mkfs.btrfs can populate the filesystem with contents of given
+		// root directory
+		mkfsArgs = append(mkfsArgs, "--rootdir", contentsRootDir)
 	}
+	if label != "" {
+		mkfsArgs = append(mkfsArgs, "-L", label)
+	}
+	mkfsArgs = append(mkfsArgs, img)
+
+	cmd, err := fakerootCommand(mkfsArgs)
+	if err != nil {
+		return err
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return osutil.OutputErr(out, err)
+	}
+	return nil
+}
+
+// mkfsXfs creates an XFS filesystem in given image file, with an optional
+// filesystem label. mkfs.xfs cannot populate the filesystem with the contents
+// of a directory, content has to be written to the mounted filesystem
+// instead.
+func mkfsXfs(img, label, contentsRootDir string, deviceSize, sectorSize quantity.Size) error {
+	if contentsRootDir != "" {
+		return fmt.Errorf("cannot populate xfs filesystem with contents")
+	}
+	mkfsArgs := []string{
+		"-f",
+	}
+	// the sector size cannot be smaller than the logical sector size of
+	// the device, which mkfs.xfs cannot probe for image files
+	if sectorSize > 512 {
+		mkfsArgs = append(mkfsArgs, "-s", "size="+sectorSize.String())
+	}
+	if label != "" {
+		mkfsArgs = append(mkfsArgs, "-L", label)
+	}
+	mkfsArgs = append(mkfsArgs, img)
+
+	cmd := exec.Command("mkfs.xfs", mkfsArgs...)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		return osutil.OutputErr(out, err)
@@ -57,6 +57,15 @@ func (m *mkfsSuite) SetUpTest(c *C) {
 
 	cmdMcopy := testutil.MockCommand(c, "mcopy", "echo 'override in test'; exit 1")
 	m.AddCleanup(cmdMcopy.Restore)
+
+	cmdMkfsBtrfs := testutil.MockCommand(c, "mkfs.btrfs", "echo 'override in test'; exit 1")
+	m.AddCleanup(cmdMkfsBtrfs.Restore)
+
+	cmdMkfsXfs := testutil.MockCommand(c, "mkfs.xfs", "echo 'override in test'; exit 1")
+	m.AddCleanup(cmdMkfsXfs.Restore)
+
+	// tests expect to be run as a regular user
+	m.AddCleanup(mkfs.MockGeteuid(func() int { return 1000 }))
 }
 
 func (m *mkfsSuite) TestMkfsExt4Happy(c *C) {
@@ -361,6 +370,139 @@ func (m *mkfsSuite) TestMkfsVfatHappyNoContents(c *C) {
 	c.Assert(cmdMcopy.Calls(), HasLen, 0)
 }
 
+func (m *mkfsSuite) TestMkfsBtrfsHappy(c *C) {
+	cmd := testutil.MockCommand(c, "fakeroot", "")
+	defer cmd.Restore()
+
+	err := mkfs.MakeWithContent("btrfs", "foo.img", "my-label", "contents", 0, 0)
+	c.Assert(err, IsNil)
+	c.Check(cmd.Calls(), DeepEquals, [][]string{
+		{
+			"fakeroot",
+			"mkfs.btrfs",
+			"-f",
+			"--rootdir", "contents",
+			"-L", "my-label",
+			"foo.img",
+		},
+	})
+
+	cmd.ForgetCalls()
+
+	// no content, no label
+	err = mkfs.Make("btrfs", "foo.img", "", 0, 0)
+	c.Assert(err, IsNil)
+	c.Check(cmd.Calls(), DeepEquals, [][]string{
+		{
+			"fakeroot",
+			"mkfs.btrfs",
+			"-f",
+			"foo.img",
+		},
+	})
+}
+
+func (m *mkfsSuite) TestMkfsBtrfsWithSize(c *C) {
+	cmd := testutil.MockCommand(c, "fakeroot", "")
+	defer cmd.Restore()
+
+	err := mkfs.Make("btrfs", "foo.img", "my-label", 512*1024*1024, 512)
+	c.Assert(err, IsNil)
+	c.Check(cmd.Calls(), DeepEquals, [][]string{
+		{
+			"fakeroot",
+			"mkfs.btrfs",
+			"-f",
+			"--mixed",
+			"-L", "my-label",
+			"foo.img",
+		},
+	})
+
+	cmd.ForgetCalls()
+
+	err = mkfs.Make("btrfs", "foo.img", "my-label", 1024*1024*1024, 512)
+	c.Assert(err, IsNil)
+	c.Check(cmd.Calls(), DeepEquals, [][]string{
+		{
+			"fakeroot",
+			"mkfs.btrfs",
+			"-f",
+			"-L", "my-label",
+			"foo.img",
+		},
+	})
+}
+
+func (m *mkfsSuite) TestMkfsBtrfsAsRoot(c *C) {
+	restore := mkfs.MockGeteuid(func() int { return 0 })
+	defer restore()
+
+	cmdFakeroot := testutil.MockCommand(c, "fakeroot", "")
+	defer cmdFakeroot.Restore()
+	cmd := testutil.MockCommand(c, "mkfs.btrfs", "")
+	defer cmd.Restore()
+
+	err := mkfs.Make("btrfs", "foo.img", "my-label", 0, 0)
+	c.Assert(err, IsNil)
+	c.Check(cmd.Calls(), DeepEquals, [][]string{
+		{"mkfs.btrfs", "-f", "-L", "my-label", "foo.img"},
+	})
+	c.Check(cmdFakeroot.Calls(), HasLen, 0)
+}
+
+func (m *mkfsSuite) TestMkfsBtrfsError(c *C) {
+	cmd := testutil.MockCommand(c, "fakeroot", "echo 'command failed'; exit 1")
+	defer cmd.Restore()
+
+	err := mkfs.MakeWithContent("btrfs", "foo.img", "my-label", "contents", 0, 0)
+	c.Assert(err, ErrorMatches, "command failed")
+}
+
+func (m *mkfsSuite) TestMkfsXfsHappy(c *C) {
+	cmd := testutil.MockCommand(c, "mkfs.xfs", "")
+	defer cmd.Restore()
+
+	err := mkfs.Make("xfs", "foo.img", "my-label", 0, 0)
+	c.Assert(err, IsNil)
+	c.Check(cmd.Calls(), DeepEquals, [][]string{
+		{
+			"mkfs.xfs",
+			"-f",
+			"-L", "my-label",
+			"foo.img",
+		},
+	})
+
+	cmd.ForgetCalls()
+
+	// empty label, 4k sectors
+	err = mkfs.Make("xfs", "foo.img", "", 1024*1024*1024, 4096)
+	c.Assert(err, IsNil)
+	c.Check(cmd.Calls(), DeepEquals, [][]string{
+		{
+			"mkfs.xfs",
+			"-f",
+			"-s", "size=4096",
+			"foo.img",
+		},
+	})
+}
+
+func (m *mkfsSuite) TestMkfsXfsErrors(c *C) {
+	cmd := testutil.MockCommand(c, "mkfs.xfs", "echo 'command failed'; exit 1")
+	defer cmd.Restore()
+
+	err := mkfs.Make("xfs", "foo.img", "my-label", 0, 0)
+	c.Assert(err, ErrorMatches, "command failed")
+
+	cmd.ForgetCalls()
+
+	err = mkfs.MakeWithContent("xfs", "foo.img", "my-label", "contents", 0, 0)
+	c.Assert(err, ErrorMatches, "cannot populate xfs filesystem with contents")
+	c.Check(cmd.Calls(), HasLen, 0)
+}
+
 func (m *mkfsSuite) TestMkfsInvalidFs(c *C) {
 	err := mkfs.MakeWithContent("no-fs", "foo.img", "my-label", "", 0, 0)
 	c.Assert(err, ErrorMatches, `cannot create unsupported filesystem "no-fs"`)
@@ -0,0 +1,363 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package changearchive keeps a record of the changes pruned from the
+// state, outside of it, so that what happened on the system can still be
+// looked up after the prune window.
+package changearchive
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+// RequestedByKey is the change data key holding the UID of the user that
+// requested the change through the API.
+const RequestedByKey = "requested-by"
+
+// maxArchiveSize is the size past which the oldest half of the archive is
+// dropped.
+var maxArchiveSize int64 = 32 * 1024 * 1024
+
+// pendingKey is the state key holding the changes pruned from the state
+// which were not written to the archive yet.
+const pendingKey = "change-archive-pending"
+
+// Task is an archived task.
+type Task struct {
+	ID      string   `json:"id"`
+	Kind    string   `json:"kind"`
+	Summary string   `json:"summary"`
+	Status  string   `json:"status"`
+	Log     []string `json:"log,omitempty"`
+
+	SpawnTime time.Time `json:"spawn-time"`
+	ReadyTime time.Time `json:"ready-time,omitempty"`
+}
+
+// Change is an archived change.
+type Change struct {
+	ID      string `json:"id"`
+	Kind    string `json:"kind"`
+	Summary string `json:"summary"`
+	Status  string `json:"status"`
+	Err     string `json:"err,omitempty"`
+
+	SpawnTime time.Time `json:"spawn-time"`
+	ReadyTime time.Time `json:"ready-time"`
+
+	SnapNames []string `json:"snap-names,omitempty"`
+	// RequestedBy is the UID of the user that requested the change, if
+	// it was requested through the API.
+	RequestedBy *uint32 `json:"requested-by,omitempty"`
+	// APIData is the data of the change exposed through the API.
+	APIData map[string]*json.RawMessage `json:"api-data,omitempty"`
+
+	Tasks []*Task `json:"tasks,omitempty"`
+}
+
+// ChangeArchiveManager keeps the changes pruned from the state in the change
+// archive.
+//
+// The pruned changes are recorded in the state, with it locked, as they are
+// pruned, and written to the archive by Ensure with the state unlocked. As
+// the state is saved along with the pruning, no change is lost if snapd
+// stops in between.
+type ChangeArchiveManager struct {
+	state *state.State
+}
+
+// Manager returns a new ChangeArchiveManager.
+func Manager(st *state.State) *ChangeArchiveManager {
+	m := &ChangeArchiveManager{state: st}
+
+	st.Lock()
+	defer st.Unlock()
+	st.AddChangesPrunedHandler(m.changesPruned)
+
+	return m
+}
+
+func (m *ChangeArchiveManager) changesPruned(chgs []*state.Change) {
+	pending, err := pendingChanges(m.state)
+	if err != nil {
+		logger.Noticef("cannot read changes pending archival, dropping them: %v", err)
+	}
+	for _, chg := range chgs {
+		pending = append(pending, archiveChange(chg))
+	}
+	m.state.Set(pendingKey, pending)
+	m.state.EnsureBefore(0)
+}
+
+func pendingChanges(st *state.State) ([]*Change, error) {
+	var pending []*Change
+	if err := st.Get(pendingKey, &pending); err != nil && !errors.Is(err, state.ErrNoState) {
+		return nil, err
+	}
+	return pending, nil
+}
+
+// Ensure implements StateManager.Ensure. It writes the changes pruned from
+// the state to the archive.
+func (m *ChangeArchiveManager) Ensure() error {
+	m.state.Lock()
+	pending, err := pendingChanges(m.state)
+	m.state.Unlock()
+	if err != nil {
+		return fmt.Errorf("cannot read changes pending archival: %v", err)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if err := archive(pending); err != nil {
+		return fmt.Errorf("cannot archive %d pruned changes: %v", len(pending), err)
+	}
+
+	m.state.Lock()
+	defer m.state.Unlock()
+	// changes pruned in the meantime were appended
+	current, err := pendingChanges(m.state)
+	if err != nil {
+		return fmt.Errorf("cannot read changes pending archival: %v", err)
+	}
+	if len(current) > len(pending) {
+		m.state.Set(pendingKey, current[len(pending):])
+	} else {
+		m.state.Set(pendingKey, nil)
+	}
+	return nil
+}
+
+func archiveChange(chg *state.Change) *Change {
+	ach := &Change{
+		ID:        chg.ID(),
+		Kind:      chg.Kind(),
+		Summary:   chg.Summary(),
+		Status:    chg.Status().String(),
+		SpawnTime: chg.SpawnTime(),
+		ReadyTime: chg.ReadyTime(),
+	}
+	if err := chg.Err(); err != nil {
+		ach.Err = err.Error()
+	}
+	// errors are ignored as these are all optional
+	chg.Get("snap-names", &ach.SnapNames)
+	var uid uint32
+	if chg.Get(RequestedByKey, &uid) == nil {
+		ach.RequestedBy = &uid
+	}
+	chg.Get("api-data", &ach.APIData)
+	for _, t := range chg.Tasks() {
+		ach.Tasks = append(ach.Tasks, &Task{
+			ID:        t.ID(),
+			Kind:      t.Kind(),
+			Summary:   t.Summary(),
+			Status:    t.Status().String(),
+			Log:       t.Log(),
+			SpawnTime: t.SpawnTime(),
+			ReadyTime: t.ReadyTime(),
+		})
+	}
+	return ach
+}
+
+// archive appends the changes to the archive, one change per line.
+func archive(changes []*Change) error {
+	var buf bytes.Buffer
+	for _, ach := range changes {
+		line, err := json.Marshal(ach)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dirs.SnapChangeArchiveFile), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dirs.SnapChangeArchiveFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if st.Size() > maxArchiveSize {
+		return shrinkArchive()
+	}
+	return nil
+}
+
+// shrinkArchive drops the oldest changes from the archive, keeping the
+// newest ones up to half the maximum size.
+func shrinkArchive() error {
+	data, err := os.ReadFile(dirs.SnapChangeArchiveFile)
+	if err != nil {
+		return err
+	}
+	keep := maxArchiveSize / 2
+	if int64(len(data)) > keep {
+		cut := len(data) - int(keep)
+		// keep only whole lines
+		i := bytes.IndexByte(data[cut:], '\n')
+		if i < 0 {
+			data = nil
+		} else {
+			data = data[cut+i+1:]
+		}
+	}
+	return osutil.AtomicWriteFile(dirs.SnapChangeArchiveFile, data, 0600, 0)
+}
+
+// Filter selects archived changes.
+type Filter struct {
+	// Kind is the kind of the changes, if set.
+	Kind string
+	// SnapName is the name of one of the snaps affected by the changes,
+	// if set.
+	SnapName string
+	// Status is the status of the changes, if set.
+	Status string
+	// After and Before delimit when the changes were spawned, if set.
+	After  time.Time
+	Before time.Time
+}
+
+func (f *Filter) matches(ach *Change) bool {
+	if f == nil {
+		return true
+	}
+	if f.Kind != "" && ach.Kind != f.Kind {
+		return false
+	}
+	if f.Status != "" && ach.Status != f.Status {
+		return false
+	}
+	if f.SnapName != "" && !affectsSnap(ach, f.SnapName) {
+		return false
+	}
+	if !f.After.IsZero() && ach.SpawnTime.Before(f.After) {
+		return false
+	}
+	if !f.Before.IsZero() && !ach.SpawnTime.Before(f.Before) {
+		return false
+	}
+	return true
+}
+
+func affectsSnap(ach *Change, snapName string) bool {
+	for _, name := range ach.SnapNames {
+		// snap-names of service-control changes can include <snap>.<app>
+		if name, _ := snap.SplitSnapApp(name); name == snapName {
+			return true
+		}
+	}
+	return false
+}
+
+// Changes returns the archived changes matching the filter, oldest first,
+// including the pruned changes not yet written to the archive. It must be
+// called with the state unlocked.
+func Changes(st *state.State, filter *Filter) ([]*Change, error) {
+	var changes []*Change
+	// only the last occurrence of a change archived more than once is
+	// kept
+	index := make(map[string]int)
+	add := func(ach *Change) {
+		if !filter.matches(ach) {
+			return
+		}
+		if i, ok := index[ach.ID]; ok {
+			changes[i] = ach
+			return
+		}
+		index[ach.ID] = len(changes)
+		changes = append(changes, ach)
+	}
+
+	if err := readArchive(add); err != nil {
+		return nil, fmt.Errorf("cannot read change archive: %v", err)
+	}
+
+	st.Lock()
+	pending, err := pendingChanges(st)
+	st.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read changes pending archival: %v", err)
+	}
+	for _, ach := range pending {
+		add(ach)
+	}
+
+	return changes, nil
+}
+
+// readArchive calls f with every change in the archive, oldest first.
+func readArchive(f func(*Change)) error {
+	file, err := os.Open(dirs.SnapChangeArchiveFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// an incomplete last line was not completely written
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var ach Change
+		if err := json.Unmarshal(line, &ach); err != nil {
+			logger.Noticef("ignoring invalid change archive entry: %v", err)
+			continue
+		}
+		f(&ach)
+	}
+}
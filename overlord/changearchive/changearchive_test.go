@@ -0,0 +1,289 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package changearchive_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/changearchive"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/testutil"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type archiveSuite struct {
+	testutil.BaseTest
+	st  *state.State
+	mgr *changearchive.ChangeArchiveManager
+}
+
+var _ = Suite(&archiveSuite{})
+
+func (s *archiveSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+
+	s.st = state.New(nil)
+	s.mgr = changearchive.Manager(s.st)
+}
+
+// addChange adds a ready change for the given snap, spawned at the given
+// time.
+func (s *archiveSuite) addChange(c *C, kind, snapName string, spawnTime time.Time, status state.Status) *state.Change {
+	restore := state.MockTime(spawnTime)
+	defer restore()
+
+	chg := s.st.NewChange(kind, "Do "+kind+" for "+snapName)
+	chg.Set("snap-names", []string{snapName})
+	t := s.st.NewTask("some-task", "Do something")
+	t.Logf("did something")
+	chg.AddTask(t)
+	t.SetStatus(status)
+	c.Assert(chg.IsReady(), Equals, true)
+	return chg
+}
+
+// prune prunes the state, which must be locked, and writes the pruned
+// changes to the archive with the state unlocked.
+func (s *archiveSuite) prune(c *C) {
+	s.st.Prune(time.Now(), time.Hour, 2*time.Hour, 0)
+	s.st.Unlock()
+	defer s.st.Lock()
+	c.Assert(s.mgr.Ensure(), IsNil)
+}
+
+// changes returns the archived changes matching the filter, unlocking the
+// state, which must be locked, meanwhile.
+func (s *archiveSuite) changes(c *C, filter *changearchive.Filter) []*changearchive.Change {
+	s.st.Unlock()
+	defer s.st.Lock()
+	changes, err := changearchive.Changes(s.st, filter)
+	c.Assert(err, IsNil)
+	return changes
+}
+
+func (s *archiveSuite) TestArchiveOnEnsure(c *C) {
+	s.st.Lock()
+	chg := s.addChange(c, "install-snap", "foo", time.Now(), state.DoneStatus)
+	s.st.Prune(time.Now(), time.Hour, 2*time.Hour, 0)
+	c.Check(s.st.Change(chg.ID()), IsNil)
+	s.st.Unlock()
+
+	// nothing is written while pruning
+	c.Check(dirs.SnapChangeArchiveFile, testutil.FileAbsent)
+	// but the pruned change is already listed
+	changes, err := changearchive.Changes(s.st, nil)
+	c.Assert(err, IsNil)
+	c.Assert(changes, HasLen, 1)
+	c.Check(changes[0].ID, Equals, chg.ID())
+
+	c.Assert(s.mgr.Ensure(), IsNil)
+	changes, err = changearchive.Changes(s.st, nil)
+	c.Assert(err, IsNil)
+	c.Assert(changes, HasLen, 1)
+	c.Check(changes[0].ID, Equals, chg.ID())
+
+	// the change is written only once
+	c.Assert(s.mgr.Ensure(), IsNil)
+	changes, err = changearchive.Changes(s.st, nil)
+	c.Assert(err, IsNil)
+	c.Check(changes, HasLen, 1)
+	data, err := os.ReadFile(dirs.SnapChangeArchiveFile)
+	c.Assert(err, IsNil)
+	c.Check(bytes.Count(data, []byte("\n")), Equals, 1)
+}
+
+func (s *archiveSuite) TestPendingKeptInState(c *C) {
+	s.st.Lock()
+	chg := s.addChange(c, "install-snap", "foo", time.Now(), state.DoneStatus)
+	s.st.Prune(time.Now(), time.Hour, 2*time.Hour, 0)
+	s.st.Unlock()
+
+	// snapd stops before the pruned change is written
+	s.st.Lock()
+	data, err := json.Marshal(s.st)
+	s.st.Unlock()
+	c.Assert(err, IsNil)
+
+	st, err := state.ReadState(nil, bytes.NewReader(data))
+	c.Assert(err, IsNil)
+	mgr := changearchive.Manager(st)
+	c.Assert(mgr.Ensure(), IsNil)
+
+	changes, err := changearchive.Changes(st, nil)
+	c.Assert(err, IsNil)
+	c.Assert(changes, HasLen, 1)
+	c.Check(changes[0].ID, Equals, chg.ID())
+	c.Check(dirs.SnapChangeArchiveFile, testutil.FilePresent)
+
+	// and is no longer pending
+	st.Lock()
+	defer st.Unlock()
+	var pending []*changearchive.Change
+	c.Check(st.Get("change-archive-pending", &pending), testutil.ErrorIs, state.ErrNoState)
+}
+
+func (s *archiveSuite) TestArchiveOnPrune(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	t0 := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	chg1 := s.addChange(c, "install-snap", "foo", t0, state.DoneStatus)
+	chg1.Set(changearchive.RequestedByKey, 1000)
+	chg1.Set("api-data", map[string]interface{}{"snap-names": []string{"foo"}})
+	chg2 := s.addChange(c, "remove-snap", "bar.app", t0.Add(time.Hour), state.ErrorStatus)
+
+	// not archived as not ready
+	chg3 := s.st.NewChange("refresh-snap", "...")
+	chg3.AddTask(s.st.NewTask("some-task", "..."))
+
+	c.Check(s.changes(c, nil), HasLen, 0)
+
+	s.prune(c)
+	c.Check(s.st.Change(chg1.ID()), IsNil)
+	c.Check(s.st.Change(chg2.ID()), IsNil)
+	c.Check(s.st.Change(chg3.ID()), NotNil)
+
+	changes := s.changes(c, nil)
+	c.Assert(changes, HasLen, 2)
+	if changes[0].ID != chg1.ID() {
+		changes[0], changes[1] = changes[1], changes[0]
+	}
+
+	uid := uint32(1000)
+	ach := changes[0]
+	c.Check(ach.ID, Equals, chg1.ID())
+	c.Check(ach.Kind, Equals, "install-snap")
+	c.Check(ach.Summary, Equals, "Do install-snap for foo")
+	c.Check(ach.Status, Equals, "Done")
+	c.Check(ach.Err, Equals, "")
+	c.Check(ach.SpawnTime.Equal(t0), Equals, true)
+	c.Check(ach.ReadyTime.IsZero(), Equals, false)
+	c.Check(ach.SnapNames, DeepEquals, []string{"foo"})
+	c.Check(ach.RequestedBy, DeepEquals, &uid)
+	c.Check(ach.APIData, HasLen, 1)
+	c.Assert(ach.Tasks, HasLen, 1)
+	c.Check(ach.Tasks[0].Kind, Equals, "some-task")
+	c.Check(ach.Tasks[0].Status, Equals, "Done")
+	c.Assert(ach.Tasks[0].Log, HasLen, 1)
+	c.Check(ach.Tasks[0].Log[0], Matches, ".* INFO did something")
+
+	c.Check(changes[1].Status, Equals, "Error")
+	c.Check(changes[1].Err, Not(Equals), "")
+	c.Check(changes[1].RequestedBy, IsNil)
+
+	st, err := os.Stat(dirs.SnapChangeArchiveFile)
+	c.Assert(err, IsNil)
+	c.Check(st.Mode().Perm(), Equals, os.FileMode(0600))
+}
+
+func (s *archiveSuite) TestChangesFilter(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	t0 := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	chg1 := s.addChange(c, "install-snap", "foo", t0, state.DoneStatus)
+	chg2 := s.addChange(c, "remove-snap", "foo", t0.Add(time.Hour), state.ErrorStatus)
+	chg3 := s.addChange(c, "service-control", "bar.app", t0.Add(2*time.Hour), state.DoneStatus)
+	s.prune(c)
+
+	for _, tc := range []struct {
+		filter   *changearchive.Filter
+		expected []string
+	}{
+		{&changearchive.Filter{}, []string{chg1.ID(), chg2.ID(), chg3.ID()}},
+		{&changearchive.Filter{Kind: "install-snap"}, []string{chg1.ID()}},
+		{&changearchive.Filter{SnapName: "foo"}, []string{chg1.ID(), chg2.ID()}},
+		{&changearchive.Filter{SnapName: "bar"}, []string{chg3.ID()}},
+		{&changearchive.Filter{Status: "Done"}, []string{chg1.ID(), chg3.ID()}},
+		{&changearchive.Filter{After: t0.Add(time.Hour)}, []string{chg2.ID(), chg3.ID()}},
+		{&changearchive.Filter{Before: t0.Add(time.Hour)}, []string{chg1.ID()}},
+		{&changearchive.Filter{SnapName: "foo", Status: "Error"}, []string{chg2.ID()}},
+		{&changearchive.Filter{Kind: "refresh-snap"}, nil},
+	} {
+		changes := s.changes(c, tc.filter)
+		var ids []string
+		for _, ach := range changes {
+			ids = append(ids, ach.ID)
+		}
+		// changes pruned together are archived in no specific order
+		c.Check(ids, testutil.DeepUnsortedMatches, tc.expected, Commentf("%+v", tc.filter))
+	}
+}
+
+func (s *archiveSuite) TestChangesArchivedTwiceOrIncomplete(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	chg := s.addChange(c, "install-snap", "foo", time.Now(), state.DoneStatus)
+	data, err := os.ReadFile(dirs.SnapChangeArchiveFile)
+	c.Check(os.IsNotExist(err), Equals, true)
+	s.prune(c)
+	data, err = os.ReadFile(dirs.SnapChangeArchiveFile)
+	c.Assert(err, IsNil)
+
+	// archived again, then an incomplete entry because of a crash
+	data = append(data, data...)
+	data = append(data, data[:10]...)
+	c.Assert(os.WriteFile(dirs.SnapChangeArchiveFile, data, 0600), IsNil)
+
+	changes := s.changes(c, nil)
+	c.Assert(changes, HasLen, 1)
+	c.Check(changes[0].ID, Equals, chg.ID())
+}
+
+func (s *archiveSuite) TestArchiveShrinks(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	var ids []string
+	for i := 0; i < 10; i++ {
+		chg := s.addChange(c, "install-snap", "foo", time.Now(), state.DoneStatus)
+		ids = append(ids, chg.ID())
+		s.prune(c)
+	}
+	data, err := os.ReadFile(dirs.SnapChangeArchiveFile)
+	c.Assert(err, IsNil)
+	// allow for about 4 changes
+	restore := changearchive.MockMaxArchiveSize(int64(len(data)) * 4 / 10)
+	defer restore()
+
+	chg := s.addChange(c, "install-snap", "foo", time.Now(), state.DoneStatus)
+	ids = append(ids, chg.ID())
+	s.prune(c)
+
+	changes := s.changes(c, nil)
+	var archived []string
+	for _, ach := range changes {
+		archived = append(archived, ach.ID)
+	}
+	// the oldest changes were dropped, keeping about half the maximum
+	c.Check(archived, DeepEquals, ids[len(ids)-len(archived):])
+	c.Check(len(archived) >= 1 && len(archived) <= 2, Equals, true, Commentf("%v", archived))
+}
@@ -84,9 +84,12 @@ func (m *ConfdbManager) doCommitTransaction(t *state.Task, _ *tomb.Tomb) (err er
 	if err != nil {
 		return err
 	}
-	schema := confdbAssert.Confdb().Schema
+	var info commitInfo
+	if err := t.Get("confdb-commit-info", &info); err != nil && !errors.Is(err, state.ErrNoState) {
+		return err
+	}
 
-	return tx.Commit(st, schema)
+	return commitAndRecord(st, tx, confdbAssert.Confdb(), info)
 }
 
 func (m *ConfdbManager) clearOngoingTransaction(t *state.Task, _ *tomb.Tomb) error {
@@ -187,7 +190,37 @@ type saveViewHandler struct {
 	ctx *hookstate.Context
 }
 
-func (h *saveViewHandler) Before() error { return nil }
+// Before checks that the transaction's data is valid, so data which doesn't
+// meet the schema (e.g., its constraints between entries) is rejected before
+// any custodian saves it.
+func (h *saveViewHandler) Before() error {
+	h.ctx.Lock()
+	defer h.ctx.Unlock()
+
+	t, _ := h.ctx.Task()
+	st := h.ctx.State()
+
+	tx, _, err := GetStoredTransaction(t)
+	if err != nil {
+		return fmt.Errorf("cannot get transaction in save-confdb handler: %v", err)
+	}
+
+	confdbAssert, err := assertstateConfdb(st, tx.ConfdbAccount, tx.ConfdbName)
+	if err != nil {
+		return err
+	}
+
+	data, err := tx.Data()
+	if err != nil {
+		return err
+	}
+
+	if err := confdbAssert.Confdb().Schema.Validate(data); err != nil {
+		return fmt.Errorf("cannot save changes to confdb %s/%s: %w", tx.ConfdbAccount, tx.ConfdbName, err)
+	}
+
+	return nil
+}
 
 func (h *saveViewHandler) Error(origErr error) (ignoreErr bool, err error) {
 	h.ctx.Lock()
@@ -22,6 +22,7 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/snapcore/snapd/asserts"
@@ -54,7 +55,7 @@ func Set(st *state.State, account, confdbName, viewName string, requests map[str
 		return err
 	}
 
-	return tx.Commit(st, view.Confdb().Schema)
+	return commitAndRecord(st, tx, view.Confdb(), commitInfo{View: view.Name})
 }
 
 // SetViaView uses the view to set the requests in the transaction's databag.
@@ -296,13 +297,30 @@ const (
 )
 
 func createChangeConfdbTasks(st *state.State, tx *Transaction, view *confdb.View, callingSnap string) (*state.TaskSet, error) {
-	custodianPlugs, err := getCustodianPlugsForView(st, view)
+	ts, err := createChangeConfdbTasksForViews(st, tx, view.Confdb(), []*confdb.View{view}, callingSnap)
+	if err != nil {
+		return nil, err
+	}
+
+	commitTask, err := ts.Edge(commitEdge)
+	if err != nil {
+		return nil, err
+	}
+	commitTask.Set("confdb-commit-info", commitInfo{Snap: callingSnap, View: view.Name})
+	return ts, nil
+}
+
+// createChangeConfdbTasksForViews creates the tasks to commit the transaction
+// which modifies data visible through the given views. The change-view and
+// save-view hooks of the custodians of all the views are run before committing.
+func createChangeConfdbTasksForViews(st *state.State, tx *Transaction, db *confdb.Confdb, views []*confdb.View, callingSnap string) (*state.TaskSet, error) {
+	custodianPlugs, err := getCustodianPlugsForViews(st, views)
 	if err != nil {
 		return nil, err
 	}
 
 	if len(custodianPlugs) == 0 {
-		return nil, fmt.Errorf("cannot commit changes to confdb %s/%s: no custodian snap installed", view.Confdb().Account, view.Confdb().Name)
+		return nil, fmt.Errorf("cannot commit changes to confdb %s/%s: no custodian snap installed", db.Account, db.Name)
 	}
 
 	custodianNames := make([]string, 0, len(custodianPlugs))
@@ -327,39 +345,39 @@ func createChangeConfdbTasks(st *state.State, tx *Transaction, view *confdb.View
 	clearTxOnErrTask := st.NewTask("clear-confdb-tx-on-error", "Clears the ongoing confdb transaction from state (on error)")
 	linkTask(clearTxOnErrTask)
 
-	// look for plugs that reference the relevant view and create run-hooks for
+	// look for plugs that reference the relevant views and create run-hooks for
 	// them, if the snap has those hooks
 	for _, name := range custodianNames {
-		plug := custodianPlugs[name]
-		custodian := plug.Snap
-		if _, ok := custodian.Hooks["change-view-"+plug.Name]; !ok {
-			continue
-		}
+		for _, plug := range custodianPlugs[name] {
+			if _, ok := plug.Snap.Hooks["change-view-"+plug.Name]; !ok {
+				continue
+			}
 
-		const ignoreError = false
-		chgViewTask := setupConfdbHook(st, name, "change-view-"+plug.Name, ignoreError)
-		// run change-view-<plug> hooks in a sequential, deterministic order
-		linkTask(chgViewTask)
+			const ignoreError = false
+			chgViewTask := setupConfdbHook(st, name, "change-view-"+plug.Name, ignoreError)
+			// run change-view-<plug> hooks in a sequential, deterministic order
+			linkTask(chgViewTask)
+		}
 	}
 
 	for _, name := range custodianNames {
-		plug := custodianPlugs[name]
-		custodian := plug.Snap
-		if _, ok := custodian.Hooks["save-view-"+plug.Name]; !ok {
-			continue
-		}
+		for _, plug := range custodianPlugs[name] {
+			if _, ok := plug.Snap.Hooks["save-view-"+plug.Name]; !ok {
+				continue
+			}
 
-		const ignoreError = false
-		saveViewTask := setupConfdbHook(st, name, "save-view-"+plug.Name, ignoreError)
-		// also run save-view hooks sequentially so, if one fails, we can determine
-		// which tasks need to be rolled back
-		linkTask(saveViewTask)
+			const ignoreError = false
+			saveViewTask := setupConfdbHook(st, name, "save-view-"+plug.Name, ignoreError)
+			// also run save-view hooks sequentially so, if one fails, we can determine
+			// which tasks need to be rolled back
+			linkTask(saveViewTask)
+		}
 	}
 
 	// run view-changed hooks for any plug that references a view that could have
 	// changed with this data modification
 	paths := tx.AlteredPaths()
-	affectedPlugs, err := getPlugsAffectedByPaths(st, view.Confdb(), paths)
+	affectedPlugs, err := getPlugsAffectedByPaths(st, db, paths)
 	if err != nil {
 		return nil, err
 	}
@@ -385,8 +403,9 @@ func createChangeConfdbTasks(st *state.State, tx *Transaction, view *confdb.View
 	}
 
 	// commit after custodians save ephemeral data
-	commitTask := st.NewTask("commit-confdb-tx", fmt.Sprintf("Commit changes to confdb \"%s/%s\"", view.Confdb().Account, view.Confdb().Name))
+	commitTask := st.NewTask("commit-confdb-tx", fmt.Sprintf("Commit changes to confdb \"%s/%s\"", db.Account, db.Name))
 	commitTask.Set("confdb-transaction", tx)
+	commitTask.Set("confdb-commit-info", commitInfo{Snap: callingSnap})
 	// link all previous tasks to the commit task that carries the transaction
 	for _, t := range ts.Tasks() {
 		t.Set("commit-task", commitTask.ID())
@@ -403,11 +422,13 @@ func createChangeConfdbTasks(st *state.State, tx *Transaction, view *confdb.View
 	return ts, nil
 }
 
-func getCustodianPlugsForView(st *state.State, view *confdb.View) (map[string]*snap.PlugInfo, error) {
+// getCustodianPlugsForViews returns the connected custodian plugs referencing
+// any of the views, grouped by snap and sorted by plug name.
+func getCustodianPlugsForViews(st *state.State, views []*confdb.View) (map[string][]*snap.PlugInfo, error) {
 	repo := ifacerepo.Get(st)
 	plugs := repo.AllPlugs("confdb")
 
-	custodians := make(map[string]*snap.PlugInfo)
+	custodians := make(map[string][]*snap.PlugInfo)
 	for _, plug := range plugs {
 		conns, err := repo.Connected(plug.Snap.InstanceName(), plug.Name)
 		if err != nil {
@@ -426,15 +447,20 @@ func getCustodianPlugsForView(st *state.State, view *confdb.View) (map[string]*s
 			return nil, err
 		}
 
-		if view.Confdb().Account != account || view.Confdb().Name != confdbName ||
-			view.Name != viewName {
-			continue
+		for _, view := range views {
+			if view.Confdb().Account != account || view.Confdb().Name != confdbName ||
+				view.Name != viewName {
+				continue
+			}
+
+			name := plug.Snap.SnapName()
+			custodians[name] = append(custodians[name], plug)
+			break
 		}
+	}
 
-		// TODO: if a snap has more than one plug providing access to a view, then
-		// which plug we're getting here becomes unpredictable. We should check
-		// for this at some point (interface connection?)
-		custodians[plug.Snap.SnapName()] = plug
+	for _, snapPlugs := range custodians {
+		sort.Slice(snapPlugs, func(i, j int) bool { return snapPlugs[i].Name < snapPlugs[j].Name })
 	}
 
 	return custodians, nil
@@ -479,6 +505,38 @@ func getPlugsAffectedByPaths(st *state.State, confdb *confdb.Confdb, storagePath
 	return affectedPlugs, nil
 }
 
+// addConfdbChangedNotices records a confdb-changed notice for each view of the
+// confdb with visibility into the modified storage paths. The notices are not
+// public, they are only visible to root and, through the snap socket, to snaps
+// with a connected confdb plug for the view.
+func addConfdbChangedNotices(st *state.State, db *confdb.Confdb, storagePaths []string, revision int) error {
+	viewNames := make(map[string]bool)
+	for _, path := range storagePaths {
+		for _, view := range db.GetViewsAffectedByPath(path) {
+			viewNames[view.Name] = true
+		}
+	}
+
+	names := make([]string, 0, len(viewNames))
+	for name := range viewNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rootUID := uint32(0)
+	opts := &state.AddNoticeOptions{
+		Data: map[string]string{"revision": strconv.Itoa(revision)},
+	}
+	for _, name := range names {
+		key := db.Account + "/" + db.Name + "/" + name
+		if _, err := st.AddNotice(&rootUID, state.ConfdbChangedNotice, key, opts); err != nil {
+			return fmt.Errorf("cannot record confdb-changed notice for %s: %v", key, err)
+		}
+	}
+
+	return nil
+}
+
 // GetStoredTransaction returns the transaction associated with the task
 // (even if indirectly) and a callback to persist changes made to it.
 func GetStoredTransaction(t *state.Task) (tx *Transaction, saveTxChanges func(), err error) {
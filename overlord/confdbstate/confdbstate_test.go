@@ -19,6 +19,7 @@
 package confdbstate_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -121,6 +122,11 @@ func (s *confdbTestSuite) SetUpTest(c *C) {
 					map[string]interface{}{"request": "private.{placeholder}", "storage": "private.{placeholder}"},
 				},
 			},
+			"setup-private": map[string]interface{}{
+				"rules": []interface{}{
+					map[string]interface{}{"request": "keys", "storage": "private"},
+				},
+			},
 		},
 		"timestamp": "2030-11-06T09:16:26Z",
 	}
@@ -882,6 +888,41 @@ func (s *confdbTestSuite) TestGetTransactionFromUserCreatesNewChange(c *C) {
 	s.checkModifyConfdbChange(c, chg, hooks)
 }
 
+func (s *confdbTestSuite) TestInvalidDataRejectedBeforeSaveView(c *C) {
+	hooks, restore := s.mockConfdbHooks(c)
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setupConfdbModificationScenario(c, []string{"custodian-snap"}, nil)
+
+	view := s.confdb.View("setup-wifi")
+	tx, err := confdbstate.NewTransaction(s.state, s.devAccID, "network")
+	c.Assert(err, IsNil)
+	// doesn't match the schema's "string" type
+	c.Assert(tx.Set("wifi.ssid", 1), IsNil)
+
+	ts, err := confdbstate.CreateChangeConfdbTasks(s.state, tx, view, "")
+	c.Assert(err, IsNil)
+	chg := s.state.NewChange("modify-confdb", "")
+	chg.AddAll(ts)
+
+	s.state.Unlock()
+	err = s.o.Settle(testutil.HostScaledTimeout(5 * time.Second))
+	s.state.Lock()
+	c.Assert(err, IsNil)
+
+	c.Assert(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, fmt.Sprintf(`(?s).*cannot save changes to confdb %s/network: cannot accept element in "wifi.ssid": expected string type but value was number.*`, s.devAccID))
+
+	// the custodian never got to save the data
+	c.Check(*hooks, DeepEquals, []string{"change-view-setup"})
+
+	_, err = confdbstate.Get(s.state, s.devAccID, "network", "setup-wifi", []string{"ssid"})
+	c.Check(err, FitsTypeOf, &confdb.NotFoundError{})
+}
+
 func (s *confdbTestSuite) TestGetTransactionFromSnapCreatesNewChange(c *C) {
 	hooks, restore := s.mockConfdbHooks(c)
 	defer restore()
@@ -1145,3 +1186,70 @@ func (s *confdbTestSuite) TestGetDifferentTransactionThanOngoing(c *C) {
 	c.Assert(tx, IsNil)
 	c.Assert(commitTxFunc, IsNil)
 }
+
+func (s *confdbTestSuite) TestSetAddsConfdbChangedNotices(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	err := confdbstate.Set(s.state, s.devAccID, "network", "setup-wifi", map[string]interface{}{"ssid": "foo"})
+	c.Assert(err, IsNil)
+
+	notices := s.state.Notices(&state.NoticeFilter{Types: []state.NoticeType{state.ConfdbChangedNotice}})
+	c.Assert(notices, HasLen, 1)
+	n := noticeToMap(c, notices[0])
+	// only visible to root and to snaps with a connected confdb plug
+	c.Check(n["user-id"], Equals, float64(0))
+	c.Check(n["key"], Equals, s.devAccID+"/network/setup-wifi")
+	c.Check(n["last-data"], DeepEquals, map[string]interface{}{"revision": "1"})
+}
+
+func (s *confdbTestSuite) TestAddConfdbChangedNoticesOnlyAffectedViews(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	views := map[string]interface{}{
+		"wifi": map[string]interface{}{
+			"rules": []interface{}{
+				map[string]interface{}{"request": "ssid", "storage": "wifi.ssid"},
+			},
+		},
+		"wifi-psk": map[string]interface{}{
+			"rules": []interface{}{
+				map[string]interface{}{"request": "psk", "storage": "wifi.psk"},
+			},
+		},
+		"proxy": map[string]interface{}{
+			"rules": []interface{}{
+				map[string]interface{}{"request": "http", "storage": "proxy.http"},
+			},
+		},
+		"all": map[string]interface{}{
+			"rules": []interface{}{
+				map[string]interface{}{"request": "wifi", "storage": "wifi"},
+				map[string]interface{}{"request": "proxy", "storage": "proxy"},
+			},
+		},
+	}
+	db, err := confdb.New("acc", "network", views, confdb.NewJSONSchema())
+	c.Assert(err, IsNil)
+
+	err = confdbstate.AddConfdbChangedNotices(s.state, db, []string{"wifi.ssid"}, 5)
+	c.Assert(err, IsNil)
+
+	notices := s.state.Notices(&state.NoticeFilter{Types: []state.NoticeType{state.ConfdbChangedNotice}})
+	var keys []string
+	for _, notice := range notices {
+		n := noticeToMap(c, notice)
+		keys = append(keys, n["key"].(string))
+		c.Check(n["last-data"], DeepEquals, map[string]interface{}{"revision": "5"})
+	}
+	c.Check(keys, testutil.DeepUnsortedMatches, []string{"acc/network/all", "acc/network/wifi"})
+}
+
+func noticeToMap(c *C, notice *state.Notice) map[string]interface{} {
+	buf, err := json.Marshal(notice)
+	c.Assert(err, IsNil)
+	var n map[string]interface{}
+	c.Assert(json.Unmarshal(buf, &n), IsNil)
+	return n
+}
@@ -19,6 +19,8 @@
 package confdbstate
 
 import (
+	"time"
+
 	"github.com/snapcore/snapd/confdb"
 	"github.com/snapcore/snapd/overlord/hookstate"
 	"github.com/snapcore/snapd/overlord/state"
@@ -31,6 +33,7 @@ var (
 	CreateChangeConfdbTasks = createChangeConfdbTasks
 	SetOngoingTransaction   = setOngoingTransaction
 	UnsetOngoingTransaction = unsetOngoingTransaction
+	AddConfdbChangedNotices = addConfdbChangedNotices
 )
 
 const (
@@ -69,3 +72,19 @@ func MockEnsureNow(f func(*state.State)) func() {
 		ensureNow = old
 	}
 }
+
+func MockMaxConfdbRevisions(n int) func() {
+	old := maxConfdbRevisions
+	maxConfdbRevisions = n
+	return func() {
+		maxConfdbRevisions = old
+	}
+}
+
+func MockTimeNow(f func() time.Time) func() {
+	old := timeNow
+	timeNow = f
+	return func() {
+		timeNow = old
+	}
+}
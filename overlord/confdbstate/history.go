@@ -0,0 +1,322 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package confdbstate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/snapcore/snapd/confdb"
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/jsonutil"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+// Revision holds a committed change to a confdb's databag.
+type Revision struct {
+	Revision  int       `json:"revision"`
+	Timestamp time.Time `json:"timestamp"`
+	// Snap is the snap which made the change. It's empty if the change was
+	// requested through the API.
+	Snap string `json:"snap,omitempty"`
+	// View is the view through which the change was made.
+	View string `json:"view,omitempty"`
+	// RollbackTo is the revision whose data was restored by this change, if
+	// the change was a rollback.
+	RollbackTo int `json:"rollback-to,omitempty"`
+	// Changes holds the storage paths set by the change, in the order they
+	// were written. Unset paths have a nil value.
+	Changes []map[string]interface{} `json:"changes,omitempty"`
+	// Data is the databag's data after the change was committed.
+	Data confdb.JSONDataBag `json:"data"`
+}
+
+// maxConfdbRevisions is the number of revisions kept in each confdb's history.
+var maxConfdbRevisions = 10
+
+var timeNow = time.Now
+
+// commitInfo holds the information recorded in the history about who and what
+// committed a transaction.
+type commitInfo struct {
+	Snap       string `json:"snap,omitempty"`
+	View       string `json:"view,omitempty"`
+	RollbackTo int    `json:"rollback-to,omitempty"`
+}
+
+// confdbHistory holds the revisions of a confdb as kept in the state. To keep
+// the state small, only the data of the oldest revision is stored and the data
+// of the following revisions is rebuilt by applying their changes.
+type confdbHistory struct {
+	Base      confdb.JSONDataBag `json:"base"`
+	Revisions []*storedRevision  `json:"revisions"`
+}
+
+// storedRevision is a Revision as kept in the state, without its data.
+type storedRevision struct {
+	Revision   int                      `json:"revision"`
+	Timestamp  time.Time                `json:"timestamp"`
+	Snap       string                   `json:"snap,omitempty"`
+	View       string                   `json:"view,omitempty"`
+	RollbackTo int                      `json:"rollback-to,omitempty"`
+	Changes    []map[string]interface{} `json:"changes,omitempty"`
+}
+
+// commitAndRecord commits the transaction, records a new revision in the
+// confdb's history and notifies about the views affected by the changes.
+func commitAndRecord(st *state.State, tx *Transaction, db *confdb.Confdb, info commitInfo) error {
+	changes := tx.copyDeltas()
+	paths := tx.AlteredPaths()
+
+	if err := tx.Commit(st, db.Schema); err != nil {
+		return err
+	}
+
+	data, err := readDatabag(st, tx.ConfdbAccount, tx.ConfdbName)
+	if err != nil {
+		return err
+	}
+
+	rev := &storedRevision{
+		Snap:       info.Snap,
+		View:       info.View,
+		RollbackTo: info.RollbackTo,
+		Changes:    changes,
+	}
+	if err := recordRevision(st, tx.ConfdbAccount, tx.ConfdbName, rev, data); err != nil {
+		return err
+	}
+
+	return addConfdbChangedNotices(st, db, paths, rev.Revision)
+}
+
+func readHistory(st *state.State) (map[string]*confdbHistory, error) {
+	var history map[string]*confdbHistory
+	if err := st.Get("confdb-history", &history); err != nil {
+		if errors.Is(err, &state.NoStateError{}) {
+			return make(map[string]*confdbHistory), nil
+		}
+		return nil, err
+	}
+	return history, nil
+}
+
+// recordRevision appends the revision to the confdb's history. The data is the
+// databag's data once the revision was committed.
+func recordRevision(st *state.State, account, confdbName string, rev *storedRevision, data confdb.JSONDataBag) error {
+	history, err := readHistory(st)
+	if err != nil {
+		return err
+	}
+
+	confdbRef := account + "/" + confdbName
+	hist := history[confdbRef]
+	if hist == nil || len(hist.Revisions) == 0 {
+		hist = &confdbHistory{Base: data.Copy()}
+		history[confdbRef] = hist
+	}
+
+	rev.Revision = 1
+	if len(hist.Revisions) > 0 {
+		rev.Revision = hist.Revisions[len(hist.Revisions)-1].Revision + 1
+	}
+	rev.Timestamp = timeNow()
+	hist.Revisions = append(hist.Revisions, rev)
+
+	if len(hist.Revisions) > maxConfdbRevisions {
+		revs, err := hist.revisions()
+		if err != nil {
+			return err
+		}
+		drop := len(hist.Revisions) - maxConfdbRevisions
+		hist.Base = revs[drop].Data
+		hist.Revisions = hist.Revisions[drop:]
+	}
+
+	st.Set("confdb-history", history)
+	return nil
+}
+
+// revisions returns the revisions in the history along with their data.
+func (h *confdbHistory) revisions() ([]*Revision, error) {
+	revs := make([]*Revision, 0, len(h.Revisions))
+	data := h.Base.Copy()
+	for i, stored := range h.Revisions {
+		// the base already holds the data of the first revision
+		if i > 0 {
+			if err := applyDeltas(data, stored.Changes); err != nil {
+				return nil, fmt.Errorf("cannot rebuild data of revision %d: %v", stored.Revision, err)
+			}
+		}
+
+		revs = append(revs, &Revision{
+			Revision:   stored.Revision,
+			Timestamp:  stored.Timestamp,
+			Snap:       stored.Snap,
+			View:       stored.View,
+			RollbackTo: stored.RollbackTo,
+			Changes:    stored.Changes,
+			Data:       data.Copy(),
+		})
+	}
+	return revs, nil
+}
+
+// History returns the revisions recorded for the confdb identified by the
+// account and confdb name, oldest first.
+func History(st *state.State, account, confdbName string) ([]*Revision, error) {
+	history, err := readHistory(st)
+	if err != nil {
+		return nil, err
+	}
+
+	hist := history[account+"/"+confdbName]
+	if hist == nil {
+		return nil, nil
+	}
+	return hist.revisions()
+}
+
+// Rollback creates a change which restores the data of the given revision of
+// the confdb identified by the account and confdb name. The change-view and
+// save-view hooks of the custodians of all views with visibility into the
+// restored data are run to check and save it.
+func Rollback(st *state.State, account, confdbName string, revision int) (*state.Change, error) {
+	revs, err := History(st, account, confdbName)
+	if err != nil {
+		return nil, err
+	}
+
+	var target *Revision
+	for _, rev := range revs {
+		if rev.Revision == revision {
+			target = rev
+			break
+		}
+	}
+	if target == nil {
+		return nil, confdb.NewNotFoundError(i18n.G("cannot find revision %d of confdb %s/%s"), revision, account, confdbName)
+	}
+
+	confdbAssert, err := assertstateConfdb(st, account, confdbName)
+	if err != nil {
+		return nil, fmt.Errorf(i18n.G("cannot find confdb assertion %s/%s: %v"), account, confdbName, err)
+	}
+	db := confdbAssert.Confdb()
+
+	tx, err := NewTransaction(st, account, confdbName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setRollbackDeltas(tx, target.Data); err != nil {
+		return nil, fmt.Errorf(i18n.G("cannot rollback confdb %s/%s: %v"), account, confdbName, err)
+	}
+
+	paths := tx.AlteredPaths()
+	if len(paths) == 0 {
+		return nil, fmt.Errorf(i18n.G("cannot rollback confdb %s/%s: data already matches revision %d"), account, confdbName, revision)
+	}
+
+	ts, err := createChangeConfdbTasksForViews(st, tx, db, viewsAffectedByPaths(db, paths), "")
+	if err != nil {
+		return nil, err
+	}
+
+	commitTask, err := ts.Edge(commitEdge)
+	if err != nil {
+		return nil, err
+	}
+	commitTask.Set("confdb-commit-info", commitInfo{RollbackTo: revision})
+
+	if err := setOngoingTransaction(st, account, confdbName, commitTask.ID()); err != nil {
+		return nil, err
+	}
+
+	chg := st.NewChange("rollback-confdb", fmt.Sprintf(i18n.G("Rollback confdb \"%s/%s\" to revision %d"), account, confdbName, revision))
+	chg.AddAll(ts)
+
+	ensureNow(st)
+	return chg, nil
+}
+
+// viewsAffectedByPaths returns the views of the confdb with visibility into any
+// of the storage paths, sorted by name.
+func viewsAffectedByPaths(db *confdb.Confdb, paths []string) []*confdb.View {
+	seen := make(map[string]bool)
+	var views []*confdb.View
+	for _, path := range paths {
+		for _, view := range db.GetViewsAffectedByPath(path) {
+			if seen[view.Name] {
+				continue
+			}
+			seen[view.Name] = true
+			views = append(views, view)
+		}
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Name < views[j].Name })
+	return views
+}
+
+// setRollbackDeltas writes the top-level entries of the data which differ from
+// the current ones into the transaction, unsetting any entry which isn't
+// present in the data.
+func setRollbackDeltas(tx *Transaction, data confdb.JSONDataBag) error {
+	current := tx.Pristine().(confdb.JSONDataBag)
+
+	// unset and set entries in a deterministic order
+	var toUnset []string
+	for key := range current {
+		if _, ok := data[key]; !ok {
+			toUnset = append(toUnset, key)
+		}
+	}
+	sort.Strings(toUnset)
+
+	toSet := make([]string, 0, len(data))
+	for key, value := range data {
+		if bytes.Equal(current[key], value) {
+			continue
+		}
+		toSet = append(toSet, key)
+	}
+	sort.Strings(toSet)
+
+	for _, key := range toUnset {
+		if err := tx.Unset(key); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range toSet {
+		var value interface{}
+		if err := jsonutil.DecodeWithNumber(bytes.NewReader(data[key]), &value); err != nil {
+			return err
+		}
+
+		if err := tx.Set(key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
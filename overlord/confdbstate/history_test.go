@@ -0,0 +1,335 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package confdbstate_test
+
+import (
+	"fmt"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/confdb"
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/overlord/confdbstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/testutil"
+)
+
+func (s *confdbTestSuite) TestHistoryRecordsCommits(c *C) {
+	now := time.Date(2024, time.November, 1, 12, 0, 0, 0, time.UTC)
+	restore := confdbstate.MockTimeNow(func() time.Time { return now })
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	revs, err := confdbstate.History(s.state, s.devAccID, "network")
+	c.Assert(err, IsNil)
+	c.Check(revs, HasLen, 0)
+
+	err = confdbstate.Set(s.state, s.devAccID, "network", "setup-wifi", map[string]interface{}{"ssid": "foo"})
+	c.Assert(err, IsNil)
+
+	err = confdbstate.Set(s.state, s.devAccID, "network", "setup-wifi", map[string]interface{}{"ssid": nil, "password": "secret"})
+	c.Assert(err, IsNil)
+
+	revs, err = confdbstate.History(s.state, s.devAccID, "network")
+	c.Assert(err, IsNil)
+	c.Assert(revs, HasLen, 2)
+
+	c.Check(revs[0].Revision, Equals, 1)
+	c.Check(revs[0].Timestamp.Equal(now), Equals, true)
+	c.Check(revs[0].Snap, Equals, "")
+	c.Check(revs[0].View, Equals, "setup-wifi")
+	c.Check(revs[0].RollbackTo, Equals, 0)
+	c.Check(revs[0].Changes, DeepEquals, []map[string]interface{}{{"wifi.ssid": "foo"}})
+	val, err := revs[0].Data.Get("wifi.ssid")
+	c.Assert(err, IsNil)
+	c.Check(val, Equals, "foo")
+
+	c.Check(revs[1].Revision, Equals, 2)
+	c.Check(revs[1].Changes, testutil.DeepUnsortedMatches, []map[string]interface{}{{"wifi.ssid": nil}, {"wifi.psk": "secret"}})
+	_, err = revs[1].Data.Get("wifi.ssid")
+	c.Check(err, FitsTypeOf, confdb.PathError(""))
+	val, err = revs[1].Data.Get("wifi.psk")
+	c.Assert(err, IsNil)
+	c.Check(val, Equals, "secret")
+
+	// the history of other confdbs is kept separately
+	revs, err = confdbstate.History(s.state, s.devAccID, "other")
+	c.Assert(err, IsNil)
+	c.Check(revs, HasLen, 0)
+}
+
+func (s *confdbTestSuite) TestHistoryPrunesOldRevisions(c *C) {
+	restore := confdbstate.MockMaxConfdbRevisions(2)
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	for _, ssid := range []string{"foo", "bar", "baz"} {
+		err := confdbstate.Set(s.state, s.devAccID, "network", "setup-wifi", map[string]interface{}{"ssid": ssid})
+		c.Assert(err, IsNil)
+	}
+
+	revs, err := confdbstate.History(s.state, s.devAccID, "network")
+	c.Assert(err, IsNil)
+	c.Assert(revs, HasLen, 2)
+	c.Check(revs[0].Revision, Equals, 2)
+	c.Check(revs[1].Revision, Equals, 3)
+
+	// the data of the remaining revisions is kept
+	for i, ssid := range []string{"bar", "baz"} {
+		val, err := revs[i].Data.Get("wifi.ssid")
+		c.Assert(err, IsNil)
+		c.Check(val, Equals, ssid)
+	}
+}
+
+func (s *confdbTestSuite) TestHistoryStoresChangesOnly(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	for _, ssid := range []string{"foo", "bar", "baz"} {
+		err := confdbstate.Set(s.state, s.devAccID, "network", "setup-wifi", map[string]interface{}{"ssid": ssid})
+		c.Assert(err, IsNil)
+	}
+
+	// only the data of the oldest revision is stored
+	var history map[string]map[string]interface{}
+	c.Assert(s.state.Get("confdb-history", &history), IsNil)
+	hist := history[s.devAccID+"/network"]
+	c.Check(hist["base"], DeepEquals, map[string]interface{}{
+		"wifi": map[string]interface{}{"ssid": "foo"},
+	})
+	revs := hist["revisions"].([]interface{})
+	c.Assert(revs, HasLen, 3)
+	for _, rev := range revs {
+		c.Check(rev.(map[string]interface{})["data"], IsNil)
+	}
+
+	// while the data of all revisions is rebuilt
+	history2, err := confdbstate.History(s.state, s.devAccID, "network")
+	c.Assert(err, IsNil)
+	c.Assert(history2, HasLen, 3)
+	for i, ssid := range []string{"foo", "bar", "baz"} {
+		val, err := history2[i].Data.Get("wifi.ssid")
+		c.Assert(err, IsNil)
+		c.Check(val, Equals, ssid)
+	}
+}
+
+func (s *confdbTestSuite) TestHistoryRecordsCallingSnap(c *C) {
+	_, restore := s.mockConfdbHooks(c)
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setupConfdbModificationScenario(c, []string{"custodian-snap"}, nil)
+
+	view := s.confdb.View("setup-wifi")
+	tx, err := confdbstate.NewTransaction(s.state, s.devAccID, "network")
+	c.Assert(err, IsNil)
+	c.Assert(tx.Set("wifi.ssid", "foo"), IsNil)
+
+	ts, err := confdbstate.CreateChangeConfdbTasks(s.state, tx, view, "custodian-snap")
+	c.Assert(err, IsNil)
+	chg := s.state.NewChange("modify-confdb", "")
+	chg.AddAll(ts)
+
+	s.state.Unlock()
+	err = s.o.Settle(testutil.HostScaledTimeout(5 * time.Second))
+	s.state.Lock()
+	c.Assert(err, IsNil)
+	c.Assert(chg.Status(), Equals, state.DoneStatus)
+
+	revs, err := confdbstate.History(s.state, s.devAccID, "network")
+	c.Assert(err, IsNil)
+	c.Assert(revs, HasLen, 1)
+	c.Check(revs[0].Snap, Equals, "custodian-snap")
+	c.Check(revs[0].View, Equals, "setup-wifi")
+	c.Check(revs[0].Changes, DeepEquals, []map[string]interface{}{{"wifi.ssid": "foo"}})
+
+	// committing through a change also notifies about the affected views
+	notices := s.state.Notices(&state.NoticeFilter{Types: []state.NoticeType{state.ConfdbChangedNotice}})
+	c.Assert(notices, HasLen, 1)
+	n := noticeToMap(c, notices[0])
+	c.Check(n["key"], Equals, s.devAccID+"/network/setup-wifi")
+	c.Check(n["last-data"], DeepEquals, map[string]interface{}{"revision": "1"})
+}
+
+func (s *confdbTestSuite) TestRollback(c *C) {
+	hooks, restore := s.mockConfdbHooks(c)
+	defer restore()
+
+	restore = confdbstate.MockEnsureNow(func(*state.State) {
+		s.checkOngoingConfdbTransaction(c, s.devAccID, "network")
+	})
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setupConfdbModificationScenario(c, []string{"custodian-snap"}, nil)
+
+	err := confdbstate.Set(s.state, s.devAccID, "network", "setup-wifi", map[string]interface{}{"ssid": "foo"})
+	c.Assert(err, IsNil)
+	err = confdbstate.Set(s.state, s.devAccID, "network", "setup-wifi", map[string]interface{}{"ssid": "bar", "private.key": "value"})
+	c.Assert(err, IsNil)
+
+	chg, err := confdbstate.Rollback(s.state, s.devAccID, "network", 1)
+	c.Assert(err, IsNil)
+	c.Check(chg.Kind(), Equals, "rollback-confdb")
+	c.Check(chg.Summary(), Equals, fmt.Sprintf(`Rollback confdb "%s/network" to revision 1`, s.devAccID))
+
+	s.state.Unlock()
+	err = s.o.Settle(testutil.HostScaledTimeout(5 * time.Second))
+	s.state.Lock()
+	c.Assert(err, IsNil)
+	c.Assert(chg.Status(), Equals, state.DoneStatus)
+
+	// the custodian's hooks check and save the restored data
+	c.Check(*hooks, DeepEquals, []string{"change-view-setup", "save-view-setup", "setup-view-changed"})
+
+	val, err := confdbstate.Get(s.state, s.devAccID, "network", "setup-wifi", nil)
+	c.Assert(err, IsNil)
+	c.Check(val, DeepEquals, map[string]interface{}{"ssid": "foo"})
+
+	// the rollback is recorded as a new revision
+	revs, err := confdbstate.History(s.state, s.devAccID, "network")
+	c.Assert(err, IsNil)
+	c.Assert(revs, HasLen, 3)
+	c.Check(revs[2].Revision, Equals, 3)
+	c.Check(revs[2].RollbackTo, Equals, 1)
+	c.Check(revs[2].View, Equals, "")
+	c.Check(revs[2].Data, DeepEquals, revs[0].Data)
+	c.Check(revs[2].Changes, DeepEquals, []map[string]interface{}{
+		{"private": nil},
+		{"wifi": map[string]interface{}{"ssid": "foo"}},
+	})
+}
+
+func (s *confdbTestSuite) mockPrivateCustodian(c *C) {
+	snapYaml := fmt.Sprintf(`name: private-snap
+version: 1
+type: app
+plugs:
+  priv:
+    interface: confdb
+    account: %s
+    view: network/setup-private
+    role: custodian
+`, s.devAccID)
+	hooks := []string{"change-view-priv", "save-view-priv", "priv-view-changed"}
+	info := mockInstalledSnap(c, s.state, snapYaml, hooks)
+	for _, hook := range hooks {
+		info.Hooks[hook] = &snap.HookInfo{
+			Name: hook,
+			Snap: info,
+		}
+	}
+
+	appSet, err := interfaces.NewSnapAppSet(info, nil)
+	c.Assert(err, IsNil)
+	c.Assert(s.repo.AddAppSet(appSet), IsNil)
+
+	ref := &interfaces.ConnRef{
+		PlugRef: interfaces.PlugRef{Snap: "private-snap", Name: "priv"},
+		SlotRef: interfaces.SlotRef{Snap: "core", Name: "confdb-slot"},
+	}
+	_, err = s.repo.Connect(ref, nil, nil, nil, nil, nil)
+	c.Assert(err, IsNil)
+}
+
+func (s *confdbTestSuite) TestRollbackRunsHooksOfAffectedViews(c *C) {
+	hooks, restore := s.mockConfdbHooks(c)
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setupConfdbModificationScenario(c, []string{"custodian-snap"}, nil)
+	s.mockPrivateCustodian(c)
+
+	err := confdbstate.Set(s.state, s.devAccID, "network", "setup-wifi", map[string]interface{}{"ssid": "foo"})
+	c.Assert(err, IsNil)
+	err = confdbstate.Set(s.state, s.devAccID, "network", "setup-private", map[string]interface{}{"keys": map[string]interface{}{"a": "b"}})
+	c.Assert(err, IsNil)
+	err = confdbstate.Set(s.state, s.devAccID, "network", "setup-wifi", map[string]interface{}{"ssid": "bar"})
+	c.Assert(err, IsNil)
+
+	rollback := func(revision int) {
+		*hooks = nil
+		chg, err := confdbstate.Rollback(s.state, s.devAccID, "network", revision)
+		c.Assert(err, IsNil)
+
+		s.state.Unlock()
+		err = s.o.Settle(testutil.HostScaledTimeout(5 * time.Second))
+		s.state.Lock()
+		c.Assert(err, IsNil)
+		c.Assert(chg.Status(), Equals, state.DoneStatus)
+	}
+
+	// only the wifi data changes, so only the setup-wifi custodian is involved
+	rollback(2)
+	c.Check(*hooks, DeepEquals, []string{"change-view-setup", "save-view-setup", "setup-view-changed"})
+
+	// the private data is visible through both views, so the hooks of the
+	// custodians of both are run
+	rollback(1)
+	c.Check(*hooks, DeepEquals, []string{
+		"change-view-setup", "change-view-priv",
+		"save-view-setup", "save-view-priv",
+		"setup-view-changed", "priv-view-changed",
+	})
+
+	val, err := confdbstate.Get(s.state, s.devAccID, "network", "setup-wifi", nil)
+	c.Assert(err, IsNil)
+	c.Check(val, DeepEquals, map[string]interface{}{"ssid": "foo"})
+	_, err = confdbstate.Get(s.state, s.devAccID, "network", "setup-private", nil)
+	c.Check(err, FitsTypeOf, &confdb.NotFoundError{})
+}
+
+func (s *confdbTestSuite) TestRollbackErrors(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	_, err := confdbstate.Rollback(s.state, s.devAccID, "network", 1)
+	c.Assert(err, FitsTypeOf, &confdb.NotFoundError{})
+	c.Assert(err, ErrorMatches, fmt.Sprintf("cannot find revision 1 of confdb %s/network", s.devAccID))
+
+	err = confdbstate.Set(s.state, s.devAccID, "network", "setup-wifi", map[string]interface{}{"ssid": "foo"})
+	c.Assert(err, IsNil)
+
+	// the data is already the same
+	_, err = confdbstate.Rollback(s.state, s.devAccID, "network", 1)
+	c.Assert(err, ErrorMatches, fmt.Sprintf("cannot rollback confdb %s/network: data already matches revision 1", s.devAccID))
+
+	err = confdbstate.Set(s.state, s.devAccID, "network", "setup-wifi", map[string]interface{}{"ssid": "bar"})
+	c.Assert(err, IsNil)
+
+	// no custodian snap is installed
+	s.setupConfdbModificationScenario(c, nil, nil)
+	_, err = confdbstate.Rollback(s.state, s.devAccID, "network", 1)
+	c.Assert(err, ErrorMatches, fmt.Sprintf("cannot commit changes to confdb %s/network: no custodian snap installed", s.devAccID))
+	c.Check(s.state.Changes(), HasLen, 0)
+}
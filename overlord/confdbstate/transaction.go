@@ -225,6 +225,26 @@ func (t *Transaction) AlteredPaths() []string {
 	return paths
 }
 
+// copyDeltas returns a copy of the changes written into the transaction.
+func (t *Transaction) copyDeltas() []map[string]interface{} {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if len(t.deltas) == 0 {
+		return nil
+	}
+
+	deltas := make([]map[string]interface{}, 0, len(t.deltas))
+	for _, delta := range t.deltas {
+		deltaCopy := make(map[string]interface{}, len(delta))
+		for k, v := range delta {
+			deltaCopy[k] = v
+		}
+		deltas = append(deltas, deltaCopy)
+	}
+	return deltas
+}
+
 func (t *Transaction) applyChanges() error {
 	// use a cached bag to apply and keep the changes
 	if t.modified == nil {
@@ -56,3 +56,9 @@ func MockDevicestateResetSession(f func(*state.State) error) (restore func()) {
 	devicestateResetSession = f
 	return restore
 }
+
+func MockRequestauditSetRotation(f func(maxSize int64, maxFiles int) error) (restore func()) {
+	restore = testutil.Backup(&requestauditSetRotation)
+	requestauditSetRotation = f
+	return restore
+}
@@ -0,0 +1,43 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore
+
+import (
+	"fmt"
+	"time"
+)
+
+func init() {
+	// add supported configuration of this module
+	supportedConfigurations["core.health.auto-revert-after"] = true
+}
+
+func validateHealthAutoRevertAfter(tr RunTransaction) error {
+	afterStr, err := coreCfg(tr, "health.auto-revert-after")
+	if err != nil {
+		return err
+	}
+	if afterStr != "" {
+		if after, err := time.ParseDuration(afterStr); err != nil || after < 0 {
+			return fmt.Errorf("health.auto-revert-after must be a non-negative duration, not %q", afterStr)
+		}
+	}
+	return nil
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/features"
 	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/interfaces/prompting/requestaudit"
 	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/ifacestate"
 	"github.com/snapcore/snapd/overlord/restart"
@@ -37,8 +38,16 @@ import (
 	"github.com/snapcore/snapd/snap"
 )
 
+func init() {
+	// add supported configuration of this module
+	supportedConfigurations["core.prompting.audit-log.max-size"] = true
+	supportedConfigurations["core.prompting.audit-log.max-files"] = true
+}
+
 var restartRequest = restart.Request
 
+var requestauditSetRotation = requestaudit.SetRotation
+
 var servicestateControl = servicestate.Control
 var serviceStartChangeTimeout = time.Minute
 
@@ -192,3 +201,51 @@ func doExperimentalApparmorPromptingDaemonRestart(c RunTransaction, opts *fsOnly
 
 	return nil
 }
+
+func promptingAuditLogRotation(tr ConfGetter) (maxSize int64, maxFiles int, err error) {
+	sizeStr, err := coreCfg(tr, "prompting.audit-log.max-size")
+	if err != nil {
+		return 0, 0, err
+	}
+	filesStr, err := coreCfg(tr, "prompting.audit-log.max-files")
+	if err != nil {
+		return 0, 0, err
+	}
+	maxSize, maxFiles, err = requestaudit.ParseRotation(sizeStr, filesStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("cannot set prompting audit log rotation: %v", err)
+	}
+	return maxSize, maxFiles, nil
+}
+
+func validatePromptingAuditLog(tr RunTransaction) error {
+	_, _, err := promptingAuditLogRotation(tr)
+	return err
+}
+
+// handlePromptingAuditLog applies the changes of the rotation settings of the
+// prompting audit log, which are otherwise applied when snapd starts.
+func handlePromptingAuditLog(tr RunTransaction, opts *fsOnlyContext) error {
+	changed := false
+	for _, key := range []string{"prompting.audit-log.max-size", "prompting.audit-log.max-files"} {
+		value, err := coreCfg(tr, key)
+		if err != nil {
+			return err
+		}
+		var pristine interface{} = ""
+		if err := tr.GetPristine("core", key, &pristine); err != nil && !config.IsNoOption(err) {
+			return err
+		}
+		if value != fmt.Sprint(pristine) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	maxSize, maxFiles, err := promptingAuditLogRotation(tr)
+	if err != nil {
+		return err
+	}
+	return requestauditSetRotation(maxSize, maxFiles)
+}
@@ -648,3 +648,73 @@ plugs:
 
 	s.state.Set("conns", conns)
 }
+
+func (s *promptingSuite) TestPromptingAuditLogRotation(c *C) {
+	type rotation struct {
+		maxSize  int64
+		maxFiles int
+	}
+	var rotations []rotation
+	// the proxy settings are applied as well
+	c.Assert(os.MkdirAll(filepath.Join(dirs.GlobalRootDir, "/etc/"), 0755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dirs.GlobalRootDir, "/etc/environment"), nil, 0644), IsNil)
+	restore := configcore.MockRequestauditSetRotation(func(maxSize int64, maxFiles int) error {
+		rotations = append(rotations, rotation{maxSize, maxFiles})
+		return nil
+	})
+	defer restore()
+
+	err := configcore.Run(coreDev, &mockConf{
+		state: s.state,
+		changes: map[string]interface{}{
+			"prompting.audit-log.max-size":  "1M",
+			"prompting.audit-log.max-files": "2",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(rotations, DeepEquals, []rotation{{1024 * 1024, 2}})
+
+	// unchanged options
+	err = configcore.Run(coreDev, &mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"prompting.audit-log.max-size": "1M",
+		},
+		changes: map[string]interface{}{
+			"prompting.audit-log.max-size": "1M",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(rotations, HasLen, 1)
+
+	// unsetting an option goes back to its default
+	err = configcore.Run(coreDev, &mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"prompting.audit-log.max-size":  "1M",
+			"prompting.audit-log.max-files": "2",
+		},
+		changes: map[string]interface{}{
+			"prompting.audit-log.max-files": "",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(rotations[1:], DeepEquals, []rotation{{1024 * 1024, 4}})
+}
+
+func (s *promptingSuite) TestPromptingAuditLogRotationInvalid(c *C) {
+	for _, tc := range []struct {
+		key, value, err string
+	}{
+		{"prompting.audit-log.max-size", "foo", `cannot set prompting audit log rotation: audit log size must be a positive size, not "foo"`},
+		{"prompting.audit-log.max-size", "0", `cannot set prompting audit log rotation: audit log size must be a positive size, not "0"`},
+		{"prompting.audit-log.max-files", "0", `cannot set prompting audit log rotation: number of audit log files must be a positive integer, not "0"`},
+		{"prompting.audit-log.max-files", "many", `cannot set prompting audit log rotation: number of audit log files must be a positive integer, not "many"`},
+	} {
+		err := configcore.Run(coreDev, &mockConf{
+			state:   s.state,
+			changes: map[string]interface{}{tc.key: tc.value},
+		})
+		c.Check(err, ErrorMatches, tc.err, Commentf("%s=%s", tc.key, tc.value))
+	}
+}
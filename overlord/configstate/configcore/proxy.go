@@ -132,34 +132,45 @@ func validateProxyStore(tr RunTransaction) error {
 }
 
 func handleProxyStore(tr RunTransaction, opts *fsOnlyContext) error {
-	// is proxy.store being modififed?
-	proxyStoreInChanges := false
+	return resetSessionOnStoreChange(tr, "proxy.store")
+}
+
+func handleStoreMirror(tr RunTransaction, opts *fsOnlyContext) error {
+	return resetSessionOnStoreChange(tr, "store.mirror")
+}
+
+// resetSessionOnStoreChange resets the device session when the option
+// selecting the store used by the device is modified, as the session is tied
+// to the store which issued it.
+func resetSessionOnStoreChange(tr RunTransaction, option string) error {
+	// is the option being modififed?
+	optionInChanges := false
 	for _, name := range tr.Changes() {
-		if name == "core.proxy.store" {
-			proxyStoreInChanges = true
+		if name == "core."+option {
+			optionInChanges = true
 			break
 		}
 	}
-	if !proxyStoreInChanges {
+	if !optionInChanges {
 		return nil
 	}
 
-	proxyStore, err := coreCfg(tr, "proxy.store")
+	value, err := coreCfg(tr, option)
 	if err != nil {
 		return err
 	}
-	var prevProxyStore string
-	if err := tr.GetPristine("core", "proxy.store", &prevProxyStore); err != nil && !config.IsNoOption(err) {
+	var prevValue string
+	if err := tr.GetPristine("core", option, &prevValue); err != nil && !config.IsNoOption(err) {
 		return err
 	}
-	if proxyStore != prevProxyStore {
+	if value != prevValue {
 		// XXX ideally we should do this only when committing but we
 		// don't have infrastructure for that ATM, it just means the
 		// store will have to recreate the session.
 		// XXX the store code doesn't acquire the store ids and the
 		// session together atomically, this can be fixed only in a
 		// larger cleanup of how store.DeviceAndAuthContext
-		// operates. Hopefully it is atypical to set proxy.store while
+		// operates. Hopefully it is atypical to change the store while
 		// non-automatic store operations are happening, this approach
 		// is a best-effort for now.
 		state := tr.State()
@@ -0,0 +1,43 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore
+
+import (
+	"fmt"
+	"strconv"
+)
+
+func init() {
+	// add supported configuration of this module
+	supportedConfigurations["core.quota-groups.usage-threshold"] = true
+}
+
+func validateQuotaUsageThreshold(tr RunTransaction) error {
+	thresholdStr, err := coreCfg(tr, "quota-groups.usage-threshold")
+	if err != nil {
+		return err
+	}
+	if thresholdStr != "" {
+		if n, err := strconv.ParseUint(thresholdStr, 10, 8); err != nil || n < 1 || n > 100 {
+			return fmt.Errorf("quota-groups.usage-threshold must be a percentage between 1 and 100, not %q", thresholdStr)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/configstate/configcore"
+)
+
+type quotasSuite struct {
+	configcoreSuite
+}
+
+var _ = Suite(&quotasSuite{})
+
+func (s *quotasSuite) TestConfigureQuotaUsageThreshold(c *C) {
+	for _, threshold := range []string{"1", "75", "100"} {
+		err := configcore.Run(classicDev, &mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"quota-groups.usage-threshold": threshold,
+			},
+		})
+		c.Check(err, IsNil)
+	}
+}
+
+func (s *quotasSuite) TestConfigureQuotaUsageThresholdInvalid(c *C) {
+	for _, threshold := range []string{"0", "101", "-5", "50%", "x"} {
+		err := configcore.Run(classicDev, &mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"quota-groups.usage-threshold": threshold,
+			},
+		})
+		c.Check(err, ErrorMatches, `quota-groups.usage-threshold must be a percentage between 1 and 100, not ".*"`)
+	}
+}
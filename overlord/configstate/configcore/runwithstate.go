@@ -44,6 +44,10 @@ func init() {
 	addWithStateHandler(nil, handleProxyConfiguration, coreOnly)
 	// proxy.store
 	addWithStateHandler(validateProxyStore, handleProxyStore, nil)
+	// store.mirror
+	addWithStateHandler(validateStoreMirror, handleStoreMirror, nil)
+	// store.peers*
+	addWithStateHandler(validateStorePeers, handleStorePeers, nil)
 
 	// resilience.vitality-hint
 	addWithStateHandler(validateVitalitySettings, handleVitalityConfiguration, nil)
@@ -60,6 +64,11 @@ func init() {
 	addWithStateHandler(validateRefreshSchedule, nil, validateOnly)
 	addWithStateHandler(validateRefreshRateLimit, nil, validateOnly)
 	addWithStateHandler(validateAutomaticSnapshotsExpiration, nil, validateOnly)
+	addWithStateHandler(validateIncrementalSnapshots, nil, validateOnly)
+	addWithStateHandler(validateRemoteSnapshots, nil, validateOnly)
+	addWithStateHandler(validateScheduledSnapshots, nil, validateOnly)
+	addWithStateHandler(validateQuotaUsageThreshold, nil, validateOnly)
+	addWithStateHandler(validateHealthAutoRevertAfter, nil, validateOnly)
 
 	// netplan.*
 	addWithStateHandler(validateNetplanSettings, handleNetplanConfiguration, coreOnly)
@@ -75,6 +84,9 @@ func init() {
 
 	// experimental.apparmor-prompting
 	addWithStateHandler(nil, doExperimentalApparmorPromptingDaemonRestart, nil)
+
+	// prompting.audit-log.{max-size,max-files}
+	addWithStateHandler(validatePromptingAuditLog, handlePromptingAuditLog, nil)
 }
 
 // RunTransaction is an interface describing how to access
@@ -22,12 +22,29 @@ package configcore
 
 import (
 	"fmt"
+	"path/filepath"
+	"strconv"
 	"time"
+
+	"github.com/snapcore/snapd/overlord/snapshotstate/remote"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/timeutil"
 )
 
 func init() {
 	// add supported configuration of this module
 	supportedConfigurations["core.snapshots.automatic.retention"] = true
+	supportedConfigurations["core.snapshots.incremental"] = true
+	supportedConfigurations["core.snapshots.remote.url"] = true
+	supportedConfigurations["core.snapshots.remote.credentials"] = true
+	supportedConfigurations["core.snapshots.remote.known-hosts"] = true
+	supportedConfigurations["core.snapshots.remote.schedule"] = true
+	supportedConfigurations["core.snapshots.schedule"] = true
+	supportedConfigurations["core.snapshots.include"] = true
+	supportedConfigurations["core.snapshots.exclude"] = true
+	supportedConfigurations["core.snapshots.retention.daily"] = true
+	supportedConfigurations["core.snapshots.retention.weekly"] = true
 }
 
 func validateAutomaticSnapshotsExpiration(tr RunTransaction) error {
@@ -46,3 +63,82 @@ func validateAutomaticSnapshotsExpiration(tr RunTransaction) error {
 	}
 	return nil
 }
+
+func validateIncrementalSnapshots(tr RunTransaction) error {
+	return validateBoolFlag(tr, "snapshots.incremental")
+}
+
+func validateRemoteSnapshots(tr RunTransaction) error {
+	url, err := coreCfg(tr, "snapshots.remote.url")
+	if err != nil {
+		return err
+	}
+	if url != "" {
+		if err := remote.ValidateURL(url); err != nil {
+			return err
+		}
+	}
+	for _, opt := range []string{"snapshots.remote.credentials", "snapshots.remote.known-hosts"} {
+		path, err := coreCfg(tr, opt)
+		if err != nil {
+			return err
+		}
+		if path != "" && !filepath.IsAbs(path) {
+			return fmt.Errorf("%s must be an absolute path, not %q", opt, path)
+		}
+	}
+	schedule, err := coreCfg(tr, "snapshots.remote.schedule")
+	if err != nil {
+		return err
+	}
+	if schedule != "" {
+		if _, err := timeutil.ParseSchedule(schedule); err != nil {
+			return fmt.Errorf("snapshots.remote.schedule cannot be parsed: %v", err)
+		}
+	}
+	return nil
+}
+
+func validateScheduledSnapshots(tr RunTransaction) error {
+	schedule, err := coreCfg(tr, "snapshots.schedule")
+	if err != nil {
+		return err
+	}
+	if schedule != "" {
+		if _, err := timeutil.ParseSchedule(schedule); err != nil {
+			return fmt.Errorf("snapshots.schedule cannot be parsed: %v", err)
+		}
+	}
+	for _, opt := range []string{"snapshots.include", "snapshots.exclude"} {
+		snaps, err := coreCfg(tr, opt)
+		if err != nil {
+			return err
+		}
+		for _, name := range strutil.CommaSeparatedList(snaps) {
+			if err := snap.ValidateInstanceName(name); err != nil {
+				return fmt.Errorf("%s contains an invalid snap name: %v", opt, err)
+			}
+		}
+	}
+	retention := make(map[string]int, 2)
+	for _, opt := range []string{"snapshots.retention.daily", "snapshots.retention.weekly"} {
+		value, err := coreCfg(tr, opt)
+		if err != nil {
+			return err
+		}
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("%s must be a non-negative integer, not %q", opt, value)
+		}
+		retention[opt] = n
+	}
+	daily, hasDaily := retention["snapshots.retention.daily"]
+	weekly, hasWeekly := retention["snapshots.retention.weekly"]
+	if hasDaily && hasWeekly && daily == 0 && weekly == 0 {
+		return fmt.Errorf("snapshots.retention.daily and snapshots.retention.weekly cannot both be 0")
+	}
+	return nil
+}
@@ -62,6 +62,28 @@ func (s *snapshotsSuite) TestConfigureAutomaticSnapshotsDisable(c *C) {
 	c.Assert(err, IsNil)
 }
 
+func (s *snapshotsSuite) TestConfigureIncrementalSnapshots(c *C) {
+	for _, v := range []interface{}{true, false, "true", "false"} {
+		err := configcore.Run(classicDev, &mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"snapshots.incremental": v,
+			},
+		})
+		c.Assert(err, IsNil)
+	}
+}
+
+func (s *snapshotsSuite) TestConfigureIncrementalSnapshotsInvalid(c *C) {
+	err := configcore.Run(classicDev, &mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"snapshots.incremental": "maybe",
+		},
+	})
+	c.Assert(err, ErrorMatches, `snapshots.incremental can only be set to 'true' or 'false'`)
+}
+
 func (s *refreshSuite) TestConfigureAutomaticSnapshotsExpirationInvalid(c *C) {
 	err := configcore.Run(classicDev, &mockConf{
 		state: s.state,
@@ -71,3 +93,89 @@ func (s *refreshSuite) TestConfigureAutomaticSnapshotsExpirationInvalid(c *C) {
 	})
 	c.Assert(err, ErrorMatches, `snapshots.automatic.retention cannot be parsed:.*`)
 }
+
+func (s *snapshotsSuite) TestConfigureRemoteSnapshots(c *C) {
+	err := configcore.Run(classicDev, &mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"snapshots.remote.url":         "sftp://backup@example.com/srv/snapshots",
+			"snapshots.remote.credentials": "/etc/snapshots/id_ed25519",
+			"snapshots.remote.known-hosts": "/etc/snapshots/known_hosts",
+			"snapshots.remote.schedule":    "mon,02:00-04:00",
+		},
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *snapshotsSuite) TestConfigureRemoteSnapshotsInvalid(c *C) {
+	for _, t := range []struct {
+		opt, value, err string
+	}{
+		{"snapshots.remote.url", "http://example.com/snapshots", `unsupported snapshot repository URL "http://example.com/snapshots"`},
+		{"snapshots.remote.url", "s3://example.com", `invalid snapshot repository URL "s3://example.com": missing bucket`},
+		{"snapshots.remote.credentials", "s3.json", `snapshots.remote.credentials must be an absolute path, not "s3.json"`},
+		{"snapshots.remote.known-hosts", "known_hosts", `snapshots.remote.known-hosts must be an absolute path, not "known_hosts"`},
+		{"snapshots.remote.schedule", "whenever", `snapshots.remote.schedule cannot be parsed: .*`},
+	} {
+		err := configcore.Run(classicDev, &mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				t.opt: t.value,
+			},
+		})
+		c.Check(err, ErrorMatches, t.err, Commentf("%s=%s", t.opt, t.value))
+	}
+}
+
+func (s *snapshotsSuite) TestConfigureScheduledSnapshots(c *C) {
+	err := configcore.Run(classicDev, &mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"snapshots.schedule":         "02:00-04:00",
+			"snapshots.include":          "foo,bar_instance",
+			"snapshots.exclude":          "baz",
+			"snapshots.retention.daily":  "0",
+			"snapshots.retention.weekly": "8",
+		},
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *snapshotsSuite) TestConfigureScheduledSnapshotsRetentionNumbers(c *C) {
+	err := configcore.Run(classicDev, &mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"snapshots.retention.daily":  7,
+			"snapshots.retention.weekly": 0,
+		},
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *snapshotsSuite) TestConfigureScheduledSnapshotsInvalid(c *C) {
+	for _, t := range []struct {
+		conf map[string]interface{}
+		err  string
+	}{
+		{map[string]interface{}{"snapshots.schedule": "whenever"}, `snapshots.schedule cannot be parsed: .*`},
+		{map[string]interface{}{"snapshots.include": "foo,Bar"}, `snapshots.include contains an invalid snap name: invalid snap name: "Bar"`},
+		{map[string]interface{}{"snapshots.exclude": "-foo"}, `snapshots.exclude contains an invalid snap name: invalid snap name: "-foo"`},
+		{map[string]interface{}{"snapshots.retention.daily": "x"}, `snapshots.retention.daily must be a non-negative integer, not "x"`},
+		{map[string]interface{}{"snapshots.retention.weekly": "-1"}, `snapshots.retention.weekly must be a non-negative integer, not "-1"`},
+		{map[string]interface{}{"snapshots.retention.weekly": -1}, `snapshots.retention.weekly must be a non-negative integer, not "-1"`},
+		{map[string]interface{}{
+			"snapshots.retention.daily":  0,
+			"snapshots.retention.weekly": 0,
+		}, `snapshots.retention.daily and snapshots.retention.weekly cannot both be 0`},
+		{map[string]interface{}{
+			"snapshots.retention.daily":  "0",
+			"snapshots.retention.weekly": "0",
+		}, `snapshots.retention.daily and snapshots.retention.weekly cannot both be 0`},
+	} {
+		err := configcore.Run(classicDev, &mockConf{
+			state: s.state,
+			conf:  t.conf,
+		})
+		c.Check(err, ErrorMatches, t.err, Commentf("%v", t.conf))
+	}
+}
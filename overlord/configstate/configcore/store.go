@@ -22,16 +22,24 @@ package configcore
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/configstate/peerconf"
 	"github.com/snapcore/snapd/sysconfig"
 )
 
 func init() {
 	supportedConfigurations["core.store.access"] = true
+	supportedConfigurations["core.store.mirror"] = true
+	supportedConfigurations["core.store.peers"] = true
+	supportedConfigurations["core.store.peers-listen"] = true
+	supportedConfigurations["core.store.peers-token"] = true
 }
 
 func validateStoreAccess(cfg ConfGetter) error {
@@ -48,6 +56,74 @@ func validateStoreAccess(cfg ConfGetter) error {
 	}
 }
 
+func validateStoreMirror(tr RunTransaction) error {
+	mirror, err := coreCfg(tr, "store.mirror")
+	if err != nil {
+		return err
+	}
+
+	if mirror == "" {
+		return nil
+	}
+
+	u, err := url.Parse(mirror)
+	if err != nil {
+		return fmt.Errorf("cannot parse store mirror %q: %v", mirror, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("cannot use store mirror %q: expected an http or https URL", mirror)
+	}
+	return nil
+}
+
+func validateStorePeers(tr RunTransaction) error {
+	peers, err := coreCfg(tr, "store.peers")
+	if err != nil {
+		return err
+	}
+	if _, err := peerconf.ParsePeers(peers); err != nil {
+		return err
+	}
+
+	listen, err := coreCfg(tr, "store.peers-listen")
+	if err != nil {
+		return err
+	}
+	return peerconf.ValidateListen(listen)
+}
+
+// handleStorePeers lets the daemon serve the download cache to peers with the
+// new address and token when store.peers-listen or store.peers-token change.
+func handleStorePeers(tr RunTransaction, opts *fsOnlyContext) error {
+	values := make(map[string]string, 2)
+	changed := false
+	for _, key := range []string{"store.peers-listen", "store.peers-token"} {
+		value, err := coreCfg(tr, key)
+		if err != nil {
+			return err
+		}
+		values[key] = value
+		var prev interface{} = ""
+		if err := tr.GetPristine("core", key, &prev); err != nil && !config.IsNoOption(err) {
+			return err
+		}
+		if value != fmt.Sprint(prev) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	// XXX as for proxy.store this happens before the transaction is
+	// committed
+	st := tr.State()
+	st.Lock()
+	defer st.Unlock()
+	peerconf.ListenChanged(st, values["store.peers-listen"], values["store.peers-token"])
+	return nil
+}
+
 // repairConfig is a set of configuration data that is consumed by the
 // snap-repair command. This struct is duplicated in cmd/snap-repair.
 type repairConfig struct {
@@ -30,6 +30,8 @@ import (
 
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/overlord/configstate/configcore"
+	"github.com/snapcore/snapd/overlord/configstate/peerconf"
+	"github.com/snapcore/snapd/overlord/state"
 )
 
 type storeSuite struct {
@@ -96,3 +98,174 @@ func (s *storeSuite) TestFilesystemOnlyApply(c *C) {
 
 	c.Check(repairConfig.StoreOffline, Equals, true)
 }
+
+func (s *storeSuite) TestStorePeersHappy(c *C) {
+	err := configcore.Run(coreDev, &mockConf{
+		state: s.state,
+		changes: map[string]interface{}{
+			"store.peers":        "http://10.0.0.2:8181, https://peer.lan/",
+			"store.peers-listen": ":8181",
+			"store.peers-token":  "secret",
+		},
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *storeSuite) TestStorePeersUnhappy(c *C) {
+	for _, tc := range []struct {
+		changes map[string]interface{}
+		err     string
+	}{
+		{map[string]interface{}{"store.peers": "ftp://10.0.0.2"}, `cannot use peer "ftp://10.0.0.2": expected an http or https URL`},
+		{map[string]interface{}{"store.peers": "10.0.0.2:8181"}, `cannot parse peer "10.0.0.2:8181": .*`},
+		{map[string]interface{}{"store.peers": "http://"}, `cannot use peer "http://": expected an http or https URL`},
+		{map[string]interface{}{"store.peers-listen": "8181"}, `cannot use "8181" as peer listen address: expected \[host\]:port`},
+	} {
+		err := configcore.Run(coreDev, &mockConf{
+			state:   s.state,
+			changes: tc.changes,
+		})
+		c.Check(err, ErrorMatches, tc.err, Commentf("%v", tc.changes))
+	}
+}
+
+func (s *storeSuite) TestStoreMirrorResetsSession(c *C) {
+	sessionResets := 0
+	defer configcore.MockDevicestateResetSession(func(s *state.State) error {
+		s.Unlock()
+		defer s.Lock()
+		sessionResets++
+		return nil
+	})()
+
+	err := configcore.Run(coreDev, &mockConf{
+		state: s.state,
+		changes: map[string]interface{}{
+			"store.mirror": "http://mirror.lan:8080",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(sessionResets, Equals, 1)
+
+	// unchanged
+	err = configcore.Run(coreDev, &mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"store.mirror": "http://mirror.lan:8080",
+		},
+		changes: map[string]interface{}{
+			"store.mirror": "http://mirror.lan:8080",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(sessionResets, Equals, 1)
+
+	// unset
+	err = configcore.Run(coreDev, &mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"store.mirror": "http://mirror.lan:8080",
+		},
+		changes: map[string]interface{}{
+			"store.mirror": "",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(sessionResets, Equals, 2)
+}
+
+func (s *storeSuite) TestStoreMirrorUnhappy(c *C) {
+	for _, tc := range []struct {
+		mirror string
+		err    string
+	}{
+		{"ftp://mirror.lan", `cannot use store mirror "ftp://mirror.lan": expected an http or https URL`},
+		{"mirror.lan:8080", `cannot use store mirror "mirror.lan:8080": expected an http or https URL`},
+		{"http://", `cannot use store mirror "http://": expected an http or https URL`},
+		{"http://%zz", `cannot parse store mirror "http://%zz": .*`},
+	} {
+		err := configcore.Run(coreDev, &mockConf{
+			state: s.state,
+			changes: map[string]interface{}{
+				"store.mirror": tc.mirror,
+			},
+		})
+		c.Check(err, ErrorMatches, tc.err, Commentf(tc.mirror))
+	}
+}
+
+func (s *storeSuite) TestStorePeersListenChanged(c *C) {
+	type listen struct{ addr, token string }
+	var changes []listen
+	s.state.Lock()
+	peerconf.OnListenChanged(s.state, func(addr, token string) {
+		changes = append(changes, listen{addr, token})
+	})
+	s.state.Unlock()
+
+	err := configcore.Run(coreDev, &mockConf{
+		state: s.state,
+		changes: map[string]interface{}{
+			"store.peers-listen": ":8181",
+			"store.peers-token":  "secret",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(changes, DeepEquals, []listen{{":8181", "secret"}})
+
+	// unrelated or unchanged options
+	err = configcore.Run(coreDev, &mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"store.peers-listen": ":8181",
+			"store.peers-token":  "secret",
+		},
+		changes: map[string]interface{}{
+			"store.peers":        "http://10.0.0.2:8181",
+			"store.peers-listen": ":8181",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(changes, HasLen, 1)
+
+	// the token changes
+	err = configcore.Run(coreDev, &mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"store.peers-listen": ":8181",
+			"store.peers-token":  "secret",
+		},
+		changes: map[string]interface{}{
+			"store.peers-token": "other-secret",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(changes, DeepEquals, []listen{{":8181", "secret"}, {":8181", "other-secret"}})
+
+	// numeric tokens are stored as numbers by snap set
+	err = configcore.Run(coreDev, &mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"store.peers-listen": ":8181",
+			"store.peers-token":  json.Number("123456"),
+		},
+		changes: map[string]interface{}{
+			"store.peers-listen": ":8181",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(changes, HasLen, 2)
+
+	err = configcore.Run(coreDev, &mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"store.peers-listen": ":8181",
+			"store.peers-token":  json.Number("123456"),
+		},
+		changes: map[string]interface{}{
+			"store.peers-token": json.Number("654321"),
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(changes, DeepEquals, []listen{{":8181", "secret"}, {":8181", "other-secret"}, {":8181", "654321"}})
+}
@@ -0,0 +1,143 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package peerconf provides the configuration of snap downloads shared
+// between peers on the local network.
+package peerconf
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/store"
+)
+
+type PeerSettings struct {
+	st *state.State
+}
+
+func New(st *state.State) *PeerSettings {
+	return &PeerSettings{st: st}
+}
+
+func (p *PeerSettings) get(key string) (string, error) {
+	p.st.Lock()
+	tr := config.NewTransaction(p.st)
+	p.st.Unlock()
+
+	// values that look like numbers, e.g. a numeric token, are stored as
+	// such by snap set
+	var value interface{} = ""
+	if err := tr.Get("core", key, &value); err != nil && !config.IsNoOption(err) {
+		return "", err
+	}
+	return fmt.Sprint(value), nil
+}
+
+// Conf returns the peers to download snaps from, as set with the
+// store.peers and store.peers-token options.
+func (p *PeerSettings) Conf() (*store.PeerConfig, error) {
+	value, err := p.get("store.peers")
+	if err != nil {
+		return nil, err
+	}
+	peers, err := ParsePeers(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(peers) == 0 {
+		return nil, nil
+	}
+
+	token, err := p.get("store.peers-token")
+	if err != nil {
+		return nil, err
+	}
+
+	return &store.PeerConfig{Peers: peers, Token: token}, nil
+}
+
+// Listen returns the address on which the download cache is served to peers
+// and the token they must present, as set with the store.peers-listen and
+// store.peers-token options. The address is empty if the cache is not
+// shared.
+func (p *PeerSettings) Listen() (addr, token string, err error) {
+	addr, err = p.get("store.peers-listen")
+	if err != nil {
+		return "", "", err
+	}
+	token, err = p.get("store.peers-token")
+	if err != nil {
+		return "", "", err
+	}
+	return addr, token, nil
+}
+
+type listenChangedKey struct{}
+
+// OnListenChanged sets the function called when the store.peers-listen or
+// store.peers-token options are changed, with the new address and token. The
+// function is called with the state locked.
+func OnListenChanged(st *state.State, f func(addr, token string)) {
+	st.Cache(listenChangedKey{}, f)
+}
+
+// ListenChanged calls the function set with OnListenChanged, if any. It must
+// be called with the state locked.
+func ListenChanged(st *state.State, addr, token string) {
+	if f, ok := st.Cached(listenChangedKey{}).(func(addr, token string)); ok {
+		f(addr, token)
+	}
+}
+
+// ParsePeers parses a comma separated list of peer base URLs.
+func ParsePeers(value string) ([]*url.URL, error) {
+	var peers []*url.URL
+	for _, s := range strings.Split(value, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse peer %q: %v", s, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("cannot use peer %q: expected an http or https URL", s)
+		}
+		peers = append(peers, u)
+	}
+	return peers, nil
+}
+
+// ValidateListen checks that the address is suitable to serve the download
+// cache to peers.
+func ValidateListen(addr string) error {
+	if addr == "" {
+		return nil
+	}
+	if _, port, err := net.SplitHostPort(addr); err != nil || port == "" {
+		return fmt.Errorf("cannot use %q as peer listen address: expected [host]:port", addr)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package peerconf_test
+
+import (
+	"net/url"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/configstate/peerconf"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/store"
+)
+
+func TestT(t *testing.T) { TestingT(t) }
+
+type peerconfSuite struct{}
+
+var _ = Suite(&peerconfSuite{})
+
+func (s *peerconfSuite) TestPeerSettingsNoSetting(c *C) {
+	st := state.New(nil)
+
+	peerConf := peerconf.New(st)
+	conf, err := peerConf.Conf()
+	c.Assert(err, IsNil)
+	c.Check(conf, IsNil)
+
+	addr, token, err := peerConf.Listen()
+	c.Assert(err, IsNil)
+	c.Check(addr, Equals, "")
+	c.Check(token, Equals, "")
+}
+
+func (s *peerconfSuite) TestPeerSettings(c *C) {
+	st := state.New(nil)
+
+	st.Lock()
+	tr := config.NewTransaction(st)
+	tr.Set("core", "store.peers", "http://10.0.0.2:8181,https://peer.lan")
+	tr.Set("core", "store.peers-token", "secret")
+	tr.Set("core", "store.peers-listen", ":8181")
+	tr.Commit()
+	st.Unlock()
+
+	peerConf := peerconf.New(st)
+	conf, err := peerConf.Conf()
+	c.Assert(err, IsNil)
+	c.Check(conf, DeepEquals, &store.PeerConfig{
+		Peers: []*url.URL{
+			{Scheme: "http", Host: "10.0.0.2:8181"},
+			{Scheme: "https", Host: "peer.lan"},
+		},
+		Token: "secret",
+	})
+
+	addr, token, err := peerConf.Listen()
+	c.Assert(err, IsNil)
+	c.Check(addr, Equals, ":8181")
+	c.Check(token, Equals, "secret")
+}
+
+func (s *peerconfSuite) TestPeerSettingsNumericToken(c *C) {
+	st := state.New(nil)
+
+	st.Lock()
+	tr := config.NewTransaction(st)
+	tr.Set("core", "store.peers", "http://10.0.0.2:8181")
+	// as set by snap set, which stores numbers as such
+	tr.Set("core", "store.peers-token", 123456)
+	tr.Set("core", "store.peers-listen", ":8181")
+	tr.Commit()
+	st.Unlock()
+
+	peerConf := peerconf.New(st)
+	conf, err := peerConf.Conf()
+	c.Assert(err, IsNil)
+	c.Check(conf.Token, Equals, "123456")
+
+	_, token, err := peerConf.Listen()
+	c.Assert(err, IsNil)
+	c.Check(token, Equals, "123456")
+}
+
+func (s *peerconfSuite) TestListenChanged(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	// nothing is called without a function
+	peerconf.ListenChanged(st, ":8181", "secret")
+
+	var addr, token string
+	peerconf.OnListenChanged(st, func(a, t string) {
+		addr, token = a, t
+	})
+	peerconf.ListenChanged(st, ":8181", "secret")
+	c.Check(addr, Equals, ":8181")
+	c.Check(token, Equals, "secret")
+}
+
+func (s *peerconfSuite) TestParsePeers(c *C) {
+	peers, err := peerconf.ParsePeers(" http://a.lan:1 ,, https://b.lan/ ")
+	c.Assert(err, IsNil)
+	c.Check(peers, DeepEquals, []*url.URL{
+		{Scheme: "http", Host: "a.lan:1"},
+		{Scheme: "https", Host: "b.lan", Path: "/"},
+	})
+
+	_, err = peerconf.ParsePeers("a.lan")
+	c.Check(err, ErrorMatches, `cannot use peer "a.lan": expected an http or https URL`)
+}
+
+func (s *peerconfSuite) TestValidateListen(c *C) {
+	c.Check(peerconf.ValidateListen(""), IsNil)
+	c.Check(peerconf.ValidateListen(":8181"), IsNil)
+	c.Check(peerconf.ValidateListen("10.0.0.1:8181"), IsNil)
+	c.Check(peerconf.ValidateListen("10.0.0.1"), ErrorMatches, `cannot use "10.0.0.1" as peer listen address: expected \[host\]:port`)
+	c.Check(peerconf.ValidateListen("10.0.0.1:"), ErrorMatches, `cannot use "10.0.0.1:" as peer listen address: .*`)
+}
@@ -23,6 +23,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -2508,6 +2509,21 @@ func (scb storeContextBackend) ProxyStore() (*asserts.Store, error) {
 	return proxyStore(st, config.NewTransaction(st))
 }
 
+func (scb storeContextBackend) StoreMirror() (*url.URL, error) {
+	tr := config.NewTransaction(scb.state)
+
+	var mirror string
+	if err := tr.GetMaybe("core", "store.mirror", &mirror); err != nil {
+		return nil, err
+	}
+
+	if mirror == "" {
+		return nil, state.ErrNoState
+	}
+
+	return url.Parse(mirror)
+}
+
 func (scb storeContextBackend) StoreOffline() (bool, error) {
 	tr := config.NewTransaction(scb.state)
 
@@ -36,6 +36,7 @@ import (
 	"github.com/snapcore/snapd/bootloader/bootloadertest"
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/gadget"
+	"github.com/snapcore/snapd/gadget/install"
 	"github.com/snapcore/snapd/gadget/quantity"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/auth"
@@ -534,6 +535,207 @@ func (s *deviceMgrGadgetSuite) TestUpdateGadgetOnCoreUpdateFailed(c *C) {
 	c.Check(s.restartRequests, HasLen, 0)
 }
 
+func (s *deviceMgrGadgetSuite) mockLayoutEvolution(c *C) *gadget.VolumeLayoutEvolution {
+	vs := &gadget.VolumeStructure{Name: "foo", Size: 20 * quantity.SizeMiB}
+	return &gadget.VolumeLayoutEvolution{
+		Volume: &gadget.Volume{Name: "pc"},
+		Disk:   &gadget.OnDiskVolume{Device: "/dev/sda"},
+		Changes: []gadget.LayoutChange{{
+			Kind:            gadget.LayoutChangeGrow,
+			GadgetStructure: vs,
+			DiskStructure: &gadget.OnDiskStructure{
+				Name:        "foo",
+				Node:        "/dev/sda3",
+				DiskIndex:   3,
+				StartOffset: quantity.OffsetMiB,
+				Size:        20 * quantity.SizeMiB,
+			},
+			OldSize: 10 * quantity.SizeMiB,
+		}},
+	}
+}
+
+func (s *deviceMgrGadgetSuite) TestUpdateGadgetOnCoreLayoutChange(c *C) {
+	var calls []string
+	evo := s.mockLayoutEvolution(c)
+	restore := devicestate.MockGadgetLayoutEvolutionsForUpdate(func(model gadget.Model, current, update gadget.GadgetData, savedDisks map[string]*gadget.OnDiskVolume) ([]*gadget.VolumeLayoutEvolution, error) {
+		calls = append(calls, "plan")
+		c.Check(current.RootDir, Equals, filepath.Join(dirs.SnapMountDir, "foo-gadget/33"))
+		c.Check(update.RootDir, Equals, filepath.Join(dirs.SnapMountDir, "foo-gadget/34"))
+		c.Check(savedDisks, IsNil)
+		return []*gadget.VolumeLayoutEvolution{evo}, nil
+	})
+	defer restore()
+	var chg *state.Change
+	var t *state.Task
+	restore = devicestate.MockInstallEvolveVolumeLayout(func(e *gadget.VolumeLayoutEvolution, opts *install.EvolveOptions) error {
+		calls = append(calls, "evolve")
+		c.Check(e, Equals, evo)
+		c.Check(opts.GadgetRootDir, Equals, filepath.Join(dirs.SnapMountDir, "foo-gadget/34"))
+		c.Check(opts.Done, HasLen, 0)
+
+		// the state is not locked while the disk is changed, and the
+		// planned changes are already visible
+		s.state.Lock()
+		c.Assert(t.Log(), HasLen, 1)
+		c.Check(t.Log()[0], Matches, `(?s).* INFO Changing partition layout of volume pc on /dev/sda:
+- grow partition 3 \("foo"\) from 10 MiB to 20 MiB`)
+		var savedDisks map[string]*gadget.OnDiskVolume
+		c.Check(s.state.Get("gadget-layout-disks", &savedDisks), IsNil)
+		c.Check(savedDisks, DeepEquals, map[string]*gadget.OnDiskVolume{"pc": evo.Disk})
+		s.state.Unlock()
+
+		c.Assert(opts.Progress("grow-partition-3"), IsNil)
+		s.state.Lock()
+		var done map[string][]string
+		c.Check(t.Get("gadget-layout-done", &done), IsNil)
+		c.Check(done, DeepEquals, map[string][]string{"pc": {"grow-partition-3"}})
+		s.state.Unlock()
+		return nil
+	})
+	defer restore()
+	restore = devicestate.MockGadgetUpdate(func(model gadget.Model, current, update gadget.GadgetData, path string, policy gadget.UpdatePolicyFunc, _ gadget.ContentUpdateObserver) error {
+		calls = append(calls, "update")
+		return gadget.ErrNoUpdate
+	})
+	defer restore()
+
+	isClassic := false
+	chg, t = s.setupGadgetUpdate(c, "", gadgetYaml, "", isClassic)
+
+	s.state.Lock()
+	s.state.Set("seeded", true)
+	s.state.Unlock()
+
+	s.settle(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Assert(chg.IsReady(), Equals, true)
+	c.Check(chg.Err(), IsNil)
+	c.Check(t.Status(), Equals, state.DoneStatus)
+	// the layout is changed before updating the assets
+	c.Check(calls, DeepEquals, []string{"plan", "evolve", "update"})
+	c.Assert(t.Log(), HasLen, 2)
+	// the saved disks are dropped once the layout is changed
+	var savedDisks map[string]*gadget.OnDiskVolume
+	c.Check(s.state.Get("gadget-layout-disks", &savedDisks), testutil.ErrorIs, state.ErrNoState)
+}
+
+func (s *deviceMgrGadgetSuite) TestUpdateGadgetOnCoreLayoutChangeFailed(c *C) {
+	evo := s.mockLayoutEvolution(c)
+	restore := devicestate.MockGadgetLayoutEvolutionsForUpdate(func(model gadget.Model, current, update gadget.GadgetData, savedDisks map[string]*gadget.OnDiskVolume) ([]*gadget.VolumeLayoutEvolution, error) {
+		return []*gadget.VolumeLayoutEvolution{evo}, nil
+	})
+	defer restore()
+	restore = devicestate.MockInstallEvolveVolumeLayout(func(e *gadget.VolumeLayoutEvolution, opts *install.EvolveOptions) error {
+		c.Assert(opts.Progress("grow-partition-3"), IsNil)
+		return errors.New("boom")
+	})
+	defer restore()
+	restore = devicestate.MockGadgetUpdate(func(model gadget.Model, current, update gadget.GadgetData, path string, policy gadget.UpdatePolicyFunc, _ gadget.ContentUpdateObserver) error {
+		return errors.New("unexpected call")
+	})
+	defer restore()
+
+	isClassic := false
+	chg, t := s.setupGadgetUpdate(c, "", gadgetYaml, "", isClassic)
+
+	s.state.Lock()
+	s.state.Set("seeded", true)
+	s.state.Unlock()
+
+	s.settle(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Assert(chg.IsReady(), Equals, true)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*update gadget \(cannot change partition layout of volume pc: boom\).*`)
+	c.Check(t.Status(), Equals, state.ErrorStatus)
+	c.Check(s.restartRequests, HasLen, 0)
+
+	// the progress and the disks before the changes are kept for a retry
+	var done map[string][]string
+	c.Check(t.Get("gadget-layout-done", &done), IsNil)
+	c.Check(done, DeepEquals, map[string][]string{"pc": {"grow-partition-3"}})
+	var savedDisks map[string]*gadget.OnDiskVolume
+	c.Check(s.state.Get("gadget-layout-disks", &savedDisks), IsNil)
+	c.Check(savedDisks, DeepEquals, map[string]*gadget.OnDiskVolume{"pc": evo.Disk})
+}
+
+func (s *deviceMgrGadgetSuite) TestUpdateGadgetOnCoreLayoutChangeRetry(c *C) {
+	evo := s.mockLayoutEvolution(c)
+	saved := map[string]*gadget.OnDiskVolume{"pc": evo.Disk}
+	restore := devicestate.MockGadgetLayoutEvolutionsForUpdate(func(model gadget.Model, current, update gadget.GadgetData, savedDisks map[string]*gadget.OnDiskVolume) ([]*gadget.VolumeLayoutEvolution, error) {
+		// the changes are planned from the disks saved by the
+		// failed attempt
+		c.Check(savedDisks, DeepEquals, saved)
+		return []*gadget.VolumeLayoutEvolution{evo}, nil
+	})
+	defer restore()
+	restore = devicestate.MockInstallEvolveVolumeLayout(func(e *gadget.VolumeLayoutEvolution, opts *install.EvolveOptions) error {
+		c.Check(opts.Done, DeepEquals, []string{"grow-partition-3"})
+		return nil
+	})
+	defer restore()
+	restore = devicestate.MockGadgetUpdate(func(model gadget.Model, current, update gadget.GadgetData, path string, policy gadget.UpdatePolicyFunc, _ gadget.ContentUpdateObserver) error {
+		return gadget.ErrNoUpdate
+	})
+	defer restore()
+
+	isClassic := false
+	chg, t := s.setupGadgetUpdate(c, "", gadgetYaml, "", isClassic)
+
+	s.state.Lock()
+	s.state.Set("seeded", true)
+	s.state.Set("gadget-layout-disks", saved)
+	// as if the task was interrupted after growing the partition
+	t.Set("gadget-layout-done", map[string][]string{"pc": {"grow-partition-3"}})
+	s.state.Unlock()
+
+	s.settle(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Assert(chg.IsReady(), Equals, true)
+	c.Check(chg.Err(), IsNil)
+	var savedDisks map[string]*gadget.OnDiskVolume
+	c.Check(s.state.Get("gadget-layout-disks", &savedDisks), testutil.ErrorIs, state.ErrNoState)
+}
+
+func (s *deviceMgrGadgetSuite) TestUpdateGadgetOnCoreLayoutAlreadyChanged(c *C) {
+	restore := devicestate.MockGadgetLayoutEvolutionsForUpdate(func(model gadget.Model, current, update gadget.GadgetData, savedDisks map[string]*gadget.OnDiskVolume) ([]*gadget.VolumeLayoutEvolution, error) {
+		return nil, nil
+	})
+	defer restore()
+	restore = devicestate.MockInstallEvolveVolumeLayout(func(e *gadget.VolumeLayoutEvolution, opts *install.EvolveOptions) error {
+		return errors.New("unexpected call")
+	})
+	defer restore()
+	restore = devicestate.MockGadgetUpdate(func(model gadget.Model, current, update gadget.GadgetData, path string, policy gadget.UpdatePolicyFunc, _ gadget.ContentUpdateObserver) error {
+		return gadget.ErrNoUpdate
+	})
+	defer restore()
+
+	isClassic := false
+	chg, _ := s.setupGadgetUpdate(c, "", gadgetYaml, "", isClassic)
+
+	s.state.Lock()
+	s.state.Set("seeded", true)
+	// left by a previous attempt which changed the layout before failing
+	s.state.Set("gadget-layout-disks", map[string]*gadget.OnDiskVolume{"pc": {Device: "/dev/sda"}})
+	s.state.Unlock()
+
+	s.settle(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Assert(chg.IsReady(), Equals, true)
+	c.Check(chg.Err(), IsNil)
+	var savedDisks map[string]*gadget.OnDiskVolume
+	c.Check(s.state.Get("gadget-layout-disks", &savedDisks), testutil.ErrorIs, state.ErrNoState)
+}
+
 func (s *deviceMgrGadgetSuite) TestUpdateGadgetOnCoreNotDuringFirstboot(c *C) {
 	restore := devicestate.MockGadgetUpdate(func(model gadget.Model, current, update gadget.GadgetData, path string, policy gadget.UpdatePolicyFunc, _ gadget.ContentUpdateObserver) error {
 		return errors.New("unexpected call")
@@ -1706,6 +1706,27 @@ func (s *deviceMgrSerialSuite) TestStoreContextBackendStoreAccess(c *C) {
 	c.Check(offline, Equals, true)
 }
 
+func (s *deviceMgrSerialSuite) TestStoreContextBackendStoreMirror(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	scb := s.mgr.StoreContextBackend()
+
+	// nothing in the state
+	_, err := scb.StoreMirror()
+	c.Check(err, testutil.ErrorIs, state.ErrNoState)
+
+	// set the store mirror
+	tr := config.NewTransaction(s.state)
+	err = tr.Set("core", "store.mirror", "http://mirror.lan:8080")
+	tr.Commit()
+	c.Assert(err, IsNil)
+
+	mirror, err := scb.StoreMirror()
+	c.Check(err, IsNil)
+	c.Check(mirror.String(), Equals, "http://mirror.lan:8080")
+}
+
 func (s *deviceMgrSerialSuite) TestInitialRegistrationContext(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
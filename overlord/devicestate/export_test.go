@@ -343,6 +343,18 @@ func MockGadgetUpdate(mock func(model gadget.Model, current, update gadget.Gadge
 	}
 }
 
+func MockGadgetLayoutEvolutionsForUpdate(mock func(model gadget.Model, current, update gadget.GadgetData, savedDisks map[string]*gadget.OnDiskVolume) ([]*gadget.VolumeLayoutEvolution, error)) (restore func()) {
+	r := testutil.Backup(&gadgetLayoutEvolutionsForUpdate)
+	gadgetLayoutEvolutionsForUpdate = mock
+	return r
+}
+
+func MockInstallEvolveVolumeLayout(mock func(evo *gadget.VolumeLayoutEvolution, opts *install.EvolveOptions) error) (restore func()) {
+	r := testutil.Backup(&installEvolveVolumeLayout)
+	installEvolveVolumeLayout = mock
+	return r
+}
+
 func MockGadgetIsCompatible(mock func(current, update *gadget.Info) error) (restore func()) {
 	old := gadgetIsCompatible
 	gadgetIsCompatible = mock
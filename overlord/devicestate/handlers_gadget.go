@@ -30,6 +30,7 @@ import (
 	"github.com/snapcore/snapd/boot"
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/gadget"
+	"github.com/snapcore/snapd/gadget/install"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/configstate/config"
@@ -83,8 +84,86 @@ func pendingGadgetData(snapsup *snapstate.SnapSetup, pendingDeviceCtx snapstate.
 
 var (
 	gadgetUpdate = gadget.Update
+
+	gadgetLayoutEvolutionsForUpdate = gadget.LayoutEvolutionsForUpdate
+	installEvolveVolumeLayout       = install.EvolveVolumeLayout
 )
 
+// updateGadgetLayout grows the last partition and creates the new partitions
+// of the gadget volumes, as required by the new gadget, before its assets are
+// updated. Like asset updates, changes to the partition layout are not undone,
+// instead the disks as they were before the changes are saved in the state and
+// the steps done are recorded in the task, so that the changes can be resumed
+// after an interruption or retried by another gadget update after a failure.
+//
+// It must be called with the state locked, the lock is released while the
+// disks are modified.
+func updateGadgetLayout(t *state.Task, model gadget.Model, current, update *gadget.GadgetData) error {
+	st := t.State()
+
+	var savedDisks map[string]*gadget.OnDiskVolume
+	if err := st.Get("gadget-layout-disks", &savedDisks); err != nil && !errors.Is(err, state.ErrNoState) {
+		return err
+	}
+	evolutions, err := gadgetLayoutEvolutionsForUpdate(model, *current, *update, savedDisks)
+	if err != nil {
+		return err
+	}
+	if len(evolutions) == 0 {
+		// the layout is up to date, possibly thanks to a previous attempt
+		st.Set("gadget-layout-disks", nil)
+		return nil
+	}
+
+	var done map[string][]string
+	if err := t.Get("gadget-layout-done", &done); err != nil && !errors.Is(err, state.ErrNoState) {
+		return err
+	}
+	if done == nil {
+		done = make(map[string][]string)
+	}
+	if savedDisks == nil {
+		savedDisks = make(map[string]*gadget.OnDiskVolume)
+	}
+	for _, evo := range evolutions {
+		savedDisks[evo.Volume.Name] = evo.Disk
+		t.Logf("Changing partition layout of %s", evo)
+	}
+	st.Set("gadget-layout-disks", savedDisks)
+
+	// releasing the lock makes the planned changes visible on the change
+	// before they are applied
+	err = func() error {
+		st.Unlock()
+		defer st.Lock()
+
+		for _, evo := range evolutions {
+			volName := evo.Volume.Name
+			opts := &install.EvolveOptions{
+				GadgetRootDir: update.RootDir,
+				KernelRootDir: update.KernelRootDir,
+				Done:          done[volName],
+				Progress: func(step string) error {
+					st.Lock()
+					defer st.Unlock()
+					done[volName] = append(done[volName], step)
+					t.Set("gadget-layout-done", done)
+					return nil
+				},
+			}
+			if err := installEvolveVolumeLayout(evo, opts); err != nil {
+				return fmt.Errorf("cannot change partition layout of volume %s: %v", volName, err)
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		return err
+	}
+	st.Set("gadget-layout-disks", nil)
+	return nil
+}
+
 func setGadgetRestartRequired(t *state.Task) {
 	chg := t.Change()
 	chg.Set("gadget-restart-required", true)
@@ -175,6 +254,13 @@ func (m *DeviceManager) doUpdateGadgetAssets(t *state.Task, _ *tomb.Tomb) error
 		updateData.KernelRootDir = updateKernelInfo.MountDir()
 	}
 
+	// only gadget updates can change the partition layout
+	if snapsup.Type == snap.TypeGadget {
+		if err := updateGadgetLayout(t, model, currentData, updateData); err != nil {
+			return err
+		}
+	}
+
 	snapRollbackDir, err := makeRollbackDir(fmt.Sprintf("%v_%v", snapsup.InstanceName(), snapsup.SideInfo.Revision))
 	if err != nil {
 		return fmt.Errorf("cannot prepare update rollback directory: %v", err)
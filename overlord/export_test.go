@@ -116,3 +116,19 @@ func MockSystemdSdNotify(f func(notifyState string) error) (restore func()) {
 		systemdSdNotify = old
 	}
 }
+
+// NewJournalStateBackend returns a journaling state backend for tests.
+func NewJournalStateBackend(path, journalPath string) state.JournalBackend {
+	return newJournalStateBackend(path, journalPath, func(time.Duration) {})
+}
+
+// NewStateBackend returns the plain state backend for tests.
+func NewStateBackend(path string) state.Backend {
+	return &overlordStateBackend{path: path, ensureBefore: func(time.Duration) {}}
+}
+
+// MockMinStateJournalCompactSize sets the size up to which the state journal
+// is not compacted.
+func MockMinStateJournalCompactSize(size int64) (restore func()) {
+	return testutil.Mock(&minStateJournalCompactSize, size)
+}
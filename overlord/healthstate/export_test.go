@@ -20,7 +20,12 @@
 package healthstate
 
 import (
+	"context"
 	"time"
+
+	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
 )
 
 func MockCheckTimeout(t time.Duration) (restore func()) {
@@ -32,3 +37,27 @@ func MockCheckTimeout(t time.Duration) (restore func()) {
 }
 
 var KnownStatuses = knownStatuses
+
+func MockTimeNow(f func() time.Time) (restore func()) {
+	old := timeNow
+	timeNow = f
+	return func() {
+		timeNow = old
+	}
+}
+
+func MockSnapstateRevert(f func(st *state.State, name string, flags snapstate.Flags, fromChange string) (*state.TaskSet, error)) (restore func()) {
+	old := snapstateRevert
+	snapstateRevert = f
+	return func() {
+		snapstateRevert = old
+	}
+}
+
+func MockRunCheckHook(f func(hookMgr *hookstate.HookManager, ctx context.Context, hooksup *hookstate.HookSetup) error) (restore func()) {
+	old := runCheckHook
+	runCheckHook = f
+	return func() {
+		runCheckHook = old
+	}
+}
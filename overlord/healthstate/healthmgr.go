@@ -0,0 +1,368 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package healthstate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+var (
+	timeNow = time.Now
+
+	snapstateRevert = snapstate.Revert
+
+	runCheckHook = func(hookMgr *hookstate.HookManager, ctx context.Context, hooksup *hookstate.HookSetup) error {
+		_, err := hookMgr.EphemeralRunHook(ctx, hooksup, nil)
+		return err
+	}
+)
+
+// HealthManager runs the check-health hook of the snaps that declare an
+// interval for it, and reverts the refreshes of snaps that stay in error
+// after being refreshed, if configured to do so with
+// health.auto-revert-after.
+type HealthManager struct {
+	state   *state.State
+	hookMgr *hookstate.HookManager
+
+	// lastCheck is when a periodic health check was last started for
+	// each snap
+	lastCheck map[string]time.Time
+	// intervals caches the check-health hook interval of the current
+	// revision of each snap, so that the snap info is only read again
+	// once the snap changes revision
+	intervals map[string]checkInterval
+	// running tracks the snaps whose periodic health check is running
+	running map[string]bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type checkInterval struct {
+	revision snap.Revision
+	interval time.Duration
+}
+
+// Manager returns a new HealthManager.
+func Manager(st *state.State, hookMgr *hookstate.HookManager) *HealthManager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &HealthManager{
+		state:     st,
+		hookMgr:   hookMgr,
+		lastCheck: make(map[string]time.Time),
+		intervals: make(map[string]checkInterval),
+		running:   make(map[string]bool),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// Wait implements StateWaiter.Wait.
+func (m *HealthManager) Wait() {
+	m.wg.Wait()
+}
+
+// Stop implements StateStopper.Stop. It cancels the running health checks.
+func (m *HealthManager) Stop() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// Ensure implements StateManager.Ensure.
+func (m *HealthManager) Ensure() error {
+	m.state.Lock()
+	defer m.state.Unlock()
+
+	var seeded bool
+	if err := m.state.Get("seeded", &seeded); err != nil && !errors.Is(err, state.ErrNoState) {
+		return err
+	}
+	if !seeded {
+		return nil
+	}
+
+	snapStates, err := snapstate.All(m.state)
+	if err != nil {
+		return err
+	}
+	healths, err := All(m.state)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(snapStates))
+	for name := range snapStates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if err := pruneAutoReverted(m.state, snapStates); err != nil {
+		return err
+	}
+
+	now := timeNow()
+	var next time.Time
+	scheduleNext := func(t time.Time) {
+		if next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+	for _, name := range names {
+		snapst := snapStates[name]
+		if !snapst.Active {
+			continue
+		}
+		health := healths[name]
+		if health != nil && health.Revision != snapst.Current {
+			// the health was reported by a previous revision
+			health = nil
+		}
+		if t := m.ensurePeriodicCheck(name, snapst, health, now); !t.IsZero() {
+			scheduleNext(t)
+		}
+		t, err := m.ensureAutoRevert(name, snapst, health, now)
+		if err != nil {
+			logger.Noticef("cannot revert unhealthy snap %q: %v", name, err)
+		}
+		if !t.IsZero() {
+			scheduleNext(t)
+		}
+	}
+	if !next.IsZero() {
+		m.state.EnsureBefore(next.Sub(now))
+	}
+	return nil
+}
+
+// ensurePeriodicCheck starts a health check of the snap if its
+// check-health hook has an interval and the snap did not report its health
+// for that long. It returns when the next check is due, if any.
+//
+// The check-health hook runs in the background, outside of any change, so
+// that periodic checks don't accumulate changes.
+func (m *HealthManager) ensurePeriodicCheck(name string, snapst *snapstate.SnapState, health *HealthState, now time.Time) time.Time {
+	interval := m.checkInterval(name, snapst)
+	if interval == 0 {
+		return time.Time{}
+	}
+
+	last := m.lastCheck[name]
+	if health != nil && health.Timestamp.After(last) {
+		last = health.Timestamp
+	}
+	if due := last.Add(interval); now.Before(due) {
+		return due
+	}
+	if m.running[name] {
+		// the next check is scheduled once this one is over
+		return time.Time{}
+	}
+	if err := snapstate.CheckChangeConflict(m.state, name, nil); err != nil {
+		// try again in a later ensure, once the snap is not being
+		// operated on
+		return time.Time{}
+	}
+
+	m.running[name] = true
+	m.lastCheck[name] = now
+	m.wg.Add(1)
+	go m.runCheck(hookSetup(name, snapst.Current))
+	return now.Add(interval)
+}
+
+// checkInterval returns the interval of the check-health hook of the
+// current revision of the snap, or zero if the hook has none.
+func (m *HealthManager) checkInterval(name string, snapst *snapstate.SnapState) time.Duration {
+	if cached, ok := m.intervals[name]; ok && cached.revision == snapst.Current {
+		return cached.interval
+	}
+
+	info, err := snapst.CurrentInfo()
+	if err != nil {
+		return 0
+	}
+	var interval time.Duration
+	if hook := info.Hooks["check-health"]; hook != nil {
+		interval = time.Duration(hook.Interval)
+	}
+	m.intervals[name] = checkInterval{revision: snapst.Current, interval: interval}
+	return interval
+}
+
+func (m *HealthManager) runCheck(hooksup *hookstate.HookSetup) {
+	defer m.wg.Done()
+
+	// the health reported by the hook is saved by its handler
+	if err := runCheckHook(m.hookMgr, m.ctx, hooksup); err != nil {
+		logger.Noticef("cannot run periodic health check of snap %q: %v", hooksup.Snap, err)
+	}
+
+	m.state.Lock()
+	defer m.state.Unlock()
+	delete(m.running, hooksup.Snap)
+}
+
+// autoRevertAfter returns how long a snap can stay in error after being
+// refreshed before the refresh is reverted, or zero if it never is.
+func autoRevertAfter(st *state.State) time.Duration {
+	var after string
+	err := config.NewTransaction(st).Get("core", "health.auto-revert-after", &after)
+	if err != nil {
+		if !config.IsNoOption(err) {
+			logger.Noticef("internal error: health.auto-revert-after system option is not valid: %v", err)
+		}
+		return 0
+	}
+	if after == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(after)
+	if err != nil {
+		logger.Noticef("internal error: health.auto-revert-after system option is not valid: %v", err)
+		return 0
+	}
+	return d
+}
+
+// errorSince returns since when the snap has been continuously in error
+// according to its health history.
+func errorSince(st *state.State, name string, health *HealthState) (time.Time, error) {
+	since := health.Timestamp
+	history, err := History(st, name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		h := history[i]
+		if h.Status != ErrorStatus || h.Revision != health.Revision {
+			break
+		}
+		since = h.Timestamp
+	}
+	return since, nil
+}
+
+// autoReverted returns the last refresh time of each snap whose refresh was
+// reverted because of failed health checks.
+func autoReverted(st *state.State) (map[string]time.Time, error) {
+	var reverted map[string]time.Time
+	if err := st.Get("health-auto-reverted", &reverted); err != nil && !errors.Is(err, state.ErrNoState) {
+		return nil, err
+	}
+	return reverted, nil
+}
+
+// pruneAutoReverted forgets about the reverts of snaps which are no longer
+// installed.
+func pruneAutoReverted(st *state.State, snapStates map[string]*snapstate.SnapState) error {
+	reverted, err := autoReverted(st)
+	if err != nil {
+		return err
+	}
+	pruned := false
+	for name := range reverted {
+		if _, ok := snapStates[name]; !ok {
+			delete(reverted, name)
+			pruned = true
+		}
+	}
+	if pruned {
+		if len(reverted) == 0 {
+			st.Set("health-auto-reverted", nil)
+		} else {
+			st.Set("health-auto-reverted", reverted)
+		}
+	}
+	return nil
+}
+
+// ensureAutoRevert reverts the last refresh of the snap if it went into
+// error within the configured period after the refresh and stayed in error
+// for that long. A refresh is reverted only once, the revision it reverts to
+// is not reverted in turn until the snap is refreshed again. It returns when
+// the revert is due, if it is pending.
+func (m *HealthManager) ensureAutoRevert(name string, snapst *snapstate.SnapState, health *HealthState, now time.Time) (time.Time, error) {
+	if health == nil || health.Status != ErrorStatus || snapst.LastRefreshTime == nil {
+		return time.Time{}, nil
+	}
+	if snapst.LastIndex(snapst.Current) < 1 {
+		// nothing to revert to
+		return time.Time{}, nil
+	}
+	after := autoRevertAfter(m.state)
+	if after == 0 {
+		return time.Time{}, nil
+	}
+	reverted, err := autoReverted(m.state)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if t, ok := reverted[name]; ok && t.Equal(*snapst.LastRefreshTime) {
+		// this refresh was already reverted
+		return time.Time{}, nil
+	}
+	since, err := errorSince(m.state, name, health)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if since.Sub(*snapst.LastRefreshTime) > after {
+		// the snap was healthy for long enough after the refresh
+		return time.Time{}, nil
+	}
+	if due := since.Add(after); now.Before(due) {
+		return due, nil
+	}
+	if err := snapstate.CheckChangeConflict(m.state, name, nil); err != nil {
+		// try again in a later ensure, once the snap is not being
+		// operated on
+		return time.Time{}, nil
+	}
+
+	ts, err := snapstateRevert(m.state, name, snapstate.Flags{}, "")
+	if err != nil {
+		return time.Time{}, err
+	}
+	logger.Noticef("Reverting snap %q, in error since %s after being refreshed", name, since.Format(time.RFC3339))
+	chg := m.state.NewChange("revert-snap", fmt.Sprintf("Revert %q snap after failed health checks", name))
+	chg.AddAll(ts)
+	chg.Set("snap-names", []string{name})
+
+	// a revert doesn't change the last refresh time, which identifies
+	// the reverted refresh
+	if reverted == nil {
+		reverted = make(map[string]time.Time)
+	}
+	reverted[name] = *snapst.LastRefreshTime
+	m.state.Set("health-auto-reverted", reverted)
+	return time.Time{}, nil
+}
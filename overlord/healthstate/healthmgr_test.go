@@ -0,0 +1,449 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package healthstate_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/healthstate"
+	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/snapstate/snapstatetest"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/testutil"
+)
+
+func (s *healthSuite) setHealth(c *check.C, snapName string, health *healthstate.HealthState) {
+	ctx, err := hookstate.NewContext(nil, s.state, &hookstate.HookSetup{Snap: snapName}, nil, "")
+	c.Assert(err, check.IsNil)
+	ctx.Lock()
+	defer ctx.Unlock()
+	ctx.Set("health", health)
+	c.Assert(healthstate.SetFromHookContext(ctx), check.IsNil)
+}
+
+func (s *healthSuite) healthNotices() []*state.Notice {
+	s.state.Lock()
+	defer s.state.Unlock()
+	return s.state.Notices(&state.NoticeFilter{Types: []state.NoticeType{state.SnapHealthNotice}})
+}
+
+func noticeToMap(c *check.C, notice *state.Notice) map[string]interface{} {
+	buf, err := json.Marshal(notice)
+	c.Assert(err, check.IsNil)
+	var n map[string]interface{}
+	c.Assert(json.Unmarshal(buf, &n), check.IsNil)
+	return n
+}
+
+func (s *healthSuite) TestHealthHistoryAndNotices(c *check.C) {
+	t0 := time.Now()
+	s.setHealth(c, "test-snap", &healthstate.HealthState{Revision: snap.R(42), Timestamp: t0, Status: healthstate.OkayStatus})
+	// no transition
+	s.setHealth(c, "test-snap", &healthstate.HealthState{Revision: snap.R(42), Timestamp: t0.Add(time.Minute), Status: healthstate.OkayStatus})
+	s.setHealth(c, "test-snap", &healthstate.HealthState{Revision: snap.R(42), Timestamp: t0.Add(2 * time.Minute), Status: healthstate.ErrorStatus, Code: "some-code", Message: "something failed"})
+
+	s.state.Lock()
+	history, err := healthstate.History(s.state, "test-snap")
+	s.state.Unlock()
+	c.Assert(err, check.IsNil)
+	c.Assert(history, check.HasLen, 2)
+	c.Check(history[0].Status, check.Equals, healthstate.OkayStatus)
+	c.Check(history[0].Timestamp.Equal(t0), check.Equals, true)
+	c.Check(history[1].Status, check.Equals, healthstate.ErrorStatus)
+	c.Check(history[1].Code, check.Equals, "some-code")
+
+	notices := s.healthNotices()
+	c.Assert(notices, check.HasLen, 1)
+	n := noticeToMap(c, notices[0])
+	c.Check(n["key"], check.Equals, "test-snap")
+	c.Check(n["occurrences"], check.Equals, 2.0)
+	c.Check(n["last-data"], check.DeepEquals, map[string]interface{}{
+		"status":          "error",
+		"previous-status": "okay",
+		"revision":        "42",
+		"code":            "some-code",
+	})
+}
+
+func (s *healthSuite) TestHealthHistoryIsBounded(c *check.C) {
+	t0 := time.Now()
+	for i := 0; i < 30; i++ {
+		status := healthstate.OkayStatus
+		if i%2 == 1 {
+			status = healthstate.WaitingStatus
+		}
+		s.setHealth(c, "test-snap", &healthstate.HealthState{Revision: snap.R(42), Timestamp: t0.Add(time.Duration(i) * time.Minute), Status: status})
+	}
+
+	s.state.Lock()
+	history, err := healthstate.History(s.state, "test-snap")
+	s.state.Unlock()
+	c.Assert(err, check.IsNil)
+	c.Assert(history, check.HasLen, 20)
+	c.Check(history[19].Timestamp.Equal(t0.Add(29*time.Minute)), check.Equals, true)
+}
+
+func (s *healthSuite) setupPeriodicSnap(c *check.C, snapYaml string) {
+	s.state.Lock()
+	s.state.Set("seeded", true)
+	sideInfo := &snap.SideInfo{RealName: "periodic-snap", Revision: snap.R(7)}
+	snapstate.Set(s.state, "periodic-snap", &snapstate.SnapState{
+		Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{sideInfo}),
+		Current:  snap.R(7),
+		Active:   true,
+		SnapType: "app",
+	})
+	s.state.Unlock()
+	snaptest.MockSnapCurrent(c, snapYaml, sideInfo)
+}
+
+// mockCheckHook mocks running the check-health hook, the hook runs until
+// the returned channel is written to.
+func (s *healthSuite) mockCheckHook(c *check.C) (ran chan *hookstate.HookSetup, done chan error) {
+	ran = make(chan *hookstate.HookSetup, 10)
+	done = make(chan error)
+	restore := healthstate.MockRunCheckHook(func(hookMgr *hookstate.HookManager, ctx context.Context, hooksup *hookstate.HookSetup) error {
+		ran <- hooksup
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	s.AddCleanup(restore)
+	return ran, done
+}
+
+const periodicSnapYaml = `name: periodic-snap
+version: v1
+hooks:
+ check-health:
+  interval: 10m
+`
+
+func (s *healthSuite) TestEnsurePeriodicCheck(c *check.C) {
+	now := time.Now()
+	restore := healthstate.MockTimeNow(func() time.Time { return now })
+	defer restore()
+	logbuf, restore := logger.MockLogger()
+	defer restore()
+	ran, done := s.mockCheckHook(c)
+	s.setupPeriodicSnap(c, periodicSnapYaml)
+
+	m := healthstate.Manager(s.state, nil)
+	defer m.Stop()
+
+	// no health was reported yet
+	c.Assert(m.Ensure(), check.IsNil)
+	hooksup := <-ran
+	c.Check(hooksup.Snap, check.Equals, "periodic-snap")
+	c.Check(hooksup.Hook, check.Equals, "check-health")
+	c.Check(hooksup.Revision, check.Equals, snap.R(7))
+	c.Check(hooksup.Optional, check.Equals, true)
+
+	// the check runs outside of any change
+	s.state.Lock()
+	c.Check(s.state.Changes(), check.HasLen, 0)
+	s.state.Unlock()
+
+	// the check is not repeated before the interval
+	now = now.Add(5 * time.Minute)
+	c.Assert(m.Ensure(), check.IsNil)
+	c.Check(ran, check.HasLen, 0)
+
+	// the health reported by the snap delays the next check
+	s.setHealth(c, "periodic-snap", &healthstate.HealthState{Revision: snap.R(7), Timestamp: now, Status: healthstate.OkayStatus})
+	now = now.Add(9 * time.Minute)
+	c.Assert(m.Ensure(), check.IsNil)
+	c.Check(ran, check.HasLen, 0)
+
+	// the check is not repeated while the previous one is still running
+	now = now.Add(time.Minute)
+	c.Assert(m.Ensure(), check.IsNil)
+	c.Check(ran, check.HasLen, 0)
+
+	// a failing check is logged
+	done <- errors.New("boom")
+	m.Wait()
+	c.Check(logbuf.String(), testutil.Contains, `cannot run periodic health check of snap "periodic-snap": boom`)
+
+	c.Assert(m.Ensure(), check.IsNil)
+	hooksup = <-ran
+	c.Check(hooksup.Snap, check.Equals, "periodic-snap")
+}
+
+func (s *healthSuite) TestEnsurePeriodicCheckCachesInterval(c *check.C) {
+	now := time.Now()
+	restore := healthstate.MockTimeNow(func() time.Time { return now })
+	defer restore()
+	ran, done := s.mockCheckHook(c)
+	s.setupPeriodicSnap(c, periodicSnapYaml)
+
+	m := healthstate.Manager(s.state, nil)
+	defer m.Stop()
+
+	c.Assert(m.Ensure(), check.IsNil)
+	<-ran
+	done <- nil
+	m.Wait()
+
+	// the snap info is not read again while the revision is the same
+	snaptest.MockSnap(c, "name: periodic-snap\nversion: v1\n", &snap.SideInfo{RealName: "periodic-snap", Revision: snap.R(7)})
+	now = now.Add(10 * time.Minute)
+	c.Assert(m.Ensure(), check.IsNil)
+	<-ran
+	done <- nil
+	m.Wait()
+
+	// but it is once the snap changes revision
+	sideInfo := &snap.SideInfo{RealName: "periodic-snap", Revision: snap.R(8)}
+	s.state.Lock()
+	snapstate.Set(s.state, "periodic-snap", &snapstate.SnapState{
+		Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{sideInfo}),
+		Current:  snap.R(8),
+		Active:   true,
+		SnapType: "app",
+	})
+	s.state.Unlock()
+	snaptest.MockSnap(c, "name: periodic-snap\nversion: v2\n", sideInfo)
+	now = now.Add(10 * time.Minute)
+	c.Assert(m.Ensure(), check.IsNil)
+	c.Check(ran, check.HasLen, 0)
+}
+
+func (s *healthSuite) TestStopCancelsPeriodicCheck(c *check.C) {
+	logbuf, restore := logger.MockLogger()
+	defer restore()
+	ran, _ := s.mockCheckHook(c)
+	s.setupPeriodicSnap(c, periodicSnapYaml)
+
+	m := healthstate.Manager(s.state, nil)
+	c.Assert(m.Ensure(), check.IsNil)
+	<-ran
+
+	// the hook returns once cancelled
+	m.Stop()
+	c.Check(logbuf.String(), testutil.Contains, `cannot run periodic health check of snap "periodic-snap": context canceled`)
+}
+
+func (s *healthSuite) TestEnsurePeriodicCheckNotSeeded(c *check.C) {
+	sideInfo := &snap.SideInfo{RealName: "periodic-snap", Revision: snap.R(7)}
+	s.state.Lock()
+	snapstate.Set(s.state, "periodic-snap", &snapstate.SnapState{
+		Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{sideInfo}),
+		Current:  snap.R(7),
+		Active:   true,
+		SnapType: "app",
+	})
+	s.state.Unlock()
+	snaptest.MockSnapCurrent(c, `name: periodic-snap
+version: v1
+hooks:
+ check-health:
+  interval: 10m
+`, sideInfo)
+
+	m := healthstate.Manager(s.state, nil)
+	c.Assert(m.Ensure(), check.IsNil)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Check(s.state.Changes(), check.HasLen, 0)
+}
+
+// setupRefreshedSnap sets up test-snap as refreshed from revision 41 to
+// revision 42 at the given time, with auto-revert configured.
+func (s *healthSuite) setupRefreshedSnap(c *check.C, refreshed time.Time, autoRevertAfter string) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	s.state.Set("seeded", true)
+	snapstate.Set(s.state, "test-snap", &snapstate.SnapState{
+		Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{
+			{RealName: "test-snap", Revision: snap.R(41)},
+			{RealName: "test-snap", Revision: snap.R(42)},
+		}),
+		Current:         snap.R(42),
+		Active:          true,
+		SnapType:        "app",
+		LastRefreshTime: &refreshed,
+	})
+	if autoRevertAfter != "" {
+		tr := config.NewTransaction(s.state)
+		c.Assert(tr.Set("core", "health.auto-revert-after", autoRevertAfter), check.IsNil)
+		tr.Commit()
+	}
+}
+
+func (s *healthSuite) mockRevert(c *check.C) *[]string {
+	var reverted []string
+	restore := healthstate.MockSnapstateRevert(func(st *state.State, name string, flags snapstate.Flags, fromChange string) (*state.TaskSet, error) {
+		reverted = append(reverted, name)
+		return state.NewTaskSet(st.NewTask("fake-revert", "...")), nil
+	})
+	s.AddCleanup(restore)
+	return &reverted
+}
+
+func (s *healthSuite) TestEnsureAutoRevert(c *check.C) {
+	refreshed := time.Now()
+	now := refreshed
+	restore := healthstate.MockTimeNow(func() time.Time { return now })
+	defer restore()
+	reverted := s.mockRevert(c)
+	s.setupRefreshedSnap(c, refreshed, "10m")
+
+	s.setHealth(c, "test-snap", &healthstate.HealthState{Revision: snap.R(42), Timestamp: refreshed.Add(time.Minute), Status: healthstate.ErrorStatus, Message: "something failed"})
+	s.setHealth(c, "test-snap", &healthstate.HealthState{Revision: snap.R(42), Timestamp: refreshed.Add(5 * time.Minute), Status: healthstate.ErrorStatus, Message: "still failing"})
+
+	m := healthstate.Manager(s.state, nil)
+	now = refreshed.Add(10 * time.Minute)
+	c.Assert(m.Ensure(), check.IsNil)
+	c.Check(*reverted, check.HasLen, 0)
+
+	// in error for 10m since the first error
+	now = refreshed.Add(11 * time.Minute)
+	c.Assert(m.Ensure(), check.IsNil)
+	c.Check(*reverted, check.DeepEquals, []string{"test-snap"})
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	chgs := s.state.Changes()
+	c.Assert(chgs, check.HasLen, 1)
+	c.Check(chgs[0].Kind(), check.Equals, "revert-snap")
+	c.Check(chgs[0].Summary(), check.Equals, `Revert "test-snap" snap after failed health checks`)
+	var snapNames []string
+	c.Assert(chgs[0].Get("snap-names", &snapNames), check.IsNil)
+	c.Check(snapNames, check.DeepEquals, []string{"test-snap"})
+}
+
+func (s *healthSuite) TestEnsureNoAutoRevert(c *check.C) {
+	refreshed := time.Now()
+	now := refreshed.Add(time.Hour)
+	restore := healthstate.MockTimeNow(func() time.Time { return now })
+	defer restore()
+	reverted := s.mockRevert(c)
+
+	for _, tc := range []struct {
+		autoRevertAfter string
+		health          *healthstate.HealthState
+	}{
+		// not configured
+		{"", &healthstate.HealthState{Revision: snap.R(42), Timestamp: refreshed, Status: healthstate.ErrorStatus}},
+		// disabled
+		{"0", &healthstate.HealthState{Revision: snap.R(42), Timestamp: refreshed, Status: healthstate.ErrorStatus}},
+		// not in error
+		{"10m", &healthstate.HealthState{Revision: snap.R(42), Timestamp: refreshed, Status: healthstate.BlockedStatus}},
+		// the error is from the previous revision
+		{"10m", &healthstate.HealthState{Revision: snap.R(41), Timestamp: refreshed, Status: healthstate.ErrorStatus}},
+		// healthy for long enough after the refresh
+		{"10m", &healthstate.HealthState{Revision: snap.R(42), Timestamp: refreshed.Add(30 * time.Minute), Status: healthstate.ErrorStatus}},
+	} {
+		s.setupRefreshedSnap(c, refreshed, tc.autoRevertAfter)
+		s.setHealth(c, "test-snap", tc.health)
+
+		m := healthstate.Manager(s.state, nil)
+		c.Assert(m.Ensure(), check.IsNil)
+		c.Check(*reverted, check.HasLen, 0, check.Commentf("%+v", tc))
+	}
+}
+
+func (s *healthSuite) TestEnsureAutoRevertOnlyOnce(c *check.C) {
+	refreshed := time.Now()
+	now := refreshed
+	restore := healthstate.MockTimeNow(func() time.Time { return now })
+	defer restore()
+	reverted := s.mockRevert(c)
+	s.setupRefreshedSnap(c, refreshed, "10m")
+	setCurrent := func(rev snap.Revision, refreshed time.Time) {
+		s.state.Lock()
+		defer s.state.Unlock()
+		snapstate.Set(s.state, "test-snap", &snapstate.SnapState{
+			Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{
+				{RealName: "test-snap", Revision: snap.R(40)},
+				{RealName: "test-snap", Revision: snap.R(41)},
+				{RealName: "test-snap", Revision: snap.R(42)},
+			}),
+			Current:         rev,
+			Active:          true,
+			SnapType:        "app",
+			LastRefreshTime: &refreshed,
+		})
+	}
+	setCurrent(snap.R(42), refreshed)
+
+	m := healthstate.Manager(s.state, nil)
+	s.setHealth(c, "test-snap", &healthstate.HealthState{Revision: snap.R(42), Timestamp: refreshed.Add(time.Minute), Status: healthstate.ErrorStatus})
+	now = refreshed.Add(12 * time.Minute)
+	c.Assert(m.Ensure(), check.IsNil)
+	c.Check(*reverted, check.DeepEquals, []string{"test-snap"})
+
+	// the revert doesn't change the last refresh time, the revision it
+	// reverted to is not reverted in turn if it fails as well
+	s.state.Lock()
+	for _, chg := range s.state.Changes() {
+		chg.SetStatus(state.DoneStatus)
+	}
+	s.state.Unlock()
+	setCurrent(snap.R(41), refreshed)
+	s.setHealth(c, "test-snap", &healthstate.HealthState{Revision: snap.R(41), Timestamp: refreshed.Add(13 * time.Minute), Status: healthstate.ErrorStatus})
+	// even if the error is now within the auto-revert period
+	s.state.Lock()
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("core", "health.auto-revert-after", "1h"), check.IsNil)
+	tr.Commit()
+	s.state.Unlock()
+	now = refreshed.Add(2 * time.Hour)
+	c.Assert(m.Ensure(), check.IsNil)
+	c.Check(*reverted, check.HasLen, 1)
+
+	// a new refresh can be reverted again
+	refreshed = now
+	setCurrent(snap.R(42), refreshed)
+	s.setHealth(c, "test-snap", &healthstate.HealthState{Revision: snap.R(42), Timestamp: refreshed.Add(time.Minute), Status: healthstate.ErrorStatus})
+	now = refreshed.Add(2 * time.Hour)
+	c.Assert(m.Ensure(), check.IsNil)
+	c.Check(*reverted, check.DeepEquals, []string{"test-snap", "test-snap"})
+}
+
+func (s *healthSuite) TestEnsureForgetsAutoRevertOfRemovedSnap(c *check.C) {
+	s.state.Lock()
+	s.state.Set("seeded", true)
+	s.state.Set("health-auto-reverted", map[string]time.Time{"gone-snap": time.Now()})
+	s.state.Unlock()
+
+	m := healthstate.Manager(s.state, nil)
+	c.Assert(m.Ensure(), check.IsNil)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	var reverted map[string]time.Time
+	c.Check(s.state.Get("health-auto-reverted", &reverted), testutil.ErrorIs, state.ErrNoState)
+}
@@ -37,6 +37,9 @@ import (
 
 var checkTimeout = 30 * time.Second
 
+// maxHealthHistory is the number of health transitions kept for each snap.
+const maxHealthHistory = 20
+
 func init() {
 	if s, ok := os.LookupEnv("SNAPD_CHECK_HEALTH_HOOK_TIMEOUT"); ok {
 		if to, err := time.ParseDuration(s); err == nil {
@@ -51,15 +54,17 @@ func init() {
 
 func Hook(st *state.State, snapName string, snapRev snap.Revision) *state.Task {
 	summary := fmt.Sprintf("Run health check of %q snap", snapName)
-	hooksup := &hookstate.HookSetup{
+	return hookstate.HookTask(st, summary, hookSetup(snapName, snapRev), nil)
+}
+
+func hookSetup(snapName string, snapRev snap.Revision) *hookstate.HookSetup {
+	return &hookstate.HookSetup{
 		Snap:     snapName,
 		Revision: snapRev,
 		Hook:     "check-health",
 		Optional: true,
 		Timeout:  checkTimeout,
 	}
-
-	return hookstate.HookTask(st, summary, hooksup, nil)
 }
 
 type HealthStatus int
@@ -166,6 +171,7 @@ func (h *healthHandler) appendHealth(health *HealthState) error {
 
 func appendHealth(ctx *hookstate.Context, health *HealthState) error {
 	st := ctx.State()
+	instanceName := ctx.InstanceName()
 
 	var hs map[string]*HealthState
 	if err := st.Get("health", &hs); err != nil {
@@ -174,10 +180,52 @@ func appendHealth(ctx *hookstate.Context, health *HealthState) error {
 		}
 		hs = map[string]*HealthState{}
 	}
-	hs[ctx.InstanceName()] = health
+	prev := hs[instanceName]
+	hs[instanceName] = health
 	st.Set("health", hs)
 
-	return nil
+	if prev != nil && prev.Status == health.Status && prev.Revision == health.Revision {
+		return nil
+	}
+	return recordHealthTransition(st, instanceName, prev, health)
+}
+
+// recordHealthTransition appends the new health of the snap to its health
+// history and, if its status changed, records a snap-health notice.
+func recordHealthTransition(st *state.State, instanceName string, prev, health *HealthState) error {
+	history, err := AllHistory(st)
+	if err != nil {
+		return err
+	}
+	if history == nil {
+		history = make(map[string][]*HealthState)
+	}
+	snapHistory := append(history[instanceName], health)
+	if len(snapHistory) > maxHealthHistory {
+		snapHistory = snapHistory[len(snapHistory)-maxHealthHistory:]
+	}
+	history[instanceName] = snapHistory
+	st.Set("health-history", history)
+
+	prevStatus := UnknownStatus
+	if prev != nil {
+		prevStatus = prev.Status
+	}
+	if prevStatus == health.Status {
+		return nil
+	}
+	data := map[string]string{
+		"status":          health.Status.String(),
+		"previous-status": prevStatus.String(),
+		"revision":        health.Revision.String(),
+	}
+	if health.Code != "" {
+		data["code"] = health.Code
+	}
+	_, err = st.AddNotice(nil, state.SnapHealthNotice, instanceName, &state.AddNoticeOptions{
+		Data: data,
+	})
+	return err
 }
 
 // SetFromHookContext extracts the health of a snap from a hook
@@ -225,3 +273,21 @@ func Get(st *state.State, snap string) (*HealthState, error) {
 
 	return &health, nil
 }
+
+// History returns the health transitions of the given snap, oldest first.
+func History(st *state.State, snap string) ([]*HealthState, error) {
+	history, err := AllHistory(st)
+	if err != nil {
+		return nil, err
+	}
+	return history[snap], nil
+}
+
+// AllHistory returns the health transitions of all the snaps, oldest first.
+func AllHistory(st *state.State) (map[string][]*HealthState, error) {
+	var history map[string][]*HealthState
+	if err := st.Get("health-history", &history); err != nil && !errors.Is(err, state.ErrNoState) {
+		return nil, err
+	}
+	return history, nil
+}
@@ -373,6 +373,42 @@ func SetupRemoveHook(st *state.State, snapName string) *state.Task {
 	return task
 }
 
+// SetupPreSnapshotHook returns a task running the pre-snapshot hook of the
+// given snap, which lets it quiesce its data before it is saved. When undone
+// the task runs the post-snapshot hook, so that the snap is not left
+// quiesced if saving its data fails.
+func SetupPreSnapshotHook(st *state.State, snapName string) *state.Task {
+	hooksup := &HookSetup{
+		Snap:     snapName,
+		Hook:     "pre-snapshot",
+		Optional: true,
+	}
+	undo := &HookSetup{
+		Snap:        snapName,
+		Hook:        "post-snapshot",
+		Optional:    true,
+		IgnoreError: true,
+	}
+
+	summary := fmt.Sprintf(i18n.G("Run pre-snapshot hook of %q snap if present"), hooksup.Snap)
+	return HookTaskWithUndo(st, summary, hooksup, undo, nil)
+}
+
+// SetupPostSnapshotHook returns a task running the post-snapshot hook of the
+// given snap once its data was saved. Failures of the hook are logged but
+// don't affect the snapshot.
+func SetupPostSnapshotHook(st *state.State, snapName string) *state.Task {
+	hooksup := &HookSetup{
+		Snap:        snapName,
+		Hook:        "post-snapshot",
+		Optional:    true,
+		IgnoreError: true,
+	}
+
+	summary := fmt.Sprintf(i18n.G("Run post-snapshot hook of %q snap if present"), hooksup.Snap)
+	return HookTask(st, summary, hooksup, nil)
+}
+
 func setupHooks(hookMgr *HookManager) {
 	handlerGenerator := func(context *Context) Handler {
 		return &SnapHookHandler{}
@@ -385,5 +421,7 @@ func setupHooks(hookMgr *HookManager) {
 	hookMgr.Register(regexp.MustCompile("^post-refresh$"), handlerGenerator)
 	hookMgr.Register(regexp.MustCompile("^pre-refresh$"), handlerGenerator)
 	hookMgr.Register(regexp.MustCompile("^remove$"), handlerGenerator)
+	hookMgr.Register(regexp.MustCompile("^pre-snapshot$"), handlerGenerator)
+	hookMgr.Register(regexp.MustCompile("^post-snapshot$"), handlerGenerator)
 	hookMgr.Register(regexp.MustCompile("^gate-auto-refresh$"), gateAutoRefreshHandlerGenerator)
 }
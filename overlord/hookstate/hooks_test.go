@@ -537,3 +537,29 @@ func (s *gateAutoRefreshHookSuite) TestGateAutorefreshHookErrorHoldErrorLogged(c
 	c.Check(hint, Equals, runinhibit.HintNotInhibited)
 	c.Check(info, Equals, runinhibit.InhibitInfo{})
 }
+
+type snapshotHooksSuite struct{}
+
+var _ = Suite(&snapshotHooksSuite{})
+
+func (s *snapshotHooksSuite) TestSetupSnapshotHooks(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	pre := hookstate.SetupPreSnapshotHook(st, "some-snap")
+	c.Check(pre.Kind(), Equals, "run-hook")
+	c.Check(pre.Summary(), Equals, `Run pre-snapshot hook of "some-snap" snap if present`)
+	var hooksup, undo hookstate.HookSetup
+	c.Assert(pre.Get("hook-setup", &hooksup), IsNil)
+	c.Check(hooksup, DeepEquals, hookstate.HookSetup{Snap: "some-snap", Hook: "pre-snapshot", Optional: true})
+	// the snap is not left quiesced if the snapshot fails
+	c.Assert(pre.Get("undo-hook-setup", &undo), IsNil)
+	c.Check(undo, DeepEquals, hookstate.HookSetup{Snap: "some-snap", Hook: "post-snapshot", Optional: true, IgnoreError: true})
+
+	post := hookstate.SetupPostSnapshotHook(st, "some-snap")
+	c.Check(post.Summary(), Equals, `Run post-snapshot hook of "some-snap" snap if present`)
+	c.Assert(post.Get("hook-setup", &hooksup), IsNil)
+	c.Check(hooksup, DeepEquals, hookstate.HookSetup{Snap: "some-snap", Hook: "post-snapshot", Optional: true, IgnoreError: true})
+	c.Check(post.Has("undo-hook-setup"), Equals, false)
+}
@@ -20,6 +20,8 @@
 package apparmorprompting
 
 import (
+	"time"
+
 	"github.com/snapcore/snapd/interfaces/prompting/requestprompts"
 	"github.com/snapcore/snapd/interfaces/prompting/requestrules"
 	"github.com/snapcore/snapd/sandbox/apparmor/notify/listener"
@@ -42,6 +44,18 @@ func MockListenerClose(f func(l *listener.Listener) error) (restore func()) {
 	return testutil.Mock(&listenerClose, f)
 }
 
+func MockRequestauditSetRotation(f func(maxSize int64, maxFiles int) error) (restore func()) {
+	return testutil.Mock(&requestauditSetRotation, f)
+}
+
+func MockWatchUserLogouts(f func(stop <-chan struct{}, loggedOut func(uid uint32)) error) (restore func()) {
+	return testutil.Mock(&watchUserLogouts, f)
+}
+
+func MockSessionRecheckInterval(interval time.Duration) (restore func()) {
+	return testutil.Mock(&sessionRecheckInterval, interval)
+}
+
 type RequestResponse struct {
 	Request           *listener.Request
 	AllowedPermission any
@@ -112,3 +126,5 @@ func (m *InterfacesRequestsManager) PromptDB() *requestprompts.PromptDB {
 func (m *InterfacesRequestsManager) RuleDB() *requestrules.RuleDB {
 	return m.rules
 }
+
+var InterfaceForRequest = interfaceForRequest
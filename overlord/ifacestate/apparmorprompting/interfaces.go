@@ -0,0 +1,119 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package apparmorprompting
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/overlord/ifacestate/ifacerepo"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+var (
+	cameraPathRegexp         = regexp.MustCompile(`^/dev/(video[0-9]+|vchiq)$`)
+	removableMediaPathRegexp = regexp.MustCompile(`^/(run/media|media)/[^/]+/|^/mnt/`)
+	homeDirRegexp            = regexp.MustCompile(`^(/home/[^/]+|/root)(/|$)`)
+)
+
+// promptingInterfaces lists the interfaces whose AppArmor rules can trigger
+// prompts, in the order in which they are considered for a request. The rules
+// of personal-files and home can both apply to the home directory, so the
+// interface granting access to specific paths is considered first.
+var promptingInterfaces = []struct {
+	name   string
+	covers func(plug *snap.PlugInfo, path string) bool
+}{
+	{"camera", func(_ *snap.PlugInfo, path string) bool { return cameraPathRegexp.MatchString(path) }},
+	{"removable-media", func(_ *snap.PlugInfo, path string) bool { return removableMediaPathRegexp.MatchString(path) }},
+	{"personal-files", personalFilesCovers},
+	// the AppArmor rules of home with a prompt prefix are the remaining ones
+	// which can trigger a request
+	{"home", func(*snap.PlugInfo, string) bool { return true }},
+}
+
+// personalFilesCovers returns whether the personal-files plug grants access to
+// the given path, that is whether the path is one of the paths of its read or
+// write attributes, or is beneath one of them.
+func personalFilesCovers(plug *snap.PlugInfo, path string) bool {
+	home := ""
+	if m := homeDirRegexp.FindStringSubmatch(path); m != nil {
+		home = m[1]
+	}
+	for _, attr := range []string{"read", "write"} {
+		paths, _ := plug.Attrs[attr].([]interface{})
+		for _, p := range paths {
+			granted, ok := p.(string)
+			if !ok {
+				continue
+			}
+			if strings.HasPrefix(granted, "$HOME") {
+				if home == "" {
+					continue
+				}
+				granted = home + strings.TrimPrefix(granted, "$HOME")
+			}
+			granted = filepath.Clean(granted)
+			if path == granted || strings.HasPrefix(path, granted+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// interfaceForRequest returns the interface whose AppArmor prompt rules
+// triggered a request by the given snap for the given path.
+//
+// The kernel does not report which rule triggered a request, so the interface
+// is the first of the prompting interfaces with a connected plug of the snap
+// granting access to the path.
+var interfaceForRequest = func(st *state.State, snapName string, path string) (string, error) {
+	st.Lock()
+	repo := ifacerepo.Get(st)
+	st.Unlock()
+
+	plugs := repo.Plugs(snapName)
+	for _, iface := range promptingInterfaces {
+		for _, plug := range plugs {
+			if plug.Interface != iface.name || !iface.covers(plug, path) {
+				continue
+			}
+			if connected, err := isPlugConnected(repo, plug); err != nil {
+				return "", err
+			} else if connected {
+				return iface.name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("cannot find interface of snap %q granting access to %s", snapName, path)
+}
+
+func isPlugConnected(repo *interfaces.Repository, plug *snap.PlugInfo) (bool, error) {
+	conns, err := repo.Connected(plug.Snap.InstanceName(), plug.Name)
+	if err != nil {
+		return false, err
+	}
+	return len(conns) > 0, nil
+}
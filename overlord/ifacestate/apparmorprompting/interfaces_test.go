@@ -0,0 +1,88 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package apparmorprompting_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/ifacestate/apparmorprompting"
+	"github.com/snapcore/snapd/overlord/ifacestate/ifacerepo"
+)
+
+const promptingSnapYaml = `name: editor
+version: 1
+apps:
+  editor:
+plugs:
+  home:
+  camera:
+  removable-media:
+  dot-config:
+    interface: personal-files
+    read: [$HOME/.config/editor]
+`
+
+func (s *apparmorpromptingSuite) TestInterfaceForRequest(c *C) {
+	s.mockConnectedPlugs(c, promptingSnapYaml)
+
+	for _, testCase := range []struct {
+		path  string
+		iface string
+	}{
+		{"/home/test/Documents/foo.txt", "home"},
+		{"/home/test/.config/editor", "personal-files"},
+		{"/home/test/.config/editor/settings", "personal-files"},
+		{"/root/.config/editor/settings", "personal-files"},
+		// paths not granted by personal-files are attributed to home
+		{"/home/test/.config/editor-other", "home"},
+		{"/home/test/.bashrc", "home"},
+		{"/media/test/usb/foo", "removable-media"},
+		{"/run/media/test/usb/foo", "removable-media"},
+		{"/mnt/foo", "removable-media"},
+		{"/dev/video0", "camera"},
+		{"/dev/vchiq", "camera"},
+	} {
+		iface, err := apparmorprompting.InterfaceForRequest(s.st, "editor", testCase.path)
+		c.Check(err, IsNil, Commentf("path: %s", testCase.path))
+		c.Check(iface, Equals, testCase.iface, Commentf("path: %s", testCase.path))
+	}
+}
+
+func (s *apparmorpromptingSuite) TestInterfaceForRequestNotConnected(c *C) {
+	s.mockConnectedPlugs(c, promptingSnapYaml)
+
+	s.st.Lock()
+	repo := ifacerepo.Get(s.st)
+	s.st.Unlock()
+	c.Assert(repo.Disconnect("editor", "dot-config", "core", "personal-files"), IsNil)
+	c.Assert(repo.Disconnect("editor", "home", "core", "home"), IsNil)
+
+	// the plugs which are not connected are not considered
+	_, err := apparmorprompting.InterfaceForRequest(s.st, "editor", "/home/test/.config/editor/settings")
+	c.Check(err, ErrorMatches, `cannot find interface of snap "editor" granting access to /home/test/.config/editor/settings`)
+
+	iface, err := apparmorprompting.InterfaceForRequest(s.st, "editor", "/dev/video0")
+	c.Check(err, IsNil)
+	c.Check(iface, Equals, "camera")
+
+	// nor are the plugs of other snaps
+	_, err = apparmorprompting.InterfaceForRequest(s.st, "other", "/dev/video0")
+	c.Check(err, ErrorMatches, `cannot find interface of snap "other" granting access to /dev/video0`)
+}
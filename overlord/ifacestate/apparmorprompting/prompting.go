@@ -23,14 +23,17 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"gopkg.in/tomb.v2"
 
 	"github.com/snapcore/snapd/interfaces/prompting"
 	prompting_errors "github.com/snapcore/snapd/interfaces/prompting/errors"
+	"github.com/snapcore/snapd/interfaces/prompting/requestaudit"
 	"github.com/snapcore/snapd/interfaces/prompting/requestprompts"
 	"github.com/snapcore/snapd/interfaces/prompting/requestrules"
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/sandbox/apparmor/notify/listener"
 	"github.com/snapcore/snapd/snap/naming"
@@ -44,6 +47,14 @@ var (
 	listenerReqs     = func(l *listener.Listener) <-chan *listener.Request { return l.Reqs() }
 
 	requestReply = func(req *listener.Request, allowedPermission any) error { return req.Reply(allowedPermission) }
+
+	watchUserLogouts = prompting.WatchUserLogouts
+
+	// sessionRecheckInterval is how often the login sessions which could
+	// not be determined when loading the rules are checked again.
+	sessionRecheckInterval = time.Minute
+
+	requestauditSetRotation = requestaudit.SetRotation
 )
 
 // A Manager holds outstanding prompts and mediates their replies, further it
@@ -58,6 +69,9 @@ type Manager interface {
 	RuleWithID(userID uint32, ruleID prompting.IDType) (*requestrules.Rule, error)
 	PatchRule(userID uint32, ruleID prompting.IDType, constraints *prompting.Constraints, outcome prompting.OutcomeType, lifespan prompting.LifespanType, duration string) (*requestrules.Rule, error)
 	RemoveRule(userID uint32, ruleID prompting.IDType) (*requestrules.Rule, error)
+	ImportRules(userID uint32, contents []*requestrules.RuleContents) ([]*requestrules.Rule, error)
+	AdminRules() ([]*requestrules.Rule, error)
+	SetAdminRules(contents []*requestrules.RuleContents) ([]*requestrules.Rule, error)
 }
 
 // verify that InterfacesRequestsManager implements Manager
@@ -70,6 +84,7 @@ type InterfacesRequestsManager struct {
 	// or when removing those databases. The lock can be held for reading when
 	// acting on just one or the other, as each has an internal mutex as well.
 	lock     sync.RWMutex
+	state    *state.State
 	listener *listener.Listener
 	prompts  *requestprompts.PromptDB
 	rules    *requestrules.RuleDB
@@ -98,10 +113,19 @@ func New(s *state.State) (m *InterfacesRequestsManager, retErr error) {
 		options := state.AddNoticeOptions{
 			Data: data,
 		}
-		_, err := s.AddNotice(&userID, state.InterfacesRequestsRuleUpdateNotice, ruleID.String(), &options)
+		noticeUser := &userID
+		if userID == requestrules.AdminUser {
+			// Admin rules apply to, and can be read by, all users
+			noticeUser = nil
+		}
+		_, err := s.AddNotice(noticeUser, state.InterfacesRequestsRuleUpdateNotice, ruleID.String(), &options)
 		return err
 	}
 
+	if err := setAuditLogRotation(s); err != nil {
+		logger.Noticef("cannot set prompting audit log rotation: %v", err)
+	}
+
 	listenerBackend, err := listenerRegister()
 	if err != nil {
 		return nil, fmt.Errorf("cannot register prompting listener: %w", err)
@@ -133,6 +157,7 @@ func New(s *state.State) (m *InterfacesRequestsManager, retErr error) {
 	}()
 
 	m = &InterfacesRequestsManager{
+		state:        s,
 		listener:     listenerBackend,
 		prompts:      promptsBackend,
 		rules:        rulesBackend,
@@ -141,10 +166,84 @@ func New(s *state.State) (m *InterfacesRequestsManager, retErr error) {
 	}
 
 	m.tomb.Go(m.run)
+	m.tomb.Go(m.watchUserSessions)
+	m.tomb.Go(m.recheckUserSessions)
 
 	return m, nil
 }
 
+// setAuditLogRotation applies the rotation settings of the audit log from
+// the system configuration. Later changes are applied by configcore.
+func setAuditLogRotation(st *state.State) error {
+	st.Lock()
+	defer st.Unlock()
+	tr := config.NewTransaction(st)
+	var values [2]string
+	for i, key := range []string{"prompting.audit-log.max-size", "prompting.audit-log.max-files"} {
+		var v interface{} = ""
+		if err := tr.Get("core", key, &v); err != nil && !config.IsNoOption(err) {
+			return err
+		}
+		values[i] = fmt.Sprint(v)
+	}
+	maxSize, maxFiles, err := requestaudit.ParseRotation(values[0], values[1])
+	if err != nil {
+		return err
+	}
+	return requestauditSetRotation(maxSize, maxFiles)
+}
+
+// watchUserSessions expires the rules with lifespan session of users when
+// they log out, and must be called using tomb.Go.
+func (m *InterfacesRequestsManager) watchUserSessions() error {
+	err := watchUserLogouts(m.tomb.Dying(), m.handleUserLogout)
+	if err != nil {
+		// Session rules are still expired when loading the rules database,
+		// so this is not fatal.
+		logger.Noticef("cannot watch user sessions, rules with lifespan session will expire on restart: %v", err)
+	}
+	return nil
+}
+
+// recheckUserSessions periodically expires the rules with lifespan session of
+// the users whose login session could not be determined when loading the
+// rules database, until the session of every such user has been checked, and
+// must be called using tomb.Go.
+func (m *InterfacesRequestsManager) recheckUserSessions() error {
+	for {
+		m.lock.RLock()
+		var users []uint32
+		if m.rules != nil {
+			users = m.rules.UncheckedSessionUsers()
+		}
+		m.lock.RUnlock()
+		if len(users) == 0 {
+			return nil
+		}
+
+		select {
+		case <-time.After(sessionRecheckInterval):
+		case <-m.tomb.Dying():
+			return nil
+		}
+		for _, userID := range users {
+			m.handleUserLogout(userID)
+		}
+	}
+}
+
+func (m *InterfacesRequestsManager) handleUserLogout(userID uint32) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	if m.rules == nil {
+		// already disconnected
+		return
+	}
+	if _, err := m.rules.ExpireSessionRules(userID); err != nil {
+		logger.Noticef("cannot expire session rules of user %d: %v", userID, err)
+	}
+}
+
 // Run is the main run loop for the manager, and must be called using tomb.Go.
 func (m *InterfacesRequestsManager) run() error {
 	m.lock.Lock()
@@ -200,10 +299,12 @@ func (m *InterfacesRequestsManager) handleListenerReq(req *listener.Request) err
 		snap = tag.InstanceName()
 	}
 
-	// TODO: when we support interfaces beyond "home", do a proper selection here
-	iface := "home"
-
 	path := req.Path
+	iface, err := interfaceForRequest(m.state, snap, path)
+	if err != nil {
+		logger.Noticef("cannot handle request: %v", err)
+		return requestReply(req, nil)
+	}
 
 	permissions, err := prompting.AbstractPermissionsFromAppArmorPermissions(iface, req.Permission)
 	if err != nil {
@@ -245,6 +346,7 @@ func (m *InterfacesRequestsManager) handleListenerReq(req *listener.Request) err
 		allowedPermission, _ := prompting.AbstractPermissionsToAppArmorPermissions(iface, satisfiedPerms)
 		// Error should not occur, but if it does, allowedPermission is set to
 		// empty, leaving it to the listener to default deny all permissions.
+		recordRuleDecision(userID, req.Label, snap, iface, path, permissions, prompting.OutcomeDeny)
 		return requestReply(req, allowedPermission)
 	}
 
@@ -260,6 +362,7 @@ func (m *InterfacesRequestsManager) handleListenerReq(req *listener.Request) err
 		allowedPermission, _ := prompting.AbstractPermissionsToAppArmorPermissions(iface, satisfiedPerms)
 		// Error should not occur, but if it does, allowedPermission is set to
 		// empty, leaving it to the listener to default deny all permissions.
+		recordRuleDecision(userID, req.Label, snap, iface, path, permissions, prompting.OutcomeAllow)
 		return requestReply(req, allowedPermission)
 	}
 
@@ -293,6 +396,16 @@ func (m *InterfacesRequestsManager) handleListenerReq(req *listener.Request) err
 	return nil
 }
 
+// recordRuleDecision records in the audit log that a request was handled
+// directly by existing rules, without creating a prompt.
+func recordRuleDecision(userID uint32, label string, snap string, iface string, path string, permissions []string, outcome prompting.OutcomeType) {
+	entry := requestaudit.NewEntry(userID, label, iface, path, permissions, outcome, requestaudit.SourceRule)
+	entry.Snap = snap
+	if err := requestaudit.Record(entry); err != nil {
+		logger.Noticef("cannot record request decision in audit log: %v", err)
+	}
+}
+
 func (m *InterfacesRequestsManager) disconnect() error {
 	m.lock.Lock()
 	defer m.lock.Unlock()
@@ -341,7 +454,10 @@ func errorsJoin(errs ...error) error {
 func (m *InterfacesRequestsManager) Stop() error {
 	m.tomb.Kill(nil)
 	// Kill causes the run loop to exit and call disconnect()
-	return m.tomb.Wait()
+	err := m.tomb.Wait()
+	// Write the decisions which are still queued for the audit log
+	requestaudit.Flush()
+	return err
 }
 
 // Prompts returns all prompts for the user with the given user ID.
@@ -381,6 +497,11 @@ func (m *InterfacesRequestsManager) HandleReply(userID uint32, promptID promptin
 		return nil, err
 	}
 
+	constraints, err = constraints.WithDefaultPathPattern(prompt.Interface)
+	if err != nil {
+		return nil, err
+	}
+
 	// Outcome and lifesnap are validated while unmarshalling, and duration is
 	// validated when the rule is being added. So only need to validate
 	// constraints.
@@ -455,16 +576,26 @@ func (m *InterfacesRequestsManager) HandleReply(userID uint32, promptID promptin
 }
 
 func (m *InterfacesRequestsManager) applyRuleToOutstandingPrompts(rule *requestrules.Rule) []prompting.IDType {
-	metadata := &prompting.Metadata{
-		User:      rule.User,
-		Snap:      rule.Snap,
-		Interface: rule.Interface,
-	}
-	satisfiedPromptIDs, err := m.prompts.HandleNewRule(metadata, rule.Constraints, rule.Outcome)
-	if err != nil {
-		// The rule's constraints and outcome were already validated, so an
-		// error should not occur here unless the prompt DB was already closed.
-		logger.Noticef("error when handling new rule: %v", err)
+	users := []uint32{rule.User}
+	if rule.Admin {
+		// Admin rules apply to the prompts of all users
+		users = m.prompts.Users()
+	}
+	var satisfiedPromptIDs []prompting.IDType
+	for _, user := range users {
+		metadata := &prompting.Metadata{
+			User:      user,
+			Snap:      rule.Snap,
+			Interface: rule.Interface,
+		}
+		ids, err := m.prompts.HandleNewRule(metadata, rule.Constraints, rule.Outcome)
+		if err != nil {
+			// The rule's constraints and outcome were already validated, so
+			// an error should not occur here unless the prompt DB was
+			// already closed.
+			logger.Noticef("error when handling new rule: %v", err)
+		}
+		satisfiedPromptIDs = append(satisfiedPromptIDs, ids...)
 	}
 	return satisfiedPromptIDs
 }
@@ -563,3 +694,50 @@ func (m *InterfacesRequestsManager) RemoveRule(userID uint32, ruleID prompting.I
 	rule, err := m.rules.RemoveRule(userID, ruleID)
 	return rule, err
 }
+
+// ImportRules creates new rules with the given contents for the user with the
+// given user ID, and then checks them against outstanding prompts, resolving
+// any prompts which they satisfy. If any of the rules cannot be added, none
+// of them is.
+func (m *InterfacesRequestsManager) ImportRules(userID uint32, contents []*requestrules.RuleContents) ([]*requestrules.Rule, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	newRules, err := m.rules.ImportRules(userID, contents)
+	if err != nil {
+		return nil, err
+	}
+	// Apply new rules to outstanding prompts.
+	for _, rule := range newRules {
+		m.applyRuleToOutstandingPrompts(rule)
+	}
+	return newRules, nil
+}
+
+// AdminRules returns the rules set by the administrator for all users.
+func (m *InterfacesRequestsManager) AdminRules() ([]*requestrules.Rule, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	rules := m.rules.AdminRules()
+	return rules, nil
+}
+
+// SetAdminRules replaces the rules set by the administrator for all users
+// with new rules with the given contents, and then checks them against the
+// outstanding prompts of all users, resolving any prompts which they satisfy.
+// Admin rules take precedence over the rules of the users.
+func (m *InterfacesRequestsManager) SetAdminRules(contents []*requestrules.RuleContents) ([]*requestrules.Rule, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	rules, err := m.rules.SetAdminRules(contents)
+	if err != nil {
+		return nil, err
+	}
+	// Apply new rules to outstanding prompts.
+	for _, rule := range rules {
+		m.applyRuleToOutstandingPrompts(rule)
+	}
+	return rules, nil
+}
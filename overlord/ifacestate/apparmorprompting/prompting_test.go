@@ -21,6 +21,7 @@ package apparmorprompting_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -32,16 +33,23 @@ import (
 	. "gopkg.in/check.v1"
 
 	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/interfaces/ifacetest"
 	"github.com/snapcore/snapd/interfaces/prompting"
 	prompting_errors "github.com/snapcore/snapd/interfaces/prompting/errors"
 	"github.com/snapcore/snapd/interfaces/prompting/patterns"
+	"github.com/snapcore/snapd/interfaces/prompting/requestaudit"
 	"github.com/snapcore/snapd/interfaces/prompting/requestprompts"
 	"github.com/snapcore/snapd/interfaces/prompting/requestrules"
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/ifacestate/apparmorprompting"
+	"github.com/snapcore/snapd/overlord/ifacestate/ifacerepo"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/sandbox/apparmor/notify"
 	"github.com/snapcore/snapd/sandbox/apparmor/notify/listener"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
 	"github.com/snapcore/snapd/testutil"
 )
 
@@ -53,6 +61,9 @@ type apparmorpromptingSuite struct {
 	st *state.State
 
 	defaultUser uint32
+
+	// logouts receives the UIDs of users to simulate logging out
+	logouts chan uint32
 }
 
 var _ = Suite(&apparmorpromptingSuite{})
@@ -66,6 +77,70 @@ func (s *apparmorpromptingSuite) SetUpTest(c *C) {
 
 	s.st = state.New(nil)
 	s.defaultUser = 1000
+
+	// the requests in the tests are made by firefox, through the home and
+	// camera interfaces
+	s.mockConnectedPlugs(c, `name: firefox
+version: 1
+apps:
+  firefox:
+plugs:
+  home:
+  camera:
+`)
+
+	s.logouts = make(chan uint32)
+	restore := apparmorprompting.MockWatchUserLogouts(func(stop <-chan struct{}, loggedOut func(uid uint32)) error {
+		for {
+			select {
+			case uid := <-s.logouts:
+				loggedOut(uid)
+			case <-stop:
+				return nil
+			}
+		}
+	})
+	s.AddCleanup(restore)
+}
+
+const promptingCoreYaml = `name: core
+version: 1
+type: os
+slots:
+  home:
+  camera:
+  removable-media:
+  personal-files:
+`
+
+// mockConnectedPlugs sets up the interfaces repository with the given snap,
+// all of whose plugs are connected to the matching slots of the core snap.
+func (s *apparmorpromptingSuite) mockConnectedPlugs(c *C, snapYaml string) {
+	repo := interfaces.NewRepository()
+	for _, name := range []string{"home", "camera", "removable-media", "personal-files"} {
+		c.Assert(repo.AddInterface(&ifacetest.TestInterface{InterfaceName: name}), IsNil)
+	}
+
+	coreInfo := snaptest.MockInfo(c, promptingCoreYaml, nil)
+	info := snaptest.MockInfo(c, snapYaml, nil)
+	for _, info := range []*snap.Info{coreInfo, info} {
+		appSet, err := interfaces.NewSnapAppSet(info, nil)
+		c.Assert(err, IsNil)
+		c.Assert(repo.AddAppSet(appSet), IsNil)
+	}
+
+	for _, plug := range info.Plugs {
+		ref := &interfaces.ConnRef{
+			PlugRef: interfaces.PlugRef{Snap: info.InstanceName(), Name: plug.Name},
+			SlotRef: interfaces.SlotRef{Snap: "core", Name: plug.Interface},
+		}
+		_, err := repo.Connect(ref, nil, nil, nil, nil, nil)
+		c.Assert(err, IsNil)
+	}
+
+	s.st.Lock()
+	ifacerepo.Replace(s.st, repo)
+	s.st.Unlock()
 }
 
 func (s *apparmorpromptingSuite) TestNew(c *C) {
@@ -79,6 +154,34 @@ func (s *apparmorpromptingSuite) TestNew(c *C) {
 	c.Assert(err, IsNil)
 }
 
+func (s *apparmorpromptingSuite) TestNewSetsAuditLogRotation(c *C) {
+	_, _, restore := apparmorprompting.MockListener()
+	defer restore()
+	var maxSizes []int64
+	var maxFiles []int
+	restore = apparmorprompting.MockRequestauditSetRotation(func(size int64, files int) error {
+		maxSizes = append(maxSizes, size)
+		maxFiles = append(maxFiles, files)
+		return nil
+	})
+	defer restore()
+
+	s.st.Lock()
+	tr := config.NewTransaction(s.st)
+	c.Assert(tr.Set("core", "prompting.audit-log.max-size", "2M"), IsNil)
+	c.Assert(tr.Set("core", "prompting.audit-log.max-files", 6), IsNil)
+	tr.Commit()
+	s.st.Unlock()
+
+	mgr, err := apparmorprompting.New(s.st)
+	c.Assert(err, IsNil)
+	c.Check(maxSizes, DeepEquals, []int64{2 * 1024 * 1024})
+	c.Check(maxFiles, DeepEquals, []int{6})
+
+	err = mgr.Stop()
+	c.Assert(err, IsNil)
+}
+
 func (s *apparmorpromptingSuite) TestNewErrorListener(c *C) {
 	registerFailure := fmt.Errorf("failed to register listener")
 	restore := apparmorprompting.MockListenerRegister(func() (*listener.Listener, error) {
@@ -206,14 +309,33 @@ func (s *apparmorpromptingSuite) TestHandleListenerRequestErrors(c *C) {
 	c.Check(err, IsNil)
 	c.Check(prompts, HasLen, 0)
 
-	// Send request with invalid permissions
+	// Send request from a snap without connected plugs granting access
 	req := &listener.Request{
+		Label:      "snap.other.other",
+		SubjectUID: s.defaultUser,
+		Path:       "/home/test/foo",
+		Permission: notify.AA_MAY_READ,
+	}
+	reqChan <- req
+	resp, err := waitForReply(replyChan)
+	c.Assert(err, IsNil)
+	c.Check(resp.Request, Equals, req)
+	c.Check(resp.AllowedPermission, IsNil)
+	logger.WithLoggerLock(func() {
+		c.Check(logbuf.String(), testutil.Contains,
+			` cannot handle request: cannot find interface of snap "other" granting access to /home/test/foo`)
+	})
+
+	// Send request with invalid permissions
+	req = &listener.Request{
 		// Most fields don't matter here
+		Label:      "snap.firefox.firefox",
 		SubjectUID: s.defaultUser,
+		Path:       "/home/test/foo",
 		Permission: notify.FilePermission(0),
 	}
 	reqChan <- req
-	resp, err := waitForReply(replyChan)
+	resp, err = waitForReply(replyChan)
 	c.Assert(err, IsNil)
 	c.Check(resp.Request, Equals, req)
 	logger.WithLoggerLock(func() {
@@ -292,6 +414,53 @@ func (s *apparmorpromptingSuite) TestHandleReplySimple(c *C) {
 	c.Assert(mgr.Stop(), IsNil)
 }
 
+func (s *apparmorpromptingSuite) TestHandleReplyDevice(c *C) {
+	reqChan, replyChan, restore := apparmorprompting.MockListener()
+	defer restore()
+
+	mgr, err := apparmorprompting.New(s.st)
+	c.Assert(err, IsNil)
+
+	req := &listener.Request{
+		Path:       "/dev/video0",
+		Permission: notify.AA_MAY_READ | notify.AA_MAY_WRITE,
+	}
+	req, prompt := s.simulateRequest(c, reqChan, mgr, req, false)
+	c.Check(prompt.Interface, Equals, "camera")
+
+	// Reply without a path pattern, to allow access to all cameras
+	constraints := prompting.Constraints{
+		Permissions: []string{"access"},
+	}
+	clientActivity := true
+	satisfied, err := mgr.HandleReply(s.defaultUser, prompt.ID, &constraints, prompting.OutcomeAllow, prompting.LifespanForever, "", clientActivity)
+	c.Check(err, IsNil)
+	c.Check(satisfied, HasLen, 0)
+
+	resp, err := waitForReply(replyChan)
+	c.Assert(err, IsNil)
+	c.Check(resp.Request, Equals, req)
+	aaPerms, err := prompting.AbstractPermissionsToAppArmorPermissions("camera", constraints.Permissions)
+	c.Check(err, IsNil)
+	c.Check(resp.AllowedPermission, Equals, aaPerms)
+
+	// Access to another camera is allowed by the new rule without prompting
+	req = &listener.Request{
+		Path:       "/dev/video1",
+		Permission: notify.AA_MAY_READ,
+	}
+	s.fillInPartialRequest(req)
+	whenSent := time.Now()
+	reqChan <- req
+	resp, err = waitForReply(replyChan)
+	c.Assert(err, IsNil)
+	c.Check(resp.Request, Equals, req)
+	c.Check(resp.AllowedPermission, Equals, aaPerms)
+	s.checkRecordedPromptNotices(c, whenSent, 0)
+
+	c.Assert(mgr.Stop(), IsNil)
+}
+
 func (s *apparmorpromptingSuite) simulateRequest(c *C, reqChan chan *listener.Request, mgr *apparmorprompting.InterfacesRequestsManager, req *listener.Request, shouldMerge bool) (*listener.Request, *requestprompts.Prompt) {
 	clientActivity := false
 	prompts, err := mgr.Prompts(s.defaultUser, clientActivity)
@@ -352,7 +521,11 @@ func (s *apparmorpromptingSuite) simulateRequest(c *C, reqChan chan *listener.Re
 	}
 
 	c.Check(prompt.Snap, Equals, expectedSnap)
-	c.Check(prompt.Interface, Equals, "home")
+	expectedIface := "home"
+	if strings.HasPrefix(req.Path, "/dev/") {
+		expectedIface = "camera"
+	}
+	c.Check(prompt.Interface, Equals, expectedIface)
 	c.Check(prompt.Constraints.Path(), Equals, req.Path)
 
 	// Check that we can query that prompt by ID
@@ -519,6 +692,19 @@ func (s *apparmorpromptingSuite) TestExistingRuleAllowsNewPrompt(c *C) {
 	c.Assert(err, IsNil)
 	c.Check(resp.AllowedPermission, DeepEquals, expectedPermissions)
 
+	// Check that the decision was recorded in the audit log
+	entries, err := requestaudit.Entries(nil)
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 1)
+	c.Check(entries[0].User, Equals, s.defaultUser)
+	c.Check(entries[0].Snap, Equals, "firefox")
+	c.Check(entries[0].App, Equals, "firefox")
+	c.Check(entries[0].Interface, Equals, "home")
+	c.Check(entries[0].Path, Equals, "/home/test/foo")
+	c.Check(entries[0].Permissions, DeepEquals, []string{"read", "write"})
+	c.Check(entries[0].Outcome, Equals, prompting.OutcomeAllow)
+	c.Check(entries[0].Source, Equals, requestaudit.SourceRule)
+
 	c.Assert(mgr.Stop(), IsNil)
 }
 
@@ -669,6 +855,14 @@ func (s *apparmorpromptingSuite) TestExistingRulesMixedMatchNewPromptDenies(c *C
 	c.Assert(err, IsNil)
 	c.Check(resp.AllowedPermission, DeepEquals, expectedPermissions)
 
+	// Check that the request was recorded as denied in the audit log
+	entries, err := requestaudit.Entries(nil)
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 1)
+	c.Check(entries[0].Permissions, DeepEquals, []string{"read", "write"})
+	c.Check(entries[0].Outcome, Equals, prompting.OutcomeDeny)
+	c.Check(entries[0].Source, Equals, requestaudit.SourceRule)
+
 	c.Assert(mgr.Stop(), IsNil)
 }
 
@@ -1052,6 +1246,143 @@ func (s *apparmorpromptingSuite) TestRequestMerged(c *C) {
 	c.Assert(mgr.Stop(), IsNil)
 }
 
+func (s *apparmorpromptingSuite) TestSessionRulesExpireOnLogout(c *C) {
+	_, _, restore := apparmorprompting.MockListener()
+	defer restore()
+
+	session := prompting.UserSessionID(1234)
+	restore = requestrules.MockCurrentUserSession(func(uid uint32) (prompting.UserSessionID, error) {
+		if session == 0 {
+			return 0, prompting_errors.ErrNoUserSession
+		}
+		return session, nil
+	})
+	defer restore()
+
+	mgr, err := apparmorprompting.New(s.st)
+	c.Assert(err, IsNil)
+
+	constraints := &prompting.Constraints{
+		PathPattern: mustParsePathPattern(c, "/home/test/Documents/**"),
+		Permissions: []string{"read"},
+	}
+	sessionRule, err := mgr.AddRule(s.defaultUser, "firefox", "home", constraints, prompting.OutcomeAllow, prompting.LifespanSession, "")
+	c.Assert(err, IsNil)
+	c.Check(sessionRule.Session, Equals, session)
+	constraints = &prompting.Constraints{
+		PathPattern: mustParsePathPattern(c, "/home/test/Pictures/**"),
+		Permissions: []string{"read"},
+	}
+	foreverRule, err := mgr.AddRule(s.defaultUser, "firefox", "home", constraints, prompting.OutcomeAllow, prompting.LifespanForever, "")
+	c.Assert(err, IsNil)
+
+	// Another user logging out does not affect the rules
+	s.logouts <- s.defaultUser + 1
+	rules, err := mgr.Rules(s.defaultUser, "", "")
+	c.Assert(err, IsNil)
+	c.Check(rules, HasLen, 2)
+
+	whenSent := time.Now()
+	session = 0
+	s.logouts <- s.defaultUser
+
+	for i := 0; i < 100; i++ {
+		rules, err = mgr.Rules(s.defaultUser, "", "")
+		c.Assert(err, IsNil)
+		if len(rules) == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(rules, HasLen, 1)
+	c.Check(rules[0].ID, Equals, foreverRule.ID)
+
+	s.st.Lock()
+	notices := s.st.Notices(&state.NoticeFilter{
+		Types: []state.NoticeType{state.InterfacesRequestsRuleUpdateNotice},
+		After: whenSent,
+	})
+	s.st.Unlock()
+	c.Assert(notices, HasLen, 1)
+	n := noticeToMap(c, notices[0])
+	c.Check(n["key"], Equals, sessionRule.ID.String())
+	c.Check(n["last-data"], DeepEquals, map[string]any{"removed": "expired"})
+
+	c.Assert(mgr.Stop(), IsNil)
+}
+
+func (s *apparmorpromptingSuite) TestSessionRulesRecheckedWhenSessionUnknown(c *C) {
+	_, _, restore := apparmorprompting.MockListener()
+	defer restore()
+	restore = apparmorprompting.MockSessionRecheckInterval(10 * time.Millisecond)
+	defer restore()
+
+	var sessionErr error
+	session := prompting.UserSessionID(1234)
+	restore = requestrules.MockCurrentUserSession(func(uid uint32) (prompting.UserSessionID, error) {
+		if sessionErr != nil {
+			return 0, sessionErr
+		}
+		if session == 0 {
+			return 0, prompting_errors.ErrNoUserSession
+		}
+		return session, nil
+	})
+	defer restore()
+
+	mgr, err := apparmorprompting.New(s.st)
+	c.Assert(err, IsNil)
+
+	constraints := &prompting.Constraints{
+		PathPattern: mustParsePathPattern(c, "/home/test/Documents/**"),
+		Permissions: []string{"read"},
+	}
+	sessionRule, err := mgr.AddRule(s.defaultUser, "firefox", "home", constraints, prompting.OutcomeAllow, prompting.LifespanSession, "")
+	c.Assert(err, IsNil)
+	c.Assert(mgr.Stop(), IsNil)
+
+	// logind cannot be reached when the rules are loaded again
+	_, _, restore = apparmorprompting.MockListener()
+	defer restore()
+	sessionErr = errors.New("cannot connect to the system bus: boom")
+	logbuf, restore := logger.MockLogger()
+	defer restore()
+	mgr, err = apparmorprompting.New(s.st)
+	c.Assert(err, IsNil)
+
+	rules, err := mgr.Rules(s.defaultUser, "", "")
+	c.Assert(err, IsNil)
+	c.Assert(rules, HasLen, 1)
+	c.Check(rules[0].ID, Equals, sessionRule.ID)
+
+	// The user logged out in the meantime, which is noticed once logind
+	// can be reached again
+	session = 0
+	sessionErr = nil
+	for i := 0; i < 100; i++ {
+		rules, err = mgr.Rules(s.defaultUser, "", "")
+		c.Assert(err, IsNil)
+		if len(rules) == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Check(rules, HasLen, 0)
+	logger.WithLoggerLock(func() {
+		c.Check(logbuf.String(), testutil.Contains, "cannot check login session of user 1000, keeping its rules with lifespan session: cannot connect to the system bus: boom")
+	})
+
+	c.Assert(mgr.Stop(), IsNil)
+}
+
+func noticeToMap(c *C, notice *state.Notice) map[string]any {
+	buf, err := json.Marshal(notice)
+	c.Assert(err, IsNil)
+	var n map[string]any
+	c.Assert(json.Unmarshal(buf, &n), IsNil)
+	return n
+}
+
 func (s *apparmorpromptingSuite) TestRules(c *C) {
 	_, _, restore := apparmorprompting.MockListener()
 	defer restore()
@@ -1279,3 +1610,201 @@ func (s *apparmorpromptingSuite) TestAddRuleWithIDPatchRemove(c *C) {
 
 	c.Assert(mgr.Stop(), IsNil)
 }
+
+func (s *apparmorpromptingSuite) TestImportRulesExistingPrompt(c *C) {
+	reqChan, replyChan, restore := apparmorprompting.MockListener()
+	defer restore()
+
+	mgr, err := apparmorprompting.New(s.st)
+	c.Assert(err, IsNil)
+
+	// Add read request
+	readReq := &listener.Request{
+		Permission: notify.AA_MAY_READ,
+	}
+	_, readPrompt := s.simulateRequest(c, reqChan, mgr, readReq, false)
+
+	whenSent := time.Now()
+	contents := []*requestrules.RuleContents{
+		{
+			Snap:      "firefox",
+			Interface: "home",
+			Constraints: &prompting.Constraints{
+				PathPattern: mustParsePathPattern(c, "/home/test/**"),
+				Permissions: []string{"read"},
+			},
+			Outcome:  prompting.OutcomeAllow,
+			Lifespan: prompting.LifespanForever,
+		},
+		{
+			Snap:      "thunderbird",
+			Interface: "home",
+			Constraints: &prompting.Constraints{
+				PathPattern: mustParsePathPattern(c, "/home/test/**"),
+				Permissions: []string{"write"},
+			},
+			Outcome:  prompting.OutcomeDeny,
+			Lifespan: prompting.LifespanForever,
+		},
+	}
+	rules, err := mgr.ImportRules(s.defaultUser, contents)
+	c.Assert(err, IsNil)
+	c.Assert(rules, HasLen, 2)
+
+	// Check that kernel received a reply
+	resp, err := waitForReply(replyChan)
+	c.Assert(err, IsNil)
+	c.Check(resp.Request, Equals, readReq)
+
+	// Check that read request prompt was satisfied
+	clientActivity := false
+	_, err = mgr.PromptWithID(s.defaultUser, readPrompt.ID, clientActivity)
+	c.Check(err, Equals, prompting_errors.ErrPromptNotFound)
+
+	retrieved, err := mgr.Rules(s.defaultUser, "", "")
+	c.Assert(err, IsNil)
+	c.Check(retrieved, DeepEquals, rules)
+
+	s.checkRecordedPromptNotices(c, whenSent, 1)
+	s.checkRecordedRuleUpdateNotices(c, whenSent, 2)
+
+	// Invalid rules are not imported
+	contents[0].Interface = "foo"
+	_, err = mgr.ImportRules(s.defaultUser, contents)
+	c.Check(err, ErrorMatches, `cannot import rule 0: invalid interface: "foo"`)
+
+	c.Assert(mgr.Stop(), IsNil)
+}
+
+func (s *apparmorpromptingSuite) TestAdminRulesFuturePrompts(c *C) {
+	reqChan, replyChan, restore := apparmorprompting.MockListener()
+	defer restore()
+
+	mgr, err := apparmorprompting.New(s.st)
+	c.Assert(err, IsNil)
+
+	// The user allows reading everything in their home directory
+	constraints := &prompting.Constraints{
+		PathPattern: mustParsePathPattern(c, "/home/test/**"),
+		Permissions: []string{"read"},
+	}
+	_, err = mgr.AddRule(s.defaultUser, "firefox", "home", constraints, prompting.OutcomeAllow, prompting.LifespanForever, "")
+	c.Assert(err, IsNil)
+
+	// The administrator denies reading a particular file
+	whenSet := time.Now()
+	adminRules, err := mgr.SetAdminRules([]*requestrules.RuleContents{
+		{
+			Snap:      "firefox",
+			Interface: "home",
+			Constraints: &prompting.Constraints{
+				PathPattern: mustParsePathPattern(c, "/home/*/foo"),
+				Permissions: []string{"read"},
+			},
+			Outcome:  prompting.OutcomeDeny,
+			Lifespan: prompting.LifespanForever,
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(adminRules, HasLen, 1)
+	s.checkRecordedRuleUpdateNotices(c, whenSet, 1)
+
+	retrieved, err := mgr.AdminRules()
+	c.Assert(err, IsNil)
+	c.Check(retrieved, DeepEquals, adminRules)
+
+	// Admin rules are not rules of the user
+	rules, err := mgr.Rules(s.defaultUser, "", "")
+	c.Assert(err, IsNil)
+	c.Check(rules, HasLen, 1)
+	_, err = mgr.RemoveRule(s.defaultUser, adminRules[0].ID)
+	c.Check(err, Equals, prompting_errors.ErrRuleNotAllowed)
+
+	// The admin rule takes precedence over the rule of the user
+	whenSent := time.Now()
+	req := &listener.Request{
+		Path:       "/home/test/foo",
+		Permission: notify.AA_MAY_READ,
+	}
+	s.fillInPartialRequest(req)
+	reqChan <- req
+	resp, err := waitForReply(replyChan)
+	c.Assert(err, IsNil)
+	c.Check(resp.Request, Equals, req)
+	c.Check(resp.AllowedPermission, DeepEquals, notify.FilePermission(0))
+
+	// Other paths are still allowed by the rule of the user
+	req = &listener.Request{
+		Path:       "/home/test/bar",
+		Permission: notify.AA_MAY_READ,
+	}
+	s.fillInPartialRequest(req)
+	reqChan <- req
+	resp, err = waitForReply(replyChan)
+	c.Assert(err, IsNil)
+	c.Check(resp.Request, Equals, req)
+	expectedPermissions, err := prompting.AbstractPermissionsToAppArmorPermissions("home", []string{"read"})
+	c.Assert(err, IsNil)
+	c.Check(resp.AllowedPermission, DeepEquals, expectedPermissions)
+
+	s.checkRecordedPromptNotices(c, whenSent, 0)
+
+	c.Assert(mgr.Stop(), IsNil)
+}
+
+func (s *apparmorpromptingSuite) TestAdminRulesOutstandingPrompts(c *C) {
+	reqChan, replyChan, restore := apparmorprompting.MockListener()
+	defer restore()
+
+	mgr, err := apparmorprompting.New(s.st)
+	c.Assert(err, IsNil)
+
+	// Add read request of the user
+	req := &listener.Request{
+		Permission: notify.AA_MAY_READ,
+	}
+	_, prompt := s.simulateRequest(c, reqChan, mgr, req, false)
+
+	// The administrator denies reading the file for all users
+	whenSet := time.Now()
+	adminRules, err := mgr.SetAdminRules([]*requestrules.RuleContents{
+		{
+			Snap:      "firefox",
+			Interface: "home",
+			Constraints: &prompting.Constraints{
+				PathPattern: mustParsePathPattern(c, "/home/*/foo"),
+				Permissions: []string{"read"},
+			},
+			Outcome:  prompting.OutcomeDeny,
+			Lifespan: prompting.LifespanForever,
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(adminRules, HasLen, 1)
+	c.Check(adminRules[0].User, Equals, requestrules.AdminUser)
+
+	// The notice of the admin rule is public
+	s.st.Lock()
+	n := s.st.Notices(&state.NoticeFilter{
+		Types: []state.NoticeType{state.InterfacesRequestsRuleUpdateNotice},
+		After: whenSet,
+	})
+	s.st.Unlock()
+	c.Assert(n, HasLen, 1)
+	userID, isSet := n[0].UserID()
+	c.Check(isSet, Equals, false)
+	c.Check(userID, Equals, uint32(0))
+
+	// The outstanding prompt has been resolved by the admin rule
+	clientActivity := false
+	_, err = mgr.PromptWithID(s.defaultUser, prompt.ID, clientActivity)
+	c.Check(err, Equals, prompting_errors.ErrPromptNotFound)
+	s.checkRecordedPromptNotices(c, whenSet, 1)
+
+	resp, err := waitForReply(replyChan)
+	c.Assert(err, IsNil)
+	c.Check(resp.Request, Equals, req)
+	c.Check(resp.AllowedPermission, DeepEquals, notify.FilePermission(0))
+
+	c.Assert(mgr.Stop(), IsNil)
+}
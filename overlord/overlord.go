@@ -22,6 +22,7 @@
 package overlord
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -35,12 +36,15 @@ import (
 	"gopkg.in/tomb.v2"
 
 	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/features"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/changearchive"
 	"github.com/snapcore/snapd/overlord/cmdstate"
 	"github.com/snapcore/snapd/overlord/confdbstate"
 	"github.com/snapcore/snapd/overlord/configstate"
+	"github.com/snapcore/snapd/overlord/configstate/peerconf"
 	"github.com/snapcore/snapd/overlord/configstate/proxyconf"
 	"github.com/snapcore/snapd/overlord/devicestate"
 	"github.com/snapcore/snapd/overlord/healthstate"
@@ -88,6 +92,8 @@ var pruneTickerC = func(t *time.Ticker) <-chan time.Time {
 // track of all available state managers and related helpers.
 type Overlord struct {
 	stateFLock *osutil.FileLock
+	// stateJournal is the state backend when journaling the state
+	stateJournal *journalStateBackend
 
 	stateEng *StateEngine
 	// ensure loop
@@ -115,6 +121,8 @@ type Overlord struct {
 	shotMgr    *snapshotstate.SnapshotManager
 	// proxyConf mediates the http proxy config
 	proxyConf func(req *http.Request) (*url.URL, error)
+	// peerConf mediates the config of downloads from local network peers
+	peerConf func() (*store.PeerConfig, error)
 }
 
 var storeNew = store.New
@@ -126,10 +134,14 @@ func New(restartHandler restart.Handler) (*Overlord, error) {
 		inited: true,
 	}
 
-	backend := &overlordStateBackend{
+	var backend state.Backend = &overlordStateBackend{
 		path:         dirs.SnapStateFile,
 		ensureBefore: o.ensureBefore,
 	}
+	if features.StateJournal.IsEnabled() {
+		o.stateJournal = newJournalStateBackend(dirs.SnapStateFile, dirs.SnapStateJournal, o.ensureBefore)
+		backend = o.stateJournal
+	}
 	s, restartMgr, err := o.loadState(backend, restartHandler)
 	if err != nil {
 		return nil, err
@@ -187,6 +199,8 @@ func New(restartHandler restart.Handler) (*Overlord, error) {
 		return nil, err
 	}
 	healthstate.Init(hookMgr)
+	o.addManager(healthstate.Manager(s, hookMgr))
+	o.addManager(changearchive.Manager(s))
 
 	// the shared task runner should be added last!
 	o.stateEng.AddManager(o.runner)
@@ -195,6 +209,7 @@ func New(restartHandler restart.Handler) (*Overlord, error) {
 	defer s.Unlock()
 	// setting up the store
 	o.proxyConf = proxyconf.New(s).Conf
+	o.peerConf = peerconf.New(s).Conf
 	storeCtx := storecontext.New(s, o.deviceMgr.StoreContextBackend())
 	sto := o.newStoreWithContext(storeCtx)
 
@@ -285,6 +300,16 @@ func (o *Overlord) loadState(backend state.Backend, restartHandler restart.Handl
 
 	perfTimings := timings.New(map[string]string{"startup": "load-state"})
 
+	// apply any journaled changes to the state file, this is done
+	// regardless of the state backend in use in case journaling the
+	// state was disabled since
+	timings.Run(perfTimings, "compact-state-journal", "compact snapd state journal", func(tm timings.Measurer) {
+		err = compactStateJournal(dirs.SnapStateFile, dirs.SnapStateJournal)
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("fatal: %v", err)
+	}
+
 	if !osutil.FileExists(dirs.SnapStateFile) {
 		// fail fast, mostly interesting for tests, this dir is setup
 		// by the snapd package
@@ -340,6 +365,7 @@ func initRestart(s *state.State, curBootID string, restartHandler restart.Handle
 func (o *Overlord) newStoreWithContext(storeCtx store.DeviceAndAuthContext) snapstate.StoreService {
 	cfg := store.DefaultConfig()
 	cfg.Proxy = o.proxyConf
+	cfg.Peers = o.peerConf
 	sto := storeNew(cfg, storeCtx)
 	sto.SetCacheDownloads(defaultCachedDownloads)
 	return sto
@@ -512,6 +538,13 @@ func (o *Overlord) Stop() error {
 		err = o.loopTomb.Wait()
 	}
 	o.stateEng.Stop()
+	if o.stateJournal != nil {
+		// leave a complete state file behind for anything reading it
+		// while snapd is not running
+		if cerr := o.compactStateJournal(); cerr != nil {
+			logger.Noticef("Cannot compact state journal: %v", cerr)
+		}
+	}
 	if o.stateFLock != nil {
 		// This will also unlock the file
 		o.stateFLock.Close()
@@ -520,6 +553,21 @@ func (o *Overlord) Stop() error {
 	return err
 }
 
+func (o *Overlord) compactStateJournal() error {
+	st := o.State()
+	st.Lock()
+	defer st.Unlock()
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	if err := o.stateJournal.Checkpoint(data); err != nil {
+		return err
+	}
+	o.stateJournal.closeJournal()
+	return os.Remove(dirs.SnapStateJournal)
+}
+
 func (o *Overlord) settle(timeout time.Duration, beforeCleanups func()) error {
 	if err := o.StartUp(); err != nil {
 		return err
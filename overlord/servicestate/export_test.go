@@ -20,6 +20,8 @@
 package servicestate
 
 import (
+	"time"
+
 	tomb "gopkg.in/tomb.v2"
 
 	"github.com/snapcore/snapd/overlord/state"
@@ -76,3 +78,21 @@ func MockResourcesCheckFeatureRequirements(f func(*quota.Resources) error) (rest
 	resourcesCheckFeatureRequirements = f
 	return r
 }
+
+func MockTimeNow(f func() time.Time) (restore func()) {
+	r := testutil.Backup(&timeNow)
+	timeNow = f
+	return r
+}
+
+func MockQuotaGroupUsage(f func(*quota.Group) (*QuotaUsageSample, error)) (restore func()) {
+	r := testutil.Backup(&quotaGroupUsage)
+	quotaGroupUsage = f
+	return r
+}
+
+func (m *ServiceManager) EnsureQuotaUsageSampled() error {
+	return m.ensureQuotaUsageSampled()
+}
+
+const MaxQuotaUsageSamples = maxQuotaUsageSamples
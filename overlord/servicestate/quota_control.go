@@ -98,6 +98,15 @@ func verifyQuotaRequirements(st *state.State, resourceLimits quota.Resources) er
 	// MemoryLimit requires systemd 211, so it's covered by the initial check
 	// CPUQuota requires systemd 213, so no further checks need to be done
 	// TasksMax requires systemd 228, so no further checks need to be done
+	// IOReadBandwidthMax and IOWriteBandwidthMax require systemd 230, so
+	// they are covered by the initial check too
+
+	// MemorySwapMax requires systemd 232, so we need to verify the version here
+	if resourceLimits.MemorySwap != nil {
+		if err := systemd.EnsureAtLeast(232); err != nil {
+			return fmt.Errorf("cannot use the memory-swap quota with incompatible systemd: %v", err)
+		}
+	}
 
 	// AllowedCPUs requires systemd 243, so we need to verify the version here
 	if resourceLimits.CPUSet != nil {
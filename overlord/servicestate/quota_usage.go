@@ -0,0 +1,239 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package servicestate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/snapcore/snapd/gadget/quantity"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap/quota"
+)
+
+const (
+	// maxQuotaUsageSamples is the number of usage samples kept for each
+	// quota group, which with the default interval covers the last 12 hours.
+	maxQuotaUsageSamples = 144
+
+	// defaultQuotaUsageThreshold is the percentage of a quota group limit
+	// above which a quota-threshold notice is recorded, unless configured
+	// with quota-groups.usage-threshold.
+	defaultQuotaUsageThreshold = 90
+)
+
+var (
+	quotaUsageSampleInterval = 5 * time.Minute
+
+	timeNow = time.Now
+)
+
+// QuotaUsageSample is the resource usage of a quota group at a point in
+// time. Only the resources limited by the group are sampled.
+type QuotaUsageSample struct {
+	Time    time.Time     `json:"time"`
+	Memory  quantity.Size `json:"memory,omitempty"`
+	Threads int           `json:"threads,omitempty"`
+	// CPUTime is the total CPU time used by the group so far.
+	CPUTime time.Duration `json:"cpu-time,omitempty"`
+	// CPU is the CPU usage since the previous sample, as a percentage
+	// of a single CPU, in the same way as the CPU limit of the group.
+	CPU int `json:"cpu,omitempty"`
+}
+
+// quotaGroupUsage samples the current usage of the resources limited by the
+// given quota group.
+var quotaGroupUsage = func(grp *quota.Group) (*QuotaUsageSample, error) {
+	sample := &QuotaUsageSample{Time: timeNow()}
+	var err error
+	if grp.MemoryLimit != 0 {
+		if sample.Memory, err = grp.CurrentMemoryUsage(); err != nil {
+			return nil, err
+		}
+	}
+	if grp.ThreadLimit != 0 {
+		if sample.Threads, err = grp.CurrentTaskUsage(); err != nil {
+			return nil, err
+		}
+	}
+	if count, percentage := grp.GetLocalCPUQuota(); count*percentage != 0 {
+		if sample.CPUTime, err = grp.CurrentCPUUsage(); err != nil {
+			return nil, err
+		}
+	}
+	return sample, nil
+}
+
+// QuotaUsageHistory returns the usage samples recorded for the given quota
+// group, oldest first.
+func QuotaUsageHistory(st *state.State, name string) ([]QuotaUsageSample, error) {
+	history, err := quotaUsageHistory(st)
+	if err != nil {
+		return nil, err
+	}
+	return history[name], nil
+}
+
+func quotaUsageHistory(st *state.State) (map[string][]QuotaUsageSample, error) {
+	var history map[string][]QuotaUsageSample
+	if err := st.Get("quota-usage-history", &history); err != nil && !errors.Is(err, state.ErrNoState) {
+		return nil, err
+	}
+	return history, nil
+}
+
+func quotaUsageThreshold(st *state.State) int {
+	var threshold int
+	err := config.NewTransaction(st).Get("core", "quota-groups.usage-threshold", &threshold)
+	if err != nil {
+		if !config.IsNoOption(err) {
+			logger.Noticef("internal error: quota-groups.usage-threshold system option is not valid: %v", err)
+		}
+		return defaultQuotaUsageThreshold
+	}
+	return threshold
+}
+
+type quotaResourceUsage struct {
+	resource string
+	usage    uint64
+	limit    uint64
+}
+
+// quotaResourcesOverThreshold returns the resources limited by the quota
+// group whose usage in the given sample is at or over the threshold
+// percentage of the limit.
+func quotaResourcesOverThreshold(grp *quota.Group, sample *QuotaUsageSample, threshold int) []quotaResourceUsage {
+	var over []quotaResourceUsage
+	check := func(resource string, usage, limit uint64) {
+		if limit != 0 && float64(usage)*100 >= float64(limit)*float64(threshold) {
+			over = append(over, quotaResourceUsage{resource: resource, usage: usage, limit: limit})
+		}
+	}
+	check("memory", uint64(sample.Memory), uint64(grp.MemoryLimit))
+	count, percentage := grp.GetLocalCPUQuota()
+	check("cpu", uint64(sample.CPU), uint64(count*percentage))
+	check("threads", uint64(sample.Threads), uint64(grp.ThreadLimit))
+	return over
+}
+
+// ensureQuotaUsageSampled periodically samples the usage of all quota
+// groups, keeping a bounded history in the state, and records a
+// quota-threshold notice for every resource that crosses the configured
+// threshold since the previous sample.
+func (m *ServiceManager) ensureQuotaUsageSampled() error {
+	now := timeNow()
+	if m.lastQuotaUsageSample.IsZero() {
+		// do not sample right away on startup
+		m.lastQuotaUsageSample = now
+		return nil
+	}
+	if now.Sub(m.lastQuotaUsageSample) < quotaUsageSampleInterval {
+		return nil
+	}
+	m.lastQuotaUsageSample = now
+
+	m.state.Lock()
+	defer m.state.Unlock()
+
+	allGrps, err := AllQuotas(m.state)
+	if err != nil {
+		return err
+	}
+	history, err := quotaUsageHistory(m.state)
+	if err != nil {
+		return err
+	}
+	if len(allGrps) == 0 && len(history) == 0 {
+		return nil
+	}
+
+	threshold := quotaUsageThreshold(m.state)
+	names := make([]string, 0, len(allGrps))
+	for name := range allGrps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	newHistory := make(map[string][]QuotaUsageSample, len(allGrps))
+	for _, name := range names {
+		grp := allGrps[name]
+		samples := history[name]
+
+		// the usage is sampled without the state lock held as it involves
+		// calling systemctl
+		m.state.Unlock()
+		sample, err := quotaGroupUsage(grp)
+		m.state.Lock()
+		if err != nil {
+			logger.Noticef("cannot sample usage of quota group %q: %v", name, err)
+			newHistory[name] = samples
+			continue
+		}
+
+		var prev *QuotaUsageSample
+		if len(samples) > 0 {
+			prev = &samples[len(samples)-1]
+			if elapsed := sample.Time.Sub(prev.Time); elapsed > 0 && sample.CPUTime >= prev.CPUTime && prev.CPUTime != 0 {
+				sample.CPU = int((sample.CPUTime - prev.CPUTime) * 100 / elapsed)
+			}
+		}
+
+		wasOver := make(map[string]bool)
+		if prev != nil {
+			for _, r := range quotaResourcesOverThreshold(grp, prev, threshold) {
+				wasOver[r.resource] = true
+			}
+		}
+		for _, r := range quotaResourcesOverThreshold(grp, sample, threshold) {
+			if wasOver[r.resource] {
+				continue
+			}
+			if err := addQuotaThresholdNotice(m.state, name, r, threshold); err != nil {
+				logger.Noticef("cannot record quota-threshold notice for quota group %q: %v", name, err)
+			}
+		}
+
+		samples = append(samples, *sample)
+		if len(samples) > maxQuotaUsageSamples {
+			samples = samples[len(samples)-maxQuotaUsageSamples:]
+		}
+		newHistory[name] = samples
+	}
+	m.state.Set("quota-usage-history", newHistory)
+	return nil
+}
+
+func addQuotaThresholdNotice(st *state.State, group string, r quotaResourceUsage, threshold int) error {
+	_, err := st.AddNotice(nil, state.QuotaThresholdNotice, group, &state.AddNoticeOptions{
+		Data: map[string]string{
+			"resource":  r.resource,
+			"usage":     strconv.FormatUint(r.usage, 10),
+			"limit":     strconv.FormatUint(r.limit, 10),
+			"threshold": fmt.Sprintf("%d%%", threshold),
+		},
+	})
+	return err
+}
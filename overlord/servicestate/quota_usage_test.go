@@ -0,0 +1,238 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package servicestate_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/gadget/quantity"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/servicestate"
+	"github.com/snapcore/snapd/overlord/servicestate/servicestatetest"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap/quota"
+)
+
+type quotaUsageSuite struct {
+	baseServiceMgrTestSuite
+
+	now   time.Time
+	usage map[string]*servicestate.QuotaUsageSample
+}
+
+var _ = Suite(&quotaUsageSuite{})
+
+func (s *quotaUsageSuite) SetUpTest(c *C) {
+	s.baseServiceMgrTestSuite.SetUpTest(c)
+
+	s.now = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	s.AddCleanup(servicestate.MockTimeNow(func() time.Time { return s.now }))
+	s.usage = make(map[string]*servicestate.QuotaUsageSample)
+	s.AddCleanup(servicestate.MockQuotaGroupUsage(func(grp *quota.Group) (*servicestate.QuotaUsageSample, error) {
+		usage, ok := s.usage[grp.Name]
+		if !ok {
+			return nil, fmt.Errorf("no usage for %q", grp.Name)
+		}
+		sample := *usage
+		sample.Time = s.now
+		return &sample, nil
+	}))
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	_, err := servicestatetest.PatchQuotas(s.state, &quota.Group{
+		Name:        "foo",
+		MemoryLimit: quantity.SizeGiB,
+		ThreadLimit: 100,
+		CPULimit:    &quota.GroupQuotaCPU{Count: 1, Percentage: 50},
+	}, &quota.Group{
+		Name:        "bar",
+		ThreadLimit: 10,
+	})
+	c.Assert(err, IsNil)
+}
+
+// sample advances the clock by the sample interval and runs the sampling
+func (s *quotaUsageSuite) sample(c *C) {
+	s.now = s.now.Add(5 * time.Minute)
+	c.Assert(s.mgr.EnsureQuotaUsageSampled(), IsNil)
+}
+
+func (s *quotaUsageSuite) notices() []*state.Notice {
+	s.state.Lock()
+	defer s.state.Unlock()
+	return s.state.Notices(&state.NoticeFilter{Types: []state.NoticeType{state.QuotaThresholdNotice}})
+}
+
+func (s *quotaUsageSuite) TestSampleHistory(c *C) {
+	s.usage["foo"] = &servicestate.QuotaUsageSample{Memory: quantity.SizeMiB, Threads: 5, CPUTime: time.Minute}
+	s.usage["bar"] = &servicestate.QuotaUsageSample{Threads: 1}
+
+	// nothing is sampled on the first run
+	c.Assert(s.mgr.EnsureQuotaUsageSampled(), IsNil)
+	s.state.Lock()
+	history, err := servicestate.QuotaUsageHistory(s.state, "foo")
+	s.state.Unlock()
+	c.Assert(err, IsNil)
+	c.Check(history, HasLen, 0)
+
+	// nor before the interval has passed
+	s.now = s.now.Add(time.Minute)
+	c.Assert(s.mgr.EnsureQuotaUsageSampled(), IsNil)
+
+	s.sample(c)
+	first := s.now
+	// 30s of CPU time over 5 minutes is 10% of a CPU
+	s.usage["foo"].CPUTime += 30 * time.Second
+	s.sample(c)
+
+	s.state.Lock()
+	history, err = servicestate.QuotaUsageHistory(s.state, "foo")
+	s.state.Unlock()
+	c.Assert(err, IsNil)
+	c.Check(history, DeepEquals, []servicestate.QuotaUsageSample{
+		{Time: first, Memory: quantity.SizeMiB, Threads: 5, CPUTime: time.Minute},
+		{Time: s.now, Memory: quantity.SizeMiB, Threads: 5, CPUTime: 90 * time.Second, CPU: 10},
+	})
+	c.Check(s.notices(), HasLen, 0)
+}
+
+func (s *quotaUsageSuite) TestSampleHistoryBounded(c *C) {
+	s.usage["foo"] = &servicestate.QuotaUsageSample{Memory: quantity.SizeMiB}
+	s.usage["bar"] = &servicestate.QuotaUsageSample{Threads: 1}
+
+	c.Assert(s.mgr.EnsureQuotaUsageSampled(), IsNil)
+	for i := 0; i < servicestate.MaxQuotaUsageSamples+10; i++ {
+		s.usage["foo"].Threads = i
+		s.sample(c)
+	}
+
+	s.state.Lock()
+	history, err := servicestate.QuotaUsageHistory(s.state, "foo")
+	s.state.Unlock()
+	c.Assert(err, IsNil)
+	c.Assert(history, HasLen, servicestate.MaxQuotaUsageSamples)
+	c.Check(history[0].Threads, Equals, 10)
+	c.Check(history[len(history)-1].Time.Equal(s.now), Equals, true)
+}
+
+func (s *quotaUsageSuite) TestSampleErrorKeepsHistory(c *C) {
+	s.usage["foo"] = &servicestate.QuotaUsageSample{Memory: quantity.SizeMiB}
+
+	c.Assert(s.mgr.EnsureQuotaUsageSampled(), IsNil)
+	s.sample(c)
+	s.sample(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	history, err := servicestate.QuotaUsageHistory(s.state, "foo")
+	c.Assert(err, IsNil)
+	c.Check(history, HasLen, 2)
+	// bar could not be sampled
+	history, err = servicestate.QuotaUsageHistory(s.state, "bar")
+	c.Assert(err, IsNil)
+	c.Check(history, HasLen, 0)
+}
+
+func (s *quotaUsageSuite) TestThresholdNotices(c *C) {
+	s.usage["foo"] = &servicestate.QuotaUsageSample{Memory: quantity.SizeMiB, Threads: 5}
+	s.usage["bar"] = &servicestate.QuotaUsageSample{Threads: 1}
+
+	c.Assert(s.mgr.EnsureQuotaUsageSampled(), IsNil)
+	s.sample(c)
+	c.Check(s.notices(), HasLen, 0)
+
+	// bar crosses the default threshold of 90%
+	s.usage["bar"].Threads = 9
+	s.sample(c)
+	notices := s.notices()
+	c.Assert(notices, HasLen, 1)
+	n := noticeToMap(c, notices[0])
+	c.Check(n["key"], Equals, "bar")
+	c.Check(n["occurrences"], Equals, 1.0)
+	c.Check(n["last-data"], DeepEquals, map[string]interface{}{
+		"resource":  "threads",
+		"usage":     "9",
+		"limit":     "10",
+		"threshold": "90%",
+	})
+
+	// staying over the threshold is not notified again
+	s.usage["bar"].Threads = 10
+	s.sample(c)
+	notices = s.notices()
+	c.Assert(notices, HasLen, 1)
+	c.Check(noticeToMap(c, notices[0])["occurrences"], Equals, 1.0)
+
+	// but dropping under it and crossing it again is
+	s.usage["bar"].Threads = 2
+	s.sample(c)
+	s.usage["bar"].Threads = 10
+	s.sample(c)
+	notices = s.notices()
+	c.Assert(notices, HasLen, 1)
+	c.Check(noticeToMap(c, notices[0])["occurrences"], Equals, 2.0)
+}
+
+func (s *quotaUsageSuite) TestThresholdNoticesConfigured(c *C) {
+	s.state.Lock()
+	tr := config.NewTransaction(s.state)
+	tr.Set("core", "quota-groups.usage-threshold", 50)
+	tr.Commit()
+	s.state.Unlock()
+
+	s.usage["foo"] = &servicestate.QuotaUsageSample{Memory: quantity.SizeMiB, CPUTime: time.Minute}
+	s.usage["bar"] = &servicestate.QuotaUsageSample{Threads: 1}
+
+	c.Assert(s.mgr.EnsureQuotaUsageSampled(), IsNil)
+	s.sample(c)
+
+	// memory over half of the limit, and 2m30s of CPU time over 5 minutes,
+	// which is the limit of 50% of a CPU
+	s.usage["foo"].Memory = 600 * quantity.SizeMiB
+	s.usage["foo"].CPUTime += 150 * time.Second
+	s.sample(c)
+
+	notices := s.notices()
+	c.Assert(notices, HasLen, 1)
+	n := noticeToMap(c, notices[0])
+	c.Check(n["key"], Equals, "foo")
+	c.Check(n["occurrences"], Equals, 2.0)
+	c.Check(n["last-data"], DeepEquals, map[string]interface{}{
+		"resource":  "cpu",
+		"usage":     "50",
+		"limit":     "50",
+		"threshold": "50%",
+	})
+}
+
+// noticeToMap converts a Notice to a map using a JSON marshal-unmarshal round trip.
+func noticeToMap(c *C, notice *state.Notice) map[string]interface{} {
+	buf, err := json.Marshal(notice)
+	c.Assert(err, IsNil)
+	var n map[string]interface{}
+	err = json.Unmarshal(buf, &n)
+	c.Assert(err, IsNil)
+	return n
+}
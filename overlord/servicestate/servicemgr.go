@@ -48,6 +48,8 @@ type ServiceManager struct {
 	state *state.State
 
 	ensuredSnapSvcs bool
+
+	lastQuotaUsageSample time.Time
 }
 
 // Manager returns a new service manager.
@@ -204,6 +206,9 @@ func (m *ServiceManager) Ensure() error {
 	if err := m.ensureSnapServicesUpdated(); err != nil {
 		return err
 	}
+	if err := m.ensureQuotaUsageSampled(); err != nil {
+		return err
+	}
 	return nil
 }
 
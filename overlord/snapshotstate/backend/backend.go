@@ -303,6 +303,29 @@ func EstimateSnapshotSize(si *snap.Info, usernames []string, dirOpts *dirs.SnapD
 
 // Save a snapshot
 func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string, dynSnapshotOpts *snap.SnapshotOptions, dirOpts *dirs.SnapDirOptions) (*client.Snapshot, error) {
+	return save(ctx, id, si, cfg, usernames, dynSnapshotOpts, dirOpts, false, nil)
+}
+
+// SaveIncremental saves a snapshot whose data is stored in the shared chunk
+// store, so that data which is unchanged from earlier snapshots is not stored
+// again.
+func SaveIncremental(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string, dynSnapshotOpts *snap.SnapshotOptions, dirOpts *dirs.SnapDirOptions) (*client.Snapshot, error) {
+	// keep the chunks we reference from being cleaned up until the
+	// snapshot is committed
+	chunkStoreLock.RLock()
+	defer chunkStoreLock.RUnlock()
+
+	return save(ctx, id, si, cfg, usernames, dynSnapshotOpts, dirOpts, true, nil)
+}
+
+// SaveEncrypted saves a snapshot whose archives and configuration are
+// encrypted with the given key. Encrypted snapshots are never incremental,
+// as identical data does not encrypt to identical chunks.
+func SaveEncrypted(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string, dynSnapshotOpts *snap.SnapshotOptions, dirOpts *dirs.SnapDirOptions, key *client.SnapshotKey) (*client.Snapshot, error) {
+	return save(ctx, id, si, cfg, usernames, dynSnapshotOpts, dirOpts, false, key)
+}
+
+func save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string, dynSnapshotOpts *snap.SnapshotOptions, dirOpts *dirs.SnapDirOptions, incremental bool, key *client.SnapshotKey) (*client.Snapshot, error) {
 	if err := os.MkdirAll(dirs.SnapshotsDir, 0700); err != nil {
 		return nil, err
 	}
@@ -335,6 +358,16 @@ func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interfac
 		}
 	}
 
+	var encKey encryptionKey
+	if key != nil {
+		snapshot.Encryption, encKey, err = newEncryption(key)
+		if err != nil {
+			return nil, err
+		}
+		// the configuration is stored encrypted, below
+		snapshot.Conf = nil
+	}
+
 	aw, err := osutil.NewAtomicFile(Filename(snapshot), 0600, 0, osutil.NoChown, osutil.NoChown)
 	if err != nil {
 		return nil, err
@@ -344,9 +377,13 @@ func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interfac
 
 	w := zip.NewWriter(aw)
 	defer w.Close() // note this does not close the file descriptor (that's done by hand on the atomic writer, above)
+	var idx chunkIndex
+	if incremental {
+		idx = make(chunkIndex)
+	}
 	savingUserData := false
 	baseDataDir := snap.BaseDataDir(si.InstanceName())
-	if err := addSnapDirToZip(ctx, snapshot, w, "root", archiveName, baseDataDir, savingUserData, snapshotOptions.Exclude); err != nil {
+	if err := addSnapDirToZip(ctx, snapshot, w, idx, encKey, "root", archiveName, baseDataDir, savingUserData, snapshotOptions.Exclude); err != nil {
 		return nil, err
 	}
 
@@ -358,7 +395,23 @@ func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interfac
 	savingUserData = true
 	for _, usr := range users {
 		snapDataDir := filepath.Dir(si.UserDataDir(usr.HomeDir, dirOpts))
-		if err := addSnapDirToZip(ctx, snapshot, w, usr.Username, userArchiveName(usr), snapDataDir, savingUserData, snapshotOptions.Exclude); err != nil {
+		if err := addSnapDirToZip(ctx, snapshot, w, idx, encKey, usr.Username, userArchiveName(usr), snapDataDir, savingUserData, snapshotOptions.Exclude); err != nil {
+			return nil, err
+		}
+	}
+
+	if encKey != nil {
+		if err := addEncryptedConfToZip(w, encKey, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if idx != nil {
+		idxWriter, err := w.Create(chunkIndexName)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.NewEncoder(idxWriter).Encode(idx); err != nil {
 			return nil, err
 		}
 	}
@@ -398,8 +451,10 @@ var isTesting = snapdenv.Testing()
 
 // addSnapDirToZip adds the 'common' and the 'rev' revisioned dir under 'snapDir'
 // to the snapshot. If one doesn't exist, it's ignored. If none exists, the
-// operation is skipped.
-func addSnapDirToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer, username, entry, snapDir string, savingUserData bool, excludePaths []string) error {
+// operation is skipped. If idx is not nil the data goes to the chunk store
+// instead of the zip, and is recorded in idx. If key is not nil the data is
+// encrypted with it.
+func addSnapDirToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer, idx chunkIndex, key encryptionKey, username, entry, snapDir string, savingUserData bool, excludePaths []string) error {
 	paths, err := pathsForSnapshot(snapDir, snapshot)
 	if err != nil {
 		return err
@@ -442,25 +497,48 @@ func addSnapDirToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writ
 		expExcludePaths = append(expExcludePaths, expandedPath)
 	}
 
-	return addToZip(ctx, snapshot, w, username, entry, paths, expExcludePaths)
+	return addToZip(ctx, snapshot, w, idx, key, username, entry, paths, expExcludePaths)
 }
 
 // addToZip adds 'paths' to the snapshot. tar will change into the paths' parent
 // directory before creating the archive so that parent dirs are not added.
-func addToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer, username, entry string, paths []string, excludePaths []string) error {
-	archiveWriter, err := w.CreateHeader(&zip.FileHeader{Name: entry})
-	if err != nil {
-		return err
-	}
+func addToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer, idx chunkIndex, key encryptionKey, username, entry string, paths []string, excludePaths []string) error {
+	var sz osutil.Sizer
+	hasher := crypto.SHA3_384.New()
 
 	tarArgs := []string{
 		"--create",
-		"--sparse", "--gzip",
+		"--sparse",
 		"--format", "gnu",
 		"--anchored",
 		"--no-wildcards-match-slash",
 	}
 
+	var archiveWriter io.Writer
+	var chunks *chunkWriter
+	var encrypter *encryptingWriter
+	switch {
+	case idx != nil:
+		// chunks are compressed one by one by the chunk writer
+		chunks = newChunkWriter(idx, entry, io.MultiWriter(hasher, &sz))
+		archiveWriter = chunks
+	default:
+		zw, err := w.CreateHeader(&zip.FileHeader{Name: entry})
+		if err != nil {
+			return err
+		}
+		if key != nil {
+			// hash and size are those of the unencrypted data
+			encrypter, err = newEncryptingWriter(key, entry, zw)
+			if err != nil {
+				return err
+			}
+			zw = encrypter
+		}
+		archiveWriter = io.MultiWriter(zw, hasher, &sz)
+		tarArgs = append(tarArgs, "--gzip")
+	}
+
 	for _, path := range excludePaths {
 		tarArgs = append(tarArgs, fmt.Sprintf("--exclude=%s", path))
 	}
@@ -471,11 +549,8 @@ func addToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer, use
 		tarArgs = append(tarArgs, "--directory", parent, dir)
 	}
 
-	var sz osutil.Sizer
-	hasher := crypto.SHA3_384.New()
-
 	cmd := tarAsUser(username, tarArgs...)
-	cmd.Stdout = io.MultiWriter(archiveWriter, hasher, &sz)
+	cmd.Stdout = archiveWriter
 
 	// keep (at most) the last 5 non-empty lines of what 'tar' writes to stderr
 	// (those are the most likely contain the reason for fatal errors)
@@ -504,12 +579,40 @@ func addToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer, use
 		return fmt.Errorf("tar failed: %v", err)
 	}
 
+	if chunks != nil {
+		if err := chunks.Close(); err != nil {
+			return err
+		}
+	}
+	if encrypter != nil {
+		if err := encrypter.Close(); err != nil {
+			return err
+		}
+	}
+
 	snapshot.SHA3_384[entry] = fmt.Sprintf("%x", hasher.Sum(nil))
 	snapshot.Size += sz.Size()
 
 	return nil
 }
 
+// addEncryptedConfToZip adds the snap configuration, encrypted with key, to
+// the snapshot.
+func addEncryptedConfToZip(w *zip.Writer, key encryptionKey, cfg map[string]interface{}) error {
+	zw, err := w.Create(encryptedConfName)
+	if err != nil {
+		return err
+	}
+	encrypter, err := newEncryptingWriter(key, encryptedConfName, zw)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(encrypter).Encode(cfg); err != nil {
+		return err
+	}
+	return encrypter.Close()
+}
+
 // pathsForSnapshot returns a list of absolute paths under 'snapDir' that should
 // be included in the snapshot (based on what directories exist).
 func pathsForSnapshot(snapDir string, snapshot *client.Snapshot) ([]string, error) {
@@ -731,6 +834,9 @@ type ImportFlags struct {
 	// noDuplicatedImportCheck tells import not to check for existing snapshot
 	// with same content hash (and not report DuplicatedSnapshotImportError).
 	NoDuplicatedImportCheck bool
+	// Key is the key of the snapshot set, needed to validate the
+	// import of encrypted snapshots.
+	Key *client.SnapshotKey
 }
 
 // Import a snapshot from the export file format
@@ -761,7 +867,7 @@ func Import(ctx context.Context, id uint64, r io.Reader, flags *ImportFlags) (sn
 		if _, ok := err.(DuplicatedSnapshotImportError); ok {
 			return nil, err
 		}
-		return nil, fmt.Errorf("%s: %v", errPrefix, err)
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
 	}
 	if err := tr.Commit(); err != nil {
 		return nil, err
@@ -899,6 +1005,10 @@ func unpackVerifySnapshotImport(ctx context.Context, r io.Reader, realSetID uint
 		if err != nil {
 			return snapNames, fmt.Errorf("cannot open snapshot: %v", err)
 		}
+		if err := r.Unlock(flags.Key); err != nil {
+			r.Close()
+			return snapNames, err
+		}
 		err = r.Check(context.TODO(), nil)
 		r.Close()
 		snapNames = append(snapNames, r.Snap)
@@ -928,11 +1038,18 @@ type SnapshotExport struct {
 	// contentHash of the full snapshot
 	contentHash []byte
 
+	// snapshots in the set
+	snapshots []*client.Snapshot
+
 	// remember setID mostly for nicer errors
 	setID uint64
 
 	// cached size, needs to be calculated with CalculateSize
 	size int64
+
+	// cached sizes of the regular snapshots the incremental snapshot
+	// files are exported as, keyed by index in snapshotFiles
+	fullSizes map[int]int64
 }
 
 // NewSnapshotExport will return a SnapshotExport structure. It must be
@@ -986,7 +1103,7 @@ func NewSnapshotExport(ctx context.Context, setID uint64) (se *SnapshotExport, e
 	if err != nil {
 		return nil, fmt.Errorf("cannot calculate content hash for snapshot export %v: %v", setID, err)
 	}
-	se = &SnapshotExport{snapshotFiles: snapshotFiles, setID: setID, contentHash: h}
+	se = &SnapshotExport{snapshotFiles: snapshotFiles, setID: setID, contentHash: h, snapshots: snapshotSet.Snapshots}
 
 	// ensure we never leak FDs even if the user does not call close
 	runtime.SetFinalizer(se, (*SnapshotExport).Close)
@@ -1014,6 +1131,34 @@ func (se *SnapshotExport) Init() error {
 	return nil
 }
 
+// fullSize returns the size of the regular snapshot the i-th snapshot file,
+// which is incremental, is exported as.
+func (se *SnapshotExport) fullSize(i int, idx chunkIndex) (int64, error) {
+	if sz, ok := se.fullSizes[i]; ok {
+		return sz, nil
+	}
+	var sz osutil.Sizer
+	if err := writeFullSnapshot(&sz, se.snapshotFiles[i], idx); err != nil {
+		return 0, err
+	}
+	if se.fullSizes == nil {
+		se.fullSizes = make(map[int]int64)
+	}
+	se.fullSizes[i] = sz.Size()
+	return sz.Size(), nil
+}
+
+// CheckKey verifies that the key can decrypt the encrypted snapshots of the
+// set; the export itself carries them as they are, encrypted.
+func (se *SnapshotExport) CheckKey(key *client.SnapshotKey) error {
+	for _, snapshot := range se.snapshots {
+		if err := CheckKey(snapshot, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (se *SnapshotExport) Size() int64 {
 	return se.size
 }
@@ -1055,7 +1200,7 @@ func (se *SnapshotExport) StreamTo(w io.Writer) error {
 	}
 
 	// write out the individual snapshots
-	for _, snapshotFile := range se.snapshotFiles {
+	for i, snapshotFile := range se.snapshotFiles {
 		stat, err := snapshotFile.Stat()
 		if err != nil {
 			return err
@@ -1064,6 +1209,12 @@ func (se *SnapshotExport) StreamTo(w io.Writer) error {
 			// should never happen
 			return fmt.Errorf("unexported special file %q in snapshot: %s", stat.Name(), stat.Mode())
 		}
+		// incremental snapshots are exported as regular ones, as
+		// the chunks they reference might not be there on import
+		idx, err := readChunkIndex(snapshotFile)
+		if err != nil {
+			return fmt.Errorf("cannot read chunk index of %v: %v", stat.Name(), err)
+		}
 		if _, err := snapshotFile.Seek(0, 0); err != nil {
 			return fmt.Errorf("cannot seek on %v: %v", stat.Name(), err)
 		}
@@ -1071,10 +1222,22 @@ func (se *SnapshotExport) StreamTo(w io.Writer) error {
 		if err != nil {
 			return fmt.Errorf("symlink: %v", stat.Name())
 		}
+		if idx != nil {
+			sz, err := se.fullSize(i, idx)
+			if err != nil {
+				return fmt.Errorf("cannot calculate the size of %v: %v", stat.Name(), err)
+			}
+			hdr.Size = sz
+		}
 		if err = tw.WriteHeader(hdr); err != nil {
 			return fmt.Errorf("cannot write header for %v: %v", stat.Name(), err)
 		}
-		if _, err := io.Copy(tw, snapshotFile); err != nil {
+		if idx != nil {
+			err = writeFullSnapshot(tw, snapshotFile, idx)
+		} else {
+			_, err = io.Copy(tw, snapshotFile)
+		}
+		if err != nil {
 			return fmt.Errorf("cannot write data for %v: %v", stat.Name(), err)
 		}
 
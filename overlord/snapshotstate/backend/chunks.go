@@ -0,0 +1,434 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package backend
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+)
+
+// Incremental snapshots do not carry the data of their archives inside the
+// snapshot zip file. Instead, the uncompressed tar stream of every archive is
+// split into content-defined chunks, each chunk is gzip-compressed on its own
+// and stored once in a content-addressed chunk store shared by all snapshots.
+// The snapshot zip file then only carries a chunk index listing, for every
+// archive, the chunks it is made of.
+//
+// As concatenated gzip members form a valid gzip stream, the data of an
+// archive is the concatenation of its compressed chunks, and the hash and
+// size recorded in the snapshot metadata are those of that concatenation.
+// They are not the same as the hash and size of the archive in a regular
+// snapshot of the same data, which is compressed as a single gzip member,
+// but they do hold for the data resolved from the chunks. This means a
+// regular snapshot, whose metadata checks out, can be produced from an
+// incremental one by just resolving its chunks, which is what export does.
+
+const chunkIndexName = "chunks.json"
+
+var (
+	// chunk boundaries are determined by a gear rolling hash over the
+	// uncompressed data, so that inserting or removing data only affects
+	// the chunks around the change; with these values chunks are ~2MiB on
+	// average.
+	chunkMinSize      = 512 * 1024
+	chunkMaxSize      = 8 * 1024 * 1024
+	chunkBits    uint = 21
+
+	// chunkStoreLock protects the chunk store from garbage collection
+	// while incremental snapshots are being saved.
+	chunkStoreLock sync.RWMutex
+)
+
+// gearTable holds the values mixed into the rolling hash for every byte; it
+// must never change, as that would change the chunk boundaries and thus
+// defeat deduplication against existing snapshots.
+var gearTable [256]uint64
+
+func init() {
+	// splitmix64, with a fixed seed
+	seed := uint64(0x736e617073686f74)
+	for i := range gearTable {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gearTable[i] = z ^ (z >> 31)
+	}
+}
+
+// chunksDir returns the directory of the chunk store.
+func chunksDir() string {
+	return filepath.Join(dirs.SnapshotsDir, "chunks")
+}
+
+// chunkPath returns the path of the chunk with the given hash in the chunk
+// store.
+func chunkPath(sum string) string {
+	return filepath.Join(chunksDir(), sum[:2], sum)
+}
+
+// chunkRef references a chunk in the chunk store.
+type chunkRef struct {
+	SHA3_384 string `json:"sha3-384"`
+	Size     int64  `json:"size"`
+}
+
+// chunkIndex maps the archive entries of an incremental snapshot to the
+// chunks their data is made of.
+type chunkIndex map[string][]chunkRef
+
+// size returns the total size of the data of the given entry.
+func (idx chunkIndex) size(entry string) int64 {
+	var sz int64
+	for _, ref := range idx[entry] {
+		sz += ref.Size
+	}
+	return sz
+}
+
+// readChunkIndex returns the chunk index of the snapshot in f, or nil if the
+// snapshot is not an incremental one.
+func readChunkIndex(f *os.File) (chunkIndex, error) {
+	if _, err := f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	arch, err := zip.NewReader(f, fi.Size())
+	if err != nil {
+		return nil, err
+	}
+	for _, fh := range arch.File {
+		if fh.Name != chunkIndexName {
+			continue
+		}
+		r, err := fh.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		var idx chunkIndex
+		if err := json.NewDecoder(r).Decode(&idx); err != nil {
+			return nil, fmt.Errorf("cannot decode chunk index: %v", err)
+		}
+		return idx, nil
+	}
+
+	return nil, nil
+}
+
+// chunkWriter splits the data written to it into content-defined chunks, and
+// hands them over to store.
+type chunkWriter struct {
+	buf []byte
+	// pos is how far into buf the rolling hash has gone
+	pos   int
+	h     uint64
+	store func(chunk []byte) error
+}
+
+func (cw *chunkWriter) Write(p []byte) (int, error) {
+	cw.buf = append(cw.buf, p...)
+	for cw.pos < len(cw.buf) {
+		// the gear hash only depends on the last 64 bytes, so there is
+		// no need to hash what comes before those in a minimal chunk
+		if skipTo := chunkMinSize - 64; cw.pos < skipTo {
+			if len(cw.buf) < skipTo {
+				cw.pos = len(cw.buf)
+				break
+			}
+			cw.pos = skipTo
+		}
+		cw.h = (cw.h << 1) + gearTable[cw.buf[cw.pos]]
+		cw.pos++
+		if cw.pos >= chunkMaxSize || (cw.pos >= chunkMinSize && cw.h>>(64-chunkBits) == 0) {
+			if err := cw.flush(cw.pos); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(p), nil
+}
+
+func (cw *chunkWriter) flush(n int) error {
+	if err := cw.store(cw.buf[:n]); err != nil {
+		return err
+	}
+	cw.buf = append(cw.buf[:0], cw.buf[n:]...)
+	cw.pos = 0
+	cw.h = 0
+	return nil
+}
+
+// Close stores whatever data is left as the last chunk.
+func (cw *chunkWriter) Close() error {
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	return cw.flush(len(cw.buf))
+}
+
+// newChunkWriter returns a chunkWriter that compresses and stores chunks in
+// the chunk store, recording them in the index for the given entry. The
+// compressed data of every chunk is also written to w.
+func newChunkWriter(idx chunkIndex, entry string, w io.Writer) *chunkWriter {
+	var buf bytes.Buffer
+	hasher := crypto.SHA3_384.New()
+	// make sure the entry is in the index even if there is no data
+	idx[entry] = []chunkRef{}
+	return &chunkWriter{store: func(chunk []byte) error {
+		buf.Reset()
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(chunk); err != nil {
+			return err
+		}
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		hasher.Reset()
+		hasher.Write(buf.Bytes())
+		sum := fmt.Sprintf("%x", hasher.Sum(nil))
+
+		if err := storeChunk(sum, buf.Bytes()); err != nil {
+			return err
+		}
+		idx[entry] = append(idx[entry], chunkRef{SHA3_384: sum, Size: int64(buf.Len())})
+		_, err := w.Write(buf.Bytes())
+		return err
+	}}
+}
+
+// storeChunk stores the given data in the chunk store, unless a chunk with
+// the same hash is there already.
+func storeChunk(sum string, data []byte) error {
+	p := chunkPath(sum)
+	if osutil.FileExists(p) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	return osutil.AtomicWriteFile(p, data, 0600, 0)
+}
+
+// chunkReader reads the concatenated data of a list of chunks from the chunk
+// store.
+type chunkReader struct {
+	chunks []chunkRef
+	cur    *os.File
+	read   int64
+}
+
+func newChunkReader(chunks []chunkRef) *chunkReader {
+	return &chunkReader{chunks: chunks}
+}
+
+func (cr *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if cr.cur == nil {
+			if len(cr.chunks) == 0 {
+				return 0, io.EOF
+			}
+			f, err := os.Open(chunkPath(cr.chunks[0].SHA3_384))
+			if err != nil {
+				if os.IsNotExist(err) {
+					return 0, fmt.Errorf("missing snapshot chunk %.7s…", cr.chunks[0].SHA3_384)
+				}
+				return 0, err
+			}
+			cr.cur = f
+			cr.read = 0
+		}
+		n, err := cr.cur.Read(p)
+		cr.read += int64(n)
+		if err == io.EOF {
+			ref := cr.chunks[0]
+			cr.cur.Close()
+			cr.cur = nil
+			cr.chunks = cr.chunks[1:]
+			if cr.read != ref.Size {
+				return n, fmt.Errorf("snapshot chunk %.7s… size (%d) different from actual (%d)", ref.SHA3_384, ref.Size, cr.read)
+			}
+			if n == 0 {
+				continue
+			}
+			return n, nil
+		}
+		return n, err
+	}
+}
+
+func (cr *chunkReader) Close() error {
+	if cr.cur != nil {
+		return cr.cur.Close()
+	}
+	return nil
+}
+
+// writeFullSnapshot writes to w a regular snapshot equivalent to the
+// incremental snapshot in f, resolving the data of its archives from the
+// chunk store.
+func writeFullSnapshot(w io.Writer, f *os.File, idx chunkIndex) error {
+	zw := zip.NewWriter(w)
+
+	entries := make([]string, 0, len(idx))
+	for entry := range idx {
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+
+	for _, entry := range entries {
+		ew, err := zw.CreateHeader(&zip.FileHeader{Name: entry})
+		if err != nil {
+			return err
+		}
+		cr := newChunkReader(idx[entry])
+		_, err = io.Copy(ew, cr)
+		cr.Close()
+		if err != nil {
+			return fmt.Errorf("cannot resolve snapshot entry %q: %v", entry, err)
+		}
+	}
+
+	for _, member := range []string{metadataName, metaHashName} {
+		mr, _, err := zipMember(f, member)
+		if err != nil {
+			return err
+		}
+		mw, err := zw.Create(member)
+		if err == nil {
+			_, err = io.Copy(mw, mr)
+		}
+		mr.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// CleanupUnreferencedChunks removes from the chunk store the chunks that are
+// no longer referenced by any incremental snapshot. Nothing is done if an
+// incremental snapshot is being saved at the time.
+//
+// The amount of chunks removed is returned, and an error if the chunks in use
+// could not be determined or one or more removals did not succeed.
+func CleanupUnreferencedChunks() (removed int, err error) {
+	if !chunkStoreLock.TryLock() {
+		logger.Debugf("Not cleaning up snapshot chunks while a snapshot is being saved.")
+		return 0, nil
+	}
+	defer chunkStoreLock.Unlock()
+
+	shards, err := os.ReadDir(chunksDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			// no chunks, nothing to do
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	referenced, err := referencedChunks()
+	if err != nil {
+		return 0, fmt.Errorf("cannot determine snapshot chunks in use: %v", err)
+	}
+
+	var errs []error
+	for _, shard := range shards {
+		if !shard.IsDir() {
+			continue
+		}
+		shardDir := filepath.Join(chunksDir(), shard.Name())
+		chunks, err := os.ReadDir(shardDir)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, chunk := range chunks {
+			if referenced[chunk.Name()] {
+				continue
+			}
+			if err := os.Remove(filepath.Join(shardDir, chunk.Name())); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			removed++
+		}
+	}
+	if len(errs) > 0 {
+		return removed, newMultiError("cannot cleanup snapshot chunks", errs)
+	}
+	return removed, nil
+}
+
+// referencedChunks returns the hashes of all the chunks referenced by the
+// snapshots in the snapshots directory.
+func referencedChunks() (map[string]bool, error) {
+	filenames, err := filepathGlob(filepath.Join(dirs.SnapshotsDir, "*.zip"))
+	if err != nil {
+		return nil, err
+	}
+
+	referenced := make(map[string]bool)
+	for _, fn := range filenames {
+		ok, setID := isSnapshotFilename(fn)
+		if !ok || importInProgressFor(setID) {
+			// imports always produce regular snapshots
+			continue
+		}
+		idx, err := readChunkIndexFromFile(fn)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read chunk index of %q: %v", fn, err)
+		}
+		for _, chunks := range idx {
+			for _, ref := range chunks {
+				referenced[ref.SHA3_384] = true
+			}
+		}
+	}
+
+	return referenced, nil
+}
+
+func readChunkIndexFromFile(fn string) (chunkIndex, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readChunkIndex(f)
+}
@@ -0,0 +1,279 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package backend_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/testutil"
+)
+
+func zipMembers(c *check.C, fn string) []string {
+	r, err := zip.OpenReader(fn)
+	c.Assert(err, check.IsNil)
+	defer r.Close()
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func chunkFiles(c *check.C) []string {
+	chunks, err := filepath.Glob(filepath.Join(backend.ChunksDir(), "*", "*"))
+	c.Assert(err, check.IsNil)
+	return chunks
+}
+
+func (s *snapshotSuite) TestIncrementalRoundtrip(c *check.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("this test cannot run as root (runuser will fail)")
+	}
+	logger.SimpleSetup(nil)
+
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42), SnapID: "hello-id"}, Version: "v1.33"}
+	cfg := map[string]interface{}{"some-setting": false}
+
+	shw, err := backend.SaveIncremental(context.TODO(), 12, info, cfg, []string{"snapuser"}, nil, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(shw.SetID, check.Equals, uint64(12))
+	c.Check(hashkeys(shw), check.DeepEquals, []string{"archive.tgz", "user/snapuser.tgz"})
+	c.Check(shw.Size > 0, check.Equals, true)
+
+	// the data lives in the chunk store, not in the snapshot itself
+	c.Check(zipMembers(c, backend.Filename(shw)), check.DeepEquals, []string{"chunks.json", "meta.json", "meta.sha3_384"})
+	c.Check(chunkFiles(c), check.HasLen, 2)
+
+	shs, err := backend.List(context.TODO(), 0, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(shs, check.HasLen, 1)
+	c.Assert(shs[0].Snapshots, check.HasLen, 1)
+	c.Check(shs[0].Snapshots[0].SHA3_384, check.DeepEquals, shw.SHA3_384)
+
+	shr, err := backend.Open(backend.Filename(shw), backend.ExtractFnameSetID)
+	c.Assert(err, check.IsNil)
+	defer shr.Close()
+	c.Check(shr.Check(context.TODO(), nil), check.IsNil)
+
+	newroot := c.MkDir()
+	c.Assert(os.MkdirAll(filepath.Join(newroot, "home/snapuser"), 0755), check.IsNil)
+	// the chunks are looked up in the snapshots directory of the new root
+	chunksDir := backend.ChunksDir()
+	dirs.SetRootDir(newroot)
+	c.Assert(os.MkdirAll(dirs.SnapshotsDir, 0700), check.IsNil)
+	c.Assert(exec.Command("cp", "-a", chunksDir, dirs.SnapshotsDir).Run(), check.IsNil)
+
+	rs, err := shr.Restore(context.TODO(), snap.R(0), nil, logger.Debugf, nil)
+	c.Assert(err, check.IsNil)
+	rs.Cleanup()
+	c.Check(exec.Command("diff", "-urN", "-x*.zip", "-xchunks", s.root, newroot).Run(), check.IsNil)
+}
+
+func (s *snapshotSuite) TestIncrementalSameAsRegular(c *check.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("this test cannot run as root (runuser will fail)")
+	}
+
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42), SnapID: "hello-id"}, Version: "v1.33"}
+
+	incremental, err := backend.SaveIncremental(context.TODO(), 1, info, nil, []string{"snapuser"}, nil, nil)
+	c.Assert(err, check.IsNil)
+	// chunks are compressed one by one, so the data is different to that
+	// of a regular snapshot, but it is still a valid gzip stream
+	regular, err := backend.Save(context.TODO(), 2, info, nil, []string{"snapuser"}, nil, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(hashkeys(incremental), check.DeepEquals, hashkeys(regular))
+
+	rdr, err := backend.Open(backend.Filename(incremental), backend.ExtractFnameSetID)
+	c.Assert(err, check.IsNil)
+	defer rdr.Close()
+	sz, ok, err := backend.ChunkIndexSize(rdr.File, "archive.tgz")
+	c.Assert(err, check.IsNil)
+	c.Check(ok, check.Equals, true)
+	c.Check(sz > 0, check.Equals, true)
+
+	rdr2, err := backend.Open(backend.Filename(regular), backend.ExtractFnameSetID)
+	c.Assert(err, check.IsNil)
+	defer rdr2.Close()
+	_, ok, err = backend.ChunkIndexSize(rdr2.File, "archive.tgz")
+	c.Assert(err, check.IsNil)
+	c.Check(ok, check.Equals, false)
+}
+
+func (s *snapshotSuite) TestIncrementalDeduplicates(c *check.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("this test cannot run as root (runuser will fail)")
+	}
+	defer backend.MockChunkSizes(4096, 64*1024, 10)()
+
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42), SnapID: "hello-id"}, Version: "v1.33"}
+	// some data big enough to be split in chunks
+	data := make([]byte, 512*1024)
+	rand.New(rand.NewSource(42)).Read(data)
+	bigFile := filepath.Join(info.DataDir(), "big")
+	c.Assert(os.WriteFile(bigFile, data, 0644), check.IsNil)
+
+	sh1, err := backend.SaveIncremental(context.TODO(), 1, info, nil, []string{"snapuser"}, nil, nil)
+	c.Assert(err, check.IsNil)
+	chunks1 := chunkFiles(c)
+	c.Check(len(chunks1) > 3, check.Equals, true)
+
+	// nothing changed, nothing new is stored
+	sh2, err := backend.SaveIncremental(context.TODO(), 2, info, nil, []string{"snapuser"}, nil, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(sh2.SHA3_384, check.DeepEquals, sh1.SHA3_384)
+	c.Check(chunkFiles(c), check.DeepEquals, chunks1)
+
+	// a change only stores the chunks around it
+	copy(data[256*1024:], "some change")
+	c.Assert(os.WriteFile(bigFile, data, 0644), check.IsNil)
+	sh3, err := backend.SaveIncremental(context.TODO(), 3, info, nil, []string{"snapuser"}, nil, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(sh3.SHA3_384["archive.tgz"], check.Not(check.Equals), sh1.SHA3_384["archive.tgz"])
+	c.Check(sh3.SHA3_384["user/snapuser.tgz"], check.Equals, sh1.SHA3_384["user/snapuser.tgz"])
+	chunks3 := chunkFiles(c)
+	c.Check(len(chunks3) > len(chunks1), check.Equals, true)
+	c.Check(len(chunks3) < 2*len(chunks1), check.Equals, true)
+
+	rdr, err := backend.Open(backend.Filename(sh3), backend.ExtractFnameSetID)
+	c.Assert(err, check.IsNil)
+	defer rdr.Close()
+	c.Check(rdr.Check(context.TODO(), nil), check.IsNil)
+}
+
+func (s *snapshotSuite) TestIncrementalCheckMissingChunk(c *check.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("this test cannot run as root (runuser will fail)")
+	}
+
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42), SnapID: "hello-id"}, Version: "v1.33"}
+	shw, err := backend.SaveIncremental(context.TODO(), 1, info, nil, []string{"snapuser"}, nil, nil)
+	c.Assert(err, check.IsNil)
+
+	c.Assert(os.RemoveAll(backend.ChunksDir()), check.IsNil)
+
+	rdr, err := backend.Open(backend.Filename(shw), backend.ExtractFnameSetID)
+	c.Assert(err, check.IsNil)
+	defer rdr.Close()
+	c.Check(rdr.Check(context.TODO(), nil), check.ErrorMatches, "missing snapshot chunk .*")
+}
+
+func (s *snapshotSuite) TestCleanupUnreferencedChunks(c *check.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("this test cannot run as root (runuser will fail)")
+	}
+
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42), SnapID: "hello-id"}, Version: "v1.33"}
+	sh1, err := backend.SaveIncremental(context.TODO(), 1, info, nil, []string{"snapuser"}, nil, nil)
+	c.Assert(err, check.IsNil)
+	sh2, err := backend.SaveIncremental(context.TODO(), 2, info, nil, []string{"snapuser"}, nil, nil)
+	c.Assert(err, check.IsNil)
+	chunks := chunkFiles(c)
+	c.Check(chunks, check.HasLen, 2)
+
+	// chunks still used by the second snapshot are kept
+	c.Assert(os.Remove(backend.Filename(sh1)), check.IsNil)
+	n, err := backend.CleanupUnreferencedChunks()
+	c.Assert(err, check.IsNil)
+	c.Check(n, check.Equals, 0)
+	c.Check(chunkFiles(c), check.DeepEquals, chunks)
+
+	rdr, err := backend.Open(backend.Filename(sh2), backend.ExtractFnameSetID)
+	c.Assert(err, check.IsNil)
+	c.Check(rdr.Check(context.TODO(), nil), check.IsNil)
+	rdr.Close()
+
+	c.Assert(os.Remove(backend.Filename(sh2)), check.IsNil)
+	n, err = backend.CleanupUnreferencedChunks()
+	c.Assert(err, check.IsNil)
+	c.Check(n, check.Equals, 2)
+	c.Check(chunkFiles(c), check.HasLen, 0)
+}
+
+func (s *snapshotSuite) TestCleanupUnreferencedChunksNoChunks(c *check.C) {
+	n, err := backend.CleanupUnreferencedChunks()
+	c.Assert(err, check.IsNil)
+	c.Check(n, check.Equals, 0)
+}
+
+func (s *snapshotSuite) TestCleanupUnreferencedChunksUnreadableSnapshot(c *check.C) {
+	chunk := filepath.Join(backend.ChunksDir(), "ab", "abcdef")
+	c.Assert(os.MkdirAll(filepath.Dir(chunk), 0700), check.IsNil)
+	c.Assert(os.WriteFile(chunk, nil, 0600), check.IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dirs.SnapshotsDir, "1_foo_1.0_1.zip"), []byte("not a zip"), 0600), check.IsNil)
+
+	// unable to know what chunks are in use, nothing is removed
+	n, err := backend.CleanupUnreferencedChunks()
+	c.Assert(err, check.ErrorMatches, `cannot determine snapshot chunks in use: cannot read chunk index of ".*/1_foo_1.0_1.zip": zip: not a valid zip file`)
+	c.Check(n, check.Equals, 0)
+	c.Check(chunk, testutil.FilePresent)
+}
+
+func (s *snapshotSuite) TestIncrementalExportImportRoundtrip(c *check.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("this test cannot run as root (runuser will fail)")
+	}
+	ctx := context.TODO()
+
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42), SnapID: "hello-id"}, Version: "v1.33"}
+	cfg := map[string]interface{}{"some-setting": false}
+	shw, err := backend.SaveIncremental(ctx, 12, info, cfg, []string{"snapuser"}, nil, nil)
+	c.Assert(err, check.IsNil)
+
+	export, err := backend.NewSnapshotExport(ctx, shw.SetID)
+	c.Assert(err, check.IsNil)
+	c.Assert(export.Init(), check.IsNil)
+
+	buf := bytes.NewBuffer(nil)
+	c.Assert(export.StreamTo(buf), check.IsNil)
+	c.Check(buf.Len(), check.Equals, int(export.Size()))
+	export.Close()
+
+	// the export does not need the chunk store
+	c.Assert(os.Remove(backend.Filename(shw)), check.IsNil)
+	c.Assert(os.RemoveAll(backend.ChunksDir()), check.IsNil)
+
+	names, err := backend.Import(ctx, 123, buf, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(names, check.DeepEquals, []string{"hello-snap"})
+
+	fn := filepath.Join(dirs.SnapshotsDir, "123_hello-snap_v1.33_42.zip")
+	c.Check(zipMembers(c, fn), check.DeepEquals, []string{"archive.tgz", "meta.json", "meta.sha3_384", "user/snapuser.tgz"})
+	rdr, err := backend.Open(fn, backend.ExtractFnameSetID)
+	c.Assert(err, check.IsNil)
+	defer rdr.Close()
+	c.Check(rdr.SHA3_384, check.DeepEquals, shw.SHA3_384)
+	c.Check(rdr.Size, check.Equals, shw.Size)
+	c.Check(rdr.Check(ctx, nil), check.IsNil)
+}
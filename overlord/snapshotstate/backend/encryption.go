@@ -0,0 +1,388 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package backend
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/gadget/device"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/secboot"
+)
+
+// The archives of encrypted snapshots are stored in the snapshot zip file
+// encrypted with AES-256-GCM, using a key derived for every archive from the
+// snapshot key. Archives are encrypted in segments so that they can be
+// streamed; every segment carries its position and whether it is the last one
+// in its nonce, so segments cannot be reordered or dropped without this being
+// detected.
+//
+// The hashes and sizes in the snapshot metadata are those of the unencrypted
+// archives, so checking an encrypted snapshot also verifies that it decrypts
+// to the data that was saved. The snap configuration is encrypted as well,
+// and stored in its own member instead of the metadata.
+//
+// The snapshot key is either derived from a passphrase, or from a random key
+// sealed to the TPM of the device, which is stored on the encrypted
+// ubuntu-data partition. The device key is only bound to the TPM, not to the
+// boot chain or the model as the keys of the encrypted partitions are: the
+// sealed key is only protected by the encryption of ubuntu-data, and anyone
+// with a copy of it can unseal it with any OS booted on the device.
+
+const (
+	encryptedConfName = "conf.json"
+
+	encryptionKeySize     = 32
+	encryptionSaltSize    = 16
+	encryptionSegmentSize = 64 * 1024
+
+	keyCheckInfo = "snapd snapshot key check"
+)
+
+var (
+	// argon2id parameters for keys derived from passphrases; changing
+	// them makes existing snapshots impossible to decrypt
+	passphraseKDFTime    uint32 = 3
+	passphraseKDFMemory  uint32 = 32 * 1024
+	passphraseKDFThreads uint8  = 4
+
+	deviceKey = deviceKeyImpl
+
+	secbootSealDeviceBoundKey   = secboot.SealDeviceBoundKey
+	secbootUnsealDeviceBoundKey = secboot.UnsealDeviceBoundKey
+)
+
+var deviceKeyMu sync.Mutex
+
+// deviceKeyImpl returns the key device-bound snapshot keys are derived from.
+// It is a random key sealed to the TPM through secboot the first time it is
+// needed, and stored along with the keys of the encrypted partitions.
+func deviceKeyImpl() ([]byte, error) {
+	if !device.HasEncryptedMarkerUnder(dirs.SnapFDEDir) {
+		return nil, errors.New("cannot use device key: device is not encrypted")
+	}
+
+	deviceKeyMu.Lock()
+	defer deviceKeyMu.Unlock()
+
+	keyFile := device.SnapshotSealedKeyUnder(dirs.SnapFDEDir)
+	if osutil.FileExists(keyFile) {
+		key, err := secbootUnsealDeviceBoundKey(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot use device key: %v", err)
+		}
+		return key, nil
+	}
+
+	key := make([]byte, encryptionKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	if err := secbootSealDeviceBoundKey(key, keyFile); err != nil {
+		return nil, fmt.Errorf("cannot use device key: %v", err)
+	}
+	return key, nil
+}
+
+// KeyRequiredError is returned when a snapshot is encrypted and the key
+// needed to decrypt it was not given.
+type KeyRequiredError struct {
+	// KeySource is the source of the key of the snapshot, one of
+	// client.SnapshotKeySourcePassphrase or client.SnapshotKeySourceDevice.
+	KeySource string
+}
+
+func (e *KeyRequiredError) Error() string {
+	return client.ErrSnapshotKeyRequired.Error()
+}
+
+func (e *KeyRequiredError) Is(err error) bool {
+	return err == client.ErrSnapshotKeyRequired
+}
+
+type encryptionKey []byte
+
+// newEncryption returns the encryption metadata and the key for a new
+// snapshot encrypted with the given key.
+func newEncryption(key *client.SnapshotKey) (*client.SnapshotEncryption, encryptionKey, error) {
+	if err := key.Validate(); err != nil {
+		return nil, nil, err
+	}
+	enc := &client.SnapshotEncryption{
+		KeySource: key.Source(),
+		Salt:      make([]byte, encryptionSaltSize),
+	}
+	if _, err := io.ReadFull(rand.Reader, enc.Salt); err != nil {
+		return nil, nil, err
+	}
+	k, err := deriveKey(key, enc)
+	if err != nil {
+		return nil, nil, err
+	}
+	enc.KeyCheck = k.check()
+	return enc, k, nil
+}
+
+func deriveKey(key *client.SnapshotKey, enc *client.SnapshotEncryption) (encryptionKey, error) {
+	switch enc.KeySource {
+	case client.SnapshotKeySourcePassphrase:
+		if key.Passphrase == "" {
+			return nil, &KeyRequiredError{KeySource: enc.KeySource}
+		}
+		return argon2.IDKey([]byte(key.Passphrase), enc.Salt, passphraseKDFTime, passphraseKDFMemory, passphraseKDFThreads, encryptionKeySize), nil
+	case client.SnapshotKeySourceDevice:
+		if !key.Device {
+			return nil, &KeyRequiredError{KeySource: enc.KeySource}
+		}
+		dk, err := deviceKey()
+		if err != nil {
+			return nil, err
+		}
+		return readKey(hkdf.New(sha256.New, dk, enc.Salt, []byte("snapd snapshot device key")))
+	default:
+		return nil, fmt.Errorf("unsupported snapshot key source %q", enc.KeySource)
+	}
+}
+
+func readKey(r io.Reader) (encryptionKey, error) {
+	k := make(encryptionKey, encryptionKeySize)
+	if _, err := io.ReadFull(r, k); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (k encryptionKey) check() []byte {
+	mac := hmac.New(sha256.New, k)
+	mac.Write([]byte(keyCheckInfo))
+	return mac.Sum(nil)
+}
+
+// unlockKey returns the key for the snapshot with the given encryption
+// metadata, verifying that it is the right one.
+func unlockKey(key *client.SnapshotKey, enc *client.SnapshotEncryption) (encryptionKey, error) {
+	if key == nil {
+		return nil, &KeyRequiredError{KeySource: enc.KeySource}
+	}
+	k, err := deriveKey(key, enc)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(k.check(), enc.KeyCheck) {
+		return nil, client.ErrSnapshotKeyInvalid
+	}
+	return k, nil
+}
+
+// CheckKey verifies that the key can decrypt the given snapshot. It is a
+// no-op for snapshots that are not encrypted.
+func CheckKey(snapshot *client.Snapshot, key *client.SnapshotKey) error {
+	if snapshot.Encryption == nil {
+		return nil
+	}
+	_, err := unlockKey(key, snapshot.Encryption)
+	return err
+}
+
+// CheckKeySource verifies that the key is of the kind needed to decrypt the
+// given snapshot, without deriving it. Verifying that it is the right key is
+// slow, and only done when unlocking the snapshot. It is a no-op for
+// snapshots that are not encrypted.
+func CheckKeySource(snapshot *client.Snapshot, key *client.SnapshotKey) error {
+	if snapshot.Encryption == nil {
+		return nil
+	}
+	if key == nil || key.Source() != snapshot.Encryption.KeySource {
+		return &KeyRequiredError{KeySource: snapshot.Encryption.KeySource}
+	}
+	return nil
+}
+
+// aead returns the cipher for the given member of the snapshot.
+func (k encryptionKey) aead(entry string) (cipher.AEAD, error) {
+	ek, err := readKey(hkdf.New(sha256.New, k, nil, []byte("snapd snapshot entry "+entry)))
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(ek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func segmentNonce(nonce []byte, counter uint64, last bool) []byte {
+	binary.BigEndian.PutUint64(nonce[len(nonce)-9:], counter)
+	nonce[len(nonce)-1] = 0
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// decryptedSize returns the size of the data that is encrypted as size bytes.
+func decryptedSize(size int64, overhead int) int64 {
+	full := int64(encryptionSegmentSize + overhead)
+	segments := (size + full - 1) / full
+	return size - segments*int64(overhead)
+}
+
+// encryptingWriter encrypts what is written to it into w; it must be closed
+// to write out the last segment.
+type encryptingWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	entry   []byte
+	nonce   []byte
+	counter uint64
+	buf     []byte
+	out     []byte
+}
+
+func newEncryptingWriter(k encryptionKey, entry string, w io.Writer) (*encryptingWriter, error) {
+	aead, err := k.aead(entry)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptingWriter{
+		w:     w,
+		aead:  aead,
+		entry: []byte(entry),
+		nonce: make([]byte, aead.NonceSize()),
+		buf:   make([]byte, 0, encryptionSegmentSize),
+	}, nil
+}
+
+func (ew *encryptingWriter) Write(p []byte) (int, error) {
+	var n int
+	for len(p) > 0 {
+		// the segment is only sealed once there is more data, so
+		// that the last one is always written by Close
+		if len(ew.buf) == encryptionSegmentSize {
+			if err := ew.seal(false); err != nil {
+				return n, err
+			}
+		}
+		m := copy(ew.buf[len(ew.buf):cap(ew.buf)], p)
+		ew.buf = ew.buf[:len(ew.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+func (ew *encryptingWriter) seal(last bool) error {
+	ew.out = ew.aead.Seal(ew.out[:0], segmentNonce(ew.nonce, ew.counter, last), ew.buf, ew.entry)
+	ew.counter++
+	ew.buf = ew.buf[:0]
+	_, err := ew.w.Write(ew.out)
+	return err
+}
+
+func (ew *encryptingWriter) Close() error {
+	return ew.seal(true)
+}
+
+// decryptingReader decrypts the data written by an encryptingWriter.
+type decryptingReader struct {
+	rc      io.ReadCloser
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	entry   []byte
+	nonce   []byte
+	counter uint64
+	buf     []byte
+	plain   []byte
+	done    bool
+}
+
+func newDecryptingReader(k encryptionKey, entry string, rc io.ReadCloser) (*decryptingReader, error) {
+	aead, err := k.aead(entry)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptingReader{
+		rc:    rc,
+		r:     bufio.NewReader(rc),
+		aead:  aead,
+		entry: []byte(entry),
+		nonce: make([]byte, aead.NonceSize()),
+		buf:   make([]byte, encryptionSegmentSize+aead.Overhead()),
+	}, nil
+}
+
+func (dr *decryptingReader) Read(p []byte) (int, error) {
+	for len(dr.plain) == 0 {
+		if dr.done {
+			return 0, io.EOF
+		}
+		if err := dr.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, dr.plain)
+	dr.plain = dr.plain[n:]
+	return n, nil
+}
+
+func (dr *decryptingReader) open() error {
+	n, err := io.ReadFull(dr.r, dr.buf)
+	last := false
+	switch err {
+	case nil:
+		if _, err := dr.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	case io.ErrUnexpectedEOF:
+		last = true
+	case io.EOF:
+		return fmt.Errorf("encrypted snapshot entry %q is truncated", dr.entry)
+	default:
+		return err
+	}
+	dr.plain, err = dr.aead.Open(dr.buf[:0], segmentNonce(dr.nonce, dr.counter, last), dr.buf[:n], dr.entry)
+	if err != nil {
+		return fmt.Errorf("cannot decrypt snapshot entry %q: %v", dr.entry, err)
+	}
+	dr.counter++
+	dr.done = last
+	return nil
+}
+
+func (dr *decryptingReader) Close() error {
+	return dr.rc.Close()
+}
@@ -0,0 +1,328 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package backend_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/gadget/device"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
+	"github.com/snapcore/snapd/snap"
+)
+
+var (
+	encInfo = &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42), SnapID: "hello-id"}, Version: "v1.33"}
+	encCfg  = map[string]interface{}{"token": "s3cr3t"}
+)
+
+func (s *snapshotSuite) saveEncrypted(c *check.C, key *client.SnapshotKey) *client.Snapshot {
+	// keep the key derivation cheap in tests
+	s.restore = append(s.restore, backend.MockPassphraseKDF(1, 64, 1))
+	shw, err := backend.SaveEncrypted(context.TODO(), 12, encInfo, encCfg, []string{"snapuser"}, nil, nil, key)
+	c.Assert(err, check.IsNil)
+	return shw
+}
+
+// zipContains returns whether any member of the zip file contains data.
+func zipContains(c *check.C, fn string, data []byte) bool {
+	r, err := zip.OpenReader(fn)
+	c.Assert(err, check.IsNil)
+	defer r.Close()
+	for _, f := range r.File {
+		rc, err := f.Open()
+		c.Assert(err, check.IsNil)
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		c.Assert(err, check.IsNil)
+		if bytes.Contains(content, data) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *snapshotSuite) TestEncryptedRoundtrip(c *check.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("this test cannot run as root (runuser will fail)")
+	}
+	logger.SimpleSetup(nil)
+
+	key := &client.SnapshotKey{Passphrase: "passw0rd"}
+	shw := s.saveEncrypted(c, key)
+	c.Check(hashkeys(shw), check.DeepEquals, []string{"archive.tgz", "user/snapuser.tgz"})
+	c.Assert(shw.Encryption, check.NotNil)
+	c.Check(shw.Encryption.KeySource, check.Equals, "passphrase")
+	c.Check(shw.Encryption.Salt, check.HasLen, 16)
+	c.Check(shw.Conf, check.IsNil)
+
+	fn := backend.Filename(shw)
+	c.Check(zipMembers(c, fn), check.DeepEquals, []string{"archive.tgz", "conf.json", "meta.json", "meta.sha3_384", "user/snapuser.tgz"})
+	// the configuration is not in the clear
+	c.Check(zipContains(c, fn, []byte("s3cr3t")), check.Equals, false)
+
+	shr, err := backend.Open(fn, backend.ExtractFnameSetID)
+	c.Assert(err, check.IsNil)
+	defer shr.Close()
+	c.Check(shr.Conf, check.IsNil)
+	c.Assert(shr.Unlock(key), check.IsNil)
+	c.Check(shr.Conf, check.DeepEquals, map[string]interface{}{"token": "s3cr3t"})
+	c.Check(shr.Check(context.TODO(), nil), check.IsNil)
+
+	newroot := c.MkDir()
+	c.Assert(os.MkdirAll(filepath.Join(newroot, "home/snapuser"), 0755), check.IsNil)
+	dirs.SetRootDir(newroot)
+
+	rs, err := shr.Restore(context.TODO(), snap.R(0), nil, logger.Debugf, nil)
+	c.Assert(err, check.IsNil)
+	rs.Cleanup()
+	c.Check(exec.Command("diff", "-urN", "-x*.zip", s.root, newroot).Run(), check.IsNil)
+}
+
+func (s *snapshotSuite) TestEncryptedSameAsRegular(c *check.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("this test cannot run as root (runuser will fail)")
+	}
+
+	encrypted := s.saveEncrypted(c, &client.SnapshotKey{Passphrase: "passw0rd"})
+	regular, err := backend.Save(context.TODO(), 2, encInfo, nil, []string{"snapuser"}, nil, nil)
+	c.Assert(err, check.IsNil)
+	// hashes and sizes are over the unencrypted data
+	c.Check(encrypted.SHA3_384, check.DeepEquals, regular.SHA3_384)
+	c.Check(encrypted.Size, check.Equals, regular.Size)
+}
+
+func (s *snapshotSuite) TestEncryptedNeedsKey(c *check.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("this test cannot run as root (runuser will fail)")
+	}
+
+	shw := s.saveEncrypted(c, &client.SnapshotKey{Passphrase: "passw0rd"})
+
+	shr, err := backend.Open(backend.Filename(shw), backend.ExtractFnameSetID)
+	c.Assert(err, check.IsNil)
+	defer shr.Close()
+
+	c.Check(shr.Check(context.TODO(), nil), check.DeepEquals, &backend.KeyRequiredError{KeySource: "passphrase"})
+	_, err = shr.Restore(context.TODO(), snap.R(0), nil, logger.Debugf, nil)
+	c.Check(err, check.DeepEquals, &backend.KeyRequiredError{KeySource: "passphrase"})
+
+	c.Check(shr.Unlock(nil), check.DeepEquals, &backend.KeyRequiredError{KeySource: "passphrase"})
+	c.Check(shr.Unlock(&client.SnapshotKey{Passphrase: "wrong"}), check.Equals, client.ErrSnapshotKeyInvalid)
+	c.Check(shr.Unlock(&client.SnapshotKey{Device: true}), check.DeepEquals, &backend.KeyRequiredError{KeySource: "passphrase"})
+	c.Check(backend.CheckKey(&shr.Snapshot, &client.SnapshotKey{Passphrase: "wrong"}), check.Equals, client.ErrSnapshotKeyInvalid)
+	c.Check(backend.CheckKey(&shr.Snapshot, &client.SnapshotKey{Passphrase: "passw0rd"}), check.IsNil)
+}
+
+func (s *snapshotSuite) TestEncryptedTampered(c *check.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("this test cannot run as root (runuser will fail)")
+	}
+
+	key := &client.SnapshotKey{Passphrase: "passw0rd"}
+	shw := s.saveEncrypted(c, key)
+
+	// swap the system and user archives; they are encrypted with
+	// different keys, so this is detected
+	fn := backend.Filename(shw)
+	r, err := zip.OpenReader(fn)
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, f := range r.File {
+		name := f.Name
+		switch name {
+		case "archive.tgz":
+			name = "user/snapuser.tgz"
+		case "user/snapuser.tgz":
+			name = "archive.tgz"
+		}
+		rc, err := f.Open()
+		c.Assert(err, check.IsNil)
+		zw, err := w.CreateHeader(&zip.FileHeader{Name: name})
+		c.Assert(err, check.IsNil)
+		_, err = io.Copy(zw, rc)
+		c.Assert(err, check.IsNil)
+		rc.Close()
+	}
+	c.Assert(w.Close(), check.IsNil)
+	r.Close()
+	c.Assert(os.WriteFile(fn, buf.Bytes(), 0600), check.IsNil)
+
+	shr, err := backend.Open(fn, backend.ExtractFnameSetID)
+	c.Assert(err, check.IsNil)
+	defer shr.Close()
+	c.Assert(shr.Unlock(key), check.IsNil)
+	c.Check(shr.Check(context.TODO(), nil), check.ErrorMatches, `cannot decrypt snapshot entry ".*": cipher: message authentication failed`)
+}
+
+func (s *snapshotSuite) TestEncryptedDeviceKey(c *check.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("this test cannot run as root (runuser will fail)")
+	}
+
+	_, err := backend.SaveEncrypted(context.TODO(), 12, encInfo, encCfg, []string{"snapuser"}, nil, nil, &client.SnapshotKey{Device: true})
+	c.Assert(err, check.ErrorMatches, "cannot use device key: device is not encrypted")
+
+	c.Assert(os.MkdirAll(dirs.SnapFDEDir, 0700), check.IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dirs.SnapFDEDir, "marker"), nil, 0600), check.IsNil)
+
+	// the key is sealed to the TPM the first time it is needed
+	var sealed []byte
+	sealCalls, unsealCalls := 0, 0
+	restore := backend.MockSecbootDeviceBoundKey(func(key []byte, keyFile string) error {
+		sealCalls++
+		c.Check(keyFile, check.Equals, device.SnapshotSealedKeyUnder(dirs.SnapFDEDir))
+		c.Check(key, check.HasLen, 32)
+		sealed = key
+		return os.WriteFile(keyFile, []byte("sealed"), 0600)
+	}, func(keyFile string) ([]byte, error) {
+		unsealCalls++
+		c.Check(keyFile, check.Equals, device.SnapshotSealedKeyUnder(dirs.SnapFDEDir))
+		return sealed, nil
+	})
+	defer restore()
+
+	key := &client.SnapshotKey{Device: true}
+	shw := s.saveEncrypted(c, key)
+	c.Check(shw.Encryption.KeySource, check.Equals, "device")
+
+	shr, err := backend.Open(backend.Filename(shw), backend.ExtractFnameSetID)
+	c.Assert(err, check.IsNil)
+	defer shr.Close()
+	c.Check(shr.Unlock(&client.SnapshotKey{Passphrase: "passw0rd"}), check.DeepEquals, &backend.KeyRequiredError{KeySource: "device"})
+	c.Assert(shr.Unlock(key), check.IsNil)
+	c.Check(shr.Check(context.TODO(), nil), check.IsNil)
+	c.Check(sealCalls, check.Equals, 1)
+	c.Check(unsealCalls, check.Not(check.Equals), 0)
+
+	// a different device cannot decrypt it
+	restore = backend.MockDeviceKey(func() ([]byte, error) {
+		return bytes.Repeat([]byte{2}, 32), nil
+	})
+	defer restore()
+	c.Check(shr.Unlock(key), check.Equals, client.ErrSnapshotKeyInvalid)
+}
+
+func (s *snapshotSuite) TestEncryptedDeviceKeyUnsealError(c *check.C) {
+	c.Assert(os.MkdirAll(dirs.SnapFDEDir, 0700), check.IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dirs.SnapFDEDir, "marker"), nil, 0600), check.IsNil)
+	c.Assert(os.WriteFile(device.SnapshotSealedKeyUnder(dirs.SnapFDEDir), []byte("sealed"), 0600), check.IsNil)
+	restore := backend.MockSecbootDeviceBoundKey(func(key []byte, keyFile string) error {
+		c.Fatalf("unexpected seal")
+		return nil
+	}, func(keyFile string) ([]byte, error) {
+		return nil, errors.New("cannot unseal key: boom")
+	})
+	defer restore()
+
+	_, err := backend.SaveEncrypted(context.TODO(), 12, encInfo, encCfg, []string{"snapuser"}, nil, nil, &client.SnapshotKey{Device: true})
+	c.Assert(err, check.ErrorMatches, "cannot use device key: cannot unseal key: boom")
+}
+
+func (s *snapshotSuite) TestEncryptedDeviceKeyError(c *check.C) {
+	restore := backend.MockDeviceKey(func() ([]byte, error) {
+		return nil, errors.New("boom")
+	})
+	defer restore()
+
+	_, err := backend.SaveEncrypted(context.TODO(), 12, encInfo, encCfg, []string{"snapuser"}, nil, nil, &client.SnapshotKey{Device: true})
+	c.Assert(err, check.ErrorMatches, "boom")
+}
+
+func (s *snapshotSuite) TestEncryptedInvalidKey(c *check.C) {
+	_, err := backend.SaveEncrypted(context.TODO(), 12, encInfo, encCfg, []string{"snapuser"}, nil, nil, &client.SnapshotKey{})
+	c.Assert(err, check.ErrorMatches, "snapshot key requires either a passphrase or the device key")
+}
+
+func (s *snapshotSuite) TestEncryptedExportImportRoundtrip(c *check.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("this test cannot run as root (runuser will fail)")
+	}
+	ctx := context.TODO()
+
+	key := &client.SnapshotKey{Passphrase: "passw0rd"}
+	shw := s.saveEncrypted(c, key)
+
+	export, err := backend.NewSnapshotExport(ctx, shw.SetID)
+	c.Assert(err, check.IsNil)
+	c.Check(export.CheckKey(nil), check.DeepEquals, &backend.KeyRequiredError{KeySource: "passphrase"})
+	c.Check(export.CheckKey(&client.SnapshotKey{Passphrase: "wrong"}), check.Equals, client.ErrSnapshotKeyInvalid)
+	c.Assert(export.CheckKey(key), check.IsNil)
+	c.Assert(export.Init(), check.IsNil)
+
+	buf := bytes.NewBuffer(nil)
+	c.Assert(export.StreamTo(buf), check.IsNil)
+	export.Close()
+	// the export carries the data encrypted
+	c.Check(bytes.Contains(buf.Bytes(), []byte("s3cr3t")), check.Equals, false)
+	c.Assert(os.Remove(backend.Filename(shw)), check.IsNil)
+	data := buf.Bytes()
+
+	// importing needs the key
+	_, err = backend.Import(ctx, 123, bytes.NewReader(data), nil)
+	c.Assert(err, check.ErrorMatches, "cannot import snapshot 123: snapshot set is encrypted and requires a key")
+	c.Check(errors.Is(err, client.ErrSnapshotKeyRequired), check.Equals, true)
+	var keyErr *backend.KeyRequiredError
+	c.Assert(errors.As(err, &keyErr), check.Equals, true)
+	c.Check(keyErr.KeySource, check.Equals, "passphrase")
+	_, err = backend.Import(ctx, 124, bytes.NewReader(data), &backend.ImportFlags{Key: &client.SnapshotKey{Passphrase: "wrong"}})
+	c.Check(errors.Is(err, client.ErrSnapshotKeyInvalid), check.Equals, true)
+
+	names, err := backend.Import(ctx, 125, bytes.NewReader(data), &backend.ImportFlags{Key: key})
+	c.Assert(err, check.IsNil)
+	c.Check(names, check.DeepEquals, []string{"hello-snap"})
+
+	// failed imports left nothing behind
+	matches, err := filepath.Glob(filepath.Join(dirs.SnapshotsDir, "*"))
+	c.Assert(err, check.IsNil)
+	c.Check(matches, check.DeepEquals, []string{filepath.Join(dirs.SnapshotsDir, "125_hello-snap_v1.33_42.zip")})
+
+	rdr, err := backend.Open(matches[0], backend.ExtractFnameSetID)
+	c.Assert(err, check.IsNil)
+	defer rdr.Close()
+	c.Assert(rdr.Unlock(key), check.IsNil)
+	c.Check(rdr.Conf, check.DeepEquals, encCfg)
+	c.Check(rdr.Check(ctx, nil), check.IsNil)
+}
+
+func (s *snapshotSuite) TestEncryptionSegments(c *check.C) {
+	const segment = 64 * 1024
+	for _, size := range []int{0, 1, segment - 1, segment, segment + 1, 3 * segment, 3*segment + 7} {
+		data := bytes.Repeat([]byte{'x'}, size)
+		out, encSize, decSize, err := backend.EncryptDecrypt(data)
+		c.Assert(err, check.IsNil, check.Commentf("size %d", size))
+		c.Check(out, check.HasLen, size)
+		c.Check(bytes.Equal(out, data), check.Equals, true, check.Commentf("size %d", size))
+		c.Check(decSize, check.Equals, int64(size), check.Commentf("size %d", size))
+		c.Check(encSize > int64(size), check.Equals, true)
+	}
+}
@@ -20,6 +20,10 @@
 package backend
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
 	"os"
 	"os/exec"
 	"time"
@@ -40,9 +44,78 @@ var (
 
 	NewMultiError = newMultiError
 
-	AddSnapDirToZip = addSnapDirToZip
+	ChunksDir = chunksDir
 )
 
+func AddSnapDirToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer, username, entry, snapDir string, savingUserData bool, excludePaths []string) error {
+	return addSnapDirToZip(ctx, snapshot, w, nil, nil, username, entry, snapDir, savingUserData, excludePaths)
+}
+
+func MockPassphraseKDF(kdfTime, memory uint32, threads uint8) (restore func()) {
+	oldTime, oldMemory, oldThreads := passphraseKDFTime, passphraseKDFMemory, passphraseKDFThreads
+	passphraseKDFTime, passphraseKDFMemory, passphraseKDFThreads = kdfTime, memory, threads
+	return func() {
+		passphraseKDFTime, passphraseKDFMemory, passphraseKDFThreads = oldTime, oldMemory, oldThreads
+	}
+}
+
+func MockSecbootDeviceBoundKey(seal func(key []byte, keyFile string) error, unseal func(keyFile string) ([]byte, error)) (restore func()) {
+	oldSeal, oldUnseal := secbootSealDeviceBoundKey, secbootUnsealDeviceBoundKey
+	secbootSealDeviceBoundKey, secbootUnsealDeviceBoundKey = seal, unseal
+	return func() {
+		secbootSealDeviceBoundKey, secbootUnsealDeviceBoundKey = oldSeal, oldUnseal
+	}
+}
+
+func MockDeviceKey(f func() ([]byte, error)) (restore func()) {
+	old := deviceKey
+	deviceKey = f
+	return func() {
+		deviceKey = old
+	}
+}
+
+// EncryptDecrypt encrypts data as a snapshot entry is encrypted, and
+// decrypts it back, returning the encrypted size and the size the encrypted
+// size is taken to decrypt to.
+func EncryptDecrypt(data []byte) (out []byte, encSize, decSize int64, err error) {
+	key := encryptionKey(bytes.Repeat([]byte{42}, encryptionKeySize))
+	var buf bytes.Buffer
+	ew, err := newEncryptingWriter(key, "entry", &buf)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if _, err := ew.Write(data); err != nil {
+		return nil, 0, 0, err
+	}
+	if err := ew.Close(); err != nil {
+		return nil, 0, 0, err
+	}
+	encSize = int64(buf.Len())
+	dr, err := newDecryptingReader(key, "entry", io.NopCloser(&buf))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	out, err = io.ReadAll(dr)
+	return out, encSize, decryptedSize(encSize, dr.aead.Overhead()), err
+}
+
+func MockChunkSizes(minSize, maxSize int, bits uint) (restore func()) {
+	oldMin, oldMax, oldBits := chunkMinSize, chunkMaxSize, chunkBits
+	chunkMinSize, chunkMaxSize, chunkBits = minSize, maxSize, bits
+	return func() {
+		chunkMinSize, chunkMaxSize, chunkBits = oldMin, oldMax, oldBits
+	}
+}
+
+func ChunkIndexSize(f *os.File, entry string) (int64, bool, error) {
+	idx, err := readChunkIndex(f)
+	if err != nil || idx == nil {
+		return 0, false, err
+	}
+	return idx.size(entry), true, nil
+}
+
 func MockIsTesting(newIsTesting bool) func() {
 	oldIsTesting := isTesting
 	isTesting = newIsTesting
@@ -50,6 +50,13 @@ const ExtractFnameSetID = 0
 type Reader struct {
 	*os.File
 	client.Snapshot
+
+	// chunks is the chunk index of incremental snapshots
+	chunks     chunkIndex
+	chunksRead bool
+
+	// key is the key of encrypted snapshots, once unlocked
+	key encryptionKey
 }
 
 // Open a Snapshot given its full filename.
@@ -142,8 +149,64 @@ func Open(fn string, setID uint64) (reader *Reader, e error) {
 	return reader, nil
 }
 
+// Unlock verifies the key of an encrypted snapshot and makes its data and
+// configuration available. It is a no-op for snapshots that are not
+// encrypted.
+func (r *Reader) Unlock(key *client.SnapshotKey) error {
+	if r.Encryption == nil {
+		return nil
+	}
+	k, err := unlockKey(key, r.Encryption)
+	if err != nil {
+		return err
+	}
+	r.key = k
+
+	confReader, _, err := r.openEntry(encryptedConfName)
+	if err != nil {
+		return err
+	}
+	defer confReader.Close()
+	if err := jsonutil.DecodeWithNumber(confReader, &r.Conf); err != nil {
+		return fmt.Errorf("cannot decode snapshot configuration: %v", err)
+	}
+	return nil
+}
+
+// openEntry returns an io.ReadCloser for the data of the given archive entry,
+// which for incremental snapshots is resolved from the chunk store, and for
+// encrypted ones is decrypted.
+func (r *Reader) openEntry(entry string) (rc io.ReadCloser, sz int64, err error) {
+	if r.Encryption != nil {
+		if r.key == nil {
+			return nil, -1, &KeyRequiredError{KeySource: r.Encryption.KeySource}
+		}
+		rc, sz, err := zipMember(r.File, entry)
+		if err != nil {
+			return nil, -1, err
+		}
+		dr, err := newDecryptingReader(r.key, entry, rc)
+		if err != nil {
+			rc.Close()
+			return nil, -1, err
+		}
+		return dr, decryptedSize(sz, dr.aead.Overhead()), nil
+	}
+	if !r.chunksRead {
+		r.chunks, err = readChunkIndex(r.File)
+		if err != nil {
+			return nil, -1, err
+		}
+		r.chunksRead = true
+	}
+	if chunks, ok := r.chunks[entry]; ok {
+		return newChunkReader(chunks), r.chunks.size(entry), nil
+	}
+	return zipMember(r.File, entry)
+}
+
 func (r *Reader) checkOne(ctx context.Context, entry string, hasher hash.Hash) error {
-	body, reportedSize, err := zipMember(r.File, entry)
+	body, reportedSize, err := r.openEntry(entry)
 	if err != nil {
 		return err
 	}
@@ -310,10 +373,11 @@ func (r *Reader) Restore(ctx context.Context, current snap.Revision, usernames [
 
 		logger.Debugf("Restoring %q from %q into %q.", entry, r.Name(), tempdir)
 
-		body, expectedSize, err := zipMember(r.File, entry)
+		body, expectedSize, err := r.openEntry(entry)
 		if err != nil {
 			return rs, err
 		}
+		defer body.Close()
 
 		expectedHash := r.SHA3_384[entry]
 
@@ -28,6 +28,7 @@ import (
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
+	"github.com/snapcore/snapd/overlord/snapshotstate/remote"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/snap"
@@ -45,13 +46,21 @@ var (
 	CleanupRestore             = cleanupRestore
 	DoCheck                    = doCheck
 	DoForget                   = doForget
+	DoPush                     = doPush
+	DoPull                     = doPull
 	SaveExpiration             = saveExpiration
 	ExpiredSnapshotSets        = expiredSnapshotSets
 	RemoveSnapshotState        = removeSnapshotState
 
 	SetSnapshotOpInProgress = setSnapshotOpInProgress
 
+	CacheSnapshotKey   = cacheSnapshotKey
+	CachedSnapshotKey  = cachedSnapshotKey
+	ForgetSnapshotKeys = forgetSnapshotKeys
+
 	DefaultAutomaticSnapshotExpiration = defaultAutomaticSnapshotExpiration
+
+	UnretainedSnapshotSets = unretainedSnapshotSets
 )
 
 func (summaries snapshotSnapSummaries) AsMaps() []map[string]string {
@@ -139,6 +148,22 @@ func MockBackendCheck(f func(*backend.Reader, context.Context, []string) error)
 	}
 }
 
+func MockBackendUnlock(f func(*backend.Reader, *client.SnapshotKey) error) (restore func()) {
+	old := backendUnlock
+	backendUnlock = f
+	return func() {
+		backendUnlock = old
+	}
+}
+
+func MockBackendCheckKeySource(f func(*client.Snapshot, *client.SnapshotKey) error) (restore func()) {
+	old := backendCheckKeySource
+	backendCheckKeySource = f
+	return func() {
+		backendCheckKeySource = old
+	}
+}
+
 func MockBackendRevert(f func(*backend.RestoreState)) (restore func()) {
 	old := backendRevert
 	backendRevert = f
@@ -171,6 +196,14 @@ func MockBackendCleanupAbandonedImports(f func() (int, error)) (restore func())
 	}
 }
 
+func MockBackendCleanupUnreferencedChunks(f func() (int, error)) (restore func()) {
+	old := backendCleanupUnreferencedChunks
+	backendCleanupUnreferencedChunks = f
+	return func() {
+		backendCleanupUnreferencedChunks = old
+	}
+}
+
 func MockBackendEstimateSnapshotSize(f func(*snap.Info, []string, *dirs.SnapDirOptions) (uint64, error)) (restore func()) {
 	old := backendEstimateSnapshotSize
 	backendEstimateSnapshotSize = f
@@ -179,6 +212,14 @@ func MockBackendEstimateSnapshotSize(f func(*snap.Info, []string, *dirs.SnapDirO
 	}
 }
 
+func MockBackendExportCheckKey(f func(*backend.SnapshotExport, *client.SnapshotKey) error) (restore func()) {
+	old := backendExportCheckKey
+	backendExportCheckKey = f
+	return func() {
+		backendExportCheckKey = old
+	}
+}
+
 func MockBackendNewSnapshotExport(f func(ctx context.Context, setID uint64) (se *SnapshotExport, err error)) (restore func()) {
 	old := backendNewSnapshotExport
 	backendNewSnapshotExport = f
@@ -187,6 +228,22 @@ func MockBackendNewSnapshotExport(f func(ctx context.Context, setID uint64) (se
 	}
 }
 
+func MockRemoteOpen(f func(context.Context, *remote.Config) (remote.Repository, error)) (restore func()) {
+	old := remoteOpen
+	remoteOpen = f
+	return func() {
+		remoteOpen = old
+	}
+}
+
+func MockTimeNow(f func() time.Time) (restore func()) {
+	old := timeNow
+	timeNow = f
+	return func() {
+		timeNow = old
+	}
+}
+
 func MockConfigGetSnapConfig(f func(*state.State, string) (*json.RawMessage, error)) (restore func()) {
 	old := configGetSnapConfig
 	configGetSnapConfig = f
@@ -0,0 +1,54 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package remote
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/snapcore/snapd/testutil"
+)
+
+var (
+	ValidateName = validateName
+)
+
+func S3Sign(req *http.Request, accessKeyID, secretAccessKey, region, payloadHash string, now time.Time) {
+	s3Sign(req, &s3Credentials{
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		Region:          region,
+	}, payloadHash, now)
+}
+
+func MockS3Multipart(threshold, partSize int64) (restore func()) {
+	restoreThreshold := testutil.Backup(&s3MultipartThreshold)
+	restorePartSize := testutil.Backup(&s3PartSize)
+	s3MultipartThreshold = threshold
+	s3PartSize = partSize
+	return func() {
+		restoreThreshold()
+		restorePartSize()
+	}
+}
+
+func MockTimeNow(f func() time.Time) (restore func()) {
+	return testutil.Mock(&timeNow, f)
+}
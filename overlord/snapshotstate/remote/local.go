@@ -0,0 +1,114 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/snapcore/snapd/osutil"
+)
+
+// localRepository is a repository in a directory, which can be on a mounted
+// network share or removable media.
+type localRepository struct {
+	dir string
+}
+
+func openLocal(dir string) *localRepository {
+	return &localRepository{dir: dir}
+}
+
+func (r *localRepository) Put(ctx context.Context, name string, rd io.Reader, size int64) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(r.dir, 0700); err != nil {
+		return err
+	}
+	aw, err := osutil.NewAtomicFile(filepath.Join(r.dir, name), 0600, 0, osutil.NoChown, osutil.NoChown)
+	if err != nil {
+		return err
+	}
+	// Cancel once committed is a NOP
+	defer aw.Cancel()
+
+	n, err := io.Copy(aw, &ctxReader{ctx: ctx, r: rd})
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("short write to snapshot repository: expected %d bytes, got %d", size, n)
+	}
+	return aw.Commit()
+}
+
+func (r *localRepository) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(r.dir, name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (r *localRepository) List(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		// skip anything that is not a complete object, like the
+		// temporary files of interrupted puts
+		if !entry.Type().IsRegular() || validateName(name) != nil || strings.HasSuffix(name, "~") {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (r *localRepository) Close() error {
+	return nil
+}
+
+// ctxReader stops reading from r once ctx is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
@@ -0,0 +1,154 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package remote implements the repositories snapshot sets can be pushed to
+// and pulled from, so that snap data can be backed up off the device.
+//
+// A repository is a flat namespace of named objects; it can be a directory
+// (possibly a mounted network share), a directory on an SFTP server, or a
+// bucket on an S3-compatible object storage service.
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound is returned when an object is not in the repository.
+var ErrNotFound = errors.New("object not found in snapshot repository")
+
+// Config describes how to access a snapshot repository.
+type Config struct {
+	// URL of the repository; one of
+	//   /path or file:///path for a local directory
+	//   sftp://user@host[:port]/path for a directory on an SFTP server
+	//   s3://host[:port]/bucket[/prefix] for an S3-compatible service,
+	//   or s3+http://... for one that is not reached over TLS
+	URL string
+	// Credentials is the path to the credentials of the repository:
+	// the private key of the user for SFTP, and a JSON file with the
+	// access keys for S3.
+	Credentials string
+	// KnownHosts is the path to a known_hosts file used to verify the
+	// host key of SFTP servers.
+	KnownHosts string
+}
+
+// Repository is a store of named objects.
+type Repository interface {
+	// Put stores the size bytes read from r as the named object,
+	// replacing any object with the same name. The object only becomes
+	// visible once it was completely written.
+	Put(ctx context.Context, name string, r io.Reader, size int64) error
+	// Get returns a reader for the named object.
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	// List returns the names of the objects in the repository.
+	List(ctx context.Context) ([]string, error)
+	// Close releases the resources used to access the repository.
+	Close() error
+}
+
+type repoURL struct {
+	kind string
+	url  *url.URL
+	path string
+}
+
+func parseURL(rawURL string) (*repoURL, error) {
+	if rawURL == "" {
+		return nil, errors.New("snapshot repository URL is empty")
+	}
+	if strings.HasPrefix(rawURL, "/") {
+		return &repoURL{kind: "file", path: filepath.Clean(rawURL)}, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot repository URL: %v", err)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("invalid snapshot repository URL %q: unexpected query or fragment", rawURL)
+	}
+	switch u.Scheme {
+	case "file":
+		if u.Host != "" || !strings.HasPrefix(u.Path, "/") {
+			return nil, fmt.Errorf("invalid snapshot repository URL %q: path must be absolute", rawURL)
+		}
+		return &repoURL{kind: "file", path: filepath.Clean(u.Path)}, nil
+	case "sftp":
+		if u.Hostname() == "" {
+			return nil, fmt.Errorf("invalid snapshot repository URL %q: missing host", rawURL)
+		}
+		if u.User.Username() == "" {
+			return nil, fmt.Errorf("invalid snapshot repository URL %q: missing user", rawURL)
+		}
+		if _, hasPassword := u.User.Password(); hasPassword {
+			return nil, fmt.Errorf("invalid snapshot repository URL %q: passwords are not supported, use a key", rawURL)
+		}
+		return &repoURL{kind: "sftp", url: u, path: u.Path}, nil
+	case "s3", "s3+http":
+		if u.Hostname() == "" {
+			return nil, fmt.Errorf("invalid snapshot repository URL %q: missing host", rawURL)
+		}
+		if u.User != nil {
+			return nil, fmt.Errorf("invalid snapshot repository URL %q: credentials must not be part of the URL", rawURL)
+		}
+		if strings.Trim(u.Path, "/") == "" {
+			return nil, fmt.Errorf("invalid snapshot repository URL %q: missing bucket", rawURL)
+		}
+		return &repoURL{kind: "s3", url: u, path: strings.Trim(u.Path, "/")}, nil
+	default:
+		return nil, fmt.Errorf("unsupported snapshot repository URL %q", rawURL)
+	}
+}
+
+// ValidateURL checks that the given URL describes a supported snapshot
+// repository.
+func ValidateURL(rawURL string) error {
+	_, err := parseURL(rawURL)
+	return err
+}
+
+// Open returns the repository described by the given configuration.
+func Open(ctx context.Context, cfg *Config) (Repository, error) {
+	u, err := parseURL(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.kind {
+	case "file":
+		return openLocal(u.path), nil
+	case "sftp":
+		return openSFTP(ctx, u, cfg)
+	case "s3":
+		return openS3(u, cfg)
+	}
+	panic("internal error: unexpected repository kind " + u.kind)
+}
+
+func validateName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\") || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid snapshot repository object name %q", name)
+	}
+	return nil
+}
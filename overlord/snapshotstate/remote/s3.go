@@ -0,0 +1,479 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/httputil"
+)
+
+const (
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3DefaultRegion   = "us-east-1"
+)
+
+var (
+	// objects bigger than this are uploaded in parts, which is needed
+	// for objects over 5GiB
+	s3MultipartThreshold int64 = 1 << 30
+	s3PartSize           int64 = 128 << 20
+
+	timeNow = time.Now
+)
+
+// s3Credentials are the contents of the credentials file of S3 repositories.
+type s3Credentials struct {
+	AccessKeyID     string `json:"access-key-id"`
+	SecretAccessKey string `json:"secret-access-key"`
+	Region          string `json:"region"`
+}
+
+func readS3Credentials(path string) (*s3Credentials, error) {
+	if path == "" {
+		return nil, errors.New("cannot access S3 snapshot repository: no credentials configured")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read S3 credentials: %v", err)
+	}
+	var creds s3Credentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("cannot decode S3 credentials: %v", err)
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, errors.New("invalid S3 credentials: access-key-id and secret-access-key are required")
+	}
+	if creds.Region == "" {
+		creds.Region = s3DefaultRegion
+	}
+	return &creds, nil
+}
+
+// s3Repository is a repository in a bucket of an S3-compatible service,
+// accessed using path-style requests so that it works with services other
+// than AWS, like MinIO.
+type s3Repository struct {
+	client *http.Client
+	creds  *s3Credentials
+	scheme string
+	host   string
+	bucket string
+	prefix string
+}
+
+func openS3(u *repoURL, cfg *Config) (*s3Repository, error) {
+	creds, err := readS3Credentials(cfg.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	scheme := "https"
+	if u.url.Scheme == "s3+http" {
+		scheme = "http"
+	}
+	bucket, prefix := u.path, ""
+	if i := strings.IndexByte(u.path, '/'); i >= 0 {
+		bucket, prefix = u.path[:i], u.path[i+1:]+"/"
+	}
+	return &s3Repository{
+		client: httputil.NewHTTPClient(&httputil.ClientOptions{
+			ExtraSSLCerts: &httputil.ExtraSSLCertsFromDir{
+				Dir: dirs.SnapdStoreSSLCertsDir,
+			},
+		}),
+		creds:  creds,
+		scheme: scheme,
+		host:   u.url.Host,
+		bucket: bucket,
+		prefix: prefix,
+	}, nil
+}
+
+func (r *s3Repository) url(key string, query url.Values) string {
+	u := url.URL{
+		Scheme: r.scheme,
+		Host:   r.host,
+		Path:   "/" + r.bucket + "/" + key,
+	}
+	if key == "" {
+		u.Path = "/" + r.bucket
+	}
+	u.RawQuery = s3EncodeQuery(query)
+	return u.String()
+}
+
+// do signs and performs the request, returning an error for anything but a
+// 2xx response.
+func (r *s3Repository) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	s3Sign(req, r.creds, payloadHash, timeNow())
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		return nil, s3ResponseError(resp)
+	}
+	return resp, nil
+}
+
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func s3ResponseError(resp *http.Response) error {
+	var serr s3Error
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	xml.Unmarshal(body, &serr)
+	// a missing bucket is also reported with a 404
+	if serr.Code == "NoSuchKey" || (serr.Code == "" && resp.StatusCode == http.StatusNotFound) {
+		return ErrNotFound
+	}
+	if serr.Code != "" {
+		return fmt.Errorf("snapshot repository error: %s: %s", serr.Code, serr.Message)
+	}
+	return fmt.Errorf("snapshot repository error: unexpected status %q", resp.Status)
+}
+
+func (r *s3Repository) Put(ctx context.Context, name string, rd io.Reader, size int64) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	if size > s3MultipartThreshold {
+		return r.putMultipart(ctx, r.prefix+name, rd, size)
+	}
+	req, err := http.NewRequestWithContext(ctx, "PUT", r.url(r.prefix+name, nil), &sizedReader{r: rd, left: size})
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	resp, err := r.do(req, s3UnsignedPayload)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// sizedReader reads exactly left bytes from r, failing if r has less so
+// that a short upload is not mistaken for a complete one.
+type sizedReader struct {
+	r    io.Reader
+	left int64
+}
+
+func (sr *sizedReader) Read(p []byte) (int, error) {
+	if sr.left <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > sr.left {
+		p = p[:sr.left]
+	}
+	n, err := sr.r.Read(p)
+	sr.left -= int64(n)
+	if err == io.EOF && sr.left > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+type s3InitiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type s3CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type s3CompleteMultipartUpload struct {
+	XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletedPart `xml:"Part"`
+}
+
+func (r *s3Repository) putMultipart(ctx context.Context, key string, rd io.Reader, size int64) (err error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", r.url(key, url.Values{"uploads": {""}}), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := r.do(req, s3EmptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	var upload s3InitiateMultipartUploadResult
+	err = xml.NewDecoder(resp.Body).Decode(&upload)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("cannot decode snapshot repository response: %v", err)
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		// don't leave the parts around, they are billed for
+		req, rerr := http.NewRequestWithContext(context.Background(), "DELETE", r.url(key, url.Values{"uploadId": {upload.UploadID}}), nil)
+		if rerr == nil {
+			if resp, rerr := r.do(req, s3EmptyPayloadHash); rerr == nil {
+				resp.Body.Close()
+			}
+		}
+	}()
+
+	var complete s3CompleteMultipartUpload
+	buf := make([]byte, s3PartSize)
+	for written := int64(0); written < size; {
+		partSize := s3PartSize
+		if size-written < partSize {
+			partSize = size - written
+		}
+		n, err := io.ReadFull(rd, buf[:partSize])
+		if err != nil {
+			return err
+		}
+		written += int64(n)
+		partNumber := len(complete.Parts) + 1
+		query := url.Values{
+			"partNumber": {strconv.Itoa(partNumber)},
+			"uploadId":   {upload.UploadID},
+		}
+		req, err := http.NewRequestWithContext(ctx, "PUT", r.url(key, query), bytes.NewReader(buf[:n]))
+		if err != nil {
+			return err
+		}
+		resp, err := r.do(req, s3UnsignedPayload)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		complete.Parts = append(complete.Parts, s3CompletedPart{
+			PartNumber: partNumber,
+			ETag:       resp.Header.Get("ETag"),
+		})
+	}
+
+	body, err := xml.Marshal(&complete)
+	if err != nil {
+		return err
+	}
+	req, err = http.NewRequestWithContext(ctx, "POST", r.url(key, url.Values{"uploadId": {upload.UploadID}}), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp, err = r.do(req, s3PayloadHash(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// errors completing the upload can come with a 200 status
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var serr s3Error
+	if xml.Unmarshal(respBody, &serr) == nil && serr.Code != "" {
+		return fmt.Errorf("snapshot repository error: %s: %s", serr.Code, serr.Message)
+	}
+	return nil
+}
+
+func (r *s3Repository) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", r.url(r.prefix+name, nil), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.do(req, s3EmptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+type s3ListBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (r *s3Repository) List(ctx context.Context) ([]string, error) {
+	var names []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if r.prefix != "" {
+			query.Set("prefix", r.prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", r.url("", query), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := r.do(req, s3EmptyPayloadHash)
+		if err != nil {
+			return nil, err
+		}
+		var result s3ListBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode snapshot repository response: %v", err)
+		}
+		for _, obj := range result.Contents {
+			name := strings.TrimPrefix(obj.Key, r.prefix)
+			if validateName(name) == nil {
+				names = append(names, name)
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return names, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (r *s3Repository) Close() error {
+	r.client.CloseIdleConnections()
+	return nil
+}
+
+// AWS signature version 4, see
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+
+var s3EmptyPayloadHash = s3PayloadHash(nil)
+
+func s3PayloadHash(payload []byte) string {
+	h := sha256.Sum256(payload)
+	return hex.EncodeToString(h[:])
+}
+
+func s3Sign(req *http.Request, creds *s3Credentials, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "date" || name == "range" || name == "content-type" || name == "content-md5" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	signedHeaders := make([]string, 0, len(headers))
+	for name := range headers {
+		signedHeaders = append(signedHeaders, name)
+	}
+	sort.Strings(signedHeaders)
+	var canonicalHeaders strings.Builder
+	for _, name := range signedHeaders {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EncodePath(req.URL.Path),
+		s3EncodeQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + creds.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + s3PayloadHash([]byte(canonicalRequest))
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range []string{date, creds.Region, "s3", "aws4_request"} {
+		key = s3HMAC(key, part)
+	}
+	signature := hex.EncodeToString(s3HMAC(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s,SignedHeaders=%s,Signature=%s",
+		creds.AccessKeyID, scope, strings.Join(signedHeaders, ";"), signature))
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape encodes everything but the unreserved characters, as required
+// for signing.
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3EncodePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = s3Escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func s3EncodeQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,184 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var (
+	sshDial = func(ctx context.Context, addr string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", addr)
+	}
+	sshTimeout = 30 * time.Second
+)
+
+// sftpRepository is a repository in a directory of an SFTP server.
+type sftpRepository struct {
+	conn *ssh.Client
+	c    *sftp.Client
+	dir  string
+}
+
+func openSFTP(ctx context.Context, u *repoURL, cfg *Config) (*sftpRepository, error) {
+	if cfg.Credentials == "" {
+		return nil, errors.New("cannot access SFTP snapshot repository: no credentials configured")
+	}
+	if cfg.KnownHosts == "" {
+		return nil, errors.New("cannot access SFTP snapshot repository: no known hosts configured")
+	}
+	keyData, err := os.ReadFile(cfg.Credentials)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read SFTP credentials: %v", err)
+	}
+	signer, err := ssh.ParsePrivateKey(keyData)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse SFTP credentials: %v", err)
+	}
+	hostKeyCallback, err := knownhosts.New(cfg.KnownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read SFTP known hosts: %v", err)
+	}
+
+	addr := u.url.Host
+	if u.url.Port() == "" {
+		addr = net.JoinHostPort(u.url.Hostname(), "22")
+	}
+	ctx, cancel := context.WithTimeout(ctx, sshTimeout)
+	defer cancel()
+	nc, err := sshDial(ctx, addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to SFTP snapshot repository: %v", err)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(nc, addr, &ssh.ClientConfig{
+		User:            u.url.User.Username(),
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sshTimeout,
+	})
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("cannot connect to SFTP snapshot repository: %v", err)
+	}
+	conn := ssh.NewClient(sshConn, chans, reqs)
+	c, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("cannot start SFTP session: %v", err)
+	}
+	dir := u.path
+	if dir == "" {
+		dir = "."
+	}
+	return &sftpRepository{conn: conn, c: c, dir: dir}, nil
+}
+
+func (r *sftpRepository) Put(ctx context.Context, name string, rd io.Reader, size int64) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	// failing to create the directory is reported when creating the file
+	if r.c.Mkdir(r.dir) == nil {
+		r.c.Chmod(r.dir, 0700)
+	}
+
+	target := path.Join(r.dir, name)
+	tmp := target + ".part~"
+	f, err := r.c.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	err = f.Chmod(0600)
+	var n int64
+	if err == nil {
+		n, err = io.Copy(f, &ctxReader{ctx: ctx, r: rd})
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n != size {
+		err = fmt.Errorf("short write to snapshot repository: expected %d bytes, got %d", size, n)
+	}
+	if err != nil {
+		r.c.Remove(tmp)
+		return err
+	}
+	if _, ok := r.c.HasExtension("posix-rename@openssh.com"); ok {
+		return r.c.PosixRename(tmp, target)
+	}
+	// version 3 of the protocol does not allow renaming over existing files
+	if err := r.c.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return r.c.Rename(tmp, target)
+}
+
+func (r *sftpRepository) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	f, err := r.c.Open(path.Join(r.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (r *sftpRepository) List(ctx context.Context) ([]string, error) {
+	entries, err := r.c.ReadDirContext(ctx, r.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		// skip anything that is not a complete object, like the
+		// temporary files of interrupted puts
+		if !entry.Mode().IsRegular() || validateName(name) != nil || strings.HasSuffix(name, "~") {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (r *sftpRepository) Close() error {
+	r.c.Close()
+	return r.conn.Close()
+}
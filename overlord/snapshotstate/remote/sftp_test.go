@@ -0,0 +1,197 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package remote_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/snapshotstate/remote"
+)
+
+type sftpSuite struct {
+	root       string
+	addr       string
+	listener   net.Listener
+	credsFile  string
+	knownHosts string
+	clientKey  ssh.PublicKey
+}
+
+var _ = check.Suite(&sftpSuite{})
+
+func (s *sftpSuite) SetUpTest(c *check.C) {
+	s.root = c.MkDir()
+
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	c.Assert(err, check.IsNil)
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	c.Assert(err, check.IsNil)
+	clientPub, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	c.Assert(err, check.IsNil)
+	s.clientKey, err = ssh.NewPublicKey(clientPub)
+	c.Assert(err, check.IsNil)
+
+	block, err := ssh.MarshalPrivateKey(clientPriv, "")
+	c.Assert(err, check.IsNil)
+	s.credsFile = filepath.Join(c.MkDir(), "id_ed25519")
+	c.Assert(os.WriteFile(s.credsFile, pem.EncodeToMemory(block), 0600), check.IsNil)
+
+	s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	s.addr = s.listener.Addr().String()
+	s.knownHosts = filepath.Join(c.MkDir(), "known_hosts")
+	line := knownhosts.Line([]string{s.addr}, hostSigner.PublicKey())
+	c.Assert(os.WriteFile(s.knownHosts, []byte(line+"\n"), 0600), check.IsNil)
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "backup" && bytes.Equal(key.Marshal(), s.clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key")
+		},
+	}
+	config.AddHostKey(hostSigner)
+	go s.serve(c, config)
+}
+
+func (s *sftpSuite) TearDownTest(c *check.C) {
+	s.listener.Close()
+}
+
+func (s *sftpSuite) serve(c *check.C, config *ssh.ServerConfig) {
+	for {
+		nc, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			conn, chans, reqs, err := ssh.NewServerConn(nc, config)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			go ssh.DiscardRequests(reqs)
+			for newCh := range chans {
+				ch, reqs, err := newCh.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					for req := range reqs {
+						ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+						req.Reply(ok, nil)
+						if ok {
+							go func() {
+								defer ch.Close()
+								server, err := sftp.NewServer(ch)
+								if err != nil {
+									return
+								}
+								server.Serve()
+							}()
+						}
+					}
+				}()
+			}
+		}()
+	}
+}
+
+func (s *sftpSuite) config(path string) *remote.Config {
+	return &remote.Config{
+		URL:         "sftp://backup@" + s.addr + filepath.Join(s.root, path),
+		Credentials: s.credsFile,
+		KnownHosts:  s.knownHosts,
+	}
+}
+
+func (s *sftpSuite) TestRepository(c *check.C) {
+	repo, err := remote.Open(context.Background(), s.config("/backups"))
+	c.Assert(err, check.IsNil)
+	checkRepository(c, repo)
+
+	data, err := os.ReadFile(filepath.Join(s.root, "backups", "foo.json"))
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, "{}")
+	entries, err := os.ReadDir(filepath.Join(s.root, "backups"))
+	c.Assert(err, check.IsNil)
+	c.Check(entries, check.HasLen, 2)
+
+	st, err := os.Stat(filepath.Join(s.root, "backups"))
+	c.Assert(err, check.IsNil)
+	c.Check(st.Mode().Perm(), check.Equals, os.FileMode(0700))
+	st, err = os.Stat(filepath.Join(s.root, "backups", "foo.json"))
+	c.Assert(err, check.IsNil)
+	c.Check(st.Mode().Perm(), check.Equals, os.FileMode(0600))
+}
+
+func (s *sftpSuite) TestListSkipsIncomplete(c *check.C) {
+	dir := filepath.Join(s.root, "backups")
+	c.Assert(os.Mkdir(dir, 0700), check.IsNil)
+	for _, name := range []string{"foo.snapshot.part~", ".hidden", "foo.json"} {
+		c.Assert(os.WriteFile(filepath.Join(dir, name), nil, 0600), check.IsNil)
+	}
+	c.Assert(os.Mkdir(filepath.Join(dir, "subdir"), 0700), check.IsNil)
+
+	repo, err := remote.Open(context.Background(), s.config("/backups"))
+	c.Assert(err, check.IsNil)
+	defer repo.Close()
+	names, err := repo.List(context.Background())
+	c.Assert(err, check.IsNil)
+	c.Check(names, check.DeepEquals, []string{"foo.json"})
+}
+
+func (s *sftpSuite) TestUnknownHost(c *check.C) {
+	c.Assert(os.WriteFile(s.knownHosts, nil, 0600), check.IsNil)
+	_, err := remote.Open(context.Background(), s.config("/backups"))
+	c.Check(err, check.ErrorMatches, "cannot connect to SFTP snapshot repository: ssh: handshake failed: knownhosts: key is unknown")
+}
+
+func (s *sftpSuite) TestUnknownUser(c *check.C) {
+	cfg := s.config("/backups")
+	cfg.URL = strings.Replace(cfg.URL, "backup@", "other@", 1)
+	_, err := remote.Open(context.Background(), cfg)
+	c.Check(err, check.ErrorMatches, "cannot connect to SFTP snapshot repository: ssh: handshake failed: .*unable to authenticate.*")
+}
+
+func (s *sftpSuite) TestMissingConfig(c *check.C) {
+	cfg := s.config("/backups")
+	cfg.KnownHosts = ""
+	_, err := remote.Open(context.Background(), cfg)
+	c.Check(err, check.ErrorMatches, "cannot access SFTP snapshot repository: no known hosts configured")
+	cfg.Credentials = ""
+	_, err = remote.Open(context.Background(), cfg)
+	c.Check(err, check.ErrorMatches, "cannot access SFTP snapshot repository: no credentials configured")
+}
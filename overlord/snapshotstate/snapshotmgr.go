@@ -20,10 +20,14 @@
 package snapshotstate
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 	"time"
 
 	"gopkg.in/tomb.v2"
@@ -33,9 +37,12 @@ import (
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
+	"github.com/snapcore/snapd/overlord/snapshotstate/remote"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/timeutil"
 )
 
 var (
@@ -45,16 +52,29 @@ var (
 	configSetSnapConfig  = config.SetSnapConfig
 	backendOpen          = backend.Open
 	backendSave          = backend.Save
+	backendSaveIncr      = backend.SaveIncremental
+	backendSaveEncrypted = backend.SaveEncrypted
 	backendImport        = backend.Import
 	backendRestore       = (*backend.Reader).Restore // TODO: look into using an interface instead
 	backendCheck         = (*backend.Reader).Check
+	backendUnlock        = (*backend.Reader).Unlock
 	backendRevert        = (*backend.RestoreState).Revert // ditto
 	backendCleanup       = (*backend.RestoreState).Cleanup
 
-	backendCleanupAbandonedImports = backend.CleanupAbandonedImports
+	backendCleanupAbandonedImports   = backend.CleanupAbandonedImports
+	backendCleanupUnreferencedChunks = backend.CleanupUnreferencedChunks
 
 	autoExpirationInterval = time.Hour * 24 // interval between forgetExpiredSnapshots runs as part of Ensure()
 
+	// maximum time between scheduled pushes to the remote snapshot
+	// repository, whatever the schedule
+	maxRemotePushInterval = time.Hour * 24 * 31
+
+	// maximum time between scheduled snapshots, whatever the schedule
+	maxScheduledSnapshotInterval = time.Hour * 24 * 31
+
+	timeNow = time.Now
+
 	getSnapDirOpts = snapstate.GetSnapDirOpts
 )
 
@@ -63,6 +83,12 @@ type SnapshotManager struct {
 	state *state.State
 
 	lastForgetExpiredSnapshotTime time.Time
+
+	lastRemotePushSchedule string
+	nextRemotePush         time.Time
+
+	lastSnapshotSchedule  string
+	nextScheduledSnapshot time.Time
 }
 
 // Manager returns a new SnapshotManager
@@ -74,6 +100,8 @@ func Manager(st *state.State, runner *state.TaskRunner) *SnapshotManager {
 	runner.AddHandler("check-snapshot", doCheck, nil)
 	runner.AddHandler("restore-snapshot", doRestore, undoRestore)
 	runner.AddHandler("cleanup-after-restore", doCleanupAfterRestore, nil)
+	runner.AddHandler("push-snapshot", doPush, nil)
+	runner.AddHandler("pull-snapshot", doPull, nil)
 
 	manager := &SnapshotManager{
 		state: st,
@@ -85,6 +113,13 @@ func Manager(st *state.State, runner *state.TaskRunner) *SnapshotManager {
 
 // Ensure is part of the overlord.StateManager interface.
 func (mgr *SnapshotManager) Ensure() error {
+	if err := mgr.ensureScheduledSnapshot(); err != nil {
+		logger.Noticef("cannot schedule snapshot: %v", err)
+	}
+	if err := mgr.ensureRemotePush(); err != nil {
+		logger.Noticef("cannot schedule push of snapshot sets: %v", err)
+	}
+
 	// process expired snapshots once a day.
 	if time.Now().After(mgr.lastForgetExpiredSnapshotTime.Add(autoExpirationInterval)) {
 		return mgr.forgetExpiredSnapshots()
@@ -97,26 +132,69 @@ func (mgr *SnapshotManager) StartUp() error {
 	if _, err := backendCleanupAbandonedImports(); err != nil {
 		logger.Noticef("cannot cleanup incomplete imports: %v", err)
 	}
+	cleanupUnreferencedChunks()
+
+	mgr.state.Lock()
+	defer mgr.state.Unlock()
+	mgr.state.AddChangeStatusChangedHandler(forgetSnapshotKeys)
 	return nil
 }
 
+// cleanupUnreferencedChunks removes the chunks of incremental snapshots that
+// are no longer needed; failing to do so is not fatal, it will be retried the
+// next time snapshots are forgotten.
+func cleanupUnreferencedChunks() {
+	if _, err := backendCleanupUnreferencedChunks(); err != nil {
+		logger.Noticef("cannot cleanup unreferenced snapshot chunks: %v", err)
+	}
+}
+
 func (mgr *SnapshotManager) forgetExpiredSnapshots() error {
+	forgotten, err := mgr.forgetExpiredSnapshotSets()
+	if err != nil {
+		return err
+	}
+	if forgotten {
+		// determining the chunks still in use reads all the snapshots,
+		// so it is done without holding the state lock
+		cleanupUnreferencedChunks()
+	}
+	return nil
+}
+
+// forgetExpiredSnapshotSets removes the expired and unretained snapshot sets,
+// returning whether it attempted to remove any.
+func (mgr *SnapshotManager) forgetExpiredSnapshotSets() (forgotten bool, err error) {
 	mgr.state.Lock()
 	defer mgr.state.Unlock()
 
 	sets, err := expiredSnapshotSets(mgr.state, time.Now())
 	if err != nil {
-		return fmt.Errorf("internal error: cannot determine expired snapshots: %v", err)
+		return false, fmt.Errorf("internal error: cannot determine expired snapshots: %v", err)
+	}
+	daily, weekly, err := ScheduledSnapshotRetention(mgr.state)
+	if err != nil {
+		return false, err
+	}
+	unretained, err := unretainedSnapshotSets(mgr.state, daily, weekly)
+	if err != nil {
+		return false, fmt.Errorf("internal error: cannot determine unretained scheduled snapshots: %v", err)
+	}
+	for setID := range unretained {
+		if sets == nil {
+			sets = make(map[uint64]bool)
+		}
+		sets[setID] = true
 	}
 
 	if len(sets) == 0 {
-		return nil
+		return false, nil
 	}
 
 	err = backendIter(context.TODO(), func(r *backend.Reader) error {
-		// forget needs to conflict with check and restore
+		// forget needs to conflict with check, restore and push
 		if err := checkSnapshotConflict(mgr.state, r.SetID, "export-snapshot",
-			"check-snapshot", "restore-snapshot"); err != nil {
+			"check-snapshot", "restore-snapshot", "push-snapshot"); err != nil {
 			// there is a conflict, do nothing and we will retry this set on next Ensure().
 			return nil
 		}
@@ -137,7 +215,7 @@ func (mgr *SnapshotManager) forgetExpiredSnapshots() error {
 	})
 
 	if err != nil {
-		return fmt.Errorf("cannot process expired snapshots: %v", err)
+		return false, fmt.Errorf("cannot process expired snapshots: %v", err)
 	}
 
 	// only reset time if there are no sets left because of conflicts
@@ -145,12 +223,207 @@ func (mgr *SnapshotManager) forgetExpiredSnapshots() error {
 		mgr.lastForgetExpiredSnapshotTime = time.Now()
 	}
 
+	return true, nil
+}
+
+// ensureScheduledSnapshot saves a snapshot set of the active snaps, as
+// scheduled by the snapshots.schedule core option. The snaps in the set can
+// be narrowed down with the snapshots.include and snapshots.exclude options;
+// snaps that are busy in other changes are skipped.
+func (mgr *SnapshotManager) ensureScheduledSnapshot() error {
+	st := mgr.state
+	st.Lock()
+	defer st.Unlock()
+
+	var scheduleStr string
+	tr := config.NewTransaction(st)
+	if err := tr.Get("core", "snapshots.schedule", &scheduleStr); err != nil && !config.IsNoOption(err) {
+		return err
+	}
+	if scheduleStr != mgr.lastSnapshotSchedule {
+		mgr.nextScheduledSnapshot = time.Time{}
+		mgr.lastSnapshotSchedule = scheduleStr
+	}
+	if scheduleStr == "" {
+		return nil
+	}
+	schedule, err := timeutil.ParseSchedule(scheduleStr)
+	if err != nil {
+		// the schedule was validated when set
+		return fmt.Errorf("cannot parse snapshots.schedule: %v", err)
+	}
+
+	now := timeNow()
+	if mgr.nextScheduledSnapshot.IsZero() {
+		var last time.Time
+		if err := st.Get("last-scheduled-snapshot", &last); err != nil && !errors.Is(err, state.ErrNoState) {
+			return err
+		}
+		if last.IsZero() {
+			last = now
+		}
+		mgr.nextScheduledSnapshot = now.Add(timeutil.Next(schedule, last, maxScheduledSnapshotInterval))
+	}
+	if now.Before(mgr.nextScheduledSnapshot) {
+		return nil
+	}
+	mgr.nextScheduledSnapshot = time.Time{}
+	st.Set("last-scheduled-snapshot", now)
+
+	for _, chg := range st.Changes() {
+		if chg.Kind() == "scheduled-snapshot" && !chg.IsReady() {
+			logger.Noticef("skipping scheduled snapshot: previous scheduled snapshot still in progress")
+			return nil
+		}
+	}
+
+	snapNames, err := scheduledSnapshotSnaps(st)
+	if err != nil {
+		return err
+	}
+	if len(snapNames) == 0 {
+		return nil
+	}
+	setID, err := newSnapshotSetID(st)
+	if err != nil {
+		return err
+	}
+
+	chg := st.NewChange("scheduled-snapshot", fmt.Sprintf("Save scheduled snapshot set #%d", setID))
+	for _, name := range snapNames {
+		desc := fmt.Sprintf("Save data of snap %q in scheduled snapshot set #%d", name, setID)
+		_, ts := newSaveTasks(st, desc, &snapshotSetup{
+			SetID:     setID,
+			Snap:      name,
+			Scheduled: true,
+		})
+		chg.AddAll(ts)
+	}
+	// forget the sets no longer retained on the next Ensure
+	mgr.lastForgetExpiredSnapshotTime = time.Time{}
+	st.EnsureBefore(0)
+	return nil
+}
+
+// scheduledSnapshotSnaps returns the active snaps to include in a scheduled
+// snapshot set.
+func scheduledSnapshotSnaps(st *state.State) ([]string, error) {
+	tr := config.NewTransaction(st)
+	var includeStr, excludeStr string
+	if err := tr.Get("core", "snapshots.include", &includeStr); err != nil && !config.IsNoOption(err) {
+		return nil, err
+	}
+	if err := tr.Get("core", "snapshots.exclude", &excludeStr); err != nil && !config.IsNoOption(err) {
+		return nil, err
+	}
+	include := strutil.CommaSeparatedList(includeStr)
+	exclude := strutil.CommaSeparatedList(excludeStr)
+
+	active, err := allActiveSnapNames(st)
+	if err != nil {
+		return nil, err
+	}
+	snapNames := make([]string, 0, len(active))
+	for _, name := range active {
+		if len(include) > 0 && !strutil.ListContains(include, name) {
+			continue
+		}
+		if strutil.ListContains(exclude, name) {
+			continue
+		}
+		if err := snapstateCheckChangeConflictMany(st, []string{name}, ""); err != nil {
+			logger.Noticef("skipping snap %q in scheduled snapshot: %v", name, err)
+			continue
+		}
+		snapNames = append(snapNames, name)
+	}
+	return snapNames, nil
+}
+
+// ensureRemotePush pushes the snapshot sets on the device to the remote
+// snapshot repository, as scheduled by the snapshots.remote.schedule core
+// option. Sets that are already in the repository are skipped when pushing.
+func (mgr *SnapshotManager) ensureRemotePush() error {
+	st := mgr.state
+	st.Lock()
+	defer st.Unlock()
+
+	var scheduleStr string
+	tr := config.NewTransaction(st)
+	if err := tr.Get("core", "snapshots.remote.schedule", &scheduleStr); err != nil && !config.IsNoOption(err) {
+		return err
+	}
+	if scheduleStr != mgr.lastRemotePushSchedule {
+		mgr.nextRemotePush = time.Time{}
+		mgr.lastRemotePushSchedule = scheduleStr
+	}
+	if scheduleStr == "" {
+		return nil
+	}
+	schedule, err := timeutil.ParseSchedule(scheduleStr)
+	if err != nil {
+		// the schedule was validated when set
+		return fmt.Errorf("cannot parse snapshots.remote.schedule: %v", err)
+	}
+
+	now := timeNow()
+	if mgr.nextRemotePush.IsZero() {
+		var last time.Time
+		if err := st.Get("last-snapshot-push", &last); err != nil && !errors.Is(err, state.ErrNoState) {
+			return err
+		}
+		if last.IsZero() {
+			last = now
+		}
+		mgr.nextRemotePush = now.Add(timeutil.Next(schedule, last, maxRemotePushInterval))
+	}
+	if now.Before(mgr.nextRemotePush) {
+		return nil
+	}
+	mgr.nextRemotePush = time.Time{}
+	st.Set("last-snapshot-push", now)
+
+	for _, chg := range st.Changes() {
+		if chg.Kind() == "push-snapshots" && !chg.IsReady() {
+			logger.Noticef("skipping scheduled push of snapshot sets: previous push still in progress")
+			return nil
+		}
+	}
+	if _, err := remoteRepositoryConfig(st); err != nil {
+		return err
+	}
+
+	var setIDs []uint64
+	seen := make(map[uint64]bool)
+	err = backendIter(context.TODO(), func(r *backend.Reader) error {
+		if seen[r.SetID] {
+			return nil
+		}
+		seen[r.SetID] = true
+		// sets being forgotten are not worth pushing
+		if checkSnapshotConflict(st, r.SetID, "forget-snapshot") == nil {
+			setIDs = append(setIDs, r.SetID)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(setIDs) == 0 {
+		return nil
+	}
+
+	chg := st.NewChange("push-snapshots", "Push snapshot sets to the remote snapshot repository")
+	for _, setID := range setIDs {
+		chg.AddTask(newPushTask(st, setID))
+	}
+	st.EnsureBefore(0)
 	return nil
 }
 
 func (SnapshotManager) affectedSnaps(t *state.Task) ([]string, error) {
-	if k := t.Kind(); k == "check-snapshot" || k == "forget-snapshot" {
-		// check and forget don't affect snaps
+	if k := t.Kind(); k == "check-snapshot" || k == "forget-snapshot" || k == "push-snapshot" {
+		// check, forget and push don't affect snaps
 		// (this could also be written k != save && k != restore, but it's safer this way around)
 		return nil, nil
 	}
@@ -163,13 +436,15 @@ func (SnapshotManager) affectedSnaps(t *state.Task) ([]string, error) {
 }
 
 type snapshotSetup struct {
-	SetID    uint64                `json:"set-id"`
-	Snap     string                `json:"snap"`
-	Users    []string              `json:"users,omitempty"`
-	Options  *snap.SnapshotOptions `json:"options,omitempty"`
-	Filename string                `json:"filename,omitempty"`
-	Current  snap.Revision         `json:"current"`
-	Auto     bool                  `json:"auto,omitempty"`
+	SetID     uint64                `json:"set-id"`
+	Snap      string                `json:"snap"`
+	Users     []string              `json:"users,omitempty"`
+	Options   *snap.SnapshotOptions `json:"options,omitempty"`
+	Filename  string                `json:"filename,omitempty"`
+	Current   snap.Revision         `json:"current"`
+	Auto      bool                  `json:"auto,omitempty"`
+	Encrypted bool                  `json:"encrypted,omitempty"`
+	Scheduled bool                  `json:"scheduled,omitempty"`
 }
 
 func filename(setID uint64, si *snap.Info) string {
@@ -215,6 +490,11 @@ func prepareSave(task *state.Task) (snapshot *snapshotSetup, cur *snap.Info, cfg
 			return nil, nil, nil, err
 		}
 	}
+	if snapshot.Scheduled {
+		if err := saveScheduled(st, snapshot.SetID, timeNow()); err != nil {
+			return nil, nil, nil, err
+		}
+	}
 
 	return snapshot, cur, cfg, nil
 }
@@ -228,12 +508,33 @@ func doSave(task *state.Task, tomb *tomb.Tomb) error {
 
 	st.Lock()
 	opts, err := getSnapDirOpts(st, snapshot.Snap)
+	if err != nil {
+		st.Unlock()
+		return err
+	}
+	var key *client.SnapshotKey
+	if snapshot.Encrypted {
+		key, err = cachedSnapshotKey(task, snapshot.SetID)
+		if err != nil {
+			st.Unlock()
+			return err
+		}
+	}
+	incremental, err := IncrementalSnapshots(st)
 	st.Unlock()
 	if err != nil {
 		return err
 	}
 
-	_, err = backendSave(tomb.Context(nil), snapshot.SetID, cur, cfg, snapshot.Users, snapshot.Options, opts)
+	switch {
+	case key != nil:
+		// encrypted snapshots are never incremental
+		_, err = backendSaveEncrypted(tomb.Context(nil), snapshot.SetID, cur, cfg, snapshot.Users, snapshot.Options, opts, key)
+	case incremental:
+		_, err = backendSaveIncr(tomb.Context(nil), snapshot.SetID, cur, cfg, snapshot.Users, snapshot.Options, opts)
+	default:
+		_, err = backendSave(tomb.Context(nil), snapshot.SetID, cur, cfg, snapshot.Users, snapshot.Options, opts)
+	}
 	if err != nil {
 		st.Lock()
 		defer st.Unlock()
@@ -244,27 +545,55 @@ func doSave(task *state.Task, tomb *tomb.Tomb) error {
 
 // prepareRestore does the steps of doRestore that require the state lock
 // before the backend Restore call.
-func prepareRestore(task *state.Task) (snapshot *snapshotSetup, oldCfg map[string]interface{}, reader *backend.Reader, err error) {
+func prepareRestore(task *state.Task) (snapshot *snapshotSetup, oldCfg map[string]interface{}, reader *backend.Reader, key *client.SnapshotKey, err error) {
 	st := task.State()
 
 	st.Lock()
 	defer st.Unlock()
 
 	if err := task.Get("snapshot-setup", &snapshot); err != nil {
-		return nil, nil, nil, taskGetErrMsg(task, err, "snapshot")
+		return nil, nil, nil, nil, taskGetErrMsg(task, err, "snapshot")
 	}
 
 	oldCfg, err = unmarshalSnapConfig(st, snapshot.Snap)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
-	reader, err = backendOpen(snapshot.Filename, backend.ExtractFnameSetID)
+	reader, key, err = openSnapshot(task, snapshot)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("cannot open snapshot: %v", err)
+		return nil, nil, nil, nil, err
 	}
 	// note given the Open succeeded, caller needs to close it when done
 
-	return snapshot, oldCfg, reader, nil
+	return snapshot, oldCfg, reader, key, nil
+}
+
+// openSnapshot opens the snapshot of the given task, and returns the key to
+// unlock it with if it is encrypted. The state must be locked by the caller.
+func openSnapshot(task *state.Task, snapshot *snapshotSetup) (reader *backend.Reader, key *client.SnapshotKey, err error) {
+	if snapshot.Encrypted {
+		key, err = cachedSnapshotKey(task, snapshot.SetID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	reader, err = backendOpen(snapshot.Filename, backend.ExtractFnameSetID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot open snapshot: %v", err)
+	}
+	return reader, key, nil
+}
+
+// unlockSnapshot unlocks an encrypted snapshot; this can be slow, so it
+// should be called without holding the state lock.
+func unlockSnapshot(reader *backend.Reader, key *client.SnapshotKey) error {
+	if key == nil {
+		return nil
+	}
+	if err := backendUnlock(reader, key); err != nil {
+		return fmt.Errorf("cannot unlock snapshot: %v", err)
+	}
+	return nil
 }
 
 // marshalSnapConfig encodes cfg to JSON and returns raw JSON message, unless
@@ -298,12 +627,16 @@ func unmarshalSnapConfig(st *state.State, snapName string) (map[string]interface
 }
 
 func doRestore(task *state.Task, tomb *tomb.Tomb) error {
-	snapshot, oldCfg, reader, err := prepareRestore(task)
+	snapshot, oldCfg, reader, key, err := prepareRestore(task)
 	if err != nil {
 		return err
 	}
 	defer reader.Close()
 
+	if err := unlockSnapshot(reader, key); err != nil {
+		return err
+	}
+
 	st := task.State()
 	logf := func(format string, args ...interface{}) {
 		st.Lock()
@@ -422,17 +755,21 @@ func doCheck(task *state.Task, tomb *tomb.Tomb) error {
 	st := task.State()
 	st.Lock()
 	err := task.Get("snapshot-setup", &snapshot)
-	st.Unlock()
 	if err != nil {
+		st.Unlock()
 		return taskGetErrMsg(task, err, "snapshot")
 	}
-
-	reader, err := backendOpen(snapshot.Filename, backend.ExtractFnameSetID)
+	reader, key, err := openSnapshot(task, &snapshot)
+	st.Unlock()
 	if err != nil {
-		return fmt.Errorf("cannot open snapshot: %v", err)
+		return err
 	}
 	defer reader.Close()
 
+	if err := unlockSnapshot(reader, key); err != nil {
+		return err
+	}
+
 	return backendCheck(reader, tomb.Context(nil), snapshot.Users)
 }
 
@@ -458,7 +795,182 @@ func doForget(task *state.Task, _ *tomb.Tomb) error {
 		return fmt.Errorf("internal error: cannot remove state of snapshot set %d: %v", snapshot.SetID, err)
 	}
 
-	return osRemove(snapshot.Filename)
+	if err := osRemove(snapshot.Filename); err != nil {
+		return err
+	}
+
+	// chunks of incremental snapshots are shared with other snapshots,
+	// so they are only removed once no snapshot references them
+	st.Unlock()
+	defer st.Lock()
+	cleanupUnreferencedChunks()
+
+	return nil
+}
+
+func doPush(task *state.Task, tomb *tomb.Tomb) error {
+	ctx := tomb.Context(nil)
+	st := task.State()
+	st.Lock()
+	var snapshot snapshotSetup
+	if err := task.Get("snapshot-setup", &snapshot); err != nil {
+		st.Unlock()
+		return taskGetErrMsg(task, err, "snapshot")
+	}
+	cfg, err := remoteRepositoryConfig(st)
+	if err != nil {
+		st.Unlock()
+		return err
+	}
+	sets, err := backendList(ctx, snapshot.SetID, nil)
+	if err != nil {
+		st.Unlock()
+		return err
+	}
+	if len(sets) == 0 {
+		st.Unlock()
+		return client.ErrSnapshotSetNotFound
+	}
+	// the export keeps the files of the set open, so it is created with
+	// the state locked for them not to go away from under it
+	se, err := backendNewSnapshotExport(ctx, snapshot.SetID)
+	st.Unlock()
+	if err != nil {
+		return err
+	}
+	defer se.Close()
+
+	repo, err := remoteOpen(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	set, err := remoteSnapshotSet(&sets[0], 0)
+	if err != nil {
+		return err
+	}
+	// anything but valid metadata is overwritten by pushing again
+	if _, err := readRemoteMetadata(ctx, repo, set.ID); err == nil {
+		st.Lock()
+		task.Logf("Snapshot set #%d is already in the remote snapshot repository as %s", snapshot.SetID, set.ID)
+		st.Unlock()
+		return nil
+	}
+
+	if err := se.Init(); err != nil {
+		return err
+	}
+	set.Size = se.Size()
+	pr, pw := io.Pipe()
+	streamed := make(chan error, 1)
+	go func() {
+		err := se.StreamTo(pw)
+		pw.CloseWithError(err)
+		streamed <- err
+	}()
+	err = repo.Put(ctx, remoteSnapshotName(set.ID), pr, set.Size)
+	// unblock the export if the upload failed
+	pr.Close()
+	if serr := <-streamed; err == nil {
+		err = serr
+	}
+	if err != nil {
+		return fmt.Errorf("cannot push snapshot set #%d: %v", snapshot.SetID, err)
+	}
+
+	metadata, err := json.Marshal(set)
+	if err != nil {
+		return err
+	}
+	if err := repo.Put(ctx, remoteMetadataName(set.ID), bytes.NewReader(metadata), int64(len(metadata))); err != nil {
+		return fmt.Errorf("cannot push snapshot set #%d: %v", snapshot.SetID, err)
+	}
+
+	st.Lock()
+	task.Logf("Pushed snapshot set #%d as %s", snapshot.SetID, set.ID)
+	st.Unlock()
+	return nil
+}
+
+// resolveRemoteID returns the full ID of the remote snapshot set identified
+// by the given, possibly abbreviated, ID.
+func resolveRemoteID(ctx context.Context, repo remote.Repository, remoteID string) (string, error) {
+	sets, err := listRemote(ctx, repo)
+	if err != nil {
+		return "", err
+	}
+	var found []string
+	for _, set := range sets {
+		if set.ID == remoteID {
+			return set.ID, nil
+		}
+		if strings.HasPrefix(set.ID, remoteID) {
+			found = append(found, set.ID)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("cannot find snapshot set %s in the remote snapshot repository", remoteID)
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("remote snapshot set ID %s is ambiguous", remoteID)
+	}
+}
+
+func doPull(task *state.Task, tomb *tomb.Tomb) error {
+	ctx := tomb.Context(nil)
+	st := task.State()
+	st.Lock()
+	var pull snapshotPull
+	if err := task.Get("snapshot-pull", &pull); err != nil {
+		st.Unlock()
+		return taskGetErrMsg(task, err, "snapshot pull")
+	}
+	var key *client.SnapshotKey
+	if pull.Encrypted {
+		if key = cachedKey(task); key == nil {
+			st.Unlock()
+			return fmt.Errorf("key of remote snapshot set %s is no longer available", pull.RemoteID)
+		}
+	}
+	cfg, err := remoteRepositoryConfig(st)
+	st.Unlock()
+	if err != nil {
+		return err
+	}
+
+	repo, err := remoteOpen(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	remoteID, err := resolveRemoteID(ctx, repo, pull.RemoteID)
+	if err != nil {
+		return err
+	}
+	rc, err := repo.Get(ctx, remoteSnapshotName(remoteID))
+	if err != nil {
+		return fmt.Errorf("cannot pull snapshot set %s: %v", remoteID, err)
+	}
+	defer rc.Close()
+
+	// importing checks whether the set is already on the device
+	setID, snapNames, err := Import(ctx, st, rc, key)
+	if err != nil {
+		return fmt.Errorf("cannot pull snapshot set %s: %v", remoteID, err)
+	}
+
+	st.Lock()
+	defer st.Unlock()
+	task.Logf("Pulled snapshot set %s as snapshot set #%d", remoteID, setID)
+	task.Change().Set("api-data", map[string]interface{}{
+		"set-id":     setID,
+		"snap-names": snapNames,
+	})
+	return nil
 }
 
 func delayedCrossMgrInit() {
@@ -475,3 +987,19 @@ func MockBackendSave(f func(context.Context, uint64, *snap.Info, map[string]inte
 		backendSave = old
 	}
 }
+
+func MockBackendSaveIncremental(f func(context.Context, uint64, *snap.Info, map[string]interface{}, []string, *snap.SnapshotOptions, *dirs.SnapDirOptions) (*client.Snapshot, error)) (restore func()) {
+	old := backendSaveIncr
+	backendSaveIncr = f
+	return func() {
+		backendSaveIncr = old
+	}
+}
+
+func MockBackendSaveEncrypted(f func(context.Context, uint64, *snap.Info, map[string]interface{}, []string, *snap.SnapshotOptions, *dirs.SnapDirOptions, *client.SnapshotKey) (*client.Snapshot, error)) (restore func()) {
+	old := backendSaveEncrypted
+	backendSaveEncrypted = f
+	return func() {
+		backendSaveEncrypted = old
+	}
+}
@@ -20,9 +20,13 @@
 package snapshotstate_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
@@ -35,8 +39,11 @@ import (
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/overlord"
+	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/snapshotstate"
 	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
+	"github.com/snapcore/snapd/overlord/snapshotstate/remote"
+	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/testutil"
@@ -55,6 +62,8 @@ func (snapshotSuite) TestManager(c *check.C) {
 		"check-snapshot",
 		"cleanup-after-restore",
 		"forget-snapshot",
+		"pull-snapshot",
+		"push-snapshot",
 		"restore-snapshot",
 		"save-snapshot",
 	})
@@ -319,6 +328,128 @@ func (snapshotSuite) TestDoSave(c *check.C) {
 	}
 }
 
+func (snapshotSuite) TestDoSaveIncremental(c *check.C) {
+	snapInfo := snap.Info{
+		SideInfo: snap.SideInfo{
+			RealName: "a-snap",
+			Revision: snap.R(-1),
+		},
+		Version: "1.33",
+	}
+	defer snapshotstate.MockSnapstateCurrentInfo(func(_ *state.State, snapname string) (*snap.Info, error) {
+		return &snapInfo, nil
+	})()
+	defer snapshotstate.MockConfigGetSnapConfig(func(*state.State, string) (*json.RawMessage, error) {
+		return nil, nil
+	})()
+
+	var calls []string
+	defer snapshotstate.MockBackendSave(func(context.Context, uint64, *snap.Info, map[string]interface{}, []string, *snap.SnapshotOptions, *dirs.SnapDirOptions) (*client.Snapshot, error) {
+		calls = append(calls, "save")
+		return nil, nil
+	})()
+	defer snapshotstate.MockBackendSaveIncremental(func(_ context.Context, id uint64, si *snap.Info, _ map[string]interface{}, _ []string, _ *snap.SnapshotOptions, _ *dirs.SnapDirOptions) (*client.Snapshot, error) {
+		calls = append(calls, "save-incremental")
+		c.Check(id, check.Equals, uint64(42))
+		c.Check(si, check.DeepEquals, &snapInfo)
+		return nil, nil
+	})()
+
+	st := state.New(nil)
+	for _, incremental := range []interface{}{true, false, "true", "false"} {
+		st.Lock()
+		tr := config.NewTransaction(st)
+		tr.Set("core", "snapshots.incremental", incremental)
+		tr.Commit()
+		task := st.NewTask("save-snapshot", "...")
+		task.Set("snapshot-setup", map[string]interface{}{
+			"set-id": 42,
+			"snap":   "a-snap",
+		})
+		st.Unlock()
+
+		err := snapshotstate.DoSave(task, &tomb.Tomb{})
+		c.Assert(err, check.IsNil)
+	}
+	c.Check(calls, check.DeepEquals, []string{"save-incremental", "save", "save-incremental", "save"})
+}
+
+func (snapshotSuite) TestDoSaveEncrypted(c *check.C) {
+	snapInfo := snap.Info{
+		SideInfo: snap.SideInfo{
+			RealName: "a-snap",
+			Revision: snap.R(-1),
+		},
+		Version: "1.33",
+	}
+	defer snapshotstate.MockSnapstateCurrentInfo(func(_ *state.State, snapname string) (*snap.Info, error) {
+		return &snapInfo, nil
+	})()
+	defer snapshotstate.MockConfigGetSnapConfig(func(*state.State, string) (*json.RawMessage, error) {
+		return nil, nil
+	})()
+
+	key := &client.SnapshotKey{Passphrase: "s3cret"}
+	var calls []string
+	defer snapshotstate.MockBackendSaveIncremental(func(context.Context, uint64, *snap.Info, map[string]interface{}, []string, *snap.SnapshotOptions, *dirs.SnapDirOptions) (*client.Snapshot, error) {
+		calls = append(calls, "save-incremental")
+		return nil, nil
+	})()
+	defer snapshotstate.MockBackendSaveEncrypted(func(_ context.Context, id uint64, si *snap.Info, _ map[string]interface{}, _ []string, _ *snap.SnapshotOptions, _ *dirs.SnapDirOptions, k *client.SnapshotKey) (*client.Snapshot, error) {
+		calls = append(calls, "save-encrypted")
+		c.Check(id, check.Equals, uint64(42))
+		c.Check(si, check.DeepEquals, &snapInfo)
+		c.Check(k, check.Equals, key)
+		return nil, nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	// encrypted snapshots are never incremental
+	tr := config.NewTransaction(st)
+	tr.Set("core", "snapshots.incremental", true)
+	tr.Commit()
+	task := st.NewTask("save-snapshot", "...")
+	task.Set("snapshot-setup", map[string]interface{}{
+		"set-id":    42,
+		"snap":      "a-snap",
+		"encrypted": true,
+	})
+	snapshotstate.CacheSnapshotKey(st, task, key)
+	st.Unlock()
+
+	err := snapshotstate.DoSave(task, &tomb.Tomb{})
+	c.Assert(err, check.IsNil)
+	c.Check(calls, check.DeepEquals, []string{"save-encrypted"})
+}
+
+func (snapshotSuite) TestDoSaveEncryptedFailsNoKey(c *check.C) {
+	defer snapshotstate.MockSnapstateCurrentInfo(func(_ *state.State, snapname string) (*snap.Info, error) {
+		return &snap.Info{SideInfo: snap.SideInfo{RealName: "a-snap", Revision: snap.R(-1)}}, nil
+	})()
+	defer snapshotstate.MockConfigGetSnapConfig(func(*state.State, string) (*json.RawMessage, error) {
+		return nil, nil
+	})()
+	defer snapshotstate.MockBackendSaveEncrypted(func(context.Context, uint64, *snap.Info, map[string]interface{}, []string, *snap.SnapshotOptions, *dirs.SnapDirOptions, *client.SnapshotKey) (*client.Snapshot, error) {
+		c.Fatal("unexpected call to backend")
+		return nil, nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	// e.g. snapd was restarted after the task was created
+	task := st.NewTask("save-snapshot", "...")
+	task.Set("snapshot-setup", map[string]interface{}{
+		"set-id":    42,
+		"snap":      "a-snap",
+		"encrypted": true,
+	})
+	st.Unlock()
+
+	err := snapshotstate.DoSave(task, &tomb.Tomb{})
+	c.Assert(err, check.ErrorMatches, `key of encrypted snapshot set #42 is no longer available`)
+}
+
 func (snapshotSuite) TestDoSaveGetsSnapDirOpts(c *check.C) {
 	restore := snapshotstate.MockGetSnapDirOptions(func(*state.State, string) (*dirs.SnapDirOptions, error) {
 		return &dirs.SnapDirOptions{HiddenSnapDataDir: true}, nil
@@ -590,6 +721,10 @@ func (rs *readerSuite) SetUpTest(c *check.C) {
 		snapshotstate.MockBackendCleanup(func(*backend.RestoreState) {
 			rs.calls = append(rs.calls, "cleanup")
 		}),
+		snapshotstate.MockBackendCleanupUnreferencedChunks(func() (int, error) {
+			rs.calls = append(rs.calls, "cleanup chunks")
+			return 0, nil
+		}),
 	}
 }
 
@@ -838,6 +973,78 @@ func (rs *readerSuite) TestDoCheck(c *check.C) {
 	c.Check(rs.calls, check.DeepEquals, []string{"open", "check"})
 }
 
+func (rs *readerSuite) setEncrypted(key *client.SnapshotKey) {
+	st := rs.task.State()
+	st.Lock()
+	defer st.Unlock()
+	rs.task.Set("snapshot-setup", map[string]interface{}{
+		"set-id":    1,
+		"snap":      "a-snap",
+		"filename":  "/some/1_file.zip",
+		"users":     []string{"a-user", "b-user"},
+		"encrypted": true,
+	})
+	if key != nil {
+		snapshotstate.CacheSnapshotKey(st, rs.task, key)
+	}
+}
+
+func (rs *readerSuite) TestDoRestoreEncrypted(c *check.C) {
+	key := &client.SnapshotKey{Passphrase: "s3cret"}
+	rs.setEncrypted(key)
+	defer snapshotstate.MockBackendUnlock(func(_ *backend.Reader, k *client.SnapshotKey) error {
+		rs.calls = append(rs.calls, "unlock")
+		c.Check(k, check.Equals, key)
+		return nil
+	})()
+
+	err := snapshotstate.DoRestore(rs.task, &tomb.Tomb{})
+	c.Assert(err, check.IsNil)
+	c.Check(rs.calls, check.DeepEquals, []string{"get config", "open", "unlock", "restore", "set config"})
+}
+
+func (rs *readerSuite) TestDoRestoreEncryptedFailsUnlockError(c *check.C) {
+	rs.setEncrypted(&client.SnapshotKey{Passphrase: "wrong"})
+	defer snapshotstate.MockBackendUnlock(func(*backend.Reader, *client.SnapshotKey) error {
+		rs.calls = append(rs.calls, "unlock")
+		return client.ErrSnapshotKeyInvalid
+	})()
+
+	err := snapshotstate.DoRestore(rs.task, &tomb.Tomb{})
+	c.Assert(err, check.ErrorMatches, `cannot unlock snapshot: invalid key for encrypted snapshot set`)
+	c.Check(rs.calls, check.DeepEquals, []string{"get config", "open", "unlock"})
+}
+
+func (rs *readerSuite) TestDoRestoreEncryptedFailsNoKey(c *check.C) {
+	rs.setEncrypted(nil)
+
+	err := snapshotstate.DoRestore(rs.task, &tomb.Tomb{})
+	c.Assert(err, check.ErrorMatches, `key of encrypted snapshot set #1 is no longer available`)
+	c.Check(rs.calls, check.DeepEquals, []string{"get config"})
+}
+
+func (rs *readerSuite) TestDoCheckEncrypted(c *check.C) {
+	key := &client.SnapshotKey{Device: true}
+	rs.setEncrypted(key)
+	defer snapshotstate.MockBackendUnlock(func(_ *backend.Reader, k *client.SnapshotKey) error {
+		rs.calls = append(rs.calls, "unlock")
+		c.Check(k, check.Equals, key)
+		return nil
+	})()
+
+	err := snapshotstate.DoCheck(rs.task, &tomb.Tomb{})
+	c.Assert(err, check.IsNil)
+	c.Check(rs.calls, check.DeepEquals, []string{"open", "unlock", "check"})
+}
+
+func (rs *readerSuite) TestDoCheckEncryptedFailsNoKey(c *check.C) {
+	rs.setEncrypted(nil)
+
+	err := snapshotstate.DoCheck(rs.task, &tomb.Tomb{})
+	c.Assert(err, check.ErrorMatches, `key of encrypted snapshot set #1 is no longer available`)
+	c.Check(rs.calls, check.HasLen, 0)
+}
+
 func (rs *readerSuite) TestDoRemove(c *check.C) {
 	defer snapshotstate.MockOsRemove(func(filename string) error {
 		c.Check(filename, check.Equals, "/some/1_file.zip")
@@ -846,9 +1053,33 @@ func (rs *readerSuite) TestDoRemove(c *check.C) {
 	})()
 	err := snapshotstate.DoForget(rs.task, &tomb.Tomb{})
 	c.Assert(err, check.IsNil)
+	c.Check(rs.calls, check.DeepEquals, []string{"remove", "cleanup chunks"})
+}
+
+func (rs *readerSuite) TestDoRemoveFailsNoChunksCleanup(c *check.C) {
+	defer snapshotstate.MockOsRemove(func(filename string) error {
+		rs.calls = append(rs.calls, "remove")
+		return errors.New("bzzt")
+	})()
+	err := snapshotstate.DoForget(rs.task, &tomb.Tomb{})
+	c.Assert(err, check.ErrorMatches, "bzzt")
 	c.Check(rs.calls, check.DeepEquals, []string{"remove"})
 }
 
+func (rs *readerSuite) TestDoRemoveChunksCleanupErrorLogged(c *check.C) {
+	logbuf, restore := logger.MockLogger()
+	defer restore()
+	defer snapshotstate.MockBackendCleanupUnreferencedChunks(func() (int, error) {
+		rs.calls = append(rs.calls, "cleanup chunks")
+		return 0, errors.New("some error")
+	})()
+
+	err := snapshotstate.DoForget(rs.task, &tomb.Tomb{})
+	c.Assert(err, check.IsNil)
+	c.Check(rs.calls, check.DeepEquals, []string{"remove", "cleanup chunks"})
+	c.Check(logbuf.String(), testutil.Contains, "cannot cleanup unreferenced snapshot chunks: some error\n")
+}
+
 func (rs *readerSuite) TestDoForgetRemovesAutomaticSnapshotExpiry(c *check.C) {
 	defer snapshotstate.MockOsRemove(func(filename string) error {
 		return nil
@@ -905,6 +1136,25 @@ func (snapshotSuite) TestManagerRunCleanupAbandonedImportsAtStartup(c *check.C)
 	c.Check(n, check.Equals, 1)
 }
 
+func (snapshotSuite) TestManagerRunCleanupUnreferencedChunksAtStartup(c *check.C) {
+	n := 0
+	restore := snapshotstate.MockBackendCleanupUnreferencedChunks(func() (int, error) {
+		n++
+		return 0, nil
+	})
+	defer restore()
+
+	o := overlord.Mock()
+	st := o.State()
+	mgr := snapshotstate.Manager(st, state.NewTaskRunner(st))
+	c.Assert(mgr, check.NotNil)
+	o.AddManager(mgr)
+	err := o.Settle(100 * time.Millisecond)
+	c.Assert(err, check.IsNil)
+
+	c.Check(n, check.Equals, 1)
+}
+
 func (snapshotSuite) TestManagerRunCleanupAbandonedImportsAtStartupErrorLogged(c *check.C) {
 	logbuf, restore := logger.MockLogger()
 	defer restore()
@@ -927,3 +1177,552 @@ func (snapshotSuite) TestManagerRunCleanupAbandonedImportsAtStartupErrorLogged(c
 	c.Check(n, check.Equals, 1)
 	c.Check(logbuf.String(), testutil.Contains, "cannot cleanup incomplete imports: some error\n")
 }
+
+func (snapshotSuite) mockPushableSet(c *check.C) *client.SnapshotSet {
+	set := &client.SnapshotSet{ID: 42, Snapshots: []*client.Snapshot{{
+		SetID:    42,
+		Time:     time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Snap:     "a-snap",
+		Revision: snap.R(1),
+		SHA3_384: map[string]string{"archive.tgz": "some-hash"},
+		Encryption: &client.SnapshotEncryption{
+			KeySource: client.SnapshotKeySourceDevice,
+		},
+	}}}
+	return set
+}
+
+func (s *snapshotSuite) TestDoPush(c *check.C) {
+	set := s.mockPushableSet(c)
+	defer snapshotstate.MockBackendList(func(_ context.Context, setID uint64, snapNames []string) ([]client.SnapshotSet, error) {
+		c.Check(setID, check.Equals, uint64(42))
+		c.Check(snapNames, check.HasLen, 0)
+		return []client.SnapshotSet{*set}, nil
+	})()
+	exports := 0
+	defer snapshotstate.MockBackendNewSnapshotExport(func(_ context.Context, setID uint64) (*backend.SnapshotExport, error) {
+		c.Check(setID, check.Equals, uint64(42))
+		exports++
+		return &backend.SnapshotExport{}, nil
+	})()
+
+	repoDir := c.MkDir()
+	st := state.New(nil)
+	st.Lock()
+	tr := config.NewTransaction(st)
+	tr.Set("core", "snapshots.remote.url", repoDir)
+	tr.Commit()
+	chg := st.NewChange("push-snapshot", "...")
+	task := st.NewTask("push-snapshot", "...")
+	task.Set("snapshot-setup", map[string]interface{}{"set-id": 42})
+	chg.AddTask(task)
+	st.Unlock()
+
+	c.Assert(snapshotstate.DoPush(task, &tomb.Tomb{}), check.IsNil)
+
+	h, err := set.ContentHash()
+	c.Assert(err, check.IsNil)
+	id := hex.EncodeToString(h)
+	data, err := os.ReadFile(filepath.Join(repoDir, id+".snapshot"))
+	c.Assert(err, check.IsNil)
+	// the export is a tar file
+	c.Check(len(data)%512, check.Equals, 0)
+	var metadata map[string]interface{}
+	metadataJSON, err := os.ReadFile(filepath.Join(repoDir, id+".json"))
+	c.Assert(err, check.IsNil)
+	c.Assert(json.Unmarshal(metadataJSON, &metadata), check.IsNil)
+	c.Check(metadata, check.DeepEquals, map[string]interface{}{
+		"id":         id,
+		"set-id":     42.,
+		"time":       "2024-01-02T03:04:05Z",
+		"snaps":      []interface{}{"a-snap"},
+		"size":       float64(len(data)),
+		"key-source": "device",
+	})
+
+	st.Lock()
+	c.Check(task.Log(), check.HasLen, 1)
+	c.Check(task.Log()[0], check.Matches, fmt.Sprintf(".* Pushed snapshot set #42 as %s", id))
+	st.Unlock()
+
+	// pushing again does nothing
+	c.Assert(snapshotstate.DoPush(task, &tomb.Tomb{}), check.IsNil)
+	st.Lock()
+	c.Check(task.Log(), check.HasLen, 2)
+	c.Check(task.Log()[1], check.Matches, fmt.Sprintf(".* Snapshot set #42 is already in the remote snapshot repository as %s", id))
+	st.Unlock()
+	c.Check(exports, check.Equals, 2)
+}
+
+func (s *snapshotSuite) TestDoPushFailsPutError(c *check.C) {
+	set := s.mockPushableSet(c)
+	defer snapshotstate.MockBackendList(func(context.Context, uint64, []string) ([]client.SnapshotSet, error) {
+		return []client.SnapshotSet{*set}, nil
+	})()
+	defer snapshotstate.MockBackendNewSnapshotExport(func(context.Context, uint64) (*backend.SnapshotExport, error) {
+		return &backend.SnapshotExport{}, nil
+	})()
+	repo := &fakeRepository{putErr: errors.New("boom")}
+	defer snapshotstate.MockRemoteOpen(func(_ context.Context, cfg *remote.Config) (remote.Repository, error) {
+		c.Check(cfg, check.DeepEquals, &remote.Config{URL: "s3://example.com/bucket", Credentials: "/etc/s3.json"})
+		return repo, nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	tr := config.NewTransaction(st)
+	tr.Set("core", "snapshots.remote.url", "s3://example.com/bucket")
+	tr.Set("core", "snapshots.remote.credentials", "/etc/s3.json")
+	tr.Commit()
+	task := st.NewTask("push-snapshot", "...")
+	task.Set("snapshot-setup", map[string]interface{}{"set-id": 42})
+	st.Unlock()
+
+	err := snapshotstate.DoPush(task, &tomb.Tomb{})
+	c.Assert(err, check.ErrorMatches, "cannot push snapshot set #42: boom")
+	c.Check(repo.closed, check.Equals, true)
+}
+
+func (s *snapshotSuite) TestDoPushFailsNoRemoteRepository(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	task := st.NewTask("push-snapshot", "...")
+	task.Set("snapshot-setup", map[string]interface{}{"set-id": 42})
+	st.Unlock()
+
+	err := snapshotstate.DoPush(task, &tomb.Tomb{})
+	c.Assert(err, check.Equals, snapshotstate.ErrNoRemoteRepository)
+}
+
+// fakeRepository is a remote.Repository keeping objects in memory.
+type fakeRepository struct {
+	objects map[string][]byte
+	putErr  error
+	closed  bool
+}
+
+func (r *fakeRepository) Put(_ context.Context, name string, rd io.Reader, size int64) error {
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+	if r.putErr != nil {
+		return r.putErr
+	}
+	if r.objects == nil {
+		r.objects = make(map[string][]byte)
+	}
+	r.objects[name] = data
+	return nil
+}
+
+func (r *fakeRepository) Get(_ context.Context, name string) (io.ReadCloser, error) {
+	data, ok := r.objects[name]
+	if !ok {
+		return nil, remote.ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (r *fakeRepository) List(context.Context) ([]string, error) {
+	var names []string
+	for name := range r.objects {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (r *fakeRepository) Close() error {
+	r.closed = true
+	return nil
+}
+
+func (r *fakeRepository) addSet(c *check.C, id string, data string) {
+	if r.objects == nil {
+		r.objects = make(map[string][]byte)
+	}
+	metadata, err := json.Marshal(&client.RemoteSnapshotSet{ID: id})
+	c.Assert(err, check.IsNil)
+	r.objects[id+".json"] = metadata
+	r.objects[id+".snapshot"] = []byte(data)
+}
+
+func (s *snapshotSuite) pullTask(c *check.C, repo *fakeRepository, remoteID string, key *client.SnapshotKey) (*state.State, *state.Task) {
+	s.AddCleanup(snapshotstate.MockRemoteOpen(func(context.Context, *remote.Config) (remote.Repository, error) {
+		return repo, nil
+	}))
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+	tr := config.NewTransaction(st)
+	tr.Set("core", "snapshots.remote.url", "s3://example.com/bucket")
+	tr.Commit()
+	ts, err := snapshotstate.Pull(st, remoteID, key)
+	c.Assert(err, check.IsNil)
+	chg := st.NewChange("pull-snapshot", "...")
+	chg.AddAll(ts)
+	return st, ts.Tasks()[0]
+}
+
+func (s *snapshotSuite) TestDoPull(c *check.C) {
+	repo := &fakeRepository{}
+	repo.addSet(c, "0123abcd", "exported data")
+	repo.addSet(c, "4567abcd", "other exported data")
+	key := &client.SnapshotKey{Passphrase: "s3cret"}
+	defer snapshotstate.MockBackendImport(func(_ context.Context, setID uint64, r io.Reader, flags *backend.ImportFlags) ([]string, error) {
+		data, err := io.ReadAll(r)
+		c.Assert(err, check.IsNil)
+		c.Check(string(data), check.Equals, "exported data")
+		c.Check(setID, check.Equals, uint64(1))
+		c.Check(flags, check.DeepEquals, &backend.ImportFlags{Key: key})
+		return []string{"a-snap", "b-snap"}, nil
+	})()
+
+	// abbreviated IDs are fine
+	st, task := s.pullTask(c, repo, "0123", key)
+	c.Assert(snapshotstate.DoPull(task, &tomb.Tomb{}), check.IsNil)
+
+	st.Lock()
+	defer st.Unlock()
+	var apiData map[string]interface{}
+	c.Assert(task.Change().Get("api-data", &apiData), check.IsNil)
+	c.Check(apiData, check.DeepEquals, map[string]interface{}{
+		"set-id":     1.,
+		"snap-names": []interface{}{"a-snap", "b-snap"},
+	})
+	c.Check(task.Log(), check.HasLen, 1)
+	c.Check(task.Log()[0], check.Matches, ".* Pulled snapshot set 0123abcd as snapshot set #1")
+	c.Check(repo.closed, check.Equals, true)
+}
+
+func (s *snapshotSuite) TestDoPullDuplicate(c *check.C) {
+	repo := &fakeRepository{}
+	repo.addSet(c, "0123abcd", "exported data")
+	defer snapshotstate.MockBackendImport(func(context.Context, uint64, io.Reader, *backend.ImportFlags) ([]string, error) {
+		return nil, backend.DuplicatedSnapshotImportError{SetID: 42, SnapNames: []string{"a-snap"}}
+	})()
+
+	st, task := s.pullTask(c, repo, "0123abcd", nil)
+	c.Assert(snapshotstate.DoPull(task, &tomb.Tomb{}), check.IsNil)
+
+	st.Lock()
+	defer st.Unlock()
+	var apiData map[string]interface{}
+	c.Assert(task.Change().Get("api-data", &apiData), check.IsNil)
+	c.Check(apiData, check.DeepEquals, map[string]interface{}{
+		"set-id":     42.,
+		"snap-names": []interface{}{"a-snap"},
+	})
+}
+
+func (s *snapshotSuite) TestDoPullFailsUnknownID(c *check.C) {
+	repo := &fakeRepository{}
+	repo.addSet(c, "0123abcd", "exported data")
+	repo.addSet(c, "0123ef01", "other exported data")
+	// incomplete sets are not considered
+	repo.objects["4567abcd.snapshot"] = nil
+
+	_, task := s.pullTask(c, repo, "4567", nil)
+	err := snapshotstate.DoPull(task, &tomb.Tomb{})
+	c.Check(err, check.ErrorMatches, "cannot find snapshot set 4567 in the remote snapshot repository")
+
+	_, task = s.pullTask(c, repo, "0123", nil)
+	err = snapshotstate.DoPull(task, &tomb.Tomb{})
+	c.Check(err, check.ErrorMatches, "remote snapshot set ID 0123 is ambiguous")
+}
+
+func (s *snapshotSuite) TestDoPullFailsImportError(c *check.C) {
+	repo := &fakeRepository{}
+	repo.addSet(c, "0123abcd", "exported data")
+	defer snapshotstate.MockBackendImport(func(context.Context, uint64, io.Reader, *backend.ImportFlags) ([]string, error) {
+		return nil, &backend.KeyRequiredError{KeySource: client.SnapshotKeySourcePassphrase}
+	})()
+
+	_, task := s.pullTask(c, repo, "0123abcd", nil)
+	err := snapshotstate.DoPull(task, &tomb.Tomb{})
+	c.Check(err, check.ErrorMatches, "cannot pull snapshot set 0123abcd: snapshot set is encrypted and requires a key")
+}
+
+func (s *snapshotSuite) TestDoPullFailsNoKey(c *check.C) {
+	st, task := s.pullTask(c, &fakeRepository{}, "0123abcd", &client.SnapshotKey{Passphrase: "s3cret"})
+	st.Lock()
+	snapshotstate.ForgetSnapshotKeys(task.Change(), state.DoingStatus, state.DoneStatus)
+	st.Unlock()
+
+	err := snapshotstate.DoPull(task, &tomb.Tomb{})
+	c.Check(err, check.ErrorMatches, "key of remote snapshot set 0123abcd is no longer available")
+}
+
+func (s *snapshotSuite) TestEnsureSchedulesPush(c *check.C) {
+	shotfile, err := os.Create(filepath.Join(c.MkDir(), "foo.zip"))
+	c.Assert(err, check.IsNil)
+	defer shotfile.Close()
+	defer snapshotstate.MockBackendIter(func(_ context.Context, f func(*backend.Reader) error) error {
+		for _, setID := range []uint64{1, 1, 2, 3} {
+			c.Assert(f(&backend.Reader{
+				Snapshot: client.Snapshot{SetID: setID, Snap: "a-snap"},
+				File:     shotfile,
+			}), check.IsNil)
+		}
+		return nil
+	})()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	defer snapshotstate.MockTimeNow(func() time.Time { return now })()
+
+	st := state.New(nil)
+	runner := state.NewTaskRunner(st)
+	mgr := snapshotstate.Manager(st, runner)
+	// don't let forgetting expired snapshots get in the way
+	snapshotstate.SetLastForgetExpiredSnapshotTime(mgr, now)
+
+	st.Lock()
+	tr := config.NewTransaction(st)
+	tr.Set("core", "snapshots.remote.url", c.MkDir())
+	tr.Set("core", "snapshots.remote.schedule", "00:00-24:00")
+	tr.Commit()
+	st.Set("last-snapshot-push", now.AddDate(0, -2, 0))
+	// set 3 is being forgotten
+	chg := st.NewChange("forget-snapshot", "...")
+	task := st.NewTask("forget-snapshot", "...")
+	task.Set("snapshot-setup", map[string]interface{}{"set-id": 3})
+	chg.AddTask(task)
+	st.Unlock()
+
+	c.Assert(mgr.Ensure(), check.IsNil)
+
+	st.Lock()
+	var pushes []*state.Change
+	for _, chg := range st.Changes() {
+		if chg.Kind() == "push-snapshots" {
+			pushes = append(pushes, chg)
+		}
+	}
+	c.Assert(pushes, check.HasLen, 1)
+	var setIDs []uint64
+	for _, task := range pushes[0].Tasks() {
+		c.Check(task.Kind(), check.Equals, "push-snapshot")
+		var snapshot map[string]interface{}
+		c.Assert(task.Get("snapshot-setup", &snapshot), check.IsNil)
+		setIDs = append(setIDs, uint64(snapshot["set-id"].(float64)))
+	}
+	c.Check(setIDs, check.DeepEquals, []uint64{1, 2})
+	var last time.Time
+	c.Assert(st.Get("last-snapshot-push", &last), check.IsNil)
+	c.Check(last.Equal(now), check.Equals, true)
+	st.Unlock()
+
+	// the next push is not due yet
+	c.Assert(mgr.Ensure(), check.IsNil)
+	st.Lock()
+	c.Check(st.Changes(), check.HasLen, 2)
+	st.Unlock()
+}
+
+func (s *snapshotSuite) TestEnsureNoScheduledPush(c *check.C) {
+	defer snapshotstate.MockBackendIter(func(context.Context, func(*backend.Reader) error) error {
+		c.Fatal("unexpected call")
+		return nil
+	})()
+
+	st := state.New(nil)
+	mgr := snapshotstate.Manager(st, state.NewTaskRunner(st))
+	snapshotstate.SetLastForgetExpiredSnapshotTime(mgr, time.Now())
+
+	st.Lock()
+	tr := config.NewTransaction(st)
+	tr.Set("core", "snapshots.remote.url", c.MkDir())
+	tr.Commit()
+	st.Set("last-snapshot-push", time.Now().AddDate(-1, 0, 0))
+	st.Unlock()
+
+	c.Assert(mgr.Ensure(), check.IsNil)
+	st.Lock()
+	defer st.Unlock()
+	c.Check(st.Changes(), check.HasLen, 0)
+}
+
+func (snapshotSuite) TestDoSaveScheduled(c *check.C) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	defer snapshotstate.MockTimeNow(func() time.Time { return now })()
+	defer snapshotstate.MockSnapstateCurrentInfo(func(*state.State, string) (*snap.Info, error) {
+		return &snap.Info{SideInfo: snap.SideInfo{RealName: "a-snap", Revision: snap.R(1)}, Version: "1"}, nil
+	})()
+	defer snapshotstate.MockConfigGetSnapConfig(func(*state.State, string) (*json.RawMessage, error) {
+		return nil, nil
+	})()
+	defer snapshotstate.MockBackendSave(func(context.Context, uint64, *snap.Info, map[string]interface{}, []string, *snap.SnapshotOptions, *dirs.SnapDirOptions) (*client.Snapshot, error) {
+		return nil, nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	task := st.NewTask("save-snapshot", "...")
+	task.Set("snapshot-setup", map[string]interface{}{
+		"set-id":    42,
+		"snap":      "a-snap",
+		"scheduled": true,
+	})
+	st.Unlock()
+	c.Assert(snapshotstate.DoSave(task, &tomb.Tomb{}), check.IsNil)
+
+	st.Lock()
+	defer st.Unlock()
+	var snapshots map[uint64]map[string]interface{}
+	c.Assert(st.Get("snapshots", &snapshots), check.IsNil)
+	c.Check(snapshots[42]["scheduled"], check.Equals, "2024-03-01T12:00:00Z")
+	// scheduled sets don't expire
+	expired, err := snapshotstate.ExpiredSnapshotSets(st, now.AddDate(10, 0, 0))
+	c.Assert(err, check.IsNil)
+	c.Check(expired, check.HasLen, 0)
+}
+
+func (snapshotSuite) TestEnsureForgetsUnretainedScheduledSnapshots(c *check.C) {
+	defer testutil.Backup(&time.Local)()
+	time.Local = time.UTC
+
+	shotfile, err := os.Create(filepath.Join(c.MkDir(), "foo.zip"))
+	c.Assert(err, check.IsNil)
+	defer shotfile.Close()
+	defer snapshotstate.MockBackendIter(func(_ context.Context, f func(*backend.Reader) error) error {
+		for setID := uint64(1); setID <= 4; setID++ {
+			c.Assert(f(&backend.Reader{
+				Snapshot: client.Snapshot{SetID: setID, Snap: "a-snap"},
+				File:     shotfile,
+			}), check.IsNil)
+		}
+		return nil
+	})()
+	removed := 0
+	defer snapshotstate.MockOsRemove(func(string) error {
+		removed++
+		return nil
+	})()
+
+	st := state.New(nil)
+	mgr := snapshotstate.Manager(st, state.NewTaskRunner(st))
+
+	cleanups := 0
+	defer snapshotstate.MockBackendCleanupUnreferencedChunks(func() (int, error) {
+		// the state lock is not held while cleaning up chunks
+		st.Lock()
+		defer st.Unlock()
+		cleanups++
+		return 0, nil
+	})()
+
+	st.Lock()
+	tr := config.NewTransaction(st)
+	// as set by snap set, which stores integers as JSON numbers
+	tr.Set("core", "snapshots.retention.daily", 1)
+	tr.Set("core", "snapshots.retention.weekly", 1)
+	tr.Commit()
+	st.Set("snapshots", map[uint64]interface{}{
+		1: map[string]interface{}{"scheduled": "2024-03-01T10:00:00Z"},
+		2: map[string]interface{}{"scheduled": "2024-03-01T12:00:00Z"},
+		3: map[string]interface{}{"scheduled": "2024-03-02T12:00:00Z"},
+		4: map[string]interface{}{"expiry-time": "2037-02-12T12:50:00Z"},
+	})
+	st.Unlock()
+
+	c.Assert(mgr.Ensure(), check.IsNil)
+
+	st.Lock()
+	defer st.Unlock()
+	var snapshots map[uint64]interface{}
+	c.Assert(st.Get("snapshots", &snapshots), check.IsNil)
+	c.Check(snapshots, check.DeepEquals, map[uint64]interface{}{
+		3: map[string]interface{}{"scheduled": "2024-03-02T12:00:00Z"},
+		4: map[string]interface{}{"expiry-time": "2037-02-12T12:50:00Z"},
+	})
+	c.Check(removed, check.Equals, 2)
+	c.Check(cleanups, check.Equals, 1)
+}
+
+func (s *snapshotSuite) TestEnsureSchedulesSnapshot(c *check.C) {
+	defer snapshotstate.MockSnapstateAll(func(*state.State) (map[string]*snapstate.SnapState, error) {
+		return map[string]*snapstate.SnapState{
+			"a-snap": {Active: true},
+			"b-snap": {Active: true},
+			"c-snap": {Active: true},
+			"d-snap": {Active: false},
+			"e-snap": {Active: true},
+		}, nil
+	})()
+	defer snapshotstate.MockSnapstateCheckChangeConflictMany(func(_ *state.State, names []string, _ string) error {
+		if names[0] == "c-snap" {
+			return errors.New("c-snap is busy")
+		}
+		return nil
+	})()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	defer snapshotstate.MockTimeNow(func() time.Time { return now })()
+	logbuf, restore := logger.MockLogger()
+	defer restore()
+
+	st := state.New(nil)
+	mgr := snapshotstate.Manager(st, state.NewTaskRunner(st))
+
+	st.Lock()
+	tr := config.NewTransaction(st)
+	tr.Set("core", "snapshots.schedule", "00:00-24:00")
+	tr.Set("core", "snapshots.include", "a-snap,c-snap,d-snap,e-snap")
+	tr.Set("core", "snapshots.exclude", "e-snap")
+	tr.Commit()
+	st.Set("last-scheduled-snapshot", now.AddDate(0, -2, 0))
+	st.Unlock()
+
+	c.Assert(mgr.Ensure(), check.IsNil)
+
+	st.Lock()
+	c.Assert(st.Changes(), check.HasLen, 1)
+	chg := st.Changes()[0]
+	c.Check(chg.Kind(), check.Equals, "scheduled-snapshot")
+	c.Check(chg.Summary(), check.Equals, "Save scheduled snapshot set #1")
+	c.Assert(chg.Tasks(), check.HasLen, 1)
+	task := chg.Tasks()[0]
+	c.Check(task.Kind(), check.Equals, "save-snapshot")
+	var snapshot map[string]interface{}
+	c.Assert(task.Get("snapshot-setup", &snapshot), check.IsNil)
+	c.Check(snapshot, check.DeepEquals, map[string]interface{}{
+		"set-id":    1.,
+		"snap":      "a-snap",
+		"current":   "unset",
+		"scheduled": true,
+	})
+	c.Check(logbuf.String(), testutil.Contains, `skipping snap "c-snap" in scheduled snapshot: c-snap is busy`)
+	var last time.Time
+	c.Assert(st.Get("last-scheduled-snapshot", &last), check.IsNil)
+	c.Check(last.Equal(now), check.Equals, true)
+	st.Unlock()
+
+	// the next snapshot is not due yet
+	c.Assert(mgr.Ensure(), check.IsNil)
+	st.Lock()
+	c.Check(st.Changes(), check.HasLen, 1)
+	st.Unlock()
+}
+
+func (s *snapshotSuite) TestEnsureScheduledSnapshotSkipsWhileInProgress(c *check.C) {
+	defer snapshotstate.MockSnapstateAll(func(*state.State) (map[string]*snapstate.SnapState, error) {
+		c.Fatal("unexpected call")
+		return nil, nil
+	})()
+
+	st := state.New(nil)
+	mgr := snapshotstate.Manager(st, state.NewTaskRunner(st))
+
+	st.Lock()
+	tr := config.NewTransaction(st)
+	tr.Set("core", "snapshots.schedule", "00:00-24:00")
+	tr.Commit()
+	st.Set("last-scheduled-snapshot", time.Now().AddDate(0, -2, 0))
+	chg := st.NewChange("scheduled-snapshot", "...")
+	chg.AddTask(st.NewTask("save-snapshot", "..."))
+	st.Unlock()
+
+	c.Assert(mgr.Ensure(), check.IsNil)
+	st.Lock()
+	defer st.Unlock()
+	c.Check(st.Changes(), check.HasLen, 1)
+}
@@ -21,17 +21,23 @@ package snapshotstate
 
 import (
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"regexp"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/hookstate"
 	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
+	"github.com/snapcore/snapd/overlord/snapshotstate/remote"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/release"
@@ -46,13 +52,28 @@ var (
 	backendEstimateSnapshotSize      = backend.EstimateSnapshotSize
 	backendList                      = backend.List
 	backendNewSnapshotExport         = backend.NewSnapshotExport
+	backendCheckKeySource            = backend.CheckKeySource
+	backendExportCheckKey            = (*backend.SnapshotExport).CheckKey
+	remoteOpen                       = remote.Open
+
+	hookstateSetupPreSnapshotHook  = hookstate.SetupPreSnapshotHook
+	hookstateSetupPostSnapshotHook = hookstate.SetupPostSnapshotHook
 
 	// Default expiration time for automatic snapshots, if not set by the user
 	defaultAutomaticSnapshotExpiration = time.Hour * 24 * 31
+
+	// Default number of daily and weekly scheduled snapshot sets to keep,
+	// if not set by the user
+	defaultScheduledSnapshotRetentionDaily  = 7
+	defaultScheduledSnapshotRetentionWeekly = 4
 )
 
 type snapshotState struct {
 	ExpiryTime time.Time `json:"expiry-time"`
+	// Scheduled is the time a scheduled snapshot set was taken at, these
+	// sets are forgotten according to the snapshots.retention.* options
+	// instead of expiring.
+	Scheduled *time.Time `json:"scheduled,omitempty"`
 }
 
 func newSnapshotSetID(st *state.State) (uint64, error) {
@@ -151,9 +172,62 @@ func AutomaticSnapshotExpiration(st *state.State) (time.Duration, error) {
 	return defaultAutomaticSnapshotExpiration, nil
 }
 
+// IncrementalSnapshots returns whether snapshots should be saved as
+// incremental snapshots, as set by the snapshots.incremental core option.
+func IncrementalSnapshots(st *state.State) (bool, error) {
+	// the option is validated as either a boolean or a "true"/"false"
+	// string, so decode it the same way
+	var incremental interface{} = ""
+	tr := config.NewTransaction(st)
+	err := tr.Get("core", "snapshots.incremental", &incremental)
+	if err != nil && !config.IsNoOption(err) {
+		return false, err
+	}
+	return fmt.Sprint(incremental) == "true", nil
+}
+
+// ErrNoRemoteRepository is returned when pushing or pulling snapshot sets
+// without a remote snapshot repository configured.
+var ErrNoRemoteRepository = errors.New("no remote snapshot repository configured, set snapshots.remote.url")
+
+// remoteRepositoryConfig returns the configuration of the remote snapshot
+// repository, as set by the snapshots.remote.* core options.
+func remoteRepositoryConfig(st *state.State) (*remote.Config, error) {
+	var cfg remote.Config
+	tr := config.NewTransaction(st)
+	for option, value := range map[string]*string{
+		"snapshots.remote.url":         &cfg.URL,
+		"snapshots.remote.credentials": &cfg.Credentials,
+		"snapshots.remote.known-hosts": &cfg.KnownHosts,
+	} {
+		if err := tr.Get("core", option, value); err != nil && !config.IsNoOption(err) {
+			return nil, err
+		}
+	}
+	if cfg.URL == "" {
+		return nil, ErrNoRemoteRepository
+	}
+	return &cfg, nil
+}
+
 // saveExpiration saves expiration date of the given snapshot set, in the state.
 // The state needs to be locked by the caller.
 func saveExpiration(st *state.State, setID uint64, expiryTime time.Time) error {
+	return setSnapshotState(st, setID, &snapshotState{
+		ExpiryTime: expiryTime,
+	})
+}
+
+// saveScheduled records that the given snapshot set was taken as scheduled
+// at the given time, in the state.
+// The state needs to be locked by the caller.
+func saveScheduled(st *state.State, setID uint64, t time.Time) error {
+	return setSnapshotState(st, setID, &snapshotState{
+		Scheduled: &t,
+	})
+}
+
+func setSnapshotState(st *state.State, setID uint64, snapshot *snapshotState) error {
 	var snapshots map[uint64]*json.RawMessage
 	err := st.Get("snapshots", &snapshots)
 	if err != nil && !errors.Is(err, state.ErrNoState) {
@@ -162,9 +236,7 @@ func saveExpiration(st *state.State, setID uint64, expiryTime time.Time) error {
 	if snapshots == nil {
 		snapshots = make(map[uint64]*json.RawMessage)
 	}
-	data, err := json.Marshal(&snapshotState{
-		ExpiryTime: expiryTime,
-	})
+	data, err := json.Marshal(snapshot)
 	if err != nil {
 		return err
 	}
@@ -207,7 +279,8 @@ func expiredSnapshotSets(st *state.State, cutoffTime time.Time) (map[uint64]bool
 
 	expired := make(map[uint64]bool)
 	for setID, snapshotSet := range snapshots {
-		if snapshotSet.ExpiryTime.Before(cutoffTime) {
+		// scheduled sets don't expire
+		if !snapshotSet.ExpiryTime.IsZero() && snapshotSet.ExpiryTime.Before(cutoffTime) {
 			expired[setID] = true
 		}
 	}
@@ -215,6 +288,92 @@ func expiredSnapshotSets(st *state.State, cutoffTime time.Time) (map[uint64]bool
 	return expired, nil
 }
 
+// ScheduledSnapshotRetention returns how many daily and weekly scheduled
+// snapshot sets are kept, as set by the snapshots.retention.* core options.
+func ScheduledSnapshotRetention(st *state.State) (daily, weekly int, err error) {
+	daily = defaultScheduledSnapshotRetentionDaily
+	weekly = defaultScheduledSnapshotRetentionWeekly
+	tr := config.NewTransaction(st)
+	for option, value := range map[string]*int{
+		"snapshots.retention.daily":  &daily,
+		"snapshots.retention.weekly": &weekly,
+	} {
+		// the options can be set as JSON numbers
+		var v interface{} = ""
+		if err := tr.Get("core", option, &v); err != nil && !config.IsNoOption(err) {
+			return 0, 0, err
+		}
+		str := fmt.Sprint(v)
+		if str == "" {
+			continue
+		}
+		n, err := strconv.Atoi(str)
+		if err != nil {
+			// the value was validated when set
+			return 0, 0, fmt.Errorf("cannot parse %s: %v", option, err)
+		}
+		*value = n
+	}
+	return daily, weekly, nil
+}
+
+// unretainedSnapshotSets returns the scheduled snapshot sets from the state
+// that are not kept by the retention policy: of the sets taken in the last
+// daily days, and the last weekly weeks, that had any, only the newest set of
+// each day or week is kept. Days and weeks are in the local time zone.
+// The state needs to be locked by the caller.
+func unretainedSnapshotSets(st *state.State, daily, weekly int) (map[uint64]bool, error) {
+	var snapshots map[uint64]*snapshotState
+	err := st.Get("snapshots", &snapshots)
+	if err != nil {
+		if !errors.Is(err, state.ErrNoState) {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	type scheduledSet struct {
+		id   uint64
+		time time.Time
+	}
+	var sets []scheduledSet
+	for setID, snapshotSet := range snapshots {
+		if snapshotSet.Scheduled != nil {
+			sets = append(sets, scheduledSet{setID, snapshotSet.Scheduled.Local()})
+		}
+	}
+	// newest first
+	sort.Slice(sets, func(i, j int) bool {
+		if sets[i].time.Equal(sets[j].time) {
+			return sets[i].id > sets[j].id
+		}
+		return sets[i].time.After(sets[j].time)
+	})
+
+	days := make(map[string]bool)
+	weeks := make(map[string]bool)
+	unretained := make(map[uint64]bool)
+	for _, set := range sets {
+		keep := false
+		day := set.time.Format("2006-01-02")
+		if !days[day] && len(days) < daily {
+			days[day] = true
+			keep = true
+		}
+		year, week := set.time.ISOWeek()
+		weekKey := fmt.Sprintf("%d-%d", year, week)
+		if !weeks[weekKey] && len(weeks) < weekly {
+			weeks[weekKey] = true
+			keep = true
+		}
+		if !keep {
+			unretained[set.id] = true
+		}
+	}
+
+	return unretained, nil
+}
+
 // snapshotSnapSummaries are used internally to get useful data from a
 // snapshot set when deciding whether to check/forget/restore it.
 type snapshotSnapSummaries []*snapshotSnapSummary
@@ -228,10 +387,28 @@ func (summaries snapshotSnapSummaries) snapNames() []string {
 }
 
 type snapshotSnapSummary struct {
-	snap     string
-	snapID   string
-	filename string
-	epoch    snap.Epoch
+	snap       string
+	snapID     string
+	filename   string
+	epoch      snap.Epoch
+	encryption *client.SnapshotEncryption
+}
+
+// checkKeySource verifies that the key is of the kind needed to decrypt the
+// encrypted snapshots in the summaries, and returns whether there are any.
+// Whether it is the right key is only verified by the tasks, as this is slow
+// and done without holding the state lock.
+func (summaries snapshotSnapSummaries) checkKeySource(key *client.SnapshotKey) (encrypted bool, err error) {
+	for _, summary := range summaries {
+		if summary.encryption == nil {
+			continue
+		}
+		if err := backendCheckKeySource(&client.Snapshot{Encryption: summary.encryption}, key); err != nil {
+			return false, err
+		}
+		encrypted = true
+	}
+	return encrypted, nil
 }
 
 // snapSummariesInSnapshotSet goes looking for the requested snaps in the
@@ -244,10 +421,11 @@ func snapSummariesInSnapshotSet(setID uint64, requested []string) (summaries sna
 			found = true
 			if len(requested) == 0 || strutil.SortedListContains(requested, r.Snap) {
 				summaries = append(summaries, &snapshotSnapSummary{
-					filename: r.Name(),
-					snap:     r.Snap,
-					snapID:   r.SnapID,
-					epoch:    r.Epoch,
+					filename:   r.Name(),
+					snap:       r.Snap,
+					snapID:     r.SnapID,
+					epoch:      r.Epoch,
+					encryption: r.Encryption,
 				})
 			}
 		}
@@ -320,12 +498,10 @@ func List(ctx context.Context, st *state.State, setID uint64, snapNames []string
 		return nil, err
 	}
 
-	// decorate all snapshots with "auto" flag if we have expiry time set for them.
+	// decorate all snapshots with "auto" flag if we have expiry time set for them,
+	// or if they were scheduled.
 	for _, sset := range sets {
-		// at the moment we only keep records with expiry time so checking non-zero
-		// expiry-time is not strictly necessary, but it makes it future-proof in case
-		// we add more attributes to these entries.
-		if snapshotState, ok := snapshots[sset.ID]; ok && !snapshotState.ExpiryTime.IsZero() {
+		if snapshotState, ok := snapshots[sset.ID]; ok && (!snapshotState.ExpiryTime.IsZero() || snapshotState.Scheduled != nil) {
 			for _, snapshot := range sset.Snapshots {
 				snapshot.Auto = true
 			}
@@ -335,8 +511,55 @@ func List(ctx context.Context, st *state.State, setID uint64, snapNames []string
 	return sets, nil
 }
 
-// Import a given snapshot ID from an exported snapshot
-func Import(ctx context.Context, st *state.State, r io.Reader) (setID uint64, snapNames []string, err error) {
+// snapshotKeysKey is the state cache key of the keys of encrypted snapshot
+// sets, by the ID of the task that needs them.
+type snapshotKeysKey struct{}
+
+// cacheSnapshotKey keeps the key for the given task in memory; keys are never
+// written to the state, so if snapd is restarted before the task runs the
+// task fails. The state must be locked by the caller.
+func cacheSnapshotKey(st *state.State, task *state.Task, key *client.SnapshotKey) {
+	keys, _ := st.Cached(snapshotKeysKey{}).(map[string]*client.SnapshotKey)
+	if keys == nil {
+		keys = make(map[string]*client.SnapshotKey)
+	}
+	keys[task.ID()] = key
+	st.Cache(snapshotKeysKey{}, keys)
+}
+
+// cachedSnapshotKey returns the key for the given task. The state must be
+// locked by the caller.
+func cachedSnapshotKey(task *state.Task, setID uint64) (*client.SnapshotKey, error) {
+	key := cachedKey(task)
+	if key == nil {
+		return nil, fmt.Errorf("key of encrypted snapshot set #%d is no longer available", setID)
+	}
+	return key, nil
+}
+
+func cachedKey(task *state.Task) *client.SnapshotKey {
+	keys, _ := task.State().Cached(snapshotKeysKey{}).(map[string]*client.SnapshotKey)
+	return keys[task.ID()]
+}
+
+// forgetSnapshotKeys drops the keys of the tasks of the given change from
+// memory once it is ready. The state must be locked by the caller.
+func forgetSnapshotKeys(chg *state.Change, old, new state.Status) {
+	if !new.Ready() {
+		return
+	}
+	keys, _ := chg.State().Cached(snapshotKeysKey{}).(map[string]*client.SnapshotKey)
+	if len(keys) == 0 {
+		return
+	}
+	for _, t := range chg.Tasks() {
+		delete(keys, t.ID())
+	}
+}
+
+// Import a given snapshot ID from an exported snapshot. The key is needed to
+// import encrypted snapshot sets.
+func Import(ctx context.Context, st *state.State, r io.Reader, key *client.SnapshotKey) (setID uint64, snapNames []string, err error) {
 	st.Lock()
 	setID, err = newSnapshotSetID(st)
 	// note, this is a new set id which is not exposed yet, no need to mark it
@@ -347,7 +570,11 @@ func Import(ctx context.Context, st *state.State, r io.Reader) (setID uint64, sn
 		return 0, nil, err
 	}
 
-	snapNames, err = backendImport(ctx, setID, r, nil)
+	var flags *backend.ImportFlags
+	if key != nil {
+		flags = &backend.ImportFlags{Key: key}
+	}
+	snapNames, err = backendImport(ctx, setID, r, flags)
 	if err != nil {
 		if dupErr, ok := err.(backend.DuplicatedSnapshotImportError); ok {
 			st.Lock()
@@ -356,7 +583,7 @@ func Import(ctx context.Context, st *state.State, r io.Reader) (setID uint64, sn
 			if err := checkSnapshotConflict(st, dupErr.SetID, "forget-snapshot"); err != nil {
 				// we found an existing snapshot but it's being forgotten, so
 				// retry the import without checking for existing snapshot.
-				flags := &backend.ImportFlags{NoDuplicatedImportCheck: true}
+				flags := &backend.ImportFlags{NoDuplicatedImportCheck: true, Key: key}
 				st.Unlock()
 				snapNames, err = backendImport(ctx, setID, r, flags)
 				st.Lock()
@@ -364,10 +591,11 @@ func Import(ctx context.Context, st *state.State, r io.Reader) (setID uint64, sn
 			}
 
 			// trying to import identical snapshot; instead return set ID of
-			// the existing one and reset its expiry time.
-			// XXX: at the moment expiry-time is the only attribute so we can
-			// just remove the record. If we ever add more attributes this needs
-			// to reset expiry-time only.
+			// the existing one and reset its expiry time. Removing the
+			// record also takes a scheduled set out of the retention
+			// policy, which is what is wanted for a set imported by hand.
+			// XXX: if we ever add more attributes this needs to reset
+			// expiry-time and scheduled only.
 			if err := removeSnapshotState(st, dupErr.SetID); err != nil {
 				return 0, nil, err
 			}
@@ -378,9 +606,15 @@ func Import(ctx context.Context, st *state.State, r io.Reader) (setID uint64, sn
 	return setID, snapNames, nil
 }
 
-// Save creates a taskset for taking snapshots of snaps' data.
+// Save creates a taskset for taking snapshots of snaps' data. If key is not
+// nil the snapshot set is encrypted with it.
 // Note that the state must be locked by the caller.
-func Save(st *state.State, instanceNames []string, users []string, options map[string]*snap.SnapshotOptions) (setID uint64, snapsSaved []string, ts *state.TaskSet, err error) {
+func Save(st *state.State, instanceNames []string, users []string, options map[string]*snap.SnapshotOptions, key *client.SnapshotKey) (setID uint64, snapsSaved []string, ts *state.TaskSet, err error) {
+	if key != nil {
+		if err := key.Validate(); err != nil {
+			return 0, nil, nil, err
+		}
+	}
 	if len(instanceNames) == 0 {
 		instanceNames, err = allActiveSnapNames(st)
 		if err != nil {
@@ -413,33 +647,58 @@ func Save(st *state.State, instanceNames []string, users []string, options map[s
 
 	for _, name := range instanceNames {
 		desc := fmt.Sprintf("Save data of snap %q in snapshot set #%d", name, setID)
-		task := st.NewTask("save-snapshot", desc)
-
 		snapshot := snapshotSetup{
-			SetID:   setID,
-			Snap:    name,
-			Users:   users,
-			Options: options[name],
+			SetID:     setID,
+			Snap:      name,
+			Users:     users,
+			Options:   options[name],
+			Encrypted: key != nil,
 		}
 
-		task.Set("snapshot-setup", &snapshot)
-		// Here, note that a snapshot set behaves as a unit: it either
-		// succeeds, or fails, as a whole; we don't use lanes, to have
-		// some snaps' snapshot succeed and not others in a single set.
-		// In practice: either the snapshot will be automatic and only
-		// for one snap (already in a lane via refresh), or it will be
-		// done by hand and the user can remove failing snaps (or find
-		// the cause of the failure). A snapshot failure can happen if
-		// a user has dropped files they can't read in their directory,
-		// for example.
-		// Also note we aren't promising this behaviour; we can change
-		// it if we find it to be wrong.
-		ts.AddTask(task)
+		task, tasks := newSaveTasks(st, desc, &snapshot)
+		if key != nil {
+			cacheSnapshotKey(st, task, key)
+		}
+		// The tasks of each snap are in their own lane, so that a
+		// failure, e.g. of a pre-snapshot hook or because a user has
+		// dropped files they can't read in their directory, only
+		// aborts the snapshot of that snap; the set then holds the
+		// snapshots of the other snaps.
+		tasks.JoinLane(st.NewLane())
+		ts.AddAll(tasks)
 	}
 
 	return setID, instanceNames, ts, nil
 }
 
+// newSaveTasks returns the save-snapshot task for the given snapshot, and the
+// tasks to run for it: the save-snapshot task, surrounded by the tasks
+// running the pre-snapshot and post-snapshot hooks if the snap has them, so
+// that it can bring its data into a consistent state before it is saved.
+// Note that the state must be locked by the caller.
+func newSaveTasks(st *state.State, desc string, snapshot *snapshotSetup) (*state.Task, *state.TaskSet) {
+	task := st.NewTask("save-snapshot", desc)
+	task.Set("snapshot-setup", snapshot)
+
+	// if the snap info cannot be read, the save-snapshot task reports it
+	info, err := snapstateCurrentInfo(st, snapshot.Snap)
+	if err != nil || (info.Hooks["pre-snapshot"] == nil && info.Hooks["post-snapshot"] == nil) {
+		return task, state.NewTaskSet(task)
+	}
+
+	ts := state.NewTaskSet()
+	// a failing pre-snapshot hook aborts the snapshot of the snap before
+	// any of its data is saved
+	preHook := hookstateSetupPreSnapshotHook(st, snapshot.Snap)
+	ts.AddTask(preHook)
+	task.WaitFor(preHook)
+	ts.AddTask(task)
+	postHook := hookstateSetupPostSnapshotHook(st, snapshot.Snap)
+	postHook.WaitFor(task)
+	ts.AddTask(postHook)
+	return task, ts
+}
+
 func AutomaticSnapshot(st *state.State, snapName string) (ts *state.TaskSet, err error) {
 	expiration, err := AutomaticSnapshotExpiration(st)
 	if err != nil {
@@ -453,6 +712,8 @@ func AutomaticSnapshot(st *state.State, snapName string) (ts *state.TaskSet, err
 		return nil, err
 	}
 
+	// no pre/post-snapshot hooks here, automatic snapshots are taken
+	// after the apps of the snap have been stopped
 	ts = state.NewTaskSet()
 	desc := fmt.Sprintf("Save data of snap %q in automatic snapshot set #%d", snapName, setID)
 	task := st.NewTask("save-snapshot", desc)
@@ -467,13 +728,18 @@ func AutomaticSnapshot(st *state.State, snapName string) (ts *state.TaskSet, err
 	return ts, nil
 }
 
-// Restore creates a taskset for restoring a snapshot's data.
+// Restore creates a taskset for restoring a snapshot's data. The key is
+// needed to restore encrypted snapshot sets.
 // Note that the state must be locked by the caller.
-func Restore(st *state.State, setID uint64, snapNames []string, users []string) (snapsFound []string, ts *state.TaskSet, err error) {
+func Restore(st *state.State, setID uint64, snapNames []string, users []string, key *client.SnapshotKey) (snapsFound []string, ts *state.TaskSet, err error) {
 	summaries, err := snapSummariesInSnapshotSet(setID, snapNames)
 	if err != nil {
 		return nil, nil, err
 	}
+	encrypted, err := summaries.checkKeySource(key)
+	if err != nil {
+		return nil, nil, err
+	}
 	all, err := snapstateAll(st)
 	if err != nil {
 		return nil, nil, err
@@ -514,13 +780,17 @@ func Restore(st *state.State, setID uint64, snapNames []string, users []string)
 		desc := fmt.Sprintf("Restore data of snap %q from snapshot set #%d", summary.snap, setID)
 		task := st.NewTask("restore-snapshot", desc)
 		snapshot := snapshotSetup{
-			SetID:    setID,
-			Snap:     summary.snap,
-			Users:    users,
-			Filename: summary.filename,
-			Current:  current,
+			SetID:     setID,
+			Snap:      summary.snap,
+			Users:     users,
+			Filename:  summary.filename,
+			Current:   current,
+			Encrypted: encrypted,
 		}
 		task.Set("snapshot-setup", &snapshot)
+		if encrypted {
+			cacheSnapshotKey(st, task, key)
+		}
 		// see the note about snapshots not using lanes, above.
 		ts.AddTask(task)
 	}
@@ -538,9 +808,10 @@ func Restore(st *state.State, setID uint64, snapNames []string, users []string)
 	return snapsFound, ts, nil
 }
 
-// Check creates a taskset for checking a snapshot's data.
+// Check creates a taskset for checking a snapshot's data. The key is needed
+// to check encrypted snapshot sets.
 // Note that the state must be locked by the caller.
-func Check(st *state.State, setID uint64, snapNames []string, users []string) (snapsFound []string, ts *state.TaskSet, err error) {
+func Check(st *state.State, setID uint64, snapNames []string, users []string, key *client.SnapshotKey) (snapsFound []string, ts *state.TaskSet, err error) {
 	// check needs to conflict with forget of itself
 	if err := checkSnapshotConflict(st, setID, "forget-snapshot"); err != nil {
 		return nil, nil, err
@@ -550,6 +821,10 @@ func Check(st *state.State, setID uint64, snapNames []string, users []string) (s
 	if err != nil {
 		return nil, nil, err
 	}
+	encrypted, err := summaries.checkKeySource(key)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	ts = state.NewTaskSet()
 
@@ -557,12 +832,16 @@ func Check(st *state.State, setID uint64, snapNames []string, users []string) (s
 		desc := fmt.Sprintf("Check data of snap %q in snapshot set #%d", summary.snap, setID)
 		task := st.NewTask("check-snapshot", desc)
 		snapshot := snapshotSetup{
-			SetID:    setID,
-			Snap:     summary.snap,
-			Users:    users,
-			Filename: summary.filename,
+			SetID:     setID,
+			Snap:      summary.snap,
+			Users:     users,
+			Filename:  summary.filename,
+			Encrypted: encrypted,
 		}
 		task.Set("snapshot-setup", &snapshot)
+		if encrypted {
+			cacheSnapshotKey(st, task, key)
+		}
 		ts.AddTask(task)
 	}
 
@@ -572,9 +851,9 @@ func Check(st *state.State, setID uint64, snapNames []string, users []string) (s
 // Forget creates a taskset for deletinig a snapshot.
 // Note that the state must be locked by the caller.
 func Forget(st *state.State, setID uint64, snapNames []string) (snapsFound []string, ts *state.TaskSet, err error) {
-	// forget needs to conflict with check, restore, import and export.
+	// forget needs to conflict with check, restore, import, export and push.
 	if err := checkSnapshotConflict(st, setID, "export-snapshot",
-		"check-snapshot", "restore-snapshot"); err != nil {
+		"check-snapshot", "restore-snapshot", "push-snapshot"); err != nil {
 		return nil, nil, err
 	}
 
@@ -628,9 +907,11 @@ func UnsetSnapshotOpInProgress(st *state.State, setID uint64) string {
 	return op
 }
 
-// Export exports a given snapshot ID
-// Note that the state must be locked by the caller.
-func Export(ctx context.Context, st *state.State, setID uint64) (se *backend.SnapshotExport, err error) {
+// Export exports a given snapshot ID. The key is needed to export encrypted
+// snapshot sets, which are exported still encrypted.
+// Note that the state must be locked by the caller; it is released while
+// the key is checked.
+func Export(ctx context.Context, st *state.State, setID uint64, key *client.SnapshotKey) (se *backend.SnapshotExport, err error) {
 	if err := checkSnapshotConflict(st, setID, "forget-snapshot"); err != nil {
 		return nil, err
 	}
@@ -639,9 +920,183 @@ func Export(ctx context.Context, st *state.State, setID uint64) (se *backend.Sna
 	se, err = backendNewSnapshotExport(ctx, setID)
 	if err != nil {
 		UnsetSnapshotOpInProgress(st, setID)
+		return nil, err
+	}
+	// checking the key can be slow so drop the lock, the set is marked
+	// as being exported meanwhile
+	st.Unlock()
+	err = backendExportCheckKey(se, key)
+	st.Lock()
+	if err != nil {
+		se.Close()
+		UnsetSnapshotOpInProgress(st, setID)
+		return nil, err
+	}
+	return se, nil
+}
+
+// Snapshot sets are stored in remote snapshot repositories as the stream
+// produced by Export, named after the content hash of the set so that a set
+// is only ever pushed once and can be told apart from the sets already on a
+// device when it is pulled. A JSON object with the metadata of the set is
+// stored next to it, once the set was pushed completely.
+
+func remoteSnapshotName(id string) string { return id + ".snapshot" }
+func remoteMetadataName(id string) string { return id + ".json" }
+
+var validRemoteID = regexp.MustCompile("^[0-9a-f]{1,64}$").MatchString
+
+// Push creates a taskset for uploading a snapshot set to the remote snapshot
+// repository. Encrypted sets are uploaded as they are, so no key is needed.
+// Note that the state must be locked by the caller.
+func Push(st *state.State, setID uint64) (snapsFound []string, ts *state.TaskSet, err error) {
+	if _, err := remoteRepositoryConfig(st); err != nil {
+		return nil, nil, err
+	}
+	if err := checkSnapshotConflict(st, setID, "forget-snapshot"); err != nil {
+		return nil, nil, err
+	}
+
+	summaries, err := snapSummariesInSnapshotSet(setID, nil)
+	if err != nil {
+		return nil, nil, err
 	}
-	return se, err
+
+	return summaries.snapNames(), state.NewTaskSet(newPushTask(st, setID)), nil
+}
+
+func newPushTask(st *state.State, setID uint64) *state.Task {
+	desc := fmt.Sprintf("Push snapshot set #%d to the remote snapshot repository", setID)
+	task := st.NewTask("push-snapshot", desc)
+	task.Set("snapshot-setup", &snapshotSetup{SetID: setID})
+	return task
+}
+
+type snapshotPull struct {
+	RemoteID  string `json:"remote-id"`
+	Encrypted bool   `json:"encrypted,omitempty"`
+}
+
+// Pull creates a taskset for downloading a snapshot set from the remote
+// snapshot repository and importing it as a new snapshot set, unless the same
+// set is already on the device. The remote ID can be abbreviated as long as
+// it is unambiguous. The key is needed to pull encrypted sets.
+// Note that the state must be locked by the caller.
+func Pull(st *state.State, remoteID string, key *client.SnapshotKey) (*state.TaskSet, error) {
+	if key != nil {
+		if err := key.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if !validRemoteID(remoteID) {
+		return nil, fmt.Errorf("invalid remote snapshot set ID %q", remoteID)
+	}
+	if _, err := remoteRepositoryConfig(st); err != nil {
+		return nil, err
+	}
+
+	desc := fmt.Sprintf("Pull snapshot set %s from the remote snapshot repository", remoteID)
+	task := st.NewTask("pull-snapshot", desc)
+	task.Set("snapshot-pull", &snapshotPull{RemoteID: remoteID, Encrypted: key != nil})
+	if key != nil {
+		cacheSnapshotKey(st, task, key)
+	}
+	return state.NewTaskSet(task), nil
+}
+
+// ListRemote returns the snapshot sets in the remote snapshot repository,
+// oldest first.
+// Note that the state must not be locked by the caller, as accessing the
+// repository can take a while.
+func ListRemote(ctx context.Context, st *state.State) ([]client.RemoteSnapshotSet, error) {
+	st.Lock()
+	cfg, err := remoteRepositoryConfig(st)
+	st.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := remoteOpen(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer repo.Close()
+
+	return listRemote(ctx, repo)
+}
+
+func listRemote(ctx context.Context, repo remote.Repository) ([]client.RemoteSnapshotSet, error) {
+	names, err := repo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list remote snapshot sets: %v", err)
+	}
+	sort.Strings(names)
+
+	sets := []client.RemoteSnapshotSet{}
+	for _, name := range names {
+		id := strings.TrimSuffix(name, ".json")
+		if id == name || !validRemoteID(id) {
+			continue
+		}
+		if !strutil.SortedListContains(names, remoteSnapshotName(id)) {
+			continue
+		}
+		set, err := readRemoteMetadata(ctx, repo, id)
+		if err != nil {
+			// one broken set should not hide the others
+			logger.Noticef("cannot read metadata of remote snapshot set %s: %v", id, err)
+			continue
+		}
+		sets = append(sets, *set)
+	}
+	sort.SliceStable(sets, func(i, j int) bool {
+		return sets[i].Time.Before(sets[j].Time)
+	})
+	return sets, nil
+}
+
+func readRemoteMetadata(ctx context.Context, repo remote.Repository, id string) (*client.RemoteSnapshotSet, error) {
+	rc, err := repo.Get(ctx, remoteMetadataName(id))
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var set client.RemoteSnapshotSet
+	if err := json.NewDecoder(io.LimitReader(rc, 1024*1024)).Decode(&set); err != nil {
+		return nil, err
+	}
+	if set.ID != id {
+		return nil, fmt.Errorf("metadata is for remote snapshot set %s", set.ID)
+	}
+	return &set, nil
+}
+
+// remoteSnapshotSet returns the metadata of the given snapshot set for
+// pushing it to a remote snapshot repository.
+func remoteSnapshotSet(set *client.SnapshotSet, size int64) (*client.RemoteSnapshotSet, error) {
+	h, err := set.ContentHash()
+	if err != nil {
+		return nil, err
+	}
+	snapNames := make([]string, len(set.Snapshots))
+	for i, snapshot := range set.Snapshots {
+		snapNames[i] = snapshot.Snap
+	}
+	sort.Strings(snapNames)
+	return &client.RemoteSnapshotSet{
+		ID:        hex.EncodeToString(h),
+		SetID:     set.ID,
+		Time:      set.Time(),
+		Snaps:     snapNames,
+		Size:      size,
+		KeySource: set.KeySource(),
+	}, nil
 }
 
 // SnapshotExport provides a snapshot export that can be streamed out
 type SnapshotExport = backend.SnapshotExport
+
+// KeyRequiredError is returned when a snapshot set is encrypted and the key
+// needed to decrypt it was not given
+type KeyRequiredError = backend.KeyRequiredError
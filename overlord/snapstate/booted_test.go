@@ -519,6 +519,48 @@ func (bs *bootedSuite) TestFinishRestartKernelClassicWithModes(c *C) {
 	c.Check(err, ErrorMatches, `cannot finish kernel installation, there was a rollback across reboot`)
 }
 
+func (bs *bootedSuite) TestFinishRestartGadgetSlotRollback(c *C) {
+	st := bs.state
+	st.Lock()
+	defer st.Unlock()
+
+	task := st.NewTask("auto-connect", "...")
+
+	var switchErr error
+	checks := 0
+	r := snapstate.MockBootCheckGadgetSlotSwitch(func() error {
+		checks++
+		return switchErr
+	})
+	defer r()
+
+	// different gadget (may happen with remodel)
+	si := &snap.SideInfo{RealName: "other-gadget", Revision: snap.R(1)}
+	snaptest.MockSnap(c, "name: other-gadget\ntype: gadget\nversion: 1", si)
+	err := snapstate.FinishRestart(task, &snapstate.SnapSetup{SideInfo: si, Type: snap.TypeGadget}, snapstate.FinishRestartOptions{FinishRestartDefault: true})
+	c.Check(err, IsNil)
+	c.Check(checks, Equals, 0)
+
+	si = &snap.SideInfo{RealName: "brand-gadget", Revision: snap.R(2)}
+	snapsup := &snapstate.SnapSetup{SideInfo: si, Type: snap.TypeGadget}
+	snaptest.MockSnap(c, "name: brand-gadget\ntype: gadget\nversion: 2", si)
+
+	// restarted, the switch of slot was committed or there was none
+	err = snapstate.FinishRestart(task, snapsup, snapstate.FinishRestartOptions{FinishRestartDefault: true})
+	c.Check(err, IsNil)
+	c.Check(checks, Equals, 1)
+
+	// restarted, the boot with the tried slot is not marked successful yet
+	switchErr = boot.ErrBootNameAndRevisionNotReady
+	err = snapstate.FinishRestart(task, snapsup, snapstate.FinishRestartOptions{FinishRestartDefault: true})
+	c.Check(err, DeepEquals, &state.Retry{After: 5 * time.Second})
+
+	// restarted, the bootloader reverted to the previous slot, rollback!
+	switchErr = errors.New(`cannot boot with gadget assets from slot "b", reverted to slot "a"`)
+	err = snapstate.FinishRestart(task, snapsup, snapstate.FinishRestartOptions{FinishRestartDefault: true})
+	c.Check(err, ErrorMatches, `cannot finish brand-gadget installation, there was a rollback across reboot: cannot boot with gadget assets from slot "b", reverted to slot "a"`)
+}
+
 func (bs *bootedSuite) TestFinishRestartEphemeralModeSkipsRollbackDetection(c *C) {
 	r := snapstatetest.MockDeviceModel(DefaultModel())
 	defer r()
@@ -404,6 +404,10 @@ func MockGenerateSnapdWrappers(f func(snapInfo *snap.Info, opts *backend.Generat
 	}
 }
 
+func MockBootCheckGadgetSlotSwitch(f func() error) (restore func()) {
+	return testutil.Mock(&bootCheckGadgetSlotSwitch, f)
+}
+
 var (
 	NotifyLinkParticipants = notifyLinkParticipants
 )
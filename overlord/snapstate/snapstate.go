@@ -1016,6 +1016,8 @@ var HasActiveConnection = func(st *state.State, iface string) (bool, error) {
 
 var generateSnapdWrappers = backend.GenerateSnapdWrappers
 
+var bootCheckGadgetSlotSwitch = boot.CheckGadgetSlotSwitch
+
 // isInvokedWithRevert returns true if the current process was invoked in the
 // context of runtime failure handling, most likely by snap-failure.
 func isInvokedWithRevert() bool {
@@ -1124,6 +1126,21 @@ func FinishRestart(task *state.Task, snapsup *SnapSetup, opts FinishRestartOptio
 		model := deviceCtx.Model()
 		var bootName string
 		switch snapsup.Type {
+		case snap.TypeGadget:
+			if snapsup.InstanceName() != model.Gadget() {
+				return nil
+			}
+			// the bootloader may revert to the previous slot of
+			// A/B paired gadget structures on a failed boot with
+			// the updated slot
+			err := bootCheckGadgetSlotSwitch()
+			if err == boot.ErrBootNameAndRevisionNotReady {
+				return &state.Retry{After: 5 * time.Second}
+			}
+			if err != nil {
+				return fmt.Errorf("cannot finish %s installation, there was a rollback across reboot: %v", snapsup.InstanceName(), err)
+			}
+			return nil
 		case snap.TypeKernel:
 			bootName = model.Kernel()
 		case snap.TypeOS, snap.TypeBase:
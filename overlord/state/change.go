@@ -267,7 +267,7 @@ func (c *Change) Summary() string {
 // Set associates value with key for future consulting by managers.
 // The provided value must properly marshal and unmarshal with encoding/json.
 func (c *Change) Set(key string, value interface{}) {
-	c.state.writing()
+	c.state.writingChange(c)
 	c.data.set(key, value)
 }
 
@@ -460,7 +460,7 @@ func (c *Change) notifyStatusChange(new Status) {
 
 // SetStatus sets the change status, overriding the default behavior (see Status method).
 func (c *Change) SetStatus(s Status) {
-	c.state.writing()
+	c.state.writingChange(c)
 	c.status = s
 	if s.Ready() {
 		c.markReady()
@@ -504,6 +504,8 @@ func (c *Change) detectChangeReady(excludeTask *Task) {
 // to give the opportunity for the change to close its ready channel, and
 // notify observers of Change changes.
 func (c *Change) taskStatusChanged(t *Task, old, new Status) {
+	// the change can become ready, or record a notice of its new status
+	c.state.writingChange(c)
 	cs := c.Status()
 	// If the task changes from ready => unready or unready => ready,
 	// update the ready status for the change.
@@ -550,6 +552,7 @@ func (c *Change) taskCleanChanged() {
 			return
 		}
 	}
+	c.state.writingChange(c)
 	c.clean = true
 }
 
@@ -625,10 +628,11 @@ func (c *Change) State() *State {
 // AddTask registers a task as required for the state change to
 // be accomplished.
 func (c *Change) AddTask(t *Task) {
-	c.state.writing()
+	c.state.writingChange(c)
 	if t.change != "" {
 		panic(fmt.Sprintf("internal error: cannot add one %q task to multiple changes", t.Kind()))
 	}
+	c.state.writingTask(t)
 	t.change = c.id
 	c.taskIDs = addOnce(c.taskIDs, t.ID())
 }
@@ -636,7 +640,7 @@ func (c *Change) AddTask(t *Task) {
 // AddAll registers all tasks in the set as required for the state
 // change to be accomplished.
 func (c *Change) AddAll(ts *TaskSet) {
-	c.state.writing()
+	c.state.writingChange(c)
 	for _, t := range ts.tasks {
 		c.AddTask(t)
 	}
@@ -675,7 +679,7 @@ func (c *Change) LaneTasks(lanes ...int) []*Task {
 // Abort flags the change for cancellation, whether in progress or not.
 // Cancellation will proceed at the next ensure pass.
 func (c *Change) Abort() {
-	c.state.writing()
+	c.state.writingChange(c)
 	tasks := make([]*Task, len(c.taskIDs))
 	for i, tid := range c.taskIDs {
 		tasks[i] = c.state.tasks[tid]
@@ -687,14 +691,14 @@ func (c *Change) Abort() {
 // except for tasks that are also in a healthy lane (not aborted, and not waiting
 // on aborted).
 func (c *Change) AbortLanes(lanes []int) {
-	c.state.writing()
+	c.state.writingChange(c)
 	c.abortLanes(lanes, make(map[int]bool), make(map[string]bool))
 }
 
 // AbortUnreadyLanes aborts the tasks from lanes that aren't fully ready, where
 // a ready lane is one in which all tasks are ready.
 func (c *Change) AbortUnreadyLanes() {
-	c.state.writing()
+	c.state.writingChange(c)
 	c.abortUnreadyLanes()
 }
 
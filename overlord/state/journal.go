@@ -0,0 +1,232 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/snapcore/snapd/logger"
+)
+
+// JournalEntry is an independently persisted piece of the serialized state.
+type JournalEntry struct {
+	// Key is the name of a top-level field of the serialized state or, for
+	// the elements of the data, changes, tasks and notices fields, the name
+	// of the field and the key or ID of the element separated by a slash,
+	// e.g. "tasks/42".
+	Key string `json:"key"`
+	// Value is the serialized entry, it is empty if the entry was removed.
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// JournalBackend is a Backend that can persist the state incrementally,
+// by journaling only the entries that changed since the previous
+// checkpoint.
+type JournalBackend interface {
+	Backend
+	// Journal persists the given entries, which changed since the previous
+	// call to Journal or Checkpoint.
+	Journal(entries []JournalEntry) error
+	// NeedsCheckpoint returns whether the full state should be
+	// checkpointed instead of journaling the changes to it, for example
+	// to compact the journal.
+	NeedsCheckpoint() bool
+}
+
+// the fields of the serialized state that are split into entries, with
+// whether they are serialized as a list rather than a map
+var splitStateFields = map[string]bool{
+	"data":    false,
+	"changes": false,
+	"tasks":   false,
+	"notices": true,
+}
+
+// journalEntries returns the entries the serialized state consists of.
+//
+// The changes and tasks which were not modified since the last checkpoint
+// are not serialized again, their entries are reused from it.
+func (s *State) journalEntries() map[string]json.RawMessage {
+	entries := make(map[string]json.RawMessage, len(s.data)+len(s.changes)+len(s.tasks)+len(s.notices)+6)
+	mustMarshal := func(key string, v interface{}) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			// this shouldn't happen, because the actual delicate serializing happens at various Set()s
+			logger.Panicf("internal error: could not marshal state entry %q for checkpointing: %v", key, err)
+		}
+		entries[key] = data
+	}
+	for k, v := range s.data {
+		if v != nil {
+			entries["data/"+k] = *v
+		}
+	}
+	for id, chg := range s.changes {
+		key := "changes/" + id
+		if data, ok := s.journaled[key]; ok && !s.dirtyChanges[id] {
+			entries[key] = data
+			continue
+		}
+		mustMarshal(key, chg)
+	}
+	for id, t := range s.tasks {
+		key := "tasks/" + id
+		if data, ok := s.journaled[key]; ok && !s.dirtyTasks[id] {
+			entries[key] = data
+			continue
+		}
+		mustMarshal(key, t)
+	}
+	if warnings := s.flattenWarnings(); len(warnings) > 0 {
+		mustMarshal("warnings", warnings)
+	}
+	for _, n := range s.flattenNotices(nil) {
+		mustMarshal("notices/"+n.id, n)
+	}
+	mustMarshal("last-change-id", s.lastChangeId)
+	mustMarshal("last-task-id", s.lastTaskId)
+	mustMarshal("last-lane-id", s.lastLaneId)
+	mustMarshal("last-notice-id", s.lastNoticeId)
+	mustMarshal("last-notice-timestamp", s.lastNoticeTimestamp)
+	return entries
+}
+
+// journalDelta returns the entries that differ between old and new, sorted
+// by key.
+func journalDelta(old, new map[string]json.RawMessage) []JournalEntry {
+	var delta []JournalEntry
+	for k, v := range new {
+		if oldV, ok := old[k]; !ok || !bytes.Equal(oldV, v) {
+			delta = append(delta, JournalEntry{Key: k, Value: v})
+		}
+	}
+	for k := range old {
+		if _, ok := new[k]; !ok {
+			delta = append(delta, JournalEntry{Key: k})
+		}
+	}
+	sort.Slice(delta, func(i, j int) bool { return delta[i].Key < delta[j].Key })
+	return delta
+}
+
+// assembleJournalEntries returns the serialized state consisting of the
+// given entries.
+func assembleJournalEntries(entries map[string]json.RawMessage) []byte {
+	fields := map[string]interface{}{
+		"data":    map[string]json.RawMessage{},
+		"changes": map[string]json.RawMessage{},
+		"tasks":   map[string]json.RawMessage{},
+	}
+	var listKeys map[string][]string
+	for k, v := range entries {
+		field, key, split := strings.Cut(k, "/")
+		isList, ok := splitStateFields[field]
+		switch {
+		case !split || !ok:
+			fields[k] = v
+		case isList:
+			if listKeys == nil {
+				listKeys = make(map[string][]string)
+			}
+			listKeys[field] = append(listKeys[field], key)
+		default:
+			m, _ := fields[field].(map[string]json.RawMessage)
+			if m == nil {
+				m = make(map[string]json.RawMessage)
+				fields[field] = m
+			}
+			m[key] = v
+		}
+	}
+	for field, keys := range listKeys {
+		sort.Strings(keys)
+		list := make([]json.RawMessage, 0, len(keys))
+		for _, key := range keys {
+			list = append(list, entries[field+"/"+key])
+		}
+		fields[field] = list
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		logger.Panicf("internal error: could not assemble state for checkpointing: %v", err)
+	}
+	return data
+}
+
+// splitJournalEntries splits the given serialized state into entries.
+func splitJournalEntries(data []byte) (map[string]json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	entries := make(map[string]json.RawMessage, len(fields))
+	for field, v := range fields {
+		isList, split := splitStateFields[field]
+		if !split {
+			entries[field] = v
+			continue
+		}
+		if isList {
+			var list []json.RawMessage
+			if err := json.Unmarshal(v, &list); err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", field, err)
+			}
+			for _, elem := range list {
+				var withID struct {
+					ID string `json:"id"`
+				}
+				if err := json.Unmarshal(elem, &withID); err != nil || withID.ID == "" {
+					return nil, fmt.Errorf("invalid %s: element without id", field)
+				}
+				entries[field+"/"+withID.ID] = elem
+			}
+			continue
+		}
+		var m map[string]json.RawMessage
+		if err := json.Unmarshal(v, &m); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", field, err)
+		}
+		for k, elem := range m {
+			entries[field+"/"+k] = elem
+		}
+	}
+	return entries, nil
+}
+
+// ApplyJournal returns the serialized state resulting from applying the
+// given journaled entries, in order, to the serialized state data.
+func ApplyJournal(data []byte, journal []JournalEntry) ([]byte, error) {
+	entries, err := splitJournalEntries(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot apply state journal: %v", err)
+	}
+	for _, e := range journal {
+		if len(e.Value) == 0 {
+			delete(entries, e.Key)
+		} else {
+			entries[e.Key] = e.Value
+		}
+	}
+	return assembleJournalEntries(entries), nil
+}
@@ -0,0 +1,287 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package state_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type journalSuite struct{}
+
+var _ = Suite(&journalSuite{})
+
+type fakeJournalBackend struct {
+	fakeStateBackend
+	journal         [][]state.JournalEntry
+	journalError    error
+	needsCheckpoint bool
+}
+
+func (b *fakeJournalBackend) Journal(entries []state.JournalEntry) error {
+	if err := b.journalError; err != nil {
+		// fail once, asking for the full state
+		b.journalError = nil
+		b.needsCheckpoint = true
+		return err
+	}
+	b.journal = append(b.journal, entries)
+	return nil
+}
+
+func (b *fakeJournalBackend) NeedsCheckpoint() bool {
+	return b.needsCheckpoint
+}
+
+func (b *fakeJournalBackend) replay(c *C) []byte {
+	c.Assert(b.checkpoints, Not(HasLen), 0)
+	var all []state.JournalEntry
+	for _, entries := range b.journal {
+		all = append(all, entries...)
+	}
+	data, err := state.ApplyJournal(b.checkpoints[len(b.checkpoints)-1], all)
+	c.Assert(err, IsNil)
+	return data
+}
+
+func journalKeys(entries []state.JournalEntry) []string {
+	keys := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if len(e.Value) == 0 {
+			keys = append(keys, "-"+e.Key)
+		} else {
+			keys = append(keys, e.Key)
+		}
+	}
+	return keys
+}
+
+func readState(c *C, data []byte) *state.State {
+	st, err := state.ReadState(nil, bytes.NewReader(data))
+	c.Assert(err, IsNil)
+	return st
+}
+
+// stateFields returns the serialized state fields, with the notices sorted
+// by ID.
+func stateFields(c *C, st *state.State) map[string]interface{} {
+	data, err := json.Marshal(st)
+	c.Assert(err, IsNil)
+	var fields map[string]interface{}
+	c.Assert(json.Unmarshal(data, &fields), IsNil)
+	notices, _ := fields["notices"].([]interface{})
+	sort.Slice(notices, func(i, j int) bool {
+		return notices[i].(map[string]interface{})["id"].(string) < notices[j].(map[string]interface{})["id"].(string)
+	})
+	return fields
+}
+
+func (s *journalSuite) TestJournalIncrementalChanges(c *C) {
+	b := new(fakeJournalBackend)
+	st := state.New(b)
+
+	st.Lock()
+	st.Set("foo", "bar")
+	st.Set("baz", 1)
+	chg := st.NewChange("install", "...")
+	t := st.NewTask("download", "...")
+	chg.AddTask(t)
+	st.Unlock()
+
+	// the first checkpoint is always complete
+	c.Assert(b.checkpoints, HasLen, 1)
+	c.Check(b.journal, HasLen, 0)
+
+	st.Lock()
+	st.Set("foo", "qux")
+	st.Set("baz", nil)
+	st.Unlock()
+
+	c.Assert(b.checkpoints, HasLen, 1)
+	c.Assert(b.journal, HasLen, 1)
+	c.Check(journalKeys(b.journal[0]), DeepEquals, []string{"-data/baz", "data/foo"})
+
+	st.Lock()
+	noticeID, err := st.AddNotice(nil, state.WarningNotice, "danger", nil)
+	st.Unlock()
+	c.Assert(err, IsNil)
+
+	c.Assert(b.journal, HasLen, 2)
+	c.Check(journalKeys(b.journal[1]), DeepEquals, []string{"last-notice-id", "last-notice-timestamp", "notices/" + noticeID})
+
+	st.Lock()
+	t.SetStatus(state.DoingStatus)
+	st.Unlock()
+
+	c.Assert(b.journal, HasLen, 3)
+	c.Check(journalKeys(b.journal[2]), testutil.Contains, "tasks/"+t.ID())
+
+	// nothing changed
+	st.Lock()
+	st.Set("foo", "qux")
+	st.Unlock()
+	c.Check(b.journal, HasLen, 3)
+
+	// the replayed journal has all the changes
+	st2 := readState(c, b.replay(c))
+	st2.Lock()
+	defer st2.Unlock()
+	var foo string
+	c.Check(st2.Get("foo", &foo), IsNil)
+	c.Check(foo, Equals, "qux")
+	c.Check(errors.Is(st2.Get("baz", nil), state.ErrNoState), Equals, true)
+	c.Check(st2.Task(t.ID()).Status(), Equals, state.DoingStatus)
+	c.Check(st2.Change(chg.ID()).Tasks(), HasLen, 1)
+	c.Check(st2.Notices(&state.NoticeFilter{Types: []state.NoticeType{state.WarningNotice}}), HasLen, 1)
+
+	st.Lock()
+	data, err := json.Marshal(st)
+	st.Unlock()
+	c.Assert(err, IsNil)
+	st3 := readState(c, data)
+	st3.Lock()
+	defer st3.Unlock()
+	c.Check(stateFields(c, st2), DeepEquals, stateFields(c, st3))
+}
+
+func (s *journalSuite) TestJournalOnlyModifiedChangesAndTasks(c *C) {
+	b := new(fakeJournalBackend)
+	st := state.New(b)
+
+	st.Lock()
+	chg1 := st.NewChange("install", "...")
+	t1 := st.NewTask("download", "...")
+	chg1.AddTask(t1)
+	chg2 := st.NewChange("remove", "...")
+	t2 := st.NewTask("unlink", "...")
+	t3 := st.NewTask("discard", "...")
+	chg2.AddTask(t2)
+	chg2.AddTask(t3)
+	st.Unlock()
+	c.Assert(b.checkpoints, HasLen, 1)
+
+	st.Lock()
+	t1.Logf("something")
+	st.Unlock()
+	c.Assert(b.journal, HasLen, 1)
+	c.Check(journalKeys(b.journal[0]), DeepEquals, []string{"tasks/" + t1.ID()})
+
+	st.Lock()
+	t3.WaitFor(t2)
+	chg1.Set("foo", "bar")
+	st.Unlock()
+	c.Assert(b.journal, HasLen, 2)
+	c.Check(journalKeys(b.journal[1]), DeepEquals, []string{"changes/" + chg1.ID(), "tasks/" + t2.ID(), "tasks/" + t3.ID()})
+
+	// the change becomes ready with its task, recording a notice
+	st.Lock()
+	t1.SetStatus(state.DoneStatus)
+	st.Unlock()
+	c.Assert(b.journal, HasLen, 3)
+	c.Check(journalKeys(b.journal[2]), DeepEquals, []string{"changes/" + chg1.ID(), "last-notice-timestamp", "notices/1", "tasks/" + t1.ID()})
+
+	st.Lock()
+	data, err := json.Marshal(st)
+	st.Unlock()
+	c.Assert(err, IsNil)
+	st2 := readState(c, b.replay(c))
+	st3 := readState(c, data)
+	st2.Lock()
+	st3.Lock()
+	c.Check(stateFields(c, st2), DeepEquals, stateFields(c, st3))
+	st3.Unlock()
+	st2.Unlock()
+
+	// the changes and tasks which were not modified are not serialized
+	// again
+	st.Lock()
+	state.MockChangeTimes(chg2, time.Now(), time.Time{})
+	state.MockTaskTimes(t2, time.Now(), time.Time{})
+	st.Set("foo", 1)
+	st.Unlock()
+	c.Assert(b.journal, HasLen, 4)
+	c.Check(journalKeys(b.journal[3]), DeepEquals, []string{"data/foo"})
+}
+
+func (s *journalSuite) TestJournalNeedsCheckpoint(c *C) {
+	b := new(fakeJournalBackend)
+	st := state.New(b)
+
+	st.Lock()
+	st.Set("foo", 1)
+	st.Unlock()
+	c.Assert(b.checkpoints, HasLen, 1)
+
+	b.needsCheckpoint = true
+	st.Lock()
+	st.Set("foo", 2)
+	st.Unlock()
+	c.Assert(b.checkpoints, HasLen, 2)
+	c.Check(b.journal, HasLen, 0)
+
+	st2 := readState(c, b.checkpoints[1])
+	st2.Lock()
+	defer st2.Unlock()
+	var foo int
+	c.Check(st2.Get("foo", &foo), IsNil)
+	c.Check(foo, Equals, 2)
+}
+
+func (s *journalSuite) TestJournalRetriesWithCheckpoint(c *C) {
+	restore := state.MockCheckpointRetryDelay(time.Millisecond, time.Second)
+	defer restore()
+
+	b := new(fakeJournalBackend)
+	st := state.New(b)
+
+	st.Lock()
+	st.Set("foo", 1)
+	st.Unlock()
+
+	b.journalError = errors.New("boom")
+	st.Lock()
+	st.Set("foo", 2)
+	st.Unlock()
+	c.Check(b.journal, HasLen, 0)
+	c.Assert(b.checkpoints, HasLen, 2)
+
+	st2 := readState(c, b.checkpoints[1])
+	st2.Lock()
+	defer st2.Unlock()
+	var foo int
+	c.Check(st2.Get("foo", &foo), IsNil)
+	c.Check(foo, Equals, 2)
+}
+
+func (s *journalSuite) TestApplyJournalErrors(c *C) {
+	_, err := state.ApplyJournal([]byte("{"), nil)
+	c.Check(err, ErrorMatches, "cannot apply state journal: unexpected end of JSON input")
+
+	_, err = state.ApplyJournal([]byte(`{"notices": [{"key": "foo"}]}`), nil)
+	c.Check(err, ErrorMatches, "cannot apply state journal: invalid notices: element without id")
+}
@@ -108,6 +108,11 @@ func (n *Notice) Type() NoticeType {
 	return n.noticeType
 }
 
+// Key returns the notice key which identifies the notice within its type.
+func (n *Notice) Key() string {
+	return n.key
+}
+
 func flattenUserID(userID *uint32) (uid uint32, isSet bool) {
 	if userID == nil {
 		return 0, false
@@ -214,11 +219,25 @@ const (
 	// expired. The key for interfaces-requests-rule-update notices is the
 	// rule ID.
 	InterfacesRequestsRuleUpdateNotice NoticeType = "interfaces-requests-rule-update"
+
+	// Recorded whenever the usage of a resource limited by a quota group
+	// crosses the configured threshold. The key for quota-threshold notices
+	// is the quota group name.
+	QuotaThresholdNotice NoticeType = "quota-threshold"
+
+	// Recorded whenever the health status of a snap changes. The key for
+	// snap-health notices is the snap instance name.
+	SnapHealthNotice NoticeType = "snap-health"
+
+	// Recorded whenever a committed confdb change may have modified the data
+	// visible through a view. The key for confdb-changed notices is the view
+	// ID, in the form <account>/<confdb>/<view>.
+	ConfdbChangedNotice NoticeType = "confdb-changed"
 )
 
 func (t NoticeType) Valid() bool {
 	switch t {
-	case ChangeUpdateNotice, WarningNotice, RefreshInhibitNotice, SnapRunInhibitNotice, InterfacesRequestsPromptNotice, InterfacesRequestsRuleUpdateNotice:
+	case ChangeUpdateNotice, WarningNotice, RefreshInhibitNotice, SnapRunInhibitNotice, InterfacesRequestsPromptNotice, InterfacesRequestsRuleUpdateNotice, QuotaThresholdNotice, SnapHealthNotice, ConfdbChangedNotice:
 		return true
 	}
 	return false
@@ -346,6 +365,10 @@ type NoticeFilter struct {
 	// Keys, if not empty, includes only notices whose key is one of these.
 	Keys []string
 
+	// TypeKeys, if not nil, includes notices of the types it has an entry
+	// for only if their key is one of the keys listed for the type.
+	TypeKeys map[NoticeType][]string
+
 	// After, if set, includes only notices that were last repeated after this time.
 	After time.Time
 }
@@ -365,6 +388,9 @@ func (f *NoticeFilter) matches(n *Notice) bool {
 	if len(f.Keys) > 0 && !sliceContains(f.Keys, n.key) {
 		return false
 	}
+	if keys, ok := f.TypeKeys[n.noticeType]; ok && !sliceContains(keys, n.key) {
+		return false
+	}
 	if !f.After.IsZero() && !n.lastRepeated.After(f.After) {
 		return false
 	}
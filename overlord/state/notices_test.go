@@ -387,6 +387,38 @@ func (s *noticesSuite) TestNoticesFilterKey(c *C) {
 	c.Check(n["key"], Equals, "foo.com/baz")
 }
 
+func (s *noticesSuite) TestNoticesFilterTypeKeys(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	addNotice(c, st, nil, state.WarningNotice, "foo.com/bar", nil)
+	time.Sleep(time.Microsecond)
+	addNotice(c, st, nil, state.WarningNotice, "foo.com/baz", nil)
+	time.Sleep(time.Microsecond)
+	addNotice(c, st, nil, state.ChangeUpdateNotice, "123", nil)
+
+	// The keys only restrict the notices of the given type
+	notices := st.Notices(&state.NoticeFilter{TypeKeys: map[state.NoticeType][]string{
+		state.WarningNotice: {"foo.com/baz"},
+	}})
+	c.Assert(notices, HasLen, 2)
+	n := noticeToMap(c, notices[0])
+	c.Check(n["type"], Equals, "warning")
+	c.Check(n["key"], Equals, "foo.com/baz")
+	n = noticeToMap(c, notices[1])
+	c.Check(n["type"], Equals, "change-update")
+	c.Check(n["key"], Equals, "123")
+
+	// No keys for a type excludes all its notices
+	notices = st.Notices(&state.NoticeFilter{TypeKeys: map[state.NoticeType][]string{
+		state.WarningNotice: nil,
+	}})
+	c.Assert(notices, HasLen, 1)
+	n = noticeToMap(c, notices[0])
+	c.Check(n["type"], Equals, "change-update")
+}
+
 func (s *noticesSuite) TestNoticesFilterAfter(c *C) {
 	st := state.New(nil)
 	st.Lock()
@@ -104,6 +104,16 @@ type State struct {
 
 	modified bool
 
+	// journaled holds the entries persisted by the last checkpoint when
+	// using a JournalBackend, it is empty until the full state was
+	// checkpointed
+	journaled map[string]json.RawMessage
+	// dirtyChanges and dirtyTasks hold the IDs of the changes and tasks
+	// modified since the last checkpoint, the others are journaled as
+	// they were by the last checkpoint
+	dirtyChanges map[string]bool
+	dirtyTasks   map[string]bool
+
 	cache map[interface{}]interface{}
 
 	pendingChangeByAttr map[string]func(*Change) bool
@@ -111,6 +121,7 @@ type State struct {
 	// task/changes observing
 	taskHandlers   map[int]func(t *Task, old, new Status) (remove bool)
 	changeHandlers map[int]func(chg *Change, old, new Status)
+	pruneHandlers  map[int]func(chgs []*Change)
 }
 
 // New returns a new empty state.
@@ -123,10 +134,14 @@ func New(backend Backend) *State {
 		warnings:            make(map[string]*Warning),
 		notices:             make(map[noticeKey]*Notice),
 		modified:            true,
+		journaled:           make(map[string]json.RawMessage),
+		dirtyChanges:        make(map[string]bool),
+		dirtyTasks:          make(map[string]bool),
 		cache:               make(map[interface{}]interface{}),
 		pendingChangeByAttr: make(map[string]func(*Change) bool),
 		taskHandlers:        make(map[int]func(t *Task, old Status, new Status) bool),
 		changeHandlers:      make(map[int]func(chg *Change, old Status, new Status)),
+		pruneHandlers:       make(map[int]func(chgs []*Change)),
 	}
 	st.noticeCond = sync.NewCond(st) // use State.Lock and State.Unlock
 	return st
@@ -156,6 +171,20 @@ func (s *State) writing() {
 	}
 }
 
+// writingChange is like writing, and marks the change as modified since the
+// last checkpoint.
+func (s *State) writingChange(chg *Change) {
+	s.writing()
+	s.dirtyChanges[chg.id] = true
+}
+
+// writingTask is like writing, and marks the task as modified since the last
+// checkpoint.
+func (s *State) writingTask(t *Task) {
+	s.writing()
+	s.dirtyTasks[t.id] = true
+}
+
 func (s *State) unlock() {
 	atomic.AddInt32(&s.muC, -1)
 	s.mu.Unlock()
@@ -233,6 +262,32 @@ func (s *State) checkpointData() []byte {
 	return data
 }
 
+// checkpointer returns a function persisting the state through the
+// backend. With a JournalBackend only the entries that changed since the
+// previous checkpoint are persisted, unless the backend asks for the full
+// state.
+func (s *State) checkpointer() func() error {
+	jb, ok := s.backend.(JournalBackend)
+	if !ok {
+		data := s.checkpointData()
+		return func() error { return s.backend.Checkpoint(data) }
+	}
+
+	entries := s.journalEntries()
+	return func() error {
+		var err error
+		if len(s.journaled) == 0 || jb.NeedsCheckpoint() {
+			err = jb.Checkpoint(assembleJournalEntries(entries))
+		} else if delta := journalDelta(s.journaled, entries); len(delta) > 0 {
+			err = jb.Journal(delta)
+		}
+		if err == nil {
+			s.journaled = entries
+		}
+		return err
+	}
+}
+
 // unlock checkpoint retry parameters (5 mins of retries by default)
 var (
 	unlockCheckpointRetryMaxTime  = 5 * time.Minute
@@ -258,12 +313,18 @@ func (s *State) Unlock() {
 		return
 	}
 
-	data := s.checkpointData()
+	checkpoint := s.checkpointer()
 	var err error
 	start := time.Now()
 	for time.Since(start) <= unlockCheckpointRetryMaxTime {
-		if err = s.backend.Checkpoint(data); err == nil {
+		if err = checkpoint(); err == nil {
 			s.modified = false
+			if len(s.dirtyChanges) > 0 {
+				s.dirtyChanges = make(map[string]bool)
+			}
+			if len(s.dirtyTasks) > 0 {
+				s.dirtyTasks = make(map[string]bool)
+			}
 			return
 		}
 		time.Sleep(unlockCheckpointRetryInterval)
@@ -481,6 +542,7 @@ func (s *State) Prune(startOfOperation time.Time, pruneWait, abortWait time.Dura
 		}
 	}
 
+	var pruned []*Change
 NextChange:
 	for _, chg := range changes {
 		readyTime := chg.ReadyTime()
@@ -504,12 +566,19 @@ NextChange:
 		}
 		// change old or we have too many changes
 		if readyTime.Before(pruneLimit) || readyChangesCount > maxReadyChanges {
-			s.writing()
+			pruned = append(pruned, chg)
+			readyChangesCount--
+		}
+	}
+
+	if len(pruned) > 0 {
+		s.writing()
+		s.notifyChangesPrunedHandlers(pruned)
+		for _, chg := range pruned {
 			for _, t := range chg.Tasks() {
 				delete(s.tasks, t.ID())
 			}
 			delete(s.changes, chg.ID())
-			readyChangesCount--
 		}
 	}
 
@@ -588,6 +657,28 @@ func (s *State) notifyChangeStatusChangedHandlers(chg *Change, old, new Status)
 	}
 }
 
+// AddChangesPrunedHandler adds a callback function that will be invoked
+// with the ready changes right before Prune removes them, together with
+// their tasks, from the state.
+func (s *State) AddChangesPrunedHandler(f func(chgs []*Change)) (id int) {
+	s.reading()
+	id = s.lastHandlerId
+	s.lastHandlerId++
+	s.pruneHandlers[id] = f
+	return id
+}
+
+func (s *State) RemoveChangesPrunedHandler(id int) {
+	s.reading()
+	delete(s.pruneHandlers, id)
+}
+
+func (s *State) notifyChangesPrunedHandlers(chgs []*Change) {
+	for _, f := range s.pruneHandlers {
+		f(chgs)
+	}
+}
+
 // SaveTimings implements timings.GetSaver
 func (s *State) SaveTimings(timings interface{}) {
 	s.Set("timings", timings)
@@ -606,9 +697,13 @@ func ReadState(backend Backend, r io.Reader) (*State, error) {
 	s.backend = backend
 	s.noticeCond = sync.NewCond(s)
 	s.modified = false
+	s.journaled = make(map[string]json.RawMessage)
+	s.dirtyChanges = make(map[string]bool)
+	s.dirtyTasks = make(map[string]bool)
 	s.cache = make(map[interface{}]interface{})
 	s.pendingChangeByAttr = make(map[string]func(*Change) bool)
 	s.changeHandlers = make(map[int]func(chg *Change, old Status, new Status))
 	s.taskHandlers = make(map[int]func(t *Task, old Status, new Status) bool)
+	s.pruneHandlers = make(map[int]func(chgs []*Change))
 	return s, err
 }
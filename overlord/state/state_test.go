@@ -577,10 +577,14 @@ func (ss *stateSuite) TestEmptyStateDataAndCheckpointReadAndSet(c *C) {
 		"tasks",
 		"warnings",
 		"notices",
+		"journaled",
+		"dirtyChanges",
+		"dirtyTasks",
 		"cache",
 		"pendingChangeByAttr",
 		"taskHandlers",
 		"changeHandlers",
+		"pruneHandlers",
 	})
 }
 
@@ -865,6 +869,59 @@ func (ss *stateSuite) TestPrune(c *C) {
 	c.Check(st.AllWarnings(), HasLen, 1)
 }
 
+func (ss *stateSuite) TestPruneNotifiesChangesPrunedHandlers(c *C) {
+	st := state.New(&fakeStateBackend{})
+	st.Lock()
+	defer st.Unlock()
+
+	now := time.Now()
+	pruneWait := 1 * time.Hour
+	abortWait := 3 * time.Hour
+
+	t1 := st.NewTask("foo", "...")
+	t1.Logf("done something")
+	chg1 := st.NewChange("prune", "...")
+	chg1.AddTask(t1)
+	state.MockChangeTimes(chg1, now.Add(-pruneWait), now.Add(-pruneWait))
+
+	t2 := st.NewTask("foo", "...")
+	chg2 := st.NewChange("old-but-not-ready", "...")
+	chg2.AddTask(t2)
+	state.MockChangeTimes(chg2, now.Add(-abortWait), time.Time{})
+
+	var pruned []string
+	var logs []string
+	calls := 0
+	st.AddChangesPrunedHandler(func(chgs []*state.Change) {
+		calls++
+		for _, chg := range chgs {
+			// the change and its tasks are still there
+			c.Check(st.Change(chg.ID()), Equals, chg)
+			pruned = append(pruned, chg.ID())
+			for _, t := range chg.Tasks() {
+				logs = append(logs, t.Log()...)
+			}
+		}
+	})
+	id := st.AddChangesPrunedHandler(func(chgs []*state.Change) {
+		c.Errorf("removed handler called")
+	})
+	st.RemoveChangesPrunedHandler(id)
+
+	st.Prune(now.AddDate(-1, 0, 0), pruneWait, abortWait, 100)
+
+	c.Check(calls, Equals, 1)
+	c.Check(pruned, DeepEquals, []string{chg1.ID()})
+	c.Assert(logs, HasLen, 1)
+	c.Check(logs[0], Matches, ".* INFO done something")
+	c.Check(st.Change(chg1.ID()), IsNil)
+	c.Check(st.Change(chg2.ID()), Equals, chg2)
+
+	// the handlers are not called if nothing is pruned
+	st.Prune(now.AddDate(-1, 0, 0), pruneWait, abortWait, 100)
+	c.Check(calls, Equals, 1)
+}
+
 func (ss *stateSuite) TestRegisterPendingChangeByAttr(c *C) {
 	st := state.New(&fakeStateBackend{})
 	st.Lock()
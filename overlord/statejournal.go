@@ -0,0 +1,234 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package overlord
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"time"
+
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+// The state journal holds the changes to the state since the state file was
+// last written, as a sequence of records each consisting of the length and
+// the CRC-32C of the payload followed by the payload itself. The payload of
+// the first record is the SHA-256 of the state file the journal applies to,
+// the payload of the following ones is a JSON list of state.JournalEntry.
+//
+// The state file is only rewritten when compacting the journal, and a
+// journal whose first record does not match the state file was already
+// compacted into it. Records that were not completely written, because of a
+// crash, are ignored when replaying the journal.
+
+// minStateJournalCompactSize is the size up to which the state journal can
+// always grow before being compacted into the state file, past it the
+// journal is compacted once it is larger than the state file.
+var minStateJournalCompactSize int64 = 1024 * 1024
+
+const stateJournalRecordHeaderSize = 8
+
+var stateJournalCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+func stateJournalRecord(payload []byte) []byte {
+	record := make([]byte, stateJournalRecordHeaderSize, stateJournalRecordHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[4:8], crc32.Checksum(payload, stateJournalCRCTable))
+	return append(record, payload...)
+}
+
+// nextStateJournalRecord returns the payload of the first record in data
+// and the data after it, or a nil payload if the record is incomplete or
+// corrupted.
+func nextStateJournalRecord(data []byte) (payload, rest []byte) {
+	if len(data) < stateJournalRecordHeaderSize {
+		return nil, nil
+	}
+	size := binary.LittleEndian.Uint32(data[0:4])
+	if uint64(len(data)-stateJournalRecordHeaderSize) < uint64(size) {
+		return nil, nil
+	}
+	end := stateJournalRecordHeaderSize + int(size)
+	payload = data[stateJournalRecordHeaderSize:end]
+	if crc32.Checksum(payload, stateJournalCRCTable) != binary.LittleEndian.Uint32(data[4:8]) {
+		return nil, nil
+	}
+	return payload, data[end:]
+}
+
+// journalStateBackend is a state backend that appends the changes to the
+// state to a journal, rewriting the state file only when asked to
+// checkpoint the full state.
+type journalStateBackend struct {
+	overlordStateBackend
+	journalPath string
+
+	journal        *os.File
+	journalSize    int64
+	checkpointSize int64
+}
+
+func newJournalStateBackend(path, journalPath string, ensureBefore func(d time.Duration)) *journalStateBackend {
+	return &journalStateBackend{
+		overlordStateBackend: overlordStateBackend{
+			path:         path,
+			ensureBefore: ensureBefore,
+		},
+		journalPath: journalPath,
+	}
+}
+
+// Checkpoint writes the state file and starts a new, empty journal.
+func (jsb *journalStateBackend) Checkpoint(data []byte) error {
+	if err := jsb.overlordStateBackend.Checkpoint(data); err != nil {
+		return err
+	}
+	jsb.checkpointSize = int64(len(data))
+
+	if jsb.journal == nil {
+		f, err := os.OpenFile(jsb.journalPath, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		jsb.journal = f
+	}
+	sum := sha256.Sum256(data)
+	jsb.journalSize = 0
+	if err := jsb.journal.Truncate(0); err != nil {
+		jsb.closeJournal()
+		return err
+	}
+	return jsb.append(stateJournalRecord(sum[:]))
+}
+
+// Journal appends the given entries to the journal.
+func (jsb *journalStateBackend) Journal(entries []state.JournalEntry) error {
+	if jsb.journal == nil {
+		return errors.New("internal error: cannot journal state changes without a checkpoint")
+	}
+	payload, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return jsb.append(stateJournalRecord(payload))
+}
+
+func (jsb *journalStateBackend) append(record []byte) error {
+	_, err := jsb.journal.WriteAt(record, jsb.journalSize)
+	if err == nil {
+		err = jsb.journal.Sync()
+	}
+	if err != nil {
+		// the journal cannot be trusted anymore, the full state
+		// needs to be checkpointed again
+		jsb.closeJournal()
+		return err
+	}
+	jsb.journalSize += int64(len(record))
+	return nil
+}
+
+// NeedsCheckpoint returns true if there is no usable journal or if it grew
+// large enough to be compacted into the state file.
+func (jsb *journalStateBackend) NeedsCheckpoint() bool {
+	if jsb.journal == nil {
+		return true
+	}
+	limit := minStateJournalCompactSize
+	if jsb.checkpointSize > limit {
+		limit = jsb.checkpointSize
+	}
+	return jsb.journalSize > limit
+}
+
+func (jsb *journalStateBackend) closeJournal() {
+	if jsb.journal != nil {
+		jsb.journal.Close()
+		jsb.journal = nil
+	}
+}
+
+// compactStateJournal applies the journal at journalPath, if any, to the
+// state file at statePath and removes it.
+func compactStateJournal(statePath, journalPath string) error {
+	journal, err := os.ReadFile(journalPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read the state journal: %v", err)
+	}
+	removeJournal := func() error {
+		if err := os.Remove(journalPath); err != nil {
+			return fmt.Errorf("cannot remove the state journal: %v", err)
+		}
+		return nil
+	}
+
+	data, err := os.ReadFile(statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		logger.Noticef("Discarding state journal without a state file")
+		return removeJournal()
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read the state file: %s", err)
+	}
+
+	sum := sha256.Sum256(data)
+	payload, rest := nextStateJournalRecord(journal)
+	if !bytes.Equal(payload, sum[:]) {
+		// the journal is incomplete or already part of the state file
+		return removeJournal()
+	}
+	var entries []state.JournalEntry
+	var records int
+	for len(rest) > 0 {
+		payload, rest = nextStateJournalRecord(rest)
+		if payload == nil {
+			logger.Noticef("Ignoring incomplete state journal record")
+			break
+		}
+		var recordEntries []state.JournalEntry
+		if err := json.Unmarshal(payload, &recordEntries); err != nil {
+			return fmt.Errorf("cannot decode the state journal: %v", err)
+		}
+		entries = append(entries, recordEntries...)
+		records++
+	}
+	if records > 0 {
+		logger.Noticef("Applying %d state journal records", records)
+		data, err = state.ApplyJournal(data, entries)
+		if err != nil {
+			return err
+		}
+		if err := osutil.AtomicWriteFile(statePath, data, 0600, 0); err != nil {
+			return err
+		}
+	}
+	return removeJournal()
+}
@@ -0,0 +1,254 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package overlord_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/features"
+	"github.com/snapcore/snapd/overlord"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/testutil"
+)
+
+func (ovs *overlordSuite) enableStateJournal(c *C) {
+	dirs.SnapStateJournal = filepath.Join(filepath.Dir(dirs.SnapStateFile), "test.journal")
+	c.Assert(os.MkdirAll(dirs.FeaturesDir, 0755), IsNil)
+	c.Assert(os.WriteFile(features.StateJournal.ControlFile(), nil, 0644), IsNil)
+}
+
+func (ovs *overlordSuite) TestStateJournal(c *C) {
+	ovs.enableStateJournal(c)
+
+	o, err := overlord.New(nil)
+	c.Assert(err, IsNil)
+
+	// the state was checkpointed in full while loading it
+	c.Check(dirs.SnapStateFile, testutil.FilePresent)
+
+	// further changes are only journaled
+	s := o.State()
+	s.Lock()
+	s.Set("mark", 1)
+	s.Unlock()
+	s.Lock()
+	s.Set("mark", 2)
+	s.Set("other-mark", 3)
+	s.Unlock()
+	c.Check(dirs.SnapStateFile, Not(testutil.FileContains), `"mark"`)
+	c.Check(dirs.SnapStateJournal, testutil.FileContains, `{"key":"data/mark","value":1}`)
+	c.Check(dirs.SnapStateJournal, testutil.FileContains, `{"key":"data/mark","value":2}`)
+	c.Check(dirs.SnapStateJournal, testutil.FileContains, `{"key":"data/other-mark","value":3}`)
+
+	st, err := os.Stat(dirs.SnapStateJournal)
+	c.Assert(err, IsNil)
+	c.Check(st.Mode().Perm(), Equals, os.FileMode(0600))
+
+	// the journal is compacted into the state file when stopping
+	c.Assert(o.Stop(), IsNil)
+	c.Check(dirs.SnapStateFile, testutil.FileContains, `"mark":2`)
+	c.Check(dirs.SnapStateFile, testutil.FileContains, `"other-mark":3`)
+	c.Check(dirs.SnapStateJournal, testutil.FileAbsent)
+}
+
+func (ovs *overlordSuite) TestStateJournalCompactedWhenLarge(c *C) {
+	ovs.enableStateJournal(c)
+	restore := overlord.MockMinStateJournalCompactSize(0)
+	defer restore()
+
+	o, err := overlord.New(nil)
+	c.Assert(err, IsNil)
+	s := o.State()
+
+	for i := 0; i < 10; i++ {
+		s.Lock()
+		s.Set("mark", strings.Repeat("x", 100*i))
+		s.Unlock()
+	}
+
+	// the journal never grows larger than the state file
+	st, err := os.Stat(dirs.SnapStateFile)
+	c.Assert(err, IsNil)
+	jst, err := os.Stat(dirs.SnapStateJournal)
+	c.Assert(err, IsNil)
+	c.Check(jst.Size() <= st.Size(), Equals, true)
+	c.Check(dirs.SnapStateFile, testutil.FileContains, strings.Repeat("x", 800))
+}
+
+// journalState writes a state file with a journal with the given changes,
+// as left behind by a journaling snapd that was interrupted.
+func journalState(c *C, changes ...func(s *state.State)) {
+	backend := overlord.NewJournalStateBackend(dirs.SnapStateFile, dirs.SnapStateJournal)
+	s := state.New(backend)
+	s.Lock()
+	s.Set("mark", 1)
+	s.Unlock()
+	for _, change := range changes {
+		s.Lock()
+		change(s)
+		s.Unlock()
+	}
+}
+
+func (ovs *overlordSuite) TestLoadStateAppliesJournal(c *C) {
+	dirs.SnapStateJournal = filepath.Join(filepath.Dir(dirs.SnapStateFile), "test.journal")
+	journalState(c, func(s *state.State) {
+		s.Set("mark", 2)
+	}, func(s *state.State) {
+		s.Set("other-mark", 3)
+	})
+	c.Check(dirs.SnapStateFile, Not(testutil.FileContains), `"other-mark"`)
+
+	// the journal is applied even without journaling enabled
+	o, err := overlord.New(nil)
+	c.Assert(err, IsNil)
+	c.Check(dirs.SnapStateJournal, testutil.FileAbsent)
+	c.Check(dirs.SnapStateFile, testutil.FileContains, `"other-mark":3`)
+
+	s := o.State()
+	s.Lock()
+	defer s.Unlock()
+	var mark, otherMark int
+	c.Assert(s.Get("mark", &mark), IsNil)
+	c.Assert(s.Get("other-mark", &otherMark), IsNil)
+	c.Check(mark, Equals, 2)
+	c.Check(otherMark, Equals, 3)
+}
+
+func (ovs *overlordSuite) TestLoadStateIgnoresIncompleteJournalRecord(c *C) {
+	dirs.SnapStateJournal = filepath.Join(filepath.Dir(dirs.SnapStateFile), "test.journal")
+	journalState(c, func(s *state.State) {
+		s.Set("mark", 2)
+	}, func(s *state.State) {
+		s.Set("mark", 3)
+	})
+
+	// simulate a crash while appending the last record
+	st, err := os.Stat(dirs.SnapStateJournal)
+	c.Assert(err, IsNil)
+	c.Assert(os.Truncate(dirs.SnapStateJournal, st.Size()-1), IsNil)
+
+	o, err := overlord.New(nil)
+	c.Assert(err, IsNil)
+	c.Check(dirs.SnapStateJournal, testutil.FileAbsent)
+
+	s := o.State()
+	s.Lock()
+	defer s.Unlock()
+	var mark int
+	c.Assert(s.Get("mark", &mark), IsNil)
+	c.Check(mark, Equals, 2)
+}
+
+func (ovs *overlordSuite) TestLoadStateDiscardsStaleJournal(c *C) {
+	dirs.SnapStateJournal = filepath.Join(filepath.Dir(dirs.SnapStateFile), "test.journal")
+	journalState(c, func(s *state.State) {
+		s.Set("mark", 2)
+	})
+
+	// simulate a crash after writing the state file while compacting
+	// the journal
+	data, err := os.ReadFile(dirs.SnapStateFile)
+	c.Assert(err, IsNil)
+	data = []byte(strings.Replace(string(data), `"mark":1`, `"mark":5`, 1))
+	c.Assert(os.WriteFile(dirs.SnapStateFile, data, 0600), IsNil)
+
+	o, err := overlord.New(nil)
+	c.Assert(err, IsNil)
+	c.Check(dirs.SnapStateJournal, testutil.FileAbsent)
+
+	s := o.State()
+	s.Lock()
+	defer s.Unlock()
+	var mark int
+	c.Assert(s.Get("mark", &mark), IsNil)
+	c.Check(mark, Equals, 5)
+}
+
+func (ovs *overlordSuite) TestLoadStateDiscardsJournalWithoutState(c *C) {
+	dirs.SnapStateJournal = filepath.Join(filepath.Dir(dirs.SnapStateFile), "test.journal")
+	journalState(c, func(s *state.State) {
+		s.Set("mark", 2)
+	})
+	c.Assert(os.Remove(dirs.SnapStateFile), IsNil)
+
+	o, err := overlord.New(nil)
+	c.Assert(err, IsNil)
+	c.Check(dirs.SnapStateJournal, testutil.FileAbsent)
+
+	s := o.State()
+	s.Lock()
+	defer s.Unlock()
+	c.Check(s.Get("mark", nil), testutil.ErrorIs, state.ErrNoState)
+}
+
+// largeState returns a state with many changes, as on a busy device,
+// checkpointed through the given backend.
+func largeState(backend state.Backend) (*state.State, []*state.Task) {
+	s := state.New(backend)
+	s.Lock()
+	defer s.Unlock()
+	var tasks []*state.Task
+	for i := 0; i < 500; i++ {
+		chg := s.NewChange("install-snap", fmt.Sprintf("Install snap %d", i))
+		for j := 0; j < 20; j++ {
+			t := s.NewTask("some-task", fmt.Sprintf("Do step %d of change %d", j, i))
+			t.Set("snap-setup", map[string]interface{}{
+				"snap-name": fmt.Sprintf("snap-%d", i),
+				"revision":  j,
+				"channel":   "latest/stable",
+			})
+			t.Logf("something happened")
+			chg.AddTask(t)
+			tasks = append(tasks, t)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		s.Set(fmt.Sprintf("data-%d", i), strings.Repeat("x", 1000))
+	}
+	return s, tasks
+}
+
+func benchmarkCheckpoint(b *testing.B, backend state.Backend) {
+	s, tasks := largeState(backend)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Lock()
+		tasks[i%len(tasks)].Logf("step %d", i)
+		s.Unlock()
+	}
+}
+
+func BenchmarkCheckpointFull(b *testing.B) {
+	dir := b.TempDir()
+	benchmarkCheckpoint(b, overlord.NewStateBackend(filepath.Join(dir, "state.json")))
+}
+
+func BenchmarkCheckpointJournal(b *testing.B) {
+	dir := b.TempDir()
+	benchmarkCheckpoint(b, overlord.NewJournalStateBackend(filepath.Join(dir, "state.json"), filepath.Join(dir, "state.journal")))
+}
@@ -73,6 +73,9 @@ type StoreOptions interface {
 	// ProxyStore returns the store assertion for the proxy store if one is set.
 	ProxyStore() (*asserts.Store, error)
 
+	// StoreMirror returns the URL of the store mirror if one is set.
+	StoreMirror() (*url.URL, error)
+
 	// StoreOffline returns a string indicating whether the store should have
 	// network access or not
 	StoreOffline() (bool, error)
@@ -234,7 +237,9 @@ func (sc *storeContext) deviceSessionRequestParams(nonce string) (*DeviceSession
 	}, nil
 }
 
-// ProxyStoreParams returns the id and URL of the proxy store if one is set. Returns the defaultURL otherwise and id = "".
+// ProxyStoreParams returns the id and URL of the proxy store if one is set.
+// Otherwise it returns the URL of the store mirror if one is set, or the
+// defaultURL, and id = "".
 func (sc *storeContext) ProxyStoreParams(defaultURL *url.URL) (proxyStoreID string, proxySroreURL *url.URL, err error) {
 	sc.state.Lock()
 	defer sc.state.Unlock()
@@ -248,6 +253,15 @@ func (sc *storeContext) ProxyStoreParams(defaultURL *url.URL) (proxyStoreID stri
 		return sto.Store(), sto.URL(), nil
 	}
 
+	mirror, err := sc.storeOptions.StoreMirror()
+	if err != nil && !errors.Is(err, state.ErrNoState) {
+		return "", nil, err
+	}
+
+	if mirror != nil {
+		return "", mirror, nil
+	}
+
 	return "", defaultURL, nil
 }
 
@@ -307,6 +307,8 @@ type testBackend struct {
 	nothing      bool
 	noSerial     bool
 	storeOffline bool
+	noProxyStore bool
+	storeMirror  *url.URL
 	device       *auth.DeviceState
 }
 
@@ -361,7 +363,7 @@ func (b *testBackend) SignDeviceSessionRequest(serial *asserts.Serial, nonce str
 }
 
 func (b *testBackend) ProxyStore() (*asserts.Store, error) {
-	if b.nothing {
+	if b.nothing || b.noProxyStore {
 		return nil, state.ErrNoState
 	}
 	a, err := asserts.Decode([]byte(exStore))
@@ -371,6 +373,13 @@ func (b *testBackend) ProxyStore() (*asserts.Store, error) {
 	return a.(*asserts.Store), nil
 }
 
+func (b *testBackend) StoreMirror() (*url.URL, error) {
+	if b.nothing || b.storeMirror == nil {
+		return nil, state.ErrNoState
+	}
+	return b.storeMirror, nil
+}
+
 func (b *testBackend) StoreOffline() (bool, error) {
 	if b.nothing {
 		return false, state.ErrNoState
@@ -432,6 +441,27 @@ func (s *storeCtxSuite) TestWithDeviceAssertions(c *C) {
 	c.Check(proxyStoreURL, DeepEquals, fooURL)
 }
 
+func (s *storeCtxSuite) TestStoreMirror(c *C) {
+	mirrorURL, err := url.Parse("http://mirror.lan:8080")
+	c.Assert(err, IsNil)
+
+	storeCtx := storecontext.New(s.state, &testBackend{noProxyStore: true, storeMirror: mirrorURL})
+	proxyStoreID, proxyStoreURL, err := storeCtx.ProxyStoreParams(s.defURL)
+	c.Assert(err, IsNil)
+	c.Check(proxyStoreID, Equals, "")
+	c.Check(proxyStoreURL, Equals, mirrorURL)
+
+	// a proxy store takes precedence
+	fooURL, err := url.Parse("http://foo.internal")
+	c.Assert(err, IsNil)
+
+	storeCtx = storecontext.New(s.state, &testBackend{storeMirror: mirrorURL})
+	proxyStoreID, proxyStoreURL, err = storeCtx.ProxyStoreParams(s.defURL)
+	c.Assert(err, IsNil)
+	c.Check(proxyStoreID, Equals, "foo")
+	c.Check(proxyStoreURL, DeepEquals, fooURL)
+}
+
 func (s *storeCtxSuite) TestWithDeviceAssertionsGenericClassicModel(c *C) {
 	model, err := asserts.Decode([]byte(exModel))
 	c.Assert(err, IsNil)
@@ -181,11 +181,14 @@ BuildRequires: golang(github.com/juju/ratelimit)
 BuildRequires: golang(github.com/kr/pretty)
 BuildRequires: golang(github.com/kr/text)
 BuildRequires: golang(github.com/mvo5/goconfigparser)
+BuildRequires: golang(github.com/pkg/sftp)
 BuildRequires: golang(github.com/seccomp/libseccomp-golang)
 BuildRequires: golang(github.com/snapcore/go-gettext)
 BuildRequires: golang(golang.org/x/crypto/openpgp/armor)
 BuildRequires: golang(golang.org/x/crypto/openpgp/packet)
 BuildRequires: golang(golang.org/x/crypto/sha3)
+BuildRequires: golang(golang.org/x/crypto/ssh)
+BuildRequires: golang(golang.org/x/crypto/ssh/knownhosts)
 BuildRequires: golang(golang.org/x/crypto/ssh/terminal)
 BuildRequires: golang(golang.org/x/xerrors)
 BuildRequires: golang(golang.org/x/xerrors/internal)
@@ -279,11 +282,14 @@ Requires:      golang(github.com/juju/ratelimit)
 Requires:      golang(github.com/kr/pretty)
 Requires:      golang(github.com/kr/text)
 Requires:      golang(github.com/mvo5/goconfigparser)
+Requires:      golang(github.com/pkg/sftp)
 Requires:      golang(github.com/seccomp/libseccomp-golang)
 Requires:      golang(github.com/snapcore/go-gettext)
 Requires:      golang(golang.org/x/crypto/openpgp/armor)
 Requires:      golang(golang.org/x/crypto/openpgp/packet)
 Requires:      golang(golang.org/x/crypto/sha3)
+Requires:      golang(golang.org/x/crypto/ssh)
+Requires:      golang(golang.org/x/crypto/ssh/knownhosts)
 Requires:      golang(golang.org/x/crypto/ssh/terminal)
 Requires:      golang(golang.org/x/xerrors)
 Requires:      golang(golang.org/x/xerrors/internal)
@@ -309,11 +315,14 @@ Provides:      bundled(golang(github.com/juju/ratelimit))
 Provides:      bundled(golang(github.com/kr/pretty))
 Provides:      bundled(golang(github.com/kr/text))
 Provides:      bundled(golang(github.com/mvo5/goconfigparser))
+Provides:      bundled(golang(github.com/pkg/sftp))
 Provides:      bundled(golang(github.com/seccomp/libseccomp-golang))
 Provides:      bundled(golang(github.com/snapcore/go-gettext))
 Provides:      bundled(golang(golang.org/x/crypto/openpgp/armor))
 Provides:      bundled(golang(golang.org/x/crypto/openpgp/packet))
 Provides:      bundled(golang(golang.org/x/crypto/sha3))
+Provides:      bundled(golang(golang.org/x/crypto/ssh))
+Provides:      bundled(golang(golang.org/x/crypto/ssh/knownhosts))
 Provides:      bundled(golang(golang.org/x/crypto/ssh/terminal))
 Provides:      bundled(golang(golang.org/x/xerrors))
 Provides:      bundled(golang(golang.org/x/xerrors/internal))
@@ -102,6 +102,10 @@ func MockSbSealKeyToTPMMultiple(f func(tpm *sb_tpm2.Connection, keys []*sb_tpm2.
 	}
 }
 
+func MockSbSealedKeyObjectUnsealFromTPM(f func(sko *sb_tpm2.SealedKeyObject, tpm *sb_tpm2.Connection) ([]byte, sb_tpm2.PolicyAuthKey, error)) (restore func()) {
+	return testutil.Mock(&sbSealedKeyObjectUnsealFromTPM, f)
+}
+
 func MockSbUpdateKeyPCRProtectionPolicyMultiple(f func(tpm *sb_tpm2.Connection, keys []*sb_tpm2.SealedKeyObject, authKey sb_tpm2.PolicyAuthKey, pcrProfile *sb_tpm2.PCRProtectionProfile) error) (restore func()) {
 	old := sbUpdateKeyPCRProtectionPolicyMultiple
 	sbUpdateKeyPCRProtectionPolicyMultiple = f
@@ -44,6 +44,14 @@ func ResealKeys(params *ResealKeysParams) error {
 	return errBuildWithoutSecboot
 }
 
+func SealDeviceBoundKey(key []byte, keyFile string) error {
+	return errBuildWithoutSecboot
+}
+
+func UnsealDeviceBoundKey(keyFile string) ([]byte, error) {
+	return nil, errBuildWithoutSecboot
+}
+
 func ProvisionTPM(mode TPMProvisionMode, lockoutAuthFile string) error {
 	return errBuildWithoutSecboot
 }
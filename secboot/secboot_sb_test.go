@@ -1064,6 +1064,97 @@ func (s *secbootSuite) TestSealKey(c *C) {
 	}
 }
 
+func (s *secbootSuite) TestSealDeviceBoundKey(c *C) {
+	mockErr := errors.New("some error")
+
+	for idx, tc := range []struct {
+		tpmErr      error
+		tpmEnabled  bool
+		sealErr     error
+		sealCalls   int
+		expectedErr string
+	}{
+		{tpmErr: mockErr, expectedErr: "cannot connect to TPM: some error"},
+		{tpmEnabled: false, expectedErr: "TPM device is not enabled"},
+		{tpmEnabled: true, sealErr: mockErr, sealCalls: 1, expectedErr: "cannot seal key: some error"},
+		{tpmEnabled: true, sealCalls: 1},
+	} {
+		c.Logf("tc: %v", idx)
+		tpm, restore := mockSbTPMConnection(c, tc.tpmErr)
+		defer restore()
+		restore = secboot.MockIsTPMEnabled(func(t *sb_tpm2.Connection) bool {
+			return tc.tpmEnabled
+		})
+		defer restore()
+
+		sealCalls := 0
+		restore = secboot.MockSbSealKeyToTPMMultiple(func(t *sb_tpm2.Connection, kr []*sb_tpm2.SealKeyRequest, params *sb_tpm2.KeyCreationParams) (sb_tpm2.PolicyAuthKey, error) {
+			sealCalls++
+			c.Check(t, Equals, tpm)
+			c.Check(kr, DeepEquals, []*sb_tpm2.SealKeyRequest{{Key: []byte("key"), Path: "/path/to/keyfile"}})
+			// no PCR policy
+			c.Check(params.PCRProfile, DeepEquals, sb_tpm2.NewPCRProtectionProfile())
+			c.Check(params.PCRPolicyCounterHandle, Equals, tpm2.HandleNull)
+			return nil, tc.sealErr
+		})
+		defer restore()
+
+		err := secboot.SealDeviceBoundKey([]byte("key"), "/path/to/keyfile")
+		if tc.expectedErr == "" {
+			c.Check(err, IsNil)
+		} else {
+			c.Check(err, ErrorMatches, tc.expectedErr)
+		}
+		c.Check(sealCalls, Equals, tc.sealCalls)
+	}
+}
+
+func (s *secbootSuite) TestUnsealDeviceBoundKey(c *C) {
+	mockErr := errors.New("some error")
+
+	for idx, tc := range []struct {
+		readErr     error
+		tpmErr      error
+		tpmEnabled  bool
+		unsealErr   error
+		expectedErr string
+	}{
+		{readErr: mockErr, expectedErr: "some error"},
+		{tpmErr: mockErr, expectedErr: "cannot connect to TPM: some error"},
+		{tpmEnabled: false, expectedErr: "TPM device is not enabled"},
+		{tpmEnabled: true, unsealErr: mockErr, expectedErr: "cannot unseal key: some error"},
+		{tpmEnabled: true},
+	} {
+		c.Logf("tc: %v", idx)
+		sko := &sb_tpm2.SealedKeyObject{}
+		restore := secboot.MockSbReadSealedKeyObjectFromFile(func(path string) (*sb_tpm2.SealedKeyObject, error) {
+			c.Check(path, Equals, "/path/to/keyfile")
+			return sko, tc.readErr
+		})
+		defer restore()
+		tpm, restore := mockSbTPMConnection(c, tc.tpmErr)
+		defer restore()
+		restore = secboot.MockIsTPMEnabled(func(t *sb_tpm2.Connection) bool {
+			return tc.tpmEnabled
+		})
+		defer restore()
+		restore = secboot.MockSbSealedKeyObjectUnsealFromTPM(func(k *sb_tpm2.SealedKeyObject, t *sb_tpm2.Connection) ([]byte, sb_tpm2.PolicyAuthKey, error) {
+			c.Check(k, Equals, sko)
+			c.Check(t, Equals, tpm)
+			return []byte("key"), nil, tc.unsealErr
+		})
+		defer restore()
+
+		key, err := secboot.UnsealDeviceBoundKey("/path/to/keyfile")
+		if tc.expectedErr == "" {
+			c.Check(err, IsNil)
+			c.Check(key, DeepEquals, []byte("key"))
+		} else {
+			c.Check(err, ErrorMatches, tc.expectedErr)
+		}
+	}
+}
+
 func (s *secbootSuite) TestResealKey(c *C) {
 	mockErr := errors.New("some error")
 
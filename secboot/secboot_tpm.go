@@ -62,6 +62,7 @@ var (
 	sbSealedKeyObjectRevokeOldPCRProtectionPolicies = (*sb_tpm2.SealedKeyObject).RevokeOldPCRProtectionPolicies
 	sbNewKeyDataFromSealedKeyObjectFile             = sb_tpm2.NewKeyDataFromSealedKeyObjectFile
 	sbReadSealedKeyObjectFromFile                   = sb_tpm2.ReadSealedKeyObjectFromFile
+	sbSealedKeyObjectUnsealFromTPM                  = (*sb_tpm2.SealedKeyObject).UnsealFromTPM
 
 	randutilRandomKernelUUID = randutil.RandomKernelUUID
 
@@ -414,6 +415,58 @@ func SealKeys(keys []SealKeyRequest, params *SealKeysParams) error {
 	return nil
 }
 
+// SealDeviceBoundKey seals the given key to the TPM without any PCR
+// protection policy and stores it in keyFile. Unlike the keys sealed with
+// SealKeys, the key does not depend on the boot chain or the model and never
+// needs to be resealed: it is only bound to the TPM of this device, and
+// anything running on the device, whatever the OS it booted, can unseal it
+// given keyFile. Callers must keep keyFile where only the booted system can
+// read it, such as the encrypted data partition.
+func SealDeviceBoundKey(key []byte, keyFile string) error {
+	tpm, err := sbConnectToDefaultTPM()
+	if err != nil {
+		return fmt.Errorf("cannot connect to TPM: %v", err)
+	}
+	defer tpm.Close()
+	if !isTPMEnabled(tpm) {
+		return fmt.Errorf("TPM device is not enabled")
+	}
+
+	creationParams := sb_tpm2.KeyCreationParams{
+		PCRProfile:             sb_tpm2.NewPCRProtectionProfile(),
+		PCRPolicyCounterHandle: tpm2.HandleNull,
+	}
+	sbKeys := []*sb_tpm2.SealKeyRequest{{Key: key, Path: keyFile}}
+	if _, err := sbSealKeyToTPMMultiple(tpm, sbKeys, &creationParams); err != nil {
+		return fmt.Errorf("cannot seal key: %v", err)
+	}
+	return nil
+}
+
+// UnsealDeviceBoundKey unseals the key sealed with SealDeviceBoundKey in
+// keyFile.
+func UnsealDeviceBoundKey(keyFile string) ([]byte, error) {
+	sealedKeyObject, err := sbReadSealedKeyObjectFromFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tpm, err := sbConnectToDefaultTPM()
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to TPM: %v", err)
+	}
+	defer tpm.Close()
+	if !isTPMEnabled(tpm) {
+		return nil, fmt.Errorf("TPM device is not enabled")
+	}
+
+	key, _, err := sbSealedKeyObjectUnsealFromTPM(sealedKeyObject, tpm)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unseal key: %v", err)
+	}
+	return key, nil
+}
+
 // ResealKeys updates the PCR protection policy for the sealed encryption keys
 // according to the specified parameters.
 func ResealKeys(params *ResealKeysParams) error {
@@ -1386,6 +1386,10 @@ type HookInfo struct {
 	Environment  strutil.OrderedMap
 	CommandChain []string
 
+	// Interval is how often the hook is run periodically, it is only
+	// supported by the check-health hook.
+	Interval timeout.Timeout
+
 	Explicit bool
 }
 
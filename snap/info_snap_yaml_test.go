@@ -1953,6 +1953,19 @@ hooks:
 	c.Check(hook.CommandChain, DeepEquals, []string{"hookchain1", "hookchain2"})
 }
 
+func (s *YamlSuite) TestSnapYamlHookInterval(c *C) {
+	y := []byte(`name: wat
+version: 42
+hooks:
+ check-health:
+  interval: 10m
+`)
+	info, err := snap.InfoFromSnapYaml(y)
+	c.Assert(err, IsNil)
+	hook := info.Hooks["check-health"]
+	c.Check(hook.Interval, Equals, timeout.Timeout(10*time.Minute))
+}
+
 func (s *YamlSuite) TestSnapYamlRestartDelay(c *C) {
 	yAutostart := []byte(`name: wat
 version: 42
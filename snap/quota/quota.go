@@ -60,6 +60,21 @@ type GroupQuotaCPU struct {
 	CPUSet []int `json:"allowed-cpus,omitempty"`
 }
 
+// GroupQuotaIO contains the IO bandwidth limits of a quota group, which apply
+// to the processes of the group accessing a single block device.
+type GroupQuotaIO struct {
+	// Device is the path of the block device the limits apply to.
+	Device string `json:"device"`
+
+	// ReadBandwidth is the maximum number of bytes per second the group can
+	// read from the device. A value of 0 means reads are not limited.
+	ReadBandwidth quantity.Size `json:"read-bandwidth,omitempty"`
+
+	// WriteBandwidth is the maximum number of bytes per second the group can
+	// write to the device. A value of 0 means writes are not limited.
+	WriteBandwidth quantity.Size `json:"write-bandwidth,omitempty"`
+}
+
 // GroupQuotaJournal contains the supported limits for journald. Any limit set here
 // applies only to the quota group itself. Journal limits will not be inherited by the
 // sub-groups as this behaviour is not supported by systemd.
@@ -109,6 +124,10 @@ type Group struct {
 	// ExhaustionBehavior. MemoryLimit is expressed in bytes.
 	MemoryLimit quantity.Size `json:"memory-limit,omitempty"`
 
+	// MemorySwapLimit is the limit of swap space available to the processes
+	// in the group, expressed in bytes. It requires cgroup v2.
+	MemorySwapLimit quantity.Size `json:"memory-swap-limit,omitempty"`
+
 	// CPULimit is the quotas for the cpu and consists of a couple of nubs.
 	// It is possible to control the percentage of the cpu available for the group
 	// and which cores (requires cgroupsv2) are allowed to be used.
@@ -119,6 +138,9 @@ type Group struct {
 	// for processes in the group.
 	ThreadLimit int `json:"task-limit,omitempty"`
 
+	// IOLimit is the IO bandwidth limits of the group, it requires cgroup v2.
+	IOLimit *GroupQuotaIO `json:"io-limit,omitempty"`
+
 	// JournalLimit is the limits that apply to the journal for this quota group. When
 	// this limit is present, then the quota group will be assigned a log namespace for
 	// journald.
@@ -165,6 +187,9 @@ func (grp *Group) GetQuotaResources() Resources {
 	if grp.MemoryLimit != 0 {
 		resourcesBuilder.WithMemoryLimit(grp.MemoryLimit)
 	}
+	if grp.MemorySwapLimit != 0 {
+		resourcesBuilder.WithMemorySwapLimit(grp.MemorySwapLimit)
+	}
 	if grp.CPULimit != nil {
 		if grp.CPULimit.Count != 0 {
 			resourcesBuilder.WithCPUCount(grp.CPULimit.Count)
@@ -179,6 +204,15 @@ func (grp *Group) GetQuotaResources() Resources {
 	if grp.ThreadLimit != 0 {
 		resourcesBuilder.WithThreadLimit(grp.ThreadLimit)
 	}
+	if grp.IOLimit != nil {
+		resourcesBuilder.WithIODevice(grp.IOLimit.Device)
+		if grp.IOLimit.ReadBandwidth != 0 {
+			resourcesBuilder.WithIOReadBandwidth(grp.IOLimit.ReadBandwidth)
+		}
+		if grp.IOLimit.WriteBandwidth != 0 {
+			resourcesBuilder.WithIOWriteBandwidth(grp.IOLimit.WriteBandwidth)
+		}
+	}
 	if grp.JournalLimit != nil {
 		resourcesBuilder.WithJournalNamespace()
 		if grp.JournalLimit.Size != 0 {
@@ -244,6 +278,25 @@ func (grp *Group) CurrentTaskUsage() (int, error) {
 	return int(count), nil
 }
 
+// CurrentCPUUsage returns the total CPU time consumed by the quota group. For
+// quota groups which do not yet have a backing systemd slice on the system
+// (i.e. quota groups without any snaps in them), the CPU usage is reported as 0
+func (grp *Group) CurrentCPUUsage() (time.Duration, error) {
+	sysd := systemd.New(systemd.SystemMode, progress.Null)
+
+	// check if this group is actually active, it could not physically exist yet
+	// since it has no snaps in it
+	isActive, err := sysd.IsActive(grp.SliceFileName())
+	if err != nil {
+		return 0, err
+	}
+	if !isActive {
+		return 0, nil
+	}
+
+	return sysd.CurrentCPUUsage(grp.SliceFileName())
+}
+
 // SliceFileName returns the name of the slice file that should be used for this
 // quota group. This name will include all of the group's parents in the name.
 // For example, a group named "bar" that is a child of the "foo" group will have
@@ -542,6 +595,23 @@ func (grp *Group) validateMemoryResourceFit(allQuotas map[string]*groupQuotaAllo
 	return nil
 }
 
+// validateMemorySwapResourceFit verifies that the new memory-swap limit is not
+// larger than the memory-swap limit of the nearest parent group that has one.
+// Unlike memory, swap is not reserved by sub-groups, as the sub-groups can use
+// the swap space of their parent as long as the parent has some left.
+func (grp *Group) validateMemorySwapResourceFit(swapLimit quantity.Size) error {
+	for parent := grp.parentGroup; parent != nil; parent = parent.parentGroup {
+		if parent.MemorySwapLimit != 0 {
+			if swapLimit > parent.MemorySwapLimit {
+				return fmt.Errorf("sub-group memory-swap limit of %s is too large to fit inside group %q memory-swap limit of %s",
+					swapLimit.IECString(), parent.Name, parent.MemorySwapLimit.IECString())
+			}
+			break
+		}
+	}
+	return nil
+}
+
 // validateCPUResourceFit verifies that the new cpu limit doesn't conflict with the current reserved cpu
 // limit of the group, and if not locates the nearest parent group that has a cpu quota, and then verifies
 // if that group has any space available by checking its 'cpuReserved'. The 'cpuReserved' tells us how much
@@ -736,6 +806,11 @@ func (grp *Group) validateQuotasFit(resourceLimits Resources) error {
 			return err
 		}
 	}
+	if resourceLimits.MemorySwap != nil {
+		if err := grp.validateMemorySwapResourceFit(resourceLimits.MemorySwap.Limit); err != nil {
+			return err
+		}
+	}
 	if resourceLimits.CPU != nil && resourceLimits.CPU.Percentage != 0 {
 		if err := grp.validateCPUResourceFit(allQuotas, resourceLimits); err != nil {
 			return err
@@ -771,6 +846,9 @@ func (grp *Group) UpdateQuotaLimits(resourceLimits Resources) error {
 	if resourceLimits.Memory != nil {
 		grp.MemoryLimit = resourceLimits.Memory.Limit
 	}
+	if resourceLimits.MemorySwap != nil {
+		grp.MemorySwapLimit = resourceLimits.MemorySwap.Limit
+	}
 	if resourceLimits.CPU != nil {
 		grp.CPULimit = &GroupQuotaCPU{
 			Count:      resourceLimits.CPU.Count,
@@ -786,6 +864,13 @@ func (grp *Group) UpdateQuotaLimits(resourceLimits Resources) error {
 	if resourceLimits.Threads != nil {
 		grp.ThreadLimit = resourceLimits.Threads.Limit
 	}
+	if resourceLimits.IO != nil {
+		grp.IOLimit = &GroupQuotaIO{
+			Device:         resourceLimits.IO.Device,
+			ReadBandwidth:  resourceLimits.IO.ReadBandwidth,
+			WriteBandwidth: resourceLimits.IO.WriteBandwidth,
+		}
+	}
 	if resourceLimits.Journal != nil {
 		if grp.JournalLimit == nil {
 			grp.JournalLimit = &GroupQuotaJournal{}
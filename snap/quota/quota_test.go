@@ -1095,6 +1095,42 @@ func (ts *quotaTestSuite) TestCurrentTaskUsage(c *C) {
 	c.Check(systemctlCalls, Equals, 5)
 }
 
+func (ts *quotaTestSuite) TestCurrentCPUUsage(c *C) {
+	systemctlCalls := 0
+	r := systemd.MockSystemctl(func(args ...string) ([]byte, error) {
+		systemctlCalls++
+		switch systemctlCalls {
+		case 1:
+			// first time pretend the slice is inactive
+			c.Assert(args, DeepEquals, []string{"is-active", "snap.group.slice"})
+			return []byte("inactive"), systemctlInactiveServiceError{}
+		case 2:
+			c.Assert(args, DeepEquals, []string{"is-active", "snap.group.slice"})
+			return []byte("active"), nil
+		case 3:
+			c.Assert(args, DeepEquals, []string{"show", "--property", "CPUUsageNSec", "snap.group.slice"})
+			return []byte("CPUUsageNSec=2500000000"), nil
+		default:
+			c.Errorf("unexpected number of systemctl calls (%d) (current call is %+v)", systemctlCalls, args)
+			return []byte("broken test"), fmt.Errorf("broken test")
+		}
+	})
+	defer r()
+
+	grp1, err := quota.NewGroup("group", quota.NewResourcesBuilder().WithCPUPercentage(50).Build())
+	c.Assert(err, IsNil)
+
+	// group initially is inactive, so it has no CPU usage
+	cpuUsage, err := grp1.CurrentCPUUsage()
+	c.Check(err, IsNil)
+	c.Check(cpuUsage, Equals, time.Duration(0))
+
+	cpuUsage, err = grp1.CurrentCPUUsage()
+	c.Check(err, IsNil)
+	c.Check(cpuUsage, Equals, 2500*time.Millisecond)
+	c.Check(systemctlCalls, Equals, 3)
+}
+
 func (ts *quotaTestSuite) TestGetGroupQuotaAllocations(c *C) {
 	// Verify we get the correct allocations for a group with a more complex tree-structure
 	// and different quotas split out into different sub-groups.
@@ -1569,6 +1605,39 @@ func (ts *quotaTestSuite) TestJournalQuotasUpdatesCorrectly(c *C) {
 	c.Check(grp1.JournalLimit.RatePeriod, Equals, time.Microsecond*5)
 }
 
+func (ts *quotaTestSuite) TestMemorySwapAndIOQuotasSetCorrectly(c *C) {
+	grp, err := quota.NewGroup("groot", quota.NewResourcesBuilder().
+		WithMemorySwapLimit(quantity.SizeGiB).
+		WithIODevice("/dev/sda").WithIOReadBandwidth(10*quantity.SizeMiB).Build())
+	c.Assert(err, IsNil)
+	c.Check(grp.MemorySwapLimit, Equals, quantity.SizeGiB)
+	c.Check(grp.IOLimit, DeepEquals, &quota.GroupQuotaIO{Device: "/dev/sda", ReadBandwidth: 10 * quantity.SizeMiB})
+
+	resources := grp.GetQuotaResources()
+	c.Check(resources, DeepEquals, quota.NewResourcesBuilder().
+		WithMemorySwapLimit(quantity.SizeGiB).
+		WithIODevice("/dev/sda").WithIOReadBandwidth(10*quantity.SizeMiB).Build())
+
+	c.Assert(resources.Change(quota.NewResourcesBuilder().WithIODevice("/dev/sda").WithIOWriteBandwidth(quantity.SizeMiB).Build()), IsNil)
+	c.Assert(grp.UpdateQuotaLimits(resources), IsNil)
+	c.Check(grp.IOLimit, DeepEquals, &quota.GroupQuotaIO{Device: "/dev/sda", ReadBandwidth: 10 * quantity.SizeMiB, WriteBandwidth: quantity.SizeMiB})
+}
+
+func (ts *quotaTestSuite) TestNestingOfMemorySwapLimits(c *C) {
+	grp, err := quota.NewGroup("groot", quota.NewResourcesBuilder().WithMemorySwapLimit(quantity.SizeGiB).Build())
+	c.Assert(err, IsNil)
+
+	subgrp, err := grp.NewSubGroup("mem-sub", quota.NewResourcesBuilder().WithMemoryLimit(quantity.SizeGiB).Build())
+	c.Assert(err, IsNil)
+
+	// siblings can each use up to the swap limit of the parent
+	_, err = grp.NewSubGroup("swap-sub", quota.NewResourcesBuilder().WithMemorySwapLimit(quantity.SizeGiB).Build())
+	c.Check(err, IsNil)
+
+	_, err = subgrp.NewSubGroup("swap-sub-sub", quota.NewResourcesBuilder().WithMemorySwapLimit(2*quantity.SizeGiB).Build())
+	c.Check(err, ErrorMatches, `sub-group memory-swap limit of 2 GiB is too large to fit inside group "groot" memory-swap limit of 1 GiB`)
+}
+
 func (ts *quotaTestSuite) TestServiceMapEmptyOnEmptyGroup(c *C) {
 	rootGrp, err := quota.NewGroup("myroot", quota.NewResourcesBuilder().WithMemoryLimit(quantity.SizeGiB).Build())
 	c.Assert(err, IsNil)
@@ -21,6 +21,8 @@ package quota
 
 import (
 	"fmt"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/snapcore/snapd/gadget/quantity"
@@ -43,6 +45,10 @@ type ResourceMemory struct {
 	Limit quantity.Size `json:"limit"`
 }
 
+type ResourceMemorySwap struct {
+	Limit quantity.Size `json:"limit"`
+}
+
 type ResourceCPU struct {
 	Count      int `json:"count"`
 	Percentage int `json:"percentage"`
@@ -66,6 +72,15 @@ type ResourceJournalRate struct {
 	Period time.Duration `json:"period"`
 }
 
+// ResourceIO represents the IO bandwidth quotas, which apply to a single
+// block device. The bandwidths are expressed in bytes per second, a zero
+// value means that direction is not limited.
+type ResourceIO struct {
+	Device         string        `json:"device"`
+	ReadBandwidth  quantity.Size `json:"read-bandwidth,omitempty"`
+	WriteBandwidth quantity.Size `json:"write-bandwidth,omitempty"`
+}
+
 // ResourceJournal represents the available journal quotas. It's structured
 // a bit different compared to the other resources to support namespace only
 // cases, where the existence of != nil ResourceJournal with empty values
@@ -79,11 +94,13 @@ type ResourceJournal struct {
 // value to indicate that their presence may be optional, and because we want to detect
 // whenever someone changes a limit to '0' explicitly.
 type Resources struct {
-	Memory  *ResourceMemory  `json:"memory,omitempty"`
-	CPU     *ResourceCPU     `json:"cpu,omitempty"`
-	CPUSet  *ResourceCPUSet  `json:"cpu-set,omitempty"`
-	Threads *ResourceThreads `json:"thread,omitempty"`
-	Journal *ResourceJournal `json:"journal,omitempty"`
+	Memory     *ResourceMemory     `json:"memory,omitempty"`
+	MemorySwap *ResourceMemorySwap `json:"memory-swap,omitempty"`
+	CPU        *ResourceCPU        `json:"cpu,omitempty"`
+	CPUSet     *ResourceCPUSet     `json:"cpu-set,omitempty"`
+	Threads    *ResourceThreads    `json:"thread,omitempty"`
+	IO         *ResourceIO         `json:"io,omitempty"`
+	Journal    *ResourceJournal    `json:"journal,omitempty"`
 }
 
 const (
@@ -109,6 +126,13 @@ func (qr *Resources) validateMemoryQuota() error {
 	return nil
 }
 
+func (qr *Resources) validateMemorySwapQuota() error {
+	if qr.MemorySwap.Limit == 0 {
+		return fmt.Errorf("memory-swap quota must have a limit set")
+	}
+	return nil
+}
+
 func cpuFitsIntoCPUSet(count, percentage int, cpuSet []int) error {
 	if len(cpuSet) > 0 && count != 0 {
 		maxCPUUsage := len(cpuSet) * 100
@@ -160,6 +184,19 @@ func (qr *Resources) validateThreadQuota() error {
 	return nil
 }
 
+func (qr *Resources) validateIOQuota() error {
+	// the device is written as is to the slice, make sure it is a proper
+	// device node path
+	device := qr.IO.Device
+	if !strings.HasPrefix(device, "/dev/") || filepath.Clean(device) != device || strings.ContainsAny(device, " \t\n") {
+		return fmt.Errorf("io quota must have a block device path under /dev, not %q", device)
+	}
+	if qr.IO.ReadBandwidth == 0 && qr.IO.WriteBandwidth == 0 {
+		return fmt.Errorf("io quota must have a read or write bandwidth limit set")
+	}
+	return nil
+}
+
 func (qr *Resources) validateJournalQuota() error {
 	// Journal quota is a bit different than the rest, we allow nil values
 	// for the size and rate, because this means that the only 'quota' we want
@@ -191,12 +228,30 @@ func (qr *Resources) validateJournalQuota() error {
 //
 // E.g. a CPUSet only only be set set on systems with cgroup v2.
 func (qr *Resources) CheckFeatureRequirements() error {
-	if qr.CPUSet != nil {
+	checkCgroupV2 := func(what string) error {
 		if cgroupVerErr != nil {
 			return cgroupVerErr
 		}
 		if cgroupVer < 2 {
-			return fmt.Errorf("cannot use CPU set with cgroup version %d", cgroupVer)
+			return fmt.Errorf("cannot use %s with cgroup version %d", what, cgroupVer)
+		}
+		return nil
+	}
+	if qr.CPUSet != nil {
+		if err := checkCgroupV2("CPU set"); err != nil {
+			return err
+		}
+	}
+	// systemd only supports swap and IO bandwidth limits on the unified
+	// hierarchy
+	if qr.MemorySwap != nil {
+		if err := checkCgroupV2("memory-swap quota"); err != nil {
+			return err
+		}
+	}
+	if qr.IO != nil {
+		if err := checkCgroupV2("io quota"); err != nil {
+			return err
 		}
 	}
 	if qr.Memory != nil && cgroupCheckMemoryCgroupErr != nil {
@@ -228,6 +283,12 @@ func (qr *Resources) Validate() error {
 		}
 	}
 
+	if qr.MemorySwap != nil {
+		if err := qr.validateMemorySwapQuota(); err != nil {
+			return err
+		}
+	}
+
 	if qr.CPU != nil {
 		if err := qr.validateCPUQuota(); err != nil {
 			return err
@@ -246,6 +307,12 @@ func (qr *Resources) Validate() error {
 		}
 	}
 
+	if qr.IO != nil {
+		if err := qr.validateIOQuota(); err != nil {
+			return err
+		}
+	}
+
 	if qr.Journal != nil {
 		if err := qr.validateJournalQuota(); err != nil {
 			return err
@@ -280,6 +347,12 @@ func (qr *Resources) ValidateChange(newLimits Resources) error {
 		}
 	}
 
+	// Check that the memory-swap limit is not being removed, unlike the
+	// memory limit it can be lowered as systemd applies it right away
+	if qr.MemorySwap != nil && newLimits.MemorySwap != nil && newLimits.MemorySwap.Limit == 0 {
+		return fmt.Errorf("cannot remove memory-swap limit from quota group")
+	}
+
 	// Check that the cpu limit is not being removed, and we want to verify the new limit
 	// is valid.
 	if qr.CPU != nil && newLimits.CPU != nil {
@@ -332,6 +405,17 @@ func (qr *Resources) ValidateChange(newLimits Resources) error {
 		}
 	}
 
+	// Check that the io limits are not being removed, changing the limits for
+	// the same device keeps the bandwidth limits that are not given
+	if qr.IO != nil && newLimits.IO != nil {
+		if newLimits.IO.Device == qr.IO.Device {
+			if (qr.IO.ReadBandwidth != 0 || qr.IO.WriteBandwidth != 0) &&
+				newLimits.IO.ReadBandwidth == 0 && newLimits.IO.WriteBandwidth == 0 {
+				return fmt.Errorf("cannot remove io limits from quota group")
+			}
+		}
+	}
+
 	// Verify journal limits not being removed
 	if qr.Journal != nil && newLimits.Journal != nil {
 		if qr.Journal.Size != nil && newLimits.Journal.Size != nil && newLimits.Journal.Size.Limit == 0 {
@@ -356,6 +440,9 @@ func (qr *Resources) clone() Resources {
 	if qr.Memory != nil {
 		resourcesCopy.Memory = &ResourceMemory{Limit: qr.Memory.Limit}
 	}
+	if qr.MemorySwap != nil {
+		resourcesCopy.MemorySwap = &ResourceMemorySwap{Limit: qr.MemorySwap.Limit}
+	}
 	if qr.CPU != nil {
 		resourcesCopy.CPU = &ResourceCPU{Count: qr.CPU.Count, Percentage: qr.CPU.Percentage}
 	}
@@ -365,6 +452,9 @@ func (qr *Resources) clone() Resources {
 	if qr.Threads != nil {
 		resourcesCopy.Threads = &ResourceThreads{Limit: qr.Threads.Limit}
 	}
+	if qr.IO != nil {
+		resourcesCopy.IO = &ResourceIO{Device: qr.IO.Device, ReadBandwidth: qr.IO.ReadBandwidth, WriteBandwidth: qr.IO.WriteBandwidth}
+	}
 	if qr.Journal != nil {
 		resourcesCopy.Journal = &ResourceJournal{}
 		if qr.Journal.Size != nil {
@@ -382,6 +472,9 @@ func (qr *Resources) changeInternal(newLimits Resources) {
 	if newLimits.Memory != nil {
 		qr.Memory = newLimits.Memory
 	}
+	if newLimits.MemorySwap != nil {
+		qr.MemorySwap = newLimits.MemorySwap
+	}
 	if newLimits.CPU != nil {
 		qr.CPU = newLimits.CPU
 	}
@@ -391,6 +484,17 @@ func (qr *Resources) changeInternal(newLimits Resources) {
 	if newLimits.Threads != nil {
 		qr.Threads = newLimits.Threads
 	}
+	if newLimits.IO != nil {
+		if qr.IO == nil || qr.IO.Device != newLimits.IO.Device {
+			qr.IO = &ResourceIO{Device: newLimits.IO.Device}
+		}
+		if newLimits.IO.ReadBandwidth != 0 {
+			qr.IO.ReadBandwidth = newLimits.IO.ReadBandwidth
+		}
+		if newLimits.IO.WriteBandwidth != 0 {
+			qr.IO.WriteBandwidth = newLimits.IO.WriteBandwidth
+		}
+	}
 	if newLimits.Journal != nil {
 		if qr.Journal == nil {
 			qr.Journal = &ResourceJournal{}
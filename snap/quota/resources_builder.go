@@ -29,6 +29,9 @@ type ResourcesBuilder struct {
 	MemoryLimit    quantity.Size
 	MemoryLimitSet bool
 
+	MemorySwapLimit    quantity.Size
+	MemorySwapLimitSet bool
+
 	CPUCount    int
 	CPUCountSet bool
 
@@ -41,6 +44,15 @@ type ResourcesBuilder struct {
 	ThreadLimit    int
 	ThreadLimitSet bool
 
+	IODevice    string
+	IODeviceSet bool
+
+	IOReadBandwidth    quantity.Size
+	IOReadBandwidthSet bool
+
+	IOWriteBandwidth    quantity.Size
+	IOWriteBandwidthSet bool
+
 	JournalNamespaceSet bool
 
 	JournalSizeLimit    quantity.Size
@@ -57,6 +69,12 @@ func (rb *ResourcesBuilder) WithMemoryLimit(limit quantity.Size) *ResourcesBuild
 	return rb
 }
 
+func (rb *ResourcesBuilder) WithMemorySwapLimit(limit quantity.Size) *ResourcesBuilder {
+	rb.MemorySwapLimit = limit
+	rb.MemorySwapLimitSet = true
+	return rb
+}
+
 func (rb *ResourcesBuilder) WithCPUCount(count int) *ResourcesBuilder {
 	rb.CPUCount = count
 	rb.CPUCountSet = true
@@ -81,6 +99,24 @@ func (rb *ResourcesBuilder) WithThreadLimit(limit int) *ResourcesBuilder {
 	return rb
 }
 
+func (rb *ResourcesBuilder) WithIODevice(device string) *ResourcesBuilder {
+	rb.IODevice = device
+	rb.IODeviceSet = true
+	return rb
+}
+
+func (rb *ResourcesBuilder) WithIOReadBandwidth(bandwidth quantity.Size) *ResourcesBuilder {
+	rb.IOReadBandwidth = bandwidth
+	rb.IOReadBandwidthSet = true
+	return rb
+}
+
+func (rb *ResourcesBuilder) WithIOWriteBandwidth(bandwidth quantity.Size) *ResourcesBuilder {
+	rb.IOWriteBandwidth = bandwidth
+	rb.IOWriteBandwidthSet = true
+	return rb
+}
+
 func (rb *ResourcesBuilder) WithJournalNamespace() *ResourcesBuilder {
 	rb.JournalNamespaceSet = true
 	return rb
@@ -106,6 +142,11 @@ func (rb *ResourcesBuilder) Build() Resources {
 			Limit: rb.MemoryLimit,
 		}
 	}
+	if rb.MemorySwapLimitSet {
+		quotaResources.MemorySwap = &ResourceMemorySwap{
+			Limit: rb.MemorySwapLimit,
+		}
+	}
 	if rb.CPUCountSet || rb.CPUPercentageSet {
 		quotaResources.CPU = &ResourceCPU{
 			Count:      rb.CPUCount,
@@ -122,6 +163,13 @@ func (rb *ResourcesBuilder) Build() Resources {
 			Limit: rb.ThreadLimit,
 		}
 	}
+	if rb.IODeviceSet || rb.IOReadBandwidthSet || rb.IOWriteBandwidthSet {
+		quotaResources.IO = &ResourceIO{
+			Device:         rb.IODevice,
+			ReadBandwidth:  rb.IOReadBandwidth,
+			WriteBandwidth: rb.IOWriteBandwidth,
+		}
+	}
 	if rb.JournalNamespaceSet || rb.JournalSizeLimitSet || rb.JournalRateSet {
 		quotaResources.Journal = &ResourceJournal{}
 		if rb.JournalSizeLimitSet {
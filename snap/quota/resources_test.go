@@ -50,6 +50,12 @@ func (s *resourcesTestSuite) TestQuotaValidationFails(c *C) {
 		{quota.NewResourcesBuilder().WithJournalRate(0, 1).Build(), `journal quota must have a period of at least 1 microsecond \(minimum resolution\)`},
 		{quota.NewResourcesBuilder().WithJournalRate(1, time.Nanosecond).Build(), `journal quota must have a period of at least 1 microsecond \(minimum resolution\)`},
 		{quota.NewResourcesBuilder().WithJournalSize(0).Build(), `journal size quota must have a limit set`},
+		{quota.NewResourcesBuilder().WithMemorySwapLimit(0).Build(), `memory-swap quota must have a limit set`},
+		{quota.NewResourcesBuilder().WithIODevice("/dev/sda").Build(), `io quota must have a read or write bandwidth limit set`},
+		{quota.NewResourcesBuilder().WithIOReadBandwidth(quantity.SizeMiB).Build(), `io quota must have a block device path under /dev, not ""`},
+		{quota.NewResourcesBuilder().WithIODevice("sda").WithIOReadBandwidth(quantity.SizeMiB).Build(), `io quota must have a block device path under /dev, not "sda"`},
+		{quota.NewResourcesBuilder().WithIODevice("/dev/../etc/passwd").WithIOReadBandwidth(quantity.SizeMiB).Build(), `io quota must have a block device path under /dev, not "/dev/../etc/passwd"`},
+		{quota.NewResourcesBuilder().WithIODevice("/dev/sda 1").WithIOReadBandwidth(quantity.SizeMiB).Build(), `io quota must have a block device path under /dev, not "/dev/sda 1"`},
 	}
 
 	for _, t := range tests {
@@ -69,6 +75,20 @@ func (s *resourcesTestSuite) TestResourceCheckFeatureRequirementsCgroupv1(c *C)
 	// cpu set with cgroup v1 is not supported
 	bad := quota.NewResourcesBuilder().WithCPUSet([]int{0, 1}).Build()
 	c.Check(bad.CheckFeatureRequirements(), ErrorMatches, "cannot use CPU set with cgroup version 1")
+
+	// neither are swap and io limits
+	bad = quota.NewResourcesBuilder().WithMemorySwapLimit(quantity.SizeGiB).Build()
+	c.Check(bad.CheckFeatureRequirements(), ErrorMatches, "cannot use memory-swap quota with cgroup version 1")
+	bad = quota.NewResourcesBuilder().WithIODevice("/dev/sda").WithIOReadBandwidth(quantity.SizeMiB).Build()
+	c.Check(bad.CheckFeatureRequirements(), ErrorMatches, "cannot use io quota with cgroup version 1")
+}
+
+func (s *resourcesTestSuite) TestResourceCheckFeatureRequirementsCgroupv2(c *C) {
+	r := quota.MockCgroupVer(2)
+	defer r()
+
+	good := quota.NewResourcesBuilder().WithMemorySwapLimit(quantity.SizeGiB).WithIODevice("/dev/sda").WithIOWriteBandwidth(quantity.SizeMiB).Build()
+	c.Check(good.CheckFeatureRequirements(), IsNil)
 }
 
 func (s *resourcesTestSuite) TestResourceCheckFeatureRequirementsCgroupv1Err(c *C) {
@@ -95,6 +115,9 @@ func (s *resourcesTestSuite) TestQuotaValidationPasses(c *C) {
 		{quota.NewResourcesBuilder().WithJournalSize(quantity.SizeMiB).Build()},
 		{quota.NewResourcesBuilder().WithJournalRate(1, time.Microsecond).Build()},
 		{quota.NewResourcesBuilder().WithJournalNamespace().Build()},
+		{quota.NewResourcesBuilder().WithMemorySwapLimit(quantity.SizeGiB).Build()},
+		{quota.NewResourcesBuilder().WithIODevice("/dev/sda").WithIOReadBandwidth(quantity.SizeMiB).Build()},
+		{quota.NewResourcesBuilder().WithIODevice("/dev/disk/by-id/nvme-1").WithIOWriteBandwidth(quantity.SizeMiB).Build()},
 	}
 
 	for _, t := range tests {
@@ -124,6 +147,21 @@ func (s *resourcesTestSuite) TestQuotaChangeValidationFails(c *C) {
 			quota.NewResourcesBuilder().WithMemoryLimit(800 * quantity.SizeKiB).Build(),
 			`cannot decrease memory limit, remove and re-create it to decrease the limit`,
 		},
+		{
+			quota.NewResourcesBuilder().WithMemorySwapLimit(quantity.SizeGiB).Build(),
+			quota.NewResourcesBuilder().WithMemorySwapLimit(0).Build(),
+			`cannot remove memory-swap limit from quota group`,
+		},
+		{
+			quota.NewResourcesBuilder().WithIODevice("/dev/sda").WithIOReadBandwidth(quantity.SizeMiB).Build(),
+			quota.NewResourcesBuilder().WithIODevice("/dev/sda").Build(),
+			`cannot remove io limits from quota group`,
+		},
+		{
+			quota.NewResourcesBuilder().WithIODevice("/dev/sda").WithIOReadBandwidth(quantity.SizeMiB).Build(),
+			quota.NewResourcesBuilder().WithIODevice("/dev/sdb").Build(),
+			`io quota must have a read or write bandwidth limit set`,
+		},
 		{
 			quota.NewResourcesBuilder().WithThreadLimit(64).Build(),
 			quota.NewResourcesBuilder().WithThreadLimit(0).Build(),
@@ -303,6 +341,28 @@ func (s *resourcesTestSuite) TestQuotaChangeValidationPasses(c *C) {
 			quota.NewResourcesBuilder().WithJournalNamespace().Build(),
 			quota.NewResourcesBuilder().WithCPUCount(4).WithCPUPercentage(25).WithJournalNamespace().Build(),
 		},
+		{
+			quota.NewResourcesBuilder().WithMemorySwapLimit(quantity.SizeGiB).Build(),
+			quota.NewResourcesBuilder().WithMemorySwapLimit(quantity.SizeMiB).Build(),
+			quota.NewResourcesBuilder().WithMemorySwapLimit(quantity.SizeMiB).Build(),
+		},
+		{
+			quota.NewResourcesBuilder().WithMemoryLimit(quantity.SizeGiB).Build(),
+			quota.NewResourcesBuilder().WithMemorySwapLimit(quantity.SizeGiB).Build(),
+			quota.NewResourcesBuilder().WithMemoryLimit(quantity.SizeGiB).WithMemorySwapLimit(quantity.SizeGiB).Build(),
+		},
+		{
+			// the limits not given for the same device are kept
+			quota.NewResourcesBuilder().WithIODevice("/dev/sda").WithIOReadBandwidth(quantity.SizeMiB).Build(),
+			quota.NewResourcesBuilder().WithIODevice("/dev/sda").WithIOWriteBandwidth(2 * quantity.SizeMiB).Build(),
+			quota.NewResourcesBuilder().WithIODevice("/dev/sda").WithIOReadBandwidth(quantity.SizeMiB).WithIOWriteBandwidth(2 * quantity.SizeMiB).Build(),
+		},
+		{
+			// but not when moving the limits to another device
+			quota.NewResourcesBuilder().WithIODevice("/dev/sda").WithIOReadBandwidth(quantity.SizeMiB).Build(),
+			quota.NewResourcesBuilder().WithIODevice("/dev/sdb").WithIOWriteBandwidth(2 * quantity.SizeMiB).Build(),
+			quota.NewResourcesBuilder().WithIODevice("/dev/sdb").WithIOWriteBandwidth(2 * quantity.SizeMiB).Build(),
+		},
 	}
 
 	for _, t := range tests {
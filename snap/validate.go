@@ -29,6 +29,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/snapcore/snapd/osutil"
@@ -178,6 +179,10 @@ func validateHooks(info *Info) error {
 	return nil
 }
 
+// minCheckHealthInterval is the shortest interval at which the check-health
+// hook can be run periodically.
+const minCheckHealthInterval = time.Minute
+
 // ValidateHook validates the content of the given HookInfo
 func ValidateHook(hook *HookInfo) error {
 	if err := naming.ValidateHook(hook.Name); err != nil {
@@ -191,6 +196,15 @@ func ValidateHook(hook *HookInfo) error {
 		}
 	}
 
+	if hook.Interval != 0 {
+		if hook.Name != "check-health" || hook.Component != nil {
+			return fmt.Errorf("cannot specify an interval for hook %q, only the check-health hook can be run periodically", hook.Name)
+		}
+		if time.Duration(hook.Interval) < minCheckHealthInterval {
+			return fmt.Errorf("check-health hook interval must be at least %v, not %v", minCheckHealthInterval, hook.Interval)
+		}
+	}
+
 	return nil
 }
 
@@ -25,6 +25,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	. "gopkg.in/check.v1"
@@ -34,6 +35,7 @@ import (
 	"github.com/snapcore/snapd/overlord/snapstate"
 	. "github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/testutil"
+	"github.com/snapcore/snapd/timeout"
 )
 
 type ValidateSuite struct {
@@ -175,6 +177,17 @@ func (s *ValidateSuite) TestValidateHook(c *C) {
 	}
 }
 
+func (s *ValidateSuite) TestValidateHookInterval(c *C) {
+	hook := &HookInfo{Name: "check-health", Interval: timeout.Timeout(5 * time.Minute)}
+	c.Check(ValidateHook(hook), IsNil)
+
+	hook.Interval = timeout.Timeout(time.Second)
+	c.Check(ValidateHook(hook), ErrorMatches, `check-health hook interval must be at least 1m0s, not 1s`)
+
+	hook = &HookInfo{Name: "configure", Interval: timeout.Timeout(5 * time.Minute)}
+	c.Check(ValidateHook(hook), ErrorMatches, `cannot specify an interval for hook "configure", only the check-health hook can be run periodically`)
+}
+
 // ValidateApp
 
 func (s *ValidateSuite) TestValidateAppSockets(c *C) {
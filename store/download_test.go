@@ -413,11 +413,11 @@ func (s *downloadSuite) TestUseDeltas(c *C) {
 
 		wantDelta bool
 	}{
-		{env: "", classic: false, exeInHost: false, exeInCore: false, wantDelta: false},
+		{env: "", classic: false, exeInHost: false, exeInCore: false, wantDelta: true},
 		{env: "", classic: false, exeInHost: false, exeInCore: true, wantDelta: true},
 		{env: "", classic: false, exeInHost: true, exeInCore: false, wantDelta: true},
 		{env: "", classic: false, exeInHost: true, exeInCore: true, wantDelta: true},
-		{env: "", classic: true, exeInHost: false, exeInCore: false, wantDelta: false},
+		{env: "", classic: true, exeInHost: false, exeInCore: false, wantDelta: true},
 		{env: "", classic: true, exeInHost: false, exeInCore: true, wantDelta: true},
 		{env: "", classic: true, exeInHost: true, exeInCore: false, wantDelta: true},
 		{env: "", classic: true, exeInHost: true, exeInCore: true, wantDelta: true},
@@ -431,11 +431,11 @@ func (s *downloadSuite) TestUseDeltas(c *C) {
 		{env: "0", classic: true, exeInHost: true, exeInCore: false, wantDelta: false},
 		{env: "0", classic: true, exeInHost: true, exeInCore: true, wantDelta: false},
 
-		{env: "1", classic: false, exeInHost: false, exeInCore: false, wantDelta: false},
+		{env: "1", classic: false, exeInHost: false, exeInCore: false, wantDelta: true},
 		{env: "1", classic: false, exeInHost: false, exeInCore: true, wantDelta: true},
 		{env: "1", classic: false, exeInHost: true, exeInCore: false, wantDelta: true},
 		{env: "1", classic: false, exeInHost: true, exeInCore: true, wantDelta: true},
-		{env: "1", classic: true, exeInHost: false, exeInCore: false, wantDelta: false},
+		{env: "1", classic: true, exeInHost: false, exeInCore: false, wantDelta: true},
 		{env: "1", classic: true, exeInHost: false, exeInCore: true, wantDelta: true},
 		{env: "1", classic: true, exeInHost: true, exeInCore: false, wantDelta: true},
 		{env: "1", classic: true, exeInHost: true, exeInCore: true, wantDelta: true},
@@ -581,14 +581,14 @@ func (s *downloadSuite) TestUseDeltas(c *C) {
 				// and args are passed to the command cached too
 				expArgs := []string{hostXdelta3Cmd.Exe(), "foo", "bar"}
 				c.Check(sto.Xdelta3Cmd("foo", "bar").Args, DeepEquals, expArgs, comment)
+			} else {
+				// without any xdelta3 the built-in decoder is used
+				c.Check(sto.UsesBuiltinDeltaDecoder(), Equals, true, comment)
 			}
 		} else {
 			// quick check that the test case makes sense, if we didn't want
-			// deltas, the scenario should have either disabled via an env var,
-			// or had both exes missing
-			c.Assert((scenario.env == "0") ||
-				(!scenario.exeInCore && !scenario.exeInHost),
-				Equals, true)
+			// deltas, the scenario should have disabled them via an env var
+			c.Assert(scenario.env, Equals, "0")
 		}
 
 		// cleanup for the next iteration
@@ -687,6 +687,50 @@ func (s *downloadSuite) TestDownloadWithDelta(c *C) {
 	}
 }
 
+func (s *downloadSuite) TestDownloadWithDeltaStats(c *C) {
+	origUseDeltas := os.Getenv("SNAPD_USE_DELTAS_EXPERIMENTAL")
+	defer os.Setenv("SNAPD_USE_DELTAS_EXPERIMENTAL", origUseDeltas)
+	c.Assert(os.Setenv("SNAPD_USE_DELTAS_EXPERIMENTAL", "1"), IsNil)
+
+	restore := store.MockDownload(func(ctx context.Context, name, sha3, url string, user *auth.UserState, s *store.Store, w io.ReadWriteSeeker, resume int64, pbar progress.Meter, dlOpts *store.DownloadOptions) error {
+		w.Write([]byte(url + "-content"))
+		return nil
+	})
+	defer restore()
+	applyErr := error(nil)
+	restore = store.MockApplyDelta(func(_ *store.Store, name string, deltaPath string, deltaInfo *snap.DeltaInfo, targetPath string, targetSha3_384 string) error {
+		if applyErr != nil {
+			return applyErr
+		}
+		return os.WriteFile(targetPath, []byte("snap-content-via-delta"), 0644)
+	})
+	defer restore()
+
+	info := snap.DownloadInfo{
+		DownloadURL: "full-snap-url",
+		Size:        1000,
+		Deltas: []snap.DeltaInfo{
+			{DownloadURL: "delta-url", Format: "xdelta3", Size: 100},
+		},
+	}
+
+	theStore := store.New(&store.Config{}, nil)
+	c.Check(theStore.DeltaStats(), Equals, store.DeltaStats{})
+
+	for i := 0; i < 2; i++ {
+		path := filepath.Join(c.MkDir(), "downloaded-file")
+		c.Assert(theStore.Download(context.TODO(), "foo", path, &info, nil, nil, nil), IsNil)
+		c.Check(path, testutil.FileEquals, "snap-content-via-delta")
+	}
+	c.Check(theStore.DeltaStats(), Equals, store.DeltaStats{Applied: 2, BytesSaved: 1800})
+
+	applyErr = errors.New("boom")
+	path := filepath.Join(c.MkDir(), "downloaded-file")
+	c.Assert(theStore.Download(context.TODO(), "foo", path, &info, nil, nil, nil), IsNil)
+	c.Check(path, testutil.FileEquals, "full-snap-url-content")
+	c.Check(theStore.DeltaStats(), Equals, store.DeltaStats{Applied: 2, Failed: 1, BytesSaved: 1800})
+}
+
 func (s *downloadSuite) TestActualDownloadRateLimited(c *C) {
 	var ratelimitReaderUsed bool
 	restore := store.MockRatelimitReader(func(r io.Reader, bucket *ratelimit.Bucket) io.Reader {
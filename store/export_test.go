@@ -225,6 +225,10 @@ func (sto *Store) Xdelta3Cmd(args ...string) *exec.Cmd {
 	return sto.xdelta3CmdFunc(args...)
 }
 
+func (sto *Store) UsesBuiltinDeltaDecoder() bool {
+	return sto.xdelta3CmdFunc == nil
+}
+
 func (cfg *Config) SetBaseURL(u *url.URL) error {
 	return cfg.setBaseURL(u)
 }
@@ -262,3 +266,11 @@ type (
 )
 
 var ReportFetchAssertionsError = reportFetchAssertionsError
+
+func MockMirrorReadSnapInfo(f func(fn string, si *snap.SideInfo) (*snap.Info, error)) (restore func()) {
+	return testutil.Mock(&mirrorReadSnapInfo, f)
+}
+
+func MockTimeNow(f func() time.Time) (restore func()) {
+	return testutil.Mock(&timeNow, f)
+}
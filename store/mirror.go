@@ -0,0 +1,807 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2024 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package store
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/channel"
+	"github.com/snapcore/snapd/snap/snapfile"
+)
+
+const (
+	mirrorDownloadPath = "download"
+	mirrorChannelsFile = "channels.json"
+)
+
+// mirrorRisks lists the channel risks from the least to the most risky one.
+var mirrorRisks = []string{"stable", "candidate", "beta", "edge"}
+
+// Mirror serves the subset of the store API used by snapd to install and
+// refresh snaps (snap actions, downloads and assertions) from a local
+// directory, so that devices on an isolated network can use a peer as their
+// store. The directory holds snap files and the assertions for them, as
+// written by "snap download", i.e. <name>_<rev>.snap and <name>_<rev>.assert.
+// Only snaps with a snap-revision and snap-declaration are served.
+//
+// The revisions released to each channel are listed in an optional
+// channels.json file in the directory, mapping snap names to channels and the
+// revision released to them, e.g. {"foo": {"latest/stable": 2, "2.0/edge": 5}}.
+// Snaps which are not listed have their newest revision released to
+// latest/stable. As with the store, a channel without a release falls back to
+// the less risky channels of the same track, and the newest revision up to the
+// released one which can read the data of the snap's current epoch is served.
+//
+// The mirror doesn't authenticate its clients: anyone who can reach it can
+// download the snaps it serves. Device sessions are handed out without
+// verifying the device, so they carry no credentials. Devices rely on the
+// store signed assertions served alongside the snaps to check their integrity.
+type Mirror struct {
+	bs asserts.Backstore
+
+	// snaps maps snap IDs to the available revisions, in ascending order.
+	snaps map[string][]*mirrorSnap
+	// snapIDs maps snap names to their snap IDs.
+	snapIDs map[string]string
+	// files maps the base names of snap files to the corresponding snaps.
+	files map[string]*mirrorSnap
+	// channels maps snap names to their channels, by full channel name, and
+	// the revision released to them.
+	channels map[string]map[string]int
+
+	mux *http.ServeMux
+}
+
+// mirrorSnap holds the details of a snap file in the mirror's directory.
+type mirrorSnap struct {
+	path      string
+	info      *snap.Info
+	snapID    string
+	revision  int
+	sha3_384  string
+	size      uint64
+	publisher snap.StoreAccount
+	createdAt time.Time
+}
+
+// NewMirror returns a Mirror serving the snaps and assertions in the
+// directory. The directory is only read when the mirror is created.
+func NewMirror(dir string) (*Mirror, error) {
+	m := &Mirror{
+		bs:      asserts.NewMemoryBackstore(),
+		snaps:   make(map[string][]*mirrorSnap),
+		snapIDs: make(map[string]string),
+		files:   make(map[string]*mirrorSnap),
+	}
+
+	if err := m.loadAssertions(dir); err != nil {
+		return nil, fmt.Errorf("cannot load mirror assertions: %v", err)
+	}
+
+	if err := m.loadSnaps(dir); err != nil {
+		return nil, fmt.Errorf("cannot load mirror snaps: %v", err)
+	}
+
+	if err := m.loadChannels(filepath.Join(dir, mirrorChannelsFile)); err != nil {
+		return nil, fmt.Errorf("cannot load mirror channels: %v", err)
+	}
+
+	m.mux = http.NewServeMux()
+	m.mux.HandleFunc("/"+snapActionEndpPath, m.snapActionEndpoint)
+	m.mux.HandleFunc("/"+assertionsPath+"/", m.assertionsEndpoint)
+	m.mux.HandleFunc("/"+mirrorDownloadPath+"/", m.downloadEndpoint)
+	m.mux.HandleFunc("/"+deviceNonceEndpPath, m.deviceNonceEndpoint)
+	m.mux.HandleFunc("/"+deviceSessionEndpPath, m.deviceSessionEndpoint)
+
+	return m, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (m *Mirror) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mux.ServeHTTP(w, r)
+}
+
+func (m *Mirror) loadAssertions(dir string) error {
+	fns, err := filepath.Glob(filepath.Join(dir, "*.assert"))
+	if err != nil {
+		return err
+	}
+
+	for _, fn := range fns {
+		if err := m.loadAssertionsFile(fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Mirror) loadAssertionsFile(fn string) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := asserts.NewDecoder(f)
+	for {
+		a, err := dec.Decode()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("cannot decode %q: %v", fn, err)
+		}
+
+		// the same assertions can be found in several files, keep the newest
+		if err := m.bs.Put(a.Type(), a); err != nil && !isRevisionError(err) {
+			return err
+		}
+	}
+}
+
+func isRevisionError(err error) bool {
+	var revErr *asserts.RevisionError
+	return errors.As(err, &revErr)
+}
+
+func (m *Mirror) loadSnaps(dir string) error {
+	fns, err := filepath.Glob(filepath.Join(dir, "*.snap"))
+	if err != nil {
+		return err
+	}
+
+	for _, fn := range fns {
+		msnap, err := m.readSnap(fn)
+		if err != nil {
+			logger.Noticef("cannot serve snap %q from mirror: %v", fn, err)
+			continue
+		}
+
+		m.snaps[msnap.snapID] = append(m.snaps[msnap.snapID], msnap)
+		m.snapIDs[msnap.info.SnapName()] = msnap.snapID
+		m.files[filepath.Base(fn)] = msnap
+	}
+
+	for _, revs := range m.snaps {
+		sort.Slice(revs, func(i, j int) bool { return revs[i].revision < revs[j].revision })
+	}
+
+	return nil
+}
+
+func (m *Mirror) loadChannels(fn string) error {
+	data, err := os.ReadFile(fn)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var channels map[string]map[string]int
+	if err := json.Unmarshal(data, &channels); err != nil {
+		return fmt.Errorf("cannot decode %q: %v", fn, err)
+	}
+
+	m.channels = make(map[string]map[string]int, len(channels))
+	for name, releases := range channels {
+		m.channels[name] = make(map[string]int, len(releases))
+		for ch, rev := range releases {
+			parsed, err := channel.Parse(ch, "")
+			if err != nil {
+				return fmt.Errorf("invalid channel for snap %q: %v", name, err)
+			}
+			if rev <= 0 {
+				return fmt.Errorf("invalid revision %d for snap %q in channel %q", rev, name, ch)
+			}
+			m.channels[name][parsed.Full()] = rev
+		}
+	}
+
+	return nil
+}
+
+var mirrorReadSnapInfo = func(fn string, si *snap.SideInfo) (*snap.Info, error) {
+	container, err := snapfile.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	return snap.ReadInfoFromSnapFile(container, si)
+}
+
+func (m *Mirror) readSnap(fn string) (*mirrorSnap, error) {
+	digest, size, err := asserts.SnapFileSHA3_384(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := m.find(asserts.SnapRevisionType, []string{digest})
+	if err != nil {
+		return nil, err
+	}
+	snapRev := a.(*asserts.SnapRevision)
+
+	a, err = m.find(asserts.SnapDeclarationType, []string{release.Series, snapRev.SnapID()})
+	if err != nil {
+		return nil, err
+	}
+	snapDecl := a.(*asserts.SnapDeclaration)
+
+	info, err := mirrorReadSnapInfo(fn, &snap.SideInfo{
+		RealName: snapDecl.SnapName(),
+		SnapID:   snapRev.SnapID(),
+		Revision: snap.R(snapRev.SnapRevision()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if info.SnapName() != snapDecl.SnapName() {
+		return nil, fmt.Errorf("snap name %q does not match declared name %q", info.SnapName(), snapDecl.SnapName())
+	}
+
+	publisher := snap.StoreAccount{ID: snapRev.DeveloperID()}
+	if a, err := m.find(asserts.AccountType, []string{snapRev.DeveloperID()}); err == nil {
+		acct := a.(*asserts.Account)
+		publisher.Username = acct.Username()
+		publisher.DisplayName = acct.DisplayName()
+		publisher.Validation = acct.Validation()
+	}
+
+	return &mirrorSnap{
+		path:      fn,
+		info:      info,
+		snapID:    snapRev.SnapID(),
+		revision:  snapRev.SnapRevision(),
+		sha3_384:  digest,
+		size:      size,
+		publisher: publisher,
+		createdAt: snapRev.Timestamp(),
+	}, nil
+}
+
+func (m *Mirror) find(assertType *asserts.AssertionType, primaryKey []string) (asserts.Assertion, error) {
+	return m.bs.Get(assertType, primaryKey, assertType.MaxSupportedFormat())
+}
+
+// snapRevision returns the snap's given revision.
+func (m *Mirror) snapRevision(snapID string, revision int) *mirrorSnap {
+	for _, rev := range m.snaps[snapID] {
+		if rev.revision == revision {
+			return rev
+		}
+	}
+
+	return nil
+}
+
+// channelRelease returns the revision released to the snap's channel or, if
+// the channel has no release, to the closest less risky channel of the same
+// track. A zero revision stands for the newest revision of the snap.
+func (m *Mirror) channelRelease(name string, ch channel.Channel) (revision int, ok bool) {
+	releases, listed := m.channels[name]
+	if !listed {
+		releases = map[string]int{"latest/stable": 0}
+	}
+
+	track := ch.Track
+	if track == "" {
+		track = "latest"
+	}
+
+	if ch.Branch != "" {
+		if rev, ok := releases[track+"/"+ch.Risk+"/"+ch.Branch]; ok {
+			return rev, true
+		}
+	}
+
+	risk := 0
+	for i, r := range mirrorRisks {
+		if r == ch.Risk {
+			risk = i
+		}
+	}
+	for i := risk; i >= 0; i-- {
+		if rev, ok := releases[track+"/"+mirrorRisks[i]]; ok {
+			return rev, true
+		}
+	}
+
+	return 0, false
+}
+
+// channelSnap returns the newest revision of the snap up to the one released
+// to the channel which can read the data written by the given epoch, if any.
+func (m *Mirror) channelSnap(snapID, ch string, epoch *snap.Epoch) (*mirrorSnap, error) {
+	revs := m.snaps[snapID]
+	if len(revs) == 0 {
+		return nil, nil
+	}
+
+	parsed, err := channel.Parse(ch, "")
+	if err != nil {
+		return nil, err
+	}
+
+	released, ok := m.channelRelease(revs[0].info.SnapName(), parsed)
+	if !ok {
+		return nil, nil
+	}
+
+	for i := len(revs) - 1; i >= 0; i-- {
+		msnap := revs[i]
+		if released != 0 && msnap.revision > released {
+			continue
+		}
+		if epoch != nil && !msnap.info.Epoch.CanRead(*epoch) {
+			continue
+		}
+		return msnap, nil
+	}
+
+	return nil, nil
+}
+
+// mirrorSnapJSON holds the snap details sent in snap action results. It
+// mirrors the fields of storeSnap used by snapd.
+type mirrorSnapJSON struct {
+	Architectures []string          `json:"architectures"`
+	Base          string            `json:"base"`
+	Confinement   string            `json:"confinement"`
+	CreatedAt     string            `json:"created-at"`
+	Description   string            `json:"description"`
+	Download      storeDownload     `json:"download"`
+	Epoch         snap.Epoch        `json:"epoch"`
+	License       string            `json:"license"`
+	Name          string            `json:"name"`
+	Publisher     snap.StoreAccount `json:"publisher"`
+	Revision      int               `json:"revision"`
+	SnapID        string            `json:"snap-id"`
+	Summary       string            `json:"summary"`
+	Title         string            `json:"title"`
+	Type          snap.Type         `json:"type"`
+	Version       string            `json:"version"`
+}
+
+type mirrorErrorJSON struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type mirrorActionResultJSON struct {
+	Result           string           `json:"result"`
+	InstanceKey      string           `json:"instance-key,omitempty"`
+	SnapID           string           `json:"snap-id,omitempty"`
+	Name             string           `json:"name,omitempty"`
+	Snap             *mirrorSnapJSON  `json:"snap,omitempty"`
+	EffectiveChannel string           `json:"effective-channel,omitempty"`
+	Error            *mirrorErrorJSON `json:"error,omitempty"`
+
+	Key                 string           `json:"key,omitempty"`
+	AssertionStreamURLs []string         `json:"assertion-stream-urls,omitempty"`
+	ErrorList           []errorListEntry `json:"error-list,omitempty"`
+}
+
+type mirrorActionResultListJSON struct {
+	Results []*mirrorActionResultJSON `json:"results"`
+}
+
+// mirrorAssertionJSON holds a requested assertion in a fetch-assertions action.
+// Either the primary key or the sequence key is set.
+type mirrorAssertionJSON struct {
+	Type        string   `json:"type"`
+	PrimaryKey  []string `json:"primary-key"`
+	SequenceKey []string `json:"sequence-key"`
+	Sequence    int      `json:"sequence"`
+	IfNewerThan *int     `json:"if-newer-than"`
+}
+
+// mirrorActionJSON is the subset of snapActionJSON read by the mirror, with
+// the requested assertions decoded.
+type mirrorActionJSON struct {
+	Action      string                `json:"action"`
+	InstanceKey string                `json:"instance-key"`
+	Name        string                `json:"name"`
+	SnapID      string                `json:"snap-id"`
+	Channel     string                `json:"channel"`
+	Revision    int                   `json:"revision"`
+	Epoch       *snap.Epoch           `json:"epoch"`
+	Key         string                `json:"key"`
+	Assertions  []mirrorAssertionJSON `json:"assertions"`
+}
+
+type mirrorActionRequestJSON struct {
+	Context []*currentSnapV2JSON `json:"context"`
+	Actions []*mirrorActionJSON  `json:"actions"`
+}
+
+func (m *Mirror) snapActionEndpoint(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		mirrorError(w, http.StatusMethodNotAllowed, "method-not-allowed", fmt.Sprintf("unsupported method %s", r.Method))
+		return
+	}
+
+	var req mirrorActionRequestJSON
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		mirrorError(w, http.StatusBadRequest, "invalid-request", fmt.Sprintf("cannot decode request: %v", err))
+		return
+	}
+
+	current := make(map[string]*currentSnapV2JSON, len(req.Context))
+	for _, cur := range req.Context {
+		current[cur.InstanceKey] = cur
+	}
+
+	baseURL := mirrorBaseURL(r)
+	results := make([]*mirrorActionResultJSON, 0, len(req.Actions))
+	for _, action := range req.Actions {
+		var res *mirrorActionResultJSON
+		switch action.Action {
+		case "install", "download":
+			res = m.installAction(action, baseURL)
+		case "refresh":
+			res = m.refreshAction(action, current[action.InstanceKey], baseURL)
+		case "fetch-assertions":
+			res = m.fetchAssertionsAction(action, baseURL)
+		default:
+			res = &mirrorActionResultJSON{
+				Result:      "error",
+				InstanceKey: action.InstanceKey,
+				Name:        action.Name,
+				Error: &mirrorErrorJSON{
+					Code:    "invalid-action",
+					Message: fmt.Sprintf("unsupported action %q", action.Action),
+				},
+			}
+		}
+
+		if res != nil {
+			results = append(results, res)
+		}
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+	json.NewEncoder(w).Encode(mirrorActionResultListJSON{Results: results})
+}
+
+func (m *Mirror) installAction(action *mirrorActionJSON, baseURL *url.URL) *mirrorActionResultJSON {
+	errorResult := func(code, msg string) *mirrorActionResultJSON {
+		return &mirrorActionResultJSON{
+			Result:      "error",
+			InstanceKey: action.InstanceKey,
+			Name:        action.Name,
+			Error:       &mirrorErrorJSON{Code: code, Message: msg},
+		}
+	}
+
+	snapID := m.snapIDs[action.Name]
+	if snapID == "" {
+		return errorResult("name-not-found", "snap not found in mirror")
+	}
+
+	ch := effectiveChannel(action.Channel, "")
+	// a requested revision is served regardless of channel and epoch, as the
+	// store does
+	if action.Revision != 0 {
+		msnap := m.snapRevision(snapID, action.Revision)
+		if msnap == nil {
+			return errorResult("revision-not-found", fmt.Sprintf("revision %d not found in mirror", action.Revision))
+		}
+		return m.snapResult(action.Action, action.InstanceKey, msnap, ch, baseURL)
+	}
+
+	msnap, err := m.channelSnap(snapID, ch, action.Epoch)
+	if err != nil {
+		return errorResult("invalid-request", err.Error())
+	}
+	if msnap == nil {
+		return errorResult("revision-not-found", fmt.Sprintf("no revision available in channel %q", ch))
+	}
+
+	return m.snapResult(action.Action, action.InstanceKey, msnap, ch, baseURL)
+}
+
+func (m *Mirror) refreshAction(action *mirrorActionJSON, cur *currentSnapV2JSON, baseURL *url.URL) *mirrorActionResultJSON {
+	errorResult := func(code, msg string) *mirrorActionResultJSON {
+		return &mirrorActionResultJSON{
+			Result:      "error",
+			InstanceKey: action.InstanceKey,
+			SnapID:      action.SnapID,
+			Error:       &mirrorErrorJSON{Code: code, Message: msg},
+		}
+	}
+
+	if cur == nil {
+		return errorResult("invalid-request", fmt.Sprintf("cannot find instance key %q in the context", action.InstanceKey))
+	}
+
+	ch := effectiveChannel(action.Channel, cur.TrackingChannel)
+	if action.Revision != 0 {
+		msnap := m.snapRevision(action.SnapID, action.Revision)
+		if msnap == nil {
+			return errorResult("revision-not-found", fmt.Sprintf("revision %d not found in mirror", action.Revision))
+		}
+		return m.snapResult("refresh", action.InstanceKey, msnap, ch, baseURL)
+	}
+
+	msnap, err := m.channelSnap(action.SnapID, ch, &cur.Epoch)
+	if err != nil {
+		return errorResult("invalid-request", err.Error())
+	}
+	// the mirror doesn't have the snap or anything newer than the current
+	// revision in the channel, so there is no update
+	if msnap == nil || msnap.revision <= cur.Revision {
+		return nil
+	}
+
+	return m.snapResult("refresh", action.InstanceKey, msnap, ch, baseURL)
+}
+
+func effectiveChannel(requested, tracking string) string {
+	if requested != "" {
+		return requested
+	}
+	if tracking != "" {
+		return tracking
+	}
+	return "latest/stable"
+}
+
+func (m *Mirror) snapResult(result, instanceKey string, msnap *mirrorSnap, channel string, baseURL *url.URL) *mirrorActionResultJSON {
+	info := msnap.info
+
+	// the digest is sent hex encoded, like the store does
+	digest, err := base64.RawURLEncoding.DecodeString(msnap.sha3_384)
+	if err != nil {
+		// cannot happen since the digest was computed when loading
+		logger.Noticef("internal error: invalid snap digest %q: %v", msnap.sha3_384, err)
+	}
+
+	downloadURL := *baseURL
+	downloadURL.Path = path.Join(baseURL.Path, mirrorDownloadPath, filepath.Base(msnap.path))
+
+	return &mirrorActionResultJSON{
+		Result:      result,
+		InstanceKey: instanceKey,
+		SnapID:      msnap.snapID,
+		Name:        info.SnapName(),
+		Snap: &mirrorSnapJSON{
+			Architectures: info.Architectures,
+			Base:          info.Base,
+			Confinement:   string(info.Confinement),
+			CreatedAt:     msnap.createdAt.UTC().Format(time.RFC3339),
+			Description:   info.Description(),
+			Download: storeDownload{
+				Sha3_384: hex.EncodeToString(digest),
+				Size:     int64(msnap.size),
+				URL:      downloadURL.String(),
+			},
+			Epoch:     info.Epoch,
+			License:   info.License,
+			Name:      info.SnapName(),
+			Publisher: msnap.publisher,
+			Revision:  msnap.revision,
+			SnapID:    msnap.snapID,
+			Summary:   info.Summary(),
+			Title:     info.Title(),
+			Type:      info.Type(),
+			Version:   info.Version,
+		},
+		EffectiveChannel: channel,
+	}
+}
+
+func (m *Mirror) fetchAssertionsAction(action *mirrorActionJSON, baseURL *url.URL) *mirrorActionResultJSON {
+	res := &mirrorActionResultJSON{
+		Result: "fetch-assertions",
+		Key:    action.Key,
+	}
+
+	for _, at := range action.Assertions {
+		assertType := asserts.Type(at.Type)
+		if assertType == nil {
+			res.ErrorList = append(res.ErrorList, errorListEntry{
+				Code:    "invalid-request",
+				Message: fmt.Sprintf("unknown assertion type %q", at.Type),
+				Type:    at.Type,
+			})
+			continue
+		}
+
+		var a asserts.Assertion
+		var err error
+		if at.SequenceKey != nil {
+			a, err = m.sequenceMember(assertType, at.SequenceKey, at.Sequence)
+		} else {
+			a, err = m.assertion(assertType, at.PrimaryKey)
+		}
+
+		if err != nil {
+			entry := errorListEntry{
+				Code:        "not-found",
+				Message:     "not found",
+				Type:        at.Type,
+				PrimaryKey:  at.PrimaryKey,
+				SequenceKey: at.SequenceKey,
+			}
+			if !errors.Is(err, &asserts.NotFoundError{}) {
+				entry.Code, entry.Message = "invalid-request", err.Error()
+			}
+			res.ErrorList = append(res.ErrorList, entry)
+			continue
+		}
+
+		if at.IfNewerThan != nil && a.Revision() <= *at.IfNewerThan {
+			continue
+		}
+
+		streamURL := *baseURL
+		streamURL.Path = path.Join(baseURL.Path, assertionsPath, assertType.Name, path.Join(asserts.ReducePrimaryKey(assertType, a.Ref().PrimaryKey)...))
+		res.AssertionStreamURLs = append(res.AssertionStreamURLs, streamURL.String())
+	}
+
+	return res
+}
+
+// assertion returns the assertion with the primary key, which may omit
+// optional elements.
+func (m *Mirror) assertion(assertType *asserts.AssertionType, primaryKey []string) (asserts.Assertion, error) {
+	if !assertType.AcceptablePrimaryKey(primaryKey) {
+		return nil, fmt.Errorf("primary key has wrong length for %q assertion", assertType.Name)
+	}
+
+	return m.find(assertType, primaryKey)
+}
+
+// sequenceMember returns the sequence forming assertion at the sequence point
+// or, if the sequence is not positive, the latest one.
+func (m *Mirror) sequenceMember(assertType *asserts.AssertionType, sequenceKey []string, sequence int) (asserts.Assertion, error) {
+	if !assertType.SequenceForming() {
+		return nil, fmt.Errorf("%q assertions are not sequence forming", assertType.Name)
+	}
+
+	if len(sequenceKey) != len(assertType.PrimaryKey)-1 {
+		return nil, fmt.Errorf("sequence key has wrong length for %q assertion", assertType.Name)
+	}
+
+	if sequence <= 0 {
+		return m.bs.SequenceMemberAfter(assertType, sequenceKey, -1, assertType.MaxSupportedFormat())
+	}
+
+	primaryKey := make([]string, 0, len(assertType.PrimaryKey))
+	primaryKey = append(primaryKey, sequenceKey...)
+	return m.find(assertType, append(primaryKey, strconv.Itoa(sequence)))
+}
+
+func (m *Mirror) assertionsEndpoint(w http.ResponseWriter, r *http.Request) {
+	comps := strings.Split(strings.TrimPrefix(r.URL.Path, "/"+assertionsPath+"/"), "/")
+	assertType := asserts.Type(comps[0])
+	if assertType == nil {
+		mirrorError(w, http.StatusBadRequest, "invalid-request", fmt.Sprintf("unknown assertion type %q", comps[0]))
+		return
+	}
+	key := comps[1:]
+
+	var a asserts.Assertion
+	var err error
+	if assertType.SequenceForming() && len(key) == len(assertType.PrimaryKey)-1 {
+		sequence := -1
+		if seq := r.URL.Query().Get("sequence"); seq != "" && seq != "latest" {
+			sequence, err = strconv.Atoi(seq)
+			if err != nil || sequence <= 0 {
+				mirrorError(w, http.StatusBadRequest, "invalid-request", fmt.Sprintf("invalid sequence %q", seq))
+				return
+			}
+		}
+		a, err = m.sequenceMember(assertType, key, sequence)
+	} else {
+		a, err = m.assertion(assertType, key)
+	}
+
+	if errors.Is(err, &asserts.NotFoundError{}) {
+		mirrorError(w, http.StatusNotFound, "not-found", "not found")
+		return
+	}
+	if err != nil {
+		mirrorError(w, http.StatusBadRequest, "invalid-request", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", asserts.MediaType)
+	w.Write(asserts.Encode(a))
+}
+
+func (m *Mirror) downloadEndpoint(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/"+mirrorDownloadPath+"/")
+	// only snaps known to the mirror are served
+	msnap, ok := m.files[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(msnap.path)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("cannot open snap: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	// ServeContent handles range requests, which are used to resume downloads
+	http.ServeContent(w, r, name, msnap.createdAt, f)
+}
+
+// deviceNonceEndpoint and deviceSessionEndpoint let devices with a serial
+// obtain a session, as they do with the store. The mirror doesn't restrict
+// access, so the device session request isn't verified and the returned
+// macaroon is a placeholder which is never checked and grants nothing.
+func (m *Mirror) deviceNonceEndpoint(w http.ResponseWriter, r *http.Request) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		http.Error(w, fmt.Sprintf("cannot generate nonce: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+	json.NewEncoder(w).Encode(map[string]string{"nonce": hex.EncodeToString(nonce)})
+}
+
+func (m *Mirror) deviceSessionEndpoint(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", jsonContentType)
+	json.NewEncoder(w).Encode(map[string]string{"macaroon": "store-mirror-session"})
+}
+
+// mirrorBaseURL returns the URL through which the request reached the mirror,
+// which is used to build download and assertion URLs.
+func mirrorBaseURL(r *http.Request) *url.URL {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return &url.URL{Scheme: scheme, Host: r.Host, Path: "/"}
+}
+
+func mirrorError(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error-list": []mirrorErrorJSON{{Code: code, Message: msg}},
+	})
+}
@@ -0,0 +1,550 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package store_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/store"
+)
+
+type mirrorSuite struct {
+	baseStoreSuite
+
+	storeSigning *assertstest.StoreStack
+	dir          string
+
+	server *httptest.Server
+	sto    *store.Store
+}
+
+var _ = Suite(&mirrorSuite{})
+
+func (s *mirrorSuite) SetUpTest(c *C) {
+	s.baseStoreSuite.SetUpTest(c)
+
+	// the snap files used in the tests are not squashfs images, take the
+	// snap.yaml from a sibling file instead
+	s.AddCleanup(store.MockMirrorReadSnapInfo(func(fn string, si *snap.SideInfo) (*snap.Info, error) {
+		yaml, err := os.ReadFile(strings.TrimSuffix(fn, ".snap") + ".yaml")
+		if err != nil {
+			return nil, err
+		}
+		return snap.InfoFromSnapYaml(yaml)
+	}))
+
+	s.storeSigning = assertstest.NewStoreStack("can0nical", nil)
+	s.dir = c.MkDir()
+
+	dev1Acct := assertstest.NewAccount(s.storeSigning, "developer1", map[string]interface{}{
+		"account-id": "developer1",
+	}, "")
+	a, err := s.storeSigning.Sign(asserts.SnapDeclarationType, map[string]interface{}{
+		"series":       "16",
+		"snap-id":      "foo-id",
+		"snap-name":    "foo",
+		"publisher-id": "developer1",
+		"timestamp":    time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+
+	s.writeAssertions(c, "common.assert", s.storeSigning.StoreAccountKey(""), dev1Acct, a)
+}
+
+func (s *mirrorSuite) TearDownTest(c *C) {
+	if s.server != nil {
+		s.server.Close()
+		s.server = nil
+	}
+	s.baseStoreSuite.TearDownTest(c)
+}
+
+func (s *mirrorSuite) writeAssertions(c *C, name string, as ...asserts.Assertion) {
+	var buf []byte
+	for _, a := range as {
+		buf = append(buf, asserts.Encode(a)...)
+		buf = append(buf, '\n')
+	}
+	c.Assert(os.WriteFile(filepath.Join(s.dir, name), buf, 0644), IsNil)
+}
+
+func (s *mirrorSuite) addSnap(c *C, name, snapID string, revision int) string {
+	return s.addSnapWithEpoch(c, name, snapID, revision, "0")
+}
+
+func (s *mirrorSuite) addSnapWithEpoch(c *C, name, snapID string, revision int, epoch string) string {
+	base := fmt.Sprintf("%s_%d", name, revision)
+	snapPath := filepath.Join(s.dir, base+".snap")
+	content := fmt.Sprintf("%s content for revision %d", name, revision)
+	c.Assert(os.WriteFile(snapPath, []byte(content), 0644), IsNil)
+	yaml := fmt.Sprintf("name: %s\nversion: 1.%d\nsummary: %s summary\nepoch: %s\n", name, revision, name, epoch)
+	c.Assert(os.WriteFile(filepath.Join(s.dir, base+".yaml"), []byte(yaml), 0644), IsNil)
+
+	digest, size, err := asserts.SnapFileSHA3_384(snapPath)
+	c.Assert(err, IsNil)
+	a, err := s.storeSigning.Sign(asserts.SnapRevisionType, map[string]interface{}{
+		"snap-sha3-384": digest,
+		"snap-size":     strconv.FormatUint(size, 10),
+		"snap-id":       snapID,
+		"snap-revision": strconv.Itoa(revision),
+		"developer-id":  "developer1",
+		"timestamp":     time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	s.writeAssertions(c, base+".assert", a)
+
+	return snapPath
+}
+
+func (s *mirrorSuite) writeChannels(c *C, channels string) {
+	c.Assert(os.WriteFile(filepath.Join(s.dir, "channels.json"), []byte(channels), 0644), IsNil)
+}
+
+func (s *mirrorSuite) startMirror(c *C) {
+	m, err := store.NewMirror(s.dir)
+	c.Assert(err, IsNil)
+
+	s.server = httptest.NewServer(m)
+	u, err := url.Parse(s.server.URL + "/")
+	c.Assert(err, IsNil)
+
+	s.sto = store.New(&store.Config{
+		StoreBaseURL:      u,
+		AssertionsBaseURL: u,
+	}, nil)
+}
+
+func (s *mirrorSuite) TestInstall(c *C) {
+	s.addSnap(c, "foo", "foo-id", 1)
+	s.addSnap(c, "foo", "foo-id", 2)
+	s.startMirror(c)
+
+	results, _, err := s.sto.SnapAction(s.ctx, nil, []*store.SnapAction{{
+		Action:       "install",
+		InstanceName: "foo",
+		Channel:      "stable",
+	}}, nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 1)
+
+	info := results[0].Info
+	c.Check(info.SnapName(), Equals, "foo")
+	c.Check(info.SnapID, Equals, "foo-id")
+	c.Check(info.Revision, Equals, snap.R(2))
+	c.Check(info.Version, Equals, "1.2")
+	c.Check(info.Summary(), Equals, "foo summary")
+	c.Check(info.Publisher.ID, Equals, "developer1")
+	c.Check(info.Publisher.Username, Equals, "developer1")
+	c.Check(info.Channel, Equals, "stable")
+	c.Check(info.DownloadURL, Equals, s.server.URL+"/download/foo_2.snap")
+}
+
+func (s *mirrorSuite) TestInstallRevision(c *C) {
+	s.addSnap(c, "foo", "foo-id", 1)
+	s.addSnap(c, "foo", "foo-id", 2)
+	s.startMirror(c)
+
+	results, _, err := s.sto.SnapAction(s.ctx, nil, []*store.SnapAction{{
+		Action:       "install",
+		InstanceName: "foo",
+		Revision:     snap.R(1),
+	}}, nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 1)
+	c.Check(results[0].Info.Revision, Equals, snap.R(1))
+	c.Check(results[0].Info.Version, Equals, "1.1")
+}
+
+func (s *mirrorSuite) TestInstallNotFound(c *C) {
+	s.addSnap(c, "foo", "foo-id", 1)
+	s.startMirror(c)
+
+	_, _, err := s.sto.SnapAction(s.ctx, nil, []*store.SnapAction{{
+		Action:       "install",
+		InstanceName: "bar",
+	}, {
+		Action:       "install",
+		InstanceName: "foo",
+		Revision:     snap.R(7),
+	}}, nil, nil, nil)
+	c.Assert(err, FitsTypeOf, &store.SnapActionError{})
+	saErr := err.(*store.SnapActionError)
+	c.Check(saErr.Install, HasLen, 2)
+	c.Check(saErr.Install["bar"], Equals, store.ErrSnapNotFound)
+	c.Check(saErr.Install["foo"], FitsTypeOf, &store.RevisionNotAvailableError{})
+}
+
+func (s *mirrorSuite) TestInstallChannel(c *C) {
+	s.addSnap(c, "foo", "foo-id", 1)
+	s.addSnap(c, "foo", "foo-id", 2)
+	s.addSnap(c, "foo", "foo-id", 3)
+	s.addSnap(c, "foo", "foo-id", 4)
+	s.writeChannels(c, `{"foo": {"stable": 1, "latest/beta": 2, "beta/hotfix": 4, "2.0/edge": 3}}`)
+	s.startMirror(c)
+
+	for _, t := range []struct {
+		channel  string
+		revision snap.Revision
+	}{
+		{"stable", snap.R(1)},
+		{"latest/stable", snap.R(1)},
+		// falls back to stable
+		{"candidate", snap.R(1)},
+		{"beta", snap.R(2)},
+		// falls back to beta
+		{"edge", snap.R(2)},
+		{"latest/beta/hotfix", snap.R(4)},
+		// falls back to edge, then beta
+		{"edge/other", snap.R(2)},
+		{"2.0/edge", snap.R(3)},
+	} {
+		results, _, err := s.sto.SnapAction(s.ctx, nil, []*store.SnapAction{{
+			Action:       "install",
+			InstanceName: "foo",
+			Channel:      t.channel,
+		}}, nil, nil, nil)
+		c.Assert(err, IsNil, Commentf(t.channel))
+		c.Assert(results, HasLen, 1)
+		c.Check(results[0].Info.Revision, Equals, t.revision, Commentf(t.channel))
+		c.Check(results[0].Info.Channel, Equals, t.channel)
+	}
+
+	// nothing is released to the track
+	_, _, err := s.sto.SnapAction(s.ctx, nil, []*store.SnapAction{{
+		Action:       "install",
+		InstanceName: "foo",
+		Channel:      "2.0/candidate",
+	}}, nil, nil, nil)
+	c.Assert(err, FitsTypeOf, &store.SnapActionError{})
+	c.Check(err.(*store.SnapActionError).Install["foo"], FitsTypeOf, &store.RevisionNotAvailableError{})
+
+	// a requested revision doesn't need to be released
+	results, _, err := s.sto.SnapAction(s.ctx, nil, []*store.SnapAction{{
+		Action:       "install",
+		InstanceName: "foo",
+		Channel:      "stable",
+		Revision:     snap.R(3),
+	}}, nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 1)
+	c.Check(results[0].Info.Revision, Equals, snap.R(3))
+}
+
+func (s *mirrorSuite) TestInstallUnlistedSnapOnlyInLatestTrack(c *C) {
+	s.addSnap(c, "foo", "foo-id", 1)
+	s.addSnap(c, "foo", "foo-id", 2)
+	s.writeChannels(c, `{"bar": {"stable": 1}}`)
+	s.startMirror(c)
+
+	results, _, err := s.sto.SnapAction(s.ctx, nil, []*store.SnapAction{{
+		Action:       "install",
+		InstanceName: "foo",
+		Channel:      "latest/edge",
+	}}, nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 1)
+	c.Check(results[0].Info.Revision, Equals, snap.R(2))
+
+	_, _, err = s.sto.SnapAction(s.ctx, nil, []*store.SnapAction{{
+		Action:       "install",
+		InstanceName: "foo",
+		Channel:      "2.0/stable",
+	}}, nil, nil, nil)
+	c.Assert(err, FitsTypeOf, &store.SnapActionError{})
+	c.Check(err.(*store.SnapActionError).Install["foo"], FitsTypeOf, &store.RevisionNotAvailableError{})
+}
+
+func (s *mirrorSuite) TestInstallEpoch(c *C) {
+	s.addSnapWithEpoch(c, "foo", "foo-id", 1, "0")
+	s.addSnapWithEpoch(c, "foo", "foo-id", 2, "1")
+	s.addSnapWithEpoch(c, "foo", "foo-id", 3, "2")
+	s.startMirror(c)
+
+	// no epoch, the newest revision
+	results, _, err := s.sto.SnapAction(s.ctx, nil, []*store.SnapAction{{
+		Action:       "install",
+		InstanceName: "foo",
+	}}, nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 1)
+	c.Check(results[0].Info.Revision, Equals, snap.R(3))
+
+	// the newest revision which can read the epoch
+	results, _, err = s.sto.SnapAction(s.ctx, nil, []*store.SnapAction{{
+		Action:       "install",
+		InstanceName: "foo",
+		Epoch:        snap.E("1"),
+	}}, nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 1)
+	c.Check(results[0].Info.Revision, Equals, snap.R(2))
+
+	_, _, err = s.sto.SnapAction(s.ctx, nil, []*store.SnapAction{{
+		Action:       "install",
+		InstanceName: "foo",
+		Epoch:        snap.E("5"),
+	}}, nil, nil, nil)
+	c.Assert(err, FitsTypeOf, &store.SnapActionError{})
+	c.Check(err.(*store.SnapActionError).Install["foo"], FitsTypeOf, &store.RevisionNotAvailableError{})
+}
+
+func (s *mirrorSuite) TestInvalidChannels(c *C) {
+	for _, t := range []struct {
+		channels string
+		err      string
+	}{
+		{`{`, `cannot load mirror channels: cannot decode ".*/channels.json": .*`},
+		{`{"foo": {"a/b/c/d": 1}}`, `cannot load mirror channels: invalid channel for snap "foo": channel name has too many components: a/b/c/d`},
+		{`{"foo": {"stable": 0}}`, `cannot load mirror channels: invalid revision 0 for snap "foo" in channel "stable"`},
+	} {
+		s.writeChannels(c, t.channels)
+		_, err := store.NewMirror(s.dir)
+		c.Check(err, ErrorMatches, t.err)
+	}
+}
+
+func (s *mirrorSuite) TestSnapWithoutAssertionsIsIgnored(c *C) {
+	c.Assert(os.WriteFile(filepath.Join(s.dir, "bar_1.snap"), []byte("bar"), 0644), IsNil)
+	s.startMirror(c)
+
+	_, _, err := s.sto.SnapAction(s.ctx, nil, []*store.SnapAction{{
+		Action:       "install",
+		InstanceName: "bar",
+	}}, nil, nil, nil)
+	c.Assert(err, FitsTypeOf, &store.SnapActionError{})
+	c.Check(err.(*store.SnapActionError).Install["bar"], Equals, store.ErrSnapNotFound)
+	c.Check(s.logbuf.String(), Matches, `(?s).*cannot serve snap ".*/bar_1.snap" from mirror: .*`)
+}
+
+func (s *mirrorSuite) TestRefresh(c *C) {
+	s.addSnap(c, "foo", "foo-id", 1)
+	s.addSnap(c, "foo", "foo-id", 2)
+	s.startMirror(c)
+
+	results, _, err := s.sto.SnapAction(s.ctx, []*store.CurrentSnap{{
+		InstanceName:    "foo",
+		SnapID:          "foo-id",
+		Revision:        snap.R(1),
+		TrackingChannel: "latest/candidate",
+		RefreshedDate:   time.Now(),
+	}}, []*store.SnapAction{{
+		Action:       "refresh",
+		InstanceName: "foo",
+		SnapID:       "foo-id",
+	}}, nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 1)
+	c.Check(results[0].Info.Revision, Equals, snap.R(2))
+	c.Check(results[0].Info.Channel, Equals, "latest/candidate")
+}
+
+func (s *mirrorSuite) TestRefreshNoUpdate(c *C) {
+	s.addSnap(c, "foo", "foo-id", 2)
+	s.startMirror(c)
+
+	_, _, err := s.sto.SnapAction(s.ctx, []*store.CurrentSnap{{
+		InstanceName:    "foo",
+		SnapID:          "foo-id",
+		Revision:        snap.R(2),
+		TrackingChannel: "latest/stable",
+		RefreshedDate:   time.Now(),
+	}}, []*store.SnapAction{{
+		Action:       "refresh",
+		InstanceName: "foo",
+		SnapID:       "foo-id",
+	}}, nil, nil, nil)
+	c.Assert(err, FitsTypeOf, &store.SnapActionError{})
+	c.Check(err.(*store.SnapActionError).NoResults, Equals, true)
+}
+
+func (s *mirrorSuite) TestRefreshChannel(c *C) {
+	s.addSnap(c, "foo", "foo-id", 1)
+	s.addSnap(c, "foo", "foo-id", 2)
+	s.writeChannels(c, `{"foo": {"stable": 1, "edge": 2}}`)
+	s.startMirror(c)
+
+	cur := []*store.CurrentSnap{{
+		InstanceName:    "foo",
+		SnapID:          "foo-id",
+		Revision:        snap.R(1),
+		TrackingChannel: "latest/stable",
+		RefreshedDate:   time.Now(),
+	}}
+
+	// nothing newer in the tracked channel
+	_, _, err := s.sto.SnapAction(s.ctx, cur, []*store.SnapAction{{
+		Action:       "refresh",
+		InstanceName: "foo",
+		SnapID:       "foo-id",
+	}}, nil, nil, nil)
+	c.Assert(err, FitsTypeOf, &store.SnapActionError{})
+	c.Check(err.(*store.SnapActionError).NoResults, Equals, true)
+
+	// switching channel
+	results, _, err := s.sto.SnapAction(s.ctx, cur, []*store.SnapAction{{
+		Action:       "refresh",
+		InstanceName: "foo",
+		SnapID:       "foo-id",
+		Channel:      "latest/edge",
+	}}, nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 1)
+	c.Check(results[0].Info.Revision, Equals, snap.R(2))
+	c.Check(results[0].Info.Channel, Equals, "latest/edge")
+}
+
+func (s *mirrorSuite) TestRefreshEpoch(c *C) {
+	s.addSnapWithEpoch(c, "foo", "foo-id", 1, "0")
+	s.addSnapWithEpoch(c, "foo", "foo-id", 2, "1*")
+	s.addSnapWithEpoch(c, "foo", "foo-id", 3, "2*")
+	s.startMirror(c)
+
+	// revision 3 cannot read the data of epoch 0, revision 2 can
+	results, _, err := s.sto.SnapAction(s.ctx, []*store.CurrentSnap{{
+		InstanceName:    "foo",
+		SnapID:          "foo-id",
+		Revision:        snap.R(1),
+		TrackingChannel: "latest/stable",
+		Epoch:           snap.E("0"),
+		RefreshedDate:   time.Now(),
+	}}, []*store.SnapAction{{
+		Action:       "refresh",
+		InstanceName: "foo",
+		SnapID:       "foo-id",
+	}}, nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 1)
+	c.Check(results[0].Info.Revision, Equals, snap.R(2))
+
+	// revision 3 can read the data of epoch 1*
+	results, _, err = s.sto.SnapAction(s.ctx, []*store.CurrentSnap{{
+		InstanceName:    "foo",
+		SnapID:          "foo-id",
+		Revision:        snap.R(2),
+		TrackingChannel: "latest/stable",
+		Epoch:           snap.E("1*"),
+		RefreshedDate:   time.Now(),
+	}}, []*store.SnapAction{{
+		Action:       "refresh",
+		InstanceName: "foo",
+		SnapID:       "foo-id",
+	}}, nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 1)
+	c.Check(results[0].Info.Revision, Equals, snap.R(3))
+}
+
+func (s *mirrorSuite) TestDownload(c *C) {
+	snapPath := s.addSnap(c, "foo", "foo-id", 1)
+	s.startMirror(c)
+
+	results, _, err := s.sto.SnapAction(s.ctx, nil, []*store.SnapAction{{
+		Action:       "download",
+		InstanceName: "foo",
+	}}, nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 1)
+
+	targetPath := filepath.Join(c.MkDir(), "foo_1.snap")
+	err = s.sto.Download(s.ctx, "foo", targetPath, &results[0].Info.DownloadInfo, nil, nil, nil)
+	c.Assert(err, IsNil)
+
+	expected, err := os.ReadFile(snapPath)
+	c.Assert(err, IsNil)
+	downloaded, err := os.ReadFile(targetPath)
+	c.Assert(err, IsNil)
+	c.Check(downloaded, DeepEquals, expected)
+}
+
+func (s *mirrorSuite) TestDownloadUnknownFile(c *C) {
+	s.addSnap(c, "foo", "foo-id", 1)
+	c.Assert(os.WriteFile(filepath.Join(s.dir, "secret"), []byte("secret"), 0644), IsNil)
+	s.startMirror(c)
+
+	for _, fn := range []string{"secret", "foo_1.yaml", "foo_2.snap", "../common.assert"} {
+		resp, err := http.Get(s.server.URL + "/download/" + fn)
+		c.Assert(err, IsNil)
+		resp.Body.Close()
+		c.Check(resp.StatusCode, Equals, 404, Commentf(fn))
+	}
+}
+
+func (s *mirrorSuite) TestAssertion(c *C) {
+	s.addSnap(c, "foo", "foo-id", 1)
+	s.startMirror(c)
+
+	a, err := s.sto.Assertion(asserts.SnapDeclarationType, []string{"16", "foo-id"}, nil)
+	c.Assert(err, IsNil)
+	c.Check(a.(*asserts.SnapDeclaration).SnapName(), Equals, "foo")
+
+	_, err = s.sto.Assertion(asserts.SnapDeclarationType, []string{"16", "bar-id"}, nil)
+	c.Check(err, ErrorMatches, `snap-declaration \(bar-id; series:16\) not found`)
+}
+
+func (s *mirrorSuite) TestFetchAssertions(c *C) {
+	s.addSnap(c, "foo", "foo-id", 1)
+	s.startMirror(c)
+
+	assertq := &testAssertQuery{
+		toResolve: map[asserts.Grouping][]*asserts.AtRevision{
+			asserts.Grouping("g1"): {{
+				Ref: asserts.Ref{
+					Type:       asserts.SnapDeclarationType,
+					PrimaryKey: []string{"16", "foo-id"},
+				},
+				Revision: asserts.RevisionNotKnown,
+			}},
+			asserts.Grouping("g2"): {{
+				Ref: asserts.Ref{
+					Type:       asserts.SnapDeclarationType,
+					PrimaryKey: []string{"16", "bar-id"},
+				},
+				Revision: asserts.RevisionNotKnown,
+			}},
+		},
+	}
+
+	results, aresults, err := s.sto.SnapAction(s.ctx, nil, nil, assertq, nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(results, HasLen, 0)
+	c.Check(aresults, DeepEquals, []store.AssertionResult{{
+		Grouping:   asserts.Grouping("g1"),
+		StreamURLs: []string{s.server.URL + "/v2/assertions/snap-declaration/16/foo-id"},
+	}})
+	c.Check(assertq.errors, DeepEquals, map[string]error{
+		"snap-declaration/16/bar-id": &asserts.NotFoundError{
+			Type:    asserts.SnapDeclarationType,
+			Headers: map[string]string{"series": "16", "snap-id": "bar-id"},
+		},
+	})
+}
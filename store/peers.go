@@ -0,0 +1,257 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package store
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/snapcore/snapd/httputil"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/progress"
+	"github.com/snapcore/snapd/snap"
+)
+
+// peerCacheEndpPath is the path under which peers serve the blobs in their
+// download cache, addressed by their sha3-384 digest.
+const peerCacheEndpPath = "v1/peer-cache/"
+
+// peerTokenLifetime is how long the token presented to a peer to download a
+// blob remains valid.
+const peerTokenLifetime = 10 * time.Minute
+
+var timeNow = time.Now
+
+// PeerConfig describes the peers on the local network that are asked for
+// snap blobs before downloading them from the store.
+type PeerConfig struct {
+	// Peers holds the base URLs of the peers.
+	Peers []*url.URL
+	// Token is the shared secret used to authenticate to the peers. It is
+	// never sent to them, see PeerDownloadToken.
+	Token string
+}
+
+// PeerDownloadToken returns the token presented to a peer to download the
+// blob with the given digest. Peers are reached over plain HTTP, so the shared
+// secret isn't sent. Instead, the token is the expiry time and an HMAC of the
+// digest and expiry keyed by the secret, which can only be used to download
+// that blob until it expires.
+func PeerDownloadToken(secret, digest string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return exp + "." + hex.EncodeToString(peerTokenMAC(secret, digest, exp))
+}
+
+func peerTokenMAC(secret, digest, expires string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(digest + "\n" + expires))
+	return mac.Sum(nil)
+}
+
+// checkPeerDownloadToken checks that the token was issued with the secret to
+// download the blob with the given digest and hasn't expired.
+func checkPeerDownloadToken(secret, digest, token string) error {
+	exp, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return errors.New("malformed token")
+	}
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return errors.New("malformed token")
+	}
+	mac, err := hex.DecodeString(sig)
+	if err != nil {
+		return errors.New("malformed token")
+	}
+	if !hmac.Equal(mac, peerTokenMAC(secret, digest, exp)) {
+		return errors.New("invalid token")
+	}
+	if timeNow().Unix() > expires {
+		return errors.New("expired token")
+	}
+	return nil
+}
+
+var validPeerCacheKey = regexp.MustCompile("^[0-9a-f]{96}$")
+
+// PeerHandler returns an http.Handler serving the blobs in the cache to
+// peers presenting a bearer token for the blob issued with the given shared
+// secret. If the secret is empty all requests are refused.
+func (cm *CacheManager) PeerHandler(token string) http.Handler {
+	return &peerCacheHandler{cache: cm, token: token}
+}
+
+type peerCacheHandler struct {
+	cache downloadCache
+	token string
+}
+
+func (h *peerCacheHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cacheKey := strings.TrimPrefix(r.URL.Path, "/"+peerCacheEndpPath)
+	if !validPeerCacheKey.MatchString(cacheKey) {
+		http.NotFound(w, r)
+		return
+	}
+
+	auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if h.token == "" || checkPeerDownloadToken(h.token, cacheKey, auth) != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	path := h.cache.GetPath(cacheKey)
+	if path == "" {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(w, "cannot read blob", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, cacheKey, fi.ModTime(), f)
+}
+
+// downloadFromPeers tries to download the snap blob from the configured
+// peers, verifying it against the expected sha3-384 digest. It returns true
+// if the blob was placed at targetPath.
+func (s *Store) downloadFromPeers(ctx context.Context, name, targetPath string, downloadInfo *snap.DownloadInfo, pbar progress.Meter) bool {
+	if s.cfg.Peers == nil || downloadInfo.Sha3_384 == "" || downloadInfo.Size <= 0 {
+		return false
+	}
+
+	peerCfg, err := s.cfg.Peers()
+	if err != nil {
+		logger.Noticef("Cannot get download peers: %v", err)
+		return false
+	}
+	if peerCfg == nil || len(peerCfg.Peers) == 0 {
+		return false
+	}
+
+	for _, peer := range peerCfg.Peers {
+		err := downloadFromPeer(ctx, name, targetPath, downloadInfo, peer, peerCfg.Token, pbar)
+		if err == nil {
+			logger.Debugf("Downloaded %s from peer %s.", name, peer.Host)
+			return true
+		}
+		logger.Noticef("Cannot download %s from peer %s: %v", name, peer.Host, err)
+	}
+
+	return false
+}
+
+var downloadFromPeer = downloadFromPeerImpl
+
+func downloadFromPeerImpl(ctx context.Context, name, targetPath string, downloadInfo *snap.DownloadInfo, peer *url.URL, token string, pbar progress.Meter) (err error) {
+	blobURL := peer.ResolveReference(&url.URL{Path: peerCacheEndpPath + downloadInfo.Sha3_384})
+
+	tc, downloadCtx := NewTransferSpeedMonitoringWriterAndContext(ctx, downloadSpeedMeasureWindow, downloadSpeedMin)
+
+	req, err := http.NewRequestWithContext(downloadCtx, "GET", blobURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+PeerDownloadToken(token, downloadInfo.Sha3_384, timeNow().Add(peerTokenLifetime)))
+
+	// peers are on the local network, they are never reached via the
+	// store proxy
+	cli := httputilNewHTTPClient(&httputil.ClientOptions{})
+	resp, err := cli.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return &DownloadError{Code: resp.StatusCode, URL: blobURL}
+	}
+
+	partialPath := targetPath + ".peer"
+	w, err := os.OpenFile(partialPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := w.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(partialPath)
+		}
+	}()
+
+	if pbar == nil {
+		pbar = progress.Null
+	}
+	pbar.Start(name, float64(resp.ContentLength))
+	h := crypto.SHA3_384.New()
+	stopMonitorCh := tc.Monitor()
+	// read one byte more than expected to detect peers sending too much
+	n, err := io.Copy(io.MultiWriter(w, h, pbar, tc), io.LimitReader(resp.Body, downloadInfo.Size+1))
+	close(stopMonitorCh)
+	pbar.Finished()
+	if err := tc.Err(); err != nil {
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if n > downloadInfo.Size {
+		return fmt.Errorf("peer sent more than the expected %d bytes", downloadInfo.Size)
+	}
+
+	actualSha3 := fmt.Sprintf("%x", h.Sum(nil))
+	if actualSha3 != downloadInfo.Sha3_384 {
+		return HashError{name, actualSha3, downloadInfo.Sha3_384}
+	}
+
+	if err := w.Sync(); err != nil {
+		return err
+	}
+
+	return os.Rename(partialPath, targetPath)
+}
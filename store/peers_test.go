@@ -0,0 +1,291 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package store_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/sha3"
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/store"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type peersSuite struct {
+	baseStoreSuite
+
+	content  string
+	sha3_384 string
+
+	peerCache *store.CacheManager
+	peer      *httptest.Server
+
+	storeHits int
+	storeSrv  *httptest.Server
+}
+
+var _ = Suite(&peersSuite{})
+
+func (s *peersSuite) SetUpTest(c *C) {
+	s.baseStoreSuite.SetUpTest(c)
+
+	s.content = "snap blob content"
+	s.sha3_384 = fmt.Sprintf("%x", sha3.Sum384([]byte(s.content)))
+
+	s.peerCache = store.NewCacheManager(c.MkDir(), 5)
+	s.peer = httptest.NewServer(s.peerCache.PeerHandler("secret"))
+	s.AddCleanup(s.peer.Close)
+
+	s.storeHits = 0
+	s.storeSrv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.storeHits++
+		io.WriteString(w, s.content)
+	}))
+	s.AddCleanup(s.storeSrv.Close)
+}
+
+func (s *peersSuite) putInPeerCache(c *C, content string) {
+	src := filepath.Join(c.MkDir(), "blob")
+	c.Assert(os.WriteFile(src, []byte(content), 0644), IsNil)
+	c.Assert(s.peerCache.Put(s.sha3_384, src), IsNil)
+}
+
+func (s *peersSuite) peerGet(c *C, path, token string) (int, string) {
+	req, err := http.NewRequest("GET", s.peer.URL+path, nil)
+	c.Assert(err, IsNil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	return resp.StatusCode, string(body)
+}
+
+func (s *peersSuite) newStore(c *C, peerCfg *store.PeerConfig, peerErr error) *store.Store {
+	sto := store.New(&store.Config{
+		Peers: func() (*store.PeerConfig, error) {
+			return peerCfg, peerErr
+		},
+	}, nil)
+	sto.SetCacheDownloads(5)
+	return sto
+}
+
+func (s *peersSuite) downloadInfo() *snap.DownloadInfo {
+	return &snap.DownloadInfo{
+		DownloadURL: s.storeSrv.URL + "/download/foo.snap",
+		Sha3_384:    s.sha3_384,
+		Size:        int64(len(s.content)),
+	}
+}
+
+func (s *peersSuite) token(secret, digest string) string {
+	return store.PeerDownloadToken(secret, digest, time.Now().Add(time.Minute))
+}
+
+func (s *peersSuite) TestPeerHandlerServesCachedBlobs(c *C) {
+	s.putInPeerCache(c, s.content)
+
+	status, body := s.peerGet(c, "/v1/peer-cache/"+s.sha3_384, s.token("secret", s.sha3_384))
+	c.Check(status, Equals, 200)
+	c.Check(body, Equals, s.content)
+}
+
+func (s *peersSuite) TestPeerHandlerAuthentication(c *C) {
+	s.putInPeerCache(c, s.content)
+
+	otherDigest := fmt.Sprintf("%x", sha3.Sum384([]byte("other")))
+	for _, token := range []string{
+		"",
+		"wrong",
+		// the shared secret itself is not accepted
+		"secret",
+		s.token("not-the-secret", s.sha3_384),
+		// a token for another blob
+		s.token("secret", otherDigest),
+		// an expired token
+		store.PeerDownloadToken("secret", s.sha3_384, time.Now().Add(-time.Minute)),
+	} {
+		status, _ := s.peerGet(c, "/v1/peer-cache/"+s.sha3_384, token)
+		c.Check(status, Equals, 403, Commentf("token %q", token))
+	}
+
+	// without a configured token nothing is served
+	srv := httptest.NewServer(s.peerCache.PeerHandler(""))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/v1/peer-cache/" + s.sha3_384)
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, Equals, 403)
+}
+
+func (s *peersSuite) TestPeerHandlerNotFound(c *C) {
+	for _, path := range []string{
+		"/v1/peer-cache/" + s.sha3_384,
+		"/v1/peer-cache/../../etc/passwd",
+		"/v1/peer-cache/not-a-digest",
+		"/other",
+	} {
+		status, _ := s.peerGet(c, path, s.token("secret", s.sha3_384))
+		c.Check(status, Equals, 404, Commentf(path))
+	}
+
+	req, err := http.NewRequest("POST", s.peer.URL+"/v1/peer-cache/"+s.sha3_384, nil)
+	c.Assert(err, IsNil)
+	req.Header.Set("Authorization", "Bearer "+s.token("secret", s.sha3_384))
+	resp, err := http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, Equals, 405)
+}
+
+func (s *peersSuite) TestDownloadFromPeer(c *C) {
+	s.putInPeerCache(c, s.content)
+
+	otherPeer, err := url.Parse("http://127.0.0.1:1")
+	c.Assert(err, IsNil)
+	peer, err := url.Parse(s.peer.URL)
+	c.Assert(err, IsNil)
+	sto := s.newStore(c, &store.PeerConfig{
+		Peers: []*url.URL{otherPeer, peer},
+		Token: "secret",
+	}, nil)
+
+	path := filepath.Join(c.MkDir(), "foo.snap")
+	err = sto.Download(s.ctx, "foo", path, s.downloadInfo(), nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(path, testutil.FileEquals, s.content)
+	c.Check(osutil.FileExists(path+".peer"), Equals, false)
+	c.Check(s.storeHits, Equals, 0)
+	c.Check(s.logbuf.String(), Matches, `(?s).*Cannot download foo from peer 127.0.0.1:1: .*`)
+
+	// the blob is now in the local cache
+	c.Check(store.NewCacheManager(dirs.SnapDownloadCacheDir, 5).GetPath(s.sha3_384), Not(Equals), "")
+}
+
+func (s *peersSuite) TestDownloadFromPeerHashMismatchFallsBackToStore(c *C) {
+	s.putInPeerCache(c, "corrupted content")
+
+	peer, err := url.Parse(s.peer.URL)
+	c.Assert(err, IsNil)
+	sto := s.newStore(c, &store.PeerConfig{
+		Peers: []*url.URL{peer},
+		Token: "secret",
+	}, nil)
+
+	path := filepath.Join(c.MkDir(), "foo.snap")
+	err = sto.Download(s.ctx, "foo", path, s.downloadInfo(), nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(path, testutil.FileEquals, s.content)
+	c.Check(osutil.FileExists(path+".peer"), Equals, false)
+	c.Check(s.storeHits, Equals, 1)
+	c.Check(s.logbuf.String(), Matches, `(?s).*Cannot download foo from peer .*: sha3-384 mismatch for "foo".*`)
+}
+
+func (s *peersSuite) TestDownloadFromPeerSendsSignedToken(c *C) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	defer store.MockTimeNow(func() time.Time { return now })()
+
+	var auth string
+	peerSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		io.WriteString(w, s.content)
+	}))
+	defer peerSrv.Close()
+
+	peer, err := url.Parse(peerSrv.URL)
+	c.Assert(err, IsNil)
+	sto := s.newStore(c, &store.PeerConfig{
+		Peers: []*url.URL{peer},
+		Token: "secret",
+	}, nil)
+
+	path := filepath.Join(c.MkDir(), "foo.snap")
+	err = sto.Download(s.ctx, "foo", path, s.downloadInfo(), nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(s.storeHits, Equals, 0)
+	c.Check(auth, Equals, "Bearer "+store.PeerDownloadToken("secret", s.sha3_384, now.Add(10*time.Minute)))
+	c.Check(auth, Not(testutil.Contains), "secret")
+}
+
+func (s *peersSuite) TestDownloadFromPeerTooLongFallsBackToStore(c *C) {
+	peerSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, s.content+" and more")
+	}))
+	defer peerSrv.Close()
+
+	peer, err := url.Parse(peerSrv.URL)
+	c.Assert(err, IsNil)
+	sto := s.newStore(c, &store.PeerConfig{
+		Peers: []*url.URL{peer},
+		Token: "secret",
+	}, nil)
+
+	path := filepath.Join(c.MkDir(), "foo.snap")
+	err = sto.Download(s.ctx, "foo", path, s.downloadInfo(), nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(path, testutil.FileEquals, s.content)
+	c.Check(osutil.FileExists(path+".peer"), Equals, false)
+	c.Check(s.storeHits, Equals, 1)
+	c.Check(s.logbuf.String(), Matches, `(?s).*Cannot download foo from peer .*: peer sent more than the expected 17 bytes.*`)
+}
+
+func (s *peersSuite) TestDownloadFromPeerWrongTokenFallsBackToStore(c *C) {
+	s.putInPeerCache(c, s.content)
+
+	peer, err := url.Parse(s.peer.URL)
+	c.Assert(err, IsNil)
+	sto := s.newStore(c, &store.PeerConfig{
+		Peers: []*url.URL{peer},
+		Token: "not-the-secret",
+	}, nil)
+
+	path := filepath.Join(c.MkDir(), "foo.snap")
+	err = sto.Download(s.ctx, "foo", path, s.downloadInfo(), nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(path, testutil.FileEquals, s.content)
+	c.Check(s.storeHits, Equals, 1)
+}
+
+func (s *peersSuite) TestDownloadPeerConfigError(c *C) {
+	sto := s.newStore(c, nil, errors.New("boom"))
+
+	path := filepath.Join(c.MkDir(), "foo.snap")
+	err := sto.Download(s.ctx, "foo", path, s.downloadInfo(), nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(path, testutil.FileEquals, s.content)
+	c.Check(s.storeHits, Equals, 1)
+	c.Check(s.logbuf.String(), Matches, `(?s).*Cannot get download peers: boom.*`)
+}
@@ -115,6 +115,10 @@ type Config struct {
 	// Proxy returns the HTTP proxy to use when talking to the store
 	Proxy func(*http.Request) (*url.URL, error)
 
+	// Peers returns the local network peers to try before downloading
+	// snaps from the store, it can be nil.
+	Peers func() (*PeerConfig, error)
+
 	// AssertionMaxFormats if set provides a way to override
 	// the assertion max formats sent to the store as supported.
 	AssertionMaxFormats map[string]int
@@ -174,8 +178,12 @@ type Store struct {
 	xdeltaCheckLock sync.Mutex
 	// whether we should use deltas or not
 	shouldUseDeltas *bool
-	// which xdelta3 we picked when we checked the deltas
+	// which xdelta3 we picked when we checked the deltas, unset if the
+	// built-in decoder is used
 	xdelta3CmdFunc func(args ...string) *exec.Cmd
+
+	deltaStatsLock sync.Mutex
+	deltaStats     DeltaStats
 }
 
 var ErrTooManyRequests = errors.New("too many requests")
@@ -47,6 +47,7 @@ import (
 	"github.com/snapcore/snapd/progress"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snapdtool"
+	"github.com/snapcore/snapd/store/vcdiff"
 )
 
 var commandFromSystemSnap = snapdtool.CommandFromSystemSnap
@@ -105,6 +106,10 @@ func (s *Store) useDeltas() (use bool) {
 	// TODO: have a per-format checker instead, we currently only support
 	// xdelta3 as a format for deltas
 
+	// an xdelta3 binary is preferred as it supports secondary compression,
+	// which the built-in decoder does not; s.xdelta3CmdFunc is left unset
+	// when the built-in decoder is used
+
 	// check if the xdelta3 config command works from the system snap
 	cmd, err := commandFromSystemSnap("/usr/bin/xdelta3", "config")
 	if err == nil {
@@ -138,15 +143,15 @@ func (s *Store) useDeltas() (use bool) {
 	// trying xdelta3 from the system
 	loc, err := exec.LookPath("xdelta3")
 	if err != nil {
-		// no xdelta3 in the env, so no deltas
-		logger.Noticef("no host system xdelta3 available to use deltas")
-		return false
+		// no xdelta3 in the env, use the built-in decoder
+		logger.Noticef("no host system xdelta3 available, using built-in delta decoder")
+		return true
 	}
 
 	if err := exec.Command(loc, "config").Run(); err != nil {
-		// xdelta3 in the env failed to run, so no deltas
-		logger.Noticef("unable to use host system xdelta3, running config command failed: %v", err)
-		return false
+		// xdelta3 in the env failed to run, use the built-in decoder
+		logger.Noticef("unable to use host system xdelta3, running config command failed: %v, using built-in delta decoder", err)
+		return true
 	}
 
 	// the xdelta3 in the env worked, so use that one
@@ -208,11 +213,16 @@ func (s *Store) Download(ctx context.Context, name string, targetPath string, do
 		return nil
 	}
 
+	if s.downloadFromPeers(ctx, name, targetPath, downloadInfo, pbar) {
+		return s.cacher.Put(downloadInfo.Sha3_384, targetPath)
+	}
+
 	if s.useDeltas() {
 		logger.Debugf("Available deltas returned by store: %v", downloadInfo.Deltas)
 
 		if len(downloadInfo.Deltas) == 1 {
 			err := s.downloadAndApplyDelta(name, targetPath, downloadInfo, pbar, user, dlOpts)
+			s.recordDelta(downloadInfo, err)
 			if err == nil {
 				// try to place the file in the cacher
 				if err = s.cacher.Put(downloadInfo.Sha3_384, targetPath); err == nil {
@@ -667,11 +677,50 @@ func (s *Store) downloadDelta(deltaName string, downloadInfo *snap.DownloadInfo,
 		return fmt.Errorf("store returned unsupported delta format %q (only xdelta3 currently)", deltaInfo.Format)
 	}
 
+	if s.useDeltas() && s.xdelta3CmdFunc == nil {
+		// the built-in decoder does not support all the features of
+		// xdelta3, check that it can apply the delta before downloading
+		// it entirely
+		if err := s.checkDeltaHeader(&deltaInfo, user); err != nil {
+			return err
+		}
+	}
+
 	url := deltaInfo.DownloadURL
 
 	return download(context.TODO(), deltaName, deltaInfo.Sha3_384, url, user, s, w, 0, pbar, dlOpts)
 }
 
+// deltaHeaderSize is the size of the start of a delta that is enough to
+// check its header.
+const deltaHeaderSize = 16
+
+// checkDeltaHeader retrieves the start of the delta and checks that its header
+// does not use features which the built-in decoder does not support.
+func (s *Store) checkDeltaHeader(deltaInfo *snap.DeltaInfo, user *auth.UserState) error {
+	storeURL, err := url.Parse(deltaInfo.DownloadURL)
+	if err != nil {
+		return err
+	}
+	cdnHeader, err := s.cdnHeader()
+	if err != nil {
+		return err
+	}
+	resp, err := doDownloadReq(context.TODO(), storeURL, cdnHeader, 0, s, user)
+	if err != nil {
+		return fmt.Errorf("cannot check delta: %v", err)
+	}
+	// the rest of the delta is not read
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("cannot check delta: unexpected status code %d", resp.StatusCode)
+	}
+	if err := vcdiff.CheckHeader(io.LimitReader(resp.Body, deltaHeaderSize)); err != nil {
+		return fmt.Errorf("cannot apply delta with the built-in decoder: %w", err)
+	}
+	return nil
+}
+
 // applyDelta generates a target snap from a previously downloaded snap and a downloaded delta.
 var applyDelta = func(s *Store, name string, deltaPath string, deltaInfo *snap.DeltaInfo, targetPath string, targetSha3_384 string) error {
 	return s.applyDeltaImpl(name, deltaPath, deltaInfo, targetPath, targetSha3_384)
@@ -691,18 +740,23 @@ func (s *Store) applyDeltaImpl(name string, deltaPath string, deltaInfo *snap.De
 
 	partialTargetPath := targetPath + ".partial"
 
-	xdelta3Args := []string{"-d", "-s", snapPath, deltaPath, partialTargetPath}
-
-	// validity check that deltas are available and that the path for the xdelta3
-	// command is set
+	// validity check that deltas are available
 	if ok := s.useDeltas(); !ok {
 		return fmt.Errorf("internal error: applyDelta used when deltas are not available")
 	}
 
-	// run the xdelta3 command, cleaning up if we fail and logging about it
-	if runErr := s.xdelta3CmdFunc(xdelta3Args...).Run(); runErr != nil {
+	var runErr error
+	if s.xdelta3CmdFunc != nil {
+		// run the xdelta3 command
+		xdelta3Args := []string{"-d", "-s", snapPath, deltaPath, partialTargetPath}
+		runErr = s.xdelta3CmdFunc(xdelta3Args...).Run()
+	} else {
+		runErr = applyNativeDelta(snapPath, deltaPath, partialTargetPath)
+	}
+	// clean up if we failed and log about it
+	if runErr != nil {
 		logger.Noticef("encountered error applying delta: %v", runErr)
-		if err := os.Remove(partialTargetPath); err != nil {
+		if err := os.Remove(partialTargetPath); err != nil && !os.IsNotExist(err) {
 			logger.Noticef("error cleaning up partial delta target %q: %s", partialTargetPath, err)
 		}
 		return runErr
@@ -731,6 +785,36 @@ func (s *Store) applyDeltaImpl(name string, deltaPath string, deltaInfo *snap.De
 	return nil
 }
 
+// applyNativeDelta applies an xdelta3 delta with the built-in decoder.
+func applyNativeDelta(sourcePath, deltaPath, targetPath string) (err error) {
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	delta, err := os.Open(deltaPath)
+	if err != nil {
+		return err
+	}
+	defer delta.Close()
+
+	target, err := os.OpenFile(targetPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := target.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	if err := vcdiff.Apply(source, delta, target); err != nil {
+		return err
+	}
+	return target.Sync()
+}
+
 // downloadAndApplyDelta downloads and then applies the delta to the current snap.
 func (s *Store) downloadAndApplyDelta(name, targetPath string, downloadInfo *snap.DownloadInfo, pbar progress.Meter, user *auth.UserState, dlOpts *DownloadOptions) error {
 	deltaInfo := &downloadInfo.Deltas[0]
@@ -763,6 +847,40 @@ func (s *Store) downloadAndApplyDelta(name, targetPath string, downloadInfo *sna
 	return nil
 }
 
+// DeltaStats holds counters about the use of deltas by a store.
+type DeltaStats struct {
+	// Applied is the number of snaps obtained by applying a delta.
+	Applied int `json:"applied"`
+	// Failed is the number of deltas that could not be downloaded or
+	// applied, in which case the full snap was downloaded instead.
+	Failed int `json:"failed"`
+	// BytesSaved is the difference between the size of the snaps obtained
+	// by applying deltas and the size of those deltas.
+	BytesSaved int64 `json:"bytes-saved"`
+}
+
+func (s *Store) recordDelta(downloadInfo *snap.DownloadInfo, err error) {
+	s.deltaStatsLock.Lock()
+	defer s.deltaStatsLock.Unlock()
+
+	if err != nil {
+		s.deltaStats.Failed++
+		return
+	}
+	s.deltaStats.Applied++
+	if saved := downloadInfo.Size - downloadInfo.Deltas[0].Size; saved > 0 {
+		s.deltaStats.BytesSaved += saved
+	}
+	logger.Debugf("Deltas saved %d bytes in total (%d applied, %d failed).", s.deltaStats.BytesSaved, s.deltaStats.Applied, s.deltaStats.Failed)
+}
+
+// DeltaStats returns the counters about the use of deltas by the store.
+func (s *Store) DeltaStats() DeltaStats {
+	s.deltaStatsLock.Lock()
+	defer s.deltaStatsLock.Unlock()
+	return s.deltaStats
+}
+
 func (s *Store) CacheDownloads() int {
 	return s.cfg.CacheDownloads
 }
@@ -23,12 +23,14 @@ import (
 	"bytes"
 	"context"
 	"crypto"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"time"
 
@@ -633,6 +635,68 @@ func (s *storeDownloadSuite) TestDownloadDelta(c *C) {
 	}
 }
 
+func (s *storeDownloadSuite) TestDownloadDeltaBuiltinDecoderChecksHeader(c *C) {
+	// no xdelta3 anywhere
+	s.mockXDelta.Restore()
+	restore := store.MockSnapdtoolCommandFromSystemSnap(func(name string, args ...string) (*exec.Cmd, error) {
+		return nil, errors.New("no system snap")
+	})
+	defer restore()
+	origPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", origPath)
+	os.Setenv("PATH", "")
+
+	info := &snap.DownloadInfo{
+		Sha3_384: "sha3",
+		Deltas: []snap.DeltaInfo{
+			{DownloadURL: "http://example.com/delta-url", Format: "xdelta3", FromRevision: 24, ToRevision: 26},
+		},
+	}
+
+	for _, tc := range []struct {
+		header []byte
+		err    string
+	}{
+		// no secondary compression
+		{[]byte{0xd6, 0xc3, 0xc4, 0x00, 0x04, 0x05, 'h', 'e', 'l', 'l', 'o'}, ""},
+		// secondary compression
+		{[]byte{0xd6, 0xc3, 0xc4, 0x00, 0x05, 0x02, 0x05, 'h', 'e', 'l', 'l', 'o'}, `cannot apply delta with the built-in decoder: unsupported vcdiff feature: secondary compression \(id 2\)`},
+	} {
+		sto := store.New(&store.Config{}, nil)
+		var probed []string
+		restore := store.MockDoDownloadReq(func(ctx context.Context, storeURL *url.URL, cdnHeader string, resume int64, s *store.Store, user *auth.UserState) (*http.Response, error) {
+			c.Check(resume, Equals, int64(0))
+			probed = append(probed, storeURL.String())
+			return &http.Response{
+				StatusCode: 200,
+				Body:       io.NopCloser(bytes.NewReader(append(tc.header, make([]byte, 1024)...))),
+			}, nil
+		})
+		defer restore()
+		downloaded := false
+		restore = store.MockDownload(func(ctx context.Context, name, sha3, url string, user *auth.UserState, _ *store.Store, w io.ReadWriteSeeker, resume int64, pbar progress.Meter, dlOpts *store.DownloadOptions) error {
+			downloaded = true
+			return nil
+		})
+		defer restore()
+
+		w, err := os.CreateTemp(c.MkDir(), "")
+		c.Assert(err, IsNil)
+		defer w.Close()
+
+		err = sto.DownloadDelta("snapname", info, w, nil, nil, nil)
+		c.Check(probed, DeepEquals, []string{"http://example.com/delta-url"})
+		if tc.err == "" {
+			c.Check(err, IsNil)
+			c.Check(downloaded, Equals, true)
+		} else {
+			// the delta is not downloaded
+			c.Check(err, ErrorMatches, tc.err)
+			c.Check(downloaded, Equals, false)
+		}
+	}
+}
+
 var applyDeltaTests = []struct {
 	deltaInfo       snap.DeltaInfo
 	currentRevision uint
@@ -706,6 +770,59 @@ func (s *storeDownloadSuite) TestApplyDelta(c *C) {
 	}
 }
 
+func (s *storeDownloadSuite) TestApplyDeltaBuiltinDecoder(c *C) {
+	// no xdelta3 anywhere
+	s.mockXDelta.Restore()
+	restore := store.MockSnapdtoolCommandFromSystemSnap(func(name string, args ...string) (*exec.Cmd, error) {
+		return nil, errors.New("no system snap")
+	})
+	defer restore()
+	origPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", origPath)
+	os.Setenv("PATH", "")
+
+	currentSnapPath := filepath.Join(dirs.SnapBlobDir, "foo_1.snap")
+	c.Assert(os.MkdirAll(dirs.SnapBlobDir, 0755), IsNil)
+	c.Assert(os.WriteFile(currentSnapPath, []byte("hello world"), 0644), IsNil)
+
+	// a vcdiff delta copying "hello " and "world" from the source, with
+	// "there " added in between
+	delta := []byte{
+		0xd6, 0xc3, 0xc4, 0x00, 0x00,
+		// window with a source segment of 11 bytes at 0
+		0x01, 11, 0,
+		// delta encoding length and target window length
+		15, 17, 0x00,
+		// data, instructions and addresses lengths
+		6, 3, 2,
+		't', 'h', 'e', 'r', 'e', ' ',
+		// COPY 6, ADD 6, COPY 5
+		22, 7, 21,
+		0, 6,
+	}
+	deltaPath := filepath.Join(dirs.SnapBlobDir, "the.delta")
+	c.Assert(os.WriteFile(deltaPath, delta, 0644), IsNil)
+
+	expected := "hello there world"
+	targetSnapPath := filepath.Join(dirs.SnapBlobDir, "foo_2.snap")
+	deltaInfo := &snap.DeltaInfo{FromRevision: 1, ToRevision: 2, Format: "xdelta3"}
+
+	sto := &store.Store{}
+	err := store.ApplyDelta(sto, "foo", deltaPath, deltaInfo, targetSnapPath, fmt.Sprintf("%x", sha3.Sum384([]byte(expected))))
+	c.Assert(err, IsNil)
+	c.Check(sto.UsesBuiltinDeltaDecoder(), Equals, true)
+	c.Check(targetSnapPath, testutil.FileEquals, expected)
+	c.Check(osutil.FileExists(targetSnapPath+".partial"), Equals, false)
+
+	// a broken delta leaves nothing behind
+	c.Assert(os.Remove(targetSnapPath), IsNil)
+	c.Assert(os.WriteFile(deltaPath, delta[:20], 0644), IsNil)
+	err = store.ApplyDelta(sto, "foo", deltaPath, deltaInfo, targetSnapPath, "")
+	c.Assert(err, ErrorMatches, "cannot read vcdiff window: unexpected EOF")
+	c.Check(osutil.FileExists(targetSnapPath+".partial"), Equals, false)
+	c.Check(osutil.FileExists(targetSnapPath), Equals, false)
+}
+
 type cacheObserver struct {
 	inCache map[string]bool
 
@@ -0,0 +1,195 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package vcdiff
+
+import (
+	"errors"
+	"io"
+)
+
+type instType byte
+
+const (
+	noop instType = iota
+	add
+	run
+	copyInst
+)
+
+type instruction struct {
+	typ  instType
+	size byte
+	mode byte
+}
+
+// defaultCodeTable is the default instruction code table, see section 5.6
+// of RFC 3284. Each code is a pair of instructions, the second is often a
+// noop.
+var defaultCodeTable = buildDefaultCodeTable()
+
+// number of modes of the address cache
+const (
+	nearSize = 4
+	sameSize = 3
+	numModes = 2 + nearSize + sameSize
+)
+
+func buildDefaultCodeTable() (table [256][2]instruction) {
+	i := 0
+	next := func(first, second instruction) {
+		table[i] = [2]instruction{first, second}
+		i++
+	}
+
+	next(instruction{typ: run}, instruction{})
+	for size := 0; size <= 17; size++ {
+		next(instruction{typ: add, size: byte(size)}, instruction{})
+	}
+	for mode := 0; mode < numModes; mode++ {
+		next(instruction{typ: copyInst, mode: byte(mode)}, instruction{})
+		for size := 4; size <= 18; size++ {
+			next(instruction{typ: copyInst, size: byte(size), mode: byte(mode)}, instruction{})
+		}
+	}
+	for mode := 0; mode < 6; mode++ {
+		for addSize := 1; addSize <= 4; addSize++ {
+			for copySize := 4; copySize <= 6; copySize++ {
+				next(instruction{typ: add, size: byte(addSize)},
+					instruction{typ: copyInst, size: byte(copySize), mode: byte(mode)})
+			}
+		}
+	}
+	for mode := 6; mode < numModes; mode++ {
+		for addSize := 1; addSize <= 4; addSize++ {
+			next(instruction{typ: add, size: byte(addSize)},
+				instruction{typ: copyInst, size: 4, mode: byte(mode)})
+		}
+	}
+	for mode := 0; mode < numModes; mode++ {
+		next(instruction{typ: copyInst, size: 4, mode: byte(mode)},
+			instruction{typ: add, size: 1})
+	}
+
+	return table
+}
+
+// addressCache implements the caching of copy addresses described in
+// section 5.1 of RFC 3284. The zero value is a reset cache.
+type addressCache struct {
+	near     [nearSize]uint64
+	nextSlot int
+	same     [sameSize * 256]uint64
+}
+
+const (
+	modeSelf = 0
+	modeHere = 1
+)
+
+// decode decodes an address in the given mode, reading from the address
+// section, and updates the cache.
+func (c *addressCache) decode(mode byte, here uint64, addrs *[]byte) (addr uint64, err error) {
+	switch {
+	case mode == modeSelf:
+		addr, err = readIntFrom(addrs)
+	case mode == modeHere:
+		var offset uint64
+		offset, err = readIntFrom(addrs)
+		if err == nil && offset > here {
+			return 0, errors.New("invalid copy address")
+		}
+		addr = here - offset
+	case int(mode) < 2+nearSize:
+		var offset uint64
+		offset, err = readIntFrom(addrs)
+		addr = c.near[mode-2] + offset
+	case int(mode) < numModes:
+		if len(*addrs) == 0 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		b := (*addrs)[0]
+		*addrs = (*addrs)[1:]
+		addr = c.same[(int(mode)-(2+nearSize))*256+int(b)]
+	default:
+		return 0, errInvalidInstruction
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	c.near[c.nextSlot] = addr
+	c.nextSlot = (c.nextSlot + 1) % nearSize
+	c.same[addr%(sameSize*256)] = addr
+	return addr, nil
+}
+
+// maxIntBytes is the number of bytes needed to encode a 64 bit integer.
+const maxIntBytes = 10
+
+var errIntOverflow = errors.New("integer overflow")
+
+// readInt reads a VCDIFF variable length integer, made of 7 bit digits,
+// most significant first, with the high bit set in all but the last byte.
+func readInt(r io.ByteReader) (uint64, error) {
+	var v uint64
+	for i := 0; i < maxIntBytes; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, unexpectedEOF(err)
+		}
+		if v > (1<<64-1)>>7 {
+			return 0, errIntOverflow
+		}
+		v = v<<7 | uint64(b&0x7f)
+		if b&0x80 == 0 {
+			return v, nil
+		}
+	}
+	return 0, errIntOverflow
+}
+
+func readInt64(r io.ByteReader) (int64, error) {
+	v, err := readInt(r)
+	if err != nil {
+		return 0, err
+	}
+	if v > 1<<63-1 {
+		return 0, errIntOverflow
+	}
+	return int64(v), nil
+}
+
+type sliceReader struct {
+	buf *[]byte
+}
+
+func (r sliceReader) ReadByte() (byte, error) {
+	if len(*r.buf) == 0 {
+		return 0, io.EOF
+	}
+	b := (*r.buf)[0]
+	*r.buf = (*r.buf)[1:]
+	return b, nil
+}
+
+// readIntFrom reads an integer from the start of the buffer, advancing it.
+func readIntFrom(buf *[]byte) (uint64, error) {
+	return readInt(sliceReader{buf})
+}
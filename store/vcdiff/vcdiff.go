@@ -0,0 +1,386 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package vcdiff implements a decoder for the VCDIFF generic differencing
+// and compression data format described in RFC 3284, which is the format of
+// the deltas produced by xdelta3.
+//
+// The xdelta3 extensions for application headers and window checksums are
+// supported; secondary compression and custom code tables are not.
+package vcdiff
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"hash/adler32"
+	"io"
+)
+
+var magic = [4]byte{0xd6, 0xc3, 0xc4, 0x00}
+
+// header indicator bits
+const (
+	vcdDecompress = 1 << iota
+	vcdCodeTable
+	// xdelta3 extension
+	vcdAppHeader
+)
+
+// window indicator bits
+const (
+	vcdSource = 1 << iota
+	vcdTarget
+	// xdelta3 extension
+	vcdAdler32
+)
+
+// delta indicator bits
+const (
+	vcdDataComp = 1 << iota
+	vcdInstComp
+	vcdAddrComp
+)
+
+// maxWindowSize is the largest target window that is decoded. xdelta3
+// windows are at most 16MiB.
+const maxWindowSize = 64 * 1024 * 1024
+
+// ErrUnsupported is returned when the delta uses VCDIFF features that are
+// not supported by the decoder.
+var ErrUnsupported = errors.New("unsupported vcdiff feature")
+
+// Apply decodes the delta read from delta against the source and writes the
+// result to target. Deltas with windows whose source segment is taken from
+// the target (VCD_TARGET) are only supported if target is also an
+// io.ReaderAt.
+func Apply(source io.ReaderAt, delta io.Reader, target io.Writer) error {
+	d := &decoder{
+		r:      bufio.NewReader(delta),
+		source: source,
+		target: target,
+	}
+	if ra, ok := target.(io.ReaderAt); ok {
+		d.targetReader = ra
+	}
+	return d.decode()
+}
+
+type decoder struct {
+	r      *bufio.Reader
+	source io.ReaderAt
+
+	target       io.Writer
+	targetReader io.ReaderAt
+	// written is the number of bytes written to target so far
+	written int64
+}
+
+// CheckHeader reads the header of the delta read from delta and returns an
+// error if the delta uses VCDIFF features, such as secondary compression,
+// that are not supported by the decoder. It reads the first few bytes of the
+// delta only, so that unsupported deltas can be told apart without
+// retrieving them entirely.
+func CheckHeader(delta io.Reader) error {
+	d := &decoder{r: bufio.NewReaderSize(delta, 16)}
+	_, err := d.decodeHeader()
+	return err
+}
+
+func (d *decoder) decode() error {
+	indicator, err := d.decodeHeader()
+	if err != nil {
+		return err
+	}
+	if indicator&vcdAppHeader != 0 {
+		n, err := readInt(d.r)
+		if err != nil {
+			return fmt.Errorf("cannot read vcdiff application header: %v", err)
+		}
+		if n > maxWindowSize {
+			return fmt.Errorf("cannot read vcdiff application header of %d bytes", n)
+		}
+		if _, err := d.r.Discard(int(n)); err != nil {
+			return fmt.Errorf("cannot read vcdiff application header: %v", unexpectedEOF(err))
+		}
+	}
+
+	for {
+		if _, err := d.r.Peek(1); err == io.EOF {
+			return nil
+		}
+		if err := d.decodeWindow(); err != nil {
+			return err
+		}
+	}
+}
+
+// decodeHeader decodes the header of the delta up to its application header,
+// returning the header indicator.
+func (d *decoder) decodeHeader() (indicator byte, err error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(d.r, hdr[:]); err != nil {
+		return 0, fmt.Errorf("cannot read vcdiff header: %v", unexpectedEOF(err))
+	}
+	if hdr[0] != magic[0] || hdr[1] != magic[1] || hdr[2] != magic[2] {
+		return 0, errors.New("invalid vcdiff header")
+	}
+	if hdr[3] != magic[3] {
+		return 0, fmt.Errorf("unsupported vcdiff version %d", hdr[3])
+	}
+
+	indicator, err = d.r.ReadByte()
+	if err != nil {
+		return 0, fmt.Errorf("cannot read vcdiff header: %v", unexpectedEOF(err))
+	}
+	if indicator&^(vcdDecompress|vcdCodeTable|vcdAppHeader) != 0 {
+		return 0, fmt.Errorf("invalid vcdiff header indicator %#x", indicator)
+	}
+	if indicator&vcdDecompress != 0 {
+		id, err := d.r.ReadByte()
+		if err != nil {
+			return 0, fmt.Errorf("cannot read vcdiff header: %v", unexpectedEOF(err))
+		}
+		// the compressor is only used if the windows say so
+		if id != 0 {
+			return 0, fmt.Errorf("%w: secondary compression (id %d)", ErrUnsupported, id)
+		}
+	}
+	if indicator&vcdCodeTable != 0 {
+		return 0, fmt.Errorf("%w: custom code table", ErrUnsupported)
+	}
+	return indicator, nil
+}
+
+// window holds the state needed to decode a single window.
+type window struct {
+	// source segment
+	sourceReader io.ReaderAt
+	sourcePos    int64
+	sourceLen    int64
+
+	target []byte
+	// pos is the position in target
+	pos int
+
+	data []byte
+	inst []byte
+	addr []byte
+
+	cache addressCache
+}
+
+func (d *decoder) decodeWindow() error {
+	indicator, err := d.r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("cannot read vcdiff window: %v", unexpectedEOF(err))
+	}
+	if indicator&^(vcdSource|vcdTarget|vcdAdler32) != 0 {
+		return fmt.Errorf("invalid vcdiff window indicator %#x", indicator)
+	}
+
+	w := &window{}
+	switch indicator & (vcdSource | vcdTarget) {
+	case vcdSource | vcdTarget:
+		return fmt.Errorf("invalid vcdiff window indicator %#x", indicator)
+	case vcdSource:
+		w.sourceReader = d.source
+	case vcdTarget:
+		if d.targetReader == nil {
+			return fmt.Errorf("%w: window with target as source", ErrUnsupported)
+		}
+		w.sourceReader = d.targetReader
+	}
+	if w.sourceReader != nil {
+		if w.sourceLen, err = readInt64(d.r); err != nil {
+			return fmt.Errorf("cannot read vcdiff window: %v", err)
+		}
+		if w.sourcePos, err = readInt64(d.r); err != nil {
+			return fmt.Errorf("cannot read vcdiff window: %v", err)
+		}
+		if indicator&vcdTarget != 0 && w.sourcePos+w.sourceLen > d.written {
+			return errors.New("invalid vcdiff window: source segment beyond decoded target")
+		}
+	}
+
+	// length of the delta encoding, which is implied by the lengths
+	// that follow
+	if _, err := readInt(d.r); err != nil {
+		return fmt.Errorf("cannot read vcdiff window: %v", err)
+	}
+	targetLen, err := readInt(d.r)
+	if err != nil {
+		return fmt.Errorf("cannot read vcdiff window: %v", err)
+	}
+	if targetLen > maxWindowSize {
+		return fmt.Errorf("cannot decode vcdiff window of %d bytes", targetLen)
+	}
+
+	deltaIndicator, err := d.r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("cannot read vcdiff window: %v", unexpectedEOF(err))
+	}
+	if deltaIndicator&^(vcdDataComp|vcdInstComp|vcdAddrComp) != 0 {
+		return fmt.Errorf("invalid vcdiff delta indicator %#x", deltaIndicator)
+	}
+	if deltaIndicator != 0 {
+		return fmt.Errorf("%w: secondary compression", ErrUnsupported)
+	}
+
+	var lens [3]uint64
+	for i := range lens {
+		if lens[i], err = readInt(d.r); err != nil {
+			return fmt.Errorf("cannot read vcdiff window: %v", err)
+		}
+		if lens[i] > maxWindowSize {
+			return fmt.Errorf("cannot decode vcdiff window with a %d bytes section", lens[i])
+		}
+	}
+
+	var checksum uint32
+	if indicator&vcdAdler32 != 0 {
+		var buf [4]byte
+		if _, err := io.ReadFull(d.r, buf[:]); err != nil {
+			return fmt.Errorf("cannot read vcdiff window: %v", unexpectedEOF(err))
+		}
+		checksum = uint32(buf[0])<<24 | uint32(buf[1])<<16 | uint32(buf[2])<<8 | uint32(buf[3])
+	}
+
+	sections := make([]byte, lens[0]+lens[1]+lens[2])
+	if _, err := io.ReadFull(d.r, sections); err != nil {
+		return fmt.Errorf("cannot read vcdiff window: %v", unexpectedEOF(err))
+	}
+	w.data = sections[:lens[0]]
+	w.inst = sections[lens[0] : lens[0]+lens[1]]
+	w.addr = sections[lens[0]+lens[1]:]
+	w.target = make([]byte, targetLen)
+
+	if err := w.run(); err != nil {
+		return fmt.Errorf("cannot decode vcdiff window: %v", err)
+	}
+
+	if indicator&vcdAdler32 != 0 && adler32.Checksum(w.target) != checksum {
+		return errors.New("cannot decode vcdiff window: checksum mismatch")
+	}
+
+	n, err := d.target.Write(w.target)
+	d.written += int64(n)
+	return err
+}
+
+var errInvalidInstruction = errors.New("invalid instruction")
+
+// run executes the instructions of the window, filling its target.
+func (w *window) run() error {
+	for len(w.inst) > 0 {
+		code := defaultCodeTable[w.inst[0]]
+		w.inst = w.inst[1:]
+
+		for _, in := range code {
+			if in.typ == noop {
+				continue
+			}
+			size := uint64(in.size)
+			if size == 0 {
+				var err error
+				if size, err = readIntFrom(&w.inst); err != nil {
+					return err
+				}
+			}
+			if size > uint64(len(w.target)-w.pos) {
+				return errors.New("instruction exceeds target window")
+			}
+			if err := w.exec(in.typ, in.mode, int(size)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if w.pos != len(w.target) {
+		return fmt.Errorf("decoded %d bytes but target window has %d", w.pos, len(w.target))
+	}
+	return nil
+}
+
+func (w *window) exec(typ instType, mode byte, size int) error {
+	switch typ {
+	case add:
+		if size > len(w.data) {
+			return errors.New("add exceeds data section")
+		}
+		copy(w.target[w.pos:], w.data[:size])
+		w.data = w.data[size:]
+	case run:
+		if len(w.data) == 0 {
+			return errors.New("run exceeds data section")
+		}
+		b := w.data[0]
+		w.data = w.data[1:]
+		for i := 0; i < size; i++ {
+			w.target[w.pos+i] = b
+		}
+	case copyInst:
+		here := uint64(w.sourceLen) + uint64(w.pos)
+		addr, err := w.cache.decode(mode, here, &w.addr)
+		if err != nil {
+			return err
+		}
+		if addr >= here {
+			return errors.New("copy address beyond current position")
+		}
+		if err := w.copy(int64(addr), size); err != nil {
+			return err
+		}
+	default:
+		return errInvalidInstruction
+	}
+	w.pos += size
+	return nil
+}
+
+// copy copies size bytes starting at addr, in the address space made of
+// the source segment followed by the target window, to the current position.
+func (w *window) copy(addr int64, size int) error {
+	dst := w.target[w.pos : w.pos+size]
+	if addr < w.sourceLen {
+		n := size
+		if int64(n) > w.sourceLen-addr {
+			n = int(w.sourceLen - addr)
+		}
+		if _, err := w.sourceReader.ReadAt(dst[:n], w.sourcePos+addr); err != nil {
+			return fmt.Errorf("cannot read source: %v", unexpectedEOF(err))
+		}
+		dst = dst[n:]
+		addr += int64(n)
+	}
+	// the copy may overlap with the bytes it produces, so it has to go
+	// byte by byte
+	from := int(addr - w.sourceLen)
+	for i := range dst {
+		dst[i] = w.target[from+i]
+	}
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
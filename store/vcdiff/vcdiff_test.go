@@ -0,0 +1,322 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package vcdiff_test
+
+import (
+	"bytes"
+	"errors"
+	"hash/adler32"
+	"strings"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/store/vcdiff"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type vcdiffSuite struct{}
+
+var _ = Suite(&vcdiffSuite{})
+
+// vcdInt encodes a VCDIFF variable length integer.
+func vcdInt(v uint64) []byte {
+	buf := []byte{byte(v & 0x7f)}
+	for v >>= 7; v > 0; v >>= 7 {
+		buf = append([]byte{byte(v&0x7f) | 0x80}, buf...)
+	}
+	return buf
+}
+
+type testWindow struct {
+	indicator byte
+	sourceLen uint64
+	sourcePos uint64
+	targetLen uint64
+	delta     byte
+	checksum  []byte
+
+	data, inst, addr []byte
+}
+
+func (w *testWindow) encode() []byte {
+	var enc []byte
+	enc = append(enc, vcdInt(w.targetLen)...)
+	enc = append(enc, w.delta)
+	enc = append(enc, vcdInt(uint64(len(w.data)))...)
+	enc = append(enc, vcdInt(uint64(len(w.inst)))...)
+	enc = append(enc, vcdInt(uint64(len(w.addr)))...)
+	enc = append(enc, w.checksum...)
+	enc = append(enc, w.data...)
+	enc = append(enc, w.inst...)
+	enc = append(enc, w.addr...)
+
+	buf := []byte{w.indicator}
+	if w.indicator&0x03 != 0 {
+		buf = append(buf, vcdInt(w.sourceLen)...)
+		buf = append(buf, vcdInt(w.sourcePos)...)
+	}
+	buf = append(buf, vcdInt(uint64(len(enc)))...)
+	return append(buf, enc...)
+}
+
+func delta(windows ...*testWindow) []byte {
+	buf := []byte{0xd6, 0xc3, 0xc4, 0x00, 0x00}
+	for _, w := range windows {
+		buf = append(buf, w.encode()...)
+	}
+	return buf
+}
+
+// targetBuffer is a target that can also be read from, as a file would be.
+type targetBuffer struct {
+	bytes.Buffer
+}
+
+func (b *targetBuffer) ReadAt(p []byte, off int64) (int, error) {
+	return bytes.NewReader(b.Bytes()).ReadAt(p, off)
+}
+
+func (s *vcdiffSuite) apply(c *C, source string, delta []byte) (string, error) {
+	var target targetBuffer
+	err := vcdiff.Apply(strings.NewReader(source), bytes.NewReader(delta), &target)
+	return target.String(), err
+}
+
+func (s *vcdiffSuite) TestCopyFromSourceAndAdd(c *C) {
+	d := delta(&testWindow{
+		indicator: 0x01,
+		sourceLen: 11,
+		targetLen: 18,
+		data:      []byte("there !"),
+		// COPY 6 mode 0, ADD 6, COPY 5 mode 0, ADD 1
+		inst: []byte{22, 7, 21, 2},
+		addr: []byte{0, 6},
+	})
+
+	target, err := s.apply(c, "hello world", d)
+	c.Assert(err, IsNil)
+	c.Check(target, Equals, "hello there world!")
+}
+
+func (s *vcdiffSuite) TestSourceSegmentPosition(c *C) {
+	d := delta(&testWindow{
+		indicator: 0x01,
+		sourceLen: 5,
+		sourcePos: 6,
+		targetLen: 5,
+		// COPY 5 mode 0
+		inst: []byte{21},
+		addr: []byte{0},
+	})
+
+	target, err := s.apply(c, "hello world", d)
+	c.Assert(err, IsNil)
+	c.Check(target, Equals, "world")
+}
+
+func (s *vcdiffSuite) TestRunAndOverlappingCopy(c *C) {
+	d := delta(&testWindow{
+		targetLen: 12,
+		data:      []byte("abz"),
+		// ADD 2, COPY 6 mode here, RUN with explicit size 4
+		inst: []byte{3, 38, 0, 4},
+		addr: []byte{2},
+	})
+
+	target, err := s.apply(c, "", d)
+	c.Assert(err, IsNil)
+	c.Check(target, Equals, "ababababzzzz")
+}
+
+func (s *vcdiffSuite) TestExplicitSizes(c *C) {
+	d := delta(&testWindow{
+		indicator: 0x01,
+		sourceLen: 26,
+		targetLen: 46,
+		data:      []byte("0123456789!"),
+		// ADD explicit 10, COPY explicit 26 mode 0, COPY explicit 9 mode 0,
+		// ADD 1
+		inst: []byte{1, 10, 19, 26, 19, 9, 2},
+		addr: []byte{0, 26},
+	})
+
+	target, err := s.apply(c, "abcdefghijklmnopqrstuvwxyz", d)
+	c.Assert(err, IsNil)
+	c.Check(target, Equals, "0123456789abcdefghijklmnopqrstuvwxyz012345678!")
+}
+
+func (s *vcdiffSuite) TestAddressCacheModes(c *C) {
+	d := delta(&testWindow{
+		indicator: 0x01,
+		sourceLen: 10,
+		targetLen: 14,
+		data:      []byte("x!"),
+		// COPY 4 mode 0, ADD 1 + COPY 4 mode near 0, COPY 4 mode same 0 +
+		// ADD 1
+		inst: []byte{20, 187, 253},
+		addr: []byte{2, 4, 6},
+	})
+
+	target, err := s.apply(c, "0123456789", d)
+	c.Assert(err, IsNil)
+	c.Check(target, Equals, "2345x67896789!")
+}
+
+func (s *vcdiffSuite) TestChecksumAndAppHeader(c *C) {
+	w := &testWindow{
+		indicator: 0x01 | 0x04,
+		sourceLen: 5,
+		targetLen: 8,
+		data:      []byte("!!!"),
+		// COPY 5 mode 0, ADD 3
+		inst: []byte{21, 4},
+		addr: []byte{0},
+	}
+	sum := adler32.Checksum([]byte("hello!!!"))
+	w.checksum = []byte{byte(sum >> 24), byte(sum >> 16), byte(sum >> 8), byte(sum)}
+
+	d := []byte{0xd6, 0xc3, 0xc4, 0x00, 0x04}
+	d = append(d, vcdInt(9)...)
+	d = append(d, "file/file"...)
+	d = append(d, w.encode()...)
+
+	target, err := s.apply(c, "hello", d)
+	c.Assert(err, IsNil)
+	c.Check(target, Equals, "hello!!!")
+
+	w.checksum[3]++
+	_, err = s.apply(c, "hello", delta(w))
+	c.Check(err, ErrorMatches, "cannot decode vcdiff window: checksum mismatch")
+}
+
+func (s *vcdiffSuite) TestMultipleWindowsWithTargetSource(c *C) {
+	d := delta(&testWindow{
+		indicator: 0x01,
+		sourceLen: 5,
+		targetLen: 5,
+		inst:      []byte{21},
+		addr:      []byte{0},
+	}, &testWindow{
+		indicator: 0x02,
+		sourceLen: 4,
+		sourcePos: 1,
+		targetLen: 6,
+		data:      []byte("!!"),
+		// COPY 4 mode 0, ADD 2
+		inst: []byte{20, 3},
+		addr: []byte{0},
+	})
+
+	target, err := s.apply(c, "hello", d)
+	c.Assert(err, IsNil)
+	c.Check(target, Equals, "helloello!!")
+
+	// target windows need a target that can be read
+	var buf bytes.Buffer
+	err = vcdiff.Apply(strings.NewReader("hello"), bytes.NewReader(d), &buf)
+	c.Check(errors.Is(err, vcdiff.ErrUnsupported), Equals, true)
+	c.Check(err, ErrorMatches, "unsupported vcdiff feature: window with target as source")
+}
+
+func (s *vcdiffSuite) TestEmpty(c *C) {
+	target, err := s.apply(c, "hello", delta())
+	c.Assert(err, IsNil)
+	c.Check(target, Equals, "")
+}
+
+func (s *vcdiffSuite) TestUnsupported(c *C) {
+	for _, d := range [][]byte{
+		// secondary compressor
+		{0xd6, 0xc3, 0xc4, 0x00, 0x01, 0x02},
+		// custom code table
+		{0xd6, 0xc3, 0xc4, 0x00, 0x02, 0x00},
+		// compressed sections
+		delta(&testWindow{targetLen: 1, delta: 0x01, data: []byte("a"), inst: []byte{2}}),
+	} {
+		_, err := s.apply(c, "", d)
+		c.Check(errors.Is(err, vcdiff.ErrUnsupported), Equals, true, Commentf("%v", err))
+	}
+}
+
+func (s *vcdiffSuite) TestCheckHeader(c *C) {
+	// only the header is read
+	c.Check(vcdiff.CheckHeader(bytes.NewReader([]byte{0xd6, 0xc3, 0xc4, 0x00, 0x04, 0xff})), IsNil)
+	c.Check(vcdiff.CheckHeader(bytes.NewReader(delta(&testWindow{targetLen: 1, data: []byte("a"), inst: []byte{2}}))), IsNil)
+	// a compressor id of 0 stands for no secondary compression
+	c.Check(vcdiff.CheckHeader(bytes.NewReader([]byte{0xd6, 0xc3, 0xc4, 0x00, 0x01, 0x00})), IsNil)
+
+	err := vcdiff.CheckHeader(bytes.NewReader([]byte{0xd6, 0xc3, 0xc4, 0x00, 0x01, 0x02}))
+	c.Check(err, ErrorMatches, `unsupported vcdiff feature: secondary compression \(id 2\)`)
+	c.Check(errors.Is(err, vcdiff.ErrUnsupported), Equals, true)
+	err = vcdiff.CheckHeader(bytes.NewReader([]byte{0xd6, 0xc3, 0xc4, 0x00, 0x02}))
+	c.Check(errors.Is(err, vcdiff.ErrUnsupported), Equals, true)
+	c.Check(vcdiff.CheckHeader(bytes.NewReader([]byte("hello"))), ErrorMatches, "invalid vcdiff header")
+	c.Check(vcdiff.CheckHeader(bytes.NewReader([]byte{0xd6, 0xc3})), ErrorMatches, "cannot read vcdiff header: unexpected EOF")
+}
+
+func (s *vcdiffSuite) TestErrors(c *C) {
+	for _, tc := range []struct {
+		delta []byte
+		err   string
+	}{
+		{[]byte{0xd6, 0xc3}, "cannot read vcdiff header: unexpected EOF"},
+		{[]byte("hello"), "invalid vcdiff header"},
+		{[]byte{0xd6, 0xc3, 0xc4, 0x01, 0x00}, "unsupported vcdiff version 1"},
+		{[]byte{0xd6, 0xc3, 0xc4, 0x00, 0x08}, "invalid vcdiff header indicator 0x8"},
+		{[]byte{0xd6, 0xc3, 0xc4, 0x00, 0x00, 0x03}, "invalid vcdiff window indicator 0x3"},
+		{[]byte{0xd6, 0xc3, 0xc4, 0x00, 0x00, 0x00, 0x05}, "cannot read vcdiff window: unexpected EOF"},
+		{
+			[]byte{0xd6, 0xc3, 0xc4, 0x00, 0x00, 0x00, 0x05, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+			"cannot read vcdiff window: integer overflow",
+		}, {
+			delta(&testWindow{targetLen: 1 << 30}),
+			"cannot decode vcdiff window of 1073741824 bytes",
+		}, {
+			// ADD 2 with a single data byte
+			delta(&testWindow{targetLen: 2, data: []byte("a"), inst: []byte{3}}),
+			"cannot decode vcdiff window: add exceeds data section",
+		}, {
+			// ADD 2 in a window of 1
+			delta(&testWindow{targetLen: 1, data: []byte("ab"), inst: []byte{3}}),
+			"cannot decode vcdiff window: instruction exceeds target window",
+		}, {
+			// ADD 1 in a window of 2
+			delta(&testWindow{targetLen: 2, data: []byte("a"), inst: []byte{2}}),
+			"cannot decode vcdiff window: decoded 1 bytes but target window has 2",
+		}, {
+			// COPY 4 mode 0 from the future
+			delta(&testWindow{targetLen: 4, inst: []byte{20}, addr: []byte{0}}),
+			"cannot decode vcdiff window: copy address beyond current position",
+		}, {
+			// COPY 4 mode 0 without an address
+			delta(&testWindow{indicator: 0x01, sourceLen: 4, targetLen: 4, inst: []byte{20}}),
+			"cannot decode vcdiff window: unexpected EOF",
+		}, {
+			// COPY 4 mode 0 beyond the end of the source
+			delta(&testWindow{indicator: 0x01, sourceLen: 8, targetLen: 4, inst: []byte{20}, addr: []byte{4}}),
+			"cannot decode vcdiff window: cannot read source: unexpected EOF",
+		},
+	} {
+		_, err := s.apply(c, "hello", tc.delta)
+		c.Check(err, ErrorMatches, tc.err, Commentf("%x", tc.delta))
+	}
+}
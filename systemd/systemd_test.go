@@ -2487,6 +2487,27 @@ func (s *SystemdTestSuite) TestCurrentUsageFamilyHappy(c *C) {
 	})
 }
 
+func (s *SystemdTestSuite) TestCurrentCPUUsage(c *C) {
+	s.outs = [][]byte{
+		[]byte(`CPUUsageNSec=1500000000`),
+		[]byte(`CPUUsageNSec=[not set]`),
+		[]byte(`CPUUsageNSec=blah`),
+	}
+	sysd := New(SystemMode, s.rep)
+	cpuUsage, err := sysd.CurrentCPUUsage("foo.slice")
+	c.Assert(err, IsNil)
+	c.Check(cpuUsage, Equals, 1500*time.Millisecond)
+	_, err = sysd.CurrentCPUUsage("foo.slice")
+	c.Check(err, ErrorMatches, "cpu usage unavailable")
+	_, err = sysd.CurrentCPUUsage("foo.slice")
+	c.Check(err, ErrorMatches, `invalid property value from systemd for CPUUsageNSec: cannot parse "blah" as an integer`)
+	c.Check(s.argses, DeepEquals, [][]string{
+		{"show", "--property", "CPUUsageNSec", "foo.slice"},
+		{"show", "--property", "CPUUsageNSec", "foo.slice"},
+		{"show", "--property", "CPUUsageNSec", "foo.slice"},
+	})
+}
+
 func (s *SystemdTestSuite) TestInactiveEnterTimestampZero(c *C) {
 	s.outs = [][]byte{
 		[]byte(`InactiveEnterTimestamp=`),
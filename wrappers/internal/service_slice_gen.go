@@ -70,10 +70,35 @@ MemoryAccounting=true
 		valuesTemplate := `MemoryMax=%[1]d
 # for compatibility with older versions of systemd
 MemoryLimit=%[1]d
-
 `
 		fmt.Fprintf(buf, valuesTemplate, grp.MemoryLimit)
 	}
+	if grp.MemorySwapLimit != 0 {
+		// MemorySwapMax requires cgroup v2, which is checked when the
+		// limit is set
+		fmt.Fprintf(buf, "MemorySwapMax=%d\n", grp.MemorySwapLimit)
+	}
+	if grp.MemoryLimit != 0 || grp.MemorySwapLimit != 0 {
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+func formatIOGroupSlice(grp *quota.Group) string {
+	if grp.IOLimit == nil {
+		return ""
+	}
+	header := `# Always enable io accounting otherwise the IO bandwidth settings do nothing.
+IOAccounting=true
+`
+	buf := bytes.NewBufferString(header)
+	if grp.IOLimit.ReadBandwidth != 0 {
+		fmt.Fprintf(buf, "IOReadBandwidthMax=%s %d\n", grp.IOLimit.Device, grp.IOLimit.ReadBandwidth)
+	}
+	if grp.IOLimit.WriteBandwidth != 0 {
+		fmt.Fprintf(buf, "IOWriteBandwidthMax=%s %d\n", grp.IOLimit.Device, grp.IOLimit.WriteBandwidth)
+	}
+	buf.WriteString("\n")
 	return buf.String()
 }
 
@@ -97,6 +122,7 @@ func GenerateQuotaSliceUnitFile(grp *quota.Group) []byte {
 
 	cpuOptions := formatCpuGroupSlice(grp)
 	memoryOptions := formatMemoryGroupSlice(grp)
+	ioOptions := formatIOGroupSlice(grp)
 	taskOptions := formatTaskGroupSlice(grp)
 	template := `[Unit]
 Description=Slice for snap quota group %[1]s
@@ -107,6 +133,6 @@ X-Snappy=yes
 `
 
 	fmt.Fprintf(&buf, template, grp.Name)
-	fmt.Fprint(&buf, cpuOptions, memoryOptions, taskOptions)
+	fmt.Fprint(&buf, cpuOptions, memoryOptions, ioOptions, taskOptions)
 	return buf.Bytes()
 }